@@ -0,0 +1,466 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// Diagnostic is a problem found by an Analyzer.
+type Diagnostic struct {
+	Filename string
+	Pos      syntax.Pos
+	Text     string
+
+	// Rule identifies the check which found the problem, such as
+	// "undefined-variable". See WriteSARIF for the list of rules.
+	Rule string
+
+	// Fixes holds any suggested changes to solve the problem.
+	Fixes []Fix
+
+	// Severity is how serious the problem is. If empty, it is a warning.
+	Severity Severity
+}
+
+// Severity is how serious a Diagnostic is. See RuleSeverity.
+type Severity string
+
+const (
+	Error   Severity = "error"
+	Warning Severity = "warning"
+	Info    Severity = "info"
+
+	// Off disables a rule entirely.
+	Off Severity = "off"
+)
+
+// Fix is a suggested change to a file, made of any number of edits which
+// don't overlap.
+type Fix struct {
+	Text  string // describes the change
+	Edits []Edit
+}
+
+// Edit replaces the source between Pos and End with Text. If both
+// positions are equal, Text is inserted at that position.
+type Edit struct {
+	Pos, End syntax.Pos
+	Text     string
+}
+
+func (d Diagnostic) String() string {
+	prefix := ""
+	if d.Filename != "" {
+		prefix = d.Filename + ":"
+	}
+	return fmt.Sprintf("%s%d:%d: %s", prefix, d.Pos.Line(), d.Pos.Col(), d.Text)
+}
+
+// ResolveFunc maps the target of a source or . command to the contents
+// of the file it refers to. It is only called with targets that are
+// known statically, such as in "source ./lib.sh", or in "source $dir/lib.sh"
+// if dir has a static value; see StaticValues.
+//
+// Returning a nil reader and a nil error means that the target should be
+// silently ignored.
+type ResolveFunc func(name string) (io.Reader, error)
+
+// Analyzer checks shell programs for common mistakes. It is safe for
+// concurrent use, as long as its resolver and command functions are.
+type Analyzer struct {
+	parser   *syntax.Parser
+	resolve  ResolveFunc
+	commands func(name string) bool
+	known    map[string]bool
+	env      map[string]bool
+	sources  []string
+
+	severities map[string]Severity
+
+	dynamicEvals      bool
+	taint             bool
+	ignoredFailures   bool
+	portableEcho      bool
+	simplifyPipelines bool
+	quoteStyle        byte
+}
+
+// NewAnalyzer allocates a new Analyzer and applies any number of options.
+func NewAnalyzer(options ...func(*Analyzer)) *Analyzer {
+	a := &Analyzer{parser: syntax.NewParser()}
+	for _, opt := range options {
+		opt(a)
+	}
+	return a
+}
+
+// Resolver sets the function used to obtain the contents of sourced
+// files. The functions and variables defined in sourced files, and in
+// the files that those source in turn, are treated as defined by the
+// program being analyzed.
+//
+// If no resolver is set, source commands are ignored.
+func Resolver(fn ResolveFunc) func(*Analyzer) {
+	return func(a *Analyzer) { a.resolve = fn }
+}
+
+// Parser sets the parser used for sourced files. By default, a parser
+// with no options is used.
+func Parser(p *syntax.Parser) func(*Analyzer) {
+	return func(a *Analyzer) { a.parser = p }
+}
+
+// Commands sets a function reporting whether a program exists, such as
+// one built on top of exec.LookPath. When set, commands which are
+// neither functions, builtins, nor existing programs are reported.
+func Commands(fn func(name string) bool) func(*Analyzer) {
+	return func(a *Analyzer) { a.commands = fn }
+}
+
+// KnownCommands declares external commands which are known to exist,
+// even if the function set via Commands reports otherwise.
+func KnownCommands(names ...string) func(*Analyzer) {
+	return func(a *Analyzer) {
+		if a.known == nil {
+			a.known = make(map[string]bool, len(names))
+		}
+		for _, name := range names {
+			a.known[name] = true
+		}
+	}
+}
+
+// Sources declares files which are treated as sourced at the start of
+// every program, such as libraries sourced by a caller or via a path only
+// known at run time. They are obtained via the resolver, and are ignored
+// if none is set.
+func Sources(names ...string) func(*Analyzer) {
+	return func(a *Analyzer) { a.sources = append(a.sources, names...) }
+}
+
+// RuleSeverity sets the severity of the diagnostics reported by a rule.
+// Off stops the rule from being reported, and an empty severity restores
+// the default. Rules which are disabled by default, such as "taint", must
+// still be enabled via their option.
+func RuleSeverity(rule string, sev Severity) func(*Analyzer) {
+	return func(a *Analyzer) {
+		if a.severities == nil {
+			a.severities = make(map[string]Severity)
+		}
+		a.severities[rule] = sev
+	}
+}
+
+// DynamicEvals makes the analyzer report the uses of eval whose code is
+// only known at run time, such as eval "$cmd", as they may run arbitrary
+// code. Uses with static arguments only, like eval 'a=1', are benign; if
+// the program was parsed with syntax.ParseScriptArgs, their code is
+// checked like any other.
+func DynamicEvals(a *Analyzer) { a.dynamicEvals = true }
+
+// Taint makes the analyzer report the paths by which untrusted data, such
+// as the program's arguments, may reach dangerous commands, such as eval.
+// See TaintFlows for details.
+func Taint(a *Analyzer) { a.taint = true }
+
+// IgnoredFailures makes the analyzer report the programs that can exit
+// with status 0 after a failed command, such as cp in "cp a b; echo done".
+// Only commands which aren't builtins and whose status isn't checked are
+// reported. Programs which use errexit, like with "set -e", are not
+// checked. See ExitCodes for how exit statuses are known statically.
+func IgnoredFailures(a *Analyzer) { a.ignoredFailures = true }
+
+// Env declares variables that are expected to be inherited from the
+// environment. Upper case names like HOME are always assumed to come
+// from the environment.
+func Env(names ...string) func(*Analyzer) {
+	return func(a *Analyzer) {
+		if a.env == nil {
+			a.env = make(map[string]bool, len(names))
+		}
+		for _, name := range names {
+			a.env[name] = true
+		}
+	}
+}
+
+// Symbols returns the functions and variables defined by f, including
+// those defined by any files it sources. Sourced files that could not be
+// resolved or parsed are reported as diagnostics.
+func (a *Analyzer) Symbols(f *syntax.File) (*Symbols, []Diagnostic) {
+	sc := &symCollector{a: a, syms: newSymbols(),
+		seen: map[string]bool{f.Name: true}}
+	for _, name := range a.sources {
+		sc.source(f.Name, syntax.Pos{}, name)
+	}
+	sc.file(f)
+	sortDiags(sc.diags)
+	return sc.syms, sc.diags
+}
+
+// Analyze checks f and returns the problems found, sorted by position.
+// Sourced files are only used for their definitions; problems within
+// them are not reported.
+//
+// If f was parsed with syntax.KeepComments, comments like
+// "# sh:ignore=rule reason" suppress the problems of a rule within the
+// statement they are attached to, and "# sh:ignore-next-line=rule" within
+// the following line. Suppressions which aren't used are reported.
+func (a *Analyzer) Analyze(f *syntax.File) []Diagnostic {
+	syms, diags := a.Symbols(f)
+	add := func(d Diagnostic) {
+		d.Filename = f.Name
+		diags = append(diags, d)
+	}
+	report := func(rule string, pos syntax.Pos, format string, args ...interface{}) {
+		add(newDiag(rule, pos, format, args...))
+	}
+	syntax.Walk(f, func(node syntax.Node) bool {
+		switch x := node.(type) {
+		case *syntax.Stmt:
+			if ce, ok := x.Cmd.(*syntax.CallExpr); ok && a.portableEcho {
+				checkEcho(x, ce, add)
+			}
+		case *syntax.ParamExp:
+			if x.Param == nil || x.Names != 0 {
+				break
+			}
+			if x.Exp != nil {
+				switch x.Exp.Op {
+				case syntax.SubstPlus, syntax.SubstColPlus,
+					syntax.SubstMinus, syntax.SubstColMinus,
+					syntax.SubstQuest, syntax.SubstColQuest,
+					syntax.SubstAssgn, syntax.SubstColAssgn:
+					// the unset case is handled explicitly
+					return true
+				}
+			}
+			name := x.Param.Value
+			if a.defined(syms, name) {
+				break
+			}
+			report("undefined-variable", x.Param.Pos(), "undefined variable: %s", name)
+		case *syntax.CallExpr:
+			if len(x.Args) == 0 {
+				break
+			}
+			name, ok := wordLit(x.Args[0])
+			if a.dynamicEvals && name == "eval" && !allLit(x.Args[1:]) {
+				report("dynamic-eval", x.Args[0].Pos(), "eval of dynamic code")
+			}
+			if a.commands == nil || !ok || strings.ContainsRune(name, '/') {
+				break
+			}
+			if _, ok := syms.Funcs[name]; ok || syntax.IsBuiltin(name) || a.known[name] {
+				break
+			}
+			if !a.commands(name) {
+				report("undefined-command", x.Args[0].Pos(), "undefined command: %s", name)
+			}
+		}
+		return true
+	})
+	checkLoops(f, 0, add)
+	checkQuotes(f, a.quoteStyle, add)
+	checkCd(f, add)
+	if a.simplifyPipelines {
+		checkPipelines(f, syms.Funcs, add)
+	}
+	if a.taint {
+		for _, flow := range TaintFlows(f) {
+			d := newDiag("taint", flow.SinkPos, "%s", flow)
+			if flow.Sink == "rm unquoted" && !hasGlob(flow.sink) {
+				d.Fixes = []Fix{{Text: "quote the argument", Edits: []Edit{
+					{Pos: flow.sink.Pos(), End: flow.sink.Pos(), Text: `"`},
+					{Pos: flow.sink.End(), End: flow.sink.End(), Text: `"`},
+				}}}
+			}
+			add(d)
+		}
+	}
+	if a.ignoredFailures {
+		for _, ce := range ignoredFailures(f) {
+			name, _ := wordLit(ce.Args[0])
+			report("ignored-failure", ce.Args[0].Pos(),
+				"failure of %s is ignored; the program may still exit with status 0", name)
+		}
+	}
+	diags = applyIgnores(f, diags)
+	diags = a.applySeverities(diags)
+	sortDiags(diags)
+	return diags
+}
+
+// applySeverities drops the diagnostics of disabled rules and sets the
+// severity of the rest, reusing the slice.
+func (a *Analyzer) applySeverities(diags []Diagnostic) []Diagnostic {
+	if len(a.severities) == 0 {
+		return diags
+	}
+	kept := diags[:0]
+	for _, d := range diags {
+		switch sev := a.severities[d.Rule]; sev {
+		case Off:
+			continue
+		case "":
+		default:
+			d.Severity = sev
+		}
+		kept = append(kept, d)
+	}
+	return kept
+}
+
+// checkLoops reports the break and continue commands outside of loops, and
+// those whose level exceeds the number of enclosing loops. Function bodies
+// and subshells start with no enclosing loops, like in Bash.
+func checkLoops(node syntax.Node, depth int, add func(Diagnostic)) {
+	stmts := func(sl syntax.StmtList, depth int) {
+		for _, st := range sl.Stmts {
+			checkLoops(st, depth, add)
+		}
+	}
+	syntax.Walk(node, func(node syntax.Node) bool {
+		switch x := node.(type) {
+		case *syntax.WhileClause:
+			stmts(x.Cond, depth+1)
+			stmts(x.Do, depth+1)
+			return false
+		case *syntax.ForClause:
+			checkLoops(x.Loop, depth, add)
+			stmts(x.Do, depth+1)
+			return false
+		case *syntax.FuncDecl:
+			checkLoops(x.Body, 0, add)
+			return false
+		case *syntax.Subshell:
+			stmts(x.StmtList, 0)
+			return false
+		case *syntax.CmdSubst:
+			stmts(x.StmtList, 0)
+			return false
+		case *syntax.CallExpr:
+			if len(x.Args) == 0 {
+				break
+			}
+			name, _ := wordLit(x.Args[0])
+			if name != "break" && name != "continue" {
+				break
+			}
+			n, ok := loopLevel(x)
+			pos := x.Args[0].Pos()
+			switch {
+			case depth == 0:
+				add(newDiag("loop-control", pos, "%s is only useful in a loop", name))
+			case !ok:
+			case n == 0:
+				add(newDiag("loop-control", pos, "invalid %s level", name))
+			case n > depth:
+				// the shell leaves all loops, as if the level was depth
+				d := newDiag("loop-control", pos, "%s level %d exceeds loop depth %d",
+					name, n, depth)
+				level := x.Args[1]
+				d.Fixes = []Fix{{
+					Text:  fmt.Sprintf("use %s %d", name, depth),
+					Edits: []Edit{{Pos: level.Pos(), End: level.End(), Text: fmt.Sprint(depth)}},
+				}}
+				add(d)
+			}
+		}
+		return true
+	})
+}
+
+func newDiag(rule string, pos syntax.Pos, format string, args ...interface{}) Diagnostic {
+	return Diagnostic{Rule: rule, Pos: pos, Text: fmt.Sprintf(format, args...)}
+}
+
+// hasGlob reports whether a word has unquoted characters which would stop
+// working if the word was quoted, such as globs or tildes.
+func hasGlob(w *syntax.Word) bool {
+	for _, part := range w.Parts {
+		if lit, ok := part.(*syntax.Lit); ok && strings.ContainsAny(lit.Value, "*?[{~") {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *Analyzer) defined(syms *Symbols, name string) bool {
+	if _, ok := syms.Vars[name]; ok {
+		return true
+	}
+	if a.env[name] || strings.ToUpper(name) == name {
+		// includes special parameters like $@ and $1
+		return true
+	}
+	return false
+}
+
+type symCollector struct {
+	a     *Analyzer
+	syms  *Symbols
+	seen  map[string]bool
+	diags []Diagnostic
+}
+
+func (sc *symCollector) file(f *syntax.File) {
+	var vals *Values
+	sc.syms.collect(f.Name, f, func(ce *syntax.CallExpr) {
+		if sc.a.resolve == nil || len(ce.Args) < 2 {
+			return
+		}
+		if vals == nil {
+			vals = StaticValues(f)
+		}
+		if name, ok := vals.Word(ce.Args[1]); ok {
+			sc.source(f.Name, ce.Args[1].Pos(), name)
+		}
+	})
+}
+
+// source collects the definitions of a sourced file, whose name is known
+// statically, as in "source ./lib.sh" or "source $dir/lib.sh". Problems are
+// reported at pos in the file named from.
+func (sc *symCollector) source(from string, pos syntax.Pos, name string) {
+	if sc.a.resolve == nil || sc.seen[name] {
+		return
+	}
+	sc.seen[name] = true
+	report := func(err error) {
+		d := newDiag("source", pos, "could not source %s: %v", name, err)
+		d.Filename = from
+		sc.diags = append(sc.diags, d)
+	}
+	r, err := sc.a.resolve(name)
+	if err != nil {
+		report(err)
+		return
+	}
+	if r == nil {
+		return
+	}
+	f, err := sc.a.parser.Parse(r, name)
+	if err != nil {
+		report(err)
+		return
+	}
+	sc.file(f)
+}
+
+func sortDiags(diags []Diagnostic) {
+	sort.SliceStable(diags, func(i, j int) bool {
+		d1, d2 := diags[i], diags[j]
+		if d1.Filename != d2.Filename {
+			return d1.Filename < d2.Filename
+		}
+		return d1.Pos.Offset() < d2.Pos.Offset()
+	})
+}
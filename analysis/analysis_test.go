@@ -0,0 +1,208 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+func mapResolver(files map[string]string) ResolveFunc {
+	return func(name string) (io.Reader, error) {
+		src, ok := files[name]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return strings.NewReader(src), nil
+	}
+}
+
+var libFiles = map[string]string{
+	"lib.sh":      "libfn() { :; }\nlibvar=x\n. ./nested.sh",
+	"./nested.sh": "nestedfn() { :; }\nread -r nestedvar",
+	"loop.sh":     "source loop.sh\nloopvar=1",
+	"bad.sh":      "foo() {",
+}
+
+var analyzeTests = []struct {
+	src  string
+	want []string
+}{
+	{"foo=bar; echo $foo", nil},
+	{"echo $foo", []string{"1:7: undefined variable: foo"}},
+	{"echo ${foo}", []string{"1:8: undefined variable: foo"}},
+	{"echo $HOME $1 $@ $#", nil},
+	{"echo ${foo:-x} ${foo-x} ${foo+x} ${foo?x}", nil},
+	{"echo ${foo:=x}; echo $foo", nil},
+	{"for i in 1 2; do echo $i; done", nil},
+	{"read -r a b; echo $a $b", nil},
+	{"read; echo $REPLY", nil},
+	{"read -p prompt -a arr; echo $arr $prompt", []string{
+		"1:35: undefined variable: prompt",
+	}},
+	{"mapfile -t lines; echo $lines", nil},
+	{"while IFS= read -r line; do echo \"$line\"; done <f", nil},
+	{"IFS=: read -ra parts <<<\"$PATH\"; echo ${parts[0]}", nil},
+	{"read -t 5 -u 3 x y; echo $x $y", nil},
+	{"read -A arr; echo ${arr[1]}", nil},
+	{"readarray -d '' -t files <f; echo \"${files[@]}\"", nil},
+	{"read -r; mapfile; echo $REPLY ${MAPFILE[0]} $line", []string{
+		"1:46: undefined variable: line",
+	}},
+	{"printf -v out %s x; echo $out", nil},
+	{"getopts ab: opt; echo $opt", nil},
+	{"local x; export y=1; echo $x $y", nil},
+	{"a[1]=x; echo ${a[1]}", nil},
+	{"((n++)); let m=3; echo $n $m", nil},
+	{"f() { echo $1; }; f", nil},
+	{"echo ${!foo*}", nil},
+	{"source lib.sh; libfn; echo $libvar", nil},
+	{". lib.sh; nestedfn; echo $nestedvar", nil},
+	{"echo $libvar", []string{"1:7: undefined variable: libvar"}},
+	{"source loop.sh; echo $loopvar", nil},
+	{"source \"$dir/lib.sh\"; echo $libvar", []string{
+		"1:10: undefined variable: dir",
+		"1:29: undefined variable: libvar",
+	}},
+	{"dir=.; source \"$dir/nested.sh\"; echo $nestedvar", nil},
+	{"while true; do break; for i; do continue 2; done; done", nil},
+	{"for ((;;)); do while break 2; do :; done; done", nil},
+	{"break; continue 2", []string{
+		"1:1: break is only useful in a loop",
+		"1:8: continue is only useful in a loop",
+	}},
+	{"for i; do break 3; continue 0; break a; break 1 2; break $N; done", []string{
+		"1:11: break level 3 exceeds loop depth 1",
+		"1:20: invalid continue level",
+		"1:32: invalid break level",
+		"1:41: invalid break level",
+	}},
+	{"for i; do f() { break; }; (continue); echo $(break); done", []string{
+		"1:17: break is only useful in a loop",
+		"1:28: continue is only useful in a loop",
+		"1:46: break is only useful in a loop",
+	}},
+	{"source missing.sh", []string{
+		"1:8: could not source missing.sh: file does not exist",
+	}},
+	{"source bad.sh", []string{
+		"1:8: could not source bad.sh: bad.sh:1:7: reached EOF without matching { with }",
+	}},
+	{"tmp=x; trap 'rm -f \"$tmp\" \"$other\"' EXIT", []string{
+		"1:29: undefined variable: other",
+	}},
+	{"trap \"$cleanup\" EXIT", []string{"1:8: undefined variable: cleanup"}},
+	{"sh -c \"echo \\$nope\"", []string{"1:15: undefined variable: nope"}},
+	{"ssh host 'echo $nope'", []string{"1:17: undefined variable: nope"}},
+	{"x=1; xargs sh -c 'echo $x $1' _", nil},
+	{"env -u a b=1 sh -c 'echo $b'", nil},
+	{"make cc=gcc; echo $cc", []string{"1:20: undefined variable: cc"}},
+}
+
+func TestAnalyze(t *testing.T) {
+	t.Parallel()
+	a := NewAnalyzer(Resolver(mapResolver(libFiles)))
+	for i, tc := range analyzeTests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			f, err := syntax.NewParser(syntax.ParseTraps, syntax.ParseScriptArgs).Parse(strings.NewReader(tc.src), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, d := range a.Analyze(f) {
+				got = append(got, d.String())
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("Analyze mismatch in %q:\nwant: %q\ngot:  %q",
+					tc.src, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestAnalyzeCommands(t *testing.T) {
+	t.Parallel()
+	a := NewAnalyzer(
+		Resolver(mapResolver(libFiles)),
+		Commands(func(name string) bool { return name == "ls" }),
+		Env("foo"),
+	)
+	src := "source lib.sh\nls; libfn; cd; nope; ./local; echo $foo\nf() { :; }; f"
+	f, err := syntax.NewParser().Parse(strings.NewReader(src), "main.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range a.Analyze(f) {
+		got = append(got, d.String())
+	}
+	want := []string{"main.sh:2:16: undefined command: nope"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Analyze mismatch:\nwant: %q\ngot:  %q", want, got)
+	}
+}
+
+func TestAnalyzeDynamicEvals(t *testing.T) {
+	t.Parallel()
+	a := NewAnalyzer(DynamicEvals)
+	src := "eval 'a=1'; eval echo $a\neval \"$(ssh-agent)\"\nf() { eval \"$1\"; }; eval"
+	f, err := syntax.NewParser(syntax.ParseScriptArgs).Parse(strings.NewReader(src), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range a.Analyze(f) {
+		got = append(got, d.String())
+	}
+	want := []string{
+		"1:13: eval of dynamic code",
+		"2:1: eval of dynamic code",
+		"3:7: eval of dynamic code",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Analyze mismatch:\nwant: %q\ngot:  %q", want, got)
+	}
+}
+
+func TestSymbolsMerge(t *testing.T) {
+	t.Parallel()
+	a := NewAnalyzer(Resolver(mapResolver(libFiles)))
+	f, err := syntax.NewParser().Parse(strings.NewReader("source lib.sh\nmain() { :; }"), "main.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	syms, diags := a.Symbols(f)
+	if len(diags) > 0 {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+	wantFuncs := map[string]string{
+		"main":     "main.sh",
+		"libfn":    "lib.sh",
+		"nestedfn": "./nested.sh",
+	}
+	if len(syms.Funcs) != len(wantFuncs) {
+		t.Fatalf("want %d funcs, got %v", len(wantFuncs), syms.Funcs)
+	}
+	for name, file := range wantFuncs {
+		if got := syms.Funcs[name].Filename; got != file {
+			t.Errorf("func %s: want file %q, got %q", name, file, got)
+		}
+	}
+	other := newSymbols()
+	other.Vars["libvar"] = Symbol{Filename: "other.sh"}
+	other.Vars["extra"] = Symbol{Filename: "other.sh"}
+	syms.Merge(other)
+	if got := syms.Vars["libvar"].Filename; got != "lib.sh" {
+		t.Errorf("Merge overwrote libvar with %q", got)
+	}
+	if _, ok := syms.Vars["extra"]; !ok {
+		t.Errorf("Merge did not add extra")
+	}
+}
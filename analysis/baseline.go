@@ -0,0 +1,98 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package analysis
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+)
+
+// Baseline is a snapshot of known diagnostics, used to only report new
+// ones. This allows adopting the checks on a large project without fixing
+// all of its existing problems first.
+//
+// Diagnostics are matched by filename, rule and text, but not by position,
+// so that the baseline still applies after unrelated lines are added or
+// removed.
+type Baseline struct {
+	counts map[baselineKey]int
+}
+
+type baselineKey struct {
+	File string `json:"file,omitempty"`
+	Rule string `json:"rule,omitempty"`
+	Text string `json:"text"`
+}
+
+type baselineEntry struct {
+	baselineKey
+	Count int `json:"count"`
+}
+
+// NewBaseline returns a baseline holding the given diagnostics.
+func NewBaseline(diags []Diagnostic) *Baseline {
+	b := &Baseline{counts: make(map[baselineKey]int)}
+	for _, d := range diags {
+		b.counts[keyOf(d)]++
+	}
+	return b
+}
+
+func keyOf(d Diagnostic) baselineKey {
+	return baselineKey{File: d.Filename, Rule: d.Rule, Text: d.Text}
+}
+
+// ReadBaseline reads a baseline in the JSON format written by
+// Baseline.Write.
+func ReadBaseline(r io.Reader) (*Baseline, error) {
+	var entries []baselineEntry
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return nil, err
+	}
+	b := &Baseline{counts: make(map[baselineKey]int, len(entries))}
+	for _, e := range entries {
+		b.counts[e.baselineKey] += e.Count
+	}
+	return b, nil
+}
+
+// Write writes the baseline as a JSON array, sorted so that it can be
+// kept in version control with minimal diffs.
+func (b *Baseline) Write(w io.Writer) error {
+	entries := []baselineEntry{}
+	for key, count := range b.counts {
+		entries = append(entries, baselineEntry{key, count})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		k1, k2 := entries[i].baselineKey, entries[j].baselineKey
+		if k1.File != k2.File {
+			return k1.File < k2.File
+		}
+		if k1.Rule != k2.Rule {
+			return k1.Rule < k2.Rule
+		}
+		return k1.Text < k2.Text
+	})
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(entries)
+}
+
+// Filter returns the diagnostics which are not in the baseline, keeping
+// their order. If the baseline holds a diagnostic n times, only its first
+// n occurrences are left out.
+func (b *Baseline) Filter(diags []Diagnostic) []Diagnostic {
+	seen := make(map[baselineKey]int)
+	var fresh []Diagnostic
+	for _, d := range diags {
+		key := keyOf(d)
+		if seen[key] < b.counts[key] {
+			seen[key]++
+			continue
+		}
+		fresh = append(fresh, d)
+	}
+	return fresh
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package analysis
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+func TestBaseline(t *testing.T) {
+	t.Parallel()
+	analyze := func(src string) []Diagnostic {
+		f, err := syntax.NewParser().Parse(strings.NewReader(src), "a.sh")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return NewAnalyzer().Analyze(f)
+	}
+	var buf bytes.Buffer
+	if err := NewBaseline(analyze("echo $x $x\nbreak")).Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `[
+	{
+		"file": "a.sh",
+		"rule": "loop-control",
+		"text": "break is only useful in a loop",
+		"count": 1
+	},
+	{
+		"file": "a.sh",
+		"rule": "undefined-variable",
+		"text": "undefined variable: x",
+		"count": 2
+	}
+]
+`
+	if got := buf.String(); got != want {
+		t.Fatalf("Write mismatch:\nwant:\n%s\ngot:\n%s", want, got)
+	}
+	b, err := ReadBaseline(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// lines moved, one more x and a new variable
+	var got []string
+	for _, d := range b.Filter(analyze("\n\necho $x $y $x $x\nbreak")) {
+		got = append(got, d.String())
+	}
+	wantNew := []string{
+		"a.sh:3:10: undefined variable: y",
+		"a.sh:3:16: undefined variable: x",
+	}
+	if !reflect.DeepEqual(got, wantNew) {
+		t.Fatalf("Filter mismatch:\nwant: %q\ngot:  %q", wantNew, got)
+	}
+}
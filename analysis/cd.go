@@ -0,0 +1,86 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package analysis
+
+import (
+	"mvdan.cc/sh/syntax"
+)
+
+// isCd reports whether a statement is a call to cd with arguments.
+func isCd(st *syntax.Stmt) bool {
+	ce, ok := st.Cmd.(*syntax.CallExpr)
+	if !ok || len(ce.Args) < 2 {
+		return false
+	}
+	name, _ := wordLit(ce.Args[0])
+	return name == "cd"
+}
+
+// checkCd reports the cd commands whose failure is not handled, as the
+// commands after them would run in the wrong directory, and those which
+// run in a subshell without anything after them, as they have no effect.
+func checkCd(f *syntax.File, add func(Diagnostic)) {
+	inSubshell := make(map[*syntax.Stmt]bool)
+	lastInSubshell := func(sl syntax.StmtList) {
+		if n := len(sl.Stmts); n > 0 && isCd(sl.Stmts[n-1]) {
+			inSubshell[sl.Stmts[n-1]] = true
+		}
+	}
+	syntax.Walk(f, func(node syntax.Node) bool {
+		switch x := node.(type) {
+		case *syntax.CmdSubst:
+			lastInSubshell(x.StmtList)
+		case *syntax.Subshell:
+			lastInSubshell(x.StmtList)
+		case *syntax.BinaryCmd:
+			if x.Op != syntax.Pipe && x.Op != syntax.PipeAll {
+				break
+			}
+			for _, st := range []*syntax.Stmt{x.X, x.Y} {
+				if isCd(st) {
+					inSubshell[st] = true
+				}
+			}
+		}
+		return true
+	})
+	for st := range inSubshell {
+		add(newDiag("cd-subshell", st.Pos(),
+			"cd runs in a subshell, so it does not change the directory of the shell"))
+	}
+	if errexit(f) {
+		return
+	}
+
+	g := BuildCFG(f)
+	check := func(g *CFG, leave string) {
+		for _, block := range g.Blocks {
+			for i, node := range block.Nodes {
+				st, ok := node.(*syntax.Stmt)
+				if !ok || !isCd(st) || inSubshell[st] || st.Background || st.Negated {
+					continue
+				}
+				last := i == len(block.Nodes)-1
+				if last && len(block.Succs) == 2 {
+					continue // a condition, like in "cd dir || exit"
+				}
+				if last && len(block.Succs) == 1 && block.Succs[0] == g.Exit {
+					continue // nothing runs after it
+				}
+				d := newDiag("cd-unchecked", st.Pos(),
+					"cd may fail, and the commands after it would run in the wrong directory")
+				end := stmtEnd(st)
+				d.Fixes = []Fix{{
+					Text:  "use cd ... || " + leave,
+					Edits: []Edit{{Pos: end, End: end, Text: " || " + leave}},
+				}}
+				add(d)
+			}
+		}
+	}
+	check(g, "exit")
+	for _, fg := range g.Funcs {
+		check(fg, "return")
+	}
+}
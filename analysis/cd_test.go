@@ -0,0 +1,72 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package analysis
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+var cdTests = []struct {
+	src  string
+	want []string
+}{
+	{"cd dir; make", []string{
+		"1:1: cd may fail, and the commands after it would run in the wrong directory => 1:7: || exit",
+	}},
+	{"cd dir 2>/dev/null\nmake", []string{
+		"1:1: cd may fail, and the commands after it would run in the wrong directory => 1:19: || exit",
+	}},
+	{"f() {\n\tcd dir\n\tmake\n}", []string{
+		"2:2: cd may fail, and the commands after it would run in the wrong directory => 2:8: || return",
+	}},
+	{"cd dir || exit; make", nil},
+	{"cd dir && make", nil},
+	{"if cd dir; then make; fi", nil},
+	{"if ! cd dir; then exit 1; fi; make", nil},
+	{"make; cd dir", nil},
+	{"cd; make", nil},
+	{"set -e; cd dir; make", nil},
+	{"x=$(cd dir; pwd)", nil},
+	{"x=$(cd dir)", []string{
+		"1:5: cd runs in a subshell, so it does not change the directory of the shell",
+	}},
+	{"(make; cd dir); make", []string{
+		"1:8: cd runs in a subshell, so it does not change the directory of the shell",
+	}},
+	{"(cd dir && make)", nil},
+	{"echo dir | cd; ls | cd dir", []string{
+		"1:21: cd runs in a subshell, so it does not change the directory of the shell",
+	}},
+}
+
+func TestAnalyzeCd(t *testing.T) {
+	t.Parallel()
+	a := NewAnalyzer(Env("dir", "x"))
+	for i, tc := range cdTests {
+		t.Run(fmt.Sprintf("%02d", i), func(t *testing.T) {
+			f, err := syntax.NewParser().Parse(strings.NewReader(tc.src), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, d := range a.Analyze(f) {
+				s := d.String()
+				for _, fix := range d.Fixes {
+					e := fix.Edits[0]
+					s += fmt.Sprintf(" => %d:%d:%s", e.Pos.Line(), e.Pos.Col(), e.Text)
+				}
+				got = append(got, s)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("Analyze mismatch in %q:\nwant: %q\ngot:  %q",
+					tc.src, tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,418 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package analysis
+
+import (
+	"strconv"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// CFG is the control-flow graph of a shell program, or of a function body.
+//
+// Only the code run directly by the shell is included; the statements in
+// command substitutions, trap handlers and other nested code are not.
+// Redirections of compound commands are not included either.
+type CFG struct {
+	// Blocks holds all the blocks of the graph, in the order they were
+	// created. Entry is the first one, and Exit is the last one.
+	Blocks []*Block
+
+	// Entry is the block where the program starts, and Exit is an empty
+	// block where it finishes, be it by running off the end, or via
+	// exit or return.
+	Entry, Exit *Block
+
+	// Funcs holds the graph of each function body declared in the
+	// program, including nested ones. Within a function body, both exit and
+	// return lead to its Exit block.
+	Funcs map[*syntax.FuncDecl]*CFG
+}
+
+// Block is a basic block; a sequence of nodes always run one after the
+// other.
+//
+// Nodes are *syntax.Stmt for simple commands such as calls, declarations
+// or function declarations, *syntax.CaseClause when the word of a case
+// clause is expanded, *syntax.CaseItem when its patterns are matched,
+// *syntax.WordIter when a for or select loop moves to its next item, and
+// syntax.ArithmExpr for the expressions of C-style loops.
+//
+// A block with two successors ends with a condition; the first successor
+// is taken if its exit status is zero, and the second otherwise. Blocks
+// which cannot be reached from the entry block hold unreachable code, such
+// as the code after an exit.
+type Block struct {
+	Index int // position in CFG.Blocks
+	Nodes []syntax.Node
+	Succs []*Block
+	Preds []*Block
+}
+
+// BuildCFG builds the control-flow graph of a file, including the
+// short-circuits of && and ||, loops, break and continue with static
+// levels, return and exit.
+//
+// Levels that aren't static, such as in "break $n", are taken as 1.
+// Subshells, background commands and pipeline components are treated as
+// running in place, but exit and return only leave them, not the enclosing
+// program.
+func BuildCFG(f *syntax.File) *CFG {
+	funcs := make(map[*syntax.FuncDecl]*CFG)
+	return buildCFG(f.Stmts, funcs)
+}
+
+func buildCFG(stmts []*syntax.Stmt, funcs map[*syntax.FuncDecl]*CFG) *CFG {
+	g := &CFG{Funcs: funcs}
+	b := &cfgBuilder{g: g}
+	g.Entry = b.newBlock()
+	exit := &Block{}
+	b.cur, b.exit, b.ret = g.Entry, exit, exit
+	b.stmts(stmts)
+	b.jump(exit)
+	exit.Index = len(g.Blocks)
+	g.Blocks = append(g.Blocks, exit)
+	g.Exit = exit
+	return g
+}
+
+type loopTargets struct {
+	brk, cont *Block
+}
+
+type cfgBuilder struct {
+	g   *CFG
+	cur *Block
+
+	loops     []loopTargets // innermost last
+	exit, ret *Block
+}
+
+func (b *cfgBuilder) newBlock() *Block {
+	block := &Block{Index: len(b.g.Blocks)}
+	b.g.Blocks = append(b.g.Blocks, block)
+	return block
+}
+
+func addEdge(from, to *Block) {
+	from.Succs = append(from.Succs, to)
+	to.Preds = append(to.Preds, from)
+}
+
+// jump ends the current block with an edge to target.
+func (b *cfgBuilder) jump(target *Block) {
+	addEdge(b.cur, target)
+}
+
+// branch ends the current block with a condition.
+func (b *cfgBuilder) branch(t, f *Block) {
+	addEdge(b.cur, t)
+	addEdge(b.cur, f)
+}
+
+func (b *cfgBuilder) stmts(stmts []*syntax.Stmt) {
+	for _, st := range stmts {
+		b.stmt(st)
+	}
+}
+
+// condList builds a list of statements whose last one is a condition.
+func (b *cfgBuilder) condList(stmts []*syntax.Stmt, t, f *Block) {
+	if len(stmts) == 0 {
+		b.branch(t, f)
+		return
+	}
+	b.stmts(stmts[:len(stmts)-1])
+	b.cond(stmts[len(stmts)-1], t, f)
+}
+
+// cond builds a statement used as a condition, continuing at t if it
+// succeeds and at f otherwise.
+func (b *cfgBuilder) cond(st *syntax.Stmt, t, f *Block) {
+	if simpleStmt(st) && !st.Background && !st.Coprocess {
+		// a negated statement is a single node, so its exit status
+		// is already negated
+		b.cur.Nodes = append(b.cur.Nodes, st)
+		if !b.control(st) {
+			b.branch(t, f)
+		}
+		return
+	}
+	if st.Negated {
+		t, f = f, t
+	}
+	if st.Background || st.Coprocess {
+		b.stmt(st)
+		b.branch(t, f)
+		return
+	}
+	switch x := st.Cmd.(type) {
+	case *syntax.BinaryCmd:
+		switch x.Op {
+		case syntax.AndStmt:
+			mid := b.newBlock()
+			b.cond(x.X, mid, f)
+			b.cur = mid
+			b.cond(x.Y, t, f)
+			return
+		case syntax.OrStmt:
+			mid := b.newBlock()
+			b.cond(x.X, t, mid)
+			b.cur = mid
+			b.cond(x.Y, t, f)
+			return
+		}
+	case *syntax.Block:
+		b.condList(x.Stmts, t, f)
+		return
+	}
+	b.stmt(st)
+	b.branch(t, f)
+}
+
+// simpleStmt reports whether a statement is added to a block as a single
+// node.
+func simpleStmt(st *syntax.Stmt) bool {
+	switch st.Cmd.(type) {
+	case nil, *syntax.CallExpr, *syntax.DeclClause, *syntax.ArithmCmd,
+		*syntax.TestClause, *syntax.LetClause, *syntax.FuncDecl:
+		return true
+	}
+	return false
+}
+
+func (b *cfgBuilder) stmt(st *syntax.Stmt) {
+	if st.Background || st.Coprocess {
+		b.sub(func() { b.cmd(st) })
+		return
+	}
+	b.cmd(st)
+}
+
+func (b *cfgBuilder) cmd(st *syntax.Stmt) {
+	if simpleStmt(st) {
+		b.cur.Nodes = append(b.cur.Nodes, st)
+		if fd, ok := st.Cmd.(*syntax.FuncDecl); ok {
+			b.g.Funcs[fd] = buildCFG([]*syntax.Stmt{fd.Body}, b.g.Funcs)
+		}
+		if b.control(st) {
+			b.cur = b.newBlock() // unreachable, like after a break
+		}
+		return
+	}
+	switch x := st.Cmd.(type) {
+	case *syntax.Block:
+		b.stmts(x.Stmts)
+	case *syntax.NamespaceClause:
+		b.stmts(x.Stmts)
+	case *syntax.Subshell:
+		b.sub(func() { b.stmts(x.Stmts) })
+	case *syntax.TimeClause:
+		if x.Stmt != nil {
+			b.stmt(x.Stmt)
+		}
+	case *syntax.CoprocClause:
+		b.sub(func() { b.stmt(x.Stmt) })
+	case *syntax.AnonFunc:
+		after := b.newBlock()
+		oldRet := b.ret
+		b.ret = after
+		b.stmt(x.Body)
+		b.ret = oldRet
+		b.jump(after)
+		b.cur = after
+	case *syntax.BinaryCmd:
+		after := b.newBlock()
+		switch x.Op {
+		case syntax.AndStmt, syntax.OrStmt:
+			mid := b.newBlock()
+			if x.Op == syntax.AndStmt {
+				b.cond(x.X, mid, after)
+			} else {
+				b.cond(x.X, after, mid)
+			}
+			b.cur = mid
+			b.stmt(x.Y)
+		default: // Pipe, PipeAll
+			b.sub(func() { b.stmt(x.X) })
+			b.sub(func() { b.stmt(x.Y) })
+		}
+		b.jump(after)
+		b.cur = after
+	case *syntax.IfClause:
+		then, els, after := b.newBlock(), b.newBlock(), b.newBlock()
+		b.condList(x.Cond.Stmts, then, els)
+		b.cur = then
+		b.stmts(x.Then.Stmts)
+		b.jump(after)
+		b.cur = els
+		b.stmts(x.Else.Stmts)
+		b.jump(after)
+		b.cur = after
+	case *syntax.WhileClause:
+		head, body, after := b.newBlock(), b.newBlock(), b.newBlock()
+		b.jump(head)
+		b.cur = head
+		if x.Until {
+			b.condList(x.Cond.Stmts, after, body)
+		} else {
+			b.condList(x.Cond.Stmts, body, after)
+		}
+		b.cur = body
+		b.loop(x.Do.Stmts, after, head)
+		b.jump(head)
+		b.cur = after
+	case *syntax.ForClause:
+		b.forClause(x)
+	case *syntax.CaseClause:
+		b.caseClause(x)
+	}
+}
+
+func (b *cfgBuilder) forClause(fc *syntax.ForClause) {
+	head, body, after := b.newBlock(), b.newBlock(), b.newBlock()
+	cont := head
+	switch x := fc.Loop.(type) {
+	case *syntax.WordIter:
+		b.jump(head)
+		b.cur = head
+		b.cur.Nodes = append(b.cur.Nodes, x)
+		b.branch(body, after)
+	case *syntax.CStyleLoop:
+		if x.Init != nil {
+			b.cur.Nodes = append(b.cur.Nodes, x.Init)
+		}
+		b.jump(head)
+		b.cur = head
+		if x.Cond != nil {
+			b.cur.Nodes = append(b.cur.Nodes, x.Cond)
+			b.branch(body, after)
+		} else {
+			b.jump(body)
+		}
+		if x.Post != nil {
+			cont = b.newBlock()
+			cont.Nodes = append(cont.Nodes, x.Post)
+			addEdge(cont, head)
+		}
+	}
+	b.cur = body
+	b.loop(fc.Do.Stmts, after, cont)
+	b.jump(cont)
+	b.cur = after
+}
+
+func (b *cfgBuilder) caseClause(cc *syntax.CaseClause) {
+	b.cur.Nodes = append(b.cur.Nodes, cc)
+	if len(cc.Items) == 0 {
+		return
+	}
+	tests := make([]*Block, len(cc.Items))
+	bodies := make([]*Block, len(cc.Items))
+	tests[0] = b.cur
+	for i := range cc.Items {
+		if i > 0 {
+			tests[i] = b.newBlock()
+		}
+		bodies[i] = b.newBlock()
+	}
+	after := b.newBlock()
+	for i, ci := range cc.Items {
+		next, nextBody := after, after
+		if i+1 < len(cc.Items) {
+			next, nextBody = tests[i+1], bodies[i+1]
+		}
+		b.cur = tests[i]
+		b.cur.Nodes = append(b.cur.Nodes, ci)
+		b.branch(bodies[i], next)
+		b.cur = bodies[i]
+		b.stmts(ci.Stmts)
+		switch ci.Op {
+		case syntax.Fallthrough:
+			b.jump(nextBody)
+		case syntax.Resume, syntax.ResumeKorn:
+			b.jump(next)
+		default:
+			b.jump(after)
+		}
+	}
+	b.cur = after
+}
+
+// loop builds the body of a loop.
+func (b *cfgBuilder) loop(stmts []*syntax.Stmt, brk, cont *Block) {
+	b.loops = append(b.loops, loopTargets{brk: brk, cont: cont})
+	b.stmts(stmts)
+	b.loops = b.loops[:len(b.loops)-1]
+}
+
+// sub builds code in a subshell, which exit and return only leave, and
+// whose loop control commands don't affect enclosing loops.
+func (b *cfgBuilder) sub(fn func()) {
+	after := b.newBlock()
+	oldLoops, oldExit, oldRet := b.loops, b.exit, b.ret
+	b.loops, b.exit, b.ret = nil, after, after
+	fn()
+	b.loops, b.exit, b.ret = oldLoops, oldExit, oldRet
+	b.jump(after)
+	b.cur = after
+}
+
+// control handles a statement that can change the control flow, such as
+// exit or break. If it does, it ends the current block and returns true.
+func (b *cfgBuilder) control(st *syntax.Stmt) bool {
+	ce, ok := st.Cmd.(*syntax.CallExpr)
+	if !ok || len(ce.Args) == 0 {
+		return false
+	}
+	name, _ := wordLit(ce.Args[0])
+	switch name {
+	case "exit":
+		b.jump(b.exit)
+	case "return":
+		b.jump(b.ret)
+	case "break", "continue":
+		if len(b.loops) == 0 {
+			return false
+		}
+		n, ok := loopLevel(ce)
+		if !ok || n == 0 {
+			n = 1
+		}
+		if n > len(b.loops) {
+			n = len(b.loops)
+		}
+		lt := b.loops[len(b.loops)-n]
+		if name == "break" {
+			b.jump(lt.brk)
+		} else {
+			b.jump(lt.cont)
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// loopLevel returns the number of loops left by a break or continue
+// command, such as 2 in "break 2", or 1 if none is given. If the level
+// isn't static, ok is false. If it is invalid, such as in "break 0" or
+// "break a", n is 0.
+func loopLevel(ce *syntax.CallExpr) (n int, ok bool) {
+	switch len(ce.Args) {
+	case 1:
+		return 1, true
+	case 2:
+	default:
+		return 0, true
+	}
+	s, ok := wordLit(ce.Args[1])
+	if !ok {
+		return 0, false
+	}
+	if n, err := strconv.Atoi(s); err == nil && n > 0 {
+		return n, true
+	}
+	return 0, true
+}
@@ -0,0 +1,258 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package analysis
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// formatCFG prints each block of a graph in a single line, showing the
+// source of its nodes and the indexes of its successors.
+func formatCFG(src string, g *CFG) []string {
+	var lines []string
+	for _, block := range g.Blocks {
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "%d:", block.Index)
+		for _, node := range block.Nodes {
+			fmt.Fprintf(&buf, " %q", src[node.Pos().Offset():node.End().Offset()])
+		}
+		if len(block.Succs) > 0 {
+			buf.WriteString(" ->")
+		}
+		for _, succ := range block.Succs {
+			fmt.Fprintf(&buf, " %d", succ.Index)
+		}
+		lines = append(lines, buf.String())
+	}
+	return lines
+}
+
+var cfgTests = []struct {
+	src  string
+	want []string
+}{
+	{"", []string{
+		"0: -> 1",
+		"1:",
+	}},
+	{"a; b", []string{
+		"0: \"a;\" \"b\" -> 1",
+		"1:",
+	}},
+	{"! a && b", []string{
+		"0: \"! a\" -> 2 1",
+		"1: -> 3",
+		"2: \"b\" -> 1",
+		"3:",
+	}},
+	{"a && b; c", []string{
+		"0: \"a\" -> 2 1",
+		"1: \"c\" -> 3",
+		"2: \"b\" -> 1",
+		"3:",
+	}},
+	{"a || b", []string{
+		"0: \"a\" -> 1 2",
+		"1: -> 3",
+		"2: \"b\" -> 1",
+		"3:",
+	}},
+	{"! a && b || c", []string{
+		"0: \"! a\" -> 3 2",
+		"1: -> 4",
+		"2: \"c\" -> 1",
+		"3: \"b\" -> 1 2",
+		"4:",
+	}},
+	{"if a; then b; elif c; then d; else e; fi", []string{
+		"0: \"a;\" -> 1 2",
+		"1: \"b;\" -> 3",
+		"2: \"c;\" -> 4 5",
+		"3: -> 7",
+		"4: \"d;\" -> 6",
+		"5: \"e;\" -> 6",
+		"6: -> 3",
+		"7:",
+	}},
+	{"while a; do b; done; c", []string{
+		"0: -> 1",
+		"1: \"a;\" -> 2 3",
+		"2: \"b;\" -> 1",
+		"3: \"c\" -> 4",
+		"4:",
+	}},
+	{"until a; do b; done", []string{
+		"0: -> 1",
+		"1: \"a;\" -> 3 2",
+		"2: \"b;\" -> 1",
+		"3: -> 4",
+		"4:",
+	}},
+	{"for i in x y; do a; continue; b; done", []string{
+		"0: -> 1",
+		"1: \"i in x y\" -> 2 3",
+		"2: \"a;\" \"continue;\" -> 1",
+		"3: -> 5",
+		"4: \"b;\" -> 1",
+		"5:",
+	}},
+	{"for ((i = 0; i < 3; i++)); do a; done", []string{
+		"0: \"i = 0\" -> 1",
+		"1: \"i < 3\" -> 2 3",
+		"2: \"a;\" -> 4",
+		"3: -> 5",
+		"4: \"i++\" -> 1",
+		"5:",
+	}},
+	{"for ((;;)); do break; done", []string{
+		"0: -> 1",
+		"1: -> 2",
+		"2: \"break;\" -> 3",
+		"3: -> 5",
+		"4: -> 1",
+		"5:",
+	}},
+	{"while a; do for i; do break 2; done; done", []string{
+		"0: -> 1",
+		"1: \"a;\" -> 2 3",
+		"2: -> 4",
+		"3: -> 8",
+		"4: \"i\" -> 5 6",
+		"5: \"break 2;\" -> 3",
+		"6: -> 1",
+		"7: -> 4",
+		"8:",
+	}},
+	{"while a; do for i; do continue 5; done; done", []string{
+		"0: -> 1",
+		"1: \"a;\" -> 2 3",
+		"2: -> 4",
+		"3: -> 8",
+		"4: \"i\" -> 5 6",
+		"5: \"continue 5;\" -> 1",
+		"6: -> 1",
+		"7: -> 4",
+		"8:",
+	}},
+	{"case x in a) b ;; c) d ;& e) ;;& f) g ;; esac", []string{
+		"0: \"case x in a) b ;; c) d ;& e) ;;& f) g ;; esac\" \"a) b ;;\" -> 1 2",
+		"1: \"b\" -> 8",
+		"2: \"c) d ;&\" -> 3 4",
+		"3: \"d\" -> 5",
+		"4: \"e) ;;&\" -> 5 6",
+		"5: -> 6",
+		"6: \"f) g ;;\" -> 7 8",
+		"7: \"g\" -> 8",
+		"8: -> 9",
+		"9:",
+	}},
+	{"exit 1; a", []string{
+		"0: \"exit 1;\" -> 2",
+		"1: \"a\" -> 2",
+		"2:",
+	}},
+	{"f() { a; return; b; }; f; exit", []string{
+		"0: \"f() { a; return; b; };\" \"f;\" \"exit\" -> 2",
+		"1: -> 2",
+		"2:",
+	}},
+	{"(exit 1); a", []string{
+		"0: \"exit 1\" -> 1",
+		"1: \"a\" -> 3",
+		"2: -> 1",
+		"3:",
+	}},
+	{"a | exit; b", []string{
+		"0: \"a\" -> 2",
+		"1: \"b\" -> 5",
+		"2: \"exit\" -> 3",
+		"3: -> 1",
+		"4: -> 3",
+		"5:",
+	}},
+	{"if exit; then a; fi", []string{
+		"0: \"exit;\" -> 4",
+		"1: \"a;\" -> 3",
+		"2: -> 3",
+		"3: -> 4",
+		"4:",
+	}},
+	{"if (a); then b; fi", []string{
+		"0: \"a\" -> 4",
+		"1: \"b;\" -> 3",
+		"2: -> 3",
+		"3: -> 5",
+		"4: -> 1 2",
+		"5:",
+	}},
+	{"a & b", []string{
+		"0: \"a &\" -> 1",
+		"1: \"b\" -> 2",
+		"2:",
+	}},
+	{"{ a; b; } || c", []string{
+		"0: \"a;\" \"b;\" -> 1 2",
+		"1: -> 3",
+		"2: \"c\" -> 1",
+		"3:",
+	}},
+	{"break; a", []string{
+		"0: \"break;\" \"a\" -> 1",
+		"1:",
+	}},
+	{"while a; do (break); b; done", []string{
+		"0: -> 1",
+		"1: \"a;\" -> 2 3",
+		"2: \"break\" -> 4",
+		"3: -> 5",
+		"4: \"b;\" -> 1",
+		"5:",
+	}},
+}
+
+func TestBuildCFG(t *testing.T) {
+	t.Parallel()
+	p := syntax.NewParser()
+	for i, tc := range cfgTests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			f, err := p.Parse(strings.NewReader(tc.src), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := formatCFG(tc.src, BuildCFG(f))
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("BuildCFG mismatch in %q:\nwant: %q\ngot:  %q",
+					tc.src, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestBuildCFGFuncs(t *testing.T) {
+	t.Parallel()
+	src := "f() { a; return; b; }; g() { h() { exit; }; }; f"
+	f, err := syntax.NewParser().Parse(strings.NewReader(src), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := BuildCFG(f)
+	want := map[string][]string{
+		"f": {`0: "a;" "return;" -> 2`, `1: "b;" -> 2`, "2:"},
+		"g": {`0: "h() { exit; };" -> 1`, "1:"},
+		"h": {`0: "exit;" -> 2`, "1: -> 2", "2:"},
+	}
+	got := make(map[string][]string)
+	for fd, fg := range g.Funcs {
+		got[fd.Name.Value] = formatCFG(src, fg)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("BuildCFG funcs mismatch:\nwant: %q\ngot:  %q", want, got)
+	}
+}
@@ -0,0 +1,325 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package analysis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ConfigFile is the name of the file holding the configuration of a
+// project, as found by FindConfig.
+const ConfigFile = ".shlint.yaml"
+
+// Config is the configuration of the checks run on a project. It is
+// usually loaded from a file like the following:
+//
+//	rules:
+//	  undefined-command: off
+//	  taint: error
+//	commands: [mytool, deploy]
+//	env:
+//	  - BUILD_ID
+//	sources:
+//	  - lib/common.sh
+//	exclude:
+//	  - vendor
+//	  - "*.bats"
+//	quotes: single
+//
+// Rules may be set to off, on, info, warning or error; on enables a rule
+// with its default severity. Quotes may be single or double, and enables
+// the quote-style rule; see QuoteStyle.
+type Config struct {
+	// Dir is the directory holding the configuration file. Sources and
+	// excluded paths are relative to it.
+	Dir string
+
+	Rules    map[string]Severity
+	Commands []string // see KnownCommands
+	Env      []string // see Env
+	Sources  []string // see Sources
+	Exclude  []string // see Config.Excluded
+	Quotes   string   // see QuoteStyle
+}
+
+// optInRules are the rules which must be enabled via an option.
+var optInRules = map[string]func(*Analyzer){
+	"dynamic-eval":    DynamicEvals,
+	"taint":           Taint,
+	"ignored-failure": IgnoredFailures,
+	"quote-style":     QuoteStyle('\''),
+	"echo-flags":      PortableEcho,
+	"useless-cat":     SimplifyPipelines,
+	"grep-count":      SimplifyPipelines,
+	"ls-grep":         SimplifyPipelines,
+}
+
+// Options returns the options to apply the configuration to an Analyzer,
+// which may be combined with others such as Resolver.
+func (c *Config) Options() []func(*Analyzer) {
+	var opts []func(*Analyzer)
+	for rule, sev := range c.Rules {
+		opts = append(opts, RuleSeverity(rule, sev))
+		if opt := optInRules[rule]; opt != nil && sev != Off {
+			opts = append(opts, opt)
+		}
+	}
+	switch c.Quotes {
+	case "single":
+		opts = append(opts, QuoteStyle('\''))
+	case "double":
+		opts = append(opts, QuoteStyle('"'))
+	}
+	if len(c.Commands) > 0 {
+		opts = append(opts, KnownCommands(c.Commands...))
+	}
+	if len(c.Env) > 0 {
+		opts = append(opts, Env(c.Env...))
+	}
+	if len(c.Sources) > 0 {
+		names := make([]string, len(c.Sources))
+		for i, name := range c.Sources {
+			names[i] = filepath.Join(c.Dir, name)
+		}
+		opts = append(opts, Sources(names...))
+	}
+	return opts
+}
+
+// Excluded reports whether a file should not be checked. Patterns
+// containing a slash, like "test/data", match a path relative to Dir or
+// any of its parent directories. Other patterns, like "*.bats", match any
+// element of the path.
+func (c *Config) Excluded(name string) bool {
+	if c.Dir != "" {
+		if rel, err := filepath.Rel(c.Dir, name); err == nil {
+			name = rel
+		}
+	}
+	elems := strings.Split(filepath.ToSlash(filepath.Clean(name)), "/")
+	for _, pattern := range c.Exclude {
+		pattern = strings.TrimSuffix(pattern, "/")
+		for i, elem := range elems {
+			if !strings.Contains(pattern, "/") {
+				if ok, _ := path.Match(pattern, elem); ok {
+					return true
+				}
+				continue
+			}
+			prefix := strings.Join(elems[:i+1], "/")
+			if ok, _ := path.Match(pattern, prefix); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FindConfig looks for ConfigFile in dir and its parent directories, and
+// loads the first one found. If there is none, it returns nil and no
+// error.
+func FindConfig(dir string) (*Config, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		name := filepath.Join(dir, ConfigFile)
+		c, err := LoadConfig(name)
+		if !os.IsNotExist(err) {
+			return c, err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// LoadConfig reads the configuration file at the given path.
+func LoadConfig(name string) (*Config, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseConfig(f, name)
+}
+
+// ParseConfig reads a configuration file. The name is used in errors, and
+// its directory is used as Dir.
+//
+// This is not a full YAML parser; it only understands a mapping of the
+// keys shown in the Config example, whose values are either a mapping of
+// scalars, or a sequence of scalars in block or flow style.
+func ParseConfig(r io.Reader, name string) (*Config, error) {
+	c := &Config{Dir: filepath.Dir(name)}
+	cp := configParser{name: name}
+	var key string // current top-level key
+	scan := bufio.NewScanner(r)
+	for scan.Scan() {
+		cp.line++
+		line := stripComment(scan.Text())
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == line {
+			k, val, ok := cp.pair(line)
+			if !ok {
+				return nil, cp.errorf("expected a key")
+			}
+			key = k
+			if key == "quotes" {
+				switch c.Quotes = unquote(val); c.Quotes {
+				case "single", "double":
+				default:
+					return nil, cp.errorf("invalid quotes: %q", val)
+				}
+				continue
+			}
+			if _, ok := c.list(key); !ok && key != "rules" {
+				return nil, cp.errorf("unknown key %q", key)
+			}
+			if val == "" {
+				continue
+			}
+			items, ok := flowSequence(val)
+			list, isList := c.list(key)
+			if !ok || !isList {
+				return nil, cp.errorf("expected a sequence or a new line after %s", key)
+			}
+			*list = append(*list, items...)
+			continue
+		}
+		switch list, _ := c.list(key); {
+		case key == "":
+			return nil, cp.errorf("unexpected indentation")
+		case list != nil:
+			if !strings.HasPrefix(trimmed, "- ") && trimmed != "-" {
+				return nil, cp.errorf("expected a sequence item in %s", key)
+			}
+			*list = append(*list, unquote(strings.TrimSpace(trimmed[1:])))
+		default: // rules
+			rule, val, ok := cp.pair(trimmed)
+			if !ok {
+				return nil, cp.errorf("expected a rule")
+			}
+			if !knownRule(rule) {
+				return nil, cp.errorf("unknown rule %q", rule)
+			}
+			sev := Severity(strings.ToLower(unquote(val)))
+			switch sev {
+			case "on":
+				sev = ""
+			case Off, Info, Warning, Error:
+			default:
+				return nil, cp.errorf("invalid severity for %s: %q", rule, val)
+			}
+			if c.Rules == nil {
+				c.Rules = make(map[string]Severity)
+			}
+			c.Rules[rule] = sev
+		}
+	}
+	if err := scan.Err(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// list returns the sequence held by a key, if it is one.
+func (c *Config) list(key string) (*[]string, bool) {
+	switch key {
+	case "commands":
+		return &c.Commands, true
+	case "env":
+		return &c.Env, true
+	case "sources":
+		return &c.Sources, true
+	case "exclude":
+		return &c.Exclude, true
+	}
+	return nil, false
+}
+
+func knownRule(id string) bool {
+	for _, rule := range rules {
+		if rule.id == id {
+			return true
+		}
+	}
+	return false
+}
+
+type configParser struct {
+	name string
+	line int
+}
+
+func (cp *configParser) errorf(format string, args ...interface{}) error {
+	prefix := ""
+	if cp.name != "" {
+		prefix = cp.name + ":"
+	}
+	return fmt.Errorf("%s%d: %s", prefix, cp.line, fmt.Sprintf(format, args...))
+}
+
+// pair splits "key: value" into its key and its value, which may be empty.
+func (cp *configParser) pair(s string) (key, val string, ok bool) {
+	i := strings.IndexByte(s, ':')
+	if i <= 0 || (i+1 < len(s) && s[i+1] != ' ') {
+		return "", "", false
+	}
+	return strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:]), true
+}
+
+// flowSequence parses a sequence like "[a, 'b c']".
+func flowSequence(s string) ([]string, bool) {
+	if !strings.HasPrefix(s, "[") || !strings.HasSuffix(s, "]") {
+		return nil, false
+	}
+	s = strings.TrimSpace(s[1 : len(s)-1])
+	if s == "" {
+		return nil, true
+	}
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		items = append(items, unquote(strings.TrimSpace(item)))
+	}
+	return items, true
+}
+
+// stripComment removes a comment starting with "#" at the start of a line
+// or after a space, unless it is quoted.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch b := line[i]; {
+		case quote != 0:
+			if b == quote {
+				quote = 0
+			}
+		case b == '"' || b == '\'':
+			quote = b
+		case b == '#' && (i == 0 || line[i-1] == ' '):
+			return strings.TrimRight(line[:i], " ")
+		}
+	}
+	return line
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
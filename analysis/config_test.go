@@ -0,0 +1,133 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package analysis
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+func TestParseConfig(t *testing.T) {
+	t.Parallel()
+	src := `# project settings
+rules:
+  undefined-command: off
+  taint: Error   # loud
+  loop-control: on
+commands: [mytool, 'deploy']
+env:
+  - BUILD_ID
+sources:
+  - lib/common.sh
+exclude:
+  - vendor/
+  - "*.bats"
+quotes: double
+`
+	c, err := ParseConfig(strings.NewReader(src), filepath.Join("proj", ConfigFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Config{
+		Dir: "proj",
+		Rules: map[string]Severity{
+			"undefined-command": Off,
+			"taint":             Error,
+			"loop-control":      "",
+		},
+		Commands: []string{"mytool", "deploy"},
+		Env:      []string{"BUILD_ID"},
+		Sources:  []string{"lib/common.sh"},
+		Exclude:  []string{"vendor/", "*.bats"},
+		Quotes:   "double",
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Fatalf("ParseConfig mismatch:\nwant: %#v\ngot:  %#v", want, c)
+	}
+}
+
+var parseConfigErrors = []struct {
+	src, want string
+}{
+	{"foo: [a]", "c.yaml:1: unknown key \"foo\""},
+	{"rules:\n  nope: off", "c.yaml:2: unknown rule \"nope\""},
+	{"rules:\n  taint: loud", "c.yaml:2: invalid severity for taint: \"loud\""},
+	{"rules: [taint]", "c.yaml:1: expected a sequence or a new line after rules"},
+	{"env:\n  FOO: bar", "c.yaml:2: expected a sequence item in env"},
+	{"  - x", "c.yaml:1: unexpected indentation"},
+	{"commands", "c.yaml:1: expected a key"},
+	{"quotes: fancy", "c.yaml:1: invalid quotes: \"fancy\""},
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	t.Parallel()
+	for i, tc := range parseConfigErrors {
+		t.Run(fmt.Sprintf("%02d", i), func(t *testing.T) {
+			_, err := ParseConfig(strings.NewReader(tc.src), "c.yaml")
+			if err == nil || err.Error() != tc.want {
+				t.Fatalf("ParseConfig error mismatch in %q:\nwant: %s\ngot:  %v",
+					tc.src, tc.want, err)
+			}
+		})
+	}
+}
+
+func TestConfigExcluded(t *testing.T) {
+	t.Parallel()
+	c := &Config{Dir: "proj", Exclude: []string{"vendor/", "*.bats", "test/data"}}
+	for name, want := range map[string]bool{
+		"proj/main.sh":              false,
+		"proj/vendor/lib.sh":        true,
+		"proj/sub/vendor/lib.sh":    true,
+		"proj/test/a.bats":          true,
+		"proj/test/data/x.sh":       true,
+		"proj/test/run.sh":          false,
+		"proj/other/test/data/x.sh": false,
+	} {
+		if got := c.Excluded(name); got != want {
+			t.Errorf("Excluded(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestAnalyzeConfig(t *testing.T) {
+	t.Parallel()
+	c := &Config{
+		Dir: "proj",
+		Rules: map[string]Severity{
+			"undefined-variable": Off,
+			"taint":              Error,
+			"undefined-command":  Info,
+		},
+		Commands: []string{"mytool"},
+		Sources:  []string{"lib.sh"},
+	}
+	files := map[string]string{filepath.Join("proj", "lib.sh"): "libfn() { :; }"}
+	opts := append(c.Options(),
+		Resolver(mapResolver(files)),
+		Commands(func(name string) bool { return name == "rm" }),
+	)
+	a := NewAnalyzer(opts...)
+	src := "echo $undef\nmytool; libfn; nope\nrm $1"
+	f, err := syntax.NewParser().Parse(strings.NewReader(src), "main.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range a.Analyze(f) {
+		got = append(got, fmt.Sprintf("%s (%s %s)", d, d.Rule, d.Severity))
+	}
+	want := []string{
+		"main.sh:2:16: undefined command: nope (undefined-command info)",
+		"main.sh:3:4: tainted data from $1 reaches rm unquoted (taint error)",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Analyze mismatch:\nwant: %q\ngot:  %q", want, got)
+	}
+}
@@ -0,0 +1,9 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+// Package analysis implements static checks on shell programs parsed by
+// the syntax package.
+//
+// This package is a work in progress and EXPERIMENTAL; its API is not
+// subject to the 1.x backwards compatibility guarantee.
+package analysis
@@ -0,0 +1,194 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package analysis
+
+import (
+	"strings"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// PortableEcho makes the analyzer report the uses of echo with the -n or
+// -e options, as shells disagree on whether echo has any options at all.
+// For example, dash's echo prints "-n" and always interprets escape
+// sequences. Where the output is known to stay the same, a fix to use
+// printf instead is included.
+func PortableEcho(a *Analyzer) { a.portableEcho = true }
+
+// echoFlags returns the options given to an echo command, and the
+// arguments after them.
+func echoFlags(args []*syntax.Word) (newline, escapes bool, rest []*syntax.Word) {
+	newline = true
+	for i, arg := range args {
+		opt, _ := wordLit(arg)
+		if len(opt) < 2 || opt[0] != '-' || strings.Trim(opt[1:], "neE") != "" {
+			return newline, escapes, args[i:]
+		}
+		for _, r := range opt[1:] {
+			switch r {
+			case 'n':
+				newline = false
+			case 'e':
+				escapes = true
+			case 'E':
+				escapes = false
+			}
+		}
+	}
+	return newline, escapes, nil
+}
+
+// checkEcho reports an echo command with options, if ce is one.
+func checkEcho(st *syntax.Stmt, ce *syntax.CallExpr, add func(Diagnostic)) {
+	if name, _ := wordLit(firstArg(ce)); name != "echo" || len(ce.Args) < 2 {
+		return
+	}
+	newline, escapes, args := echoFlags(ce.Args[1:])
+	opts := ce.Args[1 : len(ce.Args)-len(args)]
+	if len(opts) == 0 {
+		return
+	}
+	optsText := make([]string, len(opts))
+	for i, opt := range opts {
+		optsText[i], _ = wordLit(opt)
+	}
+	d := newDiag("echo-flags", ce.Args[0].Pos(),
+		"echo %s is not portable; use printf instead", strings.Join(optsText, " "))
+	if printf, ok := echoPrintf(args, newline, escapes); ok {
+		last := ce.Args[len(ce.Args)-1]
+		for _, r := range st.Redirs {
+			if r.Pos().After(ce.Args[0].Pos()) && last.End().After(r.Pos()) {
+				ok = false // we would replace the redirect too
+			}
+		}
+		if ok {
+			d.Fixes = []Fix{{Text: "use printf", Edits: []Edit{
+				{Pos: ce.Args[0].Pos(), End: last.End(), Text: printf},
+			}}}
+		}
+	}
+	add(d)
+}
+
+// echoPrintf returns a printf command which prints the same as echo with
+// the given arguments and options.
+func echoPrintf(args []*syntax.Word, newline, escapes bool) (string, bool) {
+	// static arguments become the format itself
+	vals := make([]string, len(args))
+	static := true
+	for i, arg := range args {
+		if vals[i], static = syntax.StaticValue(arg); !static {
+			break
+		}
+	}
+	if static {
+		format, ok := echoFormat(strings.Join(vals, " "), escapes)
+		if newline {
+			format += `\n`
+		}
+		if ok && !strings.Contains(format, "'") {
+			return "printf '" + format + "'", true
+		}
+	}
+
+	// otherwise, use a format with a verb per argument, which only works
+	// if each argument is a single field
+	verb := "%s"
+	if escapes {
+		verb = "%b"
+	}
+	verbs := make([]string, len(args))
+	for i, arg := range args {
+		if !singleField(arg) {
+			return "", false
+		}
+		verbs[i] = verb
+	}
+	format := strings.Join(verbs, " ")
+	if newline {
+		format += `\n`
+	}
+	var sb strings.Builder
+	sb.WriteString("printf '" + format + "'")
+	for _, arg := range args {
+		sb.WriteByte(' ')
+		syntax.NewPrinter().Print(&sb, arg)
+	}
+	return sb.String(), true
+}
+
+// echoFormat translates the output of echo into a printf format. If escapes
+// is true, echo's escape sequences are translated to printf's, and false is
+// returned if that's not possible.
+func echoFormat(s string, escapes bool) (string, bool) {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '%':
+			sb.WriteString("%%")
+		case c != '\\':
+			sb.WriteByte(c)
+		case !escapes:
+			sb.WriteString(`\\`)
+		case i+1 == len(s):
+			sb.WriteString(`\\`)
+		default:
+			i++
+			switch e := s[i]; e {
+			case 'a', 'b', 'e', 'f', 'n', 'r', 't', 'v', '\\':
+				sb.WriteByte('\\')
+				sb.WriteByte(e)
+			case '0':
+				// \0nnn in echo is \nnn in printf
+				j := i + 1
+				for j < len(s) && j < i+4 && '0' <= s[j] && s[j] <= '7' {
+					j++
+				}
+				sb.WriteString(`\` + s[i+1:j])
+				if j == i+1 {
+					sb.WriteString("0")
+				}
+				i = j - 1
+			case 'c', 'x', 'u', 'U':
+				// stopping the output, and hexadecimal or unicode
+				// escapes, are not portable in printf formats
+				return "", false
+			default:
+				sb.WriteString(`\\`)
+				sb.WriteByte(e)
+			}
+		}
+	}
+	return sb.String(), true
+}
+
+// singleField reports whether a word always expands to exactly one field.
+func singleField(w *syntax.Word) bool {
+	for _, part := range w.Parts {
+		switch x := part.(type) {
+		case *syntax.Lit:
+			if strings.ContainsAny(x.Value, "*?[{~") {
+				return false
+			}
+		case *syntax.SglQuoted:
+		case *syntax.DblQuoted:
+			for _, part := range x.Parts {
+				pe, ok := part.(*syntax.ParamExp)
+				if !ok {
+					continue
+				}
+				if pe.Param.Value == "@" || pe.Names == syntax.NamesPrefixWords {
+					return false // "$@" or "${!prefix@}"
+				}
+				if w, ok := pe.Index.(*syntax.Word); ok && w.Lit() == "@" {
+					return false // "${a[@]}"
+				}
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package analysis
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+var echoTests = []struct {
+	src  string
+	want []string
+}{
+	{`echo foo; echo -- -n; echo "-x"`, nil},
+	{`echo -n foo`, []string{`1:1: echo -n is not portable; use printf instead => printf 'foo'`}},
+	{`echo -e 'a\tb' c`, []string{`1:1: echo -e is not portable; use printf instead => printf 'a\tb c\n'`}},
+	{`echo -n -e "50%\n"`, []string{`1:1: echo -n -e is not portable; use printf instead => printf '50%%\n'`}},
+	{`echo -ne '\0101\c'`, []string{`1:1: echo -ne is not portable; use printf instead => printf '%b' '\0101\c'`}},
+	{`echo -e '\0101'`, []string{`1:1: echo -e is not portable; use printf instead => printf '\101\n'`}},
+	{`echo -n 'a\b'`, []string{`1:1: echo -n is not portable; use printf instead => printf 'a\\b'`}},
+	{`echo -n "it's"`, []string{`1:1: echo -n is not portable; use printf instead => printf '%s' "it's"`}},
+	{`echo -n "$x" 'y'`, []string{`1:1: echo -n is not portable; use printf instead => printf '%s %s' "$x" 'y'`}},
+	{`echo -e "$x"`, []string{`1:1: echo -e is not portable; use printf instead => printf '%b\n' "$x"`}},
+	{`echo -n $x`, []string{`1:1: echo -n is not portable; use printf instead`}},
+	{`echo -n "$@"`, []string{`1:1: echo -n is not portable; use printf instead`}},
+	{`echo -n *.sh`, []string{`1:1: echo -n is not portable; use printf instead`}},
+	{`echo -n a >f b`, []string{`1:1: echo -n is not portable; use printf instead`}},
+	{`echo -n a b >f`, []string{`1:1: echo -n is not portable; use printf instead => printf 'a b'`}},
+}
+
+func TestAnalyzePortableEcho(t *testing.T) {
+	t.Parallel()
+	a := NewAnalyzer(PortableEcho)
+	for i, tc := range echoTests {
+		t.Run(fmt.Sprintf("%02d", i), func(t *testing.T) {
+			f, err := syntax.NewParser().Parse(strings.NewReader(tc.src), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, d := range a.Analyze(f) {
+				if d.Rule != "echo-flags" {
+					continue
+				}
+				s := d.String()
+				for _, fix := range d.Fixes {
+					s += " => " + fix.Edits[0].Text
+				}
+				got = append(got, s)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("Analyze mismatch in %q:\nwant: %q\ngot:  %q",
+					tc.src, tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,385 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package analysis
+
+import (
+	"strconv"
+	"strings"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// ExitKind describes how a program finishes.
+type ExitKind int
+
+const (
+	// ExitStatic is an exit with a static status, like "exit 2".
+	ExitStatic ExitKind = iota
+	// ExitLast is an exit with the status of the last command, like
+	// "exit" or "exit $?".
+	ExitLast
+	// ExitDynamic is an exit with a status only known at run time, like
+	// "exit $code".
+	ExitDynamic
+	// ExitFallthrough is the end of the program being reached, with the
+	// status of its last statement.
+	ExitFallthrough
+)
+
+// ExitCode is a way in which a program can finish, as found by ExitCodes.
+type ExitCode struct {
+	Pos  syntax.Pos
+	Kind ExitKind
+
+	// Status is the exit status, or -1 if it isn't known statically.
+	Status int
+}
+
+// ExitCodes finds the ways in which a program can finish; its exit
+// commands, including those in functions, and its end if it can be
+// reached. Exit commands in subshells, like in "(exit 1)" or in pipelines,
+// are not included, as they only finish the subshell.
+//
+// The status of statements is known statically in simple cases, like
+// after "true" or "false", after an if clause whose branches have the same
+// known status, or after "cmd || exit 1", which can only continue with
+// status 0.
+func ExitCodes(f *syntax.File) []ExitCode {
+	ef := &exitFinder{}
+	ef.stmts(f.Stmts, 0)
+	if st := listStatus(f.Stmts, 0); !st.exits {
+		code := ExitCode{Kind: ExitFallthrough, Status: st.code}
+		if len(f.Stmts) > 0 {
+			code.Pos = f.Stmts[len(f.Stmts)-1].Pos()
+		}
+		ef.codes = append(ef.codes, code)
+	}
+	return ef.codes
+}
+
+const statusUnknown = -1
+
+// stmtStatus is what is known statically about the exit status of a
+// statement.
+type stmtStatus struct {
+	code  int  // statusUnknown if not known
+	exits bool // the statement always exits the program
+}
+
+// mergeStatus returns the status of a statement running either a or b.
+func mergeStatus(a, b stmtStatus) stmtStatus {
+	switch {
+	case a.exits && !b.exits:
+		return b
+	case b.exits && !a.exits:
+		return a
+	}
+	if a.code != b.code {
+		a.code = statusUnknown
+	}
+	return a
+}
+
+// listStatus returns the status of a list of statements, where prev is
+// the status of the last command run before them.
+func listStatus(stmts []*syntax.Stmt, prev int) stmtStatus {
+	st := stmtStatus{code: prev}
+	for _, s := range stmts {
+		if st = stmtStat(s, st.code); st.exits {
+			break
+		}
+	}
+	return st
+}
+
+func stmtStat(s *syntax.Stmt, prev int) stmtStatus {
+	if s.Background || s.Coprocess {
+		return stmtStatus{code: 0}
+	}
+	st := cmdStatus(s.Cmd, prev)
+	if s.Negated && !st.exits && st.code != statusUnknown {
+		if st.code == 0 {
+			st.code = 1
+		} else {
+			st.code = 0
+		}
+	}
+	return st
+}
+
+func cmdStatus(cmd syntax.Command, prev int) stmtStatus {
+	unknown := stmtStatus{code: statusUnknown}
+	switch x := cmd.(type) {
+	case nil, *syntax.DeclClause, *syntax.FuncDecl:
+		// declaration builtins like local hide the status of any
+		// command substitutions
+		return stmtStatus{code: 0}
+	case *syntax.CallExpr:
+		if len(x.Args) == 0 {
+			for _, as := range x.Assigns {
+				if as.Value != nil && hasCmdSubst(as.Value) {
+					return unknown
+				}
+			}
+			return stmtStatus{code: 0}
+		}
+		if code, ok := exitCall(x, prev); ok {
+			return stmtStatus{code: code.Status, exits: true}
+		}
+		switch name, _ := wordLit(x.Args[0]); name {
+		case "true", ":", "echo":
+			return stmtStatus{code: 0}
+		case "false":
+			return stmtStatus{code: 1}
+		}
+	case *syntax.Block:
+		return listStatus(x.Stmts, prev)
+	case *syntax.Subshell:
+		st := listStatus(x.Stmts, prev)
+		st.exits = false // exit only finishes the subshell
+		return st
+	case *syntax.IfClause:
+		cond := listStatus(x.Cond.Stmts, prev)
+		if cond.exits {
+			return cond
+		}
+		els := stmtStatus{code: 0}
+		if len(x.Else.Stmts) > 0 {
+			els = listStatus(x.Else.Stmts, statusUnknown)
+		}
+		return mergeStatus(listStatus(x.Then.Stmts, 0), els)
+	case *syntax.WhileClause:
+		return mergeStatus(stmtStatus{code: 0}, listStatus(x.Do.Stmts, statusUnknown))
+	case *syntax.ForClause:
+		return mergeStatus(stmtStatus{code: 0}, listStatus(x.Do.Stmts, statusUnknown))
+	case *syntax.CaseClause:
+		var sts []stmtStatus
+		if n := len(x.Items); n == 0 || !matchesAll(x.Items[n-1]) {
+			sts = append(sts, stmtStatus{code: 0}) // nothing may match
+		}
+		for _, ci := range x.Items {
+			sts = append(sts, listStatus(ci.Stmts, 0))
+		}
+		st := sts[0]
+		for _, st2 := range sts[1:] {
+			st = mergeStatus(st, st2)
+		}
+		return st
+	case *syntax.BinaryCmd:
+		switch x.Op {
+		case syntax.AndStmt:
+			left := stmtStat(x.X, prev)
+			if left.exits || (left.code != statusUnknown && left.code > 0) {
+				return left
+			}
+			right := stmtStat(x.Y, 0)
+			if left.code == 0 {
+				return right
+			}
+			return mergeStatus(left, right)
+		case syntax.OrStmt:
+			left := stmtStat(x.X, prev)
+			if left.exits || left.code == 0 {
+				return left
+			}
+			right := stmtStat(x.Y, left.code)
+			if left.code != statusUnknown {
+				return right
+			}
+			// only continues past an exit on the right if the left
+			// succeeded, like in "cmd || exit 1"
+			return mergeStatus(stmtStatus{code: 0}, right)
+		default: // Pipe, PipeAll
+			st := stmtStat(x.Y, statusUnknown)
+			st.exits = false
+			return st
+		}
+	}
+	return unknown
+}
+
+// matchesAll reports whether a case item matches any word, like "*)".
+func matchesAll(ci *syntax.CaseItem) bool {
+	for _, w := range ci.Patterns {
+		if lit, ok := w.Parts[0].(*syntax.Lit); ok && len(w.Parts) == 1 && lit.Value == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func hasCmdSubst(w *syntax.Word) bool {
+	found := false
+	syntax.Walk(w, func(node syntax.Node) bool {
+		if _, ok := node.(*syntax.CmdSubst); ok {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// exitCall returns the exit code of an exit command, where prev is the
+// status of the last command run before it. ok is false if the command
+// isn't an exit.
+func exitCall(ce *syntax.CallExpr, prev int) (code ExitCode, ok bool) {
+	if name, _ := wordLit(ce.Args[0]); name != "exit" {
+		return ExitCode{}, false
+	}
+	code = ExitCode{Pos: ce.Args[0].Pos(), Kind: ExitLast, Status: prev}
+	switch len(ce.Args) {
+	case 1:
+		return code, true
+	case 2:
+	default:
+		code.Kind, code.Status = ExitDynamic, statusUnknown
+		return code, true
+	}
+	arg := ce.Args[1]
+	if len(arg.Parts) == 1 {
+		if pe, ok := arg.Parts[0].(*syntax.ParamExp); ok && pe.Short && pe.Param.Value == "?" {
+			return code, true
+		}
+	}
+	if s, ok := wordLit(arg); ok {
+		if n, err := strconv.Atoi(s); err == nil {
+			code.Kind, code.Status = ExitStatic, int(uint8(n))
+			return code, true
+		}
+	}
+	code.Kind, code.Status = ExitDynamic, statusUnknown
+	return code, true
+}
+
+type exitFinder struct {
+	codes []ExitCode
+}
+
+func (ef *exitFinder) stmts(stmts []*syntax.Stmt, prev int) {
+	for _, s := range stmts {
+		ef.stmt(s, prev)
+		prev = stmtStat(s, prev).code
+	}
+}
+
+func (ef *exitFinder) stmt(s *syntax.Stmt, prev int) {
+	if s.Background || s.Coprocess {
+		return // runs in a subshell
+	}
+	switch x := s.Cmd.(type) {
+	case *syntax.CallExpr:
+		if len(x.Args) == 0 {
+			break
+		}
+		if code, ok := exitCall(x, prev); ok {
+			ef.codes = append(ef.codes, code)
+		}
+	case *syntax.Block:
+		ef.stmts(x.Stmts, prev)
+	case *syntax.IfClause:
+		ef.stmts(x.Cond.Stmts, prev)
+		ef.stmts(x.Then.Stmts, 0)
+		ef.stmts(x.Else.Stmts, statusUnknown)
+	case *syntax.WhileClause:
+		ef.stmts(x.Cond.Stmts, statusUnknown)
+		ef.stmts(x.Do.Stmts, statusUnknown)
+	case *syntax.ForClause:
+		ef.stmts(x.Do.Stmts, statusUnknown)
+	case *syntax.CaseClause:
+		for _, ci := range x.Items {
+			ef.stmts(ci.Stmts, 0)
+		}
+	case *syntax.BinaryCmd:
+		switch x.Op {
+		case syntax.AndStmt:
+			ef.stmt(x.X, prev)
+			ef.stmt(x.Y, 0)
+		case syntax.OrStmt:
+			ef.stmt(x.X, prev)
+			left := stmtStat(x.X, prev).code
+			if left == 0 {
+				left = statusUnknown
+			}
+			ef.stmt(x.Y, left)
+		}
+	case *syntax.FuncDecl:
+		ef.stmt(x.Body, statusUnknown)
+	case *syntax.TimeClause:
+		if x.Stmt != nil {
+			ef.stmt(x.Stmt, prev)
+		}
+	}
+}
+
+// ignoredFailures returns the commands at the top level of a program
+// whose failure is ignored, as the program can still exit with status 0
+// after them. Programs that enable errexit are never reported.
+func ignoredFailures(f *syntax.File) []*syntax.CallExpr {
+	if errexit(f) {
+		return nil
+	}
+	var ces []*syntax.CallExpr
+	for i, s := range f.Stmts {
+		ce, ok := s.Cmd.(*syntax.CallExpr)
+		if !ok || s.Negated || s.Background || len(ce.Args) == 0 {
+			continue
+		}
+		name, ok := wordLit(ce.Args[0])
+		if !ok || syntax.IsBuiltin(name) {
+			continue
+		}
+		if i+1 == len(f.Stmts) {
+			continue // its status is the program's
+		}
+		if st := listStatus(f.Stmts[i+1:], statusUnknown); st.code == 0 {
+			ces = append(ces, ce)
+		}
+	}
+	return ces
+}
+
+// errexit reports whether a program enables errexit, via "set -e", "set
+// -o errexit", or a shebang like "#!/bin/sh -e".
+func errexit(f *syntax.File) bool {
+	var first []syntax.Comment
+	if len(f.Stmts) > 0 {
+		first = f.Stmts[0].Comments
+	} else {
+		first = f.Last
+	}
+	if len(first) > 0 && first[0].Hash.Line() == 1 && strings.HasPrefix(first[0].Text, "!") {
+		for _, field := range strings.Fields(first[0].Text)[1:] {
+			if errexitFlag(field) {
+				return true
+			}
+		}
+	}
+	found := false
+	syntax.Walk(f, func(node syntax.Node) bool {
+		ce, ok := node.(*syntax.CallExpr)
+		if !ok || len(ce.Args) < 2 {
+			return !found
+		}
+		if name, _ := wordLit(ce.Args[0]); name != "set" {
+			return !found
+		}
+		for i, arg := range ce.Args[1:] {
+			flag, _ := wordLit(arg)
+			if errexitFlag(flag) {
+				found = true
+			} else if flag == "-o" && i+2 < len(ce.Args) {
+				if opt, _ := wordLit(ce.Args[i+2]); opt == "errexit" {
+					found = true
+				}
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+func errexitFlag(flag string) bool {
+	return len(flag) > 1 && flag[0] == '-' && flag[1] != '-' &&
+		strings.ContainsRune(flag, 'e')
+}
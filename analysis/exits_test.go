@@ -0,0 +1,137 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package analysis
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+var exitKindNames = map[ExitKind]string{
+	ExitStatic:      "static",
+	ExitLast:        "last",
+	ExitDynamic:     "dynamic",
+	ExitFallthrough: "fallthrough",
+}
+
+var exitCodesTests = []struct {
+	src  string
+	want []string
+}{
+	{"", []string{"0:0: fallthrough 0"}},
+	{"exit 3", []string{"1:1: static 3"}},
+	{"exit 256; exit -1", []string{"1:1: static 0", "1:11: static 255"}},
+	{"false; exit", []string{"1:8: last 1"}},
+	{"cmd; exit $?", []string{"1:6: last -1"}},
+	{"exit $code", []string{"1:1: dynamic -1"}},
+	{"exit 1 2", []string{"1:1: dynamic -1"}},
+	{"cmd; echo done", []string{"1:6: fallthrough 0"}},
+	{"echo start; cmd", []string{"1:13: fallthrough -1"}},
+	{"cmd || exit 1", []string{"1:8: static 1", "1:1: fallthrough 0"}},
+	{"cmd && exit", []string{"1:8: last 0", "1:1: fallthrough -1"}},
+	{"false || exit", []string{"1:10: last 1"}},
+	{"true || exit 2", []string{"1:9: static 2", "1:1: fallthrough 0"}},
+	{"! false", []string{"1:1: fallthrough 0"}},
+	{"if cmd; then exit 2; else false; fi", []string{
+		"1:14: static 2",
+		"1:1: fallthrough 1",
+	}},
+	{"if cmd; then exit 2; else exit; fi", []string{"1:14: static 2", "1:27: last -1"}},
+	{"if cmd; then true; fi", []string{"1:1: fallthrough 0"}},
+	{"if cmd; then cmd; fi", []string{"1:1: fallthrough -1"}},
+	{"while cmd; do :; done", []string{"1:1: fallthrough 0"}},
+	{"case $x in a) exit 1 ;; *) exit 1 ;; esac", []string{
+		"1:15: static 1",
+		"1:28: static 1",
+	}},
+	{"case $x in a) exit 1 ;; \"*\") exit 1 ;; esac", []string{
+		"1:15: static 1",
+		"1:30: static 1",
+		"1:1: fallthrough 0",
+	}},
+	{"(exit 4); exit", []string{"1:11: last 4"}},
+	{"f() { exit 5; }; a | exit 6; exit 7 &", []string{
+		"1:7: static 5",
+		"1:30: fallthrough 0",
+	}},
+	{"x=$(cmd)", []string{"1:1: fallthrough -1"}},
+	{"local x=$(cmd); x=1", []string{"1:17: fallthrough 0"}},
+}
+
+func TestExitCodes(t *testing.T) {
+	t.Parallel()
+	p := syntax.NewParser()
+	for i, tc := range exitCodesTests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			f, err := p.Parse(strings.NewReader(tc.src), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, code := range ExitCodes(f) {
+				got = append(got, fmt.Sprintf("%d:%d: %s %d", code.Pos.Line(),
+					code.Pos.Col(), exitKindNames[code.Kind], code.Status))
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("ExitCodes mismatch in %q:\nwant: %q\ngot:  %q",
+					tc.src, tc.want, got)
+			}
+		})
+	}
+}
+
+var ignoredFailuresTests = []struct {
+	src  string
+	want []string
+}{
+	{"cp a b", nil},
+	{"cp a b; echo done", []string{
+		"1:1: failure of cp is ignored; the program may still exit with status 0",
+	}},
+	{"mkdir x; cp a x; exit 0", []string{
+		"1:1: failure of mkdir is ignored; the program may still exit with status 0",
+		"1:10: failure of cp is ignored; the program may still exit with status 0",
+	}},
+	{"cp a b; exit", nil},
+	{"cp a b; exit $?", nil},
+	{"cp a b || exit 1; echo done", nil},
+	{"if ! cp a b; then exit 1; fi; echo done", nil},
+	{"cp a b; status=$?; echo done; exit $status", nil},
+	{"cp a b; make", nil},
+	{"cd dir; echo done", nil},
+	{"set -e; cp a b; echo done", nil},
+	{"set -euo pipefail; cp a b; echo done", nil},
+	{"set -o errexit; cp a b; echo done", nil},
+	{"#!/bin/sh -e\ncp a b; echo done", nil},
+	{"#!/bin/sh\ncp a b; echo done", []string{
+		"2:1: failure of cp is ignored; the program may still exit with status 0",
+	}},
+}
+
+func TestAnalyzeIgnoredFailures(t *testing.T) {
+	t.Parallel()
+	a := NewAnalyzer(IgnoredFailures, Env("a", "b", "x", "dir", "status"),
+		RuleSeverity("cd-unchecked", Off))
+	p := syntax.NewParser(syntax.KeepComments)
+	for i, tc := range ignoredFailuresTests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			f, err := p.Parse(strings.NewReader(tc.src), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, d := range a.Analyze(f) {
+				got = append(got, d.String())
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("Analyze mismatch in %q:\nwant: %q\ngot:  %q",
+					tc.src, tc.want, got)
+			}
+		})
+	}
+}
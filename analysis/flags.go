@@ -0,0 +1,171 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package analysis
+
+import (
+	"strings"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// Flag is a command line option handled by a shell program.
+type Flag struct {
+	// Name is the option including its dashes, such as "-v" or
+	// "--verbose".
+	Name string
+
+	// Arg is whether the option takes an argument, as in "-f file" or
+	// "--file=name".
+	Arg bool
+
+	// Pos is where the option is first handled.
+	Pos syntax.Pos
+}
+
+// Flags returns the command line options handled by a program or a
+// function, in the order they are first found. Two kinds of argument
+// parsers are recognised:
+//
+//	while getopts "vf:" opt; do ...
+//	case "$1" in -v|--verbose) ... ;; -f) file=$2; shift 2 ;; esac
+//
+// The latter also works on the variable of a loop over "$@". An option
+// handled by case takes an argument if its pattern ends in "=*", or if
+// its branch uses $2, or $1 after a shift.
+func Flags(node syntax.Node) []Flag {
+	fc := &flagCollector{seen: make(map[string]int), argVars: make(map[string]bool)}
+	syntax.Walk(node, func(node syntax.Node) bool {
+		switch x := node.(type) {
+		case *syntax.CallExpr:
+			fc.getopts(x)
+		case *syntax.WordIter:
+			if allParams(x.Items) {
+				fc.argVars[x.Name.Value] = true
+			}
+		case *syntax.CaseClause:
+			if name := paramName(x.Word); name == "1" || fc.argVars[name] {
+				fc.caseClause(x)
+			}
+		}
+		return true
+	})
+	return fc.flags
+}
+
+type flagCollector struct {
+	flags []Flag
+	seen  map[string]int // index in flags
+
+	// argVars holds the names of loop variables iterating over the
+	// program's arguments, like arg in "for arg in "$@"".
+	argVars map[string]bool
+}
+
+func (fc *flagCollector) add(flag Flag) {
+	if i, ok := fc.seen[flag.Name]; ok {
+		fc.flags[i].Arg = fc.flags[i].Arg || flag.Arg
+		return
+	}
+	fc.seen[flag.Name] = len(fc.flags)
+	fc.flags = append(fc.flags, flag)
+}
+
+func (fc *flagCollector) getopts(ce *syntax.CallExpr) {
+	if len(ce.Args) < 3 {
+		return
+	}
+	if name, _ := wordLit(ce.Args[0]); name != "getopts" {
+		return
+	}
+	optstr, ok := wordLit(ce.Args[1])
+	if !ok {
+		return
+	}
+	// a leading colon only silences errors
+	optstr = strings.TrimPrefix(optstr, ":")
+	for i := 0; i < len(optstr); i++ {
+		c := optstr[i]
+		if c == ':' {
+			continue
+		}
+		arg := i+1 < len(optstr) && optstr[i+1] == ':'
+		fc.add(Flag{Name: "-" + string(c), Arg: arg, Pos: ce.Args[1].Pos()})
+	}
+}
+
+func (fc *flagCollector) caseClause(cc *syntax.CaseClause) {
+	for _, ci := range cc.Items {
+		usesArg := branchUsesArg(ci)
+		for _, pat := range ci.Patterns {
+			s, ok := wordLit(pat)
+			if !ok || len(s) < 2 || s[0] != '-' || s == "--" {
+				continue
+			}
+			flag := Flag{Name: s, Arg: usesArg, Pos: pat.Pos()}
+			if strings.HasSuffix(s, "=*") {
+				flag.Name, flag.Arg = s[:len(s)-2], true
+			}
+			if strings.ContainsAny(flag.Name, "*?[") {
+				continue // e.g. -*) for unknown options
+			}
+			fc.add(flag)
+		}
+	}
+}
+
+// branchUsesArg reports whether a case branch reads the argument following
+// the option, either as $2 or as $1 after a shift.
+func branchUsesArg(ci *syntax.CaseItem) bool {
+	var shift syntax.Pos
+	uses := false
+	syntax.Walk(ci, func(node syntax.Node) bool {
+		switch x := node.(type) {
+		case *syntax.CallExpr:
+			if len(x.Args) == 0 || shift.IsValid() {
+				break
+			}
+			if name, _ := wordLit(x.Args[0]); name == "shift" {
+				shift = x.Pos()
+			}
+		case *syntax.ParamExp:
+			switch x.Param.Value {
+			case "2":
+				uses = true
+			case "1":
+				if shift.IsValid() && x.Pos().After(shift) {
+					uses = true
+				}
+			}
+		}
+		return !uses
+	})
+	return uses
+}
+
+// allParams reports whether the items of a for loop are the program's
+// arguments, as in "for arg" or "for arg in "$@"".
+func allParams(items []*syntax.Word) bool {
+	if len(items) == 0 {
+		return true
+	}
+	return len(items) == 1 && paramName(items[0]) == "@"
+}
+
+// paramName returns the name of the parameter if w is nothing but a simple
+// parameter expansion, like $1 or "${arg}".
+func paramName(w *syntax.Word) string {
+	if len(w.Parts) != 1 {
+		return ""
+	}
+	part := w.Parts[0]
+	if dq, ok := part.(*syntax.DblQuoted); ok && len(dq.Parts) == 1 {
+		part = dq.Parts[0]
+	}
+	pe, ok := part.(*syntax.ParamExp)
+	if !ok || pe.Excl || pe.Length || pe.Width || pe.Index != nil ||
+		pe.Slice != nil || pe.Repl != nil || pe.Exp != nil {
+		return ""
+	}
+	return pe.Param.Value
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package analysis
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+var flagsTests = []struct {
+	src  string
+	want []string
+}{
+	{"echo foo", nil},
+	{
+		`while getopts ":vf:o:" opt; do case $opt in v) ;; esac; done`,
+		[]string{"1:15 -v", "1:15 -f ARG", "1:15 -o ARG"},
+	},
+	{"getopts $opts opt", nil},
+	{
+		`case "$1" in -v|--verbose) v=1 ;; -f) file=$2; shift ;; esac`,
+		[]string{"1:14 -v", "1:17 --verbose", "1:35 -f ARG"},
+	},
+	{
+		"while [ $# -gt 0 ]; do case $1 in\n-o) shift; out=$1 ;;\n--out=*) out=${1#*=} ;;\n-h) echo $1 ;;\n-*) exit 1 ;;\n--) break ;;\nesac; shift; done",
+		[]string{"2:1 -o ARG", "3:1 --out ARG", "4:1 -h"},
+	},
+	{
+		`for arg in "$@"; do case "$arg" in -q) q=1 ;; --name=*) ;; esac; done`,
+		[]string{"1:36 -q", "1:47 --name ARG"},
+	},
+	{"for arg; do case $arg in -q) ;; esac; done", []string{"1:26 -q"}},
+	{"for arg in a b; do case $arg in -q) ;; esac; done", nil},
+	{"case $2 in -q) ;; esac", nil},
+	{
+		`getopts "f" o; case $1 in -f) x=$2 ;; esac`,
+		[]string{"1:9 -f ARG"},
+	},
+}
+
+func TestFlags(t *testing.T) {
+	t.Parallel()
+	for i, tc := range flagsTests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			f, err := syntax.NewParser().Parse(strings.NewReader(tc.src), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, flag := range Flags(f) {
+				s := fmt.Sprintf("%s %s", flag.Pos, flag.Name)
+				if flag.Arg {
+					s += " ARG"
+				}
+				got = append(got, s)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("Flags mismatch in %q:\nwant: %q\ngot:  %q",
+					tc.src, tc.want, got)
+			}
+		})
+	}
+}
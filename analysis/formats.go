@@ -0,0 +1,159 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package analysis
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"strings"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// WriteRDJSON writes diagnostics in the JSON variant of the Reviewdog
+// Diagnostic Format, to be read by "reviewdog -f=rdjson". Each edit of
+// the fixes is a suggestion, and rules are diagnostic codes. Diagnostics
+// default to the WARNING severity.
+func WriteRDJSON(w io.Writer, diags []Diagnostic) error {
+	res := rdResult{
+		Source:      rdSource{Name: "sh", URL: "https://mvdan.cc/sh"},
+		Severity:    "WARNING",
+		Diagnostics: []rdDiagnostic{},
+	}
+	for _, d := range diags {
+		rd := rdDiagnostic{
+			Message:  d.Text,
+			Severity: strings.ToUpper(string(d.Severity)),
+			Location: rdLocation{
+				Path:  d.Filename,
+				Range: rdRange{Start: rdPos(d.Pos)},
+			},
+		}
+		if d.Rule != "" {
+			rd.Code = &rdCode{Value: d.Rule}
+		}
+		for _, fix := range d.Fixes {
+			for _, edit := range fix.Edits {
+				end := rdPos(edit.End)
+				rd.Suggestions = append(rd.Suggestions, rdSuggestion{
+					Range: rdRange{Start: rdPos(edit.Pos), End: &end},
+					Text:  edit.Text,
+				})
+			}
+		}
+		res.Diagnostics = append(res.Diagnostics, rd)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(res)
+}
+
+func rdPos(pos syntax.Pos) rdPosition {
+	return rdPosition{Line: pos.Line(), Column: pos.Col()}
+}
+
+type rdResult struct {
+	Source      rdSource       `json:"source"`
+	Severity    string         `json:"severity"`
+	Diagnostics []rdDiagnostic `json:"diagnostics"`
+}
+
+type rdSource struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+type rdDiagnostic struct {
+	Message     string         `json:"message"`
+	Severity    string         `json:"severity,omitempty"`
+	Location    rdLocation     `json:"location"`
+	Code        *rdCode        `json:"code,omitempty"`
+	Suggestions []rdSuggestion `json:"suggestions,omitempty"`
+}
+
+type rdLocation struct {
+	Path  string  `json:"path,omitempty"`
+	Range rdRange `json:"range"`
+}
+
+type rdRange struct {
+	Start rdPosition  `json:"start"`
+	End   *rdPosition `json:"end,omitempty"`
+}
+
+type rdPosition struct {
+	Line   uint `json:"line"`
+	Column uint `json:"column"`
+}
+
+type rdCode struct {
+	Value string `json:"value"`
+}
+
+type rdSuggestion struct {
+	Range rdRange `json:"range"`
+	Text  string  `json:"text"`
+}
+
+// WriteCheckstyle writes diagnostics in the XML format of Checkstyle,
+// grouped by file in the order they first appear. Diagnostics without a
+// severity are warnings, and their source is the rule prefixed by "sh.",
+// like "sh.undefined-variable". Fixes are left out.
+func WriteCheckstyle(w io.Writer, diags []Diagnostic) error {
+	cs := csCheckstyle{Version: "4.3"}
+	index := make(map[string]int)
+	for _, d := range diags {
+		i, ok := index[d.Filename]
+		if !ok {
+			i = len(cs.Files)
+			index[d.Filename] = i
+			cs.Files = append(cs.Files, csFile{Name: d.Filename})
+		}
+		source := "sh"
+		if d.Rule != "" {
+			source += "." + d.Rule
+		}
+		sev := d.Severity
+		if sev == "" {
+			sev = Warning
+		}
+		cs.Files[i].Errors = append(cs.Files[i].Errors, csError{
+			Line:     d.Pos.Line(),
+			Column:   d.Pos.Col(),
+			Severity: string(sev),
+			Message:  d.Text,
+			Source:   source,
+		})
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	if err := enc.Encode(cs); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+type csCheckstyle struct {
+	XMLName xml.Name `xml:"checkstyle"`
+	Version string   `xml:"version,attr"`
+	Files   []csFile `xml:"file"`
+}
+
+type csFile struct {
+	Name   string    `xml:"name,attr"`
+	Errors []csError `xml:"error"`
+}
+
+type csError struct {
+	Line     uint   `xml:"line,attr"`
+	Column   uint   `xml:"column,attr"`
+	Severity string `xml:"severity,attr"`
+	Message  string `xml:"message,attr"`
+	Source   string `xml:"source,attr"`
+}
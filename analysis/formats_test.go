@@ -0,0 +1,144 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package analysis
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+func formatDiags(t *testing.T) []Diagnostic {
+	p := syntax.NewParser()
+	var diags []Diagnostic
+	for _, file := range []struct{ name, src string }{
+		{"a.sh", "rm $1\necho \"$undef\""},
+		{"b.sh", "break"},
+	} {
+		f, err := p.Parse(strings.NewReader(file.src), file.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		diags = append(diags, NewAnalyzer(Taint).Analyze(f)...)
+	}
+	return diags
+}
+
+func TestWriteRDJSON(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	if err := WriteRDJSON(&buf, formatDiags(t)); err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+	"source": {
+		"name": "sh",
+		"url": "https://mvdan.cc/sh"
+	},
+	"severity": "WARNING",
+	"diagnostics": [
+		{
+			"message": "tainted data from $1 reaches rm unquoted",
+			"location": {
+				"path": "a.sh",
+				"range": {
+					"start": {
+						"line": 1,
+						"column": 4
+					}
+				}
+			},
+			"code": {
+				"value": "taint"
+			},
+			"suggestions": [
+				{
+					"range": {
+						"start": {
+							"line": 1,
+							"column": 4
+						},
+						"end": {
+							"line": 1,
+							"column": 4
+						}
+					},
+					"text": "\""
+				},
+				{
+					"range": {
+						"start": {
+							"line": 1,
+							"column": 6
+						},
+						"end": {
+							"line": 1,
+							"column": 6
+						}
+					},
+					"text": "\""
+				}
+			]
+		},
+		{
+			"message": "undefined variable: undef",
+			"location": {
+				"path": "a.sh",
+				"range": {
+					"start": {
+						"line": 2,
+						"column": 8
+					}
+				}
+			},
+			"code": {
+				"value": "undefined-variable"
+			}
+		},
+		{
+			"message": "break is only useful in a loop",
+			"location": {
+				"path": "b.sh",
+				"range": {
+					"start": {
+						"line": 1,
+						"column": 1
+					}
+				}
+			},
+			"code": {
+				"value": "loop-control"
+			}
+		}
+	]
+}
+`
+	if got := buf.String(); got != want {
+		t.Fatalf("WriteRDJSON mismatch:\nwant:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestWriteCheckstyle(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	if err := WriteCheckstyle(&buf, formatDiags(t)); err != nil {
+		t.Fatal(err)
+	}
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<checkstyle version="4.3">
+	<file name="a.sh">
+		<error line="1" column="4" severity="warning" message="tainted data from $1 reaches rm unquoted" source="sh.taint"></error>
+		<error line="2" column="8" severity="warning" message="undefined variable: undef" source="sh.undefined-variable"></error>
+	</file>
+	<file name="b.sh">
+		<error line="1" column="1" severity="warning" message="break is only useful in a loop" source="sh.loop-control"></error>
+	</file>
+</checkstyle>
+`
+	if got := buf.String(); got != want {
+		t.Fatalf("WriteCheckstyle mismatch:\nwant:\n%s\ngot:\n%s", want, got)
+	}
+}
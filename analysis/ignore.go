@@ -0,0 +1,114 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package analysis
+
+import (
+	"strings"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// ignore is a suppression of a rule, found in a comment.
+type ignore struct {
+	pos      syntax.Pos // of the rule within the comment
+	rule     string
+	from, to uint // lines where the rule is suppressed
+	used     bool
+}
+
+// ignores returns the suppressions found in the comments of f, which are
+// only kept if the parser was used with syntax.KeepComments. They may be
+// of two forms, followed by an optional reason:
+//
+//	# sh:ignore=rule1,rule2
+//	# sh:ignore-next-line=rule1,rule2
+//
+// The first form applies to the whole statement that the comment is
+// attached to, whether it precedes the statement or trails it. The second
+// only applies to the line following the comment.
+func ignores(f *syntax.File) []*ignore {
+	var list []*ignore
+	stmtLines := make(map[uint][2]uint) // by comment offset
+	syntax.Walk(f, func(node syntax.Node) bool {
+		switch x := node.(type) {
+		case *syntax.Stmt:
+			for _, c := range x.Comments {
+				stmtLines[c.Pos().Offset()] = [2]uint{x.Pos().Line(), x.End().Line()}
+			}
+		case *syntax.Comment:
+			text := strings.TrimLeft(x.Text, " \t")
+			offset := uint(len(x.Text) - len(text))
+			line := x.Pos().Line()
+			from, to := line, line
+			switch {
+			case strings.HasPrefix(text, "sh:ignore="):
+				text = text[len("sh:ignore="):]
+				offset += uint(len("sh:ignore="))
+				if lines, ok := stmtLines[x.Pos().Offset()]; ok {
+					from, to = lines[0], lines[1]
+				}
+			case strings.HasPrefix(text, "sh:ignore-next-line="):
+				text = text[len("sh:ignore-next-line="):]
+				offset += uint(len("sh:ignore-next-line="))
+				from, to = line+1, line+1
+			default:
+				return true
+			}
+			if i := strings.IndexAny(text, " \t"); i >= 0 {
+				text = text[:i] // drop the reason
+			}
+			offset++ // the hash
+			for _, rule := range strings.Split(text, ",") {
+				pos := x.Pos()
+				list = append(list, &ignore{
+					pos:  syntax.NewPos(pos.Offset()+offset, line, pos.Col()+offset),
+					rule: rule,
+					from: from,
+					to:   to,
+				})
+				offset += uint(len(rule)) + 1
+			}
+		}
+		return true
+	})
+	return list
+}
+
+// applyIgnores drops the diagnostics of f which are suppressed by its
+// comments, and reports the suppressions which are unused or name unknown
+// rules.
+func applyIgnores(f *syntax.File, diags []Diagnostic) []Diagnostic {
+	list := ignores(f)
+	if len(list) == 0 {
+		return diags
+	}
+	kept := diags[:0]
+diags:
+	for _, d := range diags {
+		if d.Filename == f.Name {
+			line := d.Pos.Line()
+			for _, ig := range list {
+				if ig.rule == d.Rule && ig.from <= line && line <= ig.to {
+					ig.used = true
+					continue diags
+				}
+			}
+		}
+		kept = append(kept, d)
+	}
+	for _, ig := range list {
+		var d Diagnostic
+		switch {
+		case !knownRule(ig.rule):
+			d = newDiag("unused-ignore", ig.pos, "ignore of unknown rule: %q", ig.rule)
+		case !ig.used:
+			d = newDiag("unused-ignore", ig.pos, "unused ignore of rule: %s", ig.rule)
+		default:
+			continue
+		}
+		d.Filename = f.Name
+		kept = append(kept, d)
+	}
+	return kept
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package analysis
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+var ignoreTests = []struct {
+	src  string
+	want []string
+}{
+	{"echo $x # sh:ignore=undefined-variable legacy", nil},
+	{"# sh:ignore=undefined-variable\nif true; then\n\techo $x\nfi\necho $y", []string{
+		"5:7: undefined variable: y",
+	}},
+	{"# sh:ignore-next-line=undefined-variable,loop-control\necho $x; break\necho $y", []string{
+		"3:7: undefined variable: y",
+	}},
+	{"# sh:ignore-next-line=undefined-variable\n\necho $x", []string{
+		"1:23: unused ignore of rule: undefined-variable",
+		"3:7: undefined variable: x",
+	}},
+	{"echo $x # sh:ignore=loop-control,undefined-variable,nope", []string{
+		"1:21: unused ignore of rule: loop-control",
+		"1:53: ignore of unknown rule: \"nope\"",
+	}},
+	{"echo $x # sh:ignore", []string{"1:7: undefined variable: x"}},
+}
+
+func TestAnalyzeIgnores(t *testing.T) {
+	t.Parallel()
+	a := NewAnalyzer()
+	for i, tc := range ignoreTests {
+		t.Run(fmt.Sprintf("%02d", i), func(t *testing.T) {
+			f, err := syntax.NewParser(syntax.KeepComments).Parse(strings.NewReader(tc.src), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, d := range a.Analyze(f) {
+				got = append(got, d.String())
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("Analyze mismatch in %q:\nwant: %q\ngot:  %q",
+					tc.src, tc.want, got)
+			}
+		})
+	}
+}
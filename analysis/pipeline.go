@@ -0,0 +1,118 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package analysis
+
+import (
+	"strings"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// SimplifyPipelines makes the analyzer suggest simpler alternatives to some
+// common pipelines, with info severity:
+//
+//	cat file | cmd    # useless-cat: use cmd <file
+//	grep x | wc -l    # grep-count: use grep -c x
+//	ls | grep x       # ls-grep: use a glob
+//
+// Only the first has a fix, as the others may change the exit status or
+// the output in corner cases, such as with file names containing newlines.
+// The fix is not suggested if cmd is a builtin or a function, as those run
+// in the current shell when not in a pipeline.
+func SimplifyPipelines(a *Analyzer) { a.simplifyPipelines = true }
+
+// callName returns the name of the command a statement calls, if it is a
+// simple call.
+func callName(st *syntax.Stmt) (*syntax.CallExpr, string) {
+	ce, ok := st.Cmd.(*syntax.CallExpr)
+	if !ok || len(ce.Args) == 0 || st.Negated || st.Background || st.Coprocess {
+		return nil, ""
+	}
+	name, _ := wordLit(ce.Args[0])
+	return ce, name
+}
+
+// checkPipelines reports the pipelines which could be simpler. funcs holds
+// the functions defined by the program.
+func checkPipelines(f *syntax.File, funcs map[string]Symbol, add func(Diagnostic)) {
+	syntax.Walk(f, func(node syntax.Node) bool {
+		pipe, ok := node.(*syntax.BinaryCmd)
+		if !ok || pipe.Op != syntax.Pipe {
+			return true
+		}
+		left, right := pipe.X, pipe.Y
+		if next, ok := right.Cmd.(*syntax.BinaryCmd); ok && next.Op == syntax.Pipe {
+			right = next.X // pipelines nest to the right
+		}
+		lce, lname := callName(left)
+		rce, rname := callName(right)
+		if lce == nil || rce == nil {
+			return true
+		}
+		report := func(rule, format string, args ...interface{}) *Diagnostic {
+			d := newDiag(rule, lce.Args[0].Pos(), format, args...)
+			d.Severity = Info
+			return &d
+		}
+		switch {
+		case lname == "cat" && len(lce.Args) == 2 && len(left.Redirs) == 0:
+			file := lce.Args[1]
+			if lit, _ := wordLit(file); strings.HasPrefix(lit, "-") || !singleField(file) {
+				break
+			}
+			d := report("useless-cat", "useless use of cat; use %s <file instead", rname)
+			_, isFunc := funcs[rname]
+			if !syntax.IsBuiltin(rname) && !isFunc && !readsStdin(right) {
+				var src strings.Builder
+				syntax.NewPrinter().Print(&src, file)
+				end := stmtEnd(right)
+				d.Fixes = []Fix{{Text: "redirect the file", Edits: []Edit{
+					{Pos: left.Pos(), End: right.Pos(), Text: ""},
+					{Pos: end, End: end, Text: " <" + src.String()},
+				}}}
+			}
+			add(*d)
+		case lname == "grep" && rname == "wc" && len(rce.Args) == 2 && len(left.Redirs) == 0:
+			if opt, _ := wordLit(rce.Args[1]); opt != "-l" {
+				break
+			}
+			for _, arg := range lce.Args[1:] {
+				opt, _ := wordLit(arg)
+				if strings.HasPrefix(opt, "-") && strings.ContainsAny(opt[1:], "-coLlrRHhZzqABCm") {
+					return true // options that change what is counted
+				}
+			}
+			add(*report("grep-count", "use grep -c instead of piping grep into wc -l"))
+		case lname == "ls" && rname == "grep":
+			add(*report("ls-grep", "don't parse the output of ls; use a glob or a for loop instead"))
+		}
+		return true
+	})
+}
+
+// readsStdin reports whether a statement redirects its standard input.
+func readsStdin(st *syntax.Stmt) bool {
+	for _, r := range st.Redirs {
+		if r.N != nil && r.N.Value != "0" {
+			continue
+		}
+		switch r.Op {
+		case syntax.RdrIn, syntax.RdrInOut, syntax.DplIn, syntax.Hdoc,
+			syntax.DashHdoc, syntax.WordHdoc:
+			return true
+		}
+	}
+	return false
+}
+
+// stmtEnd returns the end of a statement, excluding any semicolon.
+func stmtEnd(st *syntax.Stmt) syntax.Pos {
+	end := st.Cmd.End()
+	for _, r := range st.Redirs {
+		if r.End().After(end) {
+			end = r.End()
+		}
+	}
+	return end
+}
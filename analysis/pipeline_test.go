@@ -0,0 +1,74 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package analysis
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+var pipelineTests = []struct {
+	src  string
+	want []string
+}{
+	{"grep x f; cat a b | sort; cat | sort; cat -n f | sort", nil},
+	{"cat f | grep x", []string{
+		"1:1: useless use of cat; use grep <file instead => grep x <f",
+	}},
+	{"cat \"$f\" | sort -u >out; echo", []string{
+		"1:1: useless use of cat; use sort <file instead => sort -u >out <\"$f\"",
+	}},
+	{"cat f | grep x | wc -l", []string{
+		"1:1: useless use of cat; use grep <file instead => grep x <f | wc -l",
+		"1:9: use grep -c instead of piping grep into wc -l",
+	}},
+	{"cat f | read x", []string{"1:1: useless use of cat; use read <file instead"}},
+	{"g() { :; }; cat f | g", []string{"1:13: useless use of cat; use g <file instead"}},
+	{"cat f | sort <g", []string{"1:1: useless use of cat; use sort <file instead"}},
+	{"cat *.txt | sort", nil},
+	{"grep -v x f | wc -l", []string{
+		"1:1: use grep -c instead of piping grep into wc -l",
+	}},
+	{"grep -o x f | wc -l; grep -A1 x | wc -l; grep x | wc -c", nil},
+	{"ls | grep foo", []string{
+		"1:1: don't parse the output of ls; use a glob or a for loop instead",
+	}},
+}
+
+func TestAnalyzeSimplifyPipelines(t *testing.T) {
+	t.Parallel()
+	a := NewAnalyzer(SimplifyPipelines, Env("f", "x"))
+	for i, tc := range pipelineTests {
+		t.Run(fmt.Sprintf("%02d", i), func(t *testing.T) {
+			f, err := syntax.NewParser().Parse(strings.NewReader(tc.src), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, d := range a.Analyze(f) {
+				if d.Severity != Info {
+					t.Fatalf("want info severity, got %q", d.Severity)
+				}
+				s := d.String()
+				for _, fix := range d.Fixes {
+					src := []byte(tc.src)
+					for i := len(fix.Edits) - 1; i >= 0; i-- {
+						e := fix.Edits[i]
+						src = append(src[:e.Pos.Offset()], append([]byte(e.Text), src[e.End.Offset():]...)...)
+					}
+					s += " => " + strings.SplitN(string(src), ";", 2)[0]
+				}
+				got = append(got, s)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("Analyze mismatch in %q:\nwant: %q\ngot:  %q",
+					tc.src, tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package analysis
+
+import (
+	"fmt"
+	"strings"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// QuoteStyle makes the analyzer report the strings which could use the
+// preferred kind of quotes instead, with a fix to change them. If quote is
+// a single quote, double-quoted strings without expansions, like "foo",
+// are reported. If quote is a double quote, single-quoted strings which
+// mean the same within double quotes, like 'foo', are reported. Any other
+// value disables the check.
+func QuoteStyle(quote byte) func(*Analyzer) {
+	return func(a *Analyzer) { a.quoteStyle = quote }
+}
+
+// checkQuotes reports the misuses of quotes, and the strings which don't
+// follow the preferred quote style, if there is one.
+func checkQuotes(node syntax.Node, style byte, add func(Diagnostic)) {
+	var visit func(node syntax.Node) bool
+	visit = func(node syntax.Node) bool {
+		switch x := node.(type) {
+		case *syntax.CallExpr:
+			// don't walk the embedded scripts, whose quotes are
+			// within the quotes of the arguments
+			for _, as := range x.Assigns {
+				syntax.Walk(as, visit)
+			}
+			for _, arg := range x.Args {
+				syntax.Walk(arg, visit)
+			}
+			if name, _ := wordLit(firstArg(x)); name == "echo" && !echoEscapes(x.Args[1:]) {
+				for _, arg := range x.Args[1:] {
+					checkEscapes(arg, "echo", add)
+				}
+			}
+			return false
+		case *syntax.Assign:
+			if x.Name != nil && x.Name.Value == "IFS" && x.Value != nil {
+				checkEscapes(x.Value, "IFS", add)
+			}
+		case *syntax.BinaryTest:
+			switch x.Op {
+			case syntax.TsMatch, syntax.TsNoMatch, syntax.TsReMatch:
+				if w, ok := x.Y.(*syntax.Word); ok {
+					checkEscapes(w, "[[", add)
+				}
+			}
+		case *syntax.DblQuoted:
+			if style != '\'' {
+				break
+			}
+			if val, ok := singleQuotable(x); ok {
+				d := newDiag("quote-style", x.Pos(), "use single quotes for strings without expansions")
+				d.Fixes = []Fix{{Text: "use single quotes", Edits: []Edit{
+					{Pos: x.Pos(), End: x.End(), Text: "'" + val + "'"},
+				}}}
+				add(d)
+			}
+		case *syntax.SglQuoted:
+			if style != '"' || x.Dollar || strings.ContainsAny(x.Value, "$`\\\"!") {
+				break
+			}
+			d := newDiag("quote-style", x.Pos(), "use double quotes for strings")
+			d.Fixes = []Fix{{Text: "use double quotes", Edits: []Edit{
+				{Pos: x.Pos(), End: x.End(), Text: `"` + x.Value + `"`},
+			}}}
+			add(d)
+		}
+		return true
+	}
+	syntax.Walk(node, visit)
+}
+
+func firstArg(ce *syntax.CallExpr) *syntax.Word {
+	if len(ce.Args) == 0 {
+		return &syntax.Word{}
+	}
+	return ce.Args[0]
+}
+
+// singleQuotable returns the value of a double-quoted string within
+// single quotes, if it has no expansions nor single quotes.
+func singleQuotable(dq *syntax.DblQuoted) (string, bool) {
+	if dq.Dollar || len(dq.Parts) > 1 {
+		return "", false
+	}
+	if len(dq.Parts) == 0 {
+		return "", true
+	}
+	lit, ok := dq.Parts[0].(*syntax.Lit)
+	if !ok {
+		return "", false
+	}
+	var sb strings.Builder
+	val := lit.Value
+	for i := 0; i < len(val); i++ {
+		c := val[i]
+		if c == '\\' && i+1 < len(val) {
+			switch val[i+1] {
+			case '$', '`', '"', '\\':
+				i++
+				c = val[i]
+			case '\n':
+				i++
+				continue
+			}
+		}
+		if c == '\'' {
+			return "", false
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String(), true
+}
+
+// echoEscapes reports whether the arguments of echo enable the escape
+// sequences, as in "echo -e".
+func echoEscapes(args []*syntax.Word) bool {
+	for _, arg := range args {
+		opt, _ := wordLit(arg)
+		if len(opt) < 2 || opt[0] != '-' || strings.Trim(opt[1:], "neE") != "" {
+			return false
+		}
+		if strings.ContainsRune(opt, 'e') {
+			return true
+		}
+	}
+	return false
+}
+
+// checkEscapes reports the C-like escape sequences within double quotes in
+// a word, like "\n", which are a backslash and a letter instead.
+func checkEscapes(w *syntax.Word, ctx string, add func(Diagnostic)) {
+	for _, part := range w.Parts {
+		dq, ok := part.(*syntax.DblQuoted)
+		if !ok || dq.Dollar {
+			continue
+		}
+		for _, part := range dq.Parts {
+			lit, ok := part.(*syntax.Lit)
+			if !ok {
+				continue
+			}
+			val := lit.Value
+			for i := 0; i+1 < len(val); i++ {
+				if val[i] != '\\' {
+					continue
+				}
+				switch c := val[i+1]; c {
+				case '\\', '$', '`', '"', '\n':
+					i++ // escapes which do work within double quotes
+				case 'a', 'b', 'e', 'f', 'n', 'r', 't', 'v':
+					d := newDiag("quote-escape", dq.Pos(),
+						`\%c in double quotes is a backslash followed by %c, not an escape sequence`, c, c)
+					if ctx == "echo" {
+						d.Text += "; use printf instead of echo"
+					} else {
+						d.Text += fmt.Sprintf(`; use $'\%c' instead`, c)
+					}
+					add(d)
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package analysis
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+var quotesTests = []struct {
+	quote byte
+	src   string
+	want  []string
+}{
+	{0, `echo "foo"`, nil},
+	{0, `echo "a\nb"`, []string{
+		`1:6: \n in double quotes is a backslash followed by n, not an escape sequence; use printf instead of echo`,
+	}},
+	{0, `echo -n "a\tb"`, []string{
+		`1:9: \t in double quotes is a backslash followed by t, not an escape sequence; use printf instead of echo`,
+	}},
+	{0, `echo -e "a\nb"; echo -ne "\n"`, nil},
+	{0, `echo "a\\nb \$n \"n\""; echo 'a\nb'; echo $'a\nb'`, nil},
+	{0, `printf "a\n"; grep "\t" f`, nil},
+	{0, `IFS="\n"; IFS=$'\n'`, []string{
+		`1:5: \n in double quotes is a backslash followed by n, not an escape sequence; use $'\n' instead`,
+	}},
+	{0, `[[ $x == *"\t"* ]]`, []string{
+		`1:11: \t in double quotes is a backslash followed by t, not an escape sequence; use $'\t' instead`,
+	}},
+
+	{'\'', `echo "foo" 'bar' "$x" "a\$b" "it's"`, []string{
+		"1:6: use single quotes for strings without expansions => 'foo'",
+		"1:23: use single quotes for strings without expansions => 'a$b'",
+	}},
+	{'"', `sh -c "echo 'foo'"`, nil},
+	{'"', `echo 'foo' "bar" 'a$b' 'a"b' $'c'`, []string{
+		`1:6: use double quotes for strings => "foo"`,
+	}},
+}
+
+func TestAnalyzeQuotes(t *testing.T) {
+	t.Parallel()
+	for i, tc := range quotesTests {
+		t.Run(fmt.Sprintf("%02d", i), func(t *testing.T) {
+			a := NewAnalyzer(QuoteStyle(tc.quote))
+			f, err := syntax.NewParser(syntax.ParseScriptArgs).Parse(strings.NewReader(tc.src), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, d := range a.Analyze(f) {
+				if d.Rule == "undefined-variable" {
+					continue
+				}
+				s := d.String()
+				for _, fix := range d.Fixes {
+					s += " => " + fix.Edits[0].Text
+				}
+				got = append(got, s)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("Analyze mismatch in %q:\nwant: %q\ngot:  %q",
+					tc.src, tc.want, got)
+			}
+		})
+	}
+}
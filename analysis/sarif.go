@@ -0,0 +1,224 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package analysis
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"path/filepath"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// rules describes the checks of an Analyzer, in the order they are listed
+// in SARIF logs.
+var rules = []struct {
+	id, text string
+}{
+	{"undefined-variable", "Variables should be defined before they are used."},
+	{"undefined-command", "Commands should be functions, builtins or existing programs."},
+	{"dynamic-eval", "Code run by eval should be static."},
+	{"taint", "Untrusted data should not reach dangerous commands."},
+	{"ignored-failure", "Failed commands should not let the program exit with status 0."},
+	{"loop-control", "Break and continue should be used in loops, with valid levels."},
+	{"quote-escape", "Escape sequences like \\n should not be used within double quotes."},
+	{"quote-style", "Strings should use the preferred kind of quotes."},
+	{"echo-flags", "Echo should not be given options, as they are not portable."},
+	{"cd-unchecked", "Failures of cd should be handled."},
+	{"cd-subshell", "Cd should not be the last command in a subshell."},
+	{"useless-cat", "Commands should read files directly instead of via cat."},
+	{"grep-count", "Grep should count lines itself instead of piping into wc -l."},
+	{"ls-grep", "The output of ls should not be parsed."},
+	{"source", "Sourced files should exist and be valid."},
+	{"unused-ignore", "Suppression comments should name known rules and be used."},
+}
+
+// WriteSARIF writes diagnostics as a log in version 2.1.0 of SARIF, the
+// Static Analysis Results Interchange Format, so that they can be used by
+// tools like GitHub code scanning. The metadata of all the rules is
+// included, whose identifiers are:
+//
+//	undefined-variable
+//	undefined-command
+//	dynamic-eval
+//	taint
+//	ignored-failure
+//	loop-control
+//	quote-escape
+//	quote-style
+//	echo-flags
+//	cd-unchecked
+//	cd-subshell
+//	useless-cat
+//	grep-count
+//	ls-grep
+//	source
+//	unused-ignore
+//
+// Severities are result levels, with info being "note". Filenames are
+// used as relative URIs. Diagnostics without a filename have
+// no artifact location, and their fixes are left out.
+func WriteSARIF(w io.Writer, diags []Diagnostic) error {
+	driver := sarifDriver{
+		Name:           "sh",
+		InformationURI: "https://mvdan.cc/sh",
+		Rules:          []sarifRule{},
+	}
+	index := make(map[string]int)
+	for _, rule := range rules {
+		index[rule.id] = len(driver.Rules)
+		driver.Rules = append(driver.Rules, sarifRule{
+			ID:               rule.id,
+			ShortDescription: &sarifText{Text: rule.text},
+		})
+	}
+	results := []sarifResult{}
+	for _, d := range diags {
+		if _, ok := index[d.Rule]; !ok {
+			index[d.Rule] = len(driver.Rules)
+			driver.Rules = append(driver.Rules, sarifRule{ID: d.Rule})
+		}
+		res := sarifResult{
+			RuleID:    d.Rule,
+			RuleIndex: index[d.Rule],
+			Level:     sarifLevel(d.Severity),
+			Message:   sarifText{Text: d.Text},
+		}
+		loc := sarifPhysical{Region: sarifRegion{
+			StartLine:   d.Pos.Line(),
+			StartColumn: d.Pos.Col(),
+		}}
+		if d.Filename != "" {
+			artifact := &sarifArtifact{URI: sarifURI(d.Filename)}
+			loc.ArtifactLocation = artifact
+			for _, fix := range d.Fixes {
+				change := sarifChange{ArtifactLocation: *artifact}
+				for _, edit := range fix.Edits {
+					change.Replacements = append(change.Replacements, sarifReplacement{
+						DeletedRegion:   sarifRange(edit.Pos, edit.End),
+						InsertedContent: sarifText{Text: edit.Text},
+					})
+				}
+				res.Fixes = append(res.Fixes, sarifFix{
+					Description:     sarifText{Text: fix.Text},
+					ArtifactChanges: []sarifChange{change},
+				})
+			}
+		}
+		res.Locations = []sarifLocation{{PhysicalLocation: loc}}
+		results = append(results, res)
+	}
+	log := sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool:    sarifTool{Driver: driver},
+			Results: results,
+		}},
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(log)
+}
+
+// sarifLevel returns the level of a result, which may be left out for
+// warnings as it is the default.
+func sarifLevel(sev Severity) string {
+	switch sev {
+	case Error:
+		return "error"
+	case Info:
+		return "note"
+	}
+	return ""
+}
+
+func sarifURI(filename string) string {
+	u := url.URL{Path: filepath.ToSlash(filename)}
+	return u.String()
+}
+
+func sarifRange(pos, end syntax.Pos) sarifRegion {
+	return sarifRegion{
+		StartLine:   pos.Line(),
+		StartColumn: pos.Col(),
+		EndLine:     end.Line(),
+		EndColumn:   end.Col(),
+	}
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string     `json:"id"`
+	ShortDescription *sarifText `json:"shortDescription,omitempty"`
+}
+
+type sarifText struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level,omitempty"`
+	Message   sarifText       `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+	Fixes     []sarifFix      `json:"fixes,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysical `json:"physicalLocation"`
+}
+
+type sarifPhysical struct {
+	ArtifactLocation *sarifArtifact `json:"artifactLocation,omitempty"`
+	Region           sarifRegion    `json:"region"`
+}
+
+type sarifArtifact struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   uint `json:"startLine"`
+	StartColumn uint `json:"startColumn"`
+	EndLine     uint `json:"endLine,omitempty"`
+	EndColumn   uint `json:"endColumn,omitempty"`
+}
+
+type sarifFix struct {
+	Description     sarifText     `json:"description"`
+	ArtifactChanges []sarifChange `json:"artifactChanges"`
+}
+
+type sarifChange struct {
+	ArtifactLocation sarifArtifact      `json:"artifactLocation"`
+	Replacements     []sarifReplacement `json:"replacements"`
+}
+
+type sarifReplacement struct {
+	DeletedRegion   sarifRegion `json:"deletedRegion"`
+	InsertedContent sarifText   `json:"insertedContent"`
+}
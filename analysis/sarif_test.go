@@ -0,0 +1,107 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package analysis
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+func TestWriteSARIF(t *testing.T) {
+	t.Parallel()
+	src := "for i; do break 2; done\nrm -rf $1\necho $undef"
+	f, err := syntax.NewParser().Parse(strings.NewReader(src), "dir/my script.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	diags := NewAnalyzer(Taint).Analyze(f)
+	diags = append(diags, Diagnostic{Pos: diags[0].Pos, Text: "custom", Rule: "custom"})
+	var buf bytes.Buffer
+	if err := WriteSARIF(&buf, diags); err != nil {
+		t.Fatal(err)
+	}
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("unexpected SARIF log: %s", buf.String())
+	}
+	run := log.Runs[0]
+	if got, want := len(run.Tool.Driver.Rules), len(rules)+1; got != want {
+		t.Fatalf("want %d rules, got %d", want, got)
+	}
+	artifact := &sarifArtifact{URI: "dir/my%20script.sh"}
+	want := []sarifResult{
+		{
+			RuleID:    "loop-control",
+			RuleIndex: 5,
+			Message:   sarifText{Text: "break level 2 exceeds loop depth 1"},
+			Locations: []sarifLocation{{PhysicalLocation: sarifPhysical{
+				ArtifactLocation: artifact,
+				Region:           sarifRegion{StartLine: 1, StartColumn: 11},
+			}}},
+			Fixes: []sarifFix{{
+				Description: sarifText{Text: "use break 1"},
+				ArtifactChanges: []sarifChange{{
+					ArtifactLocation: *artifact,
+					Replacements: []sarifReplacement{{
+						DeletedRegion:   sarifRegion{StartLine: 1, StartColumn: 17, EndLine: 1, EndColumn: 18},
+						InsertedContent: sarifText{Text: "1"},
+					}},
+				}},
+			}},
+		},
+		{
+			RuleID:    "taint",
+			RuleIndex: 3,
+			Message:   sarifText{Text: "tainted data from $1 reaches rm unquoted"},
+			Locations: []sarifLocation{{PhysicalLocation: sarifPhysical{
+				ArtifactLocation: artifact,
+				Region:           sarifRegion{StartLine: 2, StartColumn: 8},
+			}}},
+			Fixes: []sarifFix{{
+				Description: sarifText{Text: "quote the argument"},
+				ArtifactChanges: []sarifChange{{
+					ArtifactLocation: *artifact,
+					Replacements: []sarifReplacement{
+						{
+							DeletedRegion:   sarifRegion{StartLine: 2, StartColumn: 8, EndLine: 2, EndColumn: 8},
+							InsertedContent: sarifText{Text: `"`},
+						},
+						{
+							DeletedRegion:   sarifRegion{StartLine: 2, StartColumn: 10, EndLine: 2, EndColumn: 10},
+							InsertedContent: sarifText{Text: `"`},
+						},
+					},
+				}},
+			}},
+		},
+		{
+			RuleID:    "undefined-variable",
+			RuleIndex: 0,
+			Message:   sarifText{Text: "undefined variable: undef"},
+			Locations: []sarifLocation{{PhysicalLocation: sarifPhysical{
+				ArtifactLocation: artifact,
+				Region:           sarifRegion{StartLine: 3, StartColumn: 7},
+			}}},
+		},
+		{
+			RuleID:    "custom",
+			RuleIndex: len(rules),
+			Message:   sarifText{Text: "custom"},
+			Locations: []sarifLocation{{PhysicalLocation: sarifPhysical{
+				Region: sarifRegion{StartLine: 1, StartColumn: 11},
+			}}},
+		},
+	}
+	if !reflect.DeepEqual(run.Results, want) {
+		t.Fatalf("SARIF results mismatch:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,271 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package analysis
+
+import (
+	"bytes"
+	"strings"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// Symbol is the definition of a function or variable.
+type Symbol struct {
+	Filename string
+	Pos      syntax.Pos
+}
+
+// Symbols holds the functions and variables defined by one or more
+// shell programs. Definitions are collected regardless of control flow;
+// a variable assigned anywhere in a program is considered defined.
+type Symbols struct {
+	Funcs map[string]Symbol
+	Vars  map[string]Symbol
+
+	// def, if non-nil, is called with every definition of a variable,
+	// not just the first.
+	def func(name string, pos syntax.Pos)
+}
+
+func newSymbols() *Symbols {
+	return &Symbols{
+		Funcs: make(map[string]Symbol),
+		Vars:  make(map[string]Symbol),
+	}
+}
+
+// Merge adds the definitions in other to s. If a name is defined in
+// both, the definition already in s is kept.
+func (s *Symbols) Merge(other *Symbols) {
+	for name, sym := range other.Funcs {
+		if _, ok := s.Funcs[name]; !ok {
+			s.Funcs[name] = sym
+		}
+	}
+	for name, sym := range other.Vars {
+		if _, ok := s.Vars[name]; !ok {
+			s.Vars[name] = sym
+		}
+	}
+}
+
+func (s *Symbols) addFunc(filename string, lit *syntax.Lit) {
+	if _, ok := s.Funcs[lit.Value]; !ok {
+		s.Funcs[lit.Value] = Symbol{Filename: filename, Pos: lit.Pos()}
+	}
+}
+
+func (s *Symbols) addVar(filename, name string, pos syntax.Pos) {
+	if i := strings.IndexByte(name, '['); i > 0 {
+		name = name[:i] // a[i]=x defines a
+	}
+	if !syntax.ValidName(name) {
+		return
+	}
+	if s.def != nil {
+		s.def(name, pos)
+	}
+	if _, ok := s.Vars[name]; !ok {
+		s.Vars[name] = Symbol{Filename: filename, Pos: pos}
+	}
+}
+
+// collect adds the definitions found in node to s. Each static source
+// command found is passed to source.
+func (s *Symbols) collect(filename string, node syntax.Node, source func(*syntax.CallExpr)) {
+	syntax.Walk(node, func(node syntax.Node) bool {
+		switch x := node.(type) {
+		case *syntax.FuncDecl:
+			s.addFunc(filename, x.Name)
+		case *syntax.Assign:
+			if x.Name != nil {
+				s.addVar(filename, x.Name.Value, x.Name.Pos())
+			} else if x.Naked && x.Value != nil {
+				// e.g. "local foo" in a POSIX-like dialect
+				if name, ok := wordLit(x.Value); ok {
+					s.addVar(filename, name, x.Value.Pos())
+				}
+			}
+		case *syntax.WordIter:
+			s.addVar(filename, x.Name.Value, x.Name.Pos())
+		case *syntax.ParamExp:
+			if x.Exp != nil && x.Param != nil {
+				switch x.Exp.Op {
+				case syntax.SubstAssgn, syntax.SubstColAssgn:
+					s.addVar(filename, x.Param.Value, x.Param.Pos())
+				}
+			}
+		case *syntax.BinaryArithm:
+			switch x.Op {
+			case syntax.Assgn, syntax.AddAssgn, syntax.SubAssgn,
+				syntax.MulAssgn, syntax.QuoAssgn, syntax.RemAssgn,
+				syntax.AndAssgn, syntax.OrAssgn, syntax.XorAssgn,
+				syntax.ShlAssgn, syntax.ShrAssgn:
+				s.arithmVar(filename, x.X)
+			}
+		case *syntax.UnaryArithm:
+			switch x.Op {
+			case syntax.Inc, syntax.Dec:
+				s.arithmVar(filename, x.X)
+			}
+		case *syntax.CallExpr:
+			s.callVars(filename, x, source)
+		}
+		return true
+	})
+}
+
+func (s *Symbols) arithmVar(filename string, expr syntax.ArithmExpr) {
+	if w, ok := expr.(*syntax.Word); ok {
+		if name, ok := wordLit(w); ok {
+			s.addVar(filename, name, w.Pos())
+		}
+	}
+}
+
+// argOpts lists, for each builtin that assigns to variables named by
+// its arguments, the flags that consume the following argument.
+var argOpts = map[string]string{
+	"read":      "aAdinNptu",
+	"mapfile":   "dnOsuCc",
+	"readarray": "dnOsuCc",
+	"printf":    "v",
+	"getopts":   "",
+	"export":    "",
+	"local":     "",
+	"readonly":  "",
+	"declare":   "",
+	"typeset":   "",
+}
+
+// callVars collects the variables assigned by builtins such as read,
+// and reports source commands.
+func (s *Symbols) callVars(filename string, ce *syntax.CallExpr, source func(*syntax.CallExpr)) {
+	if len(ce.Args) == 0 {
+		return
+	}
+	cmd, ok := wordLit(ce.Args[0])
+	if !ok {
+		return
+	}
+	if cmd == "source" || cmd == "." {
+		if source != nil {
+			source(ce)
+		}
+		return
+	}
+	for _, as := range syntax.ArgAssigns(ce) {
+		if as.Kind == syntax.EnvAssign {
+			// e.g. "env foo=bar sh -c 'echo $foo'"
+			s.addVar(filename, as.Assign.Name.Value, as.Assign.Name.Pos())
+		}
+	}
+	opts, ok := argOpts[cmd]
+	if !ok {
+		return
+	}
+	args := ce.Args[1:]
+	var flagNames, names []*syntax.Word
+	for i := 0; i < len(args); i++ {
+		arg, ok := wordLit(args[i])
+		if !ok {
+			names = append(names, args[i])
+			continue
+		}
+		if arg == "--" {
+			names = append(names, args[i+1:]...)
+			break
+		}
+		if len(arg) > 1 && (arg[0] == '-' || arg[0] == '+') {
+			flag := arg[len(arg)-1:]
+			if strings.Contains(opts, flag) && i+1 < len(args) {
+				i++
+				if flag == "a" || flag == "A" || flag == "v" {
+					// e.g. read -ra arr, or read -A arr in mksh
+					flagNames = append(flagNames, args[i])
+				}
+			}
+			continue
+		}
+		names = append(names, args[i])
+	}
+	switch cmd {
+	case "getopts":
+		// getopts optstring name [args]
+		if len(names) < 2 {
+			return
+		}
+		names = names[1:2]
+	case "printf":
+		names = nil
+	case "mapfile", "readarray":
+		if len(names) > 1 {
+			names = names[len(names)-1:]
+		} else if len(names) == 0 {
+			s.addVar(filename, "MAPFILE", ce.Args[0].Pos())
+		}
+	case "read":
+		if len(names)+len(flagNames) == 0 {
+			s.addVar(filename, "REPLY", ce.Args[0].Pos())
+		}
+	}
+	names = append(flagNames, names...)
+	for _, w := range names {
+		name, ok := wordLit(w)
+		if !ok {
+			continue
+		}
+		if i := strings.IndexByte(name, '='); i > 0 {
+			name = name[:i]
+		}
+		s.addVar(filename, name, w.Pos())
+	}
+}
+
+// wordLit returns the value of a word if it is made of literals and
+// quoted literals only.
+func wordLit(w *syntax.Word) (string, bool) {
+	var buf bytes.Buffer
+	for _, part := range w.Parts {
+		if !partLit(&buf, part) {
+			return "", false
+		}
+	}
+	return buf.String(), true
+}
+
+// allLit reports whether all the words are made of literals and quoted
+// literals only.
+func allLit(words []*syntax.Word) bool {
+	for _, w := range words {
+		if _, ok := wordLit(w); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func partLit(buf *bytes.Buffer, part syntax.WordPart) bool {
+	switch x := part.(type) {
+	case *syntax.Lit:
+		buf.WriteString(x.Value)
+	case *syntax.SglQuoted:
+		if x.Dollar {
+			return false
+		}
+		buf.WriteString(x.Value)
+	case *syntax.DblQuoted:
+		if x.Dollar {
+			return false
+		}
+		for _, part := range x.Parts {
+			if !partLit(buf, part) {
+				return false
+			}
+		}
+	default:
+		return false
+	}
+	return true
+}
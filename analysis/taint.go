@@ -0,0 +1,290 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package analysis
+
+import (
+	"fmt"
+	"strings"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// TaintFlow is a path taken by untrusted data, such as the program's
+// arguments, to a command where it may be dangerous, such as eval.
+type TaintFlow struct {
+	// Source describes where the data comes from, such as "$1", "read"
+	// or "curl", and SourcePos is its position.
+	Source    string
+	SourcePos syntax.Pos
+
+	// Chain holds the variables that carried the data from the source
+	// to the sink, in order. It is empty if the source is used directly.
+	Chain []TaintStep
+
+	// Sink describes the dangerous use, such as "eval", "sh -c" or
+	// "rm unquoted", and SinkPos is the position of the tainted word.
+	Sink    string
+	SinkPos syntax.Pos
+
+	sink *syntax.Word
+}
+
+// TaintStep is an assignment of tainted data to a variable.
+type TaintStep struct {
+	Name string
+	Pos  syntax.Pos
+}
+
+func (f TaintFlow) String() string {
+	s := "tainted data from " + f.Source + " reaches " + f.Sink
+	if len(f.Chain) > 0 {
+		steps := make([]string, len(f.Chain))
+		for i, step := range f.Chain {
+			steps[i] = fmt.Sprintf("%s (%d:%d)", step.Name,
+				step.Pos.Line(), step.Pos.Col())
+		}
+		s += " via " + strings.Join(steps, ", ")
+	}
+	return s
+}
+
+// taintSources holds the commands whose output is untrusted, when
+// captured by command substitutions.
+var taintSources = map[string]bool{"curl": true, "wget": true}
+
+// taintShells holds the shells whose -c script is a sink.
+var taintShells = map[string]bool{
+	"sh": true, "bash": true, "dash": true, "ksh": true, "mksh": true, "zsh": true,
+}
+
+// taintSQL holds the database clients whose arguments are sinks.
+var taintSQL = map[string]bool{"sqlite3": true, "mysql": true, "psql": true}
+
+// TaintFlows finds the paths by which untrusted data may reach dangerous
+// commands.
+//
+// Untrusted data comes from the positional parameters, the variables
+// assigned by read and mapfile, and the output of curl and wget. It
+// reaches the code run by eval or by a shell's -c flag, the arguments of
+// database clients like psql, and the unquoted arguments of rm, which
+// could be split into many files or globbed.
+//
+// Like with Symbols, control flow is not followed; a variable is tainted
+// if any of its assignments is. Flows are returned in the order of their
+// sinks.
+func TaintFlows(node syntax.Node) []TaintFlow {
+	tc := &taintChecker{tainted: make(map[string]*taint)}
+	var assigns []taintAssign
+	syntax.Walk(node, func(node syntax.Node) bool {
+		switch x := node.(type) {
+		case *syntax.Assign:
+			if x.Name == nil {
+				break
+			}
+			as := taintAssign{name: x.Name.Value, pos: x.Name.Pos()}
+			if x.Value != nil {
+				as.words = append(as.words, x.Value)
+			}
+			if x.Array != nil {
+				for _, elem := range x.Array.Elems {
+					as.words = append(as.words, elem.Value)
+				}
+			}
+			assigns = append(assigns, as)
+		case *syntax.WordIter:
+			as := taintAssign{name: x.Name.Value, pos: x.Name.Pos(), words: x.Items}
+			if len(x.Items) == 0 {
+				// for name; do
+				as.source, as.sourcePos = "$@", x.Name.Pos()
+			}
+			assigns = append(assigns, as)
+		case *syntax.CallExpr:
+			if len(x.Args) == 0 {
+				break
+			}
+			switch cmd, _ := wordLit(x.Args[0]); cmd {
+			case "read", "mapfile", "readarray":
+				syms := newSymbols()
+				syms.def = func(name string, pos syntax.Pos) {
+					assigns = append(assigns, taintAssign{name: name, pos: pos,
+						source: cmd, sourcePos: x.Args[0].Pos()})
+				}
+				syms.callVars("", x, nil)
+			}
+		}
+		return true
+	})
+	for changed := true; changed; {
+		changed = false
+		for _, as := range assigns {
+			if tc.tainted[as.name] != nil {
+				continue
+			}
+			step := TaintStep{Name: as.name, Pos: as.pos}
+			if as.source != "" {
+				tc.tainted[as.name] = &taint{source: as.source,
+					pos: as.sourcePos, chain: []TaintStep{step}}
+				changed = true
+				continue
+			}
+			for _, w := range as.words {
+				if t := tc.word(w, false); t != nil {
+					chain := append([]TaintStep(nil), t.chain...)
+					tc.tainted[as.name] = &taint{source: t.source,
+						pos: t.pos, chain: append(chain, step)}
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	syntax.Walk(node, func(node syntax.Node) bool {
+		if ce, ok := node.(*syntax.CallExpr); ok {
+			tc.call(ce)
+		}
+		return true
+	})
+	return tc.flows
+}
+
+type taintAssign struct {
+	name  string
+	pos   syntax.Pos
+	words []*syntax.Word
+
+	// if the value comes straight from a source, like with read
+	source    string
+	sourcePos syntax.Pos
+}
+
+type taint struct {
+	source string
+	pos    syntax.Pos
+	chain  []TaintStep
+}
+
+type taintChecker struct {
+	tainted map[string]*taint
+	flows   []TaintFlow
+}
+
+// call reports the tainted words used by a command in a sink.
+func (tc *taintChecker) call(ce *syntax.CallExpr) {
+	if len(ce.Args) == 0 {
+		return
+	}
+	cmd, _ := wordLit(ce.Args[0])
+	args := ce.Args[1:]
+	switch {
+	case cmd == "eval":
+		tc.sink("eval", args, false)
+	case taintShells[cmd]:
+		for i, arg := range args {
+			flags, ok := wordLit(arg)
+			if !ok || len(flags) < 2 || flags[0] != '-' || flags[1] == '-' {
+				break
+			}
+			if strings.ContainsRune(flags, 'c') && i+1 < len(args) {
+				tc.sink(cmd+" -c", args[i+1:i+2], false)
+				break
+			}
+		}
+	case taintSQL[cmd]:
+		tc.sink(cmd, args, false)
+	case cmd == "rm":
+		tc.sink("rm unquoted", args, true)
+	}
+}
+
+func (tc *taintChecker) sink(name string, words []*syntax.Word, unquoted bool) {
+	for _, w := range words {
+		if t := tc.word(w, unquoted); t != nil {
+			tc.flows = append(tc.flows, TaintFlow{
+				Source:    t.source,
+				SourcePos: t.pos,
+				Chain:     t.chain,
+				Sink:      name,
+				SinkPos:   w.Pos(),
+				sink:      w,
+			})
+		}
+	}
+}
+
+// word returns the first source of tainted data in a word, or nil if
+// there is none. If unquoted is true, only unquoted expansions are
+// considered.
+func (tc *taintChecker) word(w *syntax.Word, unquoted bool) *taint {
+	if w == nil {
+		return nil // e.g. in ${a:+}
+	}
+	return tc.parts(w.Parts, unquoted)
+}
+
+func (tc *taintChecker) parts(parts []syntax.WordPart, unquoted bool) *taint {
+	for _, part := range parts {
+		switch x := part.(type) {
+		case *syntax.DblQuoted:
+			if unquoted {
+				continue
+			}
+			if t := tc.parts(x.Parts, unquoted); t != nil {
+				return t
+			}
+		case *syntax.ParamExp:
+			if t := tc.param(x, unquoted); t != nil {
+				return t
+			}
+		case *syntax.CmdSubst:
+			if t := cmdSubstSource(x); t != nil {
+				return t
+			}
+		}
+	}
+	return nil
+}
+
+func (tc *taintChecker) param(pe *syntax.ParamExp, unquoted bool) *taint {
+	if pe.Length || pe.Width || pe.Excl || pe.Param == nil {
+		return nil
+	}
+	if pe.Exp != nil {
+		switch pe.Exp.Op {
+		case syntax.SubstPlus, syntax.SubstColPlus:
+			// only expands to the alternate word
+			return tc.word(pe.Exp.Word, unquoted)
+		}
+	}
+	name := pe.Param.Value
+	switch {
+	case name == "@" || name == "*" || (name[0] >= '1' && name[0] <= '9'):
+		return &taint{source: "$" + name, pos: pe.Pos()}
+	case tc.tainted[name] != nil:
+		return tc.tainted[name]
+	}
+	if pe.Exp != nil {
+		return tc.word(pe.Exp.Word, unquoted)
+	}
+	return nil
+}
+
+// cmdSubstSource returns the source of tainted data in a command
+// substitution running a command like curl, or nil if there is none.
+func cmdSubstSource(cs *syntax.CmdSubst) *taint {
+	var t *taint
+	for _, st := range cs.Stmts {
+		syntax.Walk(st, func(node syntax.Node) bool {
+			if t != nil {
+				return false
+			}
+			if ce, ok := node.(*syntax.CallExpr); ok && len(ce.Args) > 0 {
+				if cmd, _ := wordLit(ce.Args[0]); taintSources[cmd] {
+					t = &taint{source: cmd, pos: ce.Args[0].Pos()}
+				}
+			}
+			return true
+		})
+	}
+	return t
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package analysis
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+var taintTests = []struct {
+	src  string
+	want []string
+}{
+	{"eval foo; rm -rf /tmp/x", nil},
+	{`eval "$1"`, []string{"1:6: tainted data from $1 reaches eval"}},
+	{`eval "${@}"`, []string{"1:6: tainted data from $@ reaches eval"}},
+	{`eval "${#1}" ${1:+x} ${1:+}`, nil},
+	{`eval ${x:+"$1"}`, []string{"1:6: tainted data from $1 reaches eval"}},
+	{`eval "${x:-$2}"`, []string{"1:6: tainted data from $2 reaches eval"}},
+	{"x=$1; y=\"prefix $x\"; eval \"$y\"", []string{
+		"1:27: tainted data from $1 reaches eval via x (1:1), y (1:7)",
+	}},
+	{"eval $y; y=$x; x=$1", []string{
+		"1:6: tainted data from $1 reaches eval via x (1:16), y (1:10)",
+	}},
+	{"x=safe; eval $x", nil},
+	{"x=$1; x=safe; eval $x", []string{
+		"1:20: tainted data from $1 reaches eval via x (1:1)",
+	}},
+	{"read -r line; sh -c \"$line\"", []string{
+		"1:21: tainted data from read reaches sh -c via line (1:9)",
+	}},
+	{"read; bash -ec \"$REPLY\" name", []string{
+		"1:16: tainted data from read reaches bash -c via REPLY (1:1)",
+	}},
+	{`sh "$1" -c x; sh -- "$1"`, nil},
+	{"mapfile lines; for l in \"${lines[@]}\"; do eval \"$l\"; done", []string{
+		"1:48: tainted data from mapfile reaches eval via lines (1:9), l (1:20)",
+	}},
+	{"for arg; do rm $arg; done", []string{
+		"1:16: tainted data from $@ reaches rm unquoted via arg (1:5)",
+	}},
+	{`rm "$1"; rm -- "$@"`, nil},
+	{"rm -f $1 /tmp/$(curl -s x)", []string{
+		"1:7: tainted data from $1 reaches rm unquoted",
+		"1:10: tainted data from curl reaches rm unquoted",
+	}},
+	{"v=$(curl -s example.com | jq .v); psql -c \"SELECT '$v'\"", []string{
+		"1:43: tainted data from curl reaches psql via v (1:1)",
+	}},
+	{"q=\"DELETE FROM t WHERE id=$1\"; sqlite3 db \"$q\"", []string{
+		"1:43: tainted data from $1 reaches sqlite3 via q (1:1)",
+	}},
+	{"arr=(a \"$1\"); eval \"${arr[0]}\"", []string{
+		"1:20: tainted data from $1 reaches eval via arr (1:1)",
+	}},
+	{"f() { local x=$1; eval \"$x\"; }", []string{
+		"1:24: tainted data from $1 reaches eval via x (1:13)",
+	}},
+	{"eval \"$(wget -qO- x)\"", []string{
+		"1:6: tainted data from wget reaches eval",
+	}},
+	{"eval \"$(git describe)\"", nil},
+}
+
+func TestTaintFlows(t *testing.T) {
+	t.Parallel()
+	p := syntax.NewParser()
+	for i, tc := range taintTests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			f, err := p.Parse(strings.NewReader(tc.src), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, flow := range TaintFlows(f) {
+				got = append(got, fmt.Sprintf("%d:%d: %s",
+					flow.SinkPos.Line(), flow.SinkPos.Col(), flow))
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("TaintFlows mismatch in %q:\nwant: %q\ngot:  %q",
+					tc.src, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestAnalyzeTaint(t *testing.T) {
+	t.Parallel()
+	a := NewAnalyzer(Taint)
+	src := "dir=$1\nrm -rf $dir/cache\nrm -rf \"$dir/cache\""
+	f, err := syntax.NewParser().Parse(strings.NewReader(src), "clean.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range a.Analyze(f) {
+		got = append(got, d.String())
+	}
+	want := []string{
+		"clean.sh:2:8: tainted data from $1 reaches rm unquoted via dir (1:1)",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Analyze mismatch:\nwant: %q\ngot:  %q", want, got)
+	}
+}
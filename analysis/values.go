@@ -0,0 +1,215 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package analysis
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// Values holds the variables of a program which always hold the same
+// value, known statically, such as dir in:
+//
+//	dir=/opt/app
+//	cd "$dir/bin"
+//
+// This lets tools know the value of words that use them, such as the
+// final path above.
+type Values struct {
+	// Vars holds the value of each of the variables.
+	Vars map[string]string
+
+	first map[string]syntax.Pos // where each variable is first assigned
+}
+
+// StaticValues finds the variables of a program which are only ever
+// assigned the same static value. Values may use other such variables, as
+// in "bin=$dir/bin". Any other definition of a variable, such as by read,
+// a for loop, an append, or unset, means that its value isn't static.
+//
+// Like with Symbols, control flow is not followed, and definitions in
+// sourced files are not seen. However, a variable is only considered
+// static after its first assignment in the source.
+func StaticValues(node syntax.Node) *Values {
+	defs := make(map[string][]syntax.Pos)
+	syms := newSymbols()
+	syms.def = func(name string, pos syntax.Pos) {
+		defs[name] = append(defs[name], pos)
+	}
+	syms.collect("", node, nil)
+
+	assigns := make(map[string][]*syntax.Assign)
+	benign := make(map[syntax.Pos]bool) // definitions that keep the value
+	unset := make(map[string]bool)
+	addAssign := func(as *syntax.Assign) {
+		if as.Append || as.Naked || as.Name == nil || as.Index != nil || as.Array != nil {
+			return
+		}
+		assigns[as.Name.Value] = append(assigns[as.Name.Value], as)
+		benign[as.Name.Pos()] = true
+	}
+	syntax.Walk(node, func(node syntax.Node) bool {
+		switch x := node.(type) {
+		case *syntax.CallExpr:
+			if len(x.Args) == 0 {
+				for _, as := range x.Assigns {
+					addAssign(as)
+				}
+				break
+			}
+			if name, _ := wordLit(x.Args[0]); name == "unset" {
+				for _, arg := range x.Args[1:] {
+					if name, ok := wordLit(arg); ok {
+						unset[name] = true
+					}
+				}
+			}
+		case *syntax.DeclClause:
+			keeps := false
+			switch x.Variant.Value {
+			case "export", "readonly":
+				keeps = true
+			case "local", "declare", "typeset":
+			default:
+				return true
+			}
+			for _, opt := range x.Opts {
+				// other options like -i or -l change the values
+				if s, _ := wordLit(opt); s != "-r" && s != "-x" && s != "-g" {
+					return true
+				}
+			}
+			for _, as := range x.Assigns {
+				if as.Naked && as.Name != nil && keeps {
+					benign[as.Name.Pos()] = true // e.g. "export foo"
+				} else {
+					addAssign(as)
+				}
+			}
+		}
+		return true
+	})
+
+	v := &Values{
+		Vars:  make(map[string]string),
+		first: make(map[string]syntax.Pos),
+	}
+	for name, list := range assigns {
+		v.first[name] = list[0].Pos()
+	}
+	// Each round may find variables whose values use the ones found in
+	// the previous round, until no more are found.
+	for found := true; found; {
+		found = false
+	vars:
+		for name, list := range assigns {
+			if _, ok := v.Vars[name]; ok || unset[name] {
+				continue
+			}
+			for _, pos := range defs[name] {
+				if !benign[pos] {
+					continue vars
+				}
+			}
+			val := ""
+			for i, as := range list {
+				s := ""
+				if as.Value != nil {
+					var ok bool
+					if s, ok = v.word(as.Value, true); !ok {
+						continue vars
+					}
+				}
+				if i > 0 && s != val {
+					continue vars
+				}
+				val = s
+			}
+			v.Vars[name] = val
+			found = true
+		}
+	}
+	return v
+}
+
+// Word returns the value of a word from the program, if it is known
+// statically and expands to a single field. For example, "$dir/bin" and
+// $dir/bin do if dir is in Vars, but the latter doesn't if its value
+// contains spaces.
+func (v *Values) Word(w *syntax.Word) (string, bool) {
+	return v.word(w, false)
+}
+
+// word is like Word, but assign is whether the word is the value of an
+// assignment, where no field splitting nor globbing happen.
+func (v *Values) word(w *syntax.Word, assign bool) (string, bool) {
+	static := syntax.StaticValue
+	if assign {
+		static = syntax.StaticAssignValue
+	}
+	var buf bytes.Buffer
+	for _, part := range w.Parts {
+		switch x := part.(type) {
+		case *syntax.DblQuoted:
+			if x.Dollar {
+				return "", false
+			}
+			for _, part := range x.Parts {
+				if pe, ok := part.(*syntax.ParamExp); ok {
+					s, ok := v.param(pe)
+					if !ok {
+						return "", false
+					}
+					buf.WriteString(s)
+					continue
+				}
+				s, ok := static(&syntax.Word{Parts: []syntax.WordPart{
+					&syntax.DblQuoted{Parts: []syntax.WordPart{part}},
+				}})
+				if !ok {
+					return "", false
+				}
+				buf.WriteString(s)
+			}
+		case *syntax.ParamExp:
+			s, ok := v.param(x)
+			if !ok {
+				return "", false
+			}
+			if !assign && (s == "" || strings.ContainsAny(s, " \t\n*?[")) {
+				return "", false // field splitting and globbing
+			}
+			buf.WriteString(s)
+		default:
+			s, ok := static(&syntax.Word{Parts: []syntax.WordPart{part}})
+			if !ok {
+				return "", false
+			}
+			buf.WriteString(s)
+		}
+	}
+	return buf.String(), true
+}
+
+// param returns the value of a parameter expansion, if it is a plain one
+// like $foo or ${#foo} of a variable in Vars.
+func (v *Values) param(pe *syntax.ParamExp) (string, bool) {
+	if pe.Param == nil || pe.Excl || pe.Width || pe.Flags != nil || pe.Index != nil ||
+		pe.Slice != nil || pe.Repl != nil || pe.Names != 0 || pe.Exp != nil {
+		return "", false
+	}
+	name := pe.Param.Value
+	val, ok := v.Vars[name]
+	if !ok || v.first[name].After(pe.Pos()) {
+		return "", false
+	}
+	if pe.Length {
+		return strconv.Itoa(utf8.RuneCountInString(val)), true
+	}
+	return val, true
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package analysis
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+var staticValuesTests = []struct {
+	src  string
+	want map[string]string
+}{
+	{"a=1", map[string]string{"a": "1"}},
+	{"a=", map[string]string{"a": ""}},
+	{"a='x y' b=\"z\\$\"", map[string]string{"a": "x y", "b": "z$"}},
+	{"a=1; a=1", map[string]string{"a": "1"}},
+	{"a=1; a=2", map[string]string{}},
+	{"dir=/opt; bin=$dir/bin; app=\"${bin}/app\"", map[string]string{
+		"dir": "/opt", "bin": "/opt/bin", "app": "/opt/bin/app",
+	}},
+	{"b=$a; a=1", map[string]string{"a": "1"}},
+	{"a=$b; b=$a", map[string]string{}},
+	{"a=$a", map[string]string{}},
+	{"a=*.go; n=${#a}", map[string]string{"a": "*.go", "n": "4"}},
+	{"a=~/foo", map[string]string{}},
+	{"a=$(date)", map[string]string{}},
+	{"a=${b:-x}", map[string]string{}},
+	{"a=1; read a", map[string]string{}},
+	{"a=1; for a in x; do :; done", map[string]string{}},
+	{"a=1; a+=2", map[string]string{}},
+	{"a=1; unset a", map[string]string{}},
+	{"a=1; ((a++))", map[string]string{}},
+	{"a=1 cmd", map[string]string{}},
+	{"a=1; export a; readonly b=2", map[string]string{"a": "1", "b": "2"}},
+	{"f() { local a=1; }; declare -r b=2", map[string]string{"a": "1", "b": "2"}},
+	{"a=1; f() { local a; }", map[string]string{}},
+	{"declare -i a=1+1", map[string]string{}},
+	{"a=(1 2)", map[string]string{}},
+}
+
+func TestStaticValues(t *testing.T) {
+	t.Parallel()
+	p := syntax.NewParser()
+	for i, tc := range staticValuesTests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			f, err := p.Parse(strings.NewReader(tc.src), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := StaticValues(f).Vars
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("StaticValues mismatch in %q:\nwant: %q\ngot:  %q",
+					tc.src, tc.want, got)
+			}
+		})
+	}
+}
+
+var staticWordTests = []struct {
+	src  string
+	want string // the value of the argument of the last echo
+	ok   bool
+}{
+	{"echo foo", "foo", true},
+	{`echo 'a b'"c"\ d`, "a bc d", true},
+	{`dir=/opt/app; cd "$dir/bin"; echo "$dir/bin"`, "/opt/app/bin", true},
+	{"dir=/opt/app; echo $dir/bin", "/opt/app/bin", true},
+	{"dir='/opt/my app'; echo $dir/bin", "", false},
+	{"dir='/opt/my app'; echo \"$dir/bin\"", "/opt/my app/bin", true},
+	{"empty=; echo $empty", "", false},
+	{"empty=; echo \"$empty\"", "", true},
+	{"echo $dir; dir=/opt", "", false},
+	{"echo $HOME", "", false},
+	{"echo ${dir:-x}; dir=x", "", false},
+	{"echo *.go", "", false},
+	{"echo {a,b}", "", false},
+	{"echo $(pwd)", "", false},
+}
+
+func TestStaticValuesWord(t *testing.T) {
+	t.Parallel()
+	p := syntax.NewParser()
+	for i, tc := range staticWordTests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			f, err := p.Parse(strings.NewReader(tc.src), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var word *syntax.Word
+			syntax.Walk(f, func(node syntax.Node) bool {
+				if ce, ok := node.(*syntax.CallExpr); ok && len(ce.Args) == 2 {
+					if name, _ := wordLit(ce.Args[0]); name == "echo" {
+						word = ce.Args[1]
+					}
+				}
+				return true
+			})
+			got, ok := StaticValues(f).Word(word)
+			if got != tc.want || ok != tc.ok {
+				t.Fatalf("Word mismatch in %q:\nwant: %q, %v\ngot:  %q, %v",
+					tc.src, tc.want, tc.ok, got, ok)
+			}
+		})
+	}
+}
@@ -14,11 +14,13 @@ import (
 	"golang.org/x/crypto/ssh/terminal"
 
 	"mvdan.cc/sh/interp"
+	"mvdan.cc/sh/repl"
 	"mvdan.cc/sh/syntax"
 )
 
 var (
-	command = flag.String("c", "", "command to be executed")
+	command      = flag.String("c", "", "command to be executed")
+	coverprofile = flag.String("coverprofile", "", "write a coverage profile to file")
 
 	parser *syntax.Parser
 
@@ -27,12 +29,39 @@ var (
 
 func main() {
 	flag.Parse()
-	if err := runAll(); err != nil {
+	if *coverprofile != "" {
+		runner.Coverage = &interp.Coverage{}
+	}
+	err := runAll()
+	if *coverprofile != "" {
+		if err := writeCoverage(*coverprofile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
 
+// writeCoverage writes the coverage profile, in the lcov format if the
+// file ends with .info or .lcov, and as a Go coverage profile otherwise.
+func writeCoverage(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(path, ".info") || strings.HasSuffix(path, ".lcov") {
+		err = runner.Coverage.WriteLcov(f)
+	} else {
+		err = runner.Coverage.WriteProfile(f)
+	}
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
 func runAll() error {
 	parser = syntax.NewParser()
 	if *command != "" {
@@ -71,37 +100,10 @@ func run(reader io.Reader, name string) error {
 	return runner.Run(ctx, prog)
 }
 
-type promptReader struct {
-	io.Reader
-	first bool
-}
-
-func (pr *promptReader) Read(p []byte) (int, error) {
-	if pr.first {
-		fmt.Printf("$ ")
-		pr.first = false
-	} else {
-		fmt.Printf("> ")
-	}
-	return pr.Reader.Read(p)
-}
-
 func interactive() error {
-	r := &promptReader{os.Stdin, true}
-	ctx := context.Background()
-	fn := func(s *syntax.Stmt) bool {
-		if err := runner.Run(ctx, s); err != nil {
-			switch x := err.(type) {
-			case interp.ShellExitStatus:
-				os.Exit(int(x))
-			case interp.ExitStatus:
-			default:
-				fmt.Fprintln(os.Stderr, err)
-				os.Exit(1)
-			}
-		}
-		r.first = true
-		return true
+	err := repl.New(runner, repl.Parser(parser)).Run(context.Background())
+	if x, ok := err.(interp.ShellExitStatus); ok {
+		os.Exit(int(x))
 	}
-	return parser.Stmts(r, fn)
+	return err
 }
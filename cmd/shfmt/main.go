@@ -36,11 +36,14 @@ var (
 	spaceRedirs = flag.Bool("sr", false, "")
 	keepPadding = flag.Bool("kp", false, "")
 	minify      = flag.Bool("mn", false, "")
+	lineEnds    = flag.String("le", "", "")
 
 	toJSON = flag.Bool("tojson", false, "")
+	merge  = flag.Bool("merge", false, "")
 
 	parser            *syntax.Parser
 	printer           *syntax.Printer
+	crlfPrinter       *syntax.Printer
 	readBuf, writeBuf bytes.Buffer
 
 	copyBuf = make([]byte, 32*1024)
@@ -68,7 +71,7 @@ by filename extension and by shebang.
 
 Parser options:
 
-  -ln str   language variant to parse (bash/posix/mksh, default "bash")
+  -ln str   language variant to parse (bash/posix/mksh/ksh93/zsh, default "bash")
   -p        shorthand for -ln=posix
 
 Printer options:
@@ -79,11 +82,14 @@ Printer options:
   -sr       redirect operators will be followed by a space
   -kp       keep column alignment paddings
   -mn       minify program to reduce its size (implies -s)
+  -le str   line endings (lf/crlf/keep, default "lf")
 
 Utilities:
 
   -f        recursively find all shell files and print the paths
   -tojson   print syntax tree to stdout as a typed JSON
+  -merge    merge the files base, ours and theirs into ours, like a git
+            merge driver; exit with an error if there are conflicts
 `)
 	}
 	flag.Parse()
@@ -103,6 +109,10 @@ Utilities:
 		lang = syntax.LangPOSIX
 	case "mksh":
 		lang = syntax.LangMirBSDKorn
+	case "ksh93":
+		lang = syntax.LangKsh93
+	case "zsh":
+		lang = syntax.LangZsh
 	default:
 		fmt.Fprintf(os.Stderr, "unknown shell language: %s\n", *langStr)
 		os.Exit(1)
@@ -110,11 +120,17 @@ Utilities:
 	if *posix {
 		lang = syntax.LangPOSIX
 	}
+	switch *lineEnds {
+	case "lf", "", "crlf", "keep":
+	default:
+		fmt.Fprintf(os.Stderr, "unknown line endings: %s\n", *lineEnds)
+		os.Exit(1)
+	}
 	if *minify {
 		*simple = true
 	}
 	parser = syntax.NewParser(syntax.KeepComments, syntax.Variant(lang))
-	printer = syntax.NewPrinter(func(p *syntax.Printer) {
+	printerOpts := func(p *syntax.Printer) {
 		syntax.Indent(*indent)(p)
 		if *binNext {
 			syntax.BinaryNextLine(p)
@@ -131,7 +147,25 @@ Utilities:
 		if *minify {
 			syntax.Minify(p)
 		}
-	})
+	}
+	printer = syntax.NewPrinter(printerOpts)
+	crlfPrinter = syntax.NewPrinter(printerOpts, syntax.CRLF)
+	if *merge {
+		if flag.NArg() != 3 {
+			fmt.Fprintln(os.Stderr, "-merge requires the base, ours and theirs files")
+			os.Exit(1)
+		}
+		conflicts, err := mergePaths(flag.Arg(0), flag.Arg(1), flag.Arg(2))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if conflicts > 0 {
+			fmt.Fprintf(os.Stderr, "%s: %d merge conflicts\n", flag.Arg(1), conflicts)
+			os.Exit(1)
+		}
+		return
+	}
 	if flag.NArg() == 0 {
 		if err := formatStdin(); err != nil {
 			if err != errChangedWithDiff {
@@ -182,6 +216,9 @@ func walk(path string, onError func(error)) {
 	}
 	if !info.IsDir() {
 		if err := formatPath(path, false); err != nil {
+			if err == fileutil.ErrBinaryFile {
+				err = fmt.Errorf("%s: %v", path, err)
+			}
 			onError(err)
 		}
 		return
@@ -199,6 +236,9 @@ func walk(path string, onError func(error)) {
 			return nil
 		}
 		err = formatPath(path, conf == fileutil.ConfIfShebang)
+		if err == fileutil.ErrBinaryFile {
+			return nil // e.g. a compiled program named foo.sh
+		}
 		if err != nil && !os.IsNotExist(err) {
 			onError(err)
 		}
@@ -231,6 +271,9 @@ func formatPath(path string, checkShebang bool) error {
 		return err
 	}
 	f.Close()
+	if err := fileutil.CheckBinary(readBuf.Bytes()); err != nil {
+		return err
+	}
 	return formatBytes(readBuf.Bytes(), path)
 }
 
@@ -247,7 +290,11 @@ func formatBytes(src []byte, path string) error {
 		return writeJSON(out, prog, true)
 	}
 	writeBuf.Reset()
-	printer.Print(&writeBuf, prog)
+	if *lineEnds == "crlf" || (*lineEnds == "keep" && mostlyCRLF(src)) {
+		crlfPrinter.Print(&writeBuf, prog)
+	} else {
+		printer.Print(&writeBuf, prog)
+	}
 	res := writeBuf.Bytes()
 	if !bytes.Equal(src, res) {
 		if *list {
@@ -335,3 +382,9 @@ func diffBytes(b1, b2 []byte, path string) ([]byte, error) {
 	}
 	return data, nil
 }
+
+// mostlyCRLF reports whether most lines in src end in "\r\n".
+func mostlyCRLF(src []byte) bool {
+	crlfs := bytes.Count(src, []byte("\r\n"))
+	return crlfs*2 > bytes.Count(src, []byte("\n"))
+}
@@ -26,6 +26,7 @@ func TestMain(m *testing.M) {
 	}
 	parser = syntax.NewParser(syntax.KeepComments)
 	printer = syntax.NewPrinter()
+	crlfPrinter = syntax.NewPrinter(syntax.CRLF)
 
 	exit := m.Run()
 	os.RemoveAll(dir)
@@ -59,6 +60,28 @@ func TestStdin(t *testing.T) {
 		}
 	})
 
+	t.Run("LineEndings", func(t *testing.T) {
+		defer func() { *lineEnds = "" }()
+		for _, tc := range []struct {
+			lineEnds, in, want string
+		}{
+			{"", " foo\r\nbar\r\n", "foo\nbar\n"},
+			{"crlf", " foo\nbar\n", "foo\r\nbar\r\n"},
+			{"keep", " foo\r\nbar\r\n", "foo\r\nbar\r\n"},
+			{"keep", " foo\nbar\r\nbaz\n", "foo\nbar\nbaz\n"},
+		} {
+			*lineEnds = tc.lineEnds
+			in = strings.NewReader(tc.in)
+			buf.Reset()
+			if err := formatStdin(); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tc.want {
+				t.Fatalf("-le=%s: got=%q want=%q", tc.lineEnds, got, tc.want)
+			}
+		}
+	})
+
 	t.Run("Diff", func(t *testing.T) {
 		*diff = true
 		defer func() { *diff = false }()
@@ -118,6 +141,9 @@ var walkTests = []struct {
 	{None, false, filepath.Join(".svn", "ext.sh"), " foo"},
 	{None, false, filepath.Join(".hg", "ext.sh"), " foo"},
 	{Error, false, "parse-error.sh", " foo("},
+	{None, false, "binary-nul.sh", "#!/bin/sh\n foo\x00bar"},
+	{None, false, "binary-shebang", "#!/bin/sh\n\x7fELF\x00"},
+	{None, false, "binary-longline.sh", " foo" + strings.Repeat("x", 1<<17)},
 	{None, true, "reallylongdir/symlink-file", "ext-shebang.sh"},
 	{None, true, "symlink-dir", "reallylongdir"},
 	{None, true, "symlink-none", "reallylongdir/nonexistent"},
@@ -197,10 +223,13 @@ func TestWalk(t *testing.T) {
 	if doWalk("nonexistent"); !gotError {
 		t.Fatal("`shfmt nonexistent` did not error")
 	}
+	if doWalk("binary-nul.sh"); !gotError {
+		t.Fatal("`shfmt binary-nul.sh` did not error")
+	}
 	*find = true
 	doWalk(".")
 	numFound := strings.Count(outBuf.String(), "\n")
-	if want := 13; numFound != want {
+	if want := 16; numFound != want {
 		t.Fatalf("shfmt -f printed %d paths, but wanted %d", numFound, want)
 	}
 	*find = false
@@ -0,0 +1,50 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+
+	"mvdan.cc/sh/syntax"
+	"mvdan.cc/sh/transform"
+)
+
+// mergePaths merges the changes made to a file in ours and theirs since
+// base, writing the result to ours like a git merge driver does. It
+// returns the number of conflicts.
+func mergePaths(base, ours, theirs string) (int, error) {
+	var files [3]*syntax.File
+	for i, path := range []string{base, ours, theirs} {
+		f, err := os.Open(path)
+		if err != nil {
+			return 0, err
+		}
+		prog, err := parser.Parse(f, path)
+		f.Close()
+		if err != nil {
+			return 0, err
+		}
+		files[i] = prog
+	}
+	res, conflicts, err := transform.Merge(files[0], files[1], files[2])
+	if err != nil {
+		return 0, err
+	}
+	if conflicts == 0 {
+		// format the result like any other file
+		prog, err := parser.Parse(bytes.NewReader(res), ours)
+		if err != nil {
+			return 0, err
+		}
+		if *simple {
+			syntax.Simplify(prog)
+		}
+		writeBuf.Reset()
+		printer.Print(&writeBuf, prog)
+		res = writeBuf.Bytes()
+	}
+	return conflicts, ioutil.WriteFile(ours, res, 0666)
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMergePaths(t *testing.T) {
+	tests := []struct {
+		base, ours, theirs string
+		want               string
+		conflicts          int
+	}{
+		{"a\nb\n", "a\nb\nc\n", "x\na;   b\n", "x\na\nb\nc\n", 0},
+		{"a\nb\n", "a\nb1\n", "a\nb2\n", "a\n<<<<<<< ours\nb1\n=======\nb2\n>>>>>>> theirs\n", 1},
+	}
+	dir, err := ioutil.TempDir("", "shfmt-merge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	base := filepath.Join(dir, "base.sh")
+	ours := filepath.Join(dir, "ours.sh")
+	theirs := filepath.Join(dir, "theirs.sh")
+	for _, tc := range tests {
+		for path, src := range map[string]string{
+			base: tc.base, ours: tc.ours, theirs: tc.theirs,
+		} {
+			if err := ioutil.WriteFile(path, []byte(src), 0666); err != nil {
+				t.Fatal(err)
+			}
+		}
+		conflicts, err := mergePaths(base, ours, theirs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conflicts != tc.conflicts {
+			t.Fatalf("want %d conflicts, got %d", tc.conflicts, conflicts)
+		}
+		got, err := ioutil.ReadFile(ours)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tc.want {
+			t.Fatalf("got=%q want=%q", got, tc.want)
+		}
+	}
+}
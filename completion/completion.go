@@ -0,0 +1,131 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+// Package completion generates shell completion functions for the options
+// of a shell script, as found by analysis.Flags. This lets the authors of
+// command line tools written in shell derive completions from their
+// actual argument parsing code.
+//
+// The options are completed when the current word starts with a dash,
+// and files are completed otherwise, including for the arguments of
+// options that take one.
+//
+// Separately, Suggest and SignatureAt help editors writing shell programs,
+// by suggesting completions such as variable names and reserved words, and
+// by describing the functions being called.
+//
+// This package is a work in progress and EXPERIMENTAL; its API is not
+// subject to the 1.x backwards compatibility guarantee.
+package completion
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"mvdan.cc/sh/analysis"
+)
+
+// Bash writes a Bash completion function for the command name, followed
+// by the complete command that registers it.
+func Bash(w io.Writer, name string, flags []analysis.Flag) error {
+	flags = validFlags(flags)
+	fn := funcName(name)
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# bash completion for %s\n", name)
+	fmt.Fprintf(&buf, "%s() {\n", fn)
+	buf.WriteString("\tlocal cur=${COMP_WORDS[COMP_CWORD]}\n")
+	var withArg []string
+	for _, flag := range flags {
+		if flag.Arg {
+			withArg = append(withArg, flag.Name)
+		}
+	}
+	if len(withArg) > 0 {
+		buf.WriteString("\tcase ${COMP_WORDS[COMP_CWORD - 1]} in\n")
+		fmt.Fprintf(&buf, "\t%s)\n", strings.Join(withArg, " | "))
+		buf.WriteString("\t\tCOMPREPLY=($(compgen -f -- \"$cur\"))\n")
+		buf.WriteString("\t\treturn\n")
+		buf.WriteString("\t\t;;\n")
+		buf.WriteString("\tesac\n")
+	}
+	if len(flags) > 0 {
+		names := make([]string, len(flags))
+		for i, flag := range flags {
+			names[i] = flag.Name
+		}
+		buf.WriteString("\tif [[ $cur == -* ]]; then\n")
+		fmt.Fprintf(&buf, "\t\tCOMPREPLY=($(compgen -W '%s' -- \"$cur\"))\n",
+			strings.Join(names, " "))
+		buf.WriteString("\t\treturn\n")
+		buf.WriteString("\tfi\n")
+	}
+	buf.WriteString("\tCOMPREPLY=($(compgen -f -- \"$cur\"))\n")
+	buf.WriteString("}\n")
+	fmt.Fprintf(&buf, "complete -F %s %s\n", fn, quote(name))
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Zsh writes a Zsh completion function for the command name, in the form
+// of a file to be placed in a directory of $fpath.
+func Zsh(w io.Writer, name string, flags []analysis.Flag) error {
+	flags = validFlags(flags)
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "#compdef %s\n\n", quote(name))
+	buf.WriteString("_arguments -s \\\n")
+	for _, flag := range flags {
+		if flag.Arg {
+			fmt.Fprintf(&buf, "\t'%s:argument:_files' \\\n", flag.Name)
+		} else {
+			fmt.Fprintf(&buf, "\t'%s' \\\n", flag.Name)
+		}
+	}
+	buf.WriteString("\t'*:file:_files'\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// validFlags drops the flags whose names would need quoting, which are
+// very unlikely to be real options.
+func validFlags(flags []analysis.Flag) []analysis.Flag {
+	var valid []analysis.Flag
+	for _, flag := range flags {
+		if strings.IndexFunc(flag.Name, notFlagRune) < 0 {
+			valid = append(valid, flag)
+		}
+	}
+	return valid
+}
+
+func notFlagRune(r rune) bool {
+	switch {
+	case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		return false
+	}
+	return !strings.ContainsRune("-_.+@%", r)
+}
+
+// funcName returns the name of the completion function for a command,
+// such as _my_tool for my-tool.
+func funcName(name string) string {
+	var buf bytes.Buffer
+	buf.WriteByte('_')
+	for _, r := range name {
+		if 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' {
+			buf.WriteRune(r)
+		} else {
+			buf.WriteByte('_')
+		}
+	}
+	return buf.String()
+}
+
+// quote returns s as a single shell word.
+func quote(s string) string {
+	if s != "" && strings.IndexFunc(s, notFlagRune) < 0 {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
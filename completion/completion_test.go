@@ -0,0 +1,104 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package completion
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/analysis"
+	"mvdan.cc/sh/syntax"
+)
+
+const script = `while getopts "vf:" o; do :; done
+case $1 in --out=*) ;; --dry-run) ;; -\'x) ;; esac`
+
+var completionTests = []struct {
+	name, src string
+	bash, zsh string
+}{
+	{
+		"my-tool", script,
+		`# bash completion for my-tool
+_my_tool() {
+	local cur=${COMP_WORDS[COMP_CWORD]}
+	case ${COMP_WORDS[COMP_CWORD - 1]} in
+	-f | --out)
+		COMPREPLY=($(compgen -f -- "$cur"))
+		return
+		;;
+	esac
+	if [[ $cur == -* ]]; then
+		COMPREPLY=($(compgen -W '-v -f --out --dry-run' -- "$cur"))
+		return
+	fi
+	COMPREPLY=($(compgen -f -- "$cur"))
+}
+complete -F _my_tool my-tool
+`,
+		`#compdef my-tool
+
+_arguments -s \
+	'-v' \
+	'-f:argument:_files' \
+	'--out:argument:_files' \
+	'--dry-run' \
+	'*:file:_files'
+`,
+	},
+	{
+		"it's", "echo",
+		`# bash completion for it's
+_it_s() {
+	local cur=${COMP_WORDS[COMP_CWORD]}
+	COMPREPLY=($(compgen -f -- "$cur"))
+}
+complete -F _it_s 'it'\''s'
+`,
+		`#compdef 'it'\''s'
+
+_arguments -s \
+	'*:file:_files'
+`,
+	},
+}
+
+func TestCompletion(t *testing.T) {
+	t.Parallel()
+	for i, tc := range completionTests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			f, err := syntax.NewParser().Parse(strings.NewReader(tc.src), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			flags := analysis.Flags(f)
+			var buf bytes.Buffer
+			if err := Bash(&buf, tc.name, flags); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tc.bash {
+				t.Fatalf("Bash mismatch:\nwant:\n%s\ngot:\n%s", tc.bash, got)
+			}
+			// the generated code must be valid, and formatted
+			f, err = syntax.NewParser(syntax.KeepComments).Parse(&buf, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf.Reset()
+			syntax.NewPrinter().Print(&buf, f)
+			if got := buf.String(); got != tc.bash {
+				t.Fatalf("Bash is not formatted:\nwant:\n%s\ngot:\n%s", tc.bash, got)
+			}
+			buf.Reset()
+			if err := Zsh(&buf, tc.name, flags); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tc.zsh {
+				t.Fatalf("Zsh mismatch:\nwant:\n%s\ngot:\n%s", tc.zsh, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package completion
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// Signature describes a function defined in a shell program, as used at a
+// call site.
+type Signature struct {
+	Name string
+	Pos  syntax.Pos // of the function declaration
+
+	// Doc is the text of the comment lines right before the declaration,
+	// without their hashes.
+	Doc string
+
+	// Params are the positional parameters used by the function, from $1
+	// up to the highest one used.
+	Params []Param
+
+	// Variadic is whether the function uses all of its arguments, via $@
+	// or $*.
+	Variadic bool
+
+	// Active is the index of the argument at the cursor, starting at 0 for
+	// the first parameter. It may be beyond Params if Variadic is true, and
+	// it is -1 if the cursor is on the function name.
+	Active int
+}
+
+// Param is a positional parameter of a function.
+type Param struct {
+	// Name is the variable that the parameter is first assigned to, like
+	// "dst" in "local dst=$2". It is empty if there is none.
+	Name string
+}
+
+// String returns a summary of the signature, such as "copy src dst ...",
+// where parameters without a name are shown like $3.
+func (s *Signature) String() string {
+	var b bytes.Buffer
+	b.WriteString(s.Name)
+	for i, param := range s.Params {
+		b.WriteByte(' ')
+		if param.Name != "" {
+			b.WriteString(param.Name)
+		} else {
+			b.WriteString("$" + strconv.Itoa(i+1))
+		}
+	}
+	if s.Variadic {
+		b.WriteString(" ...")
+	}
+	return b.String()
+}
+
+// SignatureAt returns the signature of the function called by the command
+// at the given byte offset in a shell program, and which argument is at
+// the cursor. It returns nil if the command isn't a function defined in
+// the program.
+//
+// If the program has syntax errors, only its complete statements before
+// the first error are used, so the call must be within one of them.
+func SignatureAt(src []byte, offset int) *Signature {
+	p := syntax.NewParser(syntax.KeepComments)
+	f, err := p.Parse(bytes.NewReader(src), "")
+	if err != nil {
+		f = &syntax.File{}
+		p.Stmts(bytes.NewReader(src), func(st *syntax.Stmt) bool {
+			f.Stmts = append(f.Stmts, st)
+			return true
+		})
+	}
+	var call *syntax.CallExpr
+	for _, node := range nodesBefore(f, offset) {
+		if ce, ok := node.(*syntax.CallExpr); ok && len(ce.Args) > 0 {
+			call = ce
+			break
+		}
+	}
+	if call == nil {
+		return nil
+	}
+	name, ok := litWord(call.Args[0])
+	if !ok {
+		return nil
+	}
+	var sig *Signature
+	syntax.Walk(f, func(node syntax.Node) bool {
+		if sig != nil {
+			return false
+		}
+		if st, ok := node.(*syntax.Stmt); ok {
+			if fd, ok := st.Cmd.(*syntax.FuncDecl); ok && fd.Name.Value == name {
+				sig = funcSignature(st, fd)
+			}
+		}
+		return true
+	})
+	if sig == nil {
+		return nil
+	}
+	sig.Active = -1
+	for i, arg := range call.Args {
+		if uint(offset) >= arg.Pos().Offset() {
+			sig.Active = i - 1
+		}
+		if uint(offset) > arg.End().Offset() {
+			sig.Active = i // in the space after the argument
+		}
+	}
+	return sig
+}
+
+// nodesBefore is like syntax.NodeAt, but it also finds the nodes ending
+// right at the offset, as the cursor is often at the end of a word.
+func nodesBefore(f *syntax.File, offset int) []syntax.Node {
+	if nodes := syntax.NodeAt(f, offset); len(nodes) > 1 || offset == 0 {
+		return nodes
+	}
+	return syntax.NodeAt(f, offset-1)
+}
+
+func funcSignature(st *syntax.Stmt, fd *syntax.FuncDecl) *Signature {
+	sig := &Signature{Name: fd.Name.Value, Pos: fd.Pos()}
+	// only keep the comments right before the declaration
+	var doc []string
+	line := fd.Pos().Line()
+	for i := len(st.Comments) - 1; i >= 0; i-- {
+		c := st.Comments[i]
+		if c.Pos().Line() != line-1 {
+			if c.Pos().Line() < line {
+				break
+			}
+			continue
+		}
+		doc = append([]string{strings.TrimPrefix(c.Text, " ")}, doc...)
+		line--
+	}
+	sig.Doc = strings.Join(doc, "\n")
+
+	var names []string
+	syntax.Walk(fd.Body, func(node syntax.Node) bool {
+		switch x := node.(type) {
+		case *syntax.FuncDecl:
+			return false // a nested function has its own parameters
+		case *syntax.Assign:
+			if x.Name == nil || x.Value == nil || len(x.Value.Parts) != 1 {
+				break
+			}
+			if n := paramNumber(x.Value.Parts[0]); n > 0 {
+				for len(names) < n {
+					names = append(names, "")
+				}
+				if names[n-1] == "" {
+					names[n-1] = x.Name.Value
+				}
+			}
+		case *syntax.ParamExp:
+			if x.Param == nil {
+				break
+			}
+			switch name := x.Param.Value; name {
+			case "@", "*":
+				sig.Variadic = true
+			default:
+				if n, err := strconv.Atoi(name); err == nil && n > len(names) {
+					names = append(names, make([]string, n-len(names))...)
+				}
+			}
+		}
+		return true
+	})
+	for _, name := range names {
+		sig.Params = append(sig.Params, Param{Name: name})
+	}
+	return sig
+}
+
+// paramNumber returns n if part is $n, "$n" or ${n}, or 0 otherwise.
+func paramNumber(part syntax.WordPart) int {
+	if dq, ok := part.(*syntax.DblQuoted); ok && len(dq.Parts) == 1 {
+		part = dq.Parts[0]
+	}
+	pe, ok := part.(*syntax.ParamExp)
+	if !ok || pe.Param == nil || pe.Exp != nil || pe.Index != nil || pe.Length {
+		return 0
+	}
+	n, err := strconv.Atoi(pe.Param.Value)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+func litWord(w *syntax.Word) (string, bool) {
+	if len(w.Parts) != 1 {
+		return "", false
+	}
+	lit, ok := w.Parts[0].(*syntax.Lit)
+	if !ok {
+		return "", false
+	}
+	return lit.Value, true
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package completion
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const signatureSrc = `# unrelated
+
+# copy copies a file,
+# keeping its mode.
+copy() {
+	local src=$1 dst="$2"
+	cp -p "$src" "$dst" "$4"
+}
+
+log() { echo "$@"; }
+nested() {
+	inner() { echo $3; }
+	echo ${1:-x}
+}
+`
+
+var signatureTests = []struct {
+	call string // the cursor is at "|"
+	want string
+}{
+	{"co|py a b", "copy src dst $3 $4 (active -1)"},
+	{"copy |a b", "copy src dst $3 $4 (active 0)"},
+	{"copy a| b", "copy src dst $3 $4 (active 0)"},
+	{"copy a |b", "copy src dst $3 $4 (active 1)"},
+	{"copy a  |  b", "copy src dst $3 $4 (active 1)"},
+	{"log x y |z", "log ... (active 2)"},
+	{"nested |x", "nested $1 (active 0)"},
+	{"ls |x", "<nil>"},
+	{"echo $(copy |x)", "copy src dst $3 $4 (active 0)"},
+	{"if copy x; then copy |y; fi", "copy src dst $3 $4 (active 0)"},
+	{"if copy x; then copy |y", "<nil>"},
+}
+
+func TestSignatureAt(t *testing.T) {
+	t.Parallel()
+	for i, tc := range signatureTests {
+		t.Run(fmt.Sprintf("%02d", i), func(t *testing.T) {
+			src := signatureSrc + tc.call
+			offset := strings.IndexByte(src, '|')
+			src = src[:offset] + src[offset+1:]
+			got := "<nil>"
+			if sig := SignatureAt([]byte(src), offset); sig != nil {
+				got = fmt.Sprintf("%s (active %d)", sig, sig.Active)
+			}
+			if got != tc.want {
+				t.Fatalf("SignatureAt mismatch in %q:\nwant: %s\ngot:  %s",
+					tc.call, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestSignatureDoc(t *testing.T) {
+	t.Parallel()
+	src := signatureSrc + "copy a b"
+	sig := SignatureAt([]byte(src), len(src))
+	if sig == nil {
+		t.Fatal("no signature found")
+	}
+	want := "copy copies a file,\nkeeping its mode."
+	if sig.Doc != want {
+		t.Fatalf("want doc %q, got %q", want, sig.Doc)
+	}
+	if line := sig.Pos.Line(); line != 5 {
+		t.Fatalf("want declaration at line 5, got %d", line)
+	}
+}
@@ -0,0 +1,335 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package completion
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"mvdan.cc/sh/analysis"
+	"mvdan.cc/sh/syntax"
+)
+
+// Kind is the kind of a suggested completion.
+type Kind int
+
+const (
+	Variable Kind = iota
+	Function
+	Keyword
+	Operator // of a parameter expansion, like ":-" in ${v:-x}
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Variable:
+		return "variable"
+	case Function:
+		return "function"
+	case Keyword:
+		return "keyword"
+	default:
+		return "operator"
+	}
+}
+
+// Item is a suggested completion.
+type Item struct {
+	// Label is the text to insert, replacing the source from Start up to
+	// the cursor.
+	Label string
+	Start int
+	Kind  Kind
+
+	// Detail describes the item, such as what an operator does.
+	Detail string
+}
+
+// paramOps are the operators suggested after the name in "${name".
+var paramOps = []struct{ op, detail string }{
+	{":-", "use a default value if unset or null"},
+	{"-", "use a default value if unset"},
+	{":=", "assign a default value if unset or null"},
+	{"=", "assign a default value if unset"},
+	{":?", "fail if unset or null"},
+	{"?", "fail if unset"},
+	{":+", "use an alternate value if set and not null"},
+	{"+", "use an alternate value if set"},
+	{"#", "remove the shortest matching prefix"},
+	{"##", "remove the longest matching prefix"},
+	{"%", "remove the shortest matching suffix"},
+	{"%%", "remove the longest matching suffix"},
+	{"/", "replace the first match"},
+	{"//", "replace all matches"},
+	{"^", "upper case the first character"},
+	{"^^", "upper case all characters"},
+	{",", "lower case the first character"},
+	{",,", "lower case all characters"},
+	{":", "take a substring"},
+}
+
+// startKeywords are the reserved words which can start a command.
+var startKeywords = []string{
+	"!", "[[", "case", "for", "function", "if", "select", "time",
+	"until", "while", "{",
+}
+
+// closeKeywords are the reserved words which can continue or end the
+// innermost open compound command, by the reserved word that opened it or
+// that was last seen within it.
+var closeKeywords = map[string][]string{
+	"if":     {"then"},
+	"elif":   {"then"},
+	"then":   {"elif", "else", "fi"},
+	"else":   {"fi"},
+	"while":  {"do"},
+	"until":  {"do"},
+	"for":    {"do"},
+	"select": {"do"},
+	"do":     {"done"},
+	"case":   {"esac"},
+	"{":      {"}"},
+}
+
+// Suggest returns the completions for the word being typed at the given
+// byte offset in a shell program, which may be incomplete:
+//
+//   - variables after "$" or "${", such as $fo or ${fo
+//   - the operators of parameter expansions, such as :- after ${foo
+//   - functions and the reserved words valid in the position of a command,
+//     such as fi after "if x; then y;"
+//   - in after "for name" and "case word"
+//
+// Only items starting with the part of the word already typed are
+// returned, sorted by kind and label. Variables and functions are those
+// defined anywhere in the complete statements of the program.
+func Suggest(src []byte, offset int) []Item {
+	ctx := scanCursor(src[:offset])
+	var items []Item
+	add := func(kind Kind, prefix string, labels ...string) {
+		for _, label := range labels {
+			if strings.HasPrefix(label, prefix) {
+				items = append(items, Item{Label: label, Start: offset - len(prefix), Kind: kind})
+			}
+		}
+	}
+	switch {
+	case ctx.single || ctx.comment:
+		return nil
+	case ctx.param != nil:
+		name := *ctx.param
+		add(Variable, name, symbols(src).vars...)
+		if name != "" {
+			for _, op := range paramOps {
+				items = append(items, Item{Label: op.op, Start: offset, Kind: Operator, Detail: op.detail})
+			}
+		}
+	case ctx.dollar != nil:
+		add(Variable, *ctx.dollar, symbols(src).vars...)
+	case ctx.double:
+	case ctx.cmdPos:
+		add(Function, ctx.word, symbols(src).funcs...)
+		add(Keyword, ctx.word, startKeywords...)
+		if len(ctx.blocks) > 0 {
+			add(Keyword, ctx.word, closeKeywords[ctx.blocks[len(ctx.blocks)-1]]...)
+		}
+	case len(ctx.words) == 2:
+		switch ctx.words[0] {
+		case "for", "select", "case":
+			add(Keyword, ctx.word, "in")
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].Kind != items[j].Kind {
+			return items[i].Kind < items[j].Kind
+		}
+		if items[i].Kind == Operator {
+			return false // keep their logical order
+		}
+		return items[i].Label < items[j].Label
+	})
+	return items
+}
+
+type names struct {
+	vars, funcs []string
+}
+
+// symbols returns the names defined by the complete statements of src,
+// ignoring those after a syntax error or an unfinished statement.
+func symbols(src []byte) names {
+	f := &syntax.File{}
+	syntax.NewParser().Stmts(bytes.NewReader(src), func(st *syntax.Stmt) bool {
+		f.Stmts = append(f.Stmts, st)
+		return true
+	})
+	syms, _ := analysis.NewAnalyzer().Symbols(f)
+	var n names
+	for name := range syms.Vars {
+		n.vars = append(n.vars, name)
+	}
+	for name := range syms.Funcs {
+		n.funcs = append(n.funcs, name)
+	}
+	return n
+}
+
+// cursor is the position of the cursor, found by scanning the source
+// before it. It is a rough approximation of the grammar, as the source
+// is often incomplete while it's being edited.
+type cursor struct {
+	single, double, comment bool
+
+	word   string   // the part of the current word before the cursor
+	words  []string // the previous words of the current command
+	cmdPos bool     // whether the current word is in the position of a command
+	blocks []string // open compound commands, by their last reserved word
+
+	param  *string // the name typed after "${"
+	dollar *string // the name typed after "$"
+}
+
+func scanCursor(src []byte) *cursor {
+	c := &cursor{cmdPos: true}
+	var word []byte
+	endWord := func() {
+		if len(word) > 0 {
+			c.word = string(word)
+			c.endWord()
+			word = word[:0]
+		}
+	}
+	for i := 0; i < len(src); i++ {
+		b := src[i]
+		switch {
+		case c.comment:
+			if b == '\n' {
+				c.comment = false
+				c.separator()
+			}
+			continue
+		case c.single:
+			c.single = b != '\''
+		case b == '\\':
+			if i++; i < len(src) {
+				word = append(word, b, src[i])
+			}
+			continue
+		case c.double:
+			c.double = b != '"'
+		case b == '\'':
+			c.single = true
+		case b == '"':
+			c.double = true
+		case b == '#' && len(word) == 0:
+			c.comment = true
+			continue
+		case b == ' ' || b == '\t':
+			endWord()
+			continue
+		case b == '(' && len(word) > 0 && word[len(word)-1] == '$':
+			// a command substitution starts a new command
+			word = word[:0]
+			c.blocks = append(c.blocks, "(")
+			c.separator()
+			continue
+		case strings.IndexByte(";&|()\n`", b) >= 0:
+			endWord()
+			switch top := c.top(); {
+			case b == '(':
+				c.blocks = append(c.blocks, "(")
+			case b == ')' && top == "(":
+				c.pop()
+			}
+			c.separator()
+			continue
+		}
+		word = append(word, b)
+	}
+	c.word = string(word)
+	if c.single || c.comment {
+		return c
+	}
+	if i := strings.LastIndex(c.word, "${"); i >= 0 {
+		name := strings.TrimLeft(c.word[i+2:], "!#")
+		if validPrefix(name) {
+			c.param = &name
+			return c
+		}
+	}
+	if i := strings.LastIndexByte(c.word, '$'); i >= 0 {
+		name := c.word[i+1:]
+		if validPrefix(name) {
+			c.dollar = &name
+		}
+	}
+	return c
+}
+
+func validPrefix(name string) bool {
+	return name == "" || syntax.ValidName(name)
+}
+
+func (c *cursor) top() string {
+	if len(c.blocks) == 0 {
+		return ""
+	}
+	return c.blocks[len(c.blocks)-1]
+}
+
+func (c *cursor) pop() {
+	c.blocks = c.blocks[:len(c.blocks)-1]
+}
+
+// separator starts a new command.
+func (c *cursor) separator() {
+	c.words = c.words[:0]
+	c.cmdPos = true
+}
+
+// endWord adds the finished current word to the command, following any
+// reserved words.
+func (c *cursor) endWord() {
+	w := c.word
+	if !c.cmdPos {
+		c.words = append(c.words, w)
+		return
+	}
+	top := c.top()
+	switch w {
+	case "if", "while", "until", "{":
+		c.blocks = append(c.blocks, w)
+		return
+	case "!", "time":
+		return
+	case "then":
+		if top == "if" || top == "elif" {
+			c.blocks[len(c.blocks)-1] = w
+		}
+		return
+	case "elif", "else":
+		if top == "then" {
+			c.blocks[len(c.blocks)-1] = w
+		}
+		return
+	case "do":
+		switch top {
+		case "while", "until", "for", "select":
+			c.blocks[len(c.blocks)-1] = w
+		}
+		return
+	case "fi", "done", "esac", "}":
+		if top != "" && top != "(" {
+			c.pop()
+		}
+	case "for", "select", "case":
+		c.blocks = append(c.blocks, w)
+	}
+	if i := strings.IndexByte(w, '='); i > 0 && syntax.ValidName(w[:i]) {
+		return // an assignment before the command
+	}
+	c.words = append(c.words, w)
+	c.cmdPos = false
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package completion
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var suggestTests = []struct {
+	src  string // the cursor is at "|"
+	want []string
+}{
+	{"foo=1; fox=2; bar=3; echo $fo|", []string{"variable foo", "variable fox"}},
+	{"foo=1; echo \"${|\"", []string{"variable foo"}},
+	{"foo=1; echo ${!|", []string{"variable foo"}},
+	{"foo=1; echo 'x $f|", nil},
+	{"foo=1 # echo $f|", nil},
+	{"build() { :; }; bu|", []string{"function build"}},
+	{"wh|", []string{"keyword while"}},
+	{"if true; then\n\techo x\nf|", []string{"keyword fi", "keyword for", "keyword function"}},
+	{"if true; then echo \"f|", nil},
+	{"if true; e|", nil},
+	{"while x; do y; d|", []string{"keyword done"}},
+	{"for i in 1 2; d|", []string{"keyword do"}},
+	{"case $x in a) e|", []string{"keyword esac"}},
+	{"case $x in\na) ;;\ne|", []string{"keyword esac"}},
+	{"for i i|", []string{"keyword in"}},
+	{"echo i|", nil},
+	{"x=$(whi|", []string{"keyword while"}},
+	{"FOO=1 wh|", []string{"keyword while"}},
+	{"if true; then\n\tlocal=1\nfi\nx=1; echo $|\nlater=2", []string{
+		"variable later", "variable local", "variable x",
+	}},
+	{"f() { :; }\nif true; then\n\tf|", []string{"function f", "keyword fi", "keyword for", "keyword function"}},
+}
+
+func TestSuggest(t *testing.T) {
+	t.Parallel()
+	for i, tc := range suggestTests {
+		t.Run(fmt.Sprintf("%02d", i), func(t *testing.T) {
+			offset := strings.IndexByte(tc.src, '|')
+			src := tc.src[:offset] + tc.src[offset+1:]
+			var got []string
+			for _, item := range Suggest([]byte(src), offset) {
+				got = append(got, fmt.Sprintf("%s %s", item.Kind, item.Label))
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("Suggest mismatch in %q:\nwant: %q\ngot:  %q",
+					tc.src, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestSuggestParamOps(t *testing.T) {
+	t.Parallel()
+	src := "foo=1; echo ${foo"
+	items := Suggest([]byte(src), len(src))
+	if len(items) != 1+len(paramOps) {
+		t.Fatalf("want foo and %d operators, got %v", len(paramOps), items)
+	}
+	want := []Item{
+		{Label: "foo", Start: len(src) - 3, Kind: Variable},
+		{Label: ":-", Start: len(src), Kind: Operator,
+			Detail: "use a default value if unset or null"},
+	}
+	if !reflect.DeepEqual(items[:2], want) {
+		t.Fatalf("want first items %#v, got %#v", want, items[:2])
+	}
+}
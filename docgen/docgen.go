@@ -0,0 +1,294 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+// Package docgen generates reference documentation for shell scripts, in
+// Markdown or as a roff manual page.
+//
+// The documentation is gathered from the syntax tree alone: the comment
+// block at the top of the script, the functions it defines along with the
+// comment blocks right before them, the options it handles, and the text
+// printed by its usage or help function. The script must have been parsed
+// with syntax.KeepComments.
+//
+// This package is a work in progress and EXPERIMENTAL; its API is not
+// subject to the 1.x backwards compatibility guarantee.
+package docgen
+
+import (
+	"bytes"
+	"strings"
+
+	"mvdan.cc/sh/analysis"
+	"mvdan.cc/sh/syntax"
+)
+
+// Doc is the documentation of a shell script.
+type Doc struct {
+	// Name is the name of the script, such as "deploy.sh".
+	Name string
+
+	// Header is the comment block at the top of the script, after any
+	// shebang line.
+	Header string
+
+	// Usage is the text printed by the script's usage or help function,
+	// or by the branch handling -h or --help. Expansions of $0, such as
+	// $(basename "$0"), are replaced by Name.
+	Usage string
+
+	Flags []analysis.Flag
+	Funcs []Func
+}
+
+// Func is a function defined by a shell script.
+type Func struct {
+	Name string
+	Pos  syntax.Pos
+
+	// Doc is the comment block right before the function.
+	Doc string
+}
+
+// New collects the documentation of the script f. Its name is taken from
+// f.Name.
+func New(f *syntax.File) *Doc {
+	d := &Doc{Name: f.Name, Header: header(f), Flags: analysis.Flags(f)}
+	var usageSrcs []syntax.Node
+	syntax.Walk(f, func(node syntax.Node) bool {
+		switch x := node.(type) {
+		case *syntax.Stmt:
+			fd, ok := x.Cmd.(*syntax.FuncDecl)
+			if !ok {
+				break
+			}
+			fn := Func{
+				Name: fd.Name.Value,
+				Pos:  fd.Pos(),
+				Doc:  commentBlock(x.Comments, x.Pos().Line()),
+			}
+			d.Funcs = append(d.Funcs, fn)
+			name := strings.ToLower(fn.Name)
+			if strings.Contains(name, "usage") || strings.Contains(name, "help") {
+				usageSrcs = append(usageSrcs, fd.Body)
+			}
+		case *syntax.CaseItem:
+			for _, pat := range x.Patterns {
+				if s, _ := lit(pat); s == "-h" || s == "--help" {
+					usageSrcs = append(usageSrcs, x)
+					break
+				}
+			}
+		}
+		return true
+	})
+	for _, node := range usageSrcs {
+		if d.Usage = d.usage(node); d.Usage != "" {
+			break
+		}
+	}
+	return d
+}
+
+// header returns the first comment block at the top of f. A block right
+// before a function documents the function instead.
+func header(f *syntax.File) string {
+	comments := f.Last
+	if len(f.Stmts) > 0 {
+		comments = nil
+		first := f.Stmts[0]
+		for _, c := range first.Comments {
+			if c.Hash.Line() < first.Pos().Line() {
+				comments = append(comments, c)
+			}
+		}
+	}
+	if len(comments) > 0 && comments[0].Hash.Line() == 1 && strings.HasPrefix(comments[0].Text, "!") {
+		comments = comments[1:] // shebang
+	}
+	var lines []string
+	for i, c := range comments {
+		if i > 0 && c.Hash.Line() != comments[i-1].Hash.Line()+1 {
+			break
+		}
+		lines = append(lines, commentText(c))
+	}
+	if len(f.Stmts) > 0 && len(lines) == len(comments) {
+		if _, ok := f.Stmts[0].Cmd.(*syntax.FuncDecl); ok {
+			return ""
+		}
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// commentBlock returns the text of the contiguous comments ending on the
+// line before the given one.
+func commentBlock(comments []syntax.Comment, line uint) string {
+	var block []syntax.Comment
+	for _, c := range comments {
+		switch l := c.Hash.Line(); {
+		case l >= line:
+		case len(block) > 0 && l == block[len(block)-1].Hash.Line()+1:
+			block = append(block, c)
+		default:
+			block = []syntax.Comment{c}
+		}
+	}
+	if len(block) == 0 || block[len(block)-1].Hash.Line() != line-1 {
+		return ""
+	}
+	lines := make([]string, len(block))
+	for i, c := range block {
+		lines[i] = commentText(c)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+func commentText(c syntax.Comment) string {
+	return strings.TrimPrefix(c.Text, " ")
+}
+
+// usage returns the text printed by node via echo, printf, or heredocs.
+func (d *Doc) usage(node syntax.Node) string {
+	var buf bytes.Buffer
+	syntax.Walk(node, func(node syntax.Node) bool {
+		s, ok := node.(*syntax.Stmt)
+		if !ok {
+			return true
+		}
+		for _, rd := range s.Redirs {
+			if rd.Hdoc == nil {
+				continue
+			}
+			body := d.text(rd.Hdoc)
+			if rd.Op == syntax.DashHdoc {
+				body = strings.Replace("\n"+body, "\n\t", "\n", -1)[1:]
+			}
+			buf.WriteString(body)
+		}
+		ce, ok := s.Cmd.(*syntax.CallExpr)
+		if !ok || len(ce.Args) == 0 {
+			return true
+		}
+		args := ce.Args[1:]
+		switch name, _ := lit(ce.Args[0]); name {
+		case "echo":
+			escapes := false
+			for len(args) > 0 {
+				if flag, _ := lit(args[0]); flag == "-e" {
+					escapes = true
+				} else if flag != "-n" && flag != "-E" {
+					break
+				}
+				args = args[1:]
+			}
+			strs := make([]string, len(args))
+			for i, arg := range args {
+				strs[i] = d.text(arg)
+			}
+			line := strings.Join(strs, " ")
+			if escapes {
+				line = unescape(line)
+			}
+			buf.WriteString(line + "\n")
+		case "printf":
+			if len(args) == 0 {
+				break
+			}
+			var strs []string
+			for _, arg := range args[1:] {
+				strs = append(strs, d.text(arg))
+			}
+			buf.WriteString(printf(unescape(d.text(args[0])), strs))
+		}
+		return true
+	})
+	return strings.TrimSpace(buf.String())
+}
+
+// text returns the text a word expands to, as far as it is known
+// statically. Any expansion involving $0 is replaced by the script's name,
+// and other expansions are kept as written.
+func (d *Doc) text(word *syntax.Word) string {
+	var buf bytes.Buffer
+	for _, part := range word.Parts {
+		d.partText(&buf, part)
+	}
+	return buf.String()
+}
+
+func (d *Doc) partText(buf *bytes.Buffer, part syntax.WordPart) {
+	switch x := part.(type) {
+	case *syntax.Lit:
+		buf.WriteString(x.Value)
+	case *syntax.SglQuoted:
+		buf.WriteString(x.Value)
+	case *syntax.DblQuoted:
+		for _, part := range x.Parts {
+			d.partText(buf, part)
+		}
+	default:
+		usesName := false
+		syntax.Walk(part, func(node syntax.Node) bool {
+			if pe, ok := node.(*syntax.ParamExp); ok && pe.Param.Value == "0" {
+				usesName = true
+			}
+			return !usesName
+		})
+		if usesName {
+			buf.WriteString(d.Name)
+			break
+		}
+		syntax.NewPrinter().Print(buf, &syntax.Word{Parts: []syntax.WordPart{part}})
+	}
+}
+
+var unescaper = strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\\`, `\`)
+
+func unescape(s string) string { return unescaper.Replace(s) }
+
+// printf applies a printf format, only supporting verbs like %s, which are
+// replaced by the arguments in order.
+func printf(format string, args []string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			buf.WriteByte(format[i])
+			continue
+		}
+		i++
+		if format[i] == '%' {
+			buf.WriteByte('%')
+			continue
+		}
+		// skip flags and widths, like in %-10s
+		for i < len(format) && strings.IndexByte("-+ #0123456789.", format[i]) >= 0 {
+			i++
+		}
+		if len(args) > 0 {
+			buf.WriteString(args[0])
+			args = args[1:]
+		}
+	}
+	return buf.String()
+}
+
+// lit returns the value of a word if it is a plain literal, possibly
+// quoted.
+func lit(w *syntax.Word) (string, bool) {
+	if len(w.Parts) != 1 {
+		return "", false
+	}
+	switch x := w.Parts[0].(type) {
+	case *syntax.Lit:
+		return x.Value, true
+	case *syntax.SglQuoted:
+		return x.Value, true
+	case *syntax.DblQuoted:
+		if len(x.Parts) == 1 {
+			if l, ok := x.Parts[0].(*syntax.Lit); ok {
+				return l.Value, true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package docgen
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+const script = `#!/bin/bash
+# Deploys the app.
+#
+# Needs ssh access.
+
+# usage prints the help text.
+usage() {
+	cat <<-EOF
+		Usage: $(basename "$0") [-v] [-t target]
+	EOF
+}
+
+# not this one
+
+# deploy copies the files.
+# It may take a while.
+deploy() { :; }
+
+while getopts "vt:" opt; do
+	case $opt in
+	h) usage ;;
+	esac
+done
+`
+
+func parse(t *testing.T, src string) *syntax.File {
+	f, err := syntax.NewParser(syntax.KeepComments).Parse(strings.NewReader(src), "deploy.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestMarkdown(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	if err := New(parse(t, script)).Markdown(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "# deploy.sh\n\nDeploys the app.\n\nNeeds ssh access.\n\n" +
+		"## Usage\n\n```\nUsage: deploy.sh [-v] [-t target]\n```\n\n" +
+		"## Options\n\n* `-v`\n* `-t` *argument*\n\n" +
+		"## Functions\n\n### usage\n\nusage prints the help text.\n\n" +
+		"### deploy\n\ndeploy copies the files.\nIt may take a while.\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("Markdown mismatch:\nwant:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestRoff(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	if err := New(parse(t, script)).Roff(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := ".TH DEPLOY.SH 1\n.SH NAME\ndeploy.sh\n" +
+		".SH SYNOPSIS\n.nf\nUsage: deploy.sh [\\-v] [\\-t target]\n.fi\n" +
+		".SH DESCRIPTION\nDeploys the app.\n\nNeeds ssh access.\n" +
+		".SH OPTIONS\n.TP\n.B \\-v\n.TP\n.B \\-t \\fIargument\\fR\n" +
+		".SH FUNCTIONS\n.SS usage\nusage prints the help text.\n" +
+		".SS deploy\ndeploy copies the files.\nIt may take a while.\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("Roff mismatch:\nwant:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+var newTests = []struct {
+	src  string
+	want Doc
+}{
+	{"", Doc{}},
+	{"#!/bin/sh\n# foo\nbar", Doc{Header: "foo"}},
+	{"#!/bin/sh\n\n# foo\n\nbar # baz", Doc{Header: "foo"}},
+	{
+		"# foo\nf() { :; }",
+		Doc{Funcs: []Func{{Name: "f", Doc: "foo"}}},
+	},
+	{
+		"# foo\n\n# bar\nf() { :; }",
+		Doc{Header: "foo", Funcs: []Func{{Name: "f", Doc: "bar"}}},
+	},
+	{
+		"# foo\n# bar\n",
+		Doc{Header: "foo\nbar"},
+	},
+	{
+		`case $1 in -h|--help) echo "usage: ${0##*/} [file]"; printf '  %-6s %s\n' -h help; exit ;; esac`,
+		Doc{Usage: "usage: x.sh [file]\n  -h help"},
+	},
+	{
+		"show_help() { echo -e 'a\\tb' $HOME; }",
+		Doc{Usage: "a\tb $HOME", Funcs: []Func{{Name: "show_help"}}},
+	},
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+	for i, tc := range newTests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			f, err := syntax.NewParser(syntax.KeepComments).Parse(strings.NewReader(tc.src), "x.sh")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := New(f)
+			got.Name = ""
+			got.Flags = nil
+			for i := range got.Funcs {
+				got.Funcs[i].Pos = syntax.Pos{}
+			}
+			if !reflect.DeepEqual(*got, tc.want) {
+				t.Fatalf("New mismatch in %q:\nwant: %#v\ngot:  %#v", tc.src, tc.want, *got)
+			}
+		})
+	}
+}
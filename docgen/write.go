@@ -0,0 +1,95 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package docgen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Markdown writes the documentation as a Markdown document.
+func (d *Doc) Markdown(w io.Writer) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# %s\n", d.Name)
+	if d.Header != "" {
+		fmt.Fprintf(&buf, "\n%s\n", d.Header)
+	}
+	if d.Usage != "" {
+		fmt.Fprintf(&buf, "\n## Usage\n\n```\n%s\n```\n", d.Usage)
+	}
+	if len(d.Flags) > 0 {
+		buf.WriteString("\n## Options\n\n")
+		for _, flag := range d.Flags {
+			fmt.Fprintf(&buf, "* `%s`", flag.Name)
+			if flag.Arg {
+				buf.WriteString(" *argument*")
+			}
+			buf.WriteString("\n")
+		}
+	}
+	if len(d.Funcs) > 0 {
+		buf.WriteString("\n## Functions\n")
+		for _, fn := range d.Funcs {
+			fmt.Fprintf(&buf, "\n### %s\n", fn.Name)
+			if fn.Doc != "" {
+				fmt.Fprintf(&buf, "\n%s\n", fn.Doc)
+			}
+		}
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Roff writes the documentation as a manual page in section 1, to be
+// rendered by man.
+func (d *Doc) Roff(w io.Writer) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, ".TH %s 1\n", roffEscape(strings.ToUpper(d.Name)))
+	fmt.Fprintf(&buf, ".SH NAME\n%s\n", roffEscape(d.Name))
+	if d.Usage != "" {
+		fmt.Fprintf(&buf, ".SH SYNOPSIS\n.nf\n%s\n.fi\n", roffText(d.Usage))
+	}
+	if d.Header != "" {
+		fmt.Fprintf(&buf, ".SH DESCRIPTION\n%s\n", roffText(d.Header))
+	}
+	if len(d.Flags) > 0 {
+		buf.WriteString(".SH OPTIONS\n")
+		for _, flag := range d.Flags {
+			fmt.Fprintf(&buf, ".TP\n.B %s", roffEscape(flag.Name))
+			if flag.Arg {
+				buf.WriteString(` \fIargument\fR`)
+			}
+			buf.WriteString("\n")
+		}
+	}
+	if len(d.Funcs) > 0 {
+		buf.WriteString(".SH FUNCTIONS\n")
+		for _, fn := range d.Funcs {
+			fmt.Fprintf(&buf, ".SS %s\n", roffEscape(fn.Name))
+			if fn.Doc != "" {
+				fmt.Fprintf(&buf, "%s\n", roffText(fn.Doc))
+			}
+		}
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+var roffEscaper = strings.NewReplacer(`\`, `\e`, "-", `\-`)
+
+func roffEscape(s string) string { return roffEscaper.Replace(s) }
+
+// roffText escapes multiple lines of text, making sure that none is taken
+// as a request.
+func roffText(s string) string {
+	lines := strings.Split(roffEscape(s), "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+			lines[i] = `\&` + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
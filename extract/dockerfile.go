@@ -0,0 +1,123 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package extract
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// Dockerfile returns the shell programs in the RUN instructions of a
+// Dockerfile, in the order they appear.
+//
+// Line continuations are kept as backslash-newline pairs, which the shell
+// understands too; comment lines within a continued instruction are
+// removed, like Docker does. RUN instructions in exec form, such as
+// RUN ["make", "install"], are not shell programs and are skipped. An
+// escape parser directive is honored.
+func Dockerfile(r io.Reader) ([]*Fragment, error) {
+	bs, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	lines := splitLines(string(bs))
+	escape := byte('\\')
+	var frags []*Fragment
+	directives := true
+	for i := 0; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(trimmed, "#") {
+			if directives {
+				if val, ok := directive(trimmed, "escape"); ok && len(val) == 1 {
+					escape = val[0]
+				}
+			}
+			continue
+		}
+		directives = false
+		if trimmed == "" {
+			continue
+		}
+		start := i
+		// find the end of the instruction
+		for continues(lines[i], escape) && i+1 < len(lines) {
+			i++
+			for i+1 < len(lines) && skippedLine(lines[i]) {
+				i++
+			}
+		}
+		if frag := runFragment(lines, start, i, escape); frag != nil {
+			frags = append(frags, frag)
+		}
+	}
+	return frags, nil
+}
+
+// directive parses a parser directive comment like "# escape=`".
+func directive(comment, name string) (string, bool) {
+	comment = strings.TrimSpace(strings.TrimPrefix(comment, "#"))
+	i := strings.IndexByte(comment, '=')
+	if i < 0 || !strings.EqualFold(strings.TrimSpace(comment[:i]), name) {
+		return "", false
+	}
+	return strings.TrimSpace(comment[i+1:]), true
+}
+
+func continues(line string, escape byte) bool {
+	line = strings.TrimRight(line, " \t")
+	return len(line) > 0 && line[len(line)-1] == escape
+}
+
+// skippedLine reports whether a line within a continued instruction is
+// ignored by Docker.
+func skippedLine(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed == "" || trimmed[0] == '#'
+}
+
+func runFragment(lines []string, start, end int, escape byte) *Fragment {
+	first := lines[start]
+	offs := indentOf(first)
+	rest := first[offs:]
+	if len(rest) < 3 || !strings.EqualFold(rest[:3], "RUN") {
+		return nil
+	}
+	offs += 3
+	if len(first) > offs && first[offs] != ' ' && first[offs] != '\t' &&
+		!continues(first[offs:], escape) {
+		return nil // e.g. RUNNER
+	}
+	// skip whitespace and flags like --mount=type=cache
+	for {
+		offs += indentOf(first[offs:])
+		if !strings.HasPrefix(first[offs:], "--") {
+			break
+		}
+		for offs < len(first) && first[offs] != ' ' && first[offs] != '\t' {
+			offs++
+		}
+	}
+	if strings.HasPrefix(first[offs:], "[") {
+		return nil // exec form
+	}
+	frag := &Fragment{}
+	for i := start; i <= end; i++ {
+		line, col := lines[i], 0
+		if i == start {
+			line, col = line[offs:], offs
+		} else if skippedLine(line) {
+			continue
+		}
+		if continues(line, escape) {
+			// Docker ignores whitespace after the escape character
+			line = strings.TrimRight(line, " \t")
+			if escape != '\\' {
+				line = line[:len(line)-1] + "\\"
+			}
+		}
+		frag.addLine(line, uint(i+1), uint(col))
+	}
+	return frag
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package extract
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+var dockerfileTests = []struct {
+	in   string
+	want []string
+}{
+	{"FROM alpine\nCMD foo", nil},
+	{"RUN foo bar", []string{"foo bar"}},
+	{"run foo\n  RUN\tbar", []string{"foo", "bar"}},
+	{"RUNNER foo", nil},
+	{`RUN ["make", "install"]`, nil},
+	{"RUN --mount=type=cache,target=/x --network=none make", []string{"make"}},
+	{"RUN foo \\\n\tbar", []string{"foo \\\n\tbar"}},
+	{"RUN foo \\\n# comment\n\n  bar\nRUN baz", []string{"foo \\\n  bar", "baz"}},
+	{"RUN foo \\\r\n  bar\r\n", []string{"foo \\\n  bar"}},
+	{"# escape=`\nRUN foo `\n  bar", []string{"foo \\\n  bar"}},
+	{"RUN apt-get update \\  \n  && apt-get install x", []string{"apt-get update \\\n  && apt-get install x"}},
+	{"# escape=`\nRUN foo `\t \n  && bar", []string{"foo \\\n  && bar"}},
+	{"FROM x\n# escape=`\nRUN foo `", []string{"foo `"}},
+}
+
+func TestDockerfile(t *testing.T) {
+	t.Parallel()
+	for i, tc := range dockerfileTests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			frags, err := Dockerfile(strings.NewReader(tc.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, frag := range frags {
+				got = append(got, frag.Src)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("Dockerfile mismatch in %q:\nwant: %q\ngot:  %q",
+					tc.in, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestDockerfileSpaceAfterEscape(t *testing.T) {
+	t.Parallel()
+	in := "FROM debian\nRUN apt-get update \\  \n  && apt-get install x\n"
+	frags, err := Dockerfile(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frags) != 1 {
+		t.Fatalf("want 1 fragment, got %d", len(frags))
+	}
+	if _, err := syntax.NewParser().Parse(strings.NewReader(frags[0].Src), ""); err != nil {
+		t.Fatalf("fragment %q does not parse: %v", frags[0].Src, err)
+	}
+}
+
+func TestDockerfilePositions(t *testing.T) {
+	t.Parallel()
+	in := "FROM alpine\nRUN echo foo && \\\n    # install\n    apk add $(bar\n"
+	frags, err := Dockerfile(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frags) != 1 {
+		t.Fatalf("want 1 fragment, got %d", len(frags))
+	}
+	frag := frags[0]
+	if got := frag.Line(); got != 2 {
+		t.Fatalf("want fragment at line 2, got %d", got)
+	}
+	f, err := frag.Parse(syntax.NewParser(), "Dockerfile")
+	if f != nil {
+		t.Fatalf("expected a parse error")
+	}
+	want := "Dockerfile:4:13: reached EOF without matching ( with )"
+	if err == nil || err.Error() != want {
+		t.Fatalf("want error %q, got %v", want, err)
+	}
+
+	frag.Src = strings.Replace(frag.Src, "$(bar", "bar", 1)
+	f, err = frag.Parse(syntax.NewParser(), "Dockerfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin := f.Stmts[0].Cmd.(*syntax.BinaryCmd)
+	call := bin.Y.Cmd.(*syntax.CallExpr)
+	for _, pos := range []struct {
+		node      syntax.Node
+		line, col uint
+	}{
+		{bin.X, 2, 5},
+		{call.Args[2], 4, 13},
+	} {
+		line, col := frag.HostPos(pos.node.Pos())
+		if line != pos.line || col != pos.col {
+			t.Errorf("want %d:%d, got %d:%d", pos.line, pos.col, line, col)
+		}
+	}
+}
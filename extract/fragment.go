@@ -0,0 +1,138 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+// Package extract finds shell programs embedded in other file formats,
+// such as Dockerfile RUN instructions, Makefile recipes or YAML CI
+// configuration files, so that they can be parsed and checked with
+// positions that refer to the host file.
+//
+// This package is a work in progress and EXPERIMENTAL; its API is not
+// subject to the 1.x backwards compatibility guarantee.
+package extract
+
+import (
+	"fmt"
+	"strings"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// Fragment is a shell program found within a host file.
+type Fragment struct {
+	// Src is the shell source code, with any syntax belonging to the
+	// host file format removed.
+	Src string
+
+	// lines holds, for each line in Src, where it starts in the host
+	// file.
+	lines []hostLine
+}
+
+type hostLine struct {
+	line uint // 1-based line in the host file
+	col  uint // bytes preceding the fragment's line in the host line
+
+	// drops holds the offsets within the fragment's line at which a
+	// byte from the host line was removed, in increasing order.
+	drops []uint
+}
+
+func (f *Fragment) addLine(s string, line, col uint) {
+	f.addDropLine(s, line, col, nil)
+}
+
+func (f *Fragment) addDropLine(s string, line, col uint, drops []uint) {
+	if len(f.lines) > 0 {
+		f.Src += "\n"
+	}
+	f.Src += s
+	f.lines = append(f.lines, hostLine{line: line, col: col, drops: drops})
+}
+
+// Line returns the line in the host file where the fragment starts.
+func (f *Fragment) Line() uint {
+	if len(f.lines) == 0 {
+		return 0
+	}
+	return f.lines[0].line
+}
+
+// HostPos maps a position within Src, such as one from a node obtained
+// by parsing the fragment, to a line and column in the host file.
+func (f *Fragment) HostPos(pos syntax.Pos) (line, col uint) {
+	if !pos.IsValid() || len(f.lines) == 0 {
+		return 0, 0
+	}
+	i := int(pos.Line()) - 1
+	if i >= len(f.lines) {
+		i = len(f.lines) - 1
+	}
+	hl := f.lines[i]
+	col = hl.col + pos.Col()
+	for _, d := range hl.drops {
+		if d >= pos.Col() {
+			break
+		}
+		col++
+	}
+	return hl.line, col
+}
+
+// Parse parses the fragment with the given parser. Parse errors are
+// returned as *Error, with positions in the host file.
+func (f *Fragment) Parse(p *syntax.Parser, name string) (*syntax.File, error) {
+	file, err := p.Parse(strings.NewReader(f.Src), name)
+	if err != nil {
+		return nil, f.hostErr(name, err)
+	}
+	return file, nil
+}
+
+func (f *Fragment) hostErr(name string, err error) error {
+	var pos syntax.Pos
+	var text string
+	switch x := err.(type) {
+	case syntax.ParseError:
+		pos, text = x.Pos, x.Text
+	case syntax.LangError:
+		pos = x.Pos
+		x.Filename = ""
+		text = strings.TrimPrefix(x.Error(), x.Pos.String()+": ")
+	default:
+		return err
+	}
+	line, col := f.HostPos(pos)
+	return &Error{Filename: name, Line: line, Col: col, Text: text}
+}
+
+// Error is an error found in a fragment, positioned in its host file.
+type Error struct {
+	Filename  string
+	Line, Col uint
+	Text      string
+}
+
+func (e *Error) Error() string {
+	if e.Filename == "" {
+		return fmt.Sprintf("%d:%d: %s", e.Line, e.Col, e.Text)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", e.Filename, e.Line, e.Col, e.Text)
+}
+
+// splitLines splits src into lines, dropping carriage returns that
+// precede newlines.
+func splitLines(src string) []string {
+	lines := strings.Split(src, "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return lines
+}
+
+// indentOf returns the number of leading spaces and tabs in s.
+func indentOf(s string) int {
+	return len(s) - len(strings.TrimLeft(s, " \t"))
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package extract
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// Makefile returns the shell programs in the recipes of a Makefile, in the
+// order they appear. Like make, each recipe line is a separate program,
+// including any continuation lines ending in a backslash. Recipes given
+// after a semicolon on the rule line are included too.
+//
+// The recipe prefix, a tab unless the .RECIPEPREFIX variable is set, is
+// removed, as are the @, - and + prefixes at the start of each recipe
+// line. Escaped dollar signs, $$, are replaced by a single $. Other make
+// variable references, such as $(CC) or $@, are kept as they are, so
+// the former will appear as command substitutions.
+func Makefile(r io.Reader) ([]*Fragment, error) {
+	bs, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	lines := splitLines(string(bs))
+	prefix := byte('\t')
+	var frags []*Fragment
+	inRule, inDefine := false, false
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if inDefine {
+			if firstWord(line) == "endef" {
+				inDefine = false
+			}
+			continue
+		}
+		start := i
+		for makeContinues(lines[i]) && i+1 < len(lines) {
+			i++
+		}
+		if len(line) > 0 && line[0] == prefix {
+			if inRule {
+				frags = appendRecipe(frags, lines[start:i+1], start, 1, prefix)
+			}
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed[0] == '#' {
+			continue // blank lines and comments don't end a rule
+		}
+		switch firstWord(line) {
+		case "define":
+			inDefine, inRule = true, false
+			continue
+		case "ifeq", "ifneq", "ifdef", "ifndef", "else", "endif":
+			continue // conditionals may appear within recipes
+		}
+		// join continued lines to find the rule's colon
+		logical := strings.Join(lines[start:i+1], "\n")
+		if val, ok := makeAssign(logical, ".RECIPEPREFIX"); ok {
+			prefix = '\t'
+			if val != "" {
+				prefix = val[0]
+			}
+		}
+		colon := ruleColon(logical)
+		inRule = colon >= 0
+		if !inRule {
+			continue
+		}
+		semi := strings.IndexByte(logical[colon:], ';')
+		if semi < 0 {
+			continue // no recipe on the rule line
+		}
+		// find the physical line where the recipe starts
+		first, offs := start, colon+semi+1
+		for offs > len(lines[first]) {
+			offs -= len(lines[first]) + 1
+			first++
+		}
+		frags = appendRecipe(frags, lines[first:i+1], first, offs, prefix)
+	}
+	return frags, nil
+}
+
+// makeContinues reports whether a line ends with an odd number of
+// backslashes, continuing into the next line.
+func makeContinues(line string) bool {
+	n := len(line) - len(strings.TrimRight(line, "\\"))
+	return n%2 == 1
+}
+
+func firstWord(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// makeAssign parses a variable assignment like "NAME := value".
+func makeAssign(line, name string) (string, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, name) {
+		return "", false
+	}
+	rest := strings.TrimSpace(line[len(name):])
+	for _, op := range [...]string{"=", ":=", "::=", "?="} {
+		if strings.HasPrefix(rest, op) {
+			return strings.TrimSpace(rest[len(op):]), true
+		}
+	}
+	return "", false
+}
+
+// ruleColon returns the offset of the colon separating a rule's targets
+// from its prerequisites, or -1 if the line isn't a rule. Colons within
+// variable references don't count, and neither do variable assignments,
+// including target-specific ones like "foo: CFLAGS += -g".
+func ruleColon(line string) int {
+	colon := -1
+	depth := 0
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '(' || c == '{':
+			depth++
+		case (c == ')' || c == '}') && depth > 0:
+			depth--
+		case depth > 0:
+		case c == '=':
+			return -1 // an assignment, either before or after the colon
+		case c == ';' && colon >= 0:
+			return colon // the recipe may contain anything
+		case c == '#':
+			return colon
+		case c == ':' && colon < 0:
+			colon = i
+			if strings.HasPrefix(line[i:], ":=") || strings.HasPrefix(line[i:], "::=") {
+				return -1
+			}
+			if i+1 < len(line) && line[i+1] == ':' {
+				i++ // a double-colon rule
+			}
+		}
+	}
+	return colon
+}
+
+// appendRecipe adds the fragment for a recipe line and its continuation
+// lines, which starts at the given offset of its first line. Empty
+// recipes are skipped.
+func appendRecipe(frags []*Fragment, lines []string, start, offs int, prefix byte) []*Fragment {
+	frag := &Fragment{}
+	for i, line := range lines {
+		col := 0
+		if i == 0 {
+			col = offs
+			col += len(line[col:]) - len(strings.TrimLeft(line[col:], "@-+ \t"))
+		} else if len(line) > 0 && line[0] == prefix {
+			col = 1
+		}
+		s, drops := unescapeDollars(line[col:])
+		frag.addDropLine(s, uint(start+i+1), uint(col), drops)
+	}
+	if strings.TrimSpace(frag.Src) == "" {
+		return frags
+	}
+	return append(frags, frag)
+}
+
+// unescapeDollars replaces each $$ with $, returning the offsets in the
+// result at which a byte was removed.
+func unescapeDollars(s string) (string, []uint) {
+	if !strings.Contains(s, "$$") {
+		return s, nil
+	}
+	var buf []byte
+	var drops []uint
+	for i := 0; i < len(s); i++ {
+		buf = append(buf, s[i])
+		if s[i] == '$' && i+1 < len(s) && s[i+1] == '$' {
+			i++
+			drops = append(drops, uint(len(buf)))
+		}
+	}
+	return string(buf), drops
+}
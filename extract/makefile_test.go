@@ -0,0 +1,114 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package extract
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+var makefileTests = []struct {
+	in   string
+	want []string
+}{
+	{"CC = gcc\nall:\n", nil},
+	{"all:\n\techo foo\n\t@echo bar", []string{"echo foo", "echo bar"}},
+	{"all: dep\n\t-@ rm -f x\n\t+make -C sub", []string{"rm -f x", "make -C sub"}},
+	{"all:\n\techo $$HOME $(CC) $@", []string{"echo $HOME $(CC) $@"}},
+	{"all:\n\tfor i in a b; do \\\n\t\techo $$i; \\\n\tdone", []string{
+		"for i in a b; do \\\n\techo $i; \\\ndone",
+	}},
+	{"all:\n\tfoo\n\n# comment\n\tbar\nX = y\n\tbaz", []string{"foo", "bar"}},
+	{"all: ; echo inline\n\tmore", []string{"echo inline", "more"}},
+	{"%.o: %.c\n\t$(CC) -c $<", []string{"$(CC) -c $<"}},
+	{"a b:: c\n\tfoo", []string{"foo"}},
+	{"X := a:b\n\tfoo\nfoo: CFLAGS += -g\n\tbar", nil},
+	{"$(OBJ): $(SRC:.c=.h)\n\tfoo", []string{"foo"}},
+	{"define X\nall:\n\tfoo\nendef\nall:\n\tbar", []string{"bar"}},
+	{"all:\nifeq ($(X),y)\n\tfoo\nelse\n\tbar\nendif", []string{"foo", "bar"}},
+	{".RECIPEPREFIX = >\nall:\n> foo\n\tbar", []string{"foo"}},
+	{"all:\n\t\n\t@", nil},
+	{"all:\r\n\tfoo\r\n", []string{"foo"}},
+	{"\tfoo\nall: x \\\n  y\n\tbar", []string{"bar"}},
+	{"foo \\\nbar: baz\n\techo hi\n", []string{"echo hi"}},
+	{"foo \\\nbar: baz; echo \\\n\thi", []string{"echo \\\nhi"}},
+}
+
+func TestMakefile(t *testing.T) {
+	t.Parallel()
+	for i, tc := range makefileTests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			frags, err := Makefile(strings.NewReader(tc.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, frag := range frags {
+				got = append(got, frag.Src)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("Makefile mismatch in %q:\nwant: %q\ngot:  %q",
+					tc.in, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestMakefilePositions(t *testing.T) {
+	t.Parallel()
+	in := "all:\n\t@echo $$a $$b \\\n\t  $$c $(\n"
+	frags, err := Makefile(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frags) != 1 {
+		t.Fatalf("want 1 fragment, got %d", len(frags))
+	}
+	frag := frags[0]
+	if got := frag.Line(); got != 2 {
+		t.Fatalf("want fragment at line 2, got %d", got)
+	}
+	_, err = frag.Parse(syntax.NewParser(), "Makefile")
+	want := "Makefile:3:8: reached EOF without matching ( with )"
+	if err == nil || err.Error() != want {
+		t.Fatalf("want error %q, got %v", want, err)
+	}
+
+	frag.Src = strings.Replace(frag.Src, "$(", "", 1)
+	f, err := frag.Parse(syntax.NewParser(), "Makefile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := f.Stmts[0].Cmd.(*syntax.CallExpr)
+	for _, pos := range []struct {
+		node      syntax.Node
+		line, col uint
+	}{
+		{call.Args[0], 2, 3},
+		{call.Args[1], 2, 8},
+		{call.Args[2], 2, 12},
+		{call.Args[3], 3, 4},
+	} {
+		line, col := frag.HostPos(pos.node.Pos())
+		if line != pos.line || col != pos.col {
+			t.Errorf("want %d:%d, got %d:%d", pos.line, pos.col, line, col)
+		}
+	}
+
+	// a recipe on a rule line that is itself a continuation
+	frags, err = Makefile(strings.NewReader("foo \\\nbar: ; echo hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frags) != 1 {
+		t.Fatalf("want 1 fragment, got %d", len(frags))
+	}
+	if line, col := frags[0].HostPos(syntax.NewPos(0, 1, 1)); line != 2 || col != 8 {
+		t.Errorf("want 2:8, got %d:%d", line, col)
+	}
+}
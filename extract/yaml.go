@@ -0,0 +1,201 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package extract
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// DefaultYAMLKeys are the mapping keys whose values are treated as shell
+// programs by YAML if no keys are given. They cover GitHub Actions and
+// GitLab CI.
+var DefaultYAMLKeys = []string{"run", "script", "before_script", "after_script"}
+
+// YAML returns the shell programs found as the values of the given
+// mapping keys in a YAML document, in the order they appear. If no keys
+// are given, DefaultYAMLKeys is used.
+//
+// A value may be a scalar, or a sequence of scalars in which case each
+// element is a separate fragment. Plain, quoted and literal block scalars
+// (those starting with "|") are supported. Folded block scalars are
+// skipped, as folding would join the lines of the program.
+//
+// This is not a full YAML parser; it only understands the block
+// structure common in CI configuration files. Columns within quoted
+// scalars containing escape sequences may be slightly off.
+func YAML(r io.Reader, keys ...string) ([]*Fragment, error) {
+	bs, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		keys = DefaultYAMLKeys
+	}
+	ys := yamlScanner{lines: splitLines(string(bs)), keys: keys}
+	ys.scan()
+	return ys.frags, nil
+}
+
+type yamlScanner struct {
+	lines []string
+	keys  []string
+	frags []*Fragment
+}
+
+func (ys *yamlScanner) scan() {
+	for i := 0; i < len(ys.lines); i++ {
+		line := ys.lines[i]
+		keyCol := indentOf(line)
+		rest := line[keyCol:]
+		if strings.HasPrefix(rest, "- ") {
+			// "- run: foo" within a sequence of mappings
+			keyCol += 2
+			keyCol += indentOf(line[keyCol:])
+			rest = line[keyCol:]
+		}
+		valCol, ok := ys.matchKey(rest)
+		if !ok {
+			continue
+		}
+		valCol += keyCol
+		valCol += indentOf(line[valCol:])
+		switch val := line[valCol:]; {
+		case val == "" || val[0] == '#':
+			i = ys.sequence(i+1, keyCol)
+		case val[0] == '|':
+			i = ys.block(i+1, keyCol)
+		case val[0] == '>':
+			i = ys.blockEnd(i+1, keyCol) - 1
+		default:
+			ys.scalar(i, valCol)
+		}
+	}
+}
+
+// matchKey reports whether s starts with one of the keys followed by a
+// colon, and returns the offset just after the colon.
+func (ys *yamlScanner) matchKey(s string) (int, bool) {
+	for _, key := range ys.keys {
+		for _, quoted := range [...]string{key, `"` + key + `"`, "'" + key + "'"} {
+			if !strings.HasPrefix(s, quoted+":") {
+				continue
+			}
+			n := len(quoted) + 1
+			if n == len(s) || s[n] == ' ' || s[n] == '\t' {
+				return n, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// sequence handles a sequence of scalars starting at line i, as the value
+// of a key at column keyCol. It returns the last line it consumed.
+func (ys *yamlScanner) sequence(i, keyCol int) int {
+	last := i - 1
+	for ; i < len(ys.lines); i++ {
+		line := ys.lines[i]
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed[0] == '#' {
+			continue
+		}
+		itemCol := indentOf(line)
+		if itemCol < keyCol || !strings.HasPrefix(line[itemCol:], "-") {
+			break
+		}
+		valCol := itemCol + 1
+		if valCol < len(line) && line[valCol] != ' ' && line[valCol] != '\t' {
+			break // not a sequence item, e.g. "--foo"
+		}
+		valCol += indentOf(line[valCol:])
+		switch val := line[valCol:]; {
+		case val == "" || val[0] == '#':
+		case val[0] == '|':
+			i = ys.block(i+1, itemCol)
+		case val[0] == '>':
+			// skip its indented lines
+			i = ys.blockEnd(i+1, itemCol) - 1
+		default:
+			ys.scalar(i, valCol)
+		}
+		last = i
+	}
+	return last
+}
+
+// blockEnd returns the first line from i onwards which is not part of a
+// block more indented than parentCol.
+func (ys *yamlScanner) blockEnd(i, parentCol int) int {
+	for ; i < len(ys.lines); i++ {
+		line := ys.lines[i]
+		if strings.TrimSpace(line) != "" && indentOf(line) <= parentCol {
+			break
+		}
+	}
+	return i
+}
+
+// block handles a literal block scalar whose content starts at line i,
+// belonging to a key or sequence item at column parentCol. It returns the
+// last line it consumed.
+func (ys *yamlScanner) block(i, parentCol int) int {
+	end := ys.blockEnd(i, parentCol)
+	contentCol := -1
+	for j := i; j < end; j++ {
+		if strings.TrimSpace(ys.lines[j]) != "" {
+			contentCol = indentOf(ys.lines[j])
+			break
+		}
+	}
+	if contentCol < 0 {
+		return end - 1
+	}
+	// trailing empty lines are not part of the program
+	for end > i && strings.TrimSpace(ys.lines[end-1]) == "" {
+		end--
+	}
+	frag := &Fragment{}
+	for j := i; j < end; j++ {
+		line := ys.lines[j]
+		if len(line) < contentCol {
+			line = ""
+		} else {
+			line = line[contentCol:]
+		}
+		frag.addLine(line, uint(j+1), uint(contentCol))
+	}
+	ys.frags = append(ys.frags, frag)
+	return end - 1
+}
+
+// scalar handles a single-line flow scalar starting at the given column.
+func (ys *yamlScanner) scalar(i, col int) {
+	val := ys.lines[i][col:]
+	switch val[0] {
+	case '\'':
+		end := strings.LastIndexByte(val, '\'')
+		if end <= 0 {
+			return
+		}
+		val = strings.Replace(val[1:end], "''", "'", -1)
+		col++
+	case '"':
+		end := strings.LastIndexByte(val, '"')
+		if end <= 0 {
+			return
+		}
+		val = strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(val[1:end])
+		col++
+	default:
+		if j := strings.Index(val, " #"); j >= 0 {
+			val = val[:j]
+		}
+		val = strings.TrimRight(val, " \t")
+	}
+	frag := &Fragment{}
+	frag.addLine(val, uint(i+1), uint(col))
+	ys.frags = append(ys.frags, frag)
+}
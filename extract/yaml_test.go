@@ -0,0 +1,91 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package extract
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+type hostFrag struct {
+	src       string
+	line, col uint
+}
+
+var yamlTests = []struct {
+	in   string
+	keys []string
+	want []hostFrag
+}{
+	{"name: foo\nruns-on: bar", nil, nil},
+	{"run: make test", nil, []hostFrag{{"make test", 1, 6}}},
+	{"    run: make test # comment", nil, []hostFrag{{"make test", 1, 10}}},
+	{"- run: 'echo ''a'''", nil, []hostFrag{{"echo 'a'", 1, 9}}},
+	{`run: "echo \"a\""`, nil, []hostFrag{{`echo "a"`, 1, 7}}},
+	{"steps:\n  - name: x\n    run: |\n      foo\n\n      bar\n\n  - run: baz",
+		nil, []hostFrag{
+			{"foo\n\nbar", 4, 7},
+			{"baz", 8, 10},
+		}},
+	{"run: |-\n  if x; then\n    y\n  fi\nother: z", nil, []hostFrag{
+		{"if x; then\n  y\nfi", 2, 3},
+	}},
+	{"run: >\n  folded\n  run: no", nil, nil},
+	{"job:\n  script:\n    - foo\n    # comment\n    - |\n      bar\n      baz\n    - qux\n  after_script:\n  - last",
+		nil, []hostFrag{
+			{"foo", 3, 7},
+			{"bar\nbaz", 6, 7},
+			{"qux", 8, 7},
+			{"last", 10, 5},
+		}},
+	{"build: make\nrun: foo", []string{"build"}, []hostFrag{{"make", 1, 8}}},
+	{"running: foo\nrun:bar", nil, nil},
+}
+
+func TestYAML(t *testing.T) {
+	t.Parallel()
+	for i, tc := range yamlTests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			frags, err := YAML(strings.NewReader(tc.in), tc.keys...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []hostFrag
+			for _, frag := range frags {
+				// the position of the first byte in the fragment
+				f, err := frag.Parse(syntax.NewParser(), "")
+				if err != nil {
+					t.Fatal(err)
+				}
+				line, col := frag.HostPos(f.Stmts[0].Pos())
+				got = append(got, hostFrag{frag.Src, line, col})
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("YAML mismatch in %q:\nwant: %v\ngot:  %v",
+					tc.in, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestYAMLError(t *testing.T) {
+	t.Parallel()
+	in := "jobs:\n  test:\n    steps:\n      - run: |\n          echo ok\n          for\n"
+	frags, err := YAML(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frags) != 1 {
+		t.Fatalf("want 1 fragment, got %d", len(frags))
+	}
+	_, err = frags[0].Parse(syntax.NewParser(), "ci.yml")
+	want := `ci.yml:6:11: "for" must be followed by a literal`
+	if err == nil || err.Error() != want {
+		t.Fatalf("want error %q, got %v", want, err)
+	}
+}
@@ -6,6 +6,8 @@
 package fileutil
 
 import (
+	"bytes"
+	"errors"
 	"os"
 	"regexp"
 	"strings"
@@ -53,3 +55,29 @@ func CouldBeScript(info os.FileInfo) ScriptConfidence {
 		return ConfIfShebang
 	}
 }
+
+// ErrBinaryFile is returned by CheckBinary for content that cannot be a
+// shell script, such as a compiled program.
+var ErrBinaryFile = errors.New("binary file")
+
+// maxLineLen is the length of the longest line that CheckBinary accepts.
+const maxLineLen = 64 << 10
+
+// CheckBinary returns ErrBinaryFile if bs looks like the contents of a
+// binary file instead of text, as it contains a NUL byte or lines longer
+// than 64KiB. This lets tools that walk directories quickly skip the files
+// which merely have a shell extension or a shebang-like prefix, such as
+// self-extracting archives, before parsing them.
+func CheckBinary(bs []byte) error {
+	if bytes.IndexByte(bs, 0) >= 0 {
+		return ErrBinaryFile
+	}
+	for len(bs) > maxLineLen {
+		i := bytes.IndexByte(bs, '\n')
+		if i < 0 || i > maxLineLen {
+			return ErrBinaryFile
+		}
+		bs = bs[i+1:]
+	}
+	return nil
+}
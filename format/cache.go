@@ -0,0 +1,148 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package format
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"mvdan.cc/sh/shproto"
+	"mvdan.cc/sh/syntax"
+)
+
+// Storage is where a Cache keeps its entries. It must be safe for
+// concurrent use.
+type Storage interface {
+	// Get returns the value stored for key, if any.
+	Get(key string) ([]byte, bool)
+	// Put stores a value for key. Errors are ignored, as the cache is
+	// only an optimization.
+	Put(key string, value []byte)
+}
+
+// MemStorage returns a Storage that keeps all entries in memory, such as
+// for a long-running language server.
+func MemStorage() Storage {
+	return &memStorage{m: make(map[string][]byte)}
+}
+
+type memStorage struct {
+	mu sync.RWMutex
+	m  map[string][]byte
+}
+
+func (s *memStorage) Get(key string) ([]byte, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	val, ok := s.m[key]
+	return val, ok
+}
+
+func (s *memStorage) Put(key string, value []byte) {
+	s.mu.Lock()
+	s.m[key] = value
+	s.mu.Unlock()
+}
+
+// DirStorage returns a Storage that keeps each entry as a file in dir, so
+// that it can be shared between processes, such as successive CI runs.
+// The directory is created if it doesn't exist.
+func DirStorage(dir string) Storage {
+	return dirStorage(dir)
+}
+
+type dirStorage string
+
+func (s dirStorage) Get(key string) ([]byte, bool) {
+	val, err := ioutil.ReadFile(filepath.Join(string(s), key))
+	return val, err == nil
+}
+
+func (s dirStorage) Put(key string, value []byte) {
+	if err := os.MkdirAll(string(s), 0777); err != nil {
+		return
+	}
+	// write to a temporary file first, so that concurrent readers never
+	// see a partial entry
+	f, err := ioutil.TempFile(string(s), "tmp-")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(value)
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(string(s), key))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
+
+// cacheVersion is part of every key, so that it can be bumped whenever
+// the parser or printer change their output.
+const cacheVersion = "1"
+
+// Cache memoizes the results of parsing and formatting by the hash of the
+// source, so that unchanged files are not processed again. Only successful
+// results are cached.
+type Cache struct {
+	Storage Storage
+
+	// Options identifies the parser and printer options in use, such as
+	// "-i 4 -ln posix", since they cannot be compared directly. Results
+	// obtained with different options must use different strings.
+	Options string
+}
+
+func (c *Cache) key(kind string, src []byte) string {
+	h := sha256.New()
+	for _, s := range [...]string{cacheVersion, kind, c.Options} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	h.Write(src)
+	return kind + "-" + hex.EncodeToString(h.Sum(nil))
+}
+
+// Parse is like parser.Parse, but returns the cached syntax tree if src
+// was parsed before.
+func (c *Cache) Parse(parser *syntax.Parser, src []byte, name string) (*syntax.File, error) {
+	key := c.key("parse", src)
+	if data, ok := c.Storage.Get(key); ok {
+		if f, err := shproto.Unmarshal(data); err == nil {
+			f.Name = name
+			return f, nil
+		}
+	}
+	f, err := parser.Parse(bytes.NewReader(src), name)
+	if err != nil {
+		return nil, err
+	}
+	if data, err := shproto.Marshal(f); err == nil {
+		c.Storage.Put(key, data)
+	}
+	return f, nil
+}
+
+// Format returns the cached result of formatting src, or calls format and
+// caches its result.
+func (c *Cache) Format(src []byte, format func([]byte) ([]byte, error)) ([]byte, error) {
+	key := c.key("format", src)
+	if out, ok := c.Storage.Get(key); ok {
+		return out, nil
+	}
+	out, err := format(src)
+	if err != nil {
+		return nil, err
+	}
+	c.Storage.Put(key, out)
+	return out, nil
+}
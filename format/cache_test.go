@@ -0,0 +1,129 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package format
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// countStorage counts the hits and misses of a Storage.
+type countStorage struct {
+	Storage
+
+	mu           sync.Mutex
+	hits, misses int
+}
+
+func (s *countStorage) Get(key string) ([]byte, bool) {
+	val, ok := s.Storage.Get(key)
+	s.mu.Lock()
+	if ok {
+		s.hits++
+	} else {
+		s.misses++
+	}
+	s.mu.Unlock()
+	return val, ok
+}
+
+func TestCacheFormatFiles(t *testing.T) {
+	t.Parallel()
+	fsys := &mapFS{files: map[string]string{
+		"a.sh": "foo  bar",
+		"b.sh": "foo  bar",
+		"c.sh": "foo\n",
+		"d.sh": "foo(",
+	}}
+	paths := []string{"a.sh", "b.sh", "c.sh", "d.sh"}
+	storage := &countStorage{Storage: MemStorage()}
+	cfg := Config{Workers: 1, Cache: &Cache{Storage: storage}}
+	want := map[string]Status{"a.sh": Changed, "b.sh": Changed, "c.sh": Unchanged, "d.sh": Failed}
+	for i := 0; i < 2; i++ {
+		got := make(map[string]Status)
+		for path, res := range collect(FormatFiles(context.Background(), fsys, paths, cfg)) {
+			got[path] = res.Status
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("statuses mismatch:\nwant: %v\ngot:  %v", want, got)
+		}
+	}
+	// the first run only hits b.sh, as a.sh has the same contents; the
+	// failed d.sh is never cached
+	if storage.hits != 4 || storage.misses != 4 {
+		t.Fatalf("want 4 hits and 4 misses, got %d and %d", storage.hits, storage.misses)
+	}
+}
+
+func TestCacheOptions(t *testing.T) {
+	t.Parallel()
+	storage := MemStorage()
+	c1 := &Cache{Storage: storage, Options: "-i 0"}
+	c2 := &Cache{Storage: storage, Options: "-i 4"}
+	format := func(out string) func([]byte) ([]byte, error) {
+		return func([]byte) ([]byte, error) { return []byte(out), nil }
+	}
+	for _, tc := range []struct {
+		c         *Cache
+		out, want string
+	}{
+		{c1, "one", "one"},
+		{c2, "two", "two"},
+		{c1, "three", "one"},
+	} {
+		got, err := tc.c.Format([]byte("src"), format(tc.out))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tc.want {
+			t.Fatalf("want %q, got %q", tc.want, got)
+		}
+	}
+}
+
+func TestCacheParse(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "sh-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := []byte("foo bar | baz # c\n")
+	parser := syntax.NewParser(syntax.KeepComments)
+	want, err := parser.Parse(bytes.NewReader(src), "a.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a separate Cache and Storage, like a new process would use
+	for i := 0; i < 2; i++ {
+		c := &Cache{Storage: DirStorage(dir)}
+		got, err := c.Parse(parser, src, "b.sh")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Name != "b.sh" {
+			t.Fatalf("want name b.sh, got %q", got.Name)
+		}
+		if i == 1 && !reflect.DeepEqual(got.Stmts[0], want.Stmts[0]) {
+			t.Fatalf("cached syntax tree mismatch")
+		}
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("want 1 cache entry, got %d", len(entries))
+	}
+	if _, err := (&Cache{Storage: DirStorage(dir)}).Parse(parser, []byte("foo("), ""); err == nil {
+		t.Fatalf("expected a parse error")
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+// Package format formats many shell files at once, such as all the
+// scripts in a repository, like shfmt does.
+//
+// This package is a work in progress and EXPERIMENTAL; its API is not
+// subject to the 1.x backwards compatibility guarantee.
+package format
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"sync"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// FS is the file system that files are read from and written to.
+type FS interface {
+	ReadFile(path string) ([]byte, error)
+	// WriteFile replaces the contents of an existing file.
+	WriteFile(path string, data []byte) error
+}
+
+// OSFS is the operating system's file system.
+var OSFS FS = osFS{}
+
+type osFS struct{}
+
+func (osFS) ReadFile(path string) ([]byte, error) { return ioutil.ReadFile(path) }
+
+func (osFS) WriteFile(path string, data []byte) error {
+	// keep the existing file's permissions
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Config holds the options used to format files.
+type Config struct {
+	// Parser and Printer hold the options for the parser and printer
+	// used for each file, such as syntax.Variant(syntax.LangPOSIX) or
+	// syntax.Indent(4).
+	Parser  []func(*syntax.Parser)
+	Printer []func(*syntax.Printer)
+
+	// Simplify applies syntax.Simplify to each program before printing.
+	Simplify bool
+
+	// Write makes the formatted files replace the original ones when
+	// they differ.
+	Write bool
+
+	// Workers is the number of files to format in parallel. If zero,
+	// runtime.GOMAXPROCS(0) is used.
+	Workers int
+
+	// Cache, if not nil, is used to skip formatting files whose contents
+	// were already formatted before. Its Options must identify the
+	// Parser, Printer and Simplify options above.
+	Cache *Cache
+}
+
+// Status is the outcome of formatting a file.
+type Status int
+
+const (
+	Unchanged Status = iota // the file was already formatted
+	Changed                 // formatting the file changed it
+	Failed                  // the file could not be read, parsed or written
+)
+
+func (s Status) String() string {
+	switch s {
+	case Unchanged:
+		return "unchanged"
+	case Changed:
+		return "changed"
+	default:
+		return "failed"
+	}
+}
+
+// Result is the result of formatting a single file.
+type Result struct {
+	Path   string
+	Status Status
+
+	// Src and Formatted hold the original and the formatted source. If
+	// the file could not be read or parsed, Formatted is nil.
+	Src, Formatted []byte
+
+	// Err holds the error if Status is Failed.
+	Err error
+}
+
+// formatter formats files reusing a single output buffer, so it must not
+// be used concurrently.
+type formatter struct {
+	cfg     *Config
+	parser  *syntax.Parser
+	printer *syntax.Printer
+	buf     bytes.Buffer
+}
+
+func newFormatter(cfg *Config) *formatter {
+	return &formatter{
+		cfg:     cfg,
+		parser:  syntax.NewParser(append([]func(*syntax.Parser){syntax.KeepComments}, cfg.Parser...)...),
+		printer: syntax.NewPrinter(cfg.Printer...),
+	}
+}
+
+// format returns the formatted version of src.
+func (f *formatter) format(src []byte, path string) ([]byte, error) {
+	if f.cfg.Cache != nil {
+		return f.cfg.Cache.Format(src, func(src []byte) ([]byte, error) {
+			return f.formatNoCache(src, path)
+		})
+	}
+	return f.formatNoCache(src, path)
+}
+
+func (f *formatter) formatNoCache(src []byte, path string) ([]byte, error) {
+	prog, err := f.parser.Parse(bytes.NewReader(src), path)
+	if err != nil {
+		return nil, err
+	}
+	if f.cfg.Simplify {
+		syntax.Simplify(prog)
+	}
+	f.buf.Reset()
+	if err := f.printer.Print(&f.buf, prog); err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), f.buf.Bytes()...), nil
+}
+
+func (f *formatter) file(fsys FS, path string) Result {
+	res := Result{Path: path, Status: Failed}
+	if res.Src, res.Err = fsys.ReadFile(path); res.Err != nil {
+		return res
+	}
+	if res.Formatted, res.Err = f.format(res.Src, path); res.Err != nil {
+		return res
+	}
+	res.Status = Unchanged
+	if bytes.Equal(res.Src, res.Formatted) {
+		return res
+	}
+	res.Status = Changed
+	if f.cfg.Write {
+		if res.Err = fsys.WriteFile(path, res.Formatted); res.Err != nil {
+			res.Status = Failed
+		}
+	}
+	return res
+}
+
+// FormatFiles formats the files at the given paths in parallel, sending
+// one result for each file on the returned channel as soon as it is
+// ready. The results may thus be in any order. The channel is closed once
+// all files have been formatted.
+//
+// If ctx is cancelled, no more files are started, and the remaining paths
+// are not reported.
+func FormatFiles(ctx context.Context, fsys FS, paths []string, cfg Config) <-chan Result {
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(paths) {
+		workers = len(paths)
+	}
+	jobs := make(chan string)
+	results := make(chan Result)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f := newFormatter(&cfg)
+			for path := range jobs {
+				select {
+				case results <- f.file(fsys, path):
+				case <-ctx.Done():
+				}
+			}
+		}()
+	}
+	go func() {
+	loop:
+		for _, path := range paths {
+			select {
+			case jobs <- path:
+			case <-ctx.Done():
+				break loop
+			}
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package format
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// mapFS is an in-memory FS, safe for concurrent use.
+type mapFS struct {
+	mu    sync.Mutex
+	files map[string]string
+}
+
+func (m *mapFS) ReadFile(path string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	src, ok := m.files[path]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+	}
+	return []byte(src), nil
+}
+
+func (m *mapFS) WriteFile(path string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[path] = string(data)
+	return nil
+}
+
+func collect(ch <-chan Result) map[string]Result {
+	m := make(map[string]Result)
+	for res := range ch {
+		m[res.Path] = res
+	}
+	return m
+}
+
+var formatTests = []struct {
+	cfg  Config
+	src  string
+	want string
+	st   Status
+}{
+	{Config{}, "foo\n", "foo\n", Unchanged},
+	{Config{}, "foo   bar", "foo bar\n", Changed},
+	{Config{}, "# keep\nfoo", "# keep\nfoo\n", Changed},
+	{Config{}, "foo(", "", Failed},
+	{
+		Config{Printer: []func(*syntax.Printer){syntax.Indent(4)}},
+		"{\nfoo\n}", "{\n    foo\n}\n", Changed,
+	},
+	{
+		Config{Parser: []func(*syntax.Parser){syntax.Variant(syntax.LangPOSIX)}},
+		"foo=(bar)", "", Failed,
+	},
+	{Config{Simplify: true}, "echo ${foo}\n", "echo $foo\n", Changed},
+}
+
+func TestFormatFiles(t *testing.T) {
+	t.Parallel()
+	for i, tc := range formatTests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			fsys := &mapFS{files: map[string]string{"a.sh": tc.src}}
+			tc.cfg.Write = true
+			got := collect(FormatFiles(context.Background(), fsys, []string{"a.sh"}, tc.cfg))
+			res := got["a.sh"]
+			if len(got) != 1 || res.Status != tc.st {
+				t.Fatalf("want one %s result, got %v", tc.st, got)
+			}
+			if (res.Err != nil) != (tc.st == Failed) {
+				t.Fatalf("unexpected error: %v", res.Err)
+			}
+			if tc.st == Failed {
+				if res.Formatted != nil {
+					t.Fatalf("failed result has formatted source %q", res.Formatted)
+				}
+				return
+			}
+			if string(res.Formatted) != tc.want {
+				t.Fatalf("Formatted mismatch:\nwant: %q\ngot:  %q", tc.want, res.Formatted)
+			}
+			if fsys.files["a.sh"] != tc.want {
+				t.Fatalf("written file mismatch:\nwant: %q\ngot:  %q", tc.want, fsys.files["a.sh"])
+			}
+		})
+	}
+}
+
+func TestFormatFilesMany(t *testing.T) {
+	t.Parallel()
+	fsys := &mapFS{files: make(map[string]string)}
+	var paths []string
+	want := make(map[string]Status)
+	for i := 0; i < 100; i++ {
+		path := fmt.Sprintf("f%02d.sh", i)
+		paths = append(paths, path)
+		switch i % 3 {
+		case 0:
+			fsys.files[path] = "foo\n"
+			want[path] = Unchanged
+		case 1:
+			fsys.files[path] = "foo  bar"
+			want[path] = Changed
+		default: // missing
+			want[path] = Failed
+		}
+	}
+	got := make(map[string]Status)
+	for path, res := range collect(FormatFiles(context.Background(), fsys, paths, Config{Workers: 4})) {
+		got[path] = res.Status
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("statuses mismatch:\nwant: %v\ngot:  %v", want, got)
+	}
+	if fsys.files["f01.sh"] != "foo  bar" {
+		t.Fatalf("file was written without Config.Write")
+	}
+}
+
+func TestFormatFilesCancel(t *testing.T) {
+	t.Parallel()
+	fsys := &mapFS{files: make(map[string]string)}
+	paths := make([]string, 1000)
+	for i := range paths {
+		paths[i] = fmt.Sprint(i)
+		fsys.files[paths[i]] = "foo"
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := FormatFiles(ctx, fsys, paths, Config{Workers: 2})
+	<-ch
+	cancel()
+	n := len(collect(ch))
+	if n >= len(paths)-1 {
+		t.Fatalf("cancelling did not stop formatting")
+	}
+}
+
+func TestStatusString(t *testing.T) {
+	var ss []string
+	for _, st := range []Status{Unchanged, Changed, Failed} {
+		ss = append(ss, st.String())
+	}
+	if got, want := strings.Join(ss, " "), "unchanged changed failed"; got != want {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+}
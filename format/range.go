@@ -0,0 +1,84 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package format
+
+import (
+	"bytes"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// FormatRange formats the top-level statements of src which intersect the
+// lines from startLine to endLine, counting from 1 and both included, and
+// leaves the rest of src untouched. This is useful to format a selection
+// in an editor.
+//
+// Whole statements are always formatted, along with their comments and
+// heredoc bodies, so the formatted lines may exceed the range; a function
+// declaration is formatted entirely if any of its lines is in the range.
+// The Write, Workers and Cache fields of cfg are ignored.
+func FormatRange(src []byte, startLine, endLine int, cfg Config) ([]byte, error) {
+	f := newFormatter(&cfg)
+	prog, err := f.parser.Parse(bytes.NewReader(src), "")
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Simplify {
+		syntax.Simplify(prog)
+	}
+	var stmts []*syntax.Stmt
+	var start, end uint // offsets of the lines to replace
+	for _, st := range prog.Stmts {
+		from, to := stmtBounds(st)
+		if int(to.Line()) < startLine || int(from.Line()) > endLine {
+			continue
+		}
+		if len(stmts) == 0 {
+			start = from.Offset()
+		}
+		stmts = append(stmts, st)
+		end = to.Offset()
+	}
+	if len(stmts) == 0 {
+		return src, nil
+	}
+	start = uint(bytes.LastIndexByte(src[:start], '\n') + 1)
+	if i := bytes.IndexByte(src[end:], '\n'); i >= 0 {
+		end += uint(i) + 1
+	} else {
+		end = uint(len(src))
+	}
+	if err := f.printer.Print(&f.buf, &syntax.File{
+		StmtList: syntax.StmtList{Stmts: stmts},
+	}); err != nil {
+		return nil, err
+	}
+	formatted := f.buf.Bytes()
+	if !bytes.HasSuffix(src[:end], []byte("\n")) {
+		formatted = bytes.TrimSuffix(formatted, []byte("\n"))
+	}
+	var out []byte
+	out = append(out, src[:start]...)
+	out = append(out, formatted...)
+	return append(out, src[end:]...), nil
+}
+
+// stmtBounds returns the first and last positions of a statement,
+// including its comments and heredoc bodies.
+func stmtBounds(st *syntax.Stmt) (from, to syntax.Pos) {
+	from, to = st.Pos(), st.End()
+	syntax.Walk(st, func(node syntax.Node) bool {
+		if node == nil {
+			return true
+		}
+		if pos := node.Pos(); pos.IsValid() && from.After(pos) {
+			from = pos
+		}
+		if end := node.End(); end.After(to) {
+			to = end
+		}
+		return true
+	})
+	return from, to
+}
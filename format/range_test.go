@@ -0,0 +1,58 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package format
+
+import (
+	"fmt"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+var formatRangeTests = []struct {
+	src        string
+	start, end int
+	want       string
+}{
+	{"a  b\nc  d\ne  f\n", 2, 2, "a  b\nc d\ne  f\n"},
+	{"a  b\nc  d\ne  f", 2, 3, "a  b\nc d\ne f"},
+	{"a  b\nc  d\n", 5, 6, "a  b\nc  d\n"},
+	{"if x;  then\n  y\nfi\nz  z\n", 2, 2, "if x; then\n\ty\nfi\nz  z\n"},
+	{"a  b\n# lead\nc  d # trail\ne  f\n", 3, 3, "a  b\n# lead\nc d # trail\ne  f\n"},
+	{"cat  <<EOF\n  body  \nEOF\nx  y\n", 1, 1, "cat <<EOF\n  body  \nEOF\nx  y\n"},
+	{"a  b;  c  d\ne  f\n", 1, 1, "a b\nc d\ne  f\n"},
+}
+
+func TestFormatRange(t *testing.T) {
+	t.Parallel()
+	for i, tc := range formatRangeTests {
+		t.Run(fmt.Sprintf("%02d", i), func(t *testing.T) {
+			got, err := FormatRange([]byte(tc.src), tc.start, tc.end, Config{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.want {
+				t.Fatalf("FormatRange mismatch in %q:\nwant: %q\ngot:  %q",
+					tc.src, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestFormatRangeOptions(t *testing.T) {
+	t.Parallel()
+	cfg := Config{
+		Printer:  []func(*syntax.Printer){syntax.Indent(2)},
+		Simplify: true,
+	}
+	src := "f() {\necho  $((  $x ))\n}\n[[  -n  \"$y\" ]]\n"
+	want := "f() {\n  echo $((x))\n}\n[[  -n  \"$y\" ]]\n"
+	got, err := FormatRange([]byte(src), 2, 2, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Fatalf("FormatRange mismatch:\nwant: %q\ngot:  %q", want, got)
+	}
+}
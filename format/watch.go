@@ -0,0 +1,155 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package format
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Op describes a file system change. Its values match those of
+// github.com/fsnotify/fsnotify, so that its events can be converted
+// directly.
+type Op uint32
+
+const (
+	Create Op = 1 << iota
+	Write
+	Remove
+	Rename
+	Chmod
+)
+
+// Event is a change to a file, such as one reported by fsnotify.
+type Event struct {
+	Path string
+	Op   Op
+}
+
+// Watch formats files as they change, until the events channel is closed or
+// ctx is cancelled. The returned channel receives one result each time a
+// file is formatted, and is closed once Watch stops.
+//
+// Only Create and Write events are considered, and only for files that are
+// either one of the given paths or inside one of them. A file is formatted
+// once no new events for it have arrived for the given delay, so that a
+// burst of writes from an editor results in a single format. Once the
+// events channel is closed, the files still waiting are formatted right
+// away.
+//
+// If cfg.Write is set, the write of a formatted file will usually cause a
+// new event for it. The resulting unchanged result is not reported.
+func Watch(ctx context.Context, fsys FS, paths []string, events <-chan Event, cfg Config, delay time.Duration) <-chan Result {
+	w := &watcher{
+		ctx:     ctx,
+		fsys:    fsys,
+		cfg:     cfg,
+		results: make(chan Result),
+		pending: make(map[string]time.Time),
+		written: make(map[string]string),
+	}
+	for _, path := range paths {
+		w.paths = append(w.paths, filepath.Clean(path))
+	}
+	go w.loop(events, delay)
+	return w.results
+}
+
+type watcher struct {
+	ctx     context.Context
+	fsys    FS
+	cfg     Config
+	paths   []string
+	results chan Result
+
+	// pending holds the time at which each file should be formatted.
+	pending map[string]time.Time
+
+	// written holds the contents last written to each file, to recognise
+	// the events caused by our own writes.
+	written map[string]string
+}
+
+func (w *watcher) loop(events <-chan Event, delay time.Duration) {
+	defer close(w.results)
+	var timer *time.Timer
+	var timerC <-chan time.Time
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case ev, ok := <-events:
+			if !ok {
+				w.format(time.Time{})
+				return
+			}
+			if ev.Op&(Create|Write) == 0 || !w.watched(ev.Path) {
+				continue
+			}
+			w.pending[filepath.Clean(ev.Path)] = time.Now().Add(delay)
+			if timer == nil {
+				timer = time.NewTimer(delay)
+				timerC = timer.C
+			}
+		case now := <-timerC:
+			if !w.format(now) {
+				return
+			}
+			timer, timerC = nil, nil
+			var next time.Time
+			for _, t := range w.pending {
+				if next.IsZero() || t.Before(next) {
+					next = t
+				}
+			}
+			if !next.IsZero() {
+				timer = time.NewTimer(next.Sub(now))
+				timerC = timer.C
+			}
+		}
+	}
+}
+
+// watched reports whether path is one of the watched paths or inside one
+// of them.
+func (w *watcher) watched(path string) bool {
+	for _, p := range w.paths {
+		rel, err := filepath.Rel(p, path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// format formats the pending files that are due at the given time, or all
+// of them if it is zero. It returns false if ctx was cancelled.
+func (w *watcher) format(now time.Time) bool {
+	var due []string
+	for path, t := range w.pending {
+		if now.IsZero() || !t.After(now) {
+			due = append(due, path)
+			delete(w.pending, path)
+		}
+	}
+	sort.Strings(due)
+	for res := range FormatFiles(w.ctx, w.fsys, due, w.cfg) {
+		written, ok := w.written[res.Path]
+		delete(w.written, res.Path)
+		if ok && res.Status == Unchanged && string(res.Src) == written {
+			continue
+		}
+		if res.Status == Changed && w.cfg.Write {
+			w.written[res.Path] = string(res.Formatted)
+		}
+		select {
+		case w.results <- res:
+		case <-w.ctx.Done():
+		}
+	}
+	return w.ctx.Err() == nil
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package format
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWatchDebounce(t *testing.T) {
+	t.Parallel()
+	fsys := &mapFS{files: map[string]string{"dir/a.sh": "foo  bar"}}
+	// buffered, so that the burst arrives well within the delay
+	events := make(chan Event, 5)
+	ch := Watch(context.Background(), fsys, []string{"dir"}, events, Config{}, 200*time.Millisecond)
+	for i := 0; i < 5; i++ {
+		events <- Event{Path: "dir/a.sh", Op: Write}
+	}
+	res := <-ch
+	if res.Path != "dir/a.sh" || res.Status != Changed {
+		t.Fatalf("unexpected result: %v", res)
+	}
+	// ignored events
+	events <- Event{Path: "dir/a.sh", Op: Remove}
+	events <- Event{Path: "other/b.sh", Op: Write}
+	events <- Event{Path: "dirx/c.sh", Op: Create}
+	close(events)
+	for res := range ch {
+		t.Fatalf("unexpected result: %v", res)
+	}
+}
+
+func TestWatchFlush(t *testing.T) {
+	t.Parallel()
+	fsys := &mapFS{files: map[string]string{"a.sh": "foo\n", "b.sh": "foo("}}
+	events := make(chan Event, 3)
+	events <- Event{Path: "a.sh", Op: Write}
+	events <- Event{Path: "./b.sh", Op: Create | Chmod}
+	events <- Event{Path: "a.sh", Op: Write}
+	close(events)
+	got := collect(Watch(context.Background(), fsys, []string{"a.sh", "b.sh"}, events, Config{}, time.Hour))
+	if len(got) != 2 || got["a.sh"].Status != Unchanged || got["b.sh"].Status != Failed {
+		t.Fatalf("unexpected results: %v", got)
+	}
+}
+
+func TestWatchOwnWrites(t *testing.T) {
+	t.Parallel()
+	fsys := &mapFS{files: map[string]string{"a.sh": "foo  bar", "b.sh": "foo\n"}}
+	events := make(chan Event)
+	ch := Watch(context.Background(), fsys, []string{"."}, events, Config{Write: true}, time.Millisecond)
+	events <- Event{Path: "a.sh", Op: Write}
+	if res := <-ch; res.Status != Changed {
+		t.Fatalf("unexpected result: %v", res)
+	}
+	if src, _ := fsys.ReadFile("a.sh"); string(src) != "foo bar\n" {
+		t.Fatalf("file was not written")
+	}
+	// the event caused by our own write is not reported
+	events <- Event{Path: "a.sh", Op: Write}
+	events <- Event{Path: "b.sh", Op: Write}
+	if res := <-ch; res.Path != "b.sh" {
+		t.Fatalf("unexpected result: %v", res)
+	}
+	// later writes to the file are reported again
+	events <- Event{Path: "a.sh", Op: Write}
+	if res := <-ch; res.Path != "a.sh" || res.Status != Unchanged {
+		t.Fatalf("unexpected result: %v", res)
+	}
+	close(events)
+	if _, ok := <-ch; ok {
+		t.Fatalf("results channel was not closed")
+	}
+}
+
+func TestWatchCancel(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := Watch(ctx, &mapFS{}, []string{"."}, make(chan Event), Config{}, time.Millisecond)
+	cancel()
+	if _, ok := <-ch; ok {
+		t.Fatalf("results channel was not closed")
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+// Package gogen generates Go source code that builds shell syntax trees.
+//
+// Given a parsed script, the generated code constructs the same nodes
+// out of composite literals of the syntax package's types. This is
+// useful as a starting point for Go programs which need to emit shell
+// programs with some parameterized parts, as the generated code can be
+// edited to replace nodes with values built at run time, instead of
+// concatenating strings.
+//
+// Positions are not part of the generated code, so printing the
+// resulting nodes will not keep the original formatting.
+//
+// This package is a work in progress and EXPERIMENTAL; its API is not
+// subject to the 1.x backwards compatibility guarantee.
+package gogen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"reflect"
+	"strconv"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// Expr writes a Go expression that evaluates to a copy of node, such as
+// &syntax.CallExpr{...}. The expression is formatted as gofmt would.
+func Expr(w io.Writer, node syntax.Node) error {
+	var buf bytes.Buffer
+	writeValue(&buf, reflect.ValueOf(node))
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// File writes a Go source file belonging to package pkg, declaring a
+// function with the given name that returns a copy of f.
+func File(w io.Writer, f *syntax.File, pkg, name string) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by mvdan.cc/sh/gogen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package %s\n\n", pkg)
+	fmt.Fprintf(&buf, "import %q\n\n", "mvdan.cc/sh/syntax")
+	fmt.Fprintf(&buf, "func %s() *syntax.File {\n\treturn ", name)
+	writeValue(&buf, reflect.ValueOf(f))
+	buf.WriteString("\n}\n")
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+var posType = reflect.TypeOf(syntax.Pos{})
+
+func writeValue(buf *bytes.Buffer, val reflect.Value) {
+	switch val.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if val.IsNil() {
+			buf.WriteString("nil")
+			return
+		}
+		if val.Kind() == reflect.Ptr {
+			buf.WriteString("&")
+		}
+		writeValue(buf, val.Elem())
+	case reflect.Struct:
+		buf.WriteString(val.Type().String())
+		buf.WriteString("{")
+		typ := val.Type()
+		first := true
+		for i := 0; i < val.NumField(); i++ {
+			ftyp := typ.Field(i)
+			fval := val.Field(i)
+			if ftyp.PkgPath != "" || ftyp.Type == posType || isZero(fval) {
+				continue
+			}
+			if first {
+				buf.WriteString("\n")
+				first = false
+			}
+			buf.WriteString(ftyp.Name)
+			buf.WriteString(": ")
+			writeValue(buf, fval)
+			buf.WriteString(",\n")
+		}
+		buf.WriteString("}")
+	case reflect.Slice:
+		buf.WriteString(val.Type().String())
+		buf.WriteString("{")
+		if val.Len() > 0 {
+			buf.WriteString("\n")
+		}
+		for i := 0; i < val.Len(); i++ {
+			writeValue(buf, val.Index(i))
+			buf.WriteString(",\n")
+		}
+		buf.WriteString("}")
+	case reflect.String:
+		buf.WriteString(strconv.Quote(val.String()))
+	case reflect.Bool:
+		buf.WriteString(strconv.FormatBool(val.Bool()))
+	default:
+		if name, ok := opNames[val.Interface()]; ok {
+			buf.WriteString("syntax." + name)
+			return
+		}
+		// a type conversion keeps the value typed, such as
+		// syntax.LangVariant(1)
+		fmt.Fprintf(buf, "%s(%d)", val.Type(), val.Interface())
+	}
+}
+
+func isZero(val reflect.Value) bool {
+	switch val.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Slice:
+		return val.IsNil()
+	case reflect.Struct:
+		typ := val.Type()
+		for i := 0; i < val.NumField(); i++ {
+			ftyp := typ.Field(i)
+			if ftyp.PkgPath != "" || ftyp.Type == posType {
+				continue
+			}
+			if !isZero(val.Field(i)) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(val.Interface(), reflect.Zero(val.Type()).Interface())
+}
@@ -0,0 +1,244 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package gogen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+var roundTripTests = []string{
+	"",
+	"foo bar",
+	"# comment\nfoo 'a' \"b $c\" $'d'",
+	"a=b c+=(d e); declare -A f=([x]=y)",
+	"foo >out 2>&1 <<EOF\nbar\nEOF",
+	"if a; then b; elif c; then d; else e; fi",
+	"for i in 1 2; do echo $i; done; for ((i = 0; i < 3; i++)); do :; done",
+	"case $x in a | b) foo ;; *) bar ;& esac",
+	"a && b || ! c | d |& e &",
+	"f() { (g); }; function h { $(i) `j` <(k); }",
+	"echo ${a:-b} ${#c} ${d/e/f} ${g:1:2} ${!h*} $((1 + 2 * 3)) $[4]",
+	"[[ -f a && (b < c) || ! d =~ e ]]; ((x++)); let y=2",
+	"time foo; coproc bar; echo @(a|b) ${x[2]}",
+}
+
+func TestRoundTrip(t *testing.T) {
+	t.Parallel()
+	for i, src := range roundTripTests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			want, err := syntax.NewParser(syntax.KeepComments).Parse(strings.NewReader(src), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := Expr(&buf, want); err != nil {
+				t.Fatal(err)
+			}
+			expr, err := parser.ParseExpr(buf.String())
+			if err != nil {
+				t.Fatalf("invalid Go expression: %v\n%s", err, buf.String())
+			}
+			types := make(map[string]reflect.Type)
+			collectTypes(types, reflect.TypeOf(want))
+			got := eval(t, types, expr, reflect.TypeOf(want))
+			clearPos(reflect.ValueOf(want))
+			if !reflect.DeepEqual(want, got.Interface()) {
+				t.Fatalf("syntax tree mismatch:\n%s", buf.String())
+			}
+		})
+	}
+}
+
+func TestFile(t *testing.T) {
+	t.Parallel()
+	f, err := syntax.NewParser().Parse(strings.NewReader("echo foo"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := File(&buf, f, "main", "script"); err != nil {
+		t.Fatal(err)
+	}
+	want := `// Code generated by mvdan.cc/sh/gogen. DO NOT EDIT.
+
+package main
+
+import "mvdan.cc/sh/syntax"
+
+func script() *syntax.File {
+	return &syntax.File{
+		StmtList: syntax.StmtList{
+			Stmts: []*syntax.Stmt{
+				&syntax.Stmt{
+					Cmd: &syntax.CallExpr{
+						Args: []*syntax.Word{
+							&syntax.Word{
+								Parts: []syntax.WordPart{
+									&syntax.Lit{
+										Value: "echo",
+									},
+								},
+							},
+							&syntax.Word{
+								Parts: []syntax.WordPart{
+									&syntax.Lit{
+										Value: "foo",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+`
+	if got := buf.String(); got != want {
+		t.Fatalf("File mismatch:\nwant:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+// collectTypes records all the named types reachable from typ.
+func collectTypes(types map[string]reflect.Type, typ reflect.Type) {
+	switch typ.Kind() {
+	case reflect.Ptr, reflect.Slice:
+		collectTypes(types, typ.Elem())
+		return
+	}
+	if _, ok := types[typ.String()]; ok || typ.PkgPath() == "" {
+		return
+	}
+	types[typ.String()] = typ
+	switch typ.Kind() {
+	case reflect.Struct:
+		for i := 0; i < typ.NumField(); i++ {
+			collectTypes(types, typ.Field(i).Type)
+		}
+	case reflect.Interface:
+		// find the implementations among the nodes we know of
+		for _, v := range []interface{}{
+			&syntax.CallExpr{}, &syntax.IfClause{}, &syntax.WhileClause{},
+			&syntax.ForClause{}, &syntax.CaseClause{}, &syntax.Block{},
+			&syntax.Subshell{}, &syntax.BinaryCmd{}, &syntax.FuncDecl{},
+			&syntax.ArithmCmd{}, &syntax.TestClause{}, &syntax.DeclClause{},
+			&syntax.LetClause{}, &syntax.TimeClause{}, &syntax.CoprocClause{},
+			&syntax.Lit{}, &syntax.SglQuoted{}, &syntax.DblQuoted{},
+			&syntax.ParamExp{}, &syntax.CmdSubst{}, &syntax.ArithmExp{},
+			&syntax.ProcSubst{}, &syntax.ExtGlob{}, &syntax.WordIter{},
+			&syntax.CStyleLoop{}, &syntax.BinaryArithm{}, &syntax.UnaryArithm{},
+			&syntax.ParenArithm{}, &syntax.Word{}, &syntax.BinaryTest{},
+			&syntax.UnaryTest{}, &syntax.ParenTest{},
+		} {
+			if vt := reflect.TypeOf(v); vt.Implements(typ) {
+				collectTypes(types, vt)
+			}
+		}
+	}
+}
+
+func exprString(expr ast.Expr) string {
+	switch x := expr.(type) {
+	case *ast.Ident:
+		return x.Name
+	case *ast.SelectorExpr:
+		return exprString(x.X) + "." + x.Sel.Name
+	case *ast.StarExpr:
+		return "*" + exprString(x.X)
+	case *ast.ArrayType:
+		return "[]" + exprString(x.Elt)
+	}
+	panic(fmt.Sprintf("unexpected type expression %T", expr))
+}
+
+// eval builds the value described by a Go expression produced by Expr.
+func eval(t *testing.T, types map[string]reflect.Type, expr ast.Expr, typ reflect.Type) reflect.Value {
+	switch x := expr.(type) {
+	case *ast.UnaryExpr: // &T{...}
+		// typ may be an interface, so use the literal's type
+		lit := x.X.(*ast.CompositeLit)
+		v := eval(t, types, lit, types[exprString(lit.Type)])
+		ptr := reflect.New(v.Type())
+		ptr.Elem().Set(v)
+		return ptr
+	case *ast.CompositeLit:
+		name := exprString(x.Type)
+		if strings.HasPrefix(name, "[]") {
+			sl := reflect.MakeSlice(typ, 0, len(x.Elts))
+			for _, elt := range x.Elts {
+				sl = reflect.Append(sl, eval(t, types, elt, typ.Elem()))
+			}
+			return sl
+		}
+		st, ok := types[name]
+		if !ok {
+			t.Fatalf("unknown type %s", name)
+		}
+		v := reflect.New(st).Elem()
+		for _, elt := range x.Elts {
+			kv := elt.(*ast.KeyValueExpr)
+			field := v.FieldByName(kv.Key.(*ast.Ident).Name)
+			fv := eval(t, types, kv.Value, field.Type())
+			field.Set(fv)
+		}
+		return v
+	case *ast.BasicLit:
+		switch x.Kind {
+		case token.STRING:
+			s, err := strconv.Unquote(x.Value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return reflect.ValueOf(s).Convert(typ)
+		}
+	case *ast.Ident:
+		switch x.Name {
+		case "true", "false":
+			return reflect.ValueOf(x.Name == "true").Convert(typ)
+		}
+	case *ast.SelectorExpr: // an operator constant
+		for op, name := range opNames {
+			if name == x.Sel.Name && reflect.TypeOf(op) == typ {
+				return reflect.ValueOf(op)
+			}
+		}
+	}
+	t.Fatalf("unexpected expression %T", expr)
+	return reflect.Value{}
+}
+
+var zeroPos = reflect.ValueOf(syntax.Pos{})
+
+func clearPos(val reflect.Value) {
+	switch val.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !val.IsNil() {
+			clearPos(val.Elem())
+		}
+	case reflect.Struct:
+		if val.Type() == posType {
+			val.Set(zeroPos)
+			return
+		}
+		for i := 0; i < val.NumField(); i++ {
+			if val.Type().Field(i).PkgPath == "" {
+				clearPos(val.Field(i))
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < val.Len(); i++ {
+			clearPos(val.Index(i))
+		}
+	}
+}
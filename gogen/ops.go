@@ -0,0 +1,143 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package gogen
+
+import "mvdan.cc/sh/syntax"
+
+// opNames maps each operator constant in the syntax package to its name.
+var opNames = map[interface{}]string{
+	syntax.RdrOut:           "RdrOut",
+	syntax.AppOut:           "AppOut",
+	syntax.RdrIn:            "RdrIn",
+	syntax.RdrInOut:         "RdrInOut",
+	syntax.DplIn:            "DplIn",
+	syntax.DplOut:           "DplOut",
+	syntax.ClbOut:           "ClbOut",
+	syntax.Hdoc:             "Hdoc",
+	syntax.DashHdoc:         "DashHdoc",
+	syntax.WordHdoc:         "WordHdoc",
+	syntax.RdrAll:           "RdrAll",
+	syntax.AppAll:           "AppAll",
+	syntax.CmdIn:            "CmdIn",
+	syntax.CmdOut:           "CmdOut",
+	syntax.GlobQuest:        "GlobQuest",
+	syntax.GlobStar:         "GlobStar",
+	syntax.GlobPlus:         "GlobPlus",
+	syntax.GlobAt:           "GlobAt",
+	syntax.GlobExcl:         "GlobExcl",
+	syntax.AndStmt:          "AndStmt",
+	syntax.OrStmt:           "OrStmt",
+	syntax.Pipe:             "Pipe",
+	syntax.PipeAll:          "PipeAll",
+	syntax.Break:            "Break",
+	syntax.Fallthrough:      "Fallthrough",
+	syntax.Resume:           "Resume",
+	syntax.ResumeKorn:       "ResumeKorn",
+	syntax.NamesPrefix:      "NamesPrefix",
+	syntax.NamesPrefixWords: "NamesPrefixWords",
+	syntax.SubstPlus:        "SubstPlus",
+	syntax.SubstColPlus:     "SubstColPlus",
+	syntax.SubstMinus:       "SubstMinus",
+	syntax.SubstColMinus:    "SubstColMinus",
+	syntax.SubstQuest:       "SubstQuest",
+	syntax.SubstColQuest:    "SubstColQuest",
+	syntax.SubstAssgn:       "SubstAssgn",
+	syntax.SubstColAssgn:    "SubstColAssgn",
+	syntax.RemSmallSuffix:   "RemSmallSuffix",
+	syntax.RemLargeSuffix:   "RemLargeSuffix",
+	syntax.RemSmallPrefix:   "RemSmallPrefix",
+	syntax.RemLargePrefix:   "RemLargePrefix",
+	syntax.UpperFirst:       "UpperFirst",
+	syntax.UpperAll:         "UpperAll",
+	syntax.LowerFirst:       "LowerFirst",
+	syntax.LowerAll:         "LowerAll",
+	syntax.OtherParamOps:    "OtherParamOps",
+	syntax.Not:              "Not",
+	syntax.Inc:              "Inc",
+	syntax.Dec:              "Dec",
+	syntax.Plus:             "Plus",
+	syntax.Minus:            "Minus",
+	syntax.Add:              "Add",
+	syntax.Sub:              "Sub",
+	syntax.Mul:              "Mul",
+	syntax.Quo:              "Quo",
+	syntax.Rem:              "Rem",
+	syntax.Pow:              "Pow",
+	syntax.Eql:              "Eql",
+	syntax.Gtr:              "Gtr",
+	syntax.Lss:              "Lss",
+	syntax.Neq:              "Neq",
+	syntax.Leq:              "Leq",
+	syntax.Geq:              "Geq",
+	syntax.And:              "And",
+	syntax.Or:               "Or",
+	syntax.Xor:              "Xor",
+	syntax.Shr:              "Shr",
+	syntax.Shl:              "Shl",
+	syntax.AndArit:          "AndArit",
+	syntax.OrArit:           "OrArit",
+	syntax.Comma:            "Comma",
+	syntax.Quest:            "Quest",
+	syntax.Colon:            "Colon",
+	syntax.Assgn:            "Assgn",
+	syntax.AddAssgn:         "AddAssgn",
+	syntax.SubAssgn:         "SubAssgn",
+	syntax.MulAssgn:         "MulAssgn",
+	syntax.QuoAssgn:         "QuoAssgn",
+	syntax.RemAssgn:         "RemAssgn",
+	syntax.AndAssgn:         "AndAssgn",
+	syntax.OrAssgn:          "OrAssgn",
+	syntax.XorAssgn:         "XorAssgn",
+	syntax.ShlAssgn:         "ShlAssgn",
+	syntax.ShrAssgn:         "ShrAssgn",
+	syntax.TsExists:         "TsExists",
+	syntax.TsRegFile:        "TsRegFile",
+	syntax.TsDirect:         "TsDirect",
+	syntax.TsCharSp:         "TsCharSp",
+	syntax.TsBlckSp:         "TsBlckSp",
+	syntax.TsNmPipe:         "TsNmPipe",
+	syntax.TsSocket:         "TsSocket",
+	syntax.TsSmbLink:        "TsSmbLink",
+	syntax.TsSticky:         "TsSticky",
+	syntax.TsGIDSet:         "TsGIDSet",
+	syntax.TsUIDSet:         "TsUIDSet",
+	syntax.TsGrpOwn:         "TsGrpOwn",
+	syntax.TsUsrOwn:         "TsUsrOwn",
+	syntax.TsModif:          "TsModif",
+	syntax.TsRead:           "TsRead",
+	syntax.TsWrite:          "TsWrite",
+	syntax.TsExec:           "TsExec",
+	syntax.TsNoEmpty:        "TsNoEmpty",
+	syntax.TsFdTerm:         "TsFdTerm",
+	syntax.TsEmpStr:         "TsEmpStr",
+	syntax.TsNempStr:        "TsNempStr",
+	syntax.TsOptSet:         "TsOptSet",
+	syntax.TsVarSet:         "TsVarSet",
+	syntax.TsRefVar:         "TsRefVar",
+	syntax.TsNot:            "TsNot",
+	syntax.TsReMatch:        "TsReMatch",
+	syntax.TsNewer:          "TsNewer",
+	syntax.TsOlder:          "TsOlder",
+	syntax.TsDevIno:         "TsDevIno",
+	syntax.TsEql:            "TsEql",
+	syntax.TsNeq:            "TsNeq",
+	syntax.TsLeq:            "TsLeq",
+	syntax.TsGeq:            "TsGeq",
+	syntax.TsLss:            "TsLss",
+	syntax.TsGtr:            "TsGtr",
+	syntax.AndTest:          "AndTest",
+	syntax.OrTest:           "OrTest",
+	syntax.TsMatch:          "TsMatch",
+	syntax.TsNoMatch:        "TsNoMatch",
+	syntax.TsBefore:         "TsBefore",
+	syntax.TsAfter:          "TsAfter",
+	syntax.TermNone:         "TermNone",
+	syntax.TermNewline:      "TermNewline",
+	syntax.TermSemicolon:    "TermSemicolon",
+	syntax.TermBackground:   "TermBackground",
+	syntax.TermAndStmt:      "TermAndStmt",
+	syntax.TermOrStmt:       "TermOrStmt",
+	syntax.TermPipe:         "TermPipe",
+	syntax.TermPipeAll:      "TermPipeAll",
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package highlight
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// Colors maps span kinds to ANSI SGR parameters, such as "1;34" for bold
+// blue. Kinds missing from the map are not colorized.
+type Colors map[Kind]string
+
+// DefaultColors is a set of colors that works on both light and dark
+// terminal backgrounds.
+var DefaultColors = Colors{
+	Keyword:   "1;34", // bold blue
+	Builtin:   "36",   // cyan
+	Variable:  "35",   // magenta
+	String:    "32",   // green
+	Comment:   "90",   // bright black
+	Operator:  "33",   // yellow
+	Expansion: "35",   // magenta
+}
+
+// ANSI writes src to w, colorizing each of its spans, as returned by
+// Spans, with ANSI escape sequences.
+func ANSI(w io.Writer, src []byte, spans []Span, colors Colors) error {
+	bw := bufio.NewWriter(w)
+	last := uint(0)
+	for _, s := range spans {
+		code := colors[s.Kind]
+		if code == "" {
+			continue
+		}
+		bw.Write(src[last:s.Start])
+		bw.WriteString("\x1b[" + code + "m")
+		bw.Write(src[s.Start:s.End])
+		bw.WriteString("\x1b[0m")
+		last = s.End
+	}
+	bw.Write(src[last:])
+	return bw.Flush()
+}
+
+// Printer prints syntax trees like syntax.Printer, optionally colorizing
+// its output for terminals. Like syntax.Printer, it is safe for concurrent
+// use.
+type Printer struct {
+	printer *syntax.Printer
+	lang    syntax.LangVariant
+	colors  Colors
+}
+
+// NewPrinter allocates a new Printer that colorizes its output with the
+// given colors. If colors is nil, the output is not colorized, which is
+// useful when the output is not a terminal. The language variant must
+// match the one used to parse the nodes to be printed. The printer options
+// are passed to syntax.NewPrinter.
+func NewPrinter(lang syntax.LangVariant, colors Colors, options ...func(*syntax.Printer)) *Printer {
+	return &Printer{
+		printer: syntax.NewPrinter(options...),
+		lang:    lang,
+		colors:  colors,
+	}
+}
+
+// Print prints node to w. See syntax.Printer.Print.
+//
+// The printed program is parsed again to find its spans. If that fails,
+// such as when node is not a whole command, the output is not colorized.
+func (p *Printer) Print(w io.Writer, node syntax.Node) error {
+	if p.colors == nil {
+		return p.printer.Print(w, node)
+	}
+	var buf bytes.Buffer
+	if err := p.printer.Print(&buf, node); err != nil {
+		return err
+	}
+	src := buf.Bytes()
+	spans, err := Parse(src, p.lang)
+	if err != nil {
+		_, err := w.Write(src)
+		return err
+	}
+	return ANSI(w, src, spans, p.colors)
+}
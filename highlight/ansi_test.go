@@ -0,0 +1,67 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package highlight
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+func TestANSI(t *testing.T) {
+	t.Parallel()
+	src := []byte("echo \"$x\" # c")
+	spans, err := Parse(src, syntax.LangBash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	colors := Colors{Builtin: "36", Variable: "35", Comment: "2"}
+	if err := ANSI(&buf, src, spans, colors); err != nil {
+		t.Fatal(err)
+	}
+	want := "\x1b[36mecho\x1b[0m \"$\x1b[35mx\x1b[0m\" \x1b[2m# c\x1b[0m"
+	if got := buf.String(); got != want {
+		t.Fatalf("ANSI mismatch:\nwant: %q\ngot:  %q", want, got)
+	}
+}
+
+func TestPrinter(t *testing.T) {
+	t.Parallel()
+	f, err := syntax.NewParser().Parse(strings.NewReader("if a;then\nb;fi"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		printer *Printer
+		node    syntax.Node
+		want    string
+	}{
+		{
+			NewPrinter(syntax.LangBash, nil),
+			f, "if a; then\n\tb\nfi\n",
+		},
+		{
+			NewPrinter(syntax.LangBash, Colors{Keyword: "1"}, syntax.Indent(2)),
+			f, "\x1b[1mif\x1b[0m a; \x1b[1mthen\x1b[0m\n  b\n\x1b[1mfi\x1b[0m\n",
+		},
+		{
+			// a plain word has no spans
+			NewPrinter(syntax.LangBash, DefaultColors),
+			f.Stmts[0].Cmd.(*syntax.IfClause).Cond.Stmts[0].Cmd.(*syntax.CallExpr).Args[0],
+			"a",
+		},
+	}
+	for _, tc := range tests {
+		var buf bytes.Buffer
+		if err := tc.printer.Print(&buf, tc.node); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != tc.want {
+			t.Errorf("Print mismatch:\nwant: %q\ngot:  %q", tc.want, got)
+		}
+	}
+}
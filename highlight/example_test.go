@@ -0,0 +1,22 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package highlight_test
+
+import (
+	"os"
+
+	"mvdan.cc/sh/highlight"
+	"mvdan.cc/sh/syntax"
+)
+
+func ExampleHTML() {
+	src := []byte("echo $HOME # home")
+	spans, err := highlight.Parse(src, syntax.LangBash)
+	if err != nil {
+		return
+	}
+	highlight.HTML(os.Stdout, src, spans)
+	// Output:
+	// <span class="builtin">echo</span> <span class="expansion">$</span><span class="variable">HOME</span> <span class="comment"># home</span>
+}
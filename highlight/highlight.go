@@ -0,0 +1,381 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+// Package highlight classifies the source code of shell programs into
+// spans such as keywords, strings and comments, which is useful for
+// syntax highlighting in editors and renderers. The classification is
+// done on the syntax tree, so it matches the parser's understanding of
+// the program.
+//
+// This package is a work in progress and EXPERIMENTAL; its API is not
+// subject to the 1.x backwards compatibility guarantee.
+package highlight
+
+import (
+	"bytes"
+	"sort"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// Kind is the classification of a span of source code.
+type Kind uint8
+
+const (
+	_ Kind = iota
+
+	Keyword   // reserved words like if and done
+	Builtin   // builtin commands like echo and declare
+	Variable  // variable names in expansions and assignments
+	String    // quoted strings and heredoc bodies
+	Comment   // comments
+	Operator  // control and redirection operators like && and >
+	Expansion // the delimiters of expansions like $( and ${
+)
+
+var kindNames = [...]string{
+	Keyword:   "keyword",
+	Builtin:   "builtin",
+	Variable:  "variable",
+	String:    "string",
+	Comment:   "comment",
+	Operator:  "operator",
+	Expansion: "expansion",
+}
+
+func (k Kind) String() string {
+	if int(k) < len(kindNames) && kindNames[k] != "" {
+		return kindNames[k]
+	}
+	return "unknown"
+}
+
+// Span is a classified range of source code, in byte offsets. Start is
+// inclusive, while End is exclusive.
+type Span struct {
+	Kind       Kind
+	Start, End uint
+}
+
+// Parse parses src in the given language variant, and returns its spans
+// as Spans would.
+func Parse(src []byte, lang syntax.LangVariant) ([]Span, error) {
+	p := syntax.NewParser(syntax.KeepComments, syntax.Variant(lang))
+	f, err := p.Parse(bytes.NewReader(src), "")
+	if err != nil {
+		return nil, err
+	}
+	return Spans(src, f), nil
+}
+
+// Spans returns the classified spans of source code within node, which
+// must have been parsed from src. Comments are only included if the parser
+// kept them.
+//
+// The spans are sorted and do not overlap. Where a node is within
+// another, such as an expansion within a double-quoted string, the inner
+// node takes precedence and the outer span is split around it. Source
+// code which is not classified, such as plain words, is not covered by
+// any span.
+func Spans(src []byte, node syntax.Node) []Span {
+	c := collector{src: src}
+	syntax.Walk(node, c.node)
+	return flatten(c.spans)
+}
+
+type collector struct {
+	src   []byte
+	spans []Span
+}
+
+func (c *collector) add(kind Kind, start, end uint) {
+	if end > uint(len(c.src)) {
+		end = uint(len(c.src))
+	}
+	if start < end {
+		c.spans = append(c.spans, Span{Kind: kind, Start: start, End: end})
+	}
+}
+
+func (c *collector) addLen(kind Kind, pos syntax.Pos, n int) {
+	if pos.IsValid() {
+		c.add(kind, pos.Offset(), pos.Offset()+uint(n))
+	}
+}
+
+func (c *collector) addNode(kind Kind, node syntax.Node) {
+	c.add(kind, node.Pos().Offset(), node.End().Offset())
+}
+
+// hasPrefix reports whether the source at pos starts with s.
+func (c *collector) hasPrefix(pos syntax.Pos, s string) bool {
+	return bytes.HasPrefix(c.src[pos.Offset():], []byte(s))
+}
+
+// findWord finds the first occurrence of word in the source between two
+// offsets, skipping comments. It is used for reserved words whose position
+// is not recorded in the syntax tree, such as "in".
+func (c *collector) findWord(from, to uint, word string) {
+	if to > uint(len(c.src)) {
+		to = uint(len(c.src))
+	}
+	for i := from; i < to; i++ {
+		switch b := c.src[i]; {
+		case b == '#':
+			for i < to && c.src[i] != '\n' {
+				i++
+			}
+		case bytes.HasPrefix(c.src[i:to], []byte(word)):
+			end := i + uint(len(word))
+			if end == to || isSpace(c.src[end]) {
+				c.add(Keyword, i, end)
+			}
+			return
+		case !isSpace(b):
+			return
+		}
+	}
+}
+
+func isSpace(b byte) bool {
+	switch b {
+	case ' ', '\t', '\n', '\r', ';':
+		return true
+	}
+	return false
+}
+
+func (c *collector) node(node syntax.Node) bool {
+	switch x := node.(type) {
+	case *syntax.Comment:
+		c.add(Comment, x.Hash.Offset(), x.End().Offset())
+	case *syntax.Stmt:
+		if x.Negated && c.hasPrefix(x.Position, "!") {
+			c.addLen(Keyword, x.Position, 1)
+		}
+		if x.Semicolon.IsValid() {
+			n := 1
+			if c.hasPrefix(x.Semicolon, "|&") {
+				n = 2
+			}
+			c.addLen(Operator, x.Semicolon, n)
+		}
+	case *syntax.Assign:
+		if x.Name != nil {
+			c.addNode(Variable, x.Name)
+		}
+	case *syntax.Redirect:
+		c.addLen(Operator, x.OpPos, len(x.Op.String()))
+		if x.Hdoc != nil && len(x.Hdoc.Parts) > 0 {
+			end := x.Hdoc.End().Offset()
+			// the last literal may end past the closing delimiter
+			if lit, ok := x.Hdoc.Parts[len(x.Hdoc.Parts)-1].(*syntax.Lit); ok {
+				end = lit.Pos().Offset() + uint(len(lit.Value))
+			}
+			c.add(String, x.Hdoc.Pos().Offset(), end)
+		}
+	case *syntax.CallExpr:
+		if len(x.Args) > 0 {
+			w := x.Args[0]
+			if len(w.Parts) == 1 {
+				if lit, ok := w.Parts[0].(*syntax.Lit); ok && syntax.IsBuiltin(lit.Value) {
+					c.addNode(Builtin, lit)
+				}
+			}
+		}
+	case *syntax.Subshell:
+		c.addLen(Operator, x.Lparen, 1)
+		c.addLen(Operator, x.Rparen, 1)
+	case *syntax.Block:
+		c.addLen(Keyword, x.Lbrace, 1)
+		c.addLen(Keyword, x.Rbrace, 1)
+	case *syntax.IfClause:
+		if x.Elif {
+			c.addLen(Keyword, x.IfPos, 4)
+		} else {
+			c.addLen(Keyword, x.IfPos, 2)
+		}
+		c.addLen(Keyword, x.ThenPos, 4)
+		c.addLen(Keyword, x.ElsePos, 4)
+		c.addLen(Keyword, x.FiPos, 2)
+	case *syntax.WhileClause:
+		c.addLen(Keyword, x.WhilePos, 5)
+		c.addLen(Keyword, x.DoPos, 2)
+		c.addLen(Keyword, x.DonePos, 4)
+	case *syntax.ForClause:
+		if x.Select {
+			c.addLen(Keyword, x.ForPos, 6)
+		} else {
+			c.addLen(Keyword, x.ForPos, 3)
+		}
+		c.addLen(Keyword, x.DoPos, 2)
+		c.addLen(Keyword, x.DonePos, 4)
+		if wi, ok := x.Loop.(*syntax.WordIter); ok {
+			c.findWord(wi.Name.End().Offset(), x.DoPos.Offset(), "in")
+		}
+	case *syntax.WordIter:
+		c.addNode(Variable, x.Name)
+	case *syntax.CStyleLoop:
+		c.addLen(Operator, x.Lparen, 2)
+		c.addLen(Operator, x.Rparen, 2)
+		c.arithmVar(x.Init)
+		c.arithmVar(x.Cond)
+		c.arithmVar(x.Post)
+	case *syntax.BinaryCmd:
+		c.addLen(Operator, x.OpPos, len(x.Op.String()))
+	case *syntax.FuncDecl:
+		if x.RsrvWord {
+			c.addLen(Keyword, x.Position, len("function"))
+		}
+	case *syntax.AnonFunc:
+		if x.RsrvWord {
+			c.addLen(Keyword, x.Position, len("function"))
+		}
+	case *syntax.SglQuoted, *syntax.DblQuoted:
+		c.addNode(String, x)
+	case *syntax.CmdSubst:
+		switch {
+		case c.hasPrefix(x.Left, "`"):
+			c.addLen(Expansion, x.Left, 1)
+		case c.hasPrefix(x.Left, "${|"):
+			c.addLen(Expansion, x.Left, 3)
+		default: // $( or ${
+			c.addLen(Expansion, x.Left, 2)
+		}
+		c.addLen(Expansion, x.Right, 1)
+	case *syntax.ParamExp:
+		c.addNode(Expansion, x)
+		if x.Param != nil {
+			c.addNode(Variable, x.Param)
+		}
+	case *syntax.ArithmExp:
+		if x.Bracket {
+			c.addLen(Expansion, x.Left, 2)
+		} else {
+			c.addLen(Expansion, x.Left, 3)
+		}
+		c.add(Expansion, x.Right.Offset(), x.End().Offset())
+		c.arithmVar(x.X)
+	case *syntax.ArithmCmd:
+		c.addLen(Operator, x.Left, 2)
+		c.addLen(Operator, x.Right, 2)
+		c.arithmVar(x.X)
+	case *syntax.BinaryArithm:
+		c.addLen(Operator, x.OpPos, len(x.Op.String()))
+		c.arithmVar(x.X)
+		c.arithmVar(x.Y)
+	case *syntax.UnaryArithm:
+		c.addLen(Operator, x.OpPos, len(x.Op.String()))
+		c.arithmVar(x.X)
+	case *syntax.ParenArithm:
+		c.addLen(Operator, x.Lparen, 1)
+		c.addLen(Operator, x.Rparen, 1)
+		c.arithmVar(x.X)
+	case *syntax.CaseClause:
+		c.addLen(Keyword, x.Case, 4)
+		c.addLen(Keyword, x.Esac, 4)
+		to := x.Esac.Offset()
+		if len(x.Items) > 0 {
+			to = x.Items[0].Pos().Offset()
+		}
+		c.findWord(x.Word.End().Offset(), to, "in")
+	case *syntax.CaseItem:
+		c.addLen(Operator, x.OpPos, len(x.Op.String()))
+	case *syntax.TestClause:
+		c.addLen(Keyword, x.Left, 2)
+		c.addLen(Keyword, x.Right, 2)
+	case *syntax.BinaryTest:
+		c.addLen(Operator, x.OpPos, len(x.Op.String()))
+	case *syntax.UnaryTest:
+		c.addLen(Operator, x.OpPos, len(x.Op.String()))
+	case *syntax.ParenTest:
+		c.addLen(Operator, x.Lparen, 1)
+		c.addLen(Operator, x.Rparen, 1)
+	case *syntax.DeclClause:
+		c.addNode(Builtin, x.Variant)
+	case *syntax.ArrayExpr:
+		c.addLen(Operator, x.Lparen, 1)
+		c.addLen(Operator, x.Rparen, 1)
+	case *syntax.ExtGlob:
+		c.addLen(Operator, x.OpPos, 2)
+		c.addLen(Operator, x.Pattern.End(), 1)
+	case *syntax.ProcSubst:
+		c.addLen(Expansion, x.OpPos, 2)
+		c.addLen(Expansion, x.Rparen, 1)
+	case *syntax.TimeClause:
+		c.addLen(Keyword, x.Time, 4)
+	case *syntax.CoprocClause:
+		c.addLen(Keyword, x.Coproc, 6)
+	case *syntax.NamespaceClause:
+		c.addLen(Keyword, x.Namespace, 9)
+		c.addLen(Keyword, x.Lbrace, 1)
+		c.addLen(Keyword, x.Rbrace, 1)
+	case *syntax.LetClause:
+		c.addLen(Builtin, x.Let, 3)
+		for _, expr := range x.Exprs {
+			c.arithmVar(expr)
+		}
+	}
+	return true
+}
+
+// arithmVar classifies an arithmetic operand as a variable if it is a
+// name, like x in $((x + 1)).
+func (c *collector) arithmVar(expr syntax.ArithmExpr) {
+	w, ok := expr.(*syntax.Word)
+	if !ok || len(w.Parts) != 1 {
+		return
+	}
+	if lit, ok := w.Parts[0].(*syntax.Lit); ok && syntax.ValidName(lit.Value) {
+		c.addNode(Variable, lit)
+	}
+}
+
+// flatten sorts spans and removes their overlaps, splitting outer spans
+// around the inner spans they contain.
+func flatten(spans []Span) []Span {
+	sort.SliceStable(spans, func(i, j int) bool {
+		if spans[i].Start != spans[j].Start {
+			return spans[i].Start < spans[j].Start
+		}
+		return spans[i].End > spans[j].End
+	})
+	type open struct {
+		Span
+		cur uint // where the uncovered part of the span starts
+	}
+	var res []Span
+	emit := func(kind Kind, start, end uint) {
+		if start >= end {
+			return
+		}
+		res = append(res, Span{Kind: kind, Start: start, End: end})
+	}
+	var stack []*open
+	pop := func() {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		emit(top.Kind, top.cur, top.End)
+		if len(stack) > 0 {
+			stack[len(stack)-1].cur = top.End
+		}
+	}
+	for _, s := range spans {
+		for len(stack) > 0 && stack[len(stack)-1].End <= s.Start {
+			pop()
+		}
+		if len(stack) > 0 {
+			top := stack[len(stack)-1]
+			emit(top.Kind, top.cur, s.Start)
+			top.cur = s.Start
+			if s.End > top.End {
+				s.End = top.End // only allow proper nesting
+			}
+		}
+		stack = append(stack, &open{Span: s, cur: s.Start})
+	}
+	for len(stack) > 0 {
+		pop()
+	}
+	return res
+}
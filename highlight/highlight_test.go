@@ -0,0 +1,111 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package highlight
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+var spansTests = []struct {
+	src  string
+	want []string
+}{
+	{"foo bar", nil},
+	{"echo foo # bar", []string{"builtin:echo", "comment:# bar"}},
+	{"foo 'a' \"b\" $'c'", []string{"string:'a'", `string:"b"`, "string:$'c'"}},
+	{"echo \"a $b c\"", []string{
+		"builtin:echo", `string:"a `, "expansion:$", "variable:b", `string: c"`,
+	}},
+	{"x=${y:-z}", []string{
+		"variable:x", "expansion:${", "variable:y", "expansion::-z}",
+	}},
+	{"a $(b) `c` $((1 + 2))", []string{
+		"expansion:$(", "expansion:)", "expansion:`", "expansion:`",
+		"expansion:$((", "operator:+", "expansion:))",
+	}},
+	{"if a; then b; elif c; then d; else e; fi", []string{
+		"keyword:if", "operator:;", "keyword:then", "operator:;",
+		"keyword:elif", "operator:;", "keyword:then", "operator:;",
+		"keyword:else", "operator:;", "keyword:fi",
+	}},
+	{"for i in a b; do c; done", []string{
+		"keyword:for", "variable:i", "keyword:in", "keyword:do", "operator:;", "keyword:done",
+	}},
+	{"until a\ndo b\ndone", []string{"keyword:until", "keyword:do", "keyword:done"}},
+	{"case $x in a | b) c ;; esac", []string{
+		"keyword:case", "expansion:$", "variable:x", "keyword:in",
+		"operator:;;", "keyword:esac",
+	}},
+	{"! a && b || c | d |& e &", []string{
+		"keyword:!", "operator:&&", "operator:||", "operator:|",
+		"operator:|&", "operator:&",
+	}},
+	{"foo >out 2>&1 <<EOF\nbody $x\nEOF", []string{
+		"operator:>", "operator:>&", "operator:<<",
+		"string:body ", "expansion:$", "variable:x", "string:\n",
+	}},
+	{"function f { (a); }", []string{
+		"keyword:function", "keyword:{", "operator:(", "operator:)",
+		"operator:;", "keyword:}",
+	}},
+	{"[[ -f a && b == c ]]", []string{
+		"keyword:[[", "operator:-f", "operator:&&", "operator:==", "keyword:]]",
+	}},
+	{"declare -a x=(1 2); let y=3; ((z++))", []string{
+		"builtin:declare", "variable:x", "operator:(", "operator:)",
+		"operator:;", "builtin:let", "variable:y", "operator:=",
+		"operator:;", "operator:((", "variable:z", "operator:++",
+		"operator:))",
+	}},
+	{"diff <(a) @(b|c)", []string{
+		"expansion:<(", "expansion:)", "operator:@(", "operator:)",
+	}},
+	{"time coproc a", []string{"keyword:time", "keyword:coproc"}},
+}
+
+func TestSpans(t *testing.T) {
+	t.Parallel()
+	for i, tc := range spansTests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			src := []byte(tc.src)
+			spans, err := Parse(src, syntax.LangBash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, s := range spans {
+				got = append(got, fmt.Sprintf("%s:%s", s.Kind, src[s.Start:s.End]))
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("Spans mismatch in %q:\nwant: %q\ngot:  %q",
+					tc.src, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestFlatten(t *testing.T) {
+	t.Parallel()
+	got := flatten([]Span{
+		{String, 0, 10},
+		{Variable, 3, 4},
+		{Expansion, 2, 6},
+		{Comment, 12, 14},
+	})
+	want := []Span{
+		{String, 0, 2},
+		{Expansion, 2, 3},
+		{Variable, 3, 4},
+		{Expansion, 4, 6},
+		{String, 6, 10},
+		{Comment, 12, 14},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("flatten mismatch:\nwant: %v\ngot:  %v", want, got)
+	}
+}
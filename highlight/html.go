@@ -0,0 +1,33 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package highlight
+
+import (
+	"bufio"
+	"html"
+	"io"
+)
+
+// HTML writes src to w as HTML, wrapping each of its spans, as returned
+// by Spans, in an element like <span class="keyword">. The rest of the
+// source is written as escaped text.
+//
+// The output is not wrapped in any element, so it is usually placed
+// inside a <pre> element, and styled via CSS rules for each of the kind
+// classes.
+func HTML(w io.Writer, src []byte, spans []Span) error {
+	bw := bufio.NewWriter(w)
+	last := uint(0)
+	for _, s := range spans {
+		bw.WriteString(html.EscapeString(string(src[last:s.Start])))
+		bw.WriteString(`<span class="`)
+		bw.WriteString(s.Kind.String())
+		bw.WriteString(`">`)
+		bw.WriteString(html.EscapeString(string(src[s.Start:s.End])))
+		bw.WriteString("</span>")
+		last = s.End
+	}
+	bw.WriteString(html.EscapeString(string(src[last:])))
+	return bw.Flush()
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package highlight
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+var htmlTests = []struct {
+	src  string
+	want string
+}{
+	{"", ""},
+	{"foo bar\n", "foo bar\n"},
+	{
+		"echo \"<$x>\" && a # 'c'\n",
+		`<span class="builtin">echo</span> <span class="string">&#34;&lt;</span>` +
+			`<span class="expansion">$</span><span class="variable">x</span>` +
+			`<span class="string">&gt;&#34;</span> <span class="operator">&amp;&amp;</span>` +
+			` a <span class="comment"># &#39;c&#39;</span>` + "\n",
+	},
+	{
+		"if true; then :; fi",
+		`<span class="keyword">if</span> <span class="builtin">true</span>` +
+			`<span class="operator">;</span> <span class="keyword">then</span> ` +
+			`<span class="builtin">:</span><span class="operator">;</span> ` +
+			`<span class="keyword">fi</span>`,
+	},
+}
+
+func TestHTML(t *testing.T) {
+	t.Parallel()
+	for i, tc := range htmlTests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			src := []byte(tc.src)
+			spans, err := Parse(src, syntax.LangBash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := HTML(&buf, src, spans); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tc.want {
+				t.Fatalf("HTML mismatch in %q:\nwant: %q\ngot:  %q",
+					tc.src, tc.want, got)
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"mvdan.cc/sh/syntax"
 )
@@ -14,31 +15,21 @@ import (
 func (r *Runner) arithm(ctx context.Context, expr syntax.ArithmExpr) int {
 	switch x := expr.(type) {
 	case *syntax.Word:
-		str := r.loneWord(ctx, x)
-		// recursively fetch vars
-		for str != "" {
-			val := r.getVar(str)
-			if val == "" {
-				break
-			}
-			str = val
-		}
-		// default to 0
-		return atoi(str)
+		return r.arithmStr(ctx, r.loneWord(ctx, x))
 	case *syntax.ParenArithm:
 		return r.arithm(ctx, x.X)
 	case *syntax.UnaryArithm:
 		switch x.Op {
 		case syntax.Inc, syntax.Dec:
-			name := x.X.(*syntax.Word).Parts[0].(*syntax.Lit).Value
-			old := atoi(r.getVar(name))
+			name, index := r.arithmName(ctx, x.X)
+			old := r.arithmStr(ctx, r.arithmVar(ctx, name, index))
 			val := old
 			if x.Op == syntax.Inc {
 				val++
 			} else {
 				val--
 			}
-			r.setVarString(ctx, name, strconv.Itoa(val))
+			r.setArithmVar(ctx, name, index, val)
 			if x.Post {
 				return old
 			}
@@ -63,10 +54,15 @@ func (r *Runner) arithm(ctx context.Context, expr syntax.ArithmExpr) int {
 		case syntax.Quest: // Colon can't happen here
 			cond := r.arithm(ctx, x.X)
 			b2 := x.Y.(*syntax.BinaryArithm) // must have Op==Colon
-			if cond == 1 {
+			if cond != 0 {
 				return r.arithm(ctx, b2.X)
 			}
 			return r.arithm(ctx, b2.Y)
+		case syntax.AndArit:
+			// the right side is only evaluated if needed
+			return oneIf(r.arithm(ctx, x.X) != 0 && r.arithm(ctx, x.Y) != 0)
+		case syntax.OrArit:
+			return oneIf(r.arithm(ctx, x.X) != 0 || r.arithm(ctx, x.Y) != 0)
 		}
 		return binArit(x.Op, r.arithm(ctx, x.X), r.arithm(ctx, x.Y))
 	default:
@@ -88,9 +84,169 @@ func atoi(s string) int {
 	return n
 }
 
+// arithmStr evaluates a string found in an arithmetic expression, such as a
+// word or the value of a variable. Like in Bash, it may be a number in any
+// base, the name of another variable, or an arithmetic expression itself.
+func (r *Runner) arithmStr(ctx context.Context, str string) int {
+	str = strings.TrimSpace(str)
+	switch {
+	case str == "":
+		return 0
+	case str[0] >= '0' && str[0] <= '9' && strings.IndexFunc(str, notNumRune) < 0:
+		n, err := arithmNum(str)
+		if err != nil {
+			r.arithmErr(str, "invalid number")
+		}
+		return n
+	case r.arithmDepth > maxNameRefDepth:
+		r.arithmErr(str, "expression recursion level exceeded")
+		return 0
+	}
+	r.arithmDepth++
+	defer func() { r.arithmDepth-- }()
+	if syntax.ValidName(str) {
+		return r.arithmStr(ctx, r.getVar(str))
+	}
+	expr := parseArithm(str)
+	if expr == nil {
+		r.arithmErr(str, "syntax error in expression")
+		return 0
+	}
+	return r.arithm(ctx, expr)
+}
+
+func notNumRune(r rune) bool {
+	switch {
+	case r >= '0' && r <= '9', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		return false
+	}
+	return r != '#' && r != '@' && r != '_'
+}
+
+func (r *Runner) arithmErr(str, msg string) {
+	r.errf("%s: %s\n", str, msg)
+	r.setErr(ShellExitStatus(1))
+}
+
+// parseArithm parses str as an arithmetic expression, returning nil if it
+// isn't valid. Expansions other than plain parameters are not allowed, so
+// that the values of variables can't run commands.
+func parseArithm(str string) syntax.ArithmExpr {
+	f, err := syntax.NewParser().Parse(strings.NewReader("(("+str+"))"), "")
+	if err != nil || len(f.Stmts) != 1 {
+		return nil
+	}
+	cmd, ok := f.Stmts[0].Cmd.(*syntax.ArithmCmd)
+	if !ok {
+		return nil
+	}
+	valid := true
+	syntax.Walk(cmd, func(node syntax.Node) bool {
+		if w, ok := node.(*syntax.Word); ok {
+			for _, part := range w.Parts {
+				switch part.(type) {
+				case *syntax.Lit, *syntax.ParamExp:
+				default:
+					valid = false
+				}
+			}
+		}
+		return valid
+	})
+	if !valid {
+		return nil
+	}
+	return cmd.X
+}
+
+// arithmNum parses an integer constant as found in arithmetic expressions;
+// decimal, octal with a leading 0, hexadecimal with a leading 0x, or in
+// any base from 2 to 64 like "2#1011".
+func arithmNum(s string) (int, error) {
+	base := 10
+	switch {
+	case strings.HasPrefix(s, "0x"), strings.HasPrefix(s, "0X"):
+		base, s = 16, s[2:]
+	case strings.Contains(s, "#"):
+		i := strings.Index(s, "#")
+		n, err := strconv.Atoi(s[:i])
+		if err != nil || n < 2 || n > 64 {
+			return 0, fmt.Errorf("invalid arithmetic base: %s", s[:i])
+		}
+		base, s = n, s[i+1:]
+	case len(s) > 1 && s[0] == '0':
+		base, s = 8, s[1:]
+	}
+	if s == "" {
+		return 0, fmt.Errorf("missing digits")
+	}
+	if base <= 36 {
+		n, err := strconv.ParseInt(s, base, 64)
+		return int(n), err
+	}
+	n := 0
+	for _, c := range s {
+		var d int
+		switch {
+		case c >= '0' && c <= '9':
+			d = int(c - '0')
+		case c >= 'a' && c <= 'z':
+			d = int(c-'a') + 10
+		case c >= 'A' && c <= 'Z':
+			d = int(c-'A') + 36
+		case c == '@':
+			d = 62
+		case c == '_':
+			d = 63
+		default:
+			d = base
+		}
+		if d >= base {
+			return 0, fmt.Errorf("value too great for base: %c", c)
+		}
+		n = n*base + d
+	}
+	return n, nil
+}
+
+// arithmName returns the variable name and index, if any, of an expression
+// that is being assigned to. The parser makes sure it is a name.
+func (r *Runner) arithmName(ctx context.Context, expr syntax.ArithmExpr) (string, syntax.ArithmExpr) {
+	switch x := expr.(*syntax.Word).Parts[0].(type) {
+	case *syntax.ParamExp:
+		name, index := x.Param.Value, x.Index
+		if vr, _ := r.lookupVar(name); index != nil {
+			if _, ok := vr.Value.(AssocArray); !ok {
+				// only evaluate the index once, as in a[i++]+=1
+				index = &syntax.Word{Parts: []syntax.WordPart{
+					&syntax.Lit{Value: strconv.Itoa(r.arithm(ctx, index))},
+				}}
+			}
+		}
+		return name, index
+	default:
+		return x.(*syntax.Lit).Value, nil
+	}
+}
+
+func (r *Runner) arithmVar(ctx context.Context, name string, index syntax.ArithmExpr) string {
+	vr, _ := r.lookupVar(name)
+	if index == nil {
+		return r.varStr(vr, 0)
+	}
+	return r.varInd(ctx, vr, index, 0)
+}
+
+func (r *Runner) setArithmVar(ctx context.Context, name string, index syntax.ArithmExpr, val int) {
+	r.setVar(ctx, name, index, Variable{Value: StringVal(strconv.Itoa(val))})
+}
+
 func (r *Runner) assgnArit(ctx context.Context, b *syntax.BinaryArithm) int {
-	name := b.X.(*syntax.Word).Parts[0].(*syntax.Lit).Value
-	val := atoi(r.getVar(name))
+	name, index := r.arithmName(ctx, b.X)
+	val := 0
+	if b.Op != syntax.Assgn {
+		val = r.arithmStr(ctx, r.arithmVar(ctx, name, index))
+	}
 	arg := r.arithm(ctx, b.Y)
 	switch b.Op {
 	case syntax.Assgn:
@@ -116,7 +272,7 @@ func (r *Runner) assgnArit(ctx context.Context, b *syntax.BinaryArithm) int {
 	case syntax.ShrAssgn:
 		val >>= uint(arg)
 	}
-	r.setVarString(ctx, name, strconv.Itoa(val))
+	r.setArithmVar(ctx, name, index, val)
 	return val
 }
 
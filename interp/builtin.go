@@ -4,9 +4,11 @@
 package interp
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -16,6 +18,8 @@ import (
 	"mvdan.cc/sh/syntax"
 )
 
+// isBuiltin returns whether name is one of the builtins implemented by
+// the interpreter, which are a subset of those in syntax.IsBuiltin.
 func isBuiltin(name string) bool {
 	switch name {
 	case "true", ":", "false", "exit", "set", "shift", "unset",
@@ -23,7 +27,7 @@ func isBuiltin(name string) bool {
 		"wait", "builtin", "trap", "type", "source", ".", "command",
 		"dirs", "pushd", "popd", "umask", "alias", "unalias",
 		"fg", "bg", "getopts", "eval", "test", "[", "exec",
-		"return", "read", "shopt":
+		"return", "read", "mapfile", "readarray", "shopt":
 		return true
 	}
 	return false
@@ -60,20 +64,24 @@ func (r *Runner) builtinCode(ctx context.Context, pos syntax.Pos, name string, a
 		switch len(args) {
 		case 0:
 		case 1:
-			if n2, err := strconv.Atoi(args[0]); err == nil {
-				n = n2
-				break
+			n2, err := strconv.Atoi(args[0])
+			if err != nil {
+				r.errf("shift: %s: numeric argument required\n", args[0])
+				return 1
 			}
-			fallthrough
+			n = n2
 		default:
 			r.errf("usage: shift [n]\n")
 			return 2
 		}
-		if n >= len(r.Params) {
-			r.Params = nil
-		} else {
-			r.Params = r.Params[n:]
+		switch {
+		case n < 0:
+			r.errf("shift: %d: shift count out of range\n", n)
+			return 1
+		case n > len(r.Params):
+			return 1
 		}
+		r.Params = r.Params[n:]
 	case "unset":
 		vars := true
 		funcs := true
@@ -127,58 +135,77 @@ func (r *Runner) builtinCode(ctx context.Context, pos syntax.Pos, name string, a
 			r.out("\n")
 		}
 	case "printf":
+		varName := ""
+		if len(args) > 1 && args[0] == "-v" {
+			if varName = args[1]; !syntax.ValidName(varName) {
+				r.errf("printf: invalid variable name: %q\n", varName)
+				return 2
+			}
+			args = args[2:]
+		}
+		if len(args) > 0 && args[0] == "--" {
+			args = args[1:]
+		}
 		if len(args) == 0 {
-			r.errf("usage: printf format [arguments]\n")
+			r.errf("usage: printf [-v var] format [arguments]\n")
 			return 2
 		}
 		format, args := args[0], args[1:]
+		var out bytes.Buffer
+		status := 0
 		for {
 			n, s, err := r.expandFormat(format, args)
-			if err != nil {
+			if err == errInvalidNum {
+				status = 1
+			} else if err != nil {
 				r.errf("%v\n", err)
 				return 1
 			}
-			r.out(s)
+			if varName != "" {
+				out.WriteString(s)
+			} else {
+				r.out(s)
+			}
 			args = args[n:]
 			if n == 0 || len(args) == 0 {
 				break
 			}
 		}
-	case "break":
-		if !r.inLoop {
-			r.errf("break is only useful in a loop")
+		if varName != "" {
+			r.setVarString(ctx, varName, out.String())
+		}
+		return status
+	case "break", "continue":
+		if r.loopDepth == 0 {
+			r.errf("%s is only useful in a loop\n", name)
 			break
 		}
+		n := 1
 		switch len(args) {
 		case 0:
-			r.breakEnclosing = 1
 		case 1:
-			if n, err := strconv.Atoi(args[0]); err == nil {
-				r.breakEnclosing = n
+			var err error
+			if n, err = strconv.Atoi(args[0]); err == nil {
 				break
 			}
 			fallthrough
 		default:
-			r.errf("usage: break [n]\n")
+			r.errf("usage: %s [n]\n", name)
 			return 2
 		}
-	case "continue":
-		if !r.inLoop {
-			r.errf("continue is only useful in a loop")
-			break
+		if n < 1 {
+			// like bash, leave all loops
+			r.errf("%s: %d: loop count out of range\n", name, n)
+			r.breakEnclosing = r.loopDepth
+			return 1
 		}
-		switch len(args) {
-		case 0:
-			r.contnEnclosing = 1
-		case 1:
-			if n, err := strconv.Atoi(args[0]); err == nil {
-				r.contnEnclosing = n
-				break
-			}
-			fallthrough
-		default:
-			r.errf("usage: continue [n]\n")
-			return 2
+		if n > r.loopDepth {
+			n = r.loopDepth
+		}
+		if name == "break" {
+			r.breakEnclosing = n
+		} else {
+			r.contnEnclosing = n
 		}
 	case "pwd":
 		r.outf("%s\n", r.getVar("PWD"))
@@ -193,7 +220,7 @@ func (r *Runner) builtinCode(ctx context.Context, pos syntax.Pos, name string, a
 			r.errf("usage: cd [dir]\n")
 			return 2
 		}
-		return r.changeDir(path)
+		return r.changeDir(ctx, path)
 	case "wait":
 		if len(args) > 0 {
 			panic("wait with args not handled yet")
@@ -213,6 +240,8 @@ func (r *Runner) builtinCode(ctx context.Context, pos syntax.Pos, name string, a
 			return 1
 		}
 		return r.builtinCode(ctx, pos, args[0], args[1:])
+	case "trap":
+		return r.trap(args)
 	case "type":
 		anyNotFound := false
 		for _, arg := range args {
@@ -242,7 +271,9 @@ func (r *Runner) builtinCode(ctx context.Context, pos syntax.Pos, name string, a
 			r.errf("eval: %v\n", err)
 			return 1
 		}
+		r.traceDepth++
 		r.stmts(ctx, file.StmtList)
+		r.traceDepth--
 		return r.exit
 	case "source", ".":
 		if len(args) < 1 {
@@ -261,14 +292,20 @@ func (r *Runner) builtinCode(ctx context.Context, pos syntax.Pos, name string, a
 			r.errf("source: %v\n", err)
 			return 1
 		}
+		if r.Coverage != nil {
+			r.Coverage.addFile(file)
+		}
 		oldParams := r.Params
 		r.Params = args[1:]
 		oldInSource := r.inSource
 		r.inSource = true
+		oldFilename := r.filename
+		r.filename = file.Name
 		r.stmts(ctx, file.StmtList)
 
 		r.Params = oldParams
 		r.inSource = oldInSource
+		r.filename = oldFilename
 		if code, ok := r.err.(returnStatus); ok {
 			r.err = nil
 			r.exit = int(code)
@@ -373,13 +410,13 @@ func (r *Runner) builtinCode(ctx context.Context, pos syntax.Pos, name string, a
 				return 1
 			}
 			newtop := swap()
-			if code := r.changeDir(newtop); code != 0 {
+			if code := r.changeDir(ctx, newtop); code != 0 {
 				return code
 			}
 			r.builtinCode(ctx, syntax.Pos{}, "dirs", nil)
 		case 1:
 			if change {
-				if code := r.changeDir(args[0]); code != 0 {
+				if code := r.changeDir(ctx, args[0]); code != 0 {
 					return code
 				}
 				r.dirStack = append(r.dirStack, r.Dir)
@@ -408,7 +445,7 @@ func (r *Runner) builtinCode(ctx context.Context, pos syntax.Pos, name string, a
 			r.dirStack = r.dirStack[:len(r.dirStack)-1]
 			if change {
 				newtop := r.dirStack[len(r.dirStack)-1]
-				if code := r.changeDir(newtop); code != 0 {
+				if code := r.changeDir(ctx, newtop); code != 0 {
 					return code
 				}
 			} else {
@@ -436,15 +473,33 @@ func (r *Runner) builtinCode(ctx context.Context, pos syntax.Pos, name string, a
 		r.setErr(returnStatus(code))
 	case "read":
 		raw := false
-		for len(args) > 0 && strings.HasPrefix(args[0], "-") {
-			switch args[0] {
-			case "-r":
-				raw = true
-			default:
-				r.errf("read: invalid option %q\n", args[0])
-				return 2
-			}
+		array := ""
+		for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+			opts := args[0][1:]
 			args = args[1:]
+			for i := 0; i < len(opts); i++ {
+				switch opts[i] {
+				case 'r':
+					raw = true
+				case 'a':
+					// like -ra arr or -aarr
+					if i+1 < len(opts) {
+						array = opts[i+1:]
+					} else if len(args) > 0 {
+						array, args = args[0], args[1:]
+					} else {
+						r.errf("read: -a: option requires an argument\n")
+						return 2
+					}
+					i = len(opts)
+				default:
+					r.errf("read: invalid option %q\n", "-"+opts[i:i+1])
+					return 2
+				}
+			}
+		}
+		if array != "" {
+			args = []string{array}
 		}
 
 		for _, name := range args {
@@ -458,11 +513,18 @@ func (r *Runner) builtinCode(ctx context.Context, pos syntax.Pos, name string, a
 		if err != nil {
 			return 1
 		}
-		if len(args) == 0 {
+		if array != "" {
+			values := r.ifsFields(string(line), -1, raw)
+			r.setVar(ctx, array, nil, Variable{Value: IndexArray(values)})
+			return 0
+		}
+		n := len(args)
+		if n == 0 {
+			// REPLY gets the entire line
 			args = append(args, "REPLY")
 		}
 
-		values := r.ifsFields(string(line), len(args), raw)
+		values := r.ifsFields(string(line), n, raw)
 		for i, name := range args {
 			val := ""
 			if i < len(values) {
@@ -473,6 +535,52 @@ func (r *Runner) builtinCode(ctx context.Context, pos syntax.Pos, name string, a
 
 		return 0
 
+	case "mapfile", "readarray":
+		trim := false
+		for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+			switch args[0] {
+			case "-t":
+				trim = true
+			default:
+				r.errf("%s: invalid option %q\n", name, args[0])
+				return 2
+			}
+			args = args[1:]
+		}
+		array := "MAPFILE"
+		switch len(args) {
+		case 0:
+		case 1:
+			array = args[0]
+		default:
+			r.errf("%s: usage: %s [-t] [array]\n", name, name)
+			return 2
+		}
+		if !syntax.ValidName(array) {
+			r.errf("%s: invalid identifier %q\n", name, array)
+			return 2
+		}
+		data, err := ioutil.ReadAll(r.Stdin)
+		if err != nil {
+			r.errf("%s: %v\n", name, err)
+			return 1
+		}
+		var lines IndexArray
+		for len(data) > 0 {
+			i := bytes.IndexByte(data, '\n') + 1
+			if i == 0 {
+				i = len(data)
+			}
+			line := string(data[:i])
+			if trim {
+				line = strings.TrimSuffix(line, "\n")
+			}
+			lines = append(lines, line)
+			data = data[i:]
+		}
+		r.setVar(ctx, array, nil, Variable{Value: lines})
+		return 0
+
 	case "getopts":
 		if len(args) < 2 {
 			r.errf("getopts: usage: getopts optstring name [arg]\n")
@@ -561,7 +669,7 @@ func (r *Runner) builtinCode(ctx context.Context, pos syntax.Pos, name string, a
 		}
 
 	default:
-		// "trap", "umask", "alias", "unalias", "fg", "bg",
+		// "umask", "alias", "unalias", "fg", "bg",
 		panic(fmt.Sprintf("unhandled builtin: %s", name))
 	}
 	return 0
@@ -575,6 +683,9 @@ func (r *Runner) printOptLine(name string, enabled bool) {
 	r.outf("%s\t%s\n", name, status)
 }
 
+// ifsFields splits s into at most n fields, the last one holding the rest of
+// the line. If n is -1, there is no limit. If n is 0, s is kept as a single
+// field, including any leading and trailing IFS characters.
 func (r *Runner) ifsFields(s string, n int, raw bool) []string {
 	type pos struct {
 		start, end int
@@ -614,10 +725,21 @@ func (r *Runner) ifsFields(s string, n int, raw bool) []string {
 	}
 
 	switch {
-	case n == 1:
+	case n == 0:
 		// include heading/trailing IFSs
 		fpos[0].start, fpos[0].end = 0, len(runes)
 		fpos = fpos[:1]
+	case n == 1:
+		// include heading/trailing IFSs, except whitespace
+		start, end := 0, len(runes)
+		for start < fpos[0].start && isSpace(runes[start]) {
+			start++
+		}
+		for end > fpos[len(fpos)-1].end && isSpace(runes[end-1]) {
+			end--
+		}
+		fpos[0].start, fpos[0].end = start, end
+		fpos = fpos[:1]
 	case n != -1 && n < len(fpos):
 		// combine to max n fields
 		fpos[n-1].end = fpos[len(fpos)-1].end
@@ -631,6 +753,8 @@ func (r *Runner) ifsFields(s string, n int, raw bool) []string {
 	return fields
 }
 
+func isSpace(r rune) bool { return r == ' ' || r == '\t' || r == '\n' }
+
 func (r *Runner) readLine(raw bool) ([]byte, error) {
 	var line []byte
 	esc := false
@@ -664,9 +788,9 @@ func (r *Runner) readLine(raw bool) ([]byte, error) {
 	}
 }
 
-func (r *Runner) changeDir(path string) int {
+func (r *Runner) changeDir(ctx context.Context, path string) int {
 	path = r.relPath(path)
-	info, err := r.stat(path)
+	info, err := r.stat(ctx, path, true)
 	if err != nil || !info.IsDir() {
 		return 1
 	}
@@ -0,0 +1,172 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package interp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// Coverage records how many times each statement of the interpreted files
+// is run, to report which parts of shell programs are exercised by a test
+// suite. Files are tracked from the moment they are run or sourced, so
+// their statements that never run are reported too. Code run via eval is
+// not tracked.
+//
+// The zero value is ready to use, and may be shared by many runners, even
+// concurrently. To record coverage, set Runner.Coverage.
+type Coverage struct {
+	mu    sync.Mutex
+	files map[string]*coverFile
+	stmts map[*syntax.Stmt]*coverBlock
+}
+
+type coverFile struct {
+	blocks map[uint]*coverBlock // by start offset
+}
+
+type coverBlock struct {
+	start, end syntax.Pos
+	count      int
+}
+
+// addFile starts tracking the statements in f. Since blocks are keyed by
+// position, a file that is parsed and run many times, such as a sourced
+// library, accumulates counts in the same blocks.
+func (c *Coverage) addFile(f *syntax.File) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.files == nil {
+		c.files = make(map[string]*coverFile)
+		c.stmts = make(map[*syntax.Stmt]*coverBlock)
+	}
+	cf := c.files[f.Name]
+	if cf == nil {
+		cf = &coverFile{blocks: make(map[uint]*coverBlock)}
+		c.files[f.Name] = cf
+	}
+	syntax.Walk(f, func(node syntax.Node) bool {
+		st, ok := node.(*syntax.Stmt)
+		if !ok {
+			return true
+		}
+		if _, ok := c.stmts[st]; ok {
+			return false // already tracked
+		}
+		b := cf.blocks[st.Pos().Offset()]
+		if b == nil {
+			end := stmtEnd(st)
+			if end.Offset() == st.Pos().Offset() {
+				// e.g. "a && b", whose block would be empty
+				return true
+			}
+			b = &coverBlock{start: st.Pos(), end: end}
+			cf.blocks[st.Pos().Offset()] = b
+		}
+		c.stmts[st] = b
+		return true
+	})
+}
+
+// stmtEnd returns where the block of a statement ends. Compound commands
+// end at the first statement they contain, so that blocks don't overlap.
+func stmtEnd(st *syntax.Stmt) syntax.Pos {
+	switch st.Cmd.(type) {
+	case nil, *syntax.CallExpr, *syntax.DeclClause, *syntax.ArithmCmd,
+		*syntax.TestClause, *syntax.LetClause:
+		return st.End()
+	}
+	end := st.End()
+	syntax.Walk(st.Cmd, func(node syntax.Node) bool {
+		if st2, ok := node.(*syntax.Stmt); ok && end.After(st2.Pos()) {
+			end = st2.Pos()
+		}
+		return true
+	})
+	return end
+}
+
+func (c *Coverage) hit(st *syntax.Stmt) {
+	c.mu.Lock()
+	if b := c.stmts[st]; b != nil {
+		b.count++
+	}
+	c.mu.Unlock()
+}
+
+// sortedFiles returns the tracked files sorted by name, each with its
+// blocks sorted by position.
+func (c *Coverage) sortedFiles() (names []string, blocks [][]*coverBlock) {
+	for name := range c.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var bs []*coverBlock
+		for _, b := range c.files[name].blocks {
+			bs = append(bs, b)
+		}
+		sort.Slice(bs, func(i, j int) bool {
+			return bs[j].start.After(bs[i].start)
+		})
+		blocks = append(blocks, bs)
+	}
+	return names, blocks
+}
+
+// WriteProfile writes the coverage in the format of Go coverage profiles,
+// in count mode, so that tools like "go tool cover -html" can be used on
+// it. Each statement is a block.
+func (c *Coverage) WriteProfile(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "mode: count")
+	names, blocks := c.sortedFiles()
+	for i, name := range names {
+		for _, b := range blocks[i] {
+			fmt.Fprintf(bw, "%s:%d.%d,%d.%d 1 %d\n", name,
+				b.start.Line(), b.start.Col(),
+				b.end.Line(), b.end.Col(), b.count)
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteLcov writes the coverage in the lcov tracefile format. The count of
+// each line is the highest count of the statements starting on it.
+func (c *Coverage) WriteLcov(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	bw := bufio.NewWriter(w)
+	names, blocks := c.sortedFiles()
+	for i, name := range names {
+		fmt.Fprintf(bw, "TN:\nSF:%s\n", name)
+		var lines []uint
+		counts := make(map[uint]int)
+		for _, b := range blocks[i] {
+			line := b.start.Line()
+			if count, ok := counts[line]; !ok {
+				lines = append(lines, line)
+				counts[line] = b.count
+			} else if b.count > count {
+				counts[line] = b.count
+			}
+		}
+		hit := 0
+		for _, line := range lines {
+			fmt.Fprintf(bw, "DA:%d,%d\n", line, counts[line])
+			if counts[line] > 0 {
+				hit++
+			}
+		}
+		fmt.Fprintf(bw, "LF:%d\nLH:%d\nend_of_record\n", len(lines), hit)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package interp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+var coverCases = []struct {
+	src, profile, lcov string
+}{
+	{
+		"echo foo\nfalse || echo bar",
+		"mode: count\n" +
+			"f.sh:1.1,1.9 1 1\n" +
+			"f.sh:2.1,2.6 1 1\n" +
+			"f.sh:2.10,2.18 1 1\n",
+		"TN:\nSF:f.sh\nDA:1,1\nDA:2,1\nLF:2\nLH:2\nend_of_record\n",
+	},
+	{
+		"if true; then\n\techo yes\nelse\n\techo no\nfi",
+		"mode: count\n" +
+			"f.sh:1.1,1.4 1 1\n" +
+			"f.sh:1.4,1.9 1 1\n" +
+			"f.sh:2.2,2.10 1 1\n" +
+			"f.sh:4.2,4.9 1 0\n",
+		"TN:\nSF:f.sh\nDA:1,1\nDA:2,1\nDA:4,0\nLF:3\nLH:2\nend_of_record\n",
+	},
+	{
+		"f() {\n\techo $1\n}\nfor i in 1 2 3; do f $i; done\ng() { :; }",
+		"mode: count\n" +
+			"f.sh:1.1,1.5 1 1\n" +
+			"f.sh:1.5,2.2 1 3\n" +
+			"f.sh:2.2,2.9 1 3\n" +
+			"f.sh:4.1,4.20 1 1\n" +
+			"f.sh:4.20,4.25 1 3\n" +
+			"f.sh:5.1,5.5 1 1\n" +
+			"f.sh:5.5,5.7 1 0\n" +
+			"f.sh:5.7,5.9 1 0\n",
+		"TN:\nSF:f.sh\nDA:1,3\nDA:2,3\nDA:4,3\nDA:5,1\nLF:4\nLH:4\nend_of_record\n",
+	},
+	{
+		"(echo a; exit 1) & wait\necho $(echo b)",
+		"mode: count\n" +
+			"f.sh:1.1,1.2 1 1\n" +
+			"f.sh:1.2,1.9 1 1\n" +
+			"f.sh:1.10,1.16 1 1\n" +
+			"f.sh:1.20,1.24 1 1\n" +
+			"f.sh:2.1,2.15 1 1\n" +
+			"f.sh:2.8,2.14 1 1\n",
+		"TN:\nSF:f.sh\nDA:1,1\nDA:2,1\nLF:2\nLH:2\nend_of_record\n",
+	},
+}
+
+func TestCoverage(t *testing.T) {
+	t.Parallel()
+	p := syntax.NewParser()
+	for i, tc := range coverCases {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			file, err := p.Parse(strings.NewReader(tc.src), "f.sh")
+			if err != nil {
+				t.Fatalf("could not parse: %v", err)
+			}
+			r, _ := New()
+			r.Coverage = &Coverage{}
+			r.Run(context.Background(), file)
+			var buf bytes.Buffer
+			if err := r.Coverage.WriteProfile(&buf); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tc.profile {
+				t.Errorf("want profile:\n%s\ngot:\n%s", tc.profile, got)
+			}
+			buf.Reset()
+			if err := r.Coverage.WriteLcov(&buf); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tc.lcov {
+				t.Errorf("want lcov:\n%s\ngot:\n%s", tc.lcov, got)
+			}
+		})
+	}
+}
+
+func TestCoverageTraps(t *testing.T) {
+	t.Parallel()
+	src := "trap 'echo bye; exit' EXIT\necho hi"
+	file, err := syntax.NewParser(syntax.ParseTraps).Parse(strings.NewReader(src), "f.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	r, _ := New(StdIO(nil, &out, &out))
+	r.Coverage = &Coverage{}
+	r.Run(context.Background(), file)
+	if want := "hi\nbye\n"; out.String() != want {
+		t.Fatalf("want output %q, got %q", want, out.String())
+	}
+	var buf bytes.Buffer
+	if err := r.Coverage.WriteProfile(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "mode: count\n" +
+		"f.sh:1.1,1.27 1 1\n" +
+		"f.sh:1.7,1.16 1 1\n" +
+		"f.sh:1.17,1.21 1 1\n" +
+		"f.sh:2.1,2.8 1 1\n"
+	if got := buf.String(); got != want {
+		t.Errorf("want profile:\n%s\ngot:\n%s", want, got)
+	}
+}
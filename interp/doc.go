@@ -5,6 +5,13 @@
 // programs. It aims to support POSIX, but its support is not complete
 // yet. It also supports some Bash features.
 //
+// The interpreter behaves the same regardless of the locale of the host,
+// as if LC_ALL=C was set, except that strings are UTF-8. Pathname
+// expansions are sorted and the < and > operators of [[ ]] compare strings
+// by their bytes, unless Runner.Collate is set. In patterns, ranges like
+// [a-z] match by code point, and character classes like [[:alpha:]] only
+// match ASCII characters.
+//
 // This package is a work in progress and EXPERIMENTAL; its API is not
 // subject to the 1.x backwards compatibility guarantee.
 package interp
@@ -0,0 +1,87 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package interp
+
+import (
+	"time"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// EventKind is the kind of an Event.
+type EventKind uint8
+
+const (
+	StmtStart EventKind = iota + 1 // a statement starts running
+	Redirect                       // a redirection was applied
+	Expand                         // the arguments of a command were expanded
+	CmdExec                        // a command was run
+	Exit                           // a statement finished running
+)
+
+var eventKindNames = [...]string{
+	StmtStart: "StmtStart",
+	Redirect:  "Redirect",
+	Expand:    "Expand",
+	CmdExec:   "CmdExec",
+	Exit:      "Exit",
+}
+
+func (k EventKind) String() string {
+	if int(k) < len(eventKindNames) && eventKindNames[k] != "" {
+		return eventKindNames[k]
+	}
+	return "EventKind(?)"
+}
+
+// Event describes a step in the execution of a program, as received by
+// Runner.Events. Events allow building timelines or profiles of how a
+// program runs.
+type Event struct {
+	Kind EventKind
+
+	// Node is a *syntax.Stmt for StmtStart and Exit, a *syntax.Redirect
+	// for Redirect, and a *syntax.CallExpr for Expand and CmdExec. Its
+	// position tells where the event comes from.
+	Node syntax.Node
+
+	// Time is when the step started, and Duration is how long it
+	// took. Duration is zero for StmtStart.
+	Time     time.Time
+	Duration time.Duration
+
+	// Fields holds the arguments of the command, for Expand and CmdExec.
+	Fields []string
+
+	// Status is the exit status, for CmdExec and Exit. For Redirect,
+	// it is non-zero if the redirection failed.
+	Status int
+}
+
+// event sends an event to r.Events, which must be non-nil.
+func (r *Runner) event(kind EventKind, node syntax.Node, start time.Time, fields []string, status int) {
+	ev := Event{
+		Kind:   kind,
+		Node:   node,
+		Time:   start,
+		Fields: fields,
+		Status: status,
+	}
+	if kind != StmtStart {
+		ev.Duration = time.Since(start)
+	}
+	r.Events(ev)
+}
+
+// eventStatus returns the exit status for an event, including the status
+// of a pending return or exit.
+func (r *Runner) eventStatus() int {
+	switch x := r.err.(type) {
+	case returnStatus:
+		return int(x)
+	case ShellExitStatus:
+		return int(x)
+	}
+	return r.exit
+}
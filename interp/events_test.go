@@ -0,0 +1,97 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package interp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+var eventsTests = []struct {
+	src  string
+	want []string
+}{
+	{"", nil},
+	{"true", []string{
+		"1:1 StmtStart",
+		"1:1 Expand [true]",
+		"1:1 CmdExec [true] 0",
+		"1:1 Exit 0",
+	}},
+	{"a=b", []string{
+		"1:1 StmtStart",
+		"1:1 Exit 0",
+	}},
+	{"echo foo >/dev/null\nfalse", []string{
+		"1:1 StmtStart",
+		"1:10 Redirect 0",
+		"1:1 Expand [echo foo]",
+		"1:1 CmdExec [echo foo] 0",
+		"1:1 Exit 0",
+		"2:1 StmtStart",
+		"2:1 Expand [false]",
+		"2:1 CmdExec [false] 1",
+		"2:1 Exit 1",
+	}},
+	{"cat <missing", []string{
+		"1:1 StmtStart",
+		"1:5 Redirect 1",
+		"1:1 Exit 1",
+	}},
+	{"f() { return 3; }; f; exit 4", []string{
+		"1:1 StmtStart",
+		"1:1 Exit 0",
+		"1:20 StmtStart",
+		"1:20 Expand [f]",
+		"1:5 StmtStart",
+		"1:7 StmtStart",
+		"1:7 Expand [return 3]",
+		"1:7 CmdExec [return 3] 3",
+		"1:7 Exit 3",
+		"1:5 Exit 3",
+		"1:20 CmdExec [f] 3",
+		"1:20 Exit 3",
+		"1:23 StmtStart",
+		"1:23 Expand [exit 4]",
+		"1:23 CmdExec [exit 4] 4",
+		"1:23 Exit 4",
+	}},
+}
+
+func TestEvents(t *testing.T) {
+	t.Parallel()
+	p := syntax.NewParser()
+	for i, tc := range eventsTests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			file, err := p.Parse(strings.NewReader(tc.src), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			r, _ := New(Module(OpenDevImpls(DefaultOpen)))
+			r.Events = func(ev Event) {
+				if ev.Time.IsZero() || ev.Duration < 0 {
+					t.Errorf("bad event times: %v %v", ev.Time, ev.Duration)
+				}
+				s := fmt.Sprintf("%s %s", ev.Node.Pos(), ev.Kind)
+				if ev.Fields != nil {
+					s += fmt.Sprintf(" %v", ev.Fields)
+				}
+				if ev.Kind != StmtStart && ev.Kind != Expand {
+					s += fmt.Sprintf(" %d", ev.Status)
+				}
+				got = append(got, s)
+			}
+			r.Run(context.Background(), file)
+			if strings.Join(got, "\n") != strings.Join(tc.want, "\n") {
+				t.Fatalf("wrong events in %q:\nwant:\n%s\ngot:\n%s", tc.src,
+					strings.Join(tc.want, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+}
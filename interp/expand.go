@@ -4,16 +4,18 @@
 package interp
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"os"
 	"os/user"
-	"path/filepath"
 	"regexp"
 	"runtime"
-	"sort"
 	"strconv"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"mvdan.cc/sh/syntax"
 )
@@ -22,7 +24,17 @@ func (r *Runner) expandFormat(format string, args []string) (int, string, error)
 	buf := r.strBuilder()
 	esc := false
 	var fmts []rune
+	var timeFmt []rune // inside a %(fmt)T directive
+	timeClosed := false
 	initialArgs := len(args)
+	badNum := false
+	nextArg := func() string {
+		arg := ""
+		if len(args) > 0 {
+			arg, args = args[0], args[1:]
+		}
+		return arg
+	}
 
 	for _, c := range format {
 		switch {
@@ -42,6 +54,25 @@ func (r *Runner) expandFormat(format string, args []string) (int, string, error)
 				buf.WriteRune(c)
 			}
 
+		case timeFmt != nil:
+			switch {
+			case timeClosed:
+				if c != 'T' {
+					return 0, "", fmt.Errorf("invalid format char: %c", c)
+				}
+				t := time.Now()
+				if n, err := strconv.ParseInt(nextArg(), 10, 64); err == nil && n >= 0 {
+					t = time.Unix(n, 0)
+				}
+				fmts = append(fmts, 's')
+				fmt.Fprintf(buf, string(fmts), strftime(string(timeFmt), t))
+				fmts, timeFmt, timeClosed = nil, nil, false
+			case c == ')':
+				timeClosed = true
+			default:
+				timeFmt = append(timeFmt, c)
+			}
+
 		case len(fmts) > 0:
 			switch c {
 			case '%':
@@ -49,42 +80,72 @@ func (r *Runner) expandFormat(format string, args []string) (int, string, error)
 				fmts = nil
 			case 'c':
 				var b byte
-				if len(args) > 0 {
-					arg := ""
-					arg, args = args[0], args[1:]
-					if len(arg) > 0 {
-						b = arg[0]
-					}
+				if arg := nextArg(); len(arg) > 0 {
+					b = arg[0]
 				}
 				buf.WriteByte(b)
 				fmts = nil
-			case '+', '-', ' ':
-				if len(fmts) > 1 {
-					return 0, "", fmt.Errorf("invalid format char: %c", c)
+			case '+', '-', ' ', '#':
+				for _, f := range fmts[1:] {
+					if f == '.' || ('1' <= f && f <= '9') {
+						return 0, "", fmt.Errorf("invalid format char: %c", c)
+					}
 				}
 				fmts = append(fmts, c)
 			case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
 				fmts = append(fmts, c)
-			case 's', 'd', 'i', 'u', 'o', 'x':
-				arg := ""
-				if len(args) > 0 {
-					arg, args = args[0], args[1:]
-				}
-				var farg interface{} = arg
-				if c != 's' {
-					n, _ := strconv.ParseInt(arg, 0, 0)
-					if c == 'i' || c == 'd' {
-						farg = int(n)
-					} else {
-						farg = uint(n)
-					}
-					if c == 'i' || c == 'u' {
-						c = 'd'
+			case '.':
+				for _, f := range fmts {
+					if f == '.' {
+						return 0, "", fmt.Errorf("invalid format char: %c", c)
 					}
 				}
 				fmts = append(fmts, c)
+			case '(':
+				timeFmt = []rune{}
+			case 's', 'b', 'q':
+				arg := nextArg()
+				stop := false
+				switch c {
+				case 'b':
+					arg, stop = formatEscapes(arg)
+				case 'q':
+					arg = shellQuote(arg)
+				}
+				fmts = append(fmts, 's')
+				fmt.Fprintf(buf, string(fmts), arg)
+				fmts = nil
+				if stop {
+					// \c stops all output
+					return 0, buf.String(), nil
+				}
+			case 'd', 'i', 'u', 'o', 'x', 'X':
+				arg := nextArg()
+				var farg interface{}
+				n, err := formatNum(arg)
+				if err != nil {
+					r.errf("printf: %s: invalid number\n", arg)
+					badNum = true
+				}
+				if c == 'i' || c == 'd' {
+					farg = int(n)
+				} else {
+					farg = uint(n)
+				}
+				if c == 'i' || c == 'u' {
+					c = 'd'
+				}
+				fmts = append(fmts, c)
 				fmt.Fprintf(buf, string(fmts), farg)
 				fmts = nil
+			case 'e', 'E', 'f', 'F', 'g', 'G':
+				f, _ := strconv.ParseFloat(nextArg(), 64)
+				if c == 'F' {
+					c = 'f'
+				}
+				fmts = append(fmts, c)
+				fmt.Fprintf(buf, string(fmts), f)
+				fmts = nil
 			default:
 				return 0, "", fmt.Errorf("invalid format char: %c", c)
 			}
@@ -98,12 +159,319 @@ func (r *Runner) expandFormat(format string, args []string) (int, string, error)
 			buf.WriteRune(c)
 		}
 	}
-	if len(fmts) > 0 {
+	if len(fmts) > 0 || timeFmt != nil {
 		return 0, "", fmt.Errorf("missing format char")
 	}
+	if badNum {
+		return initialArgs - len(args), buf.String(), errInvalidNum
+	}
 	return initialArgs - len(args), buf.String(), nil
 }
 
+// errInvalidNum is returned by expandFormat when a numeric argument could not
+// be fully parsed. The error has already been reported, and the output is
+// still valid.
+var errInvalidNum = errors.New("invalid number")
+
+// formatNum parses a numeric printf argument like the shell does; decimal,
+// octal with a leading 0, hexadecimal with a leading 0x, or the character
+// code following a leading quote like "'A". On error, the value of the
+// valid prefix is returned alongside it.
+func formatNum(s string) (int64, error) {
+	if s != "" && (s[0] == '\'' || s[0] == '"') {
+		r, _ := utf8.DecodeRuneInString(s[1:])
+		if r == utf8.RuneError {
+			r = 0
+		}
+		return int64(r), nil
+	}
+	t := strings.TrimLeft(s, " \t\n")
+	neg := false
+	if t != "" && (t[0] == '-' || t[0] == '+') {
+		neg, t = t[0] == '-', t[1:]
+	}
+	base := 10
+	switch {
+	case strings.HasPrefix(t, "0x"), strings.HasPrefix(t, "0X"):
+		base, t = 16, t[2:]
+	case len(t) > 1 && t[0] == '0':
+		base, t = 8, t[1:]
+	}
+	i := 0
+	for i < len(t) {
+		d := strings.IndexByte("0123456789abcdef", t[i]|0x20)
+		if d < 0 || d >= base {
+			break
+		}
+		i++
+	}
+	var n int64
+	var err error
+	if i > 0 {
+		var u uint64
+		u, err = strconv.ParseUint(t[:i], base, 64)
+		n = int64(u)
+	}
+	if neg {
+		n = -n
+	}
+	if err == nil && s != "" && (i < len(t) || (i == 0 && base != 8)) {
+		err = fmt.Errorf("invalid number: %q", s)
+	}
+	return n, err
+}
+
+// formatEscapes expands the backslash escape sequences in s, like printf's
+// %b. It also reports whether a \c escape was found, at which point the
+// output stops.
+func formatEscapes(s string) (string, bool) {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			buf.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch c := s[i]; c {
+		case 'a':
+			buf.WriteByte('\a')
+		case 'b':
+			buf.WriteByte('\b')
+		case 'e', 'E':
+			buf.WriteByte('\x1b')
+		case 'f':
+			buf.WriteByte('\f')
+		case 'n':
+			buf.WriteByte('\n')
+		case 'r':
+			buf.WriteByte('\r')
+		case 't':
+			buf.WriteByte('\t')
+		case 'v':
+			buf.WriteByte('\v')
+		case '\\':
+			buf.WriteByte('\\')
+		case 'c':
+			return buf.String(), true
+		case '0', 'x':
+			// up to three octal digits after \0, or two hex
+			// digits after \x
+			base, max := 8, 3
+			if c == 'x' {
+				base, max = 16, 2
+			}
+			j := i + 1
+			for j < len(s) && j-i <= max && digitVal(s[j]) < base {
+				j++
+			}
+			if c == 'x' && j == i+1 {
+				buf.WriteString(`\x`)
+				break
+			}
+			n, _ := strconv.ParseUint(s[i+1:j], base, 8)
+			buf.WriteByte(byte(n))
+			i = j - 1
+		default:
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String(), false
+}
+
+func digitVal(b byte) int {
+	switch {
+	case '0' <= b && b <= '9':
+		return int(b - '0')
+	case 'a' <= b && b <= 'f':
+		return int(b - 'a' + 10)
+	case 'A' <= b && b <= 'F':
+		return int(b - 'A' + 10)
+	}
+	return 16
+}
+
+// shellQuote quotes s so that it can be reused as shell input, like
+// printf's %q in Bash. Special characters are escaped with backslashes,
+// unless s has any characters which aren't printable, in which case the
+// $'...' form is used.
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if !printable(s) {
+		return ansiQuote(s)
+	}
+	var buf bytes.Buffer
+	for i, r := range s {
+		switch r {
+		case '#':
+			if i == 0 {
+				buf.WriteByte('\\')
+			}
+		case '~':
+			// where it could start a tilde expansion
+			if i == 0 || s[i-1] == '=' || s[i-1] == ':' {
+				buf.WriteByte('\\')
+			}
+		case ' ', '\'', '"', '\\', '|', '&', ';', '(', ')', '<', '>',
+			'!', '{', '}', '*', '[', ']', '?', '^', '$', '`', ',':
+			buf.WriteByte('\\')
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+// singleQuote quotes s like ${var@Q} in Bash, which always uses single
+// quotes, unless s has any characters which aren't printable, in which
+// case the $'...' form is used.
+func singleQuote(s string) string {
+	if !printable(s) {
+		return ansiQuote(s)
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// printable reports whether all the characters in s are valid and
+// printable, following the rules of glibc's iswprint in a UTF-8 locale
+// rather than those of unicode.IsPrint.
+func printable(s string) bool {
+	for i, r := range s {
+		if r == utf8.RuneError {
+			if _, size := utf8.DecodeRuneInString(s[i:]); size == 1 {
+				return false // an invalid byte
+			}
+		}
+		if !isPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isPrint(r rune) bool {
+	if unicode.In(r, unicode.Cc, unicode.Cs, unicode.Zl, unicode.Zp) {
+		return false
+	}
+	// any other assigned character, including format and private use ones
+	return unicode.In(r, unicode.L, unicode.M, unicode.N, unicode.P,
+		unicode.S, unicode.Zs, unicode.Cf, unicode.Co)
+}
+
+// ansiQuote quotes s in the $'...' form, escaping the bytes that aren't
+// printable.
+func ansiQuote(s string) string {
+	var buf bytes.Buffer
+	buf.WriteString("$'")
+	for i, r := range s {
+		switch r {
+		case '\a':
+			buf.WriteString(`\a`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\x1b':
+			buf.WriteString(`\E`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\v':
+			buf.WriteString(`\v`)
+		case '\\', '\'':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		default:
+			_, size := utf8.DecodeRuneInString(s[i:])
+			if char := s[i : i+size]; !printable(char) {
+				for _, b := range []byte(char) {
+					fmt.Fprintf(&buf, `\%03o`, b)
+				}
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('\'')
+	return buf.String()
+}
+
+// strftime formats t following the conversions supported by strftime(3),
+// for printf's %(fmt)T. Unknown conversions are kept as-is.
+func strftime(format string, t time.Time) string {
+	if format == "" {
+		format = "%X"
+	}
+	var buf bytes.Buffer
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			buf.WriteByte(format[i])
+			continue
+		}
+		i++
+		switch c := format[i]; c {
+		case '%':
+			buf.WriteByte('%')
+		case 'n':
+			buf.WriteByte('\n')
+		case 't':
+			buf.WriteByte('\t')
+		case 's':
+			buf.WriteString(strconv.FormatInt(t.Unix(), 10))
+		case 'j':
+			fmt.Fprintf(&buf, "%03d", t.YearDay())
+		case 'u':
+			wd := int(t.Weekday())
+			if wd == 0 {
+				wd = 7
+			}
+			buf.WriteString(strconv.Itoa(wd))
+		case 'w':
+			buf.WriteString(strconv.Itoa(int(t.Weekday())))
+		default:
+			if layout, ok := strftimeLayouts[c]; ok {
+				buf.WriteString(t.Format(layout))
+			} else {
+				buf.WriteByte('%')
+				buf.WriteByte(c)
+			}
+		}
+	}
+	return buf.String()
+}
+
+var strftimeLayouts = map[byte]string{
+	'a': "Mon",
+	'A': "Monday",
+	'b': "Jan",
+	'h': "Jan",
+	'B': "January",
+	'c': "Mon Jan _2 15:04:05 2006",
+	'd': "02",
+	'D': "01/02/06",
+	'e': "_2",
+	'F': "2006-01-02",
+	'H': "15",
+	'I': "03",
+	'm': "01",
+	'M': "04",
+	'p': "PM",
+	'r': "03:04:05 PM",
+	'R': "15:04",
+	'S': "05",
+	'T': "15:04:05",
+	'x': "01/02/06",
+	'X': "15:04:05",
+	'y': "06",
+	'Y': "2006",
+	'z': "-0700",
+	'Z': "MST",
+}
+
 func (r *Runner) fieldJoin(parts []fieldPart) string {
 	switch len(parts) {
 	case 0:
@@ -146,33 +514,26 @@ func (r *Runner) Fields(ctx context.Context, words ...*syntax.Word) ([]string, e
 
 func (r *Runner) fields(ctx context.Context, words ...*syntax.Word) []string {
 	fields := make([]string, 0, len(words))
-	baseDir := syntax.QuotePattern(r.Dir)
 	for _, word := range words {
 		for _, expWord := range syntax.ExpandBraces(word) {
 			for _, field := range r.wordFields(ctx, expWord.Parts) {
 				path, doGlob := r.escapedGlobField(field)
-				var matches []string
-				abs := filepath.IsAbs(path)
-				if doGlob && !r.opts[optNoGlob] {
-					if !abs {
-						path = filepath.Join(baseDir, path)
-					}
-					matches = glob(path, r.opts[optGlobStar])
-				}
-				if len(matches) == 0 {
+				if !doGlob || r.opts[optNoGlob] {
 					fields = append(fields, r.fieldJoin(field))
 					continue
 				}
-				for _, match := range matches {
-					if !abs {
-						endSeparator := strings.HasSuffix(match, string(filepath.Separator))
-						match, _ = filepath.Rel(r.Dir, match)
-						if endSeparator {
-							match += string(filepath.Separator)
-						}
+				matches := r.glob(path)
+				if len(matches) == 0 {
+					switch {
+					case r.opts[optFailGlob]:
+						r.errf("no match: %s\n", r.fieldJoin(field))
+						r.setErr(ShellExitStatus(1))
+					case !r.opts[optNullGlob]:
+						fields = append(fields, r.fieldJoin(field))
 					}
-					fields = append(fields, match)
+					continue
 				}
+				fields = append(fields, matches...)
 			}
 		}
 	}
@@ -184,11 +545,22 @@ func (r *Runner) loneWord(ctx context.Context, word *syntax.Word) string {
 		return ""
 	}
 	field := r.wordField(ctx, word.Parts, quoteDouble)
+	r.fieldUser(word, field)
 	return r.fieldJoin(field)
 }
 
+// document expands a heredoc body. Like the contents of double quotes, it
+// does not undergo tilde expansion.
+func (r *Runner) document(ctx context.Context, word *syntax.Word) string {
+	if word == nil {
+		return ""
+	}
+	return r.fieldJoin(r.wordField(ctx, word.Parts, quoteDouble))
+}
+
 func (r *Runner) lonePattern(ctx context.Context, word *syntax.Word) string {
 	field := r.wordField(ctx, word.Parts, quoteSingle)
+	r.fieldUser(word, field)
 	buf := r.strBuilder()
 	for _, part := range field {
 		if part.quote > quoteNone {
@@ -224,6 +596,18 @@ func (r *Runner) expandAssigns(ctx context.Context, as *syntax.Assign) []*syntax
 	return asgns
 }
 
+// fieldUser expands a leading tilde in a field obtained from word. This
+// is only done for unquoted literals, so it can't be done by wordField,
+// which is also used for the contents of double quotes.
+func (r *Runner) fieldUser(word *syntax.Word, field []fieldPart) {
+	if len(word.Parts) == 0 {
+		return
+	}
+	if _, ok := word.Parts[0].(*syntax.Lit); ok {
+		field[0].val = r.expandUser(field[0].val)
+	}
+}
+
 type fieldPart struct {
 	val   string
 	quote quoteLevel
@@ -239,13 +623,10 @@ const (
 
 func (r *Runner) wordField(ctx context.Context, wps []syntax.WordPart, ql quoteLevel) []fieldPart {
 	var field []fieldPart
-	for i, wp := range wps {
+	for _, wp := range wps {
 		switch x := wp.(type) {
 		case *syntax.Lit:
 			s := x.Value
-			if i == 0 {
-				s = r.expandUser(s)
-			}
 			if ql == quoteDouble && strings.Contains(s, "\\") {
 				buf := r.strBuilder()
 				for i := 0; i < len(s); i++ {
@@ -292,9 +673,16 @@ func (r *Runner) wordField(ctx context.Context, wps []syntax.WordPart, ql quoteL
 
 func (r *Runner) cmdSubst(ctx context.Context, cs *syntax.CmdSubst) string {
 	r2 := r.sub()
+	r2.traceDepth++
 	buf := r.strBuilder()
 	r2.Stdout = buf
+	if limit := r.Limits.SubstOutput; limit > 0 {
+		r2.substOut = &limitWriter{w: buf, limit: limit, left: limit}
+		r2.Stdout = r2.substOut
+	}
 	r2.stmts(ctx, cs.StmtList)
+	r2.exitTrap(ctx)
+	r2.stop(ctx) // to catch output exceeding the limit at the very end
 	r.setErr(r2.err)
 	return strings.TrimRight(buf.String(), "\n")
 }
@@ -311,12 +699,19 @@ func (r *Runner) wordFields(ctx context.Context, wps []syntax.WordPart) [][]fiel
 		curField = nil
 	}
 	splitAdd := func(val string) {
-		for i, field := range strings.FieldsFunc(val, r.ifsRune) {
+		split, lead, trail := splitFields(val, r.ifs)
+		if lead {
+			flush()
+		}
+		for i, field := range split {
 			if i > 0 {
 				flush()
 			}
 			curField = append(curField, fieldPart{val: field})
 		}
+		if trail {
+			flush()
+		}
 	}
 	for i, wp := range wps {
 		switch x := wp.(type) {
@@ -346,28 +741,51 @@ func (r *Runner) wordFields(ctx context.Context, wps []syntax.WordPart) [][]fiel
 			}
 			curField = append(curField, fp)
 		case *syntax.DblQuoted:
-			allowEmpty = true
-			if len(x.Parts) == 1 {
-				pe, _ := x.Parts[0].(*syntax.ParamExp)
-				if elems := r.quotedElems(pe); elems != nil {
-					for i, elem := range elems {
-						if i > 0 {
-							flush()
-						}
-						curField = append(curField, fieldPart{
-							quote: quoteDouble,
-							val:   elem,
-						})
+			if len(x.Parts) == 0 {
+				allowEmpty = true
+			}
+			for _, wp := range x.Parts {
+				pe, _ := wp.(*syntax.ParamExp)
+				if pe == nil {
+					allowEmpty = true
+					for _, part := range r.wordField(ctx, []syntax.WordPart{wp}, quoteDouble) {
+						part.quote = quoteDouble
+						curField = append(curField, part)
 					}
 					continue
 				}
-			}
-			for _, part := range r.wordField(ctx, x.Parts, quoteDouble) {
-				part.quote = quoteDouble
-				curField = append(curField, part)
+				elems, all := r.paramElems(ctx, pe)
+				if all != '@' {
+					allowEmpty = true
+					curField = append(curField, fieldPart{
+						quote: quoteDouble,
+						val:   r.joinElems(elems, all),
+					})
+					continue
+				}
+				// "${a[@]}" expands to one word per element, the
+				// first and last joining the surrounding text,
+				// and to no words at all if there are none
+				for i, elem := range elems {
+					if i > 0 {
+						flush()
+					}
+					allowEmpty = true
+					curField = append(curField, fieldPart{
+						quote: quoteDouble,
+						val:   elem,
+					})
+				}
 			}
 		case *syntax.ParamExp:
-			splitAdd(r.paramExp(ctx, x))
+			// each element of ${a[@]} is split separately
+			elems, all := r.paramElems(ctx, x)
+			for i, elem := range elems {
+				if i > 0 && all != 0 {
+					flush()
+				}
+				splitAdd(elem)
+			}
 		case *syntax.CmdSubst:
 			splitAdd(r.cmdSubst(ctx, x))
 		case *syntax.ArithmExp:
@@ -430,79 +848,3 @@ func hasGlob(path string) bool {
 	}
 	return strings.ContainsAny(path, magicChars)
 }
-
-var rxGlobStar = regexp.MustCompile(".*")
-
-func glob(pattern string, globStar bool) []string {
-	parts := strings.Split(pattern, string(filepath.Separator))
-	matches := []string{"."}
-	if filepath.IsAbs(pattern) {
-		if parts[0] == "" {
-			// unix-like
-			matches[0] = string(filepath.Separator)
-		} else {
-			// windows (for some reason it won't work without the
-			// trailing separator)
-			matches[0] = parts[0] + string(filepath.Separator)
-		}
-		parts = parts[1:]
-	}
-	for _, part := range parts {
-		if part == "**" && globStar {
-			for i := range matches {
-				// "a/**" should match "a/ a/b a/b/c ..."; note
-				// how the zero-match case has a trailing
-				// separator.
-				matches[i] += string(filepath.Separator)
-			}
-			// expand all the possible levels of **
-			latest := matches
-			for {
-				var newMatches []string
-				for _, dir := range latest {
-					newMatches = globDir(dir, rxGlobStar, newMatches)
-				}
-				if len(newMatches) == 0 {
-					// not another level of directories to
-					// try; stop
-					break
-				}
-				matches = append(matches, newMatches...)
-				latest = newMatches
-			}
-			continue
-		}
-		expr, err := syntax.TranslatePattern(part, true)
-		if err != nil {
-			return nil
-		}
-		rx := regexp.MustCompile("^" + expr + "$")
-		var newMatches []string
-		for _, dir := range matches {
-			newMatches = globDir(dir, rx, newMatches)
-		}
-		matches = newMatches
-	}
-	return matches
-}
-
-func globDir(dir string, rx *regexp.Regexp, matches []string) []string {
-	d, err := os.Open(dir)
-	if err != nil {
-		return nil
-	}
-	defer d.Close()
-
-	names, _ := d.Readdirnames(-1)
-	sort.Strings(names)
-
-	for _, name := range names {
-		if !strings.HasPrefix(rx.String(), `^\.`) && name[0] == '.' {
-			continue
-		}
-		if rx.MatchString(name) {
-			matches = append(matches, filepath.Join(dir, name))
-		}
-	}
-	return matches
-}
@@ -0,0 +1,89 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package interp
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// SplitFields splits s into fields as the shell does with the result of
+// unquoted expansions, using the characters in ifs as delimiters. The
+// caller should use " \t\n" if IFS is unset.
+//
+// Following POSIX, the space, tab and newline characters in ifs are IFS
+// whitespace: sequences of them are a single delimiter, and they are
+// ignored at the start and end of s. Any other character in ifs delimits a
+// field on its own, along with any IFS whitespace around it, so that an
+// IFS of ":" splits "a::b" into "a", "" and "b", and ":a" into "" and "a".
+// A delimiter at the end of s does not start an empty field.
+//
+// If ifs is empty, s is not split, and it results in no fields if it is
+// empty.
+func SplitFields(s, ifs string) []string {
+	fields, _, _ := splitFields(s, ifs)
+	return fields
+}
+
+// splitFields is like SplitFields, but it also reports whether s starts
+// with IFS whitespace, and whether it ends with a delimiter. Either
+// separates the fields from the text surrounding s in the same word, like
+// the "p" in p$var.
+func splitFields(s, ifs string) (fields []string, lead, trail bool) {
+	if ifs == "" {
+		if s == "" {
+			return nil, false, false
+		}
+		return []string{s}, false, false
+	}
+	isDelim := func(r rune) bool { return strings.ContainsRune(ifs, r) }
+	isSpace := func(r rune) bool {
+		return (r == ' ' || r == '\t' || r == '\n') && isDelim(r)
+	}
+	i := 0
+	// advance skips the rune at i if it satisfies fn.
+	advance := func(fn func(rune) bool) bool {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if i == len(s) || !fn(r) {
+			return false
+		}
+		i += size
+		return true
+	}
+	notDelim := func(r rune) bool { return !isDelim(r) }
+	// skipDelim skips a delimiter, made of IFS whitespace and at most one
+	// other IFS character, and returns whether it had the latter.
+	skipDelim := func() bool {
+		for advance(isSpace) {
+		}
+		if !advance(isDelim) {
+			return false
+		}
+		for advance(isSpace) {
+		}
+		return true
+	}
+	if advance(isSpace) {
+		if skipDelim() {
+			// like " : x", where the empty field joins the text before
+			fields = append(fields, "")
+		} else {
+			lead = true
+		}
+		if i == len(s) {
+			return fields, lead, true
+		}
+	}
+	for i < len(s) {
+		start := i
+		for advance(notDelim) {
+		}
+		fields = append(fields, s[start:i])
+		if i == len(s) {
+			return fields, lead, false
+		}
+		skipDelim()
+	}
+	return fields, lead, true
+}
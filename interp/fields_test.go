@@ -0,0 +1,47 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package interp
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+var splitFieldsCases = []struct {
+	s, ifs string
+	want   []string
+}{
+	{"", " \t\n", nil},
+	{"  \t ", " \t\n", nil},
+	{"a b", " \t\n", []string{"a", "b"}},
+	{"  a \n\t b  ", " \t\n", []string{"a", "b"}},
+	{"a b", "", []string{"a b"}},
+	{"", "", nil},
+	{"a:b:c", ":", []string{"a", "b", "c"}},
+	{"a::b", ":", []string{"a", "", "b"}},
+	{":a", ":", []string{"", "a"}},
+	{"a:", ":", []string{"a"}},
+	{"a::", ":", []string{"a", ""}},
+	{":", ":", []string{""}},
+	{" a ", ":", []string{" a "}},
+	{" : a : ", " :", []string{"", "a"}},
+	{"a : b", " :", []string{"a", "b"}},
+	{"a :: b", " :", []string{"a", "", "b"}},
+	{"a  b", " :", []string{"a", "b"}},
+	{"a·b·", "·", []string{"a", "b"}},
+}
+
+func TestSplitFields(t *testing.T) {
+	t.Parallel()
+	for i, tc := range splitFieldsCases {
+		t.Run(fmt.Sprintf("%02d", i), func(t *testing.T) {
+			got := SplitFields(tc.s, tc.ifs)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("SplitFields mismatch in %q with IFS %q:\nwant: %q\ngot:  %q",
+					tc.s, tc.ifs, tc.want, got)
+			}
+		})
+	}
+}
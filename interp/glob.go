@@ -0,0 +1,197 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package interp
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// GlobOptions are the shell options which change how Glob matches names,
+// which can be enabled in Bash via shopt.
+type GlobOptions struct {
+	// GlobStar makes a "**" path element match any number of
+	// directories, including none. When it is the last element, it
+	// matches all the files and directories within them too.
+	GlobStar bool
+
+	// DotGlob makes the wildcards also match names starting with a dot.
+	// Otherwise, such names only match if the pattern element starts
+	// with a literal dot. The names "." and ".." are never matched.
+	DotGlob bool
+}
+
+// Glob returns the paths in fsys which match a shell pattern, such as
+// "src/*.[ch]", sorted by their bytes. Like the paths in fsys, the pattern
+// is separated by slashes and relative to the root of fsys. Pattern
+// characters may be escaped with backslashes.
+//
+// A pattern ending with a slash only matches directories, which keep the
+// trailing slash. Errors reading directories are ignored, and the only
+// possible error is a malformed pattern, like "[a".
+//
+// An empty result is not an error; what to do then depends on the nullglob
+// and failglob options of a shell, which the interpreter implements.
+func Glob(fsys fs.FS, pattern string, opts GlobOptions) ([]string, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	dirOnly := strings.HasSuffix(pattern, "/")
+	parts := strings.Split(strings.TrimSuffix(pattern, "/"), "/")
+	matches := []string{"."}
+	for i, part := range parts {
+		last := i == len(parts)-1
+		var next []string
+		switch {
+		case part == "**" && opts.GlobStar:
+			for _, dir := range matches {
+				if last && dir != "." {
+					// "a/**" matches "a/" too
+					next = append(next, dir+"/")
+				} else if !last {
+					next = append(next, dir)
+				}
+				next = globWalk(fsys, dir, opts.DotGlob, next)
+			}
+		case !hasMeta(part):
+			name := unescapePattern(part)
+			for _, dir := range matches {
+				p := path.Join(dir, name)
+				if _, err := fs.Stat(fsys, p); err == nil {
+					next = append(next, p)
+				}
+			}
+		default:
+			expr, err := syntax.TranslatePattern(part, true)
+			if err != nil {
+				return nil, err
+			}
+			rx := regexp.MustCompile("^" + expr + "$")
+			dots := opts.DotGlob || strings.HasPrefix(part, ".") ||
+				strings.HasPrefix(part, `\.`)
+			for _, dir := range matches {
+				entries, _ := fs.ReadDir(fsys, dir)
+				for _, entry := range entries {
+					name := entry.Name()
+					if name[0] == '.' && !dots {
+						continue
+					}
+					if rx.MatchString(name) {
+						next = append(next, path.Join(dir, name))
+					}
+				}
+			}
+		}
+		if matches = next; len(matches) == 0 {
+			return nil, nil
+		}
+	}
+	if dirOnly {
+		dirs := matches[:0]
+		for _, match := range matches {
+			if strings.HasSuffix(match, "/") {
+				dirs = append(dirs, match)
+			} else if info, err := fs.Stat(fsys, match); err == nil && info.IsDir() {
+				dirs = append(dirs, match+"/")
+			}
+		}
+		matches = dirs
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// globWalk appends all the files and directories within dir, recursively,
+// without following symbolic links.
+func globWalk(fsys fs.FS, dir string, dots bool, matches []string) []string {
+	entries, _ := fs.ReadDir(fsys, dir)
+	for _, entry := range entries {
+		name := entry.Name()
+		if name[0] == '.' && !dots {
+			continue
+		}
+		p := path.Join(dir, name)
+		matches = append(matches, p)
+		if entry.IsDir() {
+			matches = globWalk(fsys, p, dots, matches)
+		}
+	}
+	return matches
+}
+
+// hasMeta reports whether a pattern has any unescaped wildcards.
+func hasMeta(pattern string) bool {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '*', '?', '[':
+			return true
+		}
+	}
+	return false
+}
+
+func unescapePattern(pattern string) string {
+	if !strings.Contains(pattern, `\`) {
+		return pattern
+	}
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] == '\\' && i+1 < len(pattern) {
+			i++
+		}
+		b.WriteByte(pattern[i])
+	}
+	return b.String()
+}
+
+// glob expands a pattern in the runner's directory, or from the root if it
+// is an absolute path, using the host's file system.
+func (r *Runner) glob(pattern string) []string {
+	abs := filepath.IsAbs(pattern)
+	trailing := strings.HasSuffix(pattern, string(filepath.Separator))
+	if !abs {
+		pattern = filepath.Join(syntax.QuotePattern(r.Dir), pattern)
+	} else {
+		pattern = filepath.Clean(pattern)
+	}
+	root := filepath.VolumeName(pattern) + string(filepath.Separator)
+	pattern = strings.TrimPrefix(pattern[len(root)-1:], string(filepath.Separator))
+	if runtime.GOOS == "windows" {
+		// backslashes are separators, not escapes
+		pattern = filepath.ToSlash(pattern)
+	}
+	if trailing {
+		pattern += "/"
+	}
+	matches, _ := Glob(os.DirFS(root), pattern, GlobOptions{
+		GlobStar: r.opts[optGlobStar],
+		DotGlob:  r.opts[optDotGlob],
+	})
+	if r.Collate != nil {
+		sort.SliceStable(matches, func(i, j int) bool {
+			return r.Collate(matches[i], matches[j]) < 0
+		})
+	}
+	for i, match := range matches {
+		match = filepath.Join(root, filepath.FromSlash(match))
+		if !abs {
+			match, _ = filepath.Rel(r.Dir, match)
+		}
+		if strings.HasSuffix(matches[i], "/") {
+			match += string(filepath.Separator)
+		}
+		matches[i] = match
+	}
+	return matches
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package interp
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+var globFS = fstest.MapFS{
+	"a.x":         {},
+	"b.x":         {},
+	"c.y":         {},
+	".hidden.x":   {},
+	"*.x":         {},
+	"dir/a.x":     {},
+	"dir/sub/b.x": {},
+	"dir/.dot/c":  {},
+	"other/a.x":   {},
+}
+
+var globCases = []struct {
+	pattern string
+	opts    GlobOptions
+	want    []string
+}{
+	{"*.x", GlobOptions{}, []string{"*.x", "a.x", "b.x"}},
+	{"?.?", GlobOptions{}, []string{"*.x", "a.x", "b.x", "c.y"}},
+	{"[ab].x", GlobOptions{}, []string{"a.x", "b.x"}},
+	{"[!a]*", GlobOptions{}, []string{"*.x", "b.x", "c.y", "dir", "other"}},
+	{"*.z", GlobOptions{}, nil},
+	{`\*.x`, GlobOptions{}, []string{"*.x"}},
+	{"a.x", GlobOptions{}, []string{"a.x"}},
+	{"nope", GlobOptions{}, nil},
+	{".h*", GlobOptions{}, []string{".hidden.x"}},
+	{"*.x", GlobOptions{DotGlob: true}, []string{"*.x", ".hidden.x", "a.x", "b.x"}},
+	{"*/a.x", GlobOptions{}, []string{"dir/a.x", "other/a.x"}},
+	{"dir/*", GlobOptions{}, []string{"dir/a.x", "dir/sub"}},
+	{"*/", GlobOptions{}, []string{"dir/", "other/"}},
+	{"**/b.x", GlobOptions{}, nil},
+	{"**/b.x", GlobOptions{GlobStar: true}, []string{"b.x", "dir/sub/b.x"}},
+	{"dir/**", GlobOptions{GlobStar: true}, []string{"dir/", "dir/a.x", "dir/sub", "dir/sub/b.x"}},
+	{"dir/**/", GlobOptions{GlobStar: true}, []string{"dir/", "dir/sub/"}},
+	{"dir/**", GlobOptions{GlobStar: true, DotGlob: true}, []string{
+		"dir/", "dir/.dot", "dir/.dot/c", "dir/a.x", "dir/sub", "dir/sub/b.x",
+	}},
+}
+
+func TestGlob(t *testing.T) {
+	t.Parallel()
+	for i, tc := range globCases {
+		t.Run(fmt.Sprintf("%02d", i), func(t *testing.T) {
+			got, err := Glob(globFS, tc.pattern, tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) == 0 && len(tc.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("Glob mismatch in %q:\nwant: %q\ngot:  %q",
+					tc.pattern, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestGlobBadPattern(t *testing.T) {
+	t.Parallel()
+	if _, err := Glob(globFS, "[[:foo:]]", GlobOptions{}); err == nil {
+		t.Fatal("want an error for an invalid character class")
+	}
+}
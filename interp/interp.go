@@ -10,6 +10,7 @@ import (
 	"io"
 	"io/ioutil"
 	"math"
+	"math/rand"
 	"os"
 	"os/user"
 	"path/filepath"
@@ -51,9 +52,14 @@ func New(opts ...func(*Runner) error) (*Runner, error) {
 	if r.Open == nil {
 		Module(nil)(r)
 	}
+	if r.Stat == nil {
+		Module(ModuleStat(nil))(r)
+	}
 	if r.Stdout == nil || r.Stderr == nil {
 		StdIO(r.Stdin, r.Stdout, r.Stderr)(r)
 	}
+	// keep the shell options set via Params when resetting
+	r.origOpts = r.opts
 	return r, nil
 }
 
@@ -98,11 +104,14 @@ func Dir(path string) func(*Runner) error {
 }
 
 // Params populates the shell options and parameters. For example, Params("-e",
-// "--", "foo") will set the "-e" option and the parameters ["foo"].
+// "--", "foo") will set the "-e" option and the parameters ["foo"]. The
+// parameters are kept if there are only options, like in Params("-e"), and
+// emptied by Params("--").
 //
 // This is similar to what the interpreter's "set" builtin does.
 func Params(args ...string) func(*Runner) error {
 	return func(r *Runner) error {
+		dashdash := false
 		for len(args) > 0 {
 			arg := args[0]
 			if arg == "" || (arg[0] != '-' && arg[0] != '+') {
@@ -110,6 +119,7 @@ func Params(args ...string) func(*Runner) error {
 			}
 			if arg == "--" {
 				args = args[1:]
+				dashdash = true
 				break
 			}
 			enable := arg[0] == '-'
@@ -142,13 +152,15 @@ func Params(args ...string) func(*Runner) error {
 			*opt = enable
 			args = args[1:]
 		}
-		r.Params = args
+		if dashdash || len(args) > 0 {
+			r.Params = args
+		}
 		return nil
 	}
 }
 
-// Module sets an interpreter module, which can be ModuleExec or ModuleOpen. If
-// the value is nil, the default module implementation is used.
+// Module sets an interpreter module, which can be ModuleExec, ModuleOpen, or
+// ModuleStat. If the value is nil, the default module implementation is used.
 func Module(mod interface{}) func(*Runner) error {
 	return func(r *Runner) error {
 		switch mod := mod.(type) {
@@ -162,6 +174,11 @@ func Module(mod interface{}) func(*Runner) error {
 				mod = DefaultOpen
 			}
 			r.Open = mod
+		case ModuleStat:
+			if mod == nil {
+				mod = DefaultStat
+			}
+			r.Stat = mod
 		default:
 			return fmt.Errorf("unknown module type: %T", mod)
 		}
@@ -212,6 +229,9 @@ type Runner struct {
 	Exec ModuleExec
 	// Open is the module responsible for opening files. It must be non-nil.
 	Open ModuleOpen
+	// Stat is the module responsible for getting information about files.
+	// It must be non-nil.
+	Stat ModuleStat
 
 	Stdin  io.Reader
 	Stdout io.Writer
@@ -239,24 +259,38 @@ type Runner struct {
 	// >0 to break or continue out of N enclosing loops
 	breakEnclosing, contnEnclosing int
 
-	inLoop   bool
-	inFunc   bool
-	inSource bool
+	loopDepth int // number of enclosing loops
+	inFunc    bool
+	inSource  bool
 
 	err  error // current shell exit code or fatal error
 	exit int   // current (last) exit status code
 
 	bgShells errgroup.Group
 
-	opts [len(shellOptsTable) + len(bashOptsTable)]bool
+	opts     [len(shellOptsTable) + len(bashOptsTable)]bool
+	origOpts [len(shellOptsTable) + len(bashOptsTable)]bool
 
 	dirStack []string
 
 	optState getopts
 
+	ifs     string
 	ifsJoin string
 	ifsRune func(rune) bool
 
+	// arithmDepth is how many strings are being evaluated as nested
+	// arithmetic expressions, to stop reference loops like a=a+1.
+	arithmDepth int
+
+	// traps holds the trap handlers, by condition name such as "EXIT".
+	// Subshells don't inherit them.
+	traps map[string]trapHandler
+
+	// curHandler is the parsed trap handler of the command being
+	// called, if any; see syntax.ParseTraps.
+	curHandler *syntax.StmtList
+
 	// keepRedirs is used so that "exec" can make any redirections
 	// apply to the current shell, and not just the command.
 	keepRedirs bool
@@ -274,6 +308,74 @@ type Runner struct {
 	// because Go doesn't currently support sending Interrupt on Windows.
 	KillTimeout time.Duration
 
+	// Limits caps the resources that programs may use. It is shared
+	// with any subshells.
+	Limits Limits
+
+	// usage is the usage of the resources in Limits, shared with any
+	// subshells.
+	usage *limitUsage
+
+	// substOut is the output of the command substitution being run, if
+	// it is limited.
+	substOut *limitWriter
+
+	// Coverage, if non-nil, records which statements are run. It is
+	// shared with any subshells.
+	Coverage *Coverage
+
+	// Profile, if non-nil, accumulates the time spent running each
+	// command, function, and statement. It is shared with any subshells.
+	Profile *Profile
+
+	// Trace, if non-nil, is where the commands being run are traced to
+	// when the xtrace option is set, such as via "set -x" or
+	// Params("-x"). If nil, the trace is written to Stderr.
+	Trace io.Writer
+
+	// Events, if non-nil, is called with each step of the execution of
+	// programs, such as when a statement starts or finishes. It is shared
+	// with subshells, so it may be called concurrently if background
+	// commands or pipelines are used.
+	Events func(Event)
+
+	// Random, if non-nil, gives the values of $RANDOM, which should be
+	// between 0 and 32767. This can be used to make the output of
+	// programs deterministic, such as in tests. If nil, a pseudo-random
+	// generator is used, which is seeded by assigning to RANDOM.
+	Random func() int
+
+	// Now, if non-nil, is used instead of time.Now to tell the time
+	// since the runner was reset, as in $SECONDS.
+	Now func() time.Time
+
+	// Line, if non-nil, gives the line number in $LINENO for a position
+	// in the program being run. This can be used to report the lines of
+	// a larger file the program was extracted from.
+	Line func(syntax.Pos) uint
+
+	// Collate, if non-nil, compares two strings like strings.Compare
+	// does, to sort the results of pathname expansion and for the < and >
+	// operators of [[ ]]. This can be used to follow the collation order
+	// of a locale. If nil, strings are compared by their bytes, like in
+	// the C locale.
+	Collate func(a, b string) int
+
+	// rand is the default source of $RANDOM.
+	rand *rand.Rand
+
+	// startTime is when the runner was reset, moved by any assignments
+	// to SECONDS.
+	startTime time.Time
+
+	// funcStack holds the names of the functions being called, the
+	// innermost being last.
+	funcStack []string
+
+	// traceDepth is the number of levels of indirection, such as
+	// command substitutions, which are shown in the trace.
+	traceDepth int
+
 	fieldAlloc  [4]fieldPart
 	fieldsAlloc [4][]fieldPart
 	bufferAlloc bytes.Buffer
@@ -322,11 +424,15 @@ var shellOptsTable = [...]struct {
 	{"f", "noglob"},
 	{"u", "nounset"},
 	{" ", "pipefail"},
+	{"x", "xtrace"},
 }
 
 var bashOptsTable = [...]string{
 	// sorted alphabetically by name
+	"dotglob",
+	"failglob",
 	"globstar",
+	"nullglob",
 }
 
 // To access the shell options arrays without a linear search when we
@@ -339,8 +445,12 @@ const (
 	optNoGlob
 	optNoUnset
 	optPipeFail
+	optXTrace
 
+	optDotGlob
+	optFailGlob
 	optGlobStar
+	optNullGlob
 )
 
 // Reset empties the runner state and sets any exported fields with zero values
@@ -360,7 +470,20 @@ func (r *Runner) Reset() {
 		Stderr:      r.Stderr,
 		Exec:        r.Exec,
 		Open:        r.Open,
+		Stat:        r.Stat,
 		KillTimeout: r.KillTimeout,
+		Limits:      r.Limits,
+		usage:       &limitUsage{},
+		Coverage:    r.Coverage,
+		Profile:     r.Profile,
+		Trace:       r.Trace,
+		Events:      r.Events,
+		Random:      r.Random,
+		Now:         r.Now,
+		Line:        r.Line,
+		Collate:     r.Collate,
+		opts:        r.origOpts,
+		origOpts:    r.origOpts,
 
 		// emptied below, to reuse the space
 		Vars:     r.Vars,
@@ -389,6 +512,9 @@ func (r *Runner) Reset() {
 	r.Vars["IFS"] = Variable{Value: StringVal(" \t\n")}
 	r.ifsUpdated()
 	r.Vars["OPTIND"] = Variable{Value: StringVal("1")}
+	if _, ok := r.Env.Get("PS4"); !ok {
+		r.Vars["PS4"] = Variable{Value: StringVal("+ ")}
+	}
 
 	if runtime.GOOS == "windows" {
 		// convert $PATH to a unix path list
@@ -404,27 +530,26 @@ func (r *Runner) Reset() {
 	if r.Open == nil {
 		r.Open = DefaultOpen
 	}
+	if r.Stat == nil {
+		r.Stat = DefaultStat
+	}
 	if r.KillTimeout == 0 {
 		r.KillTimeout = 2 * time.Second
 	}
+	r.startTime = r.now()
+	r.rand = rand.New(rand.NewSource(r.startTime.UnixNano()))
 	r.didReset = true
 }
 
 func (r *Runner) modCtx(ctx context.Context) context.Context {
 	mc := ModuleCtx{
-		Env:         r.Env,
+		Env:         r.exportedEnv(),
 		Dir:         r.Dir,
 		Stdin:       r.Stdin,
 		Stdout:      r.Stdout,
 		Stderr:      r.Stderr,
 		KillTimeout: r.KillTimeout,
-	}
-	mc.Env = r.Env.Copy()
-	for name, vr := range r.Vars {
-		if !vr.Exported {
-			continue
-		}
-		mc.Env.Set(name, r.varStr(vr, 0))
+		usage:       r.usage,
 	}
 	for name, val := range r.cmdVars {
 		mc.Env.Set(name, val)
@@ -432,6 +557,18 @@ func (r *Runner) modCtx(ctx context.Context) context.Context {
 	return context.WithValue(ctx, moduleCtxKey{}, mc)
 }
 
+// exportedEnv returns the environment that programs are run with, which
+// includes the exported variables.
+func (r *Runner) exportedEnv() Environ {
+	env := r.Env.Copy()
+	for name, vr := range r.Vars {
+		if vr.Exported {
+			env.Set(name, r.varStr(vr, 0))
+		}
+	}
+	return env
+}
+
 // ShellExitStatus exits the shell with a status code.
 type ShellExitStatus uint8
 
@@ -464,7 +601,11 @@ func (r *Runner) Run(ctx context.Context, node syntax.Node) error {
 	switch x := node.(type) {
 	case *syntax.File:
 		r.filename = x.Name
+		if r.Coverage != nil {
+			r.Coverage.addFile(x)
+		}
 		r.stmts(ctx, x.StmtList)
+		r.exitTrap(ctx)
 	case *syntax.Stmt:
 		r.stmt(ctx, x)
 	case syntax.Command:
@@ -478,6 +619,27 @@ func (r *Runner) Run(ctx context.Context, node syntax.Node) error {
 	return r.err
 }
 
+// RunSubst runs the statements of a command substitution on its own, as if
+// it was expanded by a script, and returns its standard output with any
+// trailing newlines removed. This lets programs allow limited dynamic values,
+// such as in templates, without running entire scripts.
+//
+// The substitution runs with the environment env, and options such as
+// Module may be used to set how commands are executed. If a non-nil error
+// is returned, it will typically be of type ExitStatus or ShellExitStatus,
+// and the output read until then is still returned.
+func RunSubst(ctx context.Context, cs *syntax.CmdSubst, env Environ, opts ...func(*Runner) error) (string, error) {
+	var buf bytes.Buffer
+	opts = append([]func(*Runner) error{Env(env)}, opts...)
+	r, err := New(opts...)
+	if err != nil {
+		return "", err
+	}
+	r.Stdout = &buf
+	err = r.Run(ctx, &syntax.File{StmtList: cs.StmtList})
+	return strings.TrimRight(buf.String(), "\n"), err
+}
+
 func (r *Runner) out(s string) {
 	io.WriteString(r.Stdout, s)
 }
@@ -498,6 +660,10 @@ func (r *Runner) stop(ctx context.Context) bool {
 		r.err = err
 		return true
 	}
+	if r.substOut != nil && r.substOut.exceeded() {
+		r.err = OutputLimitError{r.substOut.limit}
+		return true
+	}
 	if r.opts[optNoExec] {
 		return true
 	}
@@ -508,6 +674,9 @@ func (r *Runner) stmt(ctx context.Context, st *syntax.Stmt) {
 	if r.stop(ctx) {
 		return
 	}
+	if r.Coverage != nil {
+		r.Coverage.hit(st)
+	}
 	if st.Background {
 		r2 := r.sub()
 		st2 := *st
@@ -521,9 +690,25 @@ func (r *Runner) stmt(ctx context.Context, st *syntax.Stmt) {
 }
 
 func (r *Runner) stmtSync(ctx context.Context, st *syntax.Stmt) {
+	if r.Events != nil {
+		start := time.Now()
+		r.event(StmtStart, st, start, nil, 0)
+		defer func() { r.event(Exit, st, start, nil, r.eventStatus()) }()
+	}
+	if r.Profile != nil {
+		start := r.Profile.start()
+		defer r.Profile.addStmt(r.filename, st, start)
+	}
 	oldIn, oldOut, oldErr := r.Stdin, r.Stdout, r.Stderr
 	for _, rd := range st.Redirs {
+		var start time.Time
+		if r.Events != nil {
+			start = time.Now()
+		}
 		cls, err := r.redir(ctx, rd)
+		if r.Events != nil {
+			r.event(Redirect, rd, start, nil, oneIf(err != nil))
+		}
 		if err != nil {
 			r.exit = 1
 			return
@@ -556,13 +741,28 @@ func (r *Runner) sub() *Runner {
 		Params:      r.Params,
 		Exec:        r.Exec,
 		Open:        r.Open,
+		Stat:        r.Stat,
 		Stdin:       r.Stdin,
 		Stdout:      r.Stdout,
 		Stderr:      r.Stderr,
 		Funcs:       r.Funcs,
 		KillTimeout: r.KillTimeout,
+		Limits:      r.Limits,
+		usage:       r.usage,
+		substOut:    r.substOut,
+		Coverage:    r.Coverage,
+		Profile:     r.Profile,
+		Trace:       r.Trace,
+		Events:      r.Events,
+		Random:      r.Random,
+		Now:         r.Now,
+		Line:        r.Line,
+		Collate:     r.Collate,
+		rand:        rand.New(rand.NewSource(r.rand.Int63())),
+		startTime:   r.startTime,
 		filename:    r.filename,
 		opts:        r.opts,
+		traceDepth:  r.traceDepth,
 	}
 	// TODO: perhaps we could do a lazy copy here, or some sort of
 	// overlay to avoid copying all the time
@@ -576,7 +776,8 @@ func (r *Runner) sub() *Runner {
 		r2.cmdVars[k] = v
 	}
 	r2.dirStack = append([]string(nil), r.dirStack...)
-	r2.ifsUpdated()
+	r2.funcStack = append([]string(nil), r.funcStack...)
+	r2.setIFS(r.ifs)
 	r2.didReset = true
 	return r2
 }
@@ -591,28 +792,62 @@ func (r *Runner) cmd(ctx context.Context, cm syntax.Command) {
 	case *syntax.Subshell:
 		r2 := r.sub()
 		r2.stmts(ctx, x.StmtList)
+		r2.exitTrap(ctx)
 		r.exit = r2.exit
 		r.setErr(r2.err)
 	case *syntax.CallExpr:
+		var start time.Time
+		if r.Events != nil {
+			start = time.Now()
+		}
 		fields := r.fields(ctx, x.Args...)
+		if r.Events != nil && len(fields) > 0 {
+			r.event(Expand, x, start, fields, 0)
+		}
 		if len(fields) == 0 {
 			for _, as := range x.Assigns {
 				vr, _ := r.lookupVar(as.Name.Value)
-				vr.Value = r.assignVal(ctx, as, "")
+				vr.Value = r.assignVal(ctx, as, "", false)
+				r.trace(ctx, r.traceAssign(as, vr.Value, false))
 				r.setVar(ctx, as.Name.Value, as.Index, vr)
 			}
 			break
 		}
 		for _, as := range x.Assigns {
-			val := r.assignVal(ctx, as, "")
+			val := r.assignVal(ctx, as, "", false)
+			r.trace(ctx, r.traceAssign(as, val, false))
 			// we know that inline vars must be strings
 			r.cmdVars[as.Name.Value] = string(val.(StringVal))
 			if as.Name.Value == "IFS" {
+				defer r.setIFS(r.ifs)
 				r.ifsUpdated()
-				defer r.ifsUpdated()
 			}
 		}
+		if r.opts[optXTrace] {
+			quoted := make([]string, len(fields))
+			for i, field := range fields {
+				quoted[i] = traceQuote(field)
+			}
+			r.trace(ctx, quoted...)
+		}
+		if r.Events != nil {
+			start = time.Now()
+		}
+		var profKind string
+		var profStart time.Time
+		if r.Profile != nil {
+			profKind = r.profileKind(fields[0])
+			profStart = r.Profile.start()
+		}
+		r.curHandler = x.Handler
 		r.call(ctx, x.Args[0].Pos(), fields)
+		r.curHandler = nil
+		if r.Events != nil {
+			r.event(CmdExec, x, start, fields, r.eventStatus())
+		}
+		if r.Profile != nil {
+			r.Profile.add(profKind, fields[0], profStart)
+		}
 		// cmdVars can be nuked here, as they are never useful
 		// again once we nest into further levels of inline
 		// vars.
@@ -665,19 +900,24 @@ func (r *Runner) cmd(ctx context.Context, cm syntax.Command) {
 		r.exit = 0
 		r.stmts(ctx, x.Else)
 	case *syntax.WhileClause:
+		iters := 0
 		for !r.stop(ctx) {
 			r.stmts(ctx, x.Cond)
 			stop := (r.exit == 0) == x.Until
 			r.exit = 0
-			if stop || r.loopStmtsBroken(ctx, x.Do) {
+			if stop || r.loopLimited(&iters) || r.loopStmtsBroken(ctx, x.Do) {
 				break
 			}
 		}
 	case *syntax.ForClause:
+		iters := 0
 		switch y := x.Loop.(type) {
 		case *syntax.WordIter:
 			name := y.Name.Value
 			for _, field := range r.fields(ctx, y.Items...) {
+				if r.loopLimited(&iters) {
+					break
+				}
 				r.setVarString(ctx, name, field)
 				if r.loopStmtsBroken(ctx, x.Do) {
 					break
@@ -686,7 +926,7 @@ func (r *Runner) cmd(ctx context.Context, cm syntax.Command) {
 		case *syntax.CStyleLoop:
 			r.arithm(ctx, y.Init)
 			for r.arithm(ctx, y.Cond) != 0 {
-				if r.loopStmtsBroken(ctx, x.Do) {
+				if r.loopLimited(&iters) || r.loopStmtsBroken(ctx, x.Do) {
 					break
 				}
 				r.arithm(ctx, y.Post)
@@ -721,10 +961,12 @@ func (r *Runner) cmd(ctx context.Context, cm syntax.Command) {
 		}
 	case *syntax.DeclClause:
 		local := false
-		var modes []string
+		// attrs holds the attributes to set or unset, such as 'x' for
+		// exporting, which "+x" turns off.
+		attrs := make(map[byte]bool)
 		valType := ""
 		switch x.Variant.Value {
-		case "declare":
+		case "declare", "typeset":
 			// When used in a function, "declare" acts as
 			// "local" unless the "-g" option is used.
 			local = r.inFunc
@@ -736,45 +978,68 @@ func (r *Runner) cmd(ctx context.Context, cm syntax.Command) {
 			}
 			local = true
 		case "export":
-			modes = append(modes, "-x")
+			attrs['x'] = true
 		case "readonly":
-			modes = append(modes, "-r")
+			attrs['r'] = true
 		case "nameref":
-			modes = append(modes, "-n")
+			attrs['n'] = true
 		}
+		traced := []string{x.Variant.Value}
 		for _, opt := range x.Opts {
-			switch s := r.loneWord(ctx, opt); s {
-			case "-x", "-r", "-n":
-				modes = append(modes, s)
-			case "-a", "-A":
-				valType = s
-			case "-g":
-				local = false
-			default:
+			s := r.loneWord(ctx, opt)
+			traced = append(traced, traceQuote(s))
+			if len(s) < 2 || (s[0] != '-' && s[0] != '+') {
 				r.errf("declare: invalid option %q\n", s)
 				r.exit = 2
 				return
 			}
+			set := s[0] == '-'
+			for i := 1; i < len(s); i++ {
+				switch c := s[i]; {
+				case c == 'x', c == 'n', c == 'i', c == 'r' && set:
+					attrs[c] = set
+				case c == 'a', c == 'A':
+					if set {
+						valType = "-" + string(c)
+					}
+				case c == 'g':
+					if set {
+						local = false
+					}
+				default:
+					r.errf("declare: invalid option %q\n", s)
+					r.exit = 2
+					return
+				}
+			}
 		}
 		for _, as := range x.Assigns {
 			for _, as := range r.expandAssigns(ctx, as) {
 				name := as.Name.Value
 				vr, _ := r.lookupVar(as.Name.Value)
-				vr.Value = r.assignVal(ctx, as, valType)
+				vr.Value = r.assignVal(ctx, as, valType, attrs['i'])
 				vr.Local = local
-				for _, mode := range modes {
-					switch mode {
-					case "-x":
-						vr.Exported = true
-					case "-r":
-						vr.ReadOnly = true
-					case "-n":
-						vr.NameRef = true
+				if as.Naked {
+					traced = append(traced, name)
+				} else {
+					traced = append(traced, r.traceAssign(as, vr.Value, true))
+				}
+				for c, set := range attrs {
+					switch c {
+					case 'x':
+						vr.Exported = set
+					case 'r':
+						vr.ReadOnly = set
+					case 'n':
+						vr.NameRef = set
+					case 'i':
+						vr.Integer = set
 					}
 				}
 				r.setVar(ctx, name, as.Index, vr)
 			}
 		}
+		r.trace(ctx, traced...)
 	case *syntax.TimeClause:
 		start := time.Now()
 		if x.Stmt != nil {
@@ -813,17 +1078,13 @@ func (r *Runner) stmts(ctx context.Context, sl syntax.StmtList) {
 
 func (r *Runner) redir(ctx context.Context, rd *syntax.Redirect) (io.Closer, error) {
 	if rd.Hdoc != nil {
-		hdoc := r.loneWord(ctx, rd.Hdoc)
+		hdoc := r.document(ctx, rd.Hdoc)
 		r.Stdin = strings.NewReader(hdoc)
 		return nil, nil
 	}
 	orig := &r.Stdout
-	if rd.N != nil {
-		switch rd.N.Value {
-		case "1":
-		case "2":
-			orig = &r.Stderr
-		}
+	if rd.Fd() == 2 {
+		orig = &r.Stderr
 	}
 	arg := r.loneWord(ctx, rd.Word)
 	switch rd.Op {
@@ -871,9 +1132,8 @@ func (r *Runner) redir(ctx context.Context, rd *syntax.Redirect) (io.Closer, err
 }
 
 func (r *Runner) loopStmtsBroken(ctx context.Context, sl syntax.StmtList) bool {
-	oldInLoop := r.inLoop
-	r.inLoop = true
-	defer func() { r.inLoop = oldInLoop }()
+	r.loopDepth++
+	defer func() { r.loopDepth-- }()
 	for _, stmt := range sl.Stmts {
 		r.stmt(ctx, stmt)
 		if r.contnEnclosing > 0 {
@@ -905,9 +1165,11 @@ func (r *Runner) call(ctx context.Context, pos syntax.Pos, args []string) {
 		oldFuncVars := r.funcVars
 		r.funcVars = nil
 		r.inFunc = true
+		r.funcStack = append(r.funcStack, name)
 
 		r.stmt(ctx, body)
 
+		r.funcStack = r.funcStack[:len(r.funcStack)-1]
 		r.Params = oldParams
 		r.funcVars = oldFuncVars
 		r.inFunc = oldInFunc
@@ -925,8 +1187,16 @@ func (r *Runner) call(ctx context.Context, pos syntax.Pos, args []string) {
 }
 
 func (r *Runner) exec(ctx context.Context, args []string) {
-	path := r.lookPath(args[0])
+	path := r.lookPath(ctx, args[0])
+	if path != "" && !r.usage.addProc(r.Limits.Procs) {
+		r.setErr(ProcLimitError{r.Limits.Procs})
+		return
+	}
 	err := r.Exec(r.modCtx(ctx), path, args)
+	if limit := r.Limits.CPUTime; limit > 0 && r.usage.cpuTime() > limit {
+		r.setErr(CPULimitError{limit})
+		return
+	}
 	switch x := err.(type) {
 	case nil:
 		r.exit = 0
@@ -951,12 +1221,18 @@ func (r *Runner) open(ctx context.Context, path string, flags int, mode os.FileM
 	return f, err
 }
 
-func (r *Runner) stat(name string) (os.FileInfo, error) {
-	return os.Stat(r.relPath(name))
+func (r *Runner) stat(ctx context.Context, name string, followSymlinks bool) (os.FileInfo, error) {
+	info, err := r.Stat(r.modCtx(ctx), r.relPath(name), followSymlinks)
+	switch err.(type) {
+	case nil, *os.PathError:
+	default: // module's custom fatal error
+		r.setErr(err)
+	}
+	return info, err
 }
 
-func (r *Runner) checkStat(file string) string {
-	d, err := r.stat(file)
+func (r *Runner) checkStat(ctx context.Context, file string) string {
+	d, err := r.stat(ctx, file, true)
 	if err != nil {
 		return ""
 	}
@@ -978,16 +1254,16 @@ func winHasExt(file string) bool {
 	return strings.LastIndexAny(file, `:\/`) < i
 }
 
-func (r *Runner) findExecutable(file string, exts []string) string {
+func (r *Runner) findExecutable(ctx context.Context, file string, exts []string) string {
 	if len(exts) == 0 {
 		// non-windows
-		return r.checkStat(file)
+		return r.checkStat(ctx, file)
 	}
-	if winHasExt(file) && r.checkStat(file) != "" {
+	if winHasExt(file) && r.checkStat(ctx, file) != "" {
 		return file
 	}
 	for _, e := range exts {
-		if f := file + e; r.checkStat(f) != "" {
+		if f := file + e; r.checkStat(ctx, f) != "" {
 			return f
 		}
 	}
@@ -1026,7 +1302,7 @@ func splitList(path string) []string {
 	return fixed
 }
 
-func (r *Runner) lookPath(file string) string {
+func (r *Runner) lookPath(ctx context.Context, file string) string {
 	pathList := splitList(r.getVar("PATH"))
 	chars := `/`
 	if runtime.GOOS == "windows" {
@@ -1036,7 +1312,7 @@ func (r *Runner) lookPath(file string) string {
 	}
 	exts := r.pathExts()
 	if strings.ContainsAny(file, chars) {
-		return r.findExecutable(file, exts)
+		return r.findExecutable(ctx, file, exts)
 	}
 	for _, dir := range pathList {
 		var path string
@@ -1047,7 +1323,7 @@ func (r *Runner) lookPath(file string) string {
 		default:
 			path = filepath.Join(dir, file)
 		}
-		if f := r.findExecutable(path, exts); f != "" {
+		if f := r.findExecutable(ctx, path, exts); f != "" {
 			return f
 		}
 	}
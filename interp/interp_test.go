@@ -52,6 +52,45 @@ let i=(2 + 3)
 	}
 }
 
+// BenchmarkFields measures the expansion of words, from a single word to
+// thousands of them, without running any commands.
+func BenchmarkFields(b *testing.B) {
+	words := `"${name:-default}" ${arr[@]} $((i * 2 + 1)) {a,b,c}-${x#pre} "$x $y" 'lit' `
+	for _, bc := range []struct {
+		name, src string
+	}{
+		{"Small", "$HOME/bin"},
+		{"Medium", words},
+		{"Huge", strings.Repeat(words, 1000)},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			file, err := syntax.NewParser().Parse(strings.NewReader("echo "+bc.src), "")
+			if err != nil {
+				b.Fatal(err)
+			}
+			args := file.Stmts[0].Cmd.(*syntax.CallExpr).Args[1:]
+			setup, err := syntax.NewParser().Parse(strings.NewReader(
+				"name=foo arr=(a b c) i=3 x=prefix y=z"), "")
+			if err != nil {
+				b.Fatal(err)
+			}
+			r, _ := New()
+			ctx := context.Background()
+			if err := r.Run(ctx, setup); err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.SetBytes(int64(len(bc.src)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := r.Fields(ctx, args...); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
 var hasBash44 bool
 
 func TestMain(m *testing.M) {
@@ -101,11 +140,11 @@ var fileCases = []struct {
 	{"false; exit", "exit status 1"},
 	{"exit; echo foo", ""},
 	{"exit 0; echo foo", ""},
-	{"printf", "usage: printf format [arguments]\nexit status 2 #JUSTERR"},
-	{"break", "break is only useful in a loop #JUSTERR"},
-	{"continue", "continue is only useful in a loop #JUSTERR"},
+	{"printf", "usage: printf [-v var] format [arguments]\nexit status 2 #JUSTERR"},
+	{"break", "break is only useful in a loop\n #JUSTERR"},
+	{"continue", "continue is only useful in a loop\n #JUSTERR"},
 	{"cd a b", "usage: cd [dir]\nexit status 2 #JUSTERR"},
-	{"shift a", "usage: shift [n]\nexit status 2 #JUSTERR"},
+	{"shift a", "shift: a: numeric argument required\nexit status 1 #JUSTERR"},
 	{
 		"shouldnotexist",
 		"\"shouldnotexist\": executable file not found in $PATH\nexit status 127 #JUSTERR",
@@ -118,6 +157,14 @@ var fileCases = []struct {
 		"for i in 1; do break a; done",
 		"usage: break [n]\nexit status 2 #JUSTERR",
 	},
+	{
+		"for i in 1 2; do break 0; done",
+		"break: 0: loop count out of range\nexit status 1 #JUSTERR",
+	},
+	{
+		"for i in 1 2; do for j in a; do continue -1; done; done",
+		"continue: -1: loop count out of range\nexit status 1 #JUSTERR",
+	},
 
 	// we don't need to follow bash error strings
 	{"exit a", "invalid exit status code: \"a\"\nexit status 2 #JUSTERR"},
@@ -151,6 +198,11 @@ var fileCases = []struct {
 	{"printf %i,%u -3 -3", "-3,18446744073709551613"},
 	{"printf %o -3", "1777777777777777777775"},
 	{"printf %x -3", "fffffffffffffffd"},
+	{`printf '%d,%x,%d' "'A" "'a" '"b'`, "65,61,98"},
+	{"printf '%d,%d,%o' ' 12' +0x1f 0", "12,31,0"},
+	{"printf '%d|' 0b1 2>/dev/null", "0|exit status 1"},
+	{"printf '%d|' 0o7 12abc 3 2>&1", "printf: 0o7: invalid number\n0|printf: 12abc: invalid number\n12|3|exit status 1"},
+	{"printf %x 09", "printf: 09: invalid number\n0exit status 1 #JUSTERR"},
 	{"printf %c,%c,%c foo àa", "f,\xc3,\x00"}, // TODO: use a rune?
 	{"printf %3s a", "  a"},
 	{"printf %3i 1", "  1"},
@@ -161,6 +213,28 @@ var fileCases = []struct {
 	{"printf 'nofmt' 1 2 3", "nofmt"},
 	{"printf '%d_' 1 2 3", "1_2_3_"},
 	{"printf '%02d %02d\n' 1 2 3", "01 02\n03 00\n"},
+	{"printf %X,%#x,%#o 255 255 8", "FF,0xff,010"},
+	{"printf %.3s,%5.1s, abcdef xyz", "abc,    x,"},
+	{"printf %.2f,%5.1f,%e 3.14159 2 1234.5", "3.14,  2.0,1.234500e+03"},
+	{"printf %g,%G 0.5 1e20", "0.5,1E+20"},
+	{"printf %-+5d. 3", "+3   ."},
+	{"printf %.f 1", "1"},
+	{"printf %5.2.1f 1", "invalid format char: .\nexit status 1 #JUSTERR"},
+	{`printf '[%b]' 'a\tb' '\0101\x41' 'x\\y'`, "[a\tb][AA][x\\y]"},
+	{`printf '%b|%s\n' 'a\cb' c d; echo end`, "aend\n"},
+	{`printf '%5b|' 'a\n'`, "   a\n|"},
+	{`printf '%q\n' 'a b' "it's" '' a=b a,b '#x' x# '~x' 'a^b' a:b`,
+		"a\\ b\nit\\'s\n''\na=b\na\\,b\n\\#x\nx#\n\\~x\na\\^b\na:b\n"},
+	{`printf '%q\n' $'a\tb' $'a\nb' "$(printf %b '\001')"`, "$'a\\tb'\n$'a\\nb'\n$'\\001'\n"},
+	{`printf '%q\n' 'a=~x' 'a:~b' x~ é 'é ü' $'é\n' "$(printf %b '\0377')" "it's"$'\n'`,
+		"a=\\~x\na:\\~b\nx~\né\né\\ ü\n$'é\\n'\n$'\\377'\n$'it\\'s\\n'\n"},
+	{`printf '%(%Y %S)T|%(%s|%j|%%)T|%6(%y)T\n' 1500000045 216000 1500000000`, "2017 45|216000|003|%|    17\n"},
+	{`printf '%(%Y' 0`, "missing format char\nexit status 1 #JUSTERR"},
+	{"printf -v foo %s-%d bar 3; echo $foo", "bar-3\n"},
+	{"printf -v foo '%s,' a b c; echo $foo", "a,b,c,\n"},
+	{"printf -v foo ''; echo \"[$foo]\"", "[]\n"},
+	{"printf -v 1a foo", "printf: invalid variable name: \"1a\"\nexit status 2 #JUSTERR"},
+	{"printf -- '%s\n' -v", "-v\n"},
 
 	// words and quotes
 	{"echo  foo ", "foo\n"},
@@ -221,6 +295,13 @@ var fileCases = []struct {
 	{"[[ -n $$ && $$ -gt 0 ]]", ""},
 	{"[[ -n $PPID && $PPID -gt 0 ]]", ""},
 	{"[[ $$ -eq $PPID ]]", "exit status 1"},
+	{"[[ $RANDOM -ge 0 && $RANDOM -lt 32768 ]]", ""},
+	{"RANDOM=3; a=$RANDOM; RANDOM=3; [[ $a == $RANDOM ]]", ""},
+	{"SECONDS=10; echo $SECONDS", "10\n"},
+	{
+		"f() { echo ${FUNCNAME[@]}; }; g() { f; }; g; echo ${FUNCNAME-none}",
+		"f g main\nnone\n",
+	},
 
 	// var manipulation
 	{"echo ${#a} ${#a[@]}", "0 0\n"},
@@ -269,6 +350,7 @@ var fileCases = []struct {
 	{"a='[[:wrong:]]'; echo ${a//[[:wrong:]]}", "[[:wrong:]]\n"},
 	{"a='[[:wrong:]]'; echo ${a//[[:}", "[[:wrong:]]\n"},
 	{"a='abcx1y'; echo ${a//x[[:digit:]]y}", "abc\n"},
+	{"a='aé1'; echo ${a//[[:alpha:]]/x}", "xé1\n"},
 	{`a=xyz; echo "${a/y/a  b}"`, "xa  bz\n"},
 	{"a='foo/bar'; echo ${a//o*a/}", "fr\n"},
 	{
@@ -359,6 +441,10 @@ var fileCases = []struct {
 		`a='b  c'; eval "echo -n ${a} ${a@Q}"`,
 		`b c b  c`,
 	},
+	{
+		`for a in '' a=b "it's" 'é ü' $'a\tb' "$(printf %b '\0377')"; do echo "${a@Q}"; done`,
+		"''\n'a=b'\n'it'\\''s'\n'é ü'\n$'a\\tb'\n$'\\377'\n",
+	},
 	{
 		`a='"\n'; printf "%s %s" "${a}" "${a@E}"`,
 		"\"\\n \"\n",
@@ -463,6 +549,14 @@ var fileCases = []struct {
 		"for i in 1 2; do for j in a b; do echo $i $j; continue 2; done; done",
 		"1 a\n2 a\n",
 	},
+	{
+		"for i in 1 2; do break 5; done; for i in 1 2; do echo $i; done",
+		"1\n2\n",
+	},
+	{
+		"for i in 1 2; do for j in a b; do echo $i $j; continue 9; done; done; for k in x y; do echo $k; done",
+		"1 a\n2 a\nx\ny\n",
+	},
 	{
 		"for ((i=0; i<3; i++)); do echo $i; done",
 		"0\n1\n2\n",
@@ -537,6 +631,8 @@ var fileCases = []struct {
 		"[[ ~noexist == '~noexist' ]]",
 		"",
 	},
+	{`echo "~" "~/foo"`, "~ ~/foo\n"},
+	{"cat <<EOF\n~ ~/foo\nEOF", "~ ~/foo\n"},
 	{
 		"[[ ~root == '~root' ]]",
 		"exit status 1",
@@ -976,6 +1072,10 @@ var fileCases = []struct {
 		"[[ a < 3 ]]",
 		"exit status 1",
 	},
+	{
+		"[[ B < a && é > z ]]",
+		"",
+	},
 	{
 		"[[ 3 == 03 ]]",
 		"exit status 1",
@@ -1335,6 +1435,14 @@ var fileCases = []struct {
 		"echo $((-1 * 6 / 2))",
 		"-3\n",
 	},
+	{
+		"echo $((1 - 2 - 3)) $((12 / 3 / 2)) $((1 | 2 ^ 3 & 4)) $((0 && 1 || 1))",
+		"-4 2 3 1\n",
+	},
+	{
+		"[[ a && '' || c ]] && [[ ! '' && a ]] && echo ok",
+		"ok\n",
+	},
 	{
 		"a=2; echo $(( a + $a + c ))",
 		"4\n",
@@ -1383,6 +1491,46 @@ var fileCases = []struct {
 		"echo $((1 ? 2 : 3)) $((0 ? 2 : 3))",
 		"2 3\n",
 	},
+	{
+		"echo $((2 ? 5 : 6)) $((1 ? 0 ? 7 : 8 : 9)) $((1 ? a = 3 : 4)) $a",
+		"5 8 3 3\n",
+	},
+	{
+		"echo $((0x1f)) $((0755)) $((2#1011)) $((16#FF)) $((64#_))",
+		"31 493 11 255 63\n",
+	},
+	{
+		"a=010; b=0x10; echo $((a + b))",
+		"24\n",
+	},
+	{
+		"echo $((09))",
+		"09: invalid number\nexit status 1 #JUSTERR",
+	},
+	{
+		"a='1 + 2'; b=a; echo $((b * 2))",
+		"6\n",
+	},
+	{
+		"a='$(echo 1)'; echo $((a))",
+		"$(echo 1): syntax error in expression\nexit status 1 #JUSTERR",
+	},
+	{
+		"a=a+1; echo $((a))",
+		"a+1: expression recursion level exceeded\nexit status 1 #JUSTERR",
+	},
+	{
+		"i=0; echo $((0 && i++)) $((1 || i++)) $i",
+		"0 1 0\n",
+	},
+	{
+		"echo $((a[1, 2] = 3)) ${a[2]} $((a[2]++)) $((a[2] <<= 1)) ${a[@]}",
+		"3 3 3 8 8\n",
+	},
+	{
+		"i=0; a=(1 2); echo $((a[i++] += 5)) $i ${a[@]}",
+		"6 1 6 2\n",
+	},
 	{
 		"((1))",
 		"",
@@ -1403,6 +1551,10 @@ var fileCases = []struct {
 		"a=1; let a++; echo $a",
 		"2\n",
 	},
+	{
+		"let 'a = 1, b = 2' 'c = a ? b : 0'; echo $a $b $c",
+		"1 2 2\n",
+	},
 	{
 		"a=$((1 + 2)); echo $a",
 		"3\n",
@@ -1429,6 +1581,46 @@ var fileCases = []struct {
 		"set -- a b; echo $#",
 		"2\n",
 	},
+	{
+		"set -- a b; set -f; echo $#; set --; echo $#",
+		"2\n0\n",
+	},
+	{
+		"set -- a b c; shift 3; echo $# $?",
+		"0 0\n",
+	},
+	{
+		"set -- a b; shift 3; echo $? $1",
+		"1 a\n",
+	},
+	{
+		"set -- a b; shift -1",
+		"shift: -1: shift count out of range\nexit status 1 #JUSTERR",
+	},
+	{
+		`set -- a 'b c' d e; printf '[%s]' ${@:2} "${@:2:2}" "${@: -1}"`,
+		"[b][c][d][e][b c][d][e]",
+	},
+	{
+		`set -- a b c; echo "${@:0:2}" "$0"`,
+		"gosh a gosh\n",
+	},
+	{
+		`set -- a b c; echo ${@:1:-1}; echo after`,
+		"-1: substring expression < 0\nexit status 1 #JUSTERR",
+	},
+	{
+		`set -- abc; echo ${1:1:-1} ${@:1:0}`,
+		"b\n",
+	},
+	{
+		`set -- a 'b c' d; IFS=-; printf '[%s]' "$*" "${*:2}" "x$@y"`,
+		"[a-b c-d][b c-d][xa][b c][dy]",
+	},
+	{
+		`set -- a b; unset IFS; echo "$*"; IFS=; echo "$*"`,
+		"a b\nab\n",
+	},
 	{
 		"set -U",
 		"set: invalid option: \"-U\"\nexit status 2 #JUSTERR",
@@ -1512,9 +1704,26 @@ set +o noexec
 set +o noglob
 set +o nounset
 set +o pipefail
+set +o xtrace
  #IGNORE`,
 	},
 
+	// xtrace
+	{"set -x; echo foo 'a b'", "+ echo foo 'a b'\nfoo a b\n"},
+	{"set -x; echo '' \"it's\" '~a' a~ 'a*' a=b", "+ echo '' 'it'\\''s' '~a' a~ 'a*' a=b\n it's ~a a~ a* a=b\n"},
+	{"set -x; : '#' a#", "+ : '#' a#\n"},
+	{"set -x; a=1 b='c d'; echo $b", "+ a=1\n+ b='c d'\n+ echo c d\nc d\n"},
+	{"set -x; a=(x 'y z'); a[1]=w", "+ a=(x 'y z')\n+ a[1]=w\n #IGNORE"},
+	{"set -x; a=x true", "+ a=x\n+ true\n"},
+	{"set -x; echo $(echo x)", "++ echo x\n+ echo x\nx\n"},
+	{"set -x; eval 'echo ev'", "+ eval 'echo ev'\n++ echo ev\nev\n"},
+	{"set -x; f() { echo in; }; f", "+ f\n+ echo in\nin\n"},
+	{"set -x; declare -x 'd=e f' g; set +x", "+ declare -x 'd=e f' g\n+ set +x\n"},
+	{"PS4='[$a] '; a=z; set -x; : foo", "[z] : foo\n"},
+	{"PS4=; set -x; : foo; set -u; unset PS4; : bar", ": foo\nset -u\nunset PS4\n: bar\n"},
+	{"set -o xtrace; set +o xtrace; echo foo", "+ set +o xtrace\nfoo\n"},
+	{"set -x; (echo sub)", "+ echo sub\nsub\n"},
+
 	// unset
 	{
 		"a=1; echo $a; unset a; echo $a",
@@ -1569,6 +1778,12 @@ set +o pipefail
 	{`a="  x y z"; IFS=; echo $a`, "  x y z\n"},
 	{`a=(x y z); IFS=; echo "${a[*]}"`, "xyz\n"},
 	{`a=(x y z); IFS=-; echo "${!a[@]}"`, "0 1 2\n"},
+	{`a="x::y:"; IFS=:; printf '[%s]' $a`, "[x][][y]"},
+	{`a=":x"; IFS=:; printf '[%s]' $a p$a`, "[][x][p][x]"},
+	{`a="x:"; IFS=:; printf '[%s]' ${a}p`, "[x][p]"},
+	{`a=" : x : "; IFS=" :"; printf '[%s]' $a p${a}q`, "[][x][p][x][q]"},
+	{`a=" x "; printf '[%s]' p${a}q`, "[p][x][q]"},
+	{`a=":"; IFS=:; set -- $a; echo $#`, "1\n"},
 
 	// builtin
 	{"builtin", ""},
@@ -1586,6 +1801,25 @@ set +o pipefail
 	{"type bash | grep -q -E 'bash is (/|[A-Z]:).*'", ""},
 	{"type noexist", "type: noexist: not found\nexit status 1 #JUSTERR"},
 
+	// trap
+	{"trap", ""},
+	{"trap 'echo bye' EXIT; echo hi", "hi\nbye\n"},
+	{"trap 'echo $x' EXIT; x=foo", "foo\n"},
+	{"trap 'echo $?' EXIT; exit 3", "3\nexit status 3"},
+	{"trap 'exit 4' EXIT; echo hi", "hi\nexit status 4"},
+	{"trap false EXIT", ""},
+	{"trap 'echo bye' 0; trap - EXIT; echo hi", "hi\n"},
+	{"trap 'echo bye' exit; trap EXIT", ""},
+	{"trap 'echo a' EXIT; trap -- 'echo b' EXIT", "b\n"},
+	{"f() { trap 'echo bye' EXIT; }; f; echo hi", "hi\nbye\n"},
+	{"(trap 'echo sub' EXIT; echo in); echo out", "in\nsub\nout\n"},
+	{"trap 'echo main' EXIT; (echo sub)", "sub\nmain\n"},
+	{"echo $(trap 'echo b' EXIT; echo a)", "a b\n"},
+	{"trap \"echo it's\" INT; trap -p", "trap -- 'echo it'\\''s' SIGINT\n"},
+	{"trap 'echo x' INT TERM; trap -p TERM", "trap -- 'echo x' SIGTERM\n"},
+	{"trap 'echo x' FOO", "trap: FOO: invalid signal specification\nexit status 1 #JUSTERR"},
+	{"trap -x", "trap: -x: invalid option\nexit status 2 #JUSTERR"},
+
 	// eval
 	{"eval", ""},
 	{"eval ''", ""},
@@ -1685,6 +1919,42 @@ set +o pipefail
 		`a=b; echo "${a[@]}"`,
 		"b\n",
 	},
+	{
+		`a=('x y' z); IFS=-; for e in "${a[*]}" ${a[*]} ${a[@]}; do echo "[$e]"; done`,
+		"[x y-z]\n[x y]\n[z]\n[x y]\n[z]\n",
+	},
+	{
+		`a=('x y' z); for e in "<${a[@]}>" "<${a[*]}>"; do echo "$e"; done`,
+		"<x y\nz>\n<x y z>\n",
+	},
+	{
+		`a=(); for e in "${a[@]}" "${u[@]}" "${a[@]:-d}"; do echo "[$e]"; done`,
+		"[d]\n",
+	},
+	{
+		`a=(); for e in "${a[*]}" ""${a[@]}; do echo "[$e]"; done`,
+		"[]\n[]\n",
+	},
+	{
+		`a=(ab ac bd); for e in "${a[@]/a/X y}" "${a[@]#a}"; do echo "[$e]"; done`,
+		"[X yb]\n[X yc]\n[bd]\n[b]\n[c]\n[bd]\n",
+	},
+	{
+		`a=(ab ac bd); echo "${a[@]:1}" "${a[*]: -1}" "${a[@]:0:2}"`,
+		"ac bd bd ab ac\n",
+	},
+	{
+		`a=str; echo "${a[@]:1}"`,
+		"tr\n",
+	},
+	{
+		`set -- 'a b' c d; for e in "${@:2}" "${*:1:1}"; do echo "[$e]"; done`,
+		"[c]\n[d]\n[a b]\n",
+	},
+	{
+		`set --; for e in "$@" "x$@y"; do echo "[$e]"; done`,
+		"[xy]\n",
+	},
 
 	// associative arrays
 	{
@@ -1857,6 +2127,19 @@ set +o pipefail
 		"foo: readonly variable\nexit status 1 #JUSTERR",
 	},
 
+	// integer vars
+	{"declare -i n=5; n+=3; echo $n", "8\n"},
+	{"declare -i n; n=2*3; echo $n; n=x; echo $n", "6\n0\n"},
+	{"x=4; declare -i n=x+1; echo $n", "5\n"},
+	{"typeset -i n=1; n+=n; echo $n", "2\n"},
+	{"n=5; n+=3; echo $n", "53\n"},
+	{"declare -i n=1; declare +i n; n+=3; echo $n", "13\n"},
+	{"declare -ri z=4; echo $z", "4\n"},
+	{
+		"declare -ri z=2+2; echo $z; z=5",
+		"4\nz: readonly variable\nexit status 1 #JUSTERR",
+	},
+
 	// multiple var modes at once
 	{
 		"declare -r -x foo=bar; env | grep '^foo='",
@@ -1866,6 +2149,22 @@ set +o pipefail
 		"declare -r -x foo=bar; foo=x",
 		"foo: readonly variable\nexit status 1 #JUSTERR",
 	},
+	{
+		"declare -rx foo=bar; env | grep '^foo='; foo=x",
+		"foo=bar\nfoo: readonly variable\nexit status 1 #JUSTERR",
+	},
+	{
+		"export foo=bar; declare +x foo; env | grep '^foo='",
+		"exit status 1",
+	},
+	{
+		"typeset -x foo=bar; env | grep '^foo='",
+		"foo=bar\n",
+	},
+	{
+		"f() { typeset a=1; typeset -g b=2; }; f; echo $a $b",
+		"2\n",
+	},
 
 	// glob
 	{"echo .", ".\n"},
@@ -1919,6 +2218,30 @@ set +o pipefail
 		"shopt -s globstar; mkdir -p a/b/c; echo **/c | sed 's@\\\\@/@g'",
 		"a/b/c\n",
 	},
+	{
+		"mkdir -p a/b; touch c; echo */ | sed 's@\\\\@/@g'",
+		"a/\n",
+	},
+	{
+		"touch b B a _; echo *",
+		"B _ a b\n",
+	},
+	{
+		"touch .hidden a; shopt -s dotglob; echo *",
+		".hidden a\n",
+	},
+	{
+		"shopt -s nullglob; set -- *.x foo; echo $#",
+		"1\n",
+	},
+	{
+		"shopt -s failglob; echo *.x; echo after",
+		"no match: *.x\nexit status 1 #JUSTERR",
+	},
+	{
+		"shopt -s failglob; touch a.x; echo *.x",
+		"a.x\n",
+	},
 
 	// brace expansion; more exhaustive tests in the syntax package
 	{"echo a}b", "a}b\n"},
@@ -1986,6 +2309,50 @@ set +o pipefail
 		"read a b <<< 'foo  bar  baz  '; echo \"$a\"; echo \"$b\"",
 		"foo\nbar  baz\n",
 	},
+	{
+		"read a <<< '  foo  bar  '; echo \"[$a]\"",
+		"[foo  bar]\n",
+	},
+	{
+		"IFS= read a <<< '  foo  bar  '; echo \"[$a]\"",
+		"[  foo  bar  ]\n",
+	},
+	{
+		"IFS=: read a <<< ':foo:'; echo \"[$a]\"",
+		"[:foo:]\n",
+	},
+	{
+		"read -ra arr <<< 'a b\\ c  d'; echo ${#arr[@]} \"${arr[1]}\"",
+		"4 b\\\n",
+	},
+	{
+		"read -a arr <<< 'a b\\ c'; echo ${#arr[@]} \"${arr[1]}\"",
+		"2 b c\n",
+	},
+	{
+		"read -a",
+		"read: -a: option requires an argument\nexit status 2 #JUSTERR",
+	},
+	{
+		"printf 'l1\\n l2 \\n' | while IFS= read -r line; do echo \"<$line>\"; done",
+		"<l1>\n< l2 >\n",
+	},
+	{
+		"printf 'x\\ny z\\nw' | { mapfile -t l; echo ${#l[@]} \"${l[1]}\" \"${l[2]}\"; }",
+		"3 y z w\n",
+	},
+	{
+		"printf 'x\\ny\\n' | { readarray; printf '[%s]' \"${MAPFILE[@]}\"; }",
+		"[x\n][y\n]",
+	},
+	{
+		"mapfile -x",
+		"mapfile: invalid option \"-x\"\nexit status 2 #JUSTERR",
+	},
+	{
+		"a=x; a+=; b=; echo \"[$a][$b]\"",
+		"[x][]\n",
+	},
 	{
 		"while read a; do echo $a; done <<< 'a\nb\nc'",
 		"a\nb\nc\n",
@@ -2372,6 +2739,126 @@ func TestRunnerAltNodes(t *testing.T) {
 	}
 }
 
+var runSubstTests = []struct {
+	in, want string
+	wantErr  error
+}{
+	{"$(echo foo)", "foo", nil},
+	{"$(echo foo; echo; echo)", "foo", nil},
+	{"$(printf 'a\nb\n')", "a\nb", nil},
+	{"$(echo $FOO)", "bar", nil},
+	{"$(shout hey)", "HEY", nil},
+	{"$(echo foo; false)", "foo", ExitStatus(1)},
+	{"`echo foo; exit 3`", "foo", ShellExitStatus(3)},
+}
+
+func TestRunSubst(t *testing.T) {
+	t.Parallel()
+	env, _ := EnvFromList([]string{"FOO=bar"})
+	exec := func(ctx context.Context, path string, args []string) error {
+		if args[0] != "shout" {
+			return DefaultExec(ctx, path, args)
+		}
+		mc, _ := FromModuleContext(ctx)
+		fmt.Fprintln(mc.Stdout, strings.ToUpper(strings.Join(args[1:], " ")))
+		return nil
+	}
+	p := syntax.NewParser()
+	for i, tc := range runSubstTests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			file, err := p.Parse(strings.NewReader("echo "+tc.in), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			call := file.Stmts[0].Cmd.(*syntax.CallExpr)
+			cs := call.Args[1].Parts[0].(*syntax.CmdSubst)
+			ctx := context.Background()
+			got, err := RunSubst(ctx, cs, env, Module(ModuleExec(exec)))
+			if err != tc.wantErr {
+				t.Fatalf("wrong error in %q: want %v, got %v",
+					tc.in, tc.wantErr, err)
+			}
+			if got != tc.want {
+				t.Fatalf("wrong output in %q:\nwant: %q\ngot:  %q",
+					tc.in, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRunnerTrace(t *testing.T) {
+	t.Parallel()
+	file, err := syntax.NewParser().Parse(strings.NewReader("echo foo $(echo bar)"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out, trace bytes.Buffer
+	r, _ := New(StdIO(nil, &out, &out), Params("-x"))
+	r.Trace = &trace
+	if err := r.Run(context.Background(), file); err != nil {
+		t.Fatal(err)
+	}
+	if want := "foo bar\n"; out.String() != want {
+		t.Fatalf("wrong output:\nwant: %q\ngot:  %q", want, out.String())
+	}
+	if want := "++ echo bar\n+ echo foo bar\n"; trace.String() != want {
+		t.Fatalf("wrong trace:\nwant: %q\ngot:  %q", want, trace.String())
+	}
+}
+
+func TestRunnerCollate(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "interp-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := "touch b B a; echo *; [[ a < B ]] && echo before"
+	file, err := syntax.NewParser().Parse(strings.NewReader(src), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	r, _ := New(StdIO(nil, &out, &out), Dir(dir))
+	r.Collate = func(a, b string) int {
+		if c := strings.Compare(strings.ToLower(a), strings.ToLower(b)); c != 0 {
+			return c
+		}
+		return -strings.Compare(a, b) // lower case first
+	}
+	if err := r.Run(context.Background(), file); err != nil {
+		t.Fatal(err)
+	}
+	if want := "a b B\nbefore\n"; out.String() != want {
+		t.Fatalf("wrong output:\nwant: %q\ngot:  %q", want, out.String())
+	}
+}
+
+func TestRunnerDynamicVars(t *testing.T) {
+	t.Parallel()
+	src := "echo $RANDOM $RANDOM $SECONDS\necho $LINENO"
+	file, err := syntax.NewParser().Parse(strings.NewReader(src), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	r, _ := New(StdIO(nil, &out, &out))
+	n := 0
+	r.Random = func() int { n++; return n }
+	now := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.Now = func() time.Time {
+		now = now.Add(3 * time.Second)
+		return now
+	}
+	r.Line = func(pos syntax.Pos) uint { return pos.Line() + 10 }
+	if err := r.Run(context.Background(), file); err != nil {
+		t.Fatal(err)
+	}
+	if want := "1 2 3\n12\n"; out.String() != want {
+		t.Fatalf("wrong output:\nwant: %q\ngot:  %q", want, out.String())
+	}
+}
+
 func TestElapsedString(t *testing.T) {
 	t.Parallel()
 	tests := []struct {
@@ -0,0 +1,139 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package interp
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Limits caps the resources that a shell program may use, to safely run
+// untrusted snippets. A zero field means no limit. When a limit is
+// exceeded, the interpreter comes to a stop, and Run returns an error of
+// the matching type, such as ProcLimitError.
+//
+// The process and CPU time limits apply to a runner and all of its
+// subshells, until it is reset.
+type Limits struct {
+	// Procs is the number of programs that may be executed.
+	Procs int
+
+	// CPUTime is the total user and system CPU time that executed
+	// programs may use. It is only measured by DefaultExec, and checked
+	// each time a program exits.
+	CPUTime time.Duration
+
+	// SubstOutput is the number of bytes that each command substitution
+	// may capture, including any trailing newlines.
+	SubstOutput int
+
+	// LoopIters is the number of iterations that each loop may run.
+	LoopIters int
+}
+
+// ProcLimitError is returned when a program would exceed Limits.Procs.
+type ProcLimitError struct {
+	Limit int
+}
+
+func (e ProcLimitError) Error() string {
+	return fmt.Sprintf("process limit of %d exceeded", e.Limit)
+}
+
+// CPULimitError is returned when the executed programs exceed
+// Limits.CPUTime.
+type CPULimitError struct {
+	Limit time.Duration
+}
+
+func (e CPULimitError) Error() string {
+	return fmt.Sprintf("CPU time limit of %v exceeded", e.Limit)
+}
+
+// OutputLimitError is returned when a command substitution exceeds
+// Limits.SubstOutput.
+type OutputLimitError struct {
+	Limit int
+}
+
+func (e OutputLimitError) Error() string {
+	return fmt.Sprintf("command substitution output limit of %d bytes exceeded", e.Limit)
+}
+
+// LoopLimitError is returned when a loop exceeds Limits.LoopIters.
+type LoopLimitError struct {
+	Limit int
+}
+
+func (e LoopLimitError) Error() string {
+	return fmt.Sprintf("loop iteration limit of %d exceeded", e.Limit)
+}
+
+// limitUsage is the usage of the resources limited for a runner and its
+// subshells.
+type limitUsage struct {
+	mu    sync.Mutex
+	procs int
+	cpu   time.Duration
+}
+
+// addProc counts a program about to be executed, reporting whether the
+// limit allows it.
+func (u *limitUsage) addProc(limit int) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if limit > 0 && u.procs >= limit {
+		return false
+	}
+	u.procs++
+	return true
+}
+
+func (u *limitUsage) addCPU(d time.Duration) {
+	u.mu.Lock()
+	u.cpu += d
+	u.mu.Unlock()
+}
+
+func (u *limitUsage) cpuTime() time.Duration {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.cpu
+}
+
+// limitWriter writes up to a number of bytes, failing with an
+// OutputLimitError once they are exceeded.
+type limitWriter struct {
+	w     io.Writer
+	limit int
+	left  int
+	over  int32 // atomic, as programs may write in the background
+}
+
+func (lw *limitWriter) Write(p []byte) (int, error) {
+	if len(p) <= lw.left {
+		lw.left -= len(p)
+		return lw.w.Write(p)
+	}
+	n, _ := lw.w.Write(p[:lw.left])
+	lw.left = 0
+	atomic.StoreInt32(&lw.over, 1)
+	return n, OutputLimitError{lw.limit}
+}
+
+func (lw *limitWriter) exceeded() bool { return atomic.LoadInt32(&lw.over) != 0 }
+
+// loopLimited counts a loop iteration, stopping the interpreter if it
+// exceeds the limit.
+func (r *Runner) loopLimited(iters *int) bool {
+	*iters++
+	if limit := r.Limits.LoopIters; limit > 0 && *iters > limit {
+		r.setErr(LoopLimitError{limit})
+		return true
+	}
+	return false
+}
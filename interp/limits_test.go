@@ -0,0 +1,121 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package interp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"mvdan.cc/sh/syntax"
+)
+
+var limitsCases = []struct {
+	limits  Limits
+	src     string
+	want    string
+	wantErr error
+}{
+	{
+		Limits{LoopIters: 3},
+		"for i in 1 2 3; do echo $i; done",
+		"1\n2\n3\n", nil,
+	},
+	{
+		Limits{LoopIters: 3},
+		"for i in 1 2 3 4; do echo $i; done; echo after",
+		"1\n2\n3\n", LoopLimitError{3},
+	},
+	{
+		Limits{LoopIters: 5},
+		"while true; do :; done",
+		"", LoopLimitError{5},
+	},
+	{
+		Limits{LoopIters: 2},
+		"until false; do echo x; done",
+		"x\nx\n", LoopLimitError{2},
+	},
+	{
+		Limits{LoopIters: 10},
+		"for ((i = 0; i < 100; i++)); do :; done",
+		"", LoopLimitError{10},
+	},
+	{
+		Limits{LoopIters: 2},
+		"for i in 1 2; do for j in a b; do echo $i$j; done; done",
+		"1a\n1b\n2a\n2b\n", nil,
+	},
+	{
+		Limits{SubstOutput: 4},
+		"echo $(echo foo)",
+		"foo\n", nil,
+	},
+	{
+		Limits{SubstOutput: 3},
+		"echo $(echo foobar); echo after",
+		"", OutputLimitError{3},
+	},
+	{
+		Limits{SubstOutput: 10},
+		"a=$(while true; do echo foo; done)",
+		"", OutputLimitError{10},
+	},
+	{
+		Limits{SubstOutput: 10},
+		"a=$(sh -c 'echo foobarbazfoobar')",
+		"", OutputLimitError{10},
+	},
+	{
+		Limits{SubstOutput: 2},
+		"echo foobar",
+		"foobar\n", nil,
+	},
+	{
+		Limits{Procs: 2},
+		"sh -c 'echo 1'; sh -c 'echo 2'",
+		"1\n2\n", nil,
+	},
+	{
+		Limits{Procs: 2},
+		"sh -c 'echo 1'; (sh -c 'echo 2'); sh -c 'echo 3'",
+		"1\n2\n", ProcLimitError{2},
+	},
+	{
+		Limits{Procs: 1},
+		"echo builtins; true; sh -c 'echo 1'",
+		"builtins\n1\n", nil,
+	},
+	{
+		Limits{CPUTime: time.Nanosecond},
+		"sh -c 'i=0; while [ $i -lt 10000 ]; do i=$((i+1)); done'; echo after",
+		"", CPULimitError{time.Nanosecond},
+	},
+}
+
+func TestLimits(t *testing.T) {
+	t.Parallel()
+	p := syntax.NewParser()
+	for i, tc := range limitsCases {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			file, err := p.Parse(strings.NewReader(tc.src), "")
+			if err != nil {
+				t.Fatalf("could not parse: %v", err)
+			}
+			var buf bytes.Buffer
+			r, _ := New(StdIO(nil, &buf, &buf))
+			r.Limits = tc.limits
+			err = r.Run(context.Background(), file)
+			if err != tc.wantErr {
+				t.Fatalf("want error %v, got %v", tc.wantErr, err)
+			}
+			if got := buf.String(); got != tc.want {
+				t.Fatalf("want output %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
@@ -33,6 +33,8 @@ type ModuleCtx struct {
 	Stdout      io.Writer
 	Stderr      io.Writer
 	KillTimeout time.Duration
+
+	usage *limitUsage // to measure the CPU time of programs
 }
 
 // UnixPath fixes absolute unix paths on Windows, for example converting
@@ -97,6 +99,9 @@ func DefaultExec(ctx context.Context, path string, args []string) error {
 		}
 
 		err = cmd.Wait()
+		if mc.usage != nil && cmd.ProcessState != nil {
+			mc.usage.addCPU(cmd.ProcessState.UserTime() + cmd.ProcessState.SystemTime())
+		}
 	}
 
 	switch x := err.(type) {
@@ -129,9 +134,8 @@ func DefaultExec(ctx context.Context, path string, args []string) error {
 // stderr and the exit status set to 1. If the error is of any other type, the
 // interpreter will come to a stop.
 //
-// TODO: What about stat calls? They are used heavily in the builtin
-// test expressions, and also when doing a cd. Should they have a
-// separate module?
+// Files that are only inspected, such as in test expressions, go through
+// ModuleStat instead.
 type ModuleOpen func(ctx context.Context, path string, flag int, perm os.FileMode) (io.ReadWriteCloser, error)
 
 func DefaultOpen(ctx context.Context, path string, flag int, perm os.FileMode) (io.ReadWriteCloser, error) {
@@ -149,6 +153,26 @@ func OpenDevImpls(next ModuleOpen) ModuleOpen {
 	}
 }
 
+// ModuleStat is the module responsible for getting information about a
+// file. It is used for the file tests in test expressions, such as -f and
+// -nt, for cd, and to find executables.
+//
+// The path parameter is absolute and has been cleaned. If followSymlinks is
+// false, a symbolic link is described instead of the file it points to, like
+// in os.Lstat.
+//
+// Use a return error of type *os.PathError to make the file appear
+// missing. If the error is of any other type, the interpreter will come to a
+// stop.
+type ModuleStat func(ctx context.Context, path string, followSymlinks bool) (os.FileInfo, error)
+
+func DefaultStat(ctx context.Context, path string, followSymlinks bool) (os.FileInfo, error) {
+	if !followSymlinks {
+		return os.Lstat(path)
+	}
+	return os.Stat(path)
+}
+
 var _ io.ReadWriteCloser = devNull{}
 
 type devNull struct{}
@@ -22,6 +22,7 @@ var modCases = []struct {
 	name string
 	exec ModuleExec
 	open ModuleOpen
+	stat ModuleStat
 	src  string
 	want string
 }{
@@ -90,6 +91,68 @@ var modCases = []struct {
 		src:  "echo foo >/dev/null; echo bar >/tmp/x",
 		want: "non-dev: /tmp/x",
 	},
+	{
+		name: "StatSandbox",
+		stat: sandboxStat,
+		src:  "[[ -f /sbox/file ]] && echo file; [ -d /sbox/dir ] && echo dir; [[ -e /etc ]] || echo nohost",
+		want: "file\ndir\nnohost\n",
+	},
+	{
+		name: "StatSandboxNewer",
+		stat: sandboxStat,
+		src:  "[[ /sbox/file -nt /sbox/dir ]] && echo newer; [[ -s /sbox/file && ! -s /sbox/dir ]] && echo size",
+		want: "newer\nsize\n",
+	},
+	{
+		name: "StatSandboxSymlink",
+		stat: sandboxStat,
+		src:  "[[ -L /sbox/link && -f /sbox/link ]] && echo link; [[ -x /sbox/file ]] && echo exec",
+		want: "link\nexec\n",
+	},
+	{
+		name: "StatSandboxCd",
+		stat: sandboxStat,
+		src:  "cd /sbox/dir && pwd; cd /sbox/file || echo notdir",
+		want: "/sbox/dir\nnotdir\n",
+	},
+	{
+		name: "StatForbid",
+		stat: func(ctx context.Context, path string, followSymlinks bool) (os.FileInfo, error) {
+			return nil, fmt.Errorf("forbidden: %s", path)
+		},
+		src:  "echo foo; [[ -e /x ]]; echo bar",
+		want: "foo\nforbidden: /x",
+	},
+}
+
+type fakeInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (fi fakeInfo) Name() string       { return fi.name }
+func (fi fakeInfo) Size() int64        { return fi.size }
+func (fi fakeInfo) Mode() os.FileMode  { return fi.mode }
+func (fi fakeInfo) ModTime() time.Time { return fi.modTime }
+func (fi fakeInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi fakeInfo) Sys() interface{}   { return nil }
+
+// sandboxStat is a ModuleStat for a tiny virtual filesystem.
+func sandboxStat(ctx context.Context, path string, followSymlinks bool) (os.FileInfo, error) {
+	switch path {
+	case "/sbox/file":
+		return fakeInfo{"file", 3, 0755, time.Unix(20, 0)}, nil
+	case "/sbox/dir":
+		return fakeInfo{"dir", 0, os.ModeDir | 0755, time.Unix(10, 0)}, nil
+	case "/sbox/link":
+		if !followSymlinks {
+			return fakeInfo{"link", 0, os.ModeSymlink | 0777, time.Unix(10, 0)}, nil
+		}
+		return sandboxStat(ctx, "/sbox/file", true)
+	}
+	return nil, &os.PathError{Op: "stat", Path: path, Err: os.ErrNotExist}
 }
 
 func TestRunnerModules(t *testing.T) {
@@ -103,7 +166,7 @@ func TestRunnerModules(t *testing.T) {
 			}
 			var cb concBuffer
 			r, err := New(StdIO(nil, &cb, &cb),
-				Module(tc.exec), Module(tc.open))
+				Module(tc.exec), Module(tc.open), Module(tc.stat))
 			if err != nil {
 				t.Fatal(err)
 			}
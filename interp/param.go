@@ -34,29 +34,43 @@ func anyOfLit(v interface{}, vals ...string) string {
 	return ""
 }
 
-// quotedElems checks if a parameter expansion is exactly ${@} or ${foo[@]}
-func (r *Runner) quotedElems(pe *syntax.ParamExp) []string {
-	if pe == nil || pe.Excl || pe.Length || pe.Width {
-		return nil
-	}
-	if pe.Param.Value == "@" {
-		return r.Params
-	}
-	if anyOfLit(pe.Index, "@") == "" {
-		return nil
+// paramExp expands a parameter expansion into a single string, joining the
+// elements of ${a[@]} with spaces and those of ${a[*]} with the first
+// character of IFS.
+func (r *Runner) paramExp(ctx context.Context, pe *syntax.ParamExp) string {
+	return r.joinElems(r.paramElems(ctx, pe))
+}
+
+func (r *Runner) joinElems(elems []string, all byte) string {
+	switch all {
+	case 0:
+		return elems[0]
+	case '*':
+		return strings.Join(elems, r.ifsJoin)
+	default:
+		return strings.Join(elems, " ")
 	}
-	val, _ := r.lookupVar(pe.Param.Value)
-	if x, ok := val.Value.(IndexArray); ok {
-		return x
+}
+
+// arg0 returns the value of $0; the name of the file being run, or the name
+// of the shell if there isn't one.
+func (r *Runner) arg0() string {
+	if r.filename != "" {
+		return r.filename
 	}
-	return nil
+	return "gosh"
 }
 
-func (r *Runner) paramExp(ctx context.Context, pe *syntax.ParamExp) string {
+// paramElems expands a parameter expansion. If it expands to all the
+// elements of an array, such as ${a[@]} or $*, all holds the subscript
+// character and elems holds each of the elements, which may be none.
+// Otherwise, all is 0 and elems holds a single string.
+func (r *Runner) paramElems(ctx context.Context, pe *syntax.ParamExp) (elems []string, all byte) {
 	name := pe.Param.Value
 	var vr Variable
 	set := false
 	index := pe.Index
+	all = pe.IndexAll()
 	switch name {
 	case "#":
 		vr.Value = StringVal(strconv.Itoa(len(r.Params)))
@@ -65,15 +79,21 @@ func (r *Runner) paramExp(ctx context.Context, pe *syntax.ParamExp) string {
 		index = &syntax.Word{Parts: []syntax.WordPart{
 			&syntax.Lit{Value: name},
 		}}
+		all = name[0]
 	case "?":
 		vr.Value = StringVal(strconv.Itoa(r.exit))
 	case "$":
 		vr.Value = StringVal(strconv.Itoa(os.Getpid()))
 	case "PPID":
 		vr.Value = StringVal(strconv.Itoa(os.Getppid()))
+	case "0":
+		vr.Value = StringVal(r.arg0())
 	case "LINENO":
-		line := uint64(pe.Pos().Line())
-		vr.Value = StringVal(strconv.FormatUint(line, 10))
+		line := pe.Pos().Line()
+		if r.Line != nil {
+			line = r.Line(pe.Pos())
+		}
+		vr.Value = StringVal(strconv.FormatUint(uint64(line), 10))
 	case "DIRSTACK":
 		vr.Value = IndexArray(r.dirStack)
 	default:
@@ -89,38 +109,42 @@ func (r *Runner) paramExp(ctx context.Context, pe *syntax.ParamExp) string {
 	if index != nil {
 		str = r.varInd(ctx, vr, index, 0)
 	}
-	slicePos := func(expr syntax.ArithmExpr) int {
-		p := r.arithm(ctx, expr)
+	// slicePos clamps a slice offset or length in [0, n]
+	slicePos := func(p, n int) int {
 		if p < 0 {
-			p = len(str) + p
+			p = n + p
 			if p < 0 {
-				p = len(str)
+				p = n
 			}
-		} else if p > len(str) {
-			p = len(str)
+		} else if p > n {
+			p = n
 		}
 		return p
 	}
-	elems := []string{str}
-	if anyOfLit(index, "@", "*") != "" {
+	_, isStr := vr.Value.(StringVal)
+	elems = []string{str}
+	if all != 0 {
 		switch x := vr.Value.(type) {
 		case nil:
 			elems = nil
 		case IndexArray:
 			elems = x
+		case AssocArray:
+			elems = assocValues(x)
 		}
 	}
 	switch {
 	case pe.Length:
 		n := len(elems)
-		if anyOfLit(index, "@", "*") == "" {
+		if all == 0 {
 			n = utf8.RuneCountInString(str)
 		}
-		str = strconv.Itoa(n)
+		return []string{strconv.Itoa(n)}, 0
 	case pe.Excl:
 		var strs []string
 		if pe.Names != 0 {
 			strs = r.namesByPrefix(pe.Param.Value)
+			all = pe.Names.String()[0]
 		} else if vr.NameRef {
 			strs = append(strs, string(vr.Value.(StringVal)))
 		} else if x, ok := vr.Value.(IndexArray); ok {
@@ -138,16 +162,45 @@ func (r *Runner) paramExp(ctx context.Context, pe *syntax.ParamExp) string {
 			strs = append(strs, r.varStr(vr, 0))
 		}
 		sort.Strings(strs)
-		str = strings.Join(strs, " ")
+		if all != 0 {
+			return strs, all
+		}
+		return []string{strings.Join(strs, " ")}, 0
+	case pe.Slice != nil && all != 0 && !isStr:
+		// slice the elements themselves, unless the value is a
+		// string; the positional parameters start at $1
+		if pe.Slice.Offset != nil {
+			offset := r.arithm(ctx, pe.Slice.Offset)
+			if name == "@" || name == "*" {
+				switch {
+				case offset > 0:
+					offset--
+				case offset == 0:
+					// like in ${@:0}, which includes $0
+					elems = append([]string{r.arg0()}, elems...)
+				}
+			}
+			elems = elems[slicePos(offset, len(elems)):]
+		}
+		if pe.Slice.Length != nil {
+			length := r.arithm(ctx, pe.Slice.Length)
+			if length < 0 {
+				r.errf("%d: substring expression < 0\n", length)
+				r.setErr(ShellExitStatus(1))
+				return []string{""}, 0
+			}
+			elems = elems[:slicePos(length, len(elems))]
+		}
 	case pe.Slice != nil:
 		if pe.Slice.Offset != nil {
-			offset := slicePos(pe.Slice.Offset)
+			offset := slicePos(r.arithm(ctx, pe.Slice.Offset), len(str))
 			str = str[offset:]
 		}
 		if pe.Slice.Length != nil {
-			length := slicePos(pe.Slice.Length)
+			length := slicePos(r.arithm(ctx, pe.Slice.Length), len(str))
 			str = str[:length]
 		}
+		elems = []string{str}
 	case pe.Repl != nil:
 		orig := r.lonePattern(ctx, pe.Repl.Orig)
 		with := r.loneWord(ctx, pe.Repl.With)
@@ -155,18 +208,25 @@ func (r *Runner) paramExp(ctx context.Context, pe *syntax.ParamExp) string {
 		if pe.Repl.All {
 			n = -1
 		}
-		locs := findAllIndex(orig, str, n)
-		buf := r.strBuilder()
-		last := 0
-		for _, loc := range locs {
-			buf.WriteString(str[last:loc[0]])
-			buf.WriteString(with)
-			last = loc[1]
+		elems = append([]string(nil), elems...)
+		for i, elem := range elems {
+			locs := findAllIndex(orig, elem, n)
+			buf := r.strBuilder()
+			last := 0
+			for _, loc := range locs {
+				buf.WriteString(elem[last:loc[0]])
+				buf.WriteString(with)
+				last = loc[1]
+			}
+			buf.WriteString(elem[last:])
+			elems[i] = buf.String()
 		}
-		buf.WriteString(str[last:])
-		str = buf.String()
 	case pe.Exp != nil:
 		arg := r.loneWord(ctx, pe.Exp.Word)
+		// subst replaces the whole expansion with a single string
+		subst := func(s string) {
+			elems, all = []string{s}, 0
+		}
 		switch op := pe.Exp.Op; op {
 		case syntax.SubstColPlus:
 			if str == "" {
@@ -175,7 +235,7 @@ func (r *Runner) paramExp(ctx context.Context, pe *syntax.ParamExp) string {
 			fallthrough
 		case syntax.SubstPlus:
 			if set {
-				str = arg
+				subst(arg)
 			}
 		case syntax.SubstMinus:
 			if set {
@@ -184,7 +244,7 @@ func (r *Runner) paramExp(ctx context.Context, pe *syntax.ParamExp) string {
 			fallthrough
 		case syntax.SubstColMinus:
 			if str == "" {
-				str = arg
+				subst(arg)
 			}
 		case syntax.SubstQuest:
 			if set {
@@ -205,7 +265,7 @@ func (r *Runner) paramExp(ctx context.Context, pe *syntax.ParamExp) string {
 		case syntax.SubstColAssgn:
 			if str == "" {
 				r.setVarString(ctx, name, arg)
-				str = arg
+				subst(arg)
 			}
 		case syntax.RemSmallPrefix, syntax.RemLargePrefix,
 			syntax.RemSmallSuffix, syntax.RemLargeSuffix:
@@ -213,10 +273,10 @@ func (r *Runner) paramExp(ctx context.Context, pe *syntax.ParamExp) string {
 				op == syntax.RemLargeSuffix
 			large := op == syntax.RemLargePrefix ||
 				op == syntax.RemLargeSuffix
+			elems = append([]string(nil), elems...)
 			for i, elem := range elems {
 				elems[i] = removePattern(elem, arg, suffix, large)
 			}
-			str = strings.Join(elems, " ")
 		case syntax.UpperFirst, syntax.UpperAll,
 			syntax.LowerFirst, syntax.LowerAll:
 
@@ -224,49 +284,54 @@ func (r *Runner) paramExp(ctx context.Context, pe *syntax.ParamExp) string {
 			if op == syntax.UpperFirst || op == syntax.UpperAll {
 				caseFunc = unicode.ToUpper
 			}
-			all := op == syntax.UpperAll || op == syntax.LowerAll
+			allRunes := op == syntax.UpperAll || op == syntax.LowerAll
 
 			// empty string means '?'; nothing to do there
 			expr, err := syntax.TranslatePattern(arg, false)
 			if err != nil {
-				return str
+				break
 			}
 			rx := regexp.MustCompile(expr)
 
+			elems = append([]string(nil), elems...)
 			for i, elem := range elems {
 				rs := []rune(elem)
 				for ri, r := range rs {
 					if rx.MatchString(string(r)) {
 						rs[ri] = caseFunc(r)
-						if !all {
+						if !allRunes {
 							break
 						}
 					}
 				}
 				elems[i] = string(rs)
 			}
-			str = strings.Join(elems, " ")
 		case syntax.OtherParamOps:
-			switch arg {
-			case "Q":
-				str = strconv.Quote(str)
-			case "E":
-				tail := str
-				var rns []rune
-				for tail != "" {
-					var rn rune
-					rn, _, tail, _ = strconv.UnquoteChar(tail, 0)
-					rns = append(rns, rn)
+			elems = append([]string(nil), elems...)
+			for i, elem := range elems {
+				switch arg {
+				case "Q":
+					elems[i] = singleQuote(elem)
+				case "E":
+					tail := elem
+					var rns []rune
+					for tail != "" {
+						var rn rune
+						rn, _, tail, _ = strconv.UnquoteChar(tail, 0)
+						rns = append(rns, rn)
+					}
+					elems[i] = string(rns)
+				case "P":
+					elems[i] = r.ExpandPrompt(ctx, elem)
+				case "A", "a":
+					panic(fmt.Sprintf("unhandled @%s param expansion", arg))
+				default:
+					panic(fmt.Sprintf("unexpected @%s param expansion", arg))
 				}
-				str = string(rns)
-			case "P", "A", "a":
-				panic(fmt.Sprintf("unhandled @%s param expansion", arg))
-			default:
-				panic(fmt.Sprintf("unexpected @%s param expansion", arg))
 			}
 		}
 	}
-	return str
+	return elems, all
 }
 
 func removePattern(str, pattern string, fromEnd, greedy bool) string {
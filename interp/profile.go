@@ -0,0 +1,127 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package interp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// Profile accumulates the wall time spent running each command, function,
+// and statement, to find the slow steps of long programs. The times are
+// inclusive, so the time of a function includes the time of the commands
+// it runs.
+//
+// The zero value is ready to use, and may be shared by many runners, even
+// concurrently. To profile a program, set Runner.Profile.
+type Profile struct {
+	mu      sync.Mutex
+	entries map[profileKey]*ProfileEntry
+
+	now func() time.Time // to fake the clock in tests
+}
+
+type profileKey struct {
+	kind, name string
+}
+
+// ProfileEntry is the accumulated time of a command, function, or
+// statement.
+type ProfileEntry struct {
+	// Kind is one of "command", "builtin", "function", or "statement".
+	Kind string
+
+	// Name is the name of the command or function, or the position of
+	// the statement, such as "deploy.sh:12:3".
+	Name string
+
+	Calls int
+	Total time.Duration
+}
+
+func (p *Profile) start() time.Time {
+	if p.now != nil {
+		return p.now()
+	}
+	return time.Now()
+}
+
+func (p *Profile) add(kind, name string, start time.Time) {
+	d := p.start().Sub(start)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.entries == nil {
+		p.entries = make(map[profileKey]*ProfileEntry)
+	}
+	key := profileKey{kind, name}
+	e := p.entries[key]
+	if e == nil {
+		e = &ProfileEntry{Kind: kind, Name: name}
+		p.entries[key] = e
+	}
+	e.Calls++
+	e.Total += d
+}
+
+func (p *Profile) addStmt(filename string, st *syntax.Stmt, start time.Time) {
+	pos := st.Pos()
+	if filename == "" {
+		filename = "<stdin>"
+	}
+	p.add("statement", fmt.Sprintf("%s:%d:%d", filename, pos.Line(), pos.Col()), start)
+}
+
+// profileKind returns the kind of the command a call runs, in the same
+// order of precedence as call.
+func (r *Runner) profileKind(name string) string {
+	if r.Funcs[name] != nil {
+		return "function"
+	}
+	if isBuiltin(name) {
+		return "builtin"
+	}
+	return "command"
+}
+
+// Entries returns the accumulated entries, the slowest first.
+func (p *Profile) Entries() []ProfileEntry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entries := make([]ProfileEntry, 0, len(p.entries))
+	for _, e := range p.entries {
+		entries = append(entries, *e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		e1, e2 := entries[i], entries[j]
+		switch {
+		case e1.Total != e2.Total:
+			return e1.Total > e2.Total
+		case e1.Kind != e2.Kind:
+			return e1.Kind < e2.Kind
+		}
+		return e1.Name < e2.Name
+	})
+	return entries
+}
+
+// WriteReport writes the entries as a table, the slowest first.
+func (p *Profile) WriteReport(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	tw := tabwriter.NewWriter(bw, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "TOTAL\tCALLS\tKIND\tNAME")
+	for _, e := range p.Entries() {
+		fmt.Fprintf(tw, "%v\t%d\t%s\t%s\n", e.Total, e.Calls, e.Kind, e.Name)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
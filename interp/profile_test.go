@@ -0,0 +1,101 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package interp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"mvdan.cc/sh/syntax"
+)
+
+var profileCases = []struct {
+	src, want string
+}{
+	{
+		"echo foo",
+		"TOTAL  CALLS  KIND       NAME\n" +
+			"3ms    1      statement  f.sh:1:1\n" +
+			"1ms    1      builtin    echo\n",
+	},
+	{
+		"true; true",
+		"TOTAL  CALLS  KIND       NAME\n" +
+			"3ms    1      statement  f.sh:1:1\n" +
+			"3ms    1      statement  f.sh:1:7\n" +
+			"2ms    2      builtin    true\n",
+	},
+	{
+		"f() { :; }\nf; f",
+		"TOTAL  CALLS  KIND       NAME\n" +
+			"14ms   2      function   f\n" +
+			"10ms   2      statement  f.sh:1:5\n" +
+			"9ms    1      statement  f.sh:2:1\n" +
+			"9ms    1      statement  f.sh:2:4\n" +
+			"6ms    2      statement  f.sh:1:7\n" +
+			"2ms    2      builtin    :\n" +
+			"1ms    1      statement  f.sh:1:1\n",
+	},
+}
+
+// fakeClock returns a clock which advances by a millisecond each time it
+// is read.
+func fakeClock() func() time.Time {
+	var now time.Time
+	return func() time.Time {
+		now = now.Add(time.Millisecond)
+		return now
+	}
+}
+
+func TestProfile(t *testing.T) {
+	t.Parallel()
+	p := syntax.NewParser()
+	for i, tc := range profileCases {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			file, err := p.Parse(strings.NewReader(tc.src), "f.sh")
+			if err != nil {
+				t.Fatalf("could not parse: %v", err)
+			}
+			r, _ := New(StdIO(nil, &bytes.Buffer{}, &bytes.Buffer{}))
+			r.Profile = &Profile{now: fakeClock()}
+			r.Run(context.Background(), file)
+			var buf bytes.Buffer
+			if err := r.Profile.WriteReport(&buf); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tc.want {
+				t.Errorf("want report:\n%s\ngot:\n%s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestProfileCommand(t *testing.T) {
+	t.Parallel()
+	file, err := syntax.NewParser().Parse(strings.NewReader("sh -c true"), "f.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _ := New()
+	r.Profile = &Profile{}
+	if err := r.Run(context.Background(), file); err != nil {
+		t.Fatal(err)
+	}
+	entries := r.Profile.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("want 2 entries, got %d", len(entries))
+	}
+	stmt, cmd := entries[0], entries[1]
+	if cmd.Kind != "command" || cmd.Name != "sh" || cmd.Calls != 1 {
+		t.Fatalf("unexpected command entry: %+v", cmd)
+	}
+	if stmt.Kind != "statement" || stmt.Total < cmd.Total {
+		t.Fatalf("statement entry should include the command: %+v", stmt)
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package interp
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// ExpandPrompt expands a prompt string, such as the value of $PS1, like
+// Bash does. First, these backslash escapes are replaced:
+//
+//	\u       the name of the current user
+//	\h, \H   the host name, up to the first dot or in full
+//	\w, \W   $PWD, with $HOME shortened to ~, or its base name
+//	\$       # if the user is root, and $ otherwise
+//	\d       the date, like "Tue May 26"
+//	\t, \T   the time in 24-hour and 12-hour HH:MM:SS formats
+//	\@, \A   the time in 12-hour am/pm and 24-hour HH:MM formats
+//	\a, \e   the bell and escape characters
+//	\n, \r   the newline and carriage return characters
+//	\nnn     the character with the octal value nnn
+//	\\       a backslash
+//	\[, \]   begin and end non-printing characters, such as terminal
+//	         escape sequences, as the bytes \001 and \002
+//
+// Any other escapes are kept as they are. Then, the result is expanded like
+// a double-quoted string, so it may contain parameter expansions and
+// command substitutions, which are not traced.
+//
+// The \001 and \002 bytes are the markers used by line editors such as
+// readline to know which parts of a prompt take no space. If the prompt
+// is written directly to a terminal, they should be removed.
+func (r *Runner) ExpandPrompt(ctx context.Context, prompt string) string {
+	if !r.didReset {
+		r.Reset()
+	}
+	// Expanding prompts must not be traced, nor fail with nounset.
+	oldOpts := r.opts
+	r.opts[optXTrace], r.opts[optNoUnset] = false, false
+	defer func() { r.opts = oldOpts }()
+
+	// plain is the result without the expansion, and src is the source
+	// of the double-quoted string to expand
+	var plain, src bytes.Buffer
+	src.WriteByte('"')
+	add := func(s string) {
+		plain.WriteString(s)
+		for _, b := range []byte(s) {
+			if strings.IndexByte("$`\"\\", b) >= 0 {
+				src.WriteByte('\\')
+			}
+			src.WriteByte(b)
+		}
+	}
+	for i := 0; i < len(prompt); i++ {
+		b := prompt[i]
+		if b != '\\' || i+1 == len(prompt) {
+			plain.WriteByte(b)
+			if b == '"' || b == '\\' {
+				src.WriteByte('\\')
+			}
+			src.WriteByte(b)
+			continue
+		}
+		i++
+		switch c := prompt[i]; c {
+		case 'u':
+			if u, err := user.Current(); err == nil {
+				add(u.Username)
+			}
+		case 'h', 'H':
+			host, _ := os.Hostname()
+			if j := strings.IndexByte(host, '.'); j >= 0 && c == 'h' {
+				host = host[:j]
+			}
+			add(host)
+		case 'w', 'W':
+			add(r.promptDir(c == 'W'))
+		case '$':
+			if os.Geteuid() == 0 {
+				add("#")
+			} else {
+				add("$")
+			}
+		case 'd':
+			add(r.now().Format("Mon Jan 02"))
+		case 't':
+			add(r.now().Format("15:04:05"))
+		case 'T':
+			add(r.now().Format("03:04:05"))
+		case '@':
+			add(r.now().Format("03:04 PM"))
+		case 'A':
+			add(r.now().Format("15:04"))
+		case 'a':
+			add("\a")
+		case 'e':
+			add("\x1b")
+		case 'n':
+			add("\n")
+		case 'r':
+			add("\r")
+		case '\\':
+			add(`\`)
+		case '[':
+			add("\x01")
+		case ']':
+			add("\x02")
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			n := 0
+			j := i
+			for ; j < len(prompt) && j-i < 3 && '0' <= prompt[j] && prompt[j] <= '7'; j++ {
+				n = n*8 + int(prompt[j]-'0')
+			}
+			add(string([]byte{byte(n)}))
+			i = j - 1
+		default:
+			add(`\`)
+			i-- // keep the next character as usual
+		}
+	}
+	src.WriteByte('"')
+	if !strings.ContainsAny(plain.String(), "$`") {
+		return plain.String()
+	}
+	file, err := syntax.NewParser().Parse(&src, "")
+	if err != nil || len(file.Stmts) != 1 {
+		return plain.String()
+	}
+	call, ok := file.Stmts[0].Cmd.(*syntax.CallExpr)
+	if !ok || len(call.Args) != 1 {
+		return plain.String()
+	}
+	return r.loneWord(ctx, call.Args[0])
+}
+
+// promptDir returns $PWD for \w in a prompt, with $HOME shortened to a
+// tilde, or its base name for \W.
+func (r *Runner) promptDir(base bool) string {
+	dir := r.getVar("PWD")
+	home := r.getVar("HOME")
+	switch {
+	case home != "" && dir == home:
+		return "~"
+	case base:
+		return filepath.Base(dir)
+	case home != "" && strings.HasPrefix(dir, home+"/"):
+		return "~" + dir[len(home):]
+	}
+	return dir
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package interp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+var promptTests = []struct {
+	prompt, want string
+}{
+	{"$ ", "$ "},
+	{`\w \W`, "~/src/sh sh"},
+	{`\A \t \T \@ \d`, "15:04 15:04:05 03:04:05 03:04 PM Tue Jan 02"},
+	{`\[\e[1m\]x\n`, "\x01\x1b[1m\x02x\n"},
+	{`\101\\\q`, `A\\q`},
+	{`a"b\`, `a"b\`},
+	{`$v ${v}s $(echo sub) "q"`, `val vals sub "q"`},
+	{`\$v`, "$v"},
+	{`${missing}x`, "x"},
+}
+
+func TestExpandPrompt(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2018, 1, 2, 15, 4, 5, 0, time.UTC)
+	for i, tc := range promptTests {
+		t.Run(fmt.Sprintf("%02d", i), func(t *testing.T) {
+			r, _ := New(Params("-u"))
+			r.Now = func() time.Time { return now }
+			r.Reset()
+			r.Vars["HOME"] = Variable{Value: StringVal("/home/user")}
+			r.Vars["PWD"] = Variable{Value: StringVal("/home/user/src/sh")}
+			r.Vars["v"] = Variable{Value: StringVal("val")}
+			want := tc.want
+			if os.Geteuid() == 0 && tc.prompt == `\$v` {
+				want = "#v"
+			}
+			got := r.ExpandPrompt(context.Background(), tc.prompt)
+			if got != want {
+				t.Fatalf("ExpandPrompt mismatch in %q:\nwant: %q\ngot:  %q",
+					tc.prompt, want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package interp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// Record is a log of the programs executed by an interpreter, as kept by
+// RecordExec. It can be saved with Encode, and later used by ReplayExec to
+// run the same script again without executing anything, such as in
+// deterministic tests of deployment scripts.
+//
+// A Record is safe for concurrent use.
+type Record struct {
+	mu       sync.Mutex
+	Calls    []Call
+	replayed []bool
+}
+
+// Call is a single execution of a program.
+type Call struct {
+	Args []string
+	Env  []string // in the form "name=value", sorted
+
+	// Stdin is the hex-encoded SHA-256 hash of the standard input, or
+	// empty if there was none.
+	Stdin string
+
+	Stdout, Stderr string
+	Status         uint8
+}
+
+// DecodeRecord reads a record in JSON, as written by Encode.
+func DecodeRecord(r io.Reader) (*Record, error) {
+	rec := &Record{}
+	if err := json.NewDecoder(r).Decode(&rec.Calls); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// Encode writes the record's calls in JSON.
+func (rec *Record) Encode(w io.Writer) error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(rec.Calls)
+}
+
+// withStdin reads all of the standard input of the program being executed,
+// returning its hash and a context that gives the same input to the
+// program.
+func withStdin(ctx context.Context) (context.Context, string, error) {
+	mc, _ := FromModuleContext(ctx)
+	if mc.Stdin == nil {
+		return ctx, "", nil
+	}
+	in, err := ioutil.ReadAll(mc.Stdin)
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(in)
+	mc.Stdin = bytes.NewReader(in)
+	return context.WithValue(ctx, moduleCtxKey{}, mc), hex.EncodeToString(sum[:]), nil
+}
+
+// RecordExec returns a module which executes programs via next, adding
+// each call to rec. Note that the standard input is read in full before
+// each program is executed.
+//
+// Errors other than ExitStatus are returned as-is, without recording the
+// call.
+func RecordExec(rec *Record, next ModuleExec) ModuleExec {
+	return func(ctx context.Context, path string, args []string) error {
+		ctx, stdin, err := withStdin(ctx)
+		if err != nil {
+			return err
+		}
+		mc, _ := FromModuleContext(ctx)
+		env := execEnv(mc.Env)
+		sort.Strings(env)
+		call := Call{
+			Args:  append([]string(nil), args...),
+			Env:   env,
+			Stdin: stdin,
+		}
+		var stdout, stderr bytes.Buffer
+		mc.Stdout = io.MultiWriter(mc.Stdout, &stdout)
+		mc.Stderr = io.MultiWriter(mc.Stderr, &stderr)
+		err = next(context.WithValue(ctx, moduleCtxKey{}, mc), path, args)
+		switch x := err.(type) {
+		case nil:
+		case ExitStatus:
+			call.Status = uint8(x)
+		default:
+			return err
+		}
+		call.Stdout, call.Stderr = stdout.String(), stderr.String()
+		rec.mu.Lock()
+		rec.Calls = append(rec.Calls, call)
+		rec.mu.Unlock()
+		return err
+	}
+}
+
+// ReplayExec returns a module which executes nothing, and instead replays
+// the calls in rec. Each call is matched to the first call in rec that
+// hasn't been replayed yet and has the same arguments and standard input,
+// and its output and exit status are replayed. If there is no such call,
+// an error is returned, stopping the interpreter.
+func ReplayExec(rec *Record) ModuleExec {
+	return func(ctx context.Context, path string, args []string) error {
+		ctx, stdin, err := withStdin(ctx)
+		if err != nil {
+			return err
+		}
+		mc, _ := FromModuleContext(ctx)
+		rec.mu.Lock()
+		for len(rec.replayed) < len(rec.Calls) {
+			rec.replayed = append(rec.replayed, false)
+		}
+		var call *Call
+		for i := range rec.Calls {
+			c := &rec.Calls[i]
+			if !rec.replayed[i] && c.Stdin == stdin && reflect.DeepEqual(c.Args, args) {
+				rec.replayed[i] = true
+				call = c
+				break
+			}
+		}
+		rec.mu.Unlock()
+		if call == nil {
+			return fmt.Errorf("no recorded call to replay for %q", args)
+		}
+		io.WriteString(mc.Stdout, call.Stdout)
+		io.WriteString(mc.Stderr, call.Stderr)
+		if call.Status != 0 {
+			return ExitStatus(call.Status)
+		}
+		return nil
+	}
+}
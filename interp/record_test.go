@@ -0,0 +1,93 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package interp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// fakeDeploy is an exec module that pretends to run a few programs.
+func fakeDeploy(ctx context.Context, path string, args []string) error {
+	mc, _ := FromModuleContext(ctx)
+	switch args[0] {
+	case "upload":
+		in, _ := ioutil.ReadAll(mc.Stdin)
+		fmt.Fprintf(mc.Stdout, "uploaded %d bytes to %s\n", len(in), args[1])
+	case "restart":
+		fmt.Fprintln(mc.Stderr, "restart failed")
+		return ExitStatus(3)
+	default:
+		return fmt.Errorf("unexpected program: %q", args)
+	}
+	return nil
+}
+
+func TestRecordReplay(t *testing.T) {
+	t.Parallel()
+	src := `echo data | upload srv1; echo more data | upload srv2; restart srv1 || echo status $?`
+	want := "uploaded 5 bytes to srv1\nuploaded 10 bytes to srv2\nrestart failed\nstatus 3\n"
+	file, err := syntax.NewParser().Parse(strings.NewReader(src), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := func(exec ModuleExec) (string, error) {
+		var cb concBuffer
+		env, _ := EnvFromList([]string{"FOO=bar"})
+		r, _ := New(Env(env), StdIO(nil, &cb, &cb), Module(exec))
+		err := r.Run(context.Background(), file)
+		return cb.String(), err
+	}
+	rec := &Record{}
+	got, err := run(RecordExec(rec, fakeDeploy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Fatalf("wrong recorded output:\nwant: %q\ngot:  %q", want, got)
+	}
+	if len(rec.Calls) != 3 {
+		t.Fatalf("want 3 recorded calls, got %d", len(rec.Calls))
+	}
+	call := rec.Calls[2]
+	if call.Status != 3 || call.Stderr != "restart failed\n" || call.Stdin != "" {
+		t.Fatalf("wrong recorded call: %#v", call)
+	}
+	if !strings.Contains(strings.Join(call.Env, "\n"), "FOO=bar") {
+		t.Fatalf("env not recorded: %q", call.Env)
+	}
+
+	var buf bytes.Buffer
+	if err := rec.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	replay := func() (string, error) {
+		rec2, err := DecodeRecord(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return run(ReplayExec(rec2))
+	}
+	if got, err = replay(); err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Fatalf("wrong replayed output:\nwant: %q\ngot:  %q", want, got)
+	}
+
+	// a different standard input doesn't match the recorded call
+	src = "echo other | upload srv1"
+	if file, err = syntax.NewParser().Parse(strings.NewReader(src), ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = replay(); err == nil || !strings.Contains(err.Error(), "no recorded call") {
+		t.Fatalf("want a replay error, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package interp
+
+import (
+	"bytes"
+	"sort"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// Snapshot holds the parts of a runner's state that outlive the code that
+// set them: its exported variables and its functions. Two snapshots can be
+// compared with Diff, for example to find what sourcing a file changes.
+//
+// Aliases are not part of a snapshot, as the interpreter does not support
+// them yet.
+type Snapshot struct {
+	Vars  map[string]string
+	Funcs map[string]string // function bodies, as printed
+}
+
+// Snapshot returns the current exported variables and functions of the
+// runner.
+func (r *Runner) Snapshot() Snapshot {
+	s := Snapshot{
+		Vars:  make(map[string]string),
+		Funcs: make(map[string]string, len(r.Funcs)),
+	}
+	env := r.exportedEnv()
+	for _, name := range env.Names() {
+		s.Vars[name], _ = env.Get(name)
+	}
+	printer := syntax.NewPrinter()
+	var buf bytes.Buffer
+	for name, body := range r.Funcs {
+		buf.Reset()
+		printer.Print(&buf, body)
+		s.Funcs[name] = buf.String()
+	}
+	return s
+}
+
+// Change is a difference between two snapshots, for a single variable or
+// function.
+type Change struct {
+	Name string
+	Func bool // a function, not a variable
+
+	Added   bool // missing in the old snapshot
+	Removed bool // missing in the new snapshot
+
+	// Old and New are the values of the variable or the bodies of the
+	// function, if present.
+	Old, New string
+}
+
+// Diff returns the changes from the old snapshot to the new one. Variables
+// come first, and the changes are sorted by name.
+func Diff(old, new Snapshot) []Change {
+	changes := diffMaps(old.Vars, new.Vars, false)
+	return append(changes, diffMaps(old.Funcs, new.Funcs, true)...)
+}
+
+func diffMaps(old, new map[string]string, fn bool) []Change {
+	var changes []Change
+	for name, oldVal := range old {
+		newVal, ok := new[name]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Name: name, Func: fn,
+				Removed: true, Old: oldVal})
+		case newVal != oldVal:
+			changes = append(changes, Change{Name: name, Func: fn,
+				Old: oldVal, New: newVal})
+		}
+	}
+	for name, newVal := range new {
+		if _, ok := old[name]; !ok {
+			changes = append(changes, Change{Name: name, Func: fn,
+				Added: true, New: newVal})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
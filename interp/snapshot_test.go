@@ -0,0 +1,74 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package interp
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+var diffTests = []struct {
+	before, src string
+	want        []Change
+}{
+	{"", "", nil},
+	{"", "foo=bar", nil},
+	{"", "export FOO=bar", []Change{
+		{Name: "FOO", Added: true, New: "bar"},
+	}},
+	{"export FOO=bar", "FOO=etc", []Change{
+		{Name: "FOO", Old: "bar", New: "etc"},
+	}},
+	{"export FOO=bar", "unset FOO", []Change{
+		{Name: "FOO", Removed: true, Old: "bar"},
+	}},
+	{"export FOO=bar", "declare +x FOO", []Change{
+		{Name: "FOO", Removed: true, Old: "bar"},
+	}},
+	{"", "f() { echo foo; }", []Change{
+		{Name: "f", Func: true, Added: true, New: "{ echo foo; }"},
+	}},
+	{"f() { echo foo; }", "f() { echo bar; }", []Change{
+		{Name: "f", Func: true, Old: "{ echo foo; }", New: "{ echo bar; }"},
+	}},
+	{"f() { echo foo; }", "f() { echo  foo; }", nil},
+	{"f() { :; }; g() { :; }", "unset -f f; export B=1 A=2", []Change{
+		{Name: "A", Added: true, New: "2"},
+		{Name: "B", Added: true, New: "1"},
+		{Name: "f", Func: true, Removed: true, Old: "{ :; }"},
+	}},
+}
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+	p := syntax.NewParser()
+	for i, tc := range diffTests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			env, _ := EnvFromList(nil)
+			r, _ := New(Env(env))
+			run := func(src string) {
+				file, err := p.Parse(strings.NewReader(src), "")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := r.Run(context.Background(), file); err != nil {
+					t.Fatal(err)
+				}
+			}
+			run(tc.before)
+			old := r.Snapshot()
+			run(tc.src)
+			got := Diff(old, r.Snapshot())
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("wrong diff in %q:\nwant: %#v\ngot:  %#v",
+					tc.src, tc.want, got)
+			}
+		})
+	}
+}
@@ -7,8 +7,8 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"regexp"
+	"strings"
 
 	"golang.org/x/crypto/ssh/terminal"
 
@@ -40,7 +40,7 @@ func (r *Runner) bashTest(ctx context.Context, expr syntax.TestExpr, classic boo
 			}
 			return ""
 		}
-		if r.binTest(x.Op, r.bashTest(ctx, x.X, classic), r.bashTest(ctx, x.Y, classic)) {
+		if r.binTest(ctx, x.Op, r.bashTest(ctx, x.X, classic), r.bashTest(ctx, x.Y, classic)) {
 			return "1"
 		}
 		return ""
@@ -53,7 +53,7 @@ func (r *Runner) bashTest(ctx context.Context, expr syntax.TestExpr, classic boo
 	return ""
 }
 
-func (r *Runner) binTest(op syntax.BinTestOperator, x, y string) bool {
+func (r *Runner) binTest(ctx context.Context, op syntax.BinTestOperator, x, y string) bool {
 	switch op {
 	case syntax.TsReMatch:
 		re, err := regexp.Compile(y)
@@ -63,22 +63,22 @@ func (r *Runner) binTest(op syntax.BinTestOperator, x, y string) bool {
 		}
 		return re.MatchString(x)
 	case syntax.TsNewer:
-		info1, err1 := r.stat(x)
-		info2, err2 := r.stat(y)
+		info1, err1 := r.stat(ctx, x, true)
+		info2, err2 := r.stat(ctx, y, true)
 		if err1 != nil || err2 != nil {
 			return false
 		}
 		return info1.ModTime().After(info2.ModTime())
 	case syntax.TsOlder:
-		info1, err1 := r.stat(x)
-		info2, err2 := r.stat(y)
+		info1, err1 := r.stat(ctx, x, true)
+		info2, err2 := r.stat(ctx, y, true)
 		if err1 != nil || err2 != nil {
 			return false
 		}
 		return info1.ModTime().Before(info2.ModTime())
 	case syntax.TsDevIno:
-		info1, err1 := r.stat(x)
-		info2, err2 := r.stat(y)
+		info1, err1 := r.stat(ctx, x, true)
+		info2, err2 := r.stat(ctx, y, true)
 		if err1 != nil || err2 != nil {
 			return false
 		}
@@ -100,46 +100,53 @@ func (r *Runner) binTest(op syntax.BinTestOperator, x, y string) bool {
 	case syntax.OrTest:
 		return x != "" || y != ""
 	case syntax.TsBefore:
-		return x < y
+		return r.compare(x, y) < 0
 	default: // syntax.TsAfter
-		return x > y
+		return r.compare(x, y) > 0
 	}
 }
 
-func (r *Runner) statMode(name string, mode os.FileMode) bool {
-	info, err := r.stat(name)
+func (r *Runner) compare(a, b string) int {
+	if r.Collate != nil {
+		return r.Collate(a, b)
+	}
+	return strings.Compare(a, b)
+}
+
+func (r *Runner) statMode(ctx context.Context, name string, mode os.FileMode) bool {
+	info, err := r.stat(ctx, name, true)
 	return err == nil && info.Mode()&mode != 0
 }
 
 func (r *Runner) unTest(ctx context.Context, op syntax.UnTestOperator, x string) bool {
 	switch op {
 	case syntax.TsExists:
-		_, err := r.stat(x)
+		_, err := r.stat(ctx, x, true)
 		return err == nil
 	case syntax.TsRegFile:
-		info, err := r.stat(x)
+		info, err := r.stat(ctx, x, true)
 		return err == nil && info.Mode().IsRegular()
 	case syntax.TsDirect:
-		return r.statMode(x, os.ModeDir)
+		return r.statMode(ctx, x, os.ModeDir)
 	case syntax.TsCharSp:
-		return r.statMode(x, os.ModeCharDevice)
+		return r.statMode(ctx, x, os.ModeCharDevice)
 	case syntax.TsBlckSp:
-		info, err := r.stat(x)
+		info, err := r.stat(ctx, x, true)
 		return err == nil && info.Mode()&os.ModeDevice != 0 &&
 			info.Mode()&os.ModeCharDevice == 0
 	case syntax.TsNmPipe:
-		return r.statMode(x, os.ModeNamedPipe)
+		return r.statMode(ctx, x, os.ModeNamedPipe)
 	case syntax.TsSocket:
-		return r.statMode(x, os.ModeSocket)
+		return r.statMode(ctx, x, os.ModeSocket)
 	case syntax.TsSmbLink:
-		info, err := os.Lstat(r.relPath(x))
+		info, err := r.stat(ctx, x, false)
 		return err == nil && info.Mode()&os.ModeSymlink != 0
 	case syntax.TsSticky:
-		return r.statMode(x, os.ModeSticky)
+		return r.statMode(ctx, x, os.ModeSticky)
 	case syntax.TsUIDSet:
-		return r.statMode(x, os.ModeSetuid)
+		return r.statMode(ctx, x, os.ModeSetuid)
 	case syntax.TsGIDSet:
-		return r.statMode(x, os.ModeSetgid)
+		return r.statMode(ctx, x, os.ModeSetgid)
 	//case syntax.TsGrpOwn:
 	//case syntax.TsUsrOwn:
 	//case syntax.TsModif:
@@ -156,10 +163,9 @@ func (r *Runner) unTest(ctx context.Context, op syntax.UnTestOperator, x string)
 		}
 		return err == nil
 	case syntax.TsExec:
-		_, err := exec.LookPath(r.relPath(x))
-		return err == nil
+		return r.findExecutable(ctx, r.relPath(x), r.pathExts()) != ""
 	case syntax.TsNoEmpty:
-		info, err := r.stat(x)
+		info, err := r.stat(ctx, x, true)
 		return err == nil && info.Size() > 0
 	case syntax.TsFdTerm:
 		return terminal.IsTerminal(atoi(x))
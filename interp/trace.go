@@ -0,0 +1,124 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package interp
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// trace writes a line to the trace of the commands being run, like Bash
+// does when the xtrace option is set. Each field is quoted if needed, and
+// the line is prefixed by the expansion of $PS4.
+func (r *Runner) trace(ctx context.Context, fields ...string) {
+	if !r.opts[optXTrace] {
+		return
+	}
+	var buf bytes.Buffer
+	buf.WriteString(r.tracePrefix(ctx))
+	for i, field := range fields {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(field)
+	}
+	buf.WriteByte('\n')
+	w := r.Trace
+	if w == nil {
+		w = r.Stderr
+	}
+	w.Write(buf.Bytes())
+}
+
+// tracePrefix expands $PS4 like a prompt. Its first character is repeated
+// for each level of indirection, such as command substitutions and eval.
+func (r *Runner) tracePrefix(ctx context.Context) string {
+	oldOpts := r.opts
+	r.opts[optNoUnset] = false
+	ps4 := r.getVar("PS4")
+	r.opts = oldOpts
+	ps4 = r.ExpandPrompt(ctx, ps4)
+	if ps4 == "" {
+		return ""
+	}
+	return strings.Repeat(ps4[:1], r.traceDepth) + ps4
+}
+
+// traceAssign returns how an assignment is traced, such as a='b c'. If
+// whole is true, a string assignment is quoted as a single word instead,
+// such as 'a=b c', which is how Bash traces the arguments to declare.
+func (r *Runner) traceAssign(as *syntax.Assign, val VarValue, whole bool) string {
+	var buf bytes.Buffer
+	buf.WriteString(as.Name.Value)
+	if as.Index != nil {
+		buf.WriteByte('[')
+		syntax.NewPrinter().Print(&buf, as.Index)
+		buf.WriteByte(']')
+	}
+	if as.Append {
+		buf.WriteByte('+')
+	}
+	buf.WriteByte('=')
+	switch x := val.(type) {
+	case StringVal:
+		if whole {
+			return traceQuote(buf.String() + string(x))
+		}
+		buf.WriteString(traceQuote(string(x)))
+	case IndexArray:
+		buf.WriteByte('(')
+		for i, elem := range x {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			buf.WriteString(traceQuote(elem))
+		}
+		buf.WriteByte(')')
+	case AssocArray:
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		buf.WriteByte('(')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			buf.WriteString("[" + traceQuote(k) + "]=" + traceQuote(x[k]))
+		}
+		buf.WriteByte(')')
+	}
+	return buf.String()
+}
+
+// traceQuote quotes a word for the trace, like Bash does. Single quotes
+// are used when there are special characters, and the $'...' form when
+// there are non-printable characters other than whitespace.
+func traceQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	quote := false
+	for i, r := range s {
+		switch r {
+		case '~', '#':
+			quote = quote || i == 0
+		case ' ', '\t', '\n', '\'', '"', '\\', '|', '&', ';', '(', ')',
+			'<', '>', '!', '{', '}', '*', '[', ']', '?', '^', '$', '`':
+			quote = true
+		}
+	}
+	if !printable(s) {
+		return ansiQuote(s)
+	}
+	if !quote {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package interp
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// trapHandler is the code to run when a trap is triggered.
+type trapHandler struct {
+	src string
+
+	// stmts is the parsed code, if the parser already did it; see
+	// syntax.ParseTraps.
+	stmts *syntax.StmtList
+}
+
+// trapSignals holds the conditions that may be trapped, in the order they
+// are listed in. Only EXIT is triggered, as the interpreter doesn't
+// receive signals.
+var trapSignals = []struct {
+	name string
+	num  int // -1 if not a signal
+}{
+	{"EXIT", 0},
+	{"SIGHUP", 1},
+	{"SIGINT", 2},
+	{"SIGQUIT", 3},
+	{"SIGKILL", 9},
+	{"SIGUSR1", 10},
+	{"SIGUSR2", 12},
+	{"SIGPIPE", 13},
+	{"SIGALRM", 14},
+	{"SIGTERM", 15},
+	{"DEBUG", -1},
+	{"ERR", -1},
+	{"RETURN", -1},
+}
+
+// trapSignal returns the canonical name of the condition given to trap,
+// such as "SIGINT" for "int" or "2".
+func trapSignal(arg string) (string, bool) {
+	if n, err := strconv.Atoi(arg); err == nil {
+		for _, sig := range trapSignals {
+			if sig.num == n {
+				return sig.name, true
+			}
+		}
+		return "", false
+	}
+	arg = strings.ToUpper(arg)
+	for _, sig := range trapSignals {
+		if arg == sig.name || "SIG"+arg == sig.name && sig.num > 0 {
+			return sig.name, true
+		}
+	}
+	return "", false
+}
+
+func (r *Runner) trap(args []string) int {
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return r.printTraps(nil)
+	}
+	if args[0] == "-p" {
+		return r.printTraps(args[1:])
+	}
+	if len(args[0]) > 1 && args[0][0] == '-' {
+		r.errf("trap: %s: invalid option\n", args[0])
+		return 2
+	}
+	src, names := args[0], args[1:]
+	if len(names) == 0 {
+		// "trap SIG" resets the trap, like "trap - SIG"
+		src, names = "-", args
+	}
+	code := 0
+	for _, name := range names {
+		sig, ok := trapSignal(name)
+		if !ok {
+			r.errf("trap: %s: invalid signal specification\n", name)
+			code = 1
+			continue
+		}
+		if src == "-" {
+			delete(r.traps, sig)
+			continue
+		}
+		if r.traps == nil {
+			r.traps = make(map[string]trapHandler)
+		}
+		r.traps[sig] = trapHandler{src: src, stmts: r.curHandler}
+	}
+	return code
+}
+
+// printTraps prints the traps in a form that can be run again, like
+// "trap -p". If any conditions are given, only their traps are printed.
+func (r *Runner) printTraps(args []string) int {
+	only := make(map[string]bool)
+	code := 0
+	for _, arg := range args {
+		sig, ok := trapSignal(arg)
+		if !ok {
+			r.errf("trap: %s: invalid signal specification\n", arg)
+			code = 1
+			continue
+		}
+		only[sig] = true
+	}
+	for _, sig := range trapSignals {
+		h, ok := r.traps[sig.name]
+		if !ok || (len(only) > 0 && !only[sig.name]) {
+			continue
+		}
+		r.outf("trap -- '%s' %s\n", strings.Replace(h.src, "'", `'\''`, -1), sig.name)
+	}
+	return code
+}
+
+// exitTrap runs the EXIT trap, if any, once the shell is exiting. The exit
+// status is kept, unless the handler exits.
+func (r *Runner) exitTrap(ctx context.Context) {
+	h, ok := r.traps["EXIT"]
+	if !ok {
+		return
+	}
+	delete(r.traps, "EXIT")
+	err := r.err
+	switch err.(type) {
+	case nil, ShellExitStatus:
+	default: // a fatal error, or the context was cancelled
+		return
+	}
+	if h.stmts == nil {
+		file, perr := syntax.NewParser().Parse(strings.NewReader(h.src), "")
+		if perr != nil {
+			r.errf("trap: %v\n", perr)
+			return
+		}
+		h.stmts = &file.StmtList
+	}
+	if code, ok := err.(ShellExitStatus); ok {
+		r.exit = int(code)
+	}
+	exit := r.exit
+	r.err = nil
+	r.stmts(ctx, *h.stmts)
+	if r.err == nil {
+		r.err, r.exit = err, exit
+	}
+}
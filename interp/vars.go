@@ -6,9 +6,12 @@ package interp
 import (
 	"context"
 	"fmt"
+	"math/rand"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"mvdan.cc/sh/syntax"
 )
@@ -117,6 +120,7 @@ type Variable struct {
 	Exported bool
 	ReadOnly bool
 	NameRef  bool
+	Integer  bool // assignments are evaluated arithmetically
 	Value    VarValue
 }
 
@@ -137,6 +141,9 @@ func (r *Runner) lookupVar(name string) (Variable, bool) {
 	if name == "" {
 		panic("variable name must not be empty")
 	}
+	if vr, ok := r.dynamicVar(name); ok {
+		return vr, true
+	}
 	if val, e := r.cmdVars[name]; e {
 		return Variable{Value: StringVal(val)}, true
 	}
@@ -178,6 +185,9 @@ func (r *Runner) delVar(name string) {
 	delete(r.funcVars, name)
 	delete(r.cmdVars, name)
 	r.Env.Delete(name)
+	if name == "IFS" {
+		r.setIFS(" \t\n") // an unset IFS acts like the default
+	}
 }
 
 // maxNameRefDepth defines the maximum number of times to follow
@@ -216,7 +226,7 @@ func (r *Runner) varInd(ctx context.Context, vr Variable, e syntax.ArithmExpr, d
 			vr, _ = r.lookupVar(string(x))
 			return r.varInd(ctx, vr, e, depth+1)
 		}
-		if r.arithm(ctx, e) == 0 {
+		if anyOfLit(e, "@", "*") != "" || r.arithm(ctx, e) == 0 {
 			return string(x)
 		}
 	case IndexArray:
@@ -232,15 +242,7 @@ func (r *Runner) varInd(ctx context.Context, vr Variable, e syntax.ArithmExpr, d
 		}
 	case AssocArray:
 		if lit := anyOfLit(e, "@", "*"); lit != "" {
-			var strs IndexArray
-			keys := make([]string, 0, len(x))
-			for k := range x {
-				keys = append(keys, k)
-			}
-			sort.Strings(keys)
-			for _, k := range keys {
-				strs = append(strs, x[k])
-			}
+			strs := assocValues(x)
 			if lit == "*" {
 				return strings.Join(strs, r.ifsJoin)
 			}
@@ -251,6 +253,20 @@ func (r *Runner) varInd(ctx context.Context, vr Variable, e syntax.ArithmExpr, d
 	return ""
 }
 
+// assocValues returns the values of an associative array, sorted by key.
+func assocValues(m AssocArray) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	vals := make([]string, len(keys))
+	for i, k := range keys {
+		vals[i] = m[k]
+	}
+	return vals
+}
+
 func (r *Runner) setVarString(ctx context.Context, name, val string) {
 	r.setVar(ctx, name, nil, Variable{Value: StringVal(val)})
 }
@@ -271,11 +287,53 @@ func (r *Runner) setVarInternal(name string, vr Variable) {
 	} else {
 		r.Vars[name] = vr
 	}
-	if name == "IFS" {
+	switch name {
+	case "IFS":
 		r.ifsUpdated()
+	case "RANDOM":
+		seed, _ := strconv.ParseInt(r.varStr(vr, 0), 10, 64)
+		r.rand = rand.New(rand.NewSource(seed))
+	case "SECONDS":
+		secs, _ := strconv.Atoi(r.varStr(vr, 0))
+		r.startTime = r.now().Add(-time.Duration(secs) * time.Second)
 	}
 }
 
+// dynamicVar returns the value of the special variables which change on
+// their own, like $RANDOM.
+func (r *Runner) dynamicVar(name string) (Variable, bool) {
+	switch name {
+	case "RANDOM":
+		var n int
+		if r.Random != nil {
+			n = r.Random()
+		} else {
+			n = r.rand.Intn(32768)
+		}
+		return Variable{Value: StringVal(strconv.Itoa(n))}, true
+	case "SECONDS":
+		secs := r.now().Sub(r.startTime) / time.Second
+		return Variable{Value: StringVal(strconv.FormatInt(int64(secs), 10))}, true
+	case "FUNCNAME":
+		if len(r.funcStack) == 0 {
+			break // only set within functions
+		}
+		names := make(IndexArray, 0, len(r.funcStack)+1)
+		for i := len(r.funcStack) - 1; i >= 0; i-- {
+			names = append(names, r.funcStack[i])
+		}
+		return Variable{Value: append(names, "main")}, true
+	}
+	return Variable{}, false
+}
+
+func (r *Runner) now() time.Time {
+	if r.Now != nil {
+		return r.Now()
+	}
+	return time.Now()
+}
+
 func (r *Runner) setVar(ctx context.Context, name string, index syntax.ArithmExpr, vr Variable) {
 	cur, _ := r.lookupVar(name)
 	if cur.ReadOnly {
@@ -358,13 +416,24 @@ func stringIndex(index syntax.ArithmExpr) bool {
 	return false
 }
 
-func (r *Runner) assignVal(ctx context.Context, as *syntax.Assign, valType string) VarValue {
+// assignVal returns the value that an assignment gives to its variable,
+// where integer is whether the value is to be evaluated arithmetically
+// even if the variable doesn't have the integer attribute yet.
+func (r *Runner) assignVal(ctx context.Context, as *syntax.Assign, valType string, integer bool) VarValue {
 	prev, prevOk := r.lookupVar(as.Name.Value)
 	if as.Naked {
 		return prev.Value
 	}
 	if as.Value != nil {
 		s := r.loneWord(ctx, as.Value)
+		str, isStr := prev.Value.(StringVal)
+		if (integer || prev.Integer) && (isStr || prev.Value == nil) {
+			n := r.arithmStr(ctx, s)
+			if as.Append {
+				n += r.arithmStr(ctx, string(str))
+			}
+			return StringVal(strconv.Itoa(n))
+		}
 		if !as.Append || !prevOk {
 			return StringVal(s)
 		}
@@ -383,7 +452,11 @@ func (r *Runner) assignVal(ctx context.Context, as *syntax.Assign, valType strin
 		return StringVal(s)
 	}
 	if as.Array == nil {
-		return nil
+		// a= assigns the empty string, while a+= appends nothing
+		if as.Append && prevOk {
+			return prev.Value
+		}
+		return StringVal("")
 	}
 	elems := as.Array.Elems
 	if valType == "" {
@@ -440,7 +513,13 @@ func (r *Runner) assignVal(ctx context.Context, as *syntax.Assign, valType strin
 }
 
 func (r *Runner) ifsUpdated() {
-	runes := r.getVar("IFS")
+	r.setIFS(r.getVar("IFS"))
+}
+
+// setIFS sets the characters used to split and join fields, which may be
+// different from the value of IFS if the variable is unset.
+func (r *Runner) setIFS(runes string) {
+	r.ifs = runes
 	r.ifsJoin = ""
 	if len(runes) > 0 {
 		r.ifsJoin = runes[:1]
@@ -0,0 +1,162 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+// Package repl implements an interactive shell on top of the syntax and
+// interp packages, so that Go programs can embed one.
+//
+// Input is read from the runner's standard input one line at a time. Each
+// complete entry is evaluated as soon as it has been read, and a
+// secondary prompt is shown while an entry is incomplete, such as after
+// an unterminated if clause or quote, or a line ending in a backslash.
+//
+// This package is a work in progress and EXPERIMENTAL; its API is not
+// subject to the 1.x backwards compatibility guarantee.
+package repl
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"mvdan.cc/sh/interp"
+	"mvdan.cc/sh/syntax"
+)
+
+// REPL reads, evaluates and prints shell entries interactively.
+type REPL struct {
+	runner  *interp.Runner
+	parser  *syntax.Parser
+	prompt  func(incomplete bool) string
+	history func(entry string)
+}
+
+// New creates a new REPL which evaluates entries with runner, applying a
+// number of options. The runner's standard input must be non-nil.
+func New(runner *interp.Runner, options ...func(*REPL)) *REPL {
+	r := &REPL{runner: runner, parser: syntax.NewParser()}
+	for _, opt := range options {
+		opt(r)
+	}
+	return r
+}
+
+// Parser sets the parser used to read entries, such as one for a
+// particular language variant.
+func Parser(p *syntax.Parser) func(*REPL) {
+	return func(r *REPL) { r.parser = p }
+}
+
+// Prompt sets the function that returns the prompt to show before reading
+// each line. It returns the secondary prompt if the entry being read is
+// incomplete.
+//
+// By default, the values of the PS1 and PS2 shell variables are expanded
+// with interp.Runner.ExpandPrompt, falling back to "$ " and "> ". The
+// markers of non-printing characters, \[ and \], are removed.
+func Prompt(fn func(incomplete bool) string) func(*REPL) {
+	return func(r *REPL) { r.prompt = fn }
+}
+
+// History sets a function to be called with each complete entry, just
+// before it is evaluated. Entries may span multiple lines, and exclude the
+// trailing newline. Empty entries are skipped.
+func History(fn func(entry string)) func(*REPL) {
+	return func(r *REPL) { r.history = fn }
+}
+
+func (r *REPL) showPrompt(ctx context.Context, incomplete bool) {
+	var prompt string
+	if r.prompt != nil {
+		prompt = r.prompt(incomplete)
+	} else {
+		prompt = r.defaultPrompt(ctx, incomplete)
+	}
+	io.WriteString(r.runner.Stderr, prompt)
+}
+
+func (r *REPL) defaultPrompt(ctx context.Context, incomplete bool) string {
+	name, def := "PS1", "$ "
+	if incomplete {
+		name, def = "PS2", "> "
+	}
+	var ps string
+	if vr, ok := r.runner.Vars[name]; ok {
+		s, _ := vr.Value.(interp.StringVal)
+		ps = string(s)
+	} else if s, ok := r.runner.Env.Get(name); ok {
+		ps = s
+	} else {
+		return def
+	}
+	ps = r.runner.ExpandPrompt(ctx, ps)
+	return strings.NewReplacer("\x01", "", "\x02", "").Replace(ps)
+}
+
+// Run reads and evaluates entries until the input ends, or until the shell
+// exits, in which case the interp.ShellExitStatus is returned. Prompts and
+// syntax errors are written to the runner's standard error. A syntax error
+// discards the entry being read, as well as any input that was read along
+// with it.
+func (r *REPL) Run(ctx context.Context) error {
+	in := &recordReader{r: r.runner.Stdin}
+	for {
+		var runErr error
+		fn := func(stmts []*syntax.Stmt, incomplete bool) bool {
+			if err := r.eval(ctx, in, stmts, incomplete); err != nil {
+				runErr = err
+				return false
+			}
+			r.showPrompt(ctx, incomplete)
+			return true
+		}
+		err := r.parser.Interactive(in, fn)
+		switch {
+		case runErr != nil:
+			return runErr
+		case err == nil:
+			return nil
+		}
+		switch err.(type) {
+		case syntax.ParseError, syntax.LangError:
+		default:
+			return err // e.g. a read error
+		}
+		fmt.Fprintln(r.runner.Stderr, err)
+		in.buf.Reset()
+	}
+}
+
+// eval runs the statements completed so far, first reporting the entry to
+// the history function if it is complete. It returns a non-nil error if
+// the shell must stop.
+func (r *REPL) eval(ctx context.Context, in *recordReader, stmts []*syntax.Stmt, incomplete bool) error {
+	if !incomplete {
+		entry := strings.TrimSuffix(in.buf.String(), "\n")
+		in.buf.Reset()
+		if r.history != nil && strings.TrimSpace(entry) != "" {
+			r.history(entry)
+		}
+	}
+	for _, stmt := range stmts {
+		switch err := r.runner.Run(ctx, stmt); err.(type) {
+		case nil, interp.ExitStatus:
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// recordReader records the input read since the last complete entry.
+type recordReader struct {
+	r   io.Reader
+	buf bytes.Buffer
+}
+
+func (rr *recordReader) Read(p []byte) (int, error) {
+	n, err := rr.r.Read(p)
+	rr.buf.Write(p[:n])
+	return n, err
+}
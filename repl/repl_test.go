@@ -0,0 +1,130 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package repl
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+
+	"mvdan.cc/sh/interp"
+)
+
+// lineReader returns one line per Read call, like a terminal.
+type lineReader []string
+
+func (l *lineReader) Read(p []byte) (int, error) {
+	if len(*l) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, (*l)[0])
+	*l = (*l)[1:]
+	return n, nil
+}
+
+var runTests = []struct {
+	in      []string
+	want    string
+	wantErr error
+}{
+	{
+		[]string{},
+		"$ ",
+		nil,
+	},
+	{
+		[]string{"echo foo\n", "false\n"},
+		"$ foo\n$ $ ",
+		nil,
+	},
+	{
+		[]string{"echo foo"},
+		"$ foo\n$ ",
+		nil,
+	},
+	{
+		[]string{"if true; then\n", "echo bar\n", "fi\n"},
+		"$ > > bar\n$ ",
+		nil,
+	},
+	{
+		[]string{"echo 'a\n", "b'\n", "echo c \\\n", "d\n"},
+		"$ > a\nb\n$ > c d\n$ ",
+		nil,
+	},
+	{
+		[]string{"foo(\n", "echo ok\n"},
+		"$ 1:1: \"foo(\" must be followed by )\n$ ok\n$ ",
+		nil,
+	},
+	{
+		[]string{"echo foo; exit 3\n", "echo bar\n"},
+		"$ foo\n",
+		interp.ShellExitStatus(3),
+	},
+	{
+		[]string{"PS1='% ' PS2=.\n", "for i in 1 2; do\n", "echo $i; done\n"},
+		"$ % .1\n2\n% ",
+		nil,
+	},
+	{
+		[]string{"a=1 PS1='\\[x\\]$a\\n> '\n", "a=2\n"},
+		"$ x1\n> x2\n> ",
+		nil,
+	},
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+	for i, tc := range runTests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			in := lineReader(tc.in)
+			var out bytes.Buffer
+			runner, err := interp.New(interp.StdIO(&in, &out, &out))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = New(runner).Run(context.Background())
+			if err != tc.wantErr {
+				t.Fatalf("want error %v, got %v", tc.wantErr, err)
+			}
+			if got := out.String(); got != tc.want {
+				t.Fatalf("want output:\n%q\ngot:\n%q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestHistory(t *testing.T) {
+	t.Parallel()
+	in := lineReader{
+		"echo foo\n",
+		"\n",
+		"if true; then\n", "\techo bar\n", "fi\n",
+		"foo(\n",
+		"echo baz",
+	}
+	runner, err := interp.New(interp.StdIO(&in, nil, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	r := New(runner,
+		History(func(entry string) { got = append(got, entry) }),
+		Prompt(func(bool) string { return "" }))
+	if err := r.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"echo foo",
+		"if true; then\n\techo bar\nfi",
+		"echo baz",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("want history:\n%q\ngot:\n%q", want, got)
+	}
+}
@@ -91,5 +91,6 @@ func SourceNode(node syntax.Node) (map[string]interp.Variable, error) {
 	delete(r.Vars, "PATH")
 	delete(r.Vars, "IFS")
 	delete(r.Vars, "OPTIND")
+	delete(r.Vars, "PS4")
 	return r.Vars, nil
 }
@@ -0,0 +1,240 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package shell
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"mvdan.cc/sh/syntax"
+)
+
+const tmplPlaceholder = "__shtmpl"
+
+// Template parses a shell program with fmt-like verbs, replacing each verb
+// with the corresponding value in args as a single quoted string. Values
+// are never parsed as shell code, so they cannot inject extra words,
+// expansions or commands into the program.
+//
+// The supported verbs are %s and %v, which format the value like
+// fmt.Sprint, and %d, which requires an integer. %% is a literal percent
+// sign.
+//
+// Verbs may only appear where a shell word or part of a word is expected,
+// including within double quotes. Verbs within single quotes, arithmetic
+// expressions, heredoc bodies, comments, or in place of a name, such as in
+// "%s=value", result in an error.
+func Template(format string, args ...interface{}) (*syntax.File, error) {
+	if strings.Contains(format, tmplPlaceholder) {
+		return nil, fmt.Errorf("format cannot contain %q", tmplPlaceholder)
+	}
+	var src bytes.Buffer
+	var values []string
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' {
+			src.WriteByte(c)
+			continue
+		}
+		if i++; i == len(format) {
+			return nil, fmt.Errorf("format ends with a lone %%")
+		}
+		verb := format[i]
+		if verb == '%' {
+			src.WriteByte('%')
+			continue
+		}
+		if len(values) == len(args) {
+			return nil, fmt.Errorf("missing argument for verb %d", len(values))
+		}
+		arg := args[len(values)]
+		switch verb {
+		case 's', 'v':
+			values = append(values, fmt.Sprint(arg))
+		case 'd':
+			switch reflect.ValueOf(arg).Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+				reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16,
+				reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			default:
+				return nil, fmt.Errorf("verb %d: %%d requires an integer, got %T",
+					len(values), arg)
+			}
+			values = append(values, fmt.Sprintf("%d", arg))
+		default:
+			return nil, fmt.Errorf("unsupported verb %%%c", verb)
+		}
+		fmt.Fprintf(&src, "%s%d_", tmplPlaceholder, len(values)-1)
+	}
+	if len(values) < len(args) {
+		return nil, fmt.Errorf("%d arguments given but only %d verbs used",
+			len(args), len(values))
+	}
+	f, err := syntax.NewParser().Parse(&src, "")
+	if err != nil {
+		return nil, err
+	}
+	tr := tmplReplacer{values: values, done: make([]bool, len(values)),
+		added: make(map[*syntax.Lit]bool)}
+	syntax.Walk(f, tr.walk)
+	for i, done := range tr.done {
+		if !done {
+			return nil, fmt.Errorf("verb %d is not in a word position", i)
+		}
+	}
+	return f, nil
+}
+
+// TemplateString is like Template, but returns the resulting program
+// printed as a string.
+func TemplateString(format string, args ...interface{}) (string, error) {
+	f, err := Template(format, args...)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := syntax.NewPrinter().Print(&buf, f); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+type tmplReplacer struct {
+	values []string
+	done   []bool
+
+	// added holds the literals we created, which must not be replaced
+	// again even if their values happen to contain placeholders.
+	added map[*syntax.Lit]bool
+}
+
+func (tr *tmplReplacer) walk(node syntax.Node) bool {
+	switch x := node.(type) {
+	case *syntax.Word:
+		x.Parts = tr.parts(x.Parts, false)
+	case *syntax.DblQuoted:
+		x.Parts = tr.parts(x.Parts, true)
+	case *syntax.Redirect:
+		// quotes are not special in heredoc bodies
+		if x.N != nil {
+			syntax.Walk(x.N, tr.walk)
+		}
+		syntax.Walk(x.Word, tr.walk)
+		return false
+	case *syntax.ParamExp:
+		// the parameter name, index and slice are not words
+		if x.Exp != nil && x.Exp.Word != nil {
+			syntax.Walk(x.Exp.Word, tr.walk)
+		}
+		if x.Repl != nil {
+			syntax.Walk(x.Repl.Orig, tr.walk)
+			if x.Repl.With != nil {
+				syntax.Walk(x.Repl.With, tr.walk)
+			}
+		}
+		return false
+	case *syntax.Assign:
+		if x.Value != nil {
+			syntax.Walk(x.Value, tr.walk)
+		}
+		if x.Array != nil {
+			for _, elem := range x.Array.Elems {
+				if elem.Value != nil {
+					syntax.Walk(elem.Value, tr.walk)
+				}
+			}
+		}
+		return false
+	case *syntax.ArithmExp, *syntax.ArithmCmd, *syntax.LetClause,
+		*syntax.CStyleLoop:
+		return false
+	}
+	return true
+}
+
+// parts replaces the placeholders in the literals among wps with the
+// quoted values they stand for.
+func (tr *tmplReplacer) parts(wps []syntax.WordPart, dquoted bool) []syntax.WordPart {
+	var res []syntax.WordPart
+	for _, wp := range wps {
+		lit, ok := wp.(*syntax.Lit)
+		if !ok || tr.added[lit] || !strings.Contains(lit.Value, tmplPlaceholder) {
+			res = append(res, wp)
+			continue
+		}
+		s := lit.Value
+		for {
+			i := strings.Index(s, tmplPlaceholder)
+			if i < 0 {
+				break
+			}
+			rest := s[i+len(tmplPlaceholder):]
+			end := strings.IndexByte(rest, '_')
+			n, err := strconv.Atoi(rest[:end])
+			if err != nil || n >= len(tr.values) {
+				panic("invalid template placeholder")
+			}
+			if i > 0 {
+				res = append(res, tr.lit(lit, s[:i]))
+			}
+			if dquoted {
+				res = append(res, tr.lit(lit, dquoteEscape(tr.values[n])))
+			} else {
+				res = append(res, tr.quoted(lit, tr.values[n])...)
+			}
+			tr.done[n] = true
+			s = rest[end+1:]
+		}
+		if s != "" {
+			res = append(res, tr.lit(lit, s))
+		}
+	}
+	return res
+}
+
+func (tr *tmplReplacer) lit(orig *syntax.Lit, value string) *syntax.Lit {
+	l := &syntax.Lit{ValuePos: orig.ValuePos, ValueEnd: orig.ValueEnd, Value: value}
+	tr.added[l] = true
+	return l
+}
+
+// quoted returns the parts that represent a string as a single word.
+// Single quotes cannot be escaped within single quotes, so they are
+// added as separate escaped literals.
+func (tr *tmplReplacer) quoted(orig *syntax.Lit, s string) []syntax.WordPart {
+	if s == "" {
+		return []syntax.WordPart{tr.sglQuoted(orig, "")}
+	}
+	var res []syntax.WordPart
+	for i, part := range strings.Split(s, "'") {
+		if i > 0 {
+			res = append(res, tr.lit(orig, `\'`))
+		}
+		if part != "" {
+			res = append(res, tr.sglQuoted(orig, part))
+		}
+	}
+	return res
+}
+
+func (tr *tmplReplacer) sglQuoted(orig *syntax.Lit, value string) *syntax.SglQuoted {
+	return &syntax.SglQuoted{Left: orig.ValuePos, Right: orig.ValuePos, Value: value}
+}
+
+// dquoteEscape escapes the characters that are special within double
+// quotes.
+func dquoteEscape(s string) string {
+	var buf bytes.Buffer
+	for _, r := range s {
+		switch r {
+		case '$', '`', '"', '\\':
+			buf.WriteByte('\\')
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package shell
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"mvdan.cc/sh/interp"
+)
+
+var templateTests = []struct {
+	format string
+	args   []interface{}
+	want   string
+}{
+	{"foo", nil, "foo"},
+	{"echo 100%%", nil, "echo 100%"},
+	{"tar -C %s -xf %s", []interface{}{"/tmp/a b", "x.tgz"}, "tar -C '/tmp/a b' -xf 'x.tgz'"},
+	{"echo %s", []interface{}{""}, "echo ''"},
+	{"echo %s", []interface{}{"it's"}, `echo 'it'\''s'`},
+	{"echo %s", []interface{}{"'"}, `echo \'`},
+	{"echo %s", []interface{}{"$(rm -rf /); `x`"}, "echo '$(rm -rf /); `x`'"},
+	{"echo pre%s*.go", []interface{}{"*"}, "echo pre'*'*.go"},
+	{"echo %s%s", []interface{}{"a", 3}, "echo 'a''3'"},
+	{"echo \"x %s y\"", []interface{}{`"$HOME" \ ` + "`"}, "echo \"x \\\"\\$HOME\\\" \\\\ \\` y\""},
+	{"foo=%s bar >%s", []interface{}{"a b", "out file"}, "foo='a b' bar >'out file'"},
+	{"arr=(%s x)", []interface{}{"a b"}, "arr=('a b' x)"},
+	{"echo ${x:-%s}", []interface{}{"a b"}, "echo ${x:-'a b'}"},
+	{"case %s in %s) ;; esac", []interface{}{"x y", "*"}, "case 'x y' in '*') ;; esac"},
+	{"sleep %d", []interface{}{uint8(3)}, "sleep '3'"},
+	{"echo %s", []interface{}{"__shtmpl0_"}, "echo '__shtmpl0_'"},
+}
+
+func TestTemplate(t *testing.T) {
+	for i := range templateTests {
+		t.Run(fmt.Sprintf("%02d", i), func(t *testing.T) {
+			tc := templateTests[i]
+			t.Parallel()
+			got, err := TemplateString(tc.format, tc.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Fatalf("\nwant: %q\ngot:  %q", tc.want, got)
+			}
+		})
+	}
+}
+
+var templateErrTests = []struct {
+	format string
+	args   []interface{}
+	want   string
+}{
+	{"echo %s", nil, "missing argument for verb 0"},
+	{"echo", []interface{}{"x"}, "1 arguments given but only 0 verbs used"},
+	{"echo %", nil, "format ends with a lone %"},
+	{"echo %x", []interface{}{"x"}, "unsupported verb %x"},
+	{"sleep %d", []interface{}{"3"}, "verb 0: %d requires an integer, got string"},
+	{"echo __shtmpl", nil, `format cannot contain "__shtmpl"`},
+	{"echo '%s'", []interface{}{"x"}, "verb 0 is not in a word position"},
+	{"%s=foo", []interface{}{"x"}, "verb 0 is not in a word position"},
+	{"echo $((%s + 1))", []interface{}{"x"}, "verb 0 is not in a word position"},
+	{"echo ${%s}", []interface{}{"x"}, "verb 0 is not in a word position"},
+	{"cat <<EOF\n%s\nEOF", []interface{}{"x"}, "verb 0 is not in a word position"},
+	{"echo 'a", nil, "1:6: reached EOF without closing quote '"},
+}
+
+func TestTemplateError(t *testing.T) {
+	for i := range templateErrTests {
+		t.Run(fmt.Sprintf("%02d", i), func(t *testing.T) {
+			tc := templateErrTests[i]
+			t.Parallel()
+			_, err := Template(tc.format, tc.args...)
+			if err == nil {
+				t.Fatalf("wanted error %q, got none", tc.want)
+			}
+			if got := err.Error(); got != tc.want {
+				t.Fatalf("\nwant: %q\ngot:  %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestTemplateRun(t *testing.T) {
+	t.Parallel()
+	values := []string{
+		"a b", "", "'", `"`, "$HOME", "$(echo x)", "`echo x`",
+		"; echo injected", "*", "\\", "\n", "{a,b}", "~", "-n",
+	}
+	for _, value := range values {
+		f, err := Template(`printf '[%%s]' %s "%s" x%s`, value, value, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		r, err := interp.New(interp.StdIO(nil, &buf, &buf))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Run(context.Background(), f); err != nil {
+			t.Fatal(err)
+		}
+		want := fmt.Sprintf("[%s][%s][x%s]", value, value, value)
+		if got := buf.String(); got != want {
+			t.Errorf("value %q:\nwant: %q\ngot:  %q", value, want, got)
+		}
+	}
+}
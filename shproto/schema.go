@@ -0,0 +1,307 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package shproto
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+
+	"mvdan.cc/sh/syntax"
+)
+
+var (
+	fileType     = reflect.TypeOf(syntax.File{})
+	posType      = reflect.TypeOf(syntax.Pos{})
+	stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+)
+
+// variants lists the implementations of each of the node interfaces, in
+// the order of their field numbers within the interface's message. New
+// implementations must only be appended, so that the numbers don't change.
+var variants = map[reflect.Type][]reflect.Type{
+	reflect.TypeOf((*syntax.Command)(nil)).Elem(): {
+		reflect.TypeOf(syntax.CallExpr{}),
+		reflect.TypeOf(syntax.IfClause{}),
+		reflect.TypeOf(syntax.WhileClause{}),
+		reflect.TypeOf(syntax.ForClause{}),
+		reflect.TypeOf(syntax.CaseClause{}),
+		reflect.TypeOf(syntax.Block{}),
+		reflect.TypeOf(syntax.Subshell{}),
+		reflect.TypeOf(syntax.BinaryCmd{}),
+		reflect.TypeOf(syntax.FuncDecl{}),
+		reflect.TypeOf(syntax.ArithmCmd{}),
+		reflect.TypeOf(syntax.TestClause{}),
+		reflect.TypeOf(syntax.DeclClause{}),
+		reflect.TypeOf(syntax.LetClause{}),
+		reflect.TypeOf(syntax.TimeClause{}),
+		reflect.TypeOf(syntax.CoprocClause{}),
+		reflect.TypeOf(syntax.NamespaceClause{}),
+		reflect.TypeOf(syntax.AnonFunc{}),
+	},
+	reflect.TypeOf((*syntax.WordPart)(nil)).Elem(): {
+		reflect.TypeOf(syntax.Lit{}),
+		reflect.TypeOf(syntax.SglQuoted{}),
+		reflect.TypeOf(syntax.DblQuoted{}),
+		reflect.TypeOf(syntax.ParamExp{}),
+		reflect.TypeOf(syntax.CmdSubst{}),
+		reflect.TypeOf(syntax.ArithmExp{}),
+		reflect.TypeOf(syntax.ProcSubst{}),
+		reflect.TypeOf(syntax.ExtGlob{}),
+	},
+	reflect.TypeOf((*syntax.ArithmExpr)(nil)).Elem(): {
+		reflect.TypeOf(syntax.BinaryArithm{}),
+		reflect.TypeOf(syntax.UnaryArithm{}),
+		reflect.TypeOf(syntax.ParenArithm{}),
+		reflect.TypeOf(syntax.Word{}),
+	},
+	reflect.TypeOf((*syntax.TestExpr)(nil)).Elem(): {
+		reflect.TypeOf(syntax.BinaryTest{}),
+		reflect.TypeOf(syntax.UnaryTest{}),
+		reflect.TypeOf(syntax.ParenTest{}),
+		reflect.TypeOf(syntax.Word{}),
+	},
+	reflect.TypeOf((*syntax.Loop)(nil)).Elem(): {
+		reflect.TypeOf(syntax.WordIter{}),
+		reflect.TypeOf(syntax.CStyleLoop{}),
+	},
+}
+
+// fieldNumbers holds the field number of each struct field, per message.
+// Numbers must never change, so that messages encoded by other versions of
+// this package or by other programs can still be decoded. New struct fields
+// must be given new numbers, and the numbers of removed fields must not be
+// reused.
+var fieldNumbers = map[string]map[string]int{
+	"AnonFunc":        {"Position": 1, "RsrvWord": 2, "Body": 3, "Args": 4},
+	"ArithmCmd":       {"Left": 1, "Right": 2, "Unsigned": 3, "X": 4},
+	"ArithmExp":       {"Left": 1, "Right": 2, "Bracket": 3, "Unsigned": 4, "X": 5},
+	"ArrayElem":       {"Index": 1, "Value": 2, "Comments": 3},
+	"ArrayExpr":       {"Lparen": 1, "Rparen": 2, "Elems": 3, "Last": 4},
+	"Assign":          {"Append": 1, "Naked": 2, "Name": 3, "Index": 4, "Value": 5, "Array": 6},
+	"BinaryArithm":    {"OpPos": 1, "Op": 2, "X": 3, "Y": 4},
+	"BinaryCmd":       {"OpPos": 1, "Op": 2, "X": 3, "Y": 4},
+	"BinaryTest":      {"OpPos": 1, "Op": 2, "X": 3, "Y": 4},
+	"Block":           {"Lbrace": 1, "Rbrace": 2, "StmtList": 3},
+	"CStyleLoop":      {"Lparen": 1, "Rparen": 2, "Init": 3, "Cond": 4, "Post": 5},
+	"CallExpr":        {"Assigns": 1, "Args": 2, "Handler": 3, "Script": 4},
+	"CaseClause":      {"Case": 1, "Esac": 2, "Word": 3, "Items": 4, "Last": 5},
+	"CaseItem":        {"Op": 1, "OpPos": 2, "Comments": 3, "Patterns": 4, "StmtList": 5},
+	"CmdSubst":        {"Left": 1, "Right": 2, "StmtList": 3, "TempFile": 4, "ReplyVar": 5},
+	"Comment":         {"Hash": 1, "Text": 2},
+	"CoprocClause":    {"Coproc": 1, "Name": 2, "Stmt": 3},
+	"DblQuoted":       {"Position": 1, "Dollar": 2, "Parts": 3},
+	"DeclClause":      {"Variant": 1, "Opts": 2, "Assigns": 3},
+	"Expansion":       {"Op": 1, "Word": 2},
+	"ExtGlob":         {"OpPos": 1, "Op": 2, "Pattern": 3},
+	"File":            {"Name": 1, "StmtList": 2},
+	"ForClause":       {"ForPos": 1, "DoPos": 2, "DonePos": 3, "Select": 4, "Loop": 5, "Do": 6, "Braces": 7},
+	"FuncDecl":        {"Position": 1, "RsrvWord": 2, "Name": 3, "Body": 4},
+	"IfClause":        {"Elif": 1, "IfPos": 2, "ThenPos": 3, "ElsePos": 4, "FiPos": 5, "Cond": 6, "Then": 7, "Else": 8},
+	"LetClause":       {"Let": 1, "Exprs": 2},
+	"Lit":             {"ValuePos": 1, "ValueEnd": 2, "Value": 3},
+	"NamespaceClause": {"Namespace": 1, "Lbrace": 2, "Rbrace": 3, "Name": 4, "StmtList": 5},
+	"ParamExp":        {"Dollar": 1, "Rbrace": 2, "Short": 3, "Excl": 4, "Length": 5, "Width": 6, "Param": 7, "Index": 8, "Slice": 9, "Repl": 10, "Names": 11, "Exp": 12, "Flags": 13},
+	"ParenArithm":     {"Lparen": 1, "Rparen": 2, "X": 3},
+	"ParenTest":       {"Lparen": 1, "Rparen": 2, "X": 3},
+	"ProcSubst":       {"OpPos": 1, "Rparen": 2, "Op": 3, "StmtList": 4},
+	"Redirect":        {"OpPos": 1, "Op": 2, "N": 3, "Word": 4, "Hdoc": 5},
+	"Replace":         {"All": 1, "Orig": 2, "With": 3},
+	"SglQuoted":       {"Left": 1, "Right": 2, "Dollar": 3, "Value": 4},
+	"Slice":           {"Offset": 1, "Length": 2},
+	"Stmt":            {"Comments": 1, "Cmd": 2, "Position": 3, "Semicolon": 4, "Negated": 5, "Background": 6, "Coprocess": 7, "Redirs": 8, "Terminator": 9},
+	"StmtList":        {"Stmts": 1, "Last": 2},
+	"Subshell":        {"Lparen": 1, "Rparen": 2, "StmtList": 3},
+	"TestClause":      {"Left": 1, "Right": 2, "X": 3},
+	"TimeClause":      {"Time": 1, "PosixFormat": 2, "Stmt": 3},
+	"UnaryArithm":     {"OpPos": 1, "Op": 2, "Post": 3, "X": 4},
+	"UnaryTest":       {"OpPos": 1, "Op": 2, "X": 3},
+	"WhileClause":     {"WhilePos": 1, "DoPos": 2, "DonePos": 3, "Until": 4, "Cond": 5, "Do": 6},
+	"Word":            {"Parts": 1},
+	"WordIter":        {"Name": 1, "Items": 2},
+}
+
+// field is a field of a message which corresponds to a struct field.
+type field struct {
+	num   int // the protobuf field number
+	index int // the struct field index
+	name  string
+	typ   reflect.Type
+}
+
+// messages holds the fields of every struct type reachable from File,
+// except Pos, which is encoded specially. The fields are sorted by number.
+var messages = make(map[reflect.Type][]field)
+
+func init() {
+	addMessage(fileType)
+}
+
+// addMessage registers a struct type and all the types it references,
+// taking the field numbers from fieldNumbers.
+func addMessage(t reflect.Type) {
+	if _, ok := messages[t]; ok || t == posType {
+		return
+	}
+	var fields []field
+	messages[t] = nil // avoid infinite recursion
+	nums := fieldNumbers[t.Name()]
+	for i := 0; i < t.NumField(); i++ {
+		ft := t.Field(i)
+		if ft.PkgPath != "" {
+			continue
+		}
+		num, ok := nums[ft.Name]
+		if !ok {
+			panic(fmt.Sprintf("shproto: no field number for %s.%s", t.Name(), ft.Name))
+		}
+		fields = append(fields, field{
+			num:   num,
+			index: i,
+			name:  ft.Name,
+			typ:   ft.Type,
+		})
+		addType(ft.Type)
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].num < fields[j].num
+	})
+	messages[t] = fields
+}
+
+// lookupField returns the field with the given number, if any.
+func lookupField(fields []field, num int) (field, bool) {
+	for _, f := range fields {
+		if f.num == num {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+func addType(t reflect.Type) {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice:
+		addType(t.Elem())
+	case reflect.Struct:
+		addMessage(t)
+	case reflect.Uint32:
+		if isOperator(t) {
+			addOperator(t)
+		}
+	case reflect.Interface:
+		for _, vt := range variants[t] {
+			addMessage(vt)
+		}
+	}
+}
+
+func isOperator(t reflect.Type) bool {
+	return t.Kind() == reflect.Uint32 && t.Implements(stringerType)
+}
+
+// operators maps, for each operator type, the string of each operator to
+// its value.
+var operators = make(map[reflect.Type]map[string]uint64)
+
+func addOperator(t reflect.Type) {
+	if _, ok := operators[t]; ok {
+		return
+	}
+	m := make(map[string]uint64)
+	// operators are tokens, which are few
+	for i := uint64(1); i < 256; i++ {
+		name := reflect.ValueOf(uint32(i)).Convert(t).Interface().(fmt.Stringer).String()
+		if _, ok := m[name]; !ok {
+			m[name] = i
+		}
+	}
+	operators[t] = m
+}
+
+// Schema returns the Protocol Buffers (proto3) definition of the messages
+// produced by Marshal. The root message is File.
+func Schema() string {
+	var buf bytes.Buffer
+	buf.WriteString(`// Code generated by mvdan.cc/sh/shproto. DO NOT EDIT.
+
+// Messages mirroring the node types of the mvdan.cc/sh/syntax Go package.
+// Operators are encoded as their string form, such as "&&".
+syntax = "proto3";
+
+package mvdan.sh.syntax;
+
+message Pos {
+  uint32 offset = 1;
+  uint32 line = 2;
+  uint32 col = 3;
+}
+`)
+	for _, t := range sortedTypes() {
+		if t.Kind() == reflect.Interface {
+			fmt.Fprintf(&buf, "\n// %s holds one of its implementations.\n", t.Name())
+			fmt.Fprintf(&buf, "message %s {\n  oneof node {\n", t.Name())
+			for i, vt := range variants[t] {
+				fmt.Fprintf(&buf, "    %s %s = %d;\n", vt.Name(), snakeCase(vt.Name()), i+1)
+			}
+			buf.WriteString("  }\n}\n")
+			continue
+		}
+		fmt.Fprintf(&buf, "\nmessage %s {\n", t.Name())
+		for _, f := range messages[t] {
+			fmt.Fprintf(&buf, "  %s %s = %d;\n", protoType(f.typ), snakeCase(f.name), f.num)
+		}
+		buf.WriteString("}\n")
+	}
+	return buf.String()
+}
+
+// sortedTypes returns all the message types, including interfaces, sorted
+// by name.
+func sortedTypes() []reflect.Type {
+	var types []reflect.Type
+	for t := range messages {
+		types = append(types, t)
+	}
+	for t := range variants {
+		types = append(types, t)
+	}
+	for i := 1; i < len(types); i++ {
+		for j := i; j > 0 && types[j].Name() < types[j-1].Name(); j-- {
+			types[j], types[j-1] = types[j-1], types[j]
+		}
+	}
+	return types
+}
+
+func protoType(t reflect.Type) string {
+	switch {
+	case t.Kind() == reflect.Slice:
+		return "repeated " + protoType(t.Elem())
+	case t.Kind() == reflect.Ptr:
+		return t.Elem().Name()
+	case t.Kind() == reflect.Bool:
+		return "bool"
+	case t.Kind() == reflect.String, isOperator(t):
+		return "string"
+	}
+	return t.Name()
+}
+
+func snakeCase(s string) string {
+	var buf bytes.Buffer
+	for i, r := range s {
+		if unicode.IsUpper(r) {
+			if i > 0 && !unicode.IsUpper(rune(s[i-1])) {
+				buf.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		buf.WriteRune(r)
+	}
+	return strings.TrimPrefix(buf.String(), "_")
+}
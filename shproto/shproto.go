@@ -0,0 +1,335 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+// Package shproto encodes shell syntax trees as Protocol Buffers messages.
+//
+// The schema, which can be obtained via Schema and is also shipped as
+// syntax.proto in this directory, mirrors the node types of the syntax
+// package field by field. This allows programs written in other languages
+// to consume syntax trees produced by a Go frontend, without having to
+// reimplement the shell grammar.
+//
+// Each interface type, such as Command, is a message with a oneof holding
+// one of its implementations. Operators are encoded as their string
+// representation, such as "&&" or "<<". Field numbers are fixed, so new
+// versions of the schema only ever add fields and implementations.
+//
+// This package is a work in progress and EXPERIMENTAL; its API is not
+// subject to the 1.x backwards compatibility guarantee.
+package shproto
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// Protocol Buffers wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// Marshal encodes a syntax tree as a File message.
+func Marshal(f *syntax.File) ([]byte, error) {
+	return appendMessage(nil, reflect.ValueOf(f).Elem())
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendTag(b []byte, num, wire int) []byte {
+	return appendVarint(b, uint64(num)<<3|uint64(wire))
+}
+
+func appendBytes(b []byte, num int, data []byte) []byte {
+	b = appendTag(b, num, wireBytes)
+	b = appendVarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+func appendMessage(b []byte, val reflect.Value) ([]byte, error) {
+	for _, f := range messages[val.Type()] {
+		var err error
+		if b, err = appendField(b, f.num, val.Field(f.index)); err != nil {
+			return nil, fmt.Errorf("%s.%s: %v", val.Type().Name(), f.name, err)
+		}
+	}
+	return b, nil
+}
+
+// appendField encodes a field, omitting it if it holds the zero value.
+func appendField(b []byte, num int, val reflect.Value) ([]byte, error) {
+	typ := val.Type()
+	switch {
+	case typ == posType:
+		pos := val.Interface().(syntax.Pos)
+		if !pos.IsValid() {
+			return b, nil
+		}
+		var data []byte
+		for i, n := range [...]uint{pos.Offset(), pos.Line(), pos.Col()} {
+			if n != 0 {
+				data = appendTag(data, i+1, wireVarint)
+				data = appendVarint(data, uint64(n))
+			}
+		}
+		return appendBytes(b, num, data), nil
+	case isOperator(typ):
+		if val.Uint() == 0 {
+			return b, nil
+		}
+		s := val.Interface().(fmt.Stringer).String()
+		return appendBytes(b, num, []byte(s)), nil
+	}
+	switch typ.Kind() {
+	case reflect.Bool:
+		if !val.Bool() {
+			return b, nil
+		}
+		b = appendTag(b, num, wireVarint)
+		return append(b, 1), nil
+	case reflect.String:
+		if val.Len() == 0 {
+			return b, nil
+		}
+		return appendBytes(b, num, []byte(val.String())), nil
+	case reflect.Slice:
+		for i := 0; i < val.Len(); i++ {
+			var err error
+			if b, err = appendElem(b, num, val.Index(i)); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case reflect.Ptr, reflect.Interface:
+		if val.IsNil() {
+			return b, nil
+		}
+	case reflect.Struct:
+		if reflect.DeepEqual(val.Interface(), reflect.Zero(typ).Interface()) {
+			return b, nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported type %s", typ)
+	}
+	return appendElem(b, num, val)
+}
+
+// appendElem encodes a value even if it is the zero value, as is needed
+// for the elements of repeated fields.
+func appendElem(b []byte, num int, val reflect.Value) ([]byte, error) {
+	switch val.Kind() {
+	case reflect.String:
+		return appendBytes(b, num, []byte(val.String())), nil
+	case reflect.Interface:
+		if val.IsNil() {
+			return appendBytes(b, num, nil), nil
+		}
+		elem := val.Elem().Elem()
+		for i, vt := range variants[val.Type()] {
+			if vt == elem.Type() {
+				data, err := appendElem(nil, i+1, elem)
+				if err != nil {
+					return nil, err
+				}
+				return appendBytes(b, num, data), nil
+			}
+		}
+		return nil, fmt.Errorf("unsupported %s type %s", val.Type().Name(), elem.Type())
+	case reflect.Ptr:
+		if val.IsNil() {
+			return appendBytes(b, num, nil), nil
+		}
+		val = val.Elem()
+	}
+	data, err := appendMessage(nil, val)
+	if err != nil {
+		return nil, err
+	}
+	return appendBytes(b, num, data), nil
+}
+
+// Unmarshal decodes a File message into a syntax tree. Unknown fields are
+// skipped, so that messages produced with newer versions of the schema can
+// still be decoded.
+//
+// Empty lists, such as a statement without redirections, are always
+// decoded as nil slices.
+func Unmarshal(data []byte) (*syntax.File, error) {
+	f := &syntax.File{}
+	if err := decodeMessage(data, reflect.ValueOf(f).Elem()); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+var errTruncated = errors.New("unexpected end of message")
+
+type decoder struct {
+	data []byte
+}
+
+func (d *decoder) varint() (uint64, error) {
+	var v uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		if len(d.data) == 0 {
+			return 0, errTruncated
+		}
+		c := d.data[0]
+		d.data = d.data[1:]
+		v |= uint64(c&0x7f) << shift
+		if c < 0x80 {
+			return v, nil
+		}
+	}
+	return 0, errors.New("varint overflows 64 bits")
+}
+
+func (d *decoder) bytes() ([]byte, error) {
+	n, err := d.varint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(d.data)) {
+		return nil, errTruncated
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b, nil
+}
+
+// next reads the next field, returning its number and wire type. For
+// length-delimited fields, the returned data holds its contents. For
+// varint fields, v holds its value.
+func (d *decoder) next() (num, wire int, v uint64, data []byte, err error) {
+	tag, err := d.varint()
+	if err != nil {
+		return 0, 0, 0, nil, err
+	}
+	num, wire = int(tag>>3), int(tag&7)
+	switch wire {
+	case wireVarint:
+		v, err = d.varint()
+	case wireBytes:
+		data, err = d.bytes()
+	case wireFixed64, wireFixed32:
+		n := 8
+		if wire == wireFixed32 {
+			n = 4
+		}
+		if len(d.data) < n {
+			return 0, 0, 0, nil, errTruncated
+		}
+		d.data = d.data[n:]
+	default:
+		err = fmt.Errorf("unsupported wire type %d", wire)
+	}
+	return num, wire, v, data, err
+}
+
+func decodeMessage(data []byte, val reflect.Value) error {
+	fields := messages[val.Type()]
+	d := decoder{data}
+	for len(d.data) > 0 {
+		num, wire, v, data, err := d.next()
+		if err != nil {
+			return err
+		}
+		f, ok := lookupField(fields, num)
+		if !ok {
+			continue // unknown field
+		}
+		if err := decodeField(wire, v, data, val.Field(f.index)); err != nil {
+			return fmt.Errorf("%s.%s: %v", val.Type().Name(), f.name, err)
+		}
+	}
+	return nil
+}
+
+func decodeField(wire int, v uint64, data []byte, val reflect.Value) error {
+	typ := val.Type()
+	if typ.Kind() == reflect.Bool {
+		if wire != wireVarint {
+			return fmt.Errorf("wire type %d is not a varint", wire)
+		}
+		val.SetBool(v != 0)
+		return nil
+	}
+	if wire != wireBytes {
+		return fmt.Errorf("wire type %d is not length-delimited", wire)
+	}
+	switch {
+	case typ == posType:
+		var nums [3]uint
+		d := decoder{data}
+		for len(d.data) > 0 {
+			num, wire, v, _, err := d.next()
+			if err != nil {
+				return err
+			}
+			if num >= 1 && num <= len(nums) && wire == wireVarint {
+				nums[num-1] = uint(v)
+			}
+		}
+		val.Set(reflect.ValueOf(syntax.NewPos(nums[0], nums[1], nums[2])))
+		return nil
+	case isOperator(typ):
+		op, ok := operators[typ][string(data)]
+		if !ok {
+			return fmt.Errorf("unknown %s %q", typ.Name(), data)
+		}
+		val.SetUint(op)
+		return nil
+	}
+	switch typ.Kind() {
+	case reflect.String:
+		val.SetString(string(data))
+	case reflect.Slice:
+		elem := reflect.New(typ.Elem()).Elem()
+		if err := decodeField(wire, v, data, elem); err != nil {
+			return err
+		}
+		val.Set(reflect.Append(val, elem))
+	case reflect.Interface:
+		vts := variants[typ]
+		d := decoder{data}
+		for len(d.data) > 0 {
+			num, wire, _, data, err := d.next()
+			if err != nil {
+				return err
+			}
+			if num < 1 || num > len(vts) {
+				continue // unknown variant
+			}
+			if wire != wireBytes {
+				return fmt.Errorf("wire type %d is not length-delimited", wire)
+			}
+			ptr := reflect.New(vts[num-1])
+			if err := decodeMessage(data, ptr.Elem()); err != nil {
+				return err
+			}
+			val.Set(ptr)
+		}
+	case reflect.Ptr:
+		ptr := reflect.New(typ.Elem())
+		if err := decodeMessage(data, ptr.Elem()); err != nil {
+			return err
+		}
+		val.Set(ptr)
+	case reflect.Struct:
+		return decodeMessage(data, val)
+	default:
+		return fmt.Errorf("unsupported type %s", typ)
+	}
+	return nil
+}
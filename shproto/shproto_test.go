@@ -0,0 +1,221 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package shproto
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+var update = flag.Bool("u", false, "update syntax.proto")
+
+func TestSchemaFile(t *testing.T) {
+	want := Schema()
+	if *update {
+		if err := ioutil.WriteFile("syntax.proto", []byte(want), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := ioutil.ReadFile("syntax.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Fatalf("syntax.proto is out of date; run go test -u")
+	}
+}
+
+func TestFieldNumbers(t *testing.T) {
+	for t2, fields := range messages {
+		seen := make(map[int]bool)
+		for _, f := range fields {
+			if seen[f.num] {
+				t.Errorf("%s: field number %d is used twice", t2.Name(), f.num)
+			}
+			seen[f.num] = true
+		}
+		for name := range fieldNumbers[t2.Name()] {
+			if _, ok := t2.FieldByName(name); !ok {
+				t.Errorf("%s: numbered field %s does not exist", t2.Name(), name)
+			}
+		}
+	}
+	for name := range fieldNumbers {
+		found := false
+		for t2 := range messages {
+			found = found || t2.Name() == name
+		}
+		if !found {
+			t.Errorf("numbered message %s does not exist", name)
+		}
+	}
+}
+
+// stableEncoding is the encoding of stableSrc, which must not change as
+// long as the existing field and variant numbers are kept.
+const stableSrc = "a=b foo >x 2>&1 && ! { bar; } # c"
+
+const stableEncoding = "" +
+	"0a04662e736812bb020ab8020a0c0a06081e1001181f1202206312a102429e02" +
+	"0a06081010011811120226261ab901124b0a490a2c1a110a0410011801120608" +
+	"01100118021a01612a170a150a130a0608021001180312060803100118041a01" +
+	"6212190a170a150a0608041001180512060807100118081a03666f6f1a041001" +
+	"180142240a0608081001180912013e22170a150a130a0608091001180a120608" +
+	"0a1001180b1a0178423a0a06080c1001180d12023e261a130a06080b1001180c" +
+	"1206080c1001180d1a013222170a150a130a06080e1001180f1206080f100118" +
+	"101a01314a0226262254124832460a060815100118161206081c1001181d1a34" +
+	"0a32121d0a1b12190a170a150a060817100118181206081a1001181b1a036261" +
+	"721a060817100118182206081a1001181b4a013b1a0608131001181428011a04" +
+	"10011801"
+
+func TestStableEncoding(t *testing.T) {
+	t.Parallel()
+	f, err := syntax.NewParser(syntax.KeepComments).Parse(strings.NewReader(stableSrc), "f.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(data); got != stableEncoding {
+		t.Fatalf("the encoding changed; field numbers must be kept stable:\nwant: %s\ngot:  %s",
+			stableEncoding, got)
+	}
+	got, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clearEmpty(reflect.ValueOf(f))
+	if !reflect.DeepEqual(got, f) {
+		t.Fatalf("stable encoding does not round trip")
+	}
+}
+
+var roundTripTests = []struct {
+	src  string
+	lang syntax.LangVariant
+}{
+	{"", syntax.LangBash},
+	{"# only a comment", syntax.LangBash},
+	{"foo bar 'baz' \"$x ${y:-z}\"", syntax.LangBash},
+	{"a=b cmd >out 2>&1 <<-EOF\n\tx $y\n\tEOF", syntax.LangBash},
+	{"foo && ! bar || baz | qux &", syntax.LangBash},
+	{"if a; then b; elif c; then d; else e; fi # end", syntax.LangBash},
+	{"while a; do b; done; until c; do d; done", syntax.LangBash},
+	{"for i in 1 2; do echo $i; done; for ((i = 0; i < 3; i++)); do :; done", syntax.LangBash},
+	{"case $x in a | b) foo ;; *) bar ;& esac", syntax.LangBash},
+	{"f() { (a); }; function g { b; }", syntax.LangBash},
+	{"echo $((1 + 2 * -x)) $(foo) `bar` <(baz) @(a|b)", syntax.LangBash},
+	{"((x++)); let y=2+3; [[ -n $a && ($b == c*) ]]", syntax.LangBash},
+	{"declare -a -x foo=bar; time -p sleep 1; coproc foo { bar; }", syntax.LangBash},
+	{"echo ${#x} ${x[1]} ${x:1:2} ${x/a/b} ${!x*} ${x^^}", syntax.LangBash},
+	{"c+=(1 2) d[3]=4; echo $'\\n' $\"foo\"", syntax.LangBash},
+	{"foo; bar\n\n# trailing", syntax.LangPOSIX},
+}
+
+func TestRoundTrip(t *testing.T) {
+	t.Parallel()
+	for i, tc := range roundTripTests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			p := syntax.NewParser(syntax.KeepComments, syntax.Variant(tc.lang))
+			want, err := p.Parse(strings.NewReader(tc.src), "file.sh")
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := Marshal(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Unmarshal(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			clearEmpty(reflect.ValueOf(want))
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("round trip mismatch for %q", tc.src)
+			}
+		})
+	}
+}
+
+// clearEmpty replaces empty slices with nil ones, as the two cannot be told
+// apart once encoded.
+func clearEmpty(val reflect.Value) {
+	switch val.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !val.IsNil() {
+			clearEmpty(val.Elem())
+		}
+	case reflect.Struct:
+		for i := 0; i < val.NumField(); i++ {
+			if val.Type().Field(i).PkgPath == "" {
+				clearEmpty(val.Field(i))
+			}
+		}
+	case reflect.Slice:
+		if val.Len() == 0 {
+			val.Set(reflect.Zero(val.Type()))
+		}
+		for i := 0; i < val.Len(); i++ {
+			clearEmpty(val.Index(i))
+		}
+	}
+}
+
+func TestUnmarshalUnknownFields(t *testing.T) {
+	t.Parallel()
+	f, err := syntax.NewParser().Parse(strings.NewReader("foo"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a varint at field 100 and a fixed32 at field 101, as a newer
+	// version of the schema might add
+	extra := append(appendTag(nil, 100, wireVarint), 7)
+	extra = append(appendTag(extra, 101, wireFixed32), 1, 2, 3, 4)
+	got, err := Unmarshal(append(extra, data...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, f) {
+		t.Fatalf("unknown fields changed the decoded tree")
+	}
+}
+
+var unmarshalErrTests = []struct {
+	data []byte
+	want string
+}{
+	{[]byte{0x12}, "unexpected end of message"},
+	{[]byte{0x12, 0x05, 0x00}, "unexpected end of message"},
+	{[]byte{0x0b}, "unsupported wire type 3"},
+	{[]byte{0x12, 0x02, 0x08, 0x01}, "File.StmtList: StmtList.Stmts: wire type 0 is not length-delimited"},
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	t.Parallel()
+	for i, tc := range unmarshalErrTests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			_, err := Unmarshal(tc.data)
+			if err == nil {
+				t.Fatalf("Unmarshal(%x) did not error", tc.data)
+			}
+			if got := err.Error(); got != tc.want {
+				t.Fatalf("Unmarshal(%x) error mismatch:\nwant: %s\ngot:  %s",
+					tc.data, tc.want, got)
+			}
+		})
+	}
+}
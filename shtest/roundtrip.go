@@ -0,0 +1,137 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package shtest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"mvdan.cc/sh/fileutil"
+	"mvdan.cc/sh/syntax"
+)
+
+// AssertRoundTrips checks that src, parsed with parser, is printed with
+// printer as a program which parses back to the same syntax tree save for
+// its positions, and that printing that program again results in the same
+// output. If parser or printer are nil, syntax.NewParser(syntax.KeepComments)
+// and syntax.NewPrinter() are used.
+//
+// It is meant for changes to the parser or printer, such as support for a
+// new language variant, to ensure that formatting a program never changes
+// what it does. Printers which drop or rewrite parts of a program, like
+// syntax.Minify dropping comments, cannot pass this check.
+func AssertRoundTrips(tb testing.TB, parser *syntax.Parser, printer *syntax.Printer, src string) {
+	tb.Helper()
+	roundTrip(tb, parser, printer, fmt.Sprintf("%q", src), []byte(src))
+}
+
+// AssertRoundTripsDir is like AssertRoundTrips, but it checks each shell
+// script in a directory and its subdirectories, such as a corpus of real
+// world scripts. Like with shfmt, scripts are found by their extension or
+// their shebang. All scripts are checked even if some fail.
+func AssertRoundTripsDir(tb testing.TB, parser *syntax.Parser, printer *syntax.Printer, dir string) {
+	tb.Helper()
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		conf := fileutil.CouldBeScript(info)
+		if conf == fileutil.ConfNotScript {
+			return nil
+		}
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if conf == fileutil.ConfIfShebang && !fileutil.HasShebang(src) {
+			return nil
+		}
+		roundTrip(tb, parser, printer, path, src)
+		return nil
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func roundTrip(tb testing.TB, parser *syntax.Parser, printer *syntax.Printer, name string, src []byte) {
+	tb.Helper()
+	if parser == nil {
+		parser = syntax.NewParser(syntax.KeepComments)
+	}
+	if printer == nil {
+		printer = syntax.NewPrinter()
+	}
+	f, err := parser.Parse(bytes.NewReader(src), "")
+	if err != nil {
+		tb.Errorf("could not parse %s: %v", name, err)
+		return
+	}
+	var once bytes.Buffer
+	if err := printer.Print(&once, f); err != nil {
+		tb.Errorf("could not print %s: %v", name, err)
+		return
+	}
+	f2, err := parser.Parse(bytes.NewReader(once.Bytes()), "")
+	if err != nil {
+		tb.Errorf("printing %s results in an invalid program: %v\n%s", name, err, once.Bytes())
+		return
+	}
+	if want, got := firstDiff(f, f2); want != got {
+		tb.Errorf("printing %s changes its syntax tree:\nwant: %s\ngot:  %s", name, want, got)
+		return
+	}
+	var twice bytes.Buffer
+	if err := printer.Print(&twice, f2); err != nil {
+		tb.Errorf("could not print %s: %v", name, err)
+		return
+	}
+	if twice.String() != once.String() {
+		tb.Errorf("printing %s is not idempotent:\nonce:  %q\ntwice: %q", name, once.String(), twice.String())
+	}
+}
+
+var sexpPos = regexp.MustCompile(`@[0-9]+:[0-9]+`)
+
+// firstDiff returns the first top-level statements, or the trailing
+// comments, which differ between two programs. Both are empty if the
+// programs are equal save for their positions.
+func firstDiff(f1, f2 *syntax.File) (string, string) {
+	sexp := func(node syntax.Node) string {
+		if node == nil {
+			return "nil"
+		}
+		var buf bytes.Buffer
+		syntax.SexpPrint(&buf, node)
+		return sexpPos.ReplaceAllString(buf.String(), "")
+	}
+	for i := 0; i < len(f1.Stmts) || i < len(f2.Stmts); i++ {
+		var s1, s2 syntax.Node
+		if i < len(f1.Stmts) {
+			s1 = f1.Stmts[i]
+		}
+		if i < len(f2.Stmts) {
+			s2 = f2.Stmts[i]
+		}
+		if x1, x2 := sexp(s1), sexp(s2); x1 != x2 {
+			return x1, x2
+		}
+	}
+	last := func(f *syntax.File) string {
+		var buf bytes.Buffer
+		for _, c := range f.Last {
+			buf.WriteString(sexp(&c))
+		}
+		return buf.String()
+	}
+	if x1, x2 := last(f1), last(f2); x1 != x2 {
+		return x1, x2
+	}
+	return "", ""
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package shtest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+func TestAssertRoundTrips(t *testing.T) {
+	t.Parallel()
+	posix := syntax.NewParser(syntax.KeepComments, syntax.Variant(syntax.LangPOSIX))
+	AssertRoundTrips(t, nil, nil, "foo   &&bar # baz")
+	AssertRoundTrips(t, nil, syntax.NewPrinter(syntax.Indent(4)), "if a; then\nb\nfi\n\n# end")
+	AssertRoundTrips(t, nil, syntax.NewPrinter(syntax.BinaryNextLine), "cat <<EOF\n$x\nEOF\nfoo=(a b)")
+	AssertRoundTrips(t, posix, syntax.NewPrinter(syntax.Minify), "foo | bar")
+	AssertRoundTrips(t, syntax.NewParser(syntax.Variant(syntax.LangMirBSDKorn)), nil, "a=$(( 1 + 2 ))")
+	AssertRoundTripsDir(t, nil, nil, "testdata/roundtrip")
+	AssertRoundTripsDir(t, nil, syntax.NewPrinter(syntax.KeepPadding), "testdata/roundtrip")
+}
+
+var roundTripFailureTests = []struct {
+	fn   func(testing.TB)
+	want string
+}{
+	{
+		func(tb testing.TB) { AssertRoundTrips(tb, nil, nil, "foo(") },
+		`could not parse "foo(": 1:1: "foo(" must be followed by )`,
+	},
+	{
+		func(tb testing.TB) { AssertRoundTrips(tb, nil, syntax.NewPrinter(syntax.Minify), "foo # bar") },
+		`printing "foo # bar" changes its syntax tree:` + "\n" +
+			`want: (Stmt :Comments [(Comment :Text " bar")] :Cmd (CallExpr :Args [(Word (Lit "foo"))]))` + "\n" +
+			`got:  (Stmt :Cmd (CallExpr :Args [(Word (Lit "foo"))]))`,
+	},
+	{
+		func(tb testing.TB) { AssertRoundTrips(tb, nil, syntax.NewPrinter(syntax.Minify), "foo\n# bar") },
+		`printing "foo\n# bar" changes its syntax tree:` + "\n" +
+			`want: (Comment :Text " bar")` + "\n" +
+			`got:  `,
+	},
+}
+
+func TestRoundTripFailures(t *testing.T) {
+	t.Parallel()
+	for i, tc := range roundTripFailureTests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			r := &recorder{TB: t}
+			tc.fn(r)
+			if got := strings.Join(r.failures, "\n"); got != tc.want {
+				t.Fatalf("want failure:\n%s\ngot:\n%s", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+// Package shtest provides helpers to test shell programs from Go tests,
+// such as the scripts embedded in a Go program. Each helper reports any
+// mismatch through the given testing.TB.
+//
+// This package is a work in progress and EXPERIMENTAL; its API is not
+// subject to the 1.x backwards compatibility guarantee.
+package shtest
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/interp"
+	"mvdan.cc/sh/syntax"
+)
+
+// AssertParses checks that src is a valid shell program with the given
+// parser options, such as syntax.Variant(syntax.LangPOSIX), and returns
+// its syntax tree. Comments are kept. If src cannot be parsed, the test
+// is stopped.
+func AssertParses(tb testing.TB, src string, opts ...func(*syntax.Parser)) *syntax.File {
+	tb.Helper()
+	opts = append([]func(*syntax.Parser){syntax.KeepComments}, opts...)
+	f, err := syntax.NewParser(opts...).Parse(strings.NewReader(src), "")
+	if err != nil {
+		tb.Fatalf("could not parse %q: %v", src, err)
+	}
+	return f
+}
+
+// AssertFormats checks that formatting in with the given printer options,
+// such as syntax.Indent(4), results in want.
+func AssertFormats(tb testing.TB, in, want string, opts ...func(*syntax.Printer)) {
+	tb.Helper()
+	f := AssertParses(tb, in)
+	var buf bytes.Buffer
+	if err := syntax.NewPrinter(opts...).Print(&buf, f); err != nil {
+		tb.Fatalf("could not print %q: %v", in, err)
+	}
+	if got := buf.String(); got != want {
+		tb.Errorf("formatting %q:\nwant: %q\ngot:  %q", in, want, got)
+	}
+}
+
+// AssertRuns checks that running src with the interpreter writes
+// wantStdout to standard output and exits with wantStatus. The standard
+// input is empty, and the standard error output is shown if the check
+// fails. Options like interp.Dir or interp.Env can be used to configure
+// the interpreter.
+func AssertRuns(tb testing.TB, src, wantStdout string, wantStatus int, opts ...func(*interp.Runner) error) {
+	tb.Helper()
+	f := AssertParses(tb, src)
+	var stdout, stderr bytes.Buffer
+	opts = append([]func(*interp.Runner) error{
+		interp.StdIO(strings.NewReader(""), &stdout, &stderr),
+	}, opts...)
+	r, err := interp.New(opts...)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	status := 0
+	switch err := r.Run(context.Background(), f).(type) {
+	case nil:
+	case interp.ExitStatus:
+		status = int(err)
+	case interp.ShellExitStatus:
+		status = int(err)
+	default:
+		tb.Fatalf("could not run %q: %v", src, err)
+	}
+	if got := stdout.String(); got != wantStdout || status != wantStatus {
+		tb.Errorf("running %q:\nwant: %q, exit status %d\ngot:  %q, exit status %d\nstderr: %q",
+			src, wantStdout, wantStatus, got, status, stderr.String())
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package shtest
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/interp"
+	"mvdan.cc/sh/syntax"
+)
+
+func TestAssertions(t *testing.T) {
+	t.Parallel()
+	f := AssertParses(t, "foo # bar")
+	if len(f.Stmts) != 1 || len(f.Stmts[0].Comments) != 1 {
+		t.Fatalf("unexpected syntax tree: %#v", f)
+	}
+	AssertParses(t, "echo ${a/b/c}")
+	AssertFormats(t, "foo   &&bar", "foo && bar\n")
+	AssertFormats(t, "{\nfoo\n}", "{\n    foo\n}\n", syntax.Indent(4))
+	AssertRuns(t, "echo foo", "foo\n", 0)
+	AssertRuns(t, "echo foo >&2; exit 3", "", 3)
+	AssertRuns(t, "false", "", 1)
+	AssertRuns(t, "echo $FOO; pwd", "bar\n"+os.TempDir()+"\n", 0,
+		env(t, "FOO=bar"), interp.Dir(os.TempDir()))
+}
+
+// recorder is a testing.TB that records failures instead of reporting
+// them.
+type recorder struct {
+	testing.TB
+	failures []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...interface{}) {
+	r.Errorf(format, args...)
+	panic(r)
+}
+
+func (r *recorder) Fatal(args ...interface{}) { r.Fatalf("%s", fmt.Sprint(args...)) }
+
+var failureTests = []struct {
+	fn   func(testing.TB)
+	want string
+}{
+	{
+		func(tb testing.TB) { AssertParses(tb, "foo(") },
+		`could not parse "foo(": 1:1: "foo(" must be followed by )`,
+	},
+	{
+		func(tb testing.TB) { AssertParses(tb, "foo=(bar)", syntax.Variant(syntax.LangPOSIX)) },
+		`could not parse "foo=(bar)": 1:5: arrays are a bash/mksh/ksh93/zsh feature`,
+	},
+	{
+		func(tb testing.TB) { AssertFormats(tb, "foo", "bar\n") },
+		"formatting \"foo\":\nwant: \"bar\\n\"\ngot:  \"foo\\n\"",
+	},
+	{
+		func(tb testing.TB) { AssertRuns(tb, "echo foo >&2; exit 2", "foo\n", 0) },
+		"running \"echo foo >&2; exit 2\":\nwant: \"foo\\n\", exit status 0\n" +
+			"got:  \"\", exit status 2\nstderr: \"foo\\n\"",
+	},
+}
+
+func TestFailures(t *testing.T) {
+	t.Parallel()
+	for i, tc := range failureTests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			r := &recorder{TB: t}
+			func() {
+				defer func() {
+					if v := recover(); v != nil && v != r {
+						panic(v)
+					}
+				}()
+				tc.fn(r)
+			}()
+			if got := strings.Join(r.failures, "\n"); got != tc.want {
+				t.Fatalf("want failure:\n%s\ngot:\n%s", tc.want, got)
+			}
+		})
+	}
+}
+
+func env(tb testing.TB, pairs ...string) func(*interp.Runner) error {
+	env, err := interp.EnvFromList(pairs)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return interp.Env(env)
+}
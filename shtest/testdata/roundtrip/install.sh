@@ -0,0 +1,28 @@
+#!/bin/sh
+# install copies the built binaries into $PREFIX.
+set -eu
+
+PREFIX=${PREFIX:-/usr/local}
+
+usage() {
+	echo "usage: $0 [-n] binary..." >&2
+	exit 2
+}
+
+dry=false
+while getopts n opt; do
+	case $opt in
+	n) dry=true ;;
+	*) usage ;;
+	esac
+done
+shift $((OPTIND - 1))
+[ $# -gt 0 ] || usage
+
+for bin in "$@"; do
+	if $dry; then
+		echo "would install $bin"
+		continue
+	fi
+	install -m 755 "$bin" "$PREFIX/bin/" # keep the name
+done
@@ -0,0 +1,25 @@
+# shellcheck shell=bash
+
+declare -A seen=()
+
+log() {
+	printf '%s: %s\n' "${FUNCNAME[1]}" "$*" >&2
+}
+
+dedup() {
+	local line
+	while IFS= read -r line; do
+		[[ -n ${seen[$line]} ]] && continue
+		seen[$line]=1
+		echo "$line"
+	done < <(sort "$@")
+}
+
+if ((BASH_VERSINFO[0] < 4)); then
+	log "bash 4 or later is required"
+fi
+
+cat <<-EOF
+	$(date +%F)
+	${USER:-nobody} ran ${0##*/}
+EOF
@@ -0,0 +1,138 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package syntax
+
+import "sync"
+
+// Arena makes the parser allocate the most common nodes of each program,
+// such as statements, calls, words and literals, in large slabs of memory
+// owned by the returned File. Calling Release on the File once it is no
+// longer needed recycles the slabs for later calls to Parse, which greatly
+// reduces the work of the garbage collector in programs which parse many
+// scripts, such as services.
+//
+// Without Release, the slabs are simply freed by the garbage collector, like
+// any other syntax tree. Only Parse uses the arena; Stmts and Interactive
+// hand out statements one at a time, which cannot be released together.
+// See ParseStmts to recycle the memory of each statement instead.
+func Arena(p *Parser) { p.useArena = true }
+
+// Release recycles the memory of a program parsed with the Arena option, so
+// that it can be reused when parsing other programs. Neither the File nor
+// any of its nodes may be used after calling Release, as they will be
+// overwritten; only strings obtained from the nodes remain valid.
+//
+// Release does nothing for programs parsed without Arena, or if it was
+// already called.
+func (f *File) Release() {
+	a := f.arena
+	if a == nil {
+		return
+	}
+	f.arena = nil
+	f.StmtList = StmtList{}
+	a.reset()
+	arenaPool.Put(a)
+}
+
+var arenaPool = sync.Pool{New: func() interface{} { return new(arena) }}
+
+// arena holds the slabs that a parser allocates nodes from. Slabs are never
+// freed by Release; they are cleared and handed out again, in order.
+type arena struct {
+	// how many slabs of each kind were handed out since the last reset
+	lits, words, wps, stmts, stLists, calls int
+
+	litSlabs    [][]Lit
+	wordSlabs   [][]Word
+	wpsSlabs    [][]WordPart
+	stmtSlabs   [][]Stmt
+	stListSlabs [][]*Stmt
+	callSlabs   [][]callAlloc
+}
+
+func (a *arena) litSlab(size int) []Lit {
+	if a.lits == len(a.litSlabs) {
+		a.litSlabs = append(a.litSlabs, make([]Lit, size))
+	}
+	a.lits++
+	return a.litSlabs[a.lits-1]
+}
+
+func (a *arena) wordSlab(size int) []Word {
+	if a.words == len(a.wordSlabs) {
+		a.wordSlabs = append(a.wordSlabs, make([]Word, size))
+	}
+	a.words++
+	return a.wordSlabs[a.words-1]
+}
+
+func (a *arena) wpsSlab(size int) []WordPart {
+	if a.wps == len(a.wpsSlabs) {
+		a.wpsSlabs = append(a.wpsSlabs, make([]WordPart, size))
+	}
+	a.wps++
+	return a.wpsSlabs[a.wps-1]
+}
+
+func (a *arena) stmtSlab(size int) []Stmt {
+	if a.stmts == len(a.stmtSlabs) {
+		a.stmtSlabs = append(a.stmtSlabs, make([]Stmt, size))
+	}
+	a.stmts++
+	return a.stmtSlabs[a.stmts-1]
+}
+
+func (a *arena) stListSlab(size int) []*Stmt {
+	if a.stLists == len(a.stListSlabs) {
+		a.stListSlabs = append(a.stListSlabs, make([]*Stmt, size))
+	}
+	a.stLists++
+	return a.stListSlabs[a.stLists-1]
+}
+
+func (a *arena) callSlab(size int) []callAlloc {
+	if a.calls == len(a.callSlabs) {
+		a.callSlabs = append(a.callSlabs, make([]callAlloc, size))
+	}
+	a.calls++
+	return a.callSlabs[a.calls-1]
+}
+
+// reset clears the slabs handed out since the last reset, so that they
+// don't keep any memory alive, and so that nodes start from scratch when
+// they are handed out again.
+func (a *arena) reset() {
+	for _, slab := range a.litSlabs[:a.lits] {
+		for i := range slab {
+			slab[i] = Lit{}
+		}
+	}
+	for _, slab := range a.wordSlabs[:a.words] {
+		for i := range slab {
+			slab[i] = Word{}
+		}
+	}
+	for _, slab := range a.wpsSlabs[:a.wps] {
+		for i := range slab {
+			slab[i] = nil
+		}
+	}
+	for _, slab := range a.stmtSlabs[:a.stmts] {
+		for i := range slab {
+			slab[i] = Stmt{}
+		}
+	}
+	for _, slab := range a.stListSlabs[:a.stLists] {
+		for i := range slab {
+			slab[i] = nil
+		}
+	}
+	for _, slab := range a.callSlabs[:a.calls] {
+		for i := range slab {
+			slab[i] = callAlloc{}
+		}
+	}
+	a.lits, a.words, a.wps, a.stmts, a.stLists, a.calls = 0, 0, 0, 0, 0, 0
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package syntax
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestArena(t *testing.T) {
+	t.Parallel()
+	p := NewParser(KeepComments)
+	pa := NewParser(KeepComments, Arena)
+	printer := NewPrinter()
+	for i, c := range fileTests {
+		if c.Bash == nil {
+			continue
+		}
+		for j, in := range c.Strs {
+			f, err := p.Parse(strings.NewReader(in), "")
+			if err != nil {
+				t.Fatalf("%03d-%d: %v", i, j, err)
+			}
+			want, _ := strPrint(printer, f)
+			// parse twice, to reuse the memory released the first time
+			for k := 0; k < 2; k++ {
+				f, err := pa.Parse(strings.NewReader(in), "")
+				if err != nil {
+					t.Fatalf("%03d-%d: %v", i, j, err)
+				}
+				if got, _ := strPrint(printer, f); got != want {
+					t.Fatalf("%03d-%d: Arena mismatch in %q:\nwant: %q\ngot:  %q",
+						i, j, in, want, got)
+				}
+				f.Release()
+				if len(f.Stmts) > 0 {
+					t.Fatalf("%03d-%d: Release kept the statements", i, j)
+				}
+				f.Release() // does nothing
+			}
+		}
+	}
+}
+
+func TestArenaKeepsUnreleased(t *testing.T) {
+	t.Parallel()
+	pa := NewParser(Arena)
+	f1, err := pa.Parse(strings.NewReader("foo bar\nbaz"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2, err := pa.Parse(strings.NewReader("other program"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2.Release()
+	if _, err := pa.Parse(strings.NewReader("third one"), ""); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := strPrint(NewPrinter(), f1)
+	if want := "foo bar\nbaz\n"; got != want {
+		t.Fatalf("unreleased program was modified:\nwant: %q\ngot:  %q", want, got)
+	}
+}
+
+func TestArenaAllocs(t *testing.T) {
+	src := strings.Repeat("foo bar baz\nif a; then b c; fi\nx=y z\n", 20)
+	allocated := func(p *Parser) uint64 {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		for i := 0; i < 100; i++ {
+			f, err := p.Parse(strings.NewReader(src), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.Release()
+		}
+		runtime.ReadMemStats(&after)
+		return after.TotalAlloc - before.TotalAlloc
+	}
+	heap, arena := allocated(NewParser()), allocated(NewParser(Arena))
+	if arena >= heap/2 {
+		t.Fatalf("Arena does not halve allocated memory: %d bytes with it, %d without", arena, heap)
+	}
+}
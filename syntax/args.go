@@ -0,0 +1,141 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package syntax
+
+import "strings"
+
+// ArgAssignKind is the kind of an ArgAssign.
+type ArgAssignKind int
+
+const (
+	// EnvAssign sets a variable in the environment of the command that
+	// is run, like in "env FOO=bar cmd" or "sudo FOO=bar cmd".
+	EnvAssign ArgAssignKind = iota
+	// MakeAssign overrides a variable of a makefile, like in
+	// "make CC=gcc".
+	MakeAssign
+	// OperandAssign is an operand of a program in the form key=value,
+	// like in "dd if=/dev/zero".
+	OperandAssign
+)
+
+func (k ArgAssignKind) String() string {
+	switch k {
+	case EnvAssign:
+		return "env"
+	case MakeAssign:
+		return "make"
+	default:
+		return "operand"
+	}
+}
+
+// ArgAssign is an argument of a command in the form key=value, which is
+// not a plain argument for the command. For example, FOO=bar in
+// "env FOO=bar cmd" is an assignment to the environment of cmd, much like
+// in "FOO=bar cmd".
+type ArgAssign struct {
+	Kind ArgAssignKind
+	Arg  int // index of the argument within the call's Args
+
+	// Assign holds the key and the value, which is nil if empty. Their
+	// positions are within the argument.
+	Assign *Assign
+}
+
+// argAssignCmds are the programs whose arguments may be classified by
+// ArgAssigns.
+var argAssignCmds = map[string]ArgAssignKind{
+	"env":   EnvAssign,
+	"sudo":  EnvAssign,
+	"make":  MakeAssign,
+	"gmake": MakeAssign,
+	"bmake": MakeAssign,
+	"dd":    OperandAssign,
+}
+
+// ArgAssigns returns the arguments of a call in the form key=value which
+// are assignments or operands for the program being run, as opposed to
+// plain arguments. The programs recognised are env and sudo, whose
+// assignments come before the command they run; make, where they may be
+// anywhere; and dd, whose operands are all in this form.
+//
+// Only arguments whose key is a valid name and is written literally, like
+// in FOO="$bar", are returned.
+func ArgAssigns(ce *CallExpr) []ArgAssign {
+	if len(ce.Args) == 0 {
+		return nil
+	}
+	name := ce.Args[0].Lit()
+	if i := strings.LastIndexByte(name, '/'); i >= 0 {
+		name = name[i+1:] // e.g. "/usr/bin/env"
+	}
+	kind, ok := argAssignCmds[name]
+	if !ok {
+		return nil
+	}
+	var list []ArgAssign
+	args := ce.Args[1:]
+	if kind == EnvAssign {
+		args = skipOpts(args, argOpts[name])
+		if name == "env" && len(args) > 0 && args[0].Lit() == "-" {
+			args = args[1:] // like -i
+		}
+	}
+	start := len(ce.Args) - len(args)
+	for i, arg := range args {
+		as := argAssign(arg, kind == MakeAssign)
+		if as == nil {
+			if kind == EnvAssign {
+				break // the command being run
+			}
+			continue
+		}
+		list = append(list, ArgAssign{
+			Kind:   kind,
+			Arg:    start + i,
+			Assign: as,
+		})
+	}
+	return list
+}
+
+// argAssign splits a word like key=value into an assignment, returning nil
+// if it isn't in that form. If makeOps is true, the operators of make like
+// += and := are supported too.
+func argAssign(w *Word, makeOps bool) *Assign {
+	lit, ok := w.Parts[0].(*Lit)
+	if !ok {
+		return nil
+	}
+	i := strings.IndexByte(lit.Value, '=')
+	if i <= 0 {
+		return nil
+	}
+	key := lit.Value[:i]
+	if makeOps {
+		key = strings.TrimRight(key, ":+?!")
+	}
+	if !ValidName(key) {
+		return nil
+	}
+	as := &Assign{Name: &Lit{
+		ValuePos: lit.ValuePos,
+		ValueEnd: posAddCol(lit.ValuePos, len(key)),
+		Value:    key,
+	}}
+	var parts []WordPart
+	if rest := lit.Value[i+1:]; rest != "" {
+		parts = append(parts, &Lit{
+			ValuePos: posAddCol(lit.ValuePos, i+1),
+			ValueEnd: lit.ValueEnd,
+			Value:    rest,
+		})
+	}
+	parts = append(parts, w.Parts[1:]...)
+	if len(parts) > 0 {
+		as.Value = &Word{Parts: parts}
+	}
+	return as
+}
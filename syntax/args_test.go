@@ -0,0 +1,73 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package syntax
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var argAssignsTests = []struct {
+	src  string
+	want []string
+}{
+	{"echo FOO=bar", nil},
+	{"env FOO=bar BAZ= cmd x=y", []string{"1 env FOO=bar", "2 env BAZ="}},
+	{"/usr/bin/env -i -u X FOO=\"$bar\"x cmd", []string{"4 env FOO=\"$bar\"x"}},
+	{"env - A=1 cmd", []string{"2 env A=1"}},
+	{"sudo -u root PATH=/bin cmd", []string{"3 env PATH=/bin"}},
+	{"make -j4 CC=gcc all CFLAGS+=-O2 1x=y", []string{"2 make CC=gcc", "4 make CFLAGS=-O2"}},
+	{"dd if=/dev/zero of=out bs=1M count=1", []string{
+		"1 operand if=/dev/zero", "2 operand of=out",
+		"3 operand bs=1M", "4 operand count=1",
+	}},
+	{"env $x=1 cmd", nil},
+}
+
+func TestArgAssigns(t *testing.T) {
+	t.Parallel()
+	p := NewParser()
+	printer := NewPrinter()
+	for i, tc := range argAssignsTests {
+		t.Run(fmt.Sprintf("%02d", i), func(t *testing.T) {
+			f, err := p.Parse(strings.NewReader(tc.src), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, as := range ArgAssigns(f.Stmts[0].Cmd.(*CallExpr)) {
+				val := ""
+				if as.Assign.Value != nil {
+					val, err = strPrint(printer, as.Assign.Value)
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+				got = append(got, fmt.Sprintf("%d %s %s=%s",
+					as.Arg, as.Kind, as.Assign.Name.Value, val))
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("ArgAssigns mismatch in %q:\nwant: %q\ngot:  %q",
+					tc.src, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestArgAssignsPos(t *testing.T) {
+	t.Parallel()
+	f, err := NewParser().Parse(strings.NewReader("env FOO=bar cmd"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	as := ArgAssigns(f.Stmts[0].Cmd.(*CallExpr))[0].Assign
+	if got := as.Name.End().Col(); got != 8 {
+		t.Errorf("want name to end at column 8, got %d", got)
+	}
+	if got := as.Value.Pos().Col(); got != 9 {
+		t.Errorf("want value to start at column 9, got %d", got)
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package syntax
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// benchMedium is a script like those found in most projects, using the
+// most common kinds of nodes.
+const benchMedium = `#!/bin/bash
+# build and package the project
+set -euo pipefail
+
+: "${GOOS:=$(go env GOOS)}"
+version=$(git describe --tags --always 2>/dev/null || echo dev)
+dist="dist/${version#v}"
+
+log() {
+	printf '%s: %s\n' "$(date +%T)" "$*" >&2
+}
+
+build() {
+	local os=$1 arch=$2 out
+	out="$dist/app-$os-$arch"
+	if [[ $os == windows ]]; then
+		out+=.exe
+	fi
+	log "building $out"
+	GOOS=$os GOARCH=$arch go build -o "$out" -ldflags "-X main.version=$version" ./cmd/app
+}
+
+rm -rf "$dist" && mkdir -p "$dist"
+for os in linux darwin windows; do
+	for arch in amd64 arm64; do
+		build "$os" "$arch" &
+	done
+done
+wait
+
+count=0
+while read -r file; do
+	case ${file##*.} in
+	exe | "") count=$((count + 1)) ;;
+	*) log "unexpected file: $file" ;;
+	esac
+done < <(find "$dist" -type f)
+
+cat >"$dist/README" <<EOF
+app $version, built on $(uname -s)
+$count binaries
+EOF
+
+(cd "$dist" && sha256sum -- * | sort -k2) >"$dist/SHA256SUMS"
+`
+
+// benchScripts are the scripts used in benchmarks, from a one-liner to a
+// script of megabytes, to measure both the fixed costs and the costs which
+// grow with the size of the input.
+var benchScripts = []struct {
+	name, src string
+}{
+	{"Small", `[ -f "$file" ] && echo "found $file" || exit 1` + "\n"},
+	{"Medium", benchMedium},
+	{"Huge", strings.Repeat(benchMedium, 1000)},
+}
+
+func BenchmarkParseScripts(b *testing.B) {
+	for _, bs := range benchScripts {
+		b.Run(bs.name, func(b *testing.B) {
+			p := NewParser(KeepComments)
+			in := strings.NewReader(bs.src)
+			b.ReportAllocs()
+			b.SetBytes(int64(len(bs.src)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := p.Parse(in, ""); err != nil {
+					b.Fatal(err)
+				}
+				in.Reset(bs.src)
+			}
+		})
+	}
+}
+
+func BenchmarkParseScriptsArena(b *testing.B) {
+	for _, bs := range benchScripts {
+		b.Run(bs.name, func(b *testing.B) {
+			p := NewParser(KeepComments, Arena)
+			in := strings.NewReader(bs.src)
+			b.ReportAllocs()
+			b.SetBytes(int64(len(bs.src)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				f, err := p.Parse(in, "")
+				if err != nil {
+					b.Fatal(err)
+				}
+				f.Release()
+				in.Reset(bs.src)
+			}
+		})
+	}
+}
+
+func BenchmarkParseScriptsLazy(b *testing.B) {
+	for _, bs := range benchScripts {
+		b.Run(bs.name, func(b *testing.B) {
+			p := NewParser(KeepComments, LazyWords)
+			in := strings.NewReader(bs.src)
+			b.ReportAllocs()
+			b.SetBytes(int64(len(bs.src)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := p.Parse(in, ""); err != nil {
+					b.Fatal(err)
+				}
+				in.Reset(bs.src)
+			}
+		})
+	}
+}
+
+func BenchmarkParseScriptsBytes(b *testing.B) {
+	for _, bs := range benchScripts {
+		b.Run(bs.name, func(b *testing.B) {
+			p := NewParser(KeepComments)
+			src := []byte(bs.src)
+			b.ReportAllocs()
+			b.SetBytes(int64(len(src)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := p.ParseBytes(src, ""); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkPrintScripts(b *testing.B) {
+	for _, bs := range benchScripts {
+		b.Run(bs.name, func(b *testing.B) {
+			f, err := NewParser(KeepComments).Parse(strings.NewReader(bs.src), "")
+			if err != nil {
+				b.Fatal(err)
+			}
+			printer := NewPrinter()
+			b.ReportAllocs()
+			b.SetBytes(int64(len(bs.src)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := printer.Print(ioutil.Discard, f); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkWalkScripts(b *testing.B) {
+	for _, bs := range benchScripts {
+		b.Run(bs.name, func(b *testing.B) {
+			f, err := NewParser(KeepComments).Parse(strings.NewReader(bs.src), "")
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.SetBytes(int64(len(bs.src)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				n := 0
+				Walk(f, func(node Node) bool {
+					n++
+					return true
+				})
+				if n == 0 {
+					b.Fatal("walked no nodes")
+				}
+			}
+		})
+	}
+}
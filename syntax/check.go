@@ -0,0 +1,295 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package syntax
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CheckError is the error returned by Check, describing the first node found
+// which breaks an invariant of the syntax tree.
+type CheckError struct {
+	Node Node
+	Text string
+}
+
+func (e CheckError) Error() string {
+	if pos := checkPos(e.Node); pos.IsValid() {
+		return fmt.Sprintf("%s: %T %s", pos, e.Node, e.Text)
+	}
+	return fmt.Sprintf("%T %s", e.Node, e.Text)
+}
+
+// checkPos is like node.Pos, but it doesn't panic on nodes missing the
+// children their position comes from.
+func checkPos(node Node) (pos Pos) {
+	defer func() {
+		if recover() != nil {
+			pos = Pos{}
+		}
+	}()
+	return node.Pos()
+}
+
+// Check verifies that a syntax tree is well-formed, returning a CheckError
+// describing the first problem found, if any. The trees returned by Parser
+// are always well-formed; Check is meant to be used in the tests of programs
+// which build or modify syntax trees, as a malformed tree may make other
+// packages like the printer panic or produce a different program.
+//
+// Required children must not be nil, such as both sides of a BinaryCmd, and
+// a Word must have at least one part. Operators must be valid for the type
+// of node they are in; for example, a Redirect cannot use Pipe. Literals
+// must be valid too, such as the name of an Assign, or the value of a
+// SglQuoted, which cannot contain a single quote unless it is a
+// dollar-quoted string. As a tree does not record its language variant,
+// names are valid if any variant accepts them, such as the Korn Shell 93
+// namespace names like ".foo.bar".
+//
+// Positions are optional, so that nodes may be built or moved freely. When
+// both a node and its parent have valid positions, the node must be within
+// its parent, and its end must not come before its start. Comments and
+// heredoc bodies are excluded, as they can be placed after their parent, and
+// so are the statements following an elif clause, which ends where the next
+// branch starts.
+func Check(node Node) error {
+	var err error
+	Walk(node, func(node Node) bool {
+		if err == nil && node != nil {
+			err = checkNode(node)
+		}
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	var stack []Node
+	Walk(node, func(node Node) bool {
+		if err != nil {
+			return false
+		}
+		if node == nil {
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		parent := Node(nil)
+		if len(stack) > 0 {
+			parent = stack[len(stack)-1]
+		}
+		stack = append(stack, node)
+		if _, ok := node.(*Comment); ok {
+			return true
+		}
+		switch x := parent.(type) {
+		case *Redirect:
+			if node == Node(x.Hdoc) {
+				return true
+			}
+		case *IfClause:
+			// an elif clause ends where the next branch starts
+			if st, ok := node.(*Stmt); ok && x.Elif && inStmts(st, x.Else) {
+				return true
+			}
+		}
+		pos, end := node.Pos(), node.End()
+		if !pos.IsValid() || !end.IsValid() {
+			return true
+		}
+		if pos.After(end) {
+			err = CheckError{node, fmt.Sprintf("ends at %s, before it starts", end)}
+			return false
+		}
+		if parent == nil {
+			return true
+		}
+		ppos, pend := parent.Pos(), parent.End()
+		if !ppos.IsValid() || !pend.IsValid() {
+			return true
+		}
+		if ppos.After(pos) || end.After(pend) {
+			err = CheckError{node, fmt.Sprintf("is not within its parent %T at %s", parent, ppos)}
+			return false
+		}
+		return true
+	})
+	return err
+}
+
+func checkNode(node Node) error {
+	text := ""
+	fail := func(format string, args ...interface{}) {
+		if text == "" {
+			text = fmt.Sprintf(format, args...)
+		}
+	}
+	required := func(field string, isNil bool) {
+		if isNil {
+			fail("is missing its %s", field)
+		}
+	}
+	switch x := node.(type) {
+	case *Stmt:
+		if x.Cmd == nil && len(x.Redirs) == 0 {
+			fail("has neither a command nor redirects")
+		}
+	case *Assign:
+		if x.Naked {
+			required("value", x.Value == nil && x.Name == nil)
+			break
+		}
+		required("name", x.Name == nil)
+		if x.Name != nil && !validKshName(x.Name.Value) {
+			fail("has an invalid name: %q", x.Name.Value)
+		}
+		if x.Value != nil && x.Array != nil {
+			fail("has both a value and an array")
+		}
+	case *Redirect:
+		required("word", x.Word == nil)
+		if x.Op < RdrOut || x.Op > AppAll {
+			fail("has an invalid operator: %s", x.Op)
+		}
+		if x.Hdoc != nil && x.Op != Hdoc && x.Op != DashHdoc {
+			fail("has a heredoc body with %s", x.Op)
+		}
+	case *CallExpr:
+		if len(x.Assigns) == 0 && len(x.Args) == 0 {
+			fail("has neither assignments nor arguments")
+		}
+	case *ForClause:
+		required("loop", x.Loop == nil)
+	case *WordIter:
+		required("name", x.Name == nil)
+		if x.Name != nil && !validKshName(x.Name.Value) {
+			fail("has an invalid name: %q", x.Name.Value)
+		}
+	case *BinaryCmd:
+		required("left side", x.X == nil)
+		required("right side", x.Y == nil)
+		if x.Op < AndStmt || x.Op > PipeAll {
+			fail("has an invalid operator: %s", x.Op)
+		}
+	case *FuncDecl:
+		required("name", x.Name == nil)
+		required("body", x.Body == nil)
+	case *AnonFunc:
+		required("body", x.Body == nil)
+	case *Word:
+		if len(x.Parts) == 0 {
+			fail("has no parts")
+		}
+	case *SglQuoted:
+		if !x.Dollar && strings.ContainsRune(x.Value, '\'') {
+			fail("contains a single quote: %q", x.Value)
+		}
+	case *ParamExp:
+		required("parameter", x.Param == nil)
+		if x.Names != 0 && x.Names != NamesPrefix && x.Names != NamesPrefixWords {
+			fail("has an invalid names operator: %s", x.Names)
+		}
+		if x.Exp != nil && (x.Exp.Op < SubstPlus || x.Exp.Op > OtherParamOps) {
+			fail("has an invalid expansion operator: %s", x.Exp.Op)
+		}
+	case *ArithmExp:
+		required("expression", x.X == nil)
+	case *ArithmCmd:
+		required("expression", x.X == nil)
+	case *BinaryArithm:
+		required("left side", x.X == nil)
+		required("right side", x.Y == nil)
+		if !validBinArit(x.Op) {
+			fail("has an invalid operator: %s", x.Op)
+		}
+	case *UnaryArithm:
+		required("operand", x.X == nil)
+		switch x.Op {
+		case Not, Inc, Dec, Plus, Minus:
+		default:
+			fail("has an invalid operator: %s", x.Op)
+		}
+	case *ParenArithm:
+		required("expression", x.X == nil)
+	case *CaseClause:
+		required("word", x.Word == nil)
+	case *CaseItem:
+		if len(x.Patterns) == 0 {
+			fail("has no patterns")
+		}
+		if x.Op < Break || x.Op > ResumeKorn {
+			fail("has an invalid operator: %s", x.Op)
+		}
+	case *TestClause:
+		required("expression", x.X == nil)
+	case *BinaryTest:
+		required("left side", x.X == nil)
+		required("right side", x.Y == nil)
+		switch x.Op {
+		case AndTest, OrTest, TsMatch, TsNoMatch, TsBefore, TsAfter:
+		default:
+			if x.Op < TsReMatch || x.Op > TsGtr {
+				fail("has an invalid operator: %s", x.Op)
+			}
+		}
+	case *UnaryTest:
+		required("operand", x.X == nil)
+		if x.Op != TsNot && (x.Op < TsExists || x.Op > TsRefVar) {
+			fail("has an invalid operator: %s", x.Op)
+		}
+	case *ParenTest:
+		required("expression", x.X == nil)
+	case *DeclClause:
+		required("variant", x.Variant == nil)
+		if x.Variant != nil {
+			switch x.Variant.Value {
+			case "declare", "local", "export", "readonly", "typeset", "nameref":
+			default:
+				fail("has an invalid variant: %q", x.Variant.Value)
+			}
+		}
+	case *ArrayElem:
+		required("value", x.Value == nil)
+	case *ExtGlob:
+		required("pattern", x.Pattern == nil)
+		if x.Op < GlobQuest || x.Op > GlobExcl {
+			fail("has an invalid operator: %s", x.Op)
+		}
+	case *ProcSubst:
+		if x.Op != CmdIn && x.Op != CmdOut {
+			fail("has an invalid operator: %s", x.Op)
+		}
+	case *CoprocClause:
+		required("statement", x.Stmt == nil)
+	case *NamespaceClause:
+		required("name", x.Name == nil)
+	case *LetClause:
+		if len(x.Exprs) == 0 {
+			fail("has no expressions")
+		}
+	}
+	if text != "" {
+		return CheckError{node, text}
+	}
+	return nil
+}
+
+func validBinArit(op BinAritOperator) bool {
+	switch op {
+	case Add, Sub, Mul, Quo, Rem, Pow, Eql, Gtr, Lss, Neq, Leq, Geq,
+		And, Or, Xor, Shr, Shl, AndArit, OrArit, Comma, Quest, Colon,
+		Assgn, AddAssgn, SubAssgn, MulAssgn, QuoAssgn, RemAssgn,
+		AndAssgn, OrAssgn, XorAssgn, ShlAssgn, ShrAssgn:
+		return true
+	}
+	return false
+}
+
+func inStmts(st *Stmt, sl StmtList) bool {
+	for _, st2 := range sl.Stmts {
+		if st == st2 {
+			return true
+		}
+	}
+	return false
+}
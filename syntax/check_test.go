@@ -0,0 +1,126 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package syntax
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCheckParsed(t *testing.T) {
+	t.Parallel()
+	parsers := []*Parser{
+		NewParser(KeepComments),
+		NewParser(KeepComments, Variant(LangPOSIX)),
+		NewParser(KeepComments, Variant(LangMirBSDKorn)),
+		NewParser(KeepComments, Variant(LangKsh93)),
+		NewParser(KeepComments, Variant(LangZsh)),
+	}
+	var inputs []string
+	for _, c := range append(fileTests, fileTestsNoPrint...) {
+		inputs = append(inputs, c.Strs...)
+	}
+	for _, tc := range ksh93Tests {
+		inputs = append(inputs, tc.in)
+	}
+	for _, tc := range zshTests {
+		inputs = append(inputs, tc.in)
+	}
+	for _, in := range inputs {
+		for _, p := range parsers {
+			f, err := p.Parse(strings.NewReader(in), "")
+			if err != nil {
+				continue
+			}
+			if err := Check(f); err != nil {
+				t.Errorf("Check failed on %q: %v", in, err)
+			}
+		}
+	}
+}
+
+func TestCheckBuilt(t *testing.T) {
+	t.Parallel()
+	echo := func(args ...string) *Stmt {
+		ce := &CallExpr{}
+		for _, arg := range append([]string{"echo"}, args...) {
+			ce.Args = append(ce.Args, QuoteWord(arg))
+		}
+		return &Stmt{Cmd: ce}
+	}
+	f := &File{StmtList: StmtList{Stmts: []*Stmt{
+		echo("foo", "bar baz"),
+		{Cmd: &BinaryCmd{Op: Pipe, X: echo(), Y: echo("x")}},
+		{Cmd: &FuncDecl{Name: &Lit{Value: "f"}, Body: &Stmt{Cmd: &Block{}}}},
+	}}}
+	if err := Check(f); err != nil {
+		t.Fatal(err)
+	}
+}
+
+var checkTests = []struct {
+	node Node
+	want string
+}{
+	{&Stmt{}, "*syntax.Stmt has neither a command nor redirects"},
+	{&CallExpr{}, "*syntax.CallExpr has neither assignments nor arguments"},
+	{&CallExpr{Args: []*Word{{}}}, "*syntax.Word has no parts"},
+	{
+		&BinaryCmd{Op: AndStmt, X: &Stmt{Cmd: litCall("a")}},
+		"*syntax.BinaryCmd is missing its right side",
+	},
+	{
+		&BinaryCmd{Op: BinCmdOperator(RdrOut), X: &Stmt{Cmd: litCall("a")}, Y: &Stmt{Cmd: litCall("b")}},
+		"*syntax.BinaryCmd has an invalid operator: >",
+	},
+	{
+		&Redirect{Op: RedirOperator(Pipe), Word: litWord("f")},
+		"*syntax.Redirect has an invalid operator: |",
+	},
+	{
+		&Redirect{Op: RdrOut, Word: litWord("f"), Hdoc: litWord("x")},
+		"*syntax.Redirect has a heredoc body with >",
+	},
+	{&FuncDecl{Name: &Lit{Value: "f"}}, "*syntax.FuncDecl is missing its body"},
+	{&Assign{Name: &Lit{Value: "a b"}}, `*syntax.Assign has an invalid name: "a b"`},
+	{&SglQuoted{Value: "it's"}, `*syntax.SglQuoted contains a single quote: "it's"`},
+	{&SglQuoted{Dollar: true, Value: `it\'s`}, ""},
+	{&ParamExp{}, "*syntax.ParamExp is missing its parameter"},
+	{
+		&ArithmExp{X: &BinaryArithm{Op: BinAritOperator(dblLeftBrack), X: litWord("1"), Y: litWord("2")}},
+		"*syntax.BinaryArithm has an invalid operator: [[",
+	},
+	{&TestClause{X: &UnaryTest{Op: TsExists}}, "*syntax.UnaryTest is missing its operand"},
+	{&DeclClause{Variant: &Lit{Value: "foo"}}, `*syntax.DeclClause has an invalid variant: "foo"`},
+	{&CaseClause{Word: litWord("x"), Items: []*CaseItem{{Op: Break}}}, "*syntax.CaseItem has no patterns"},
+	{
+		&Word{Parts: []WordPart{&Lit{ValuePos: NewPos(4, 1, 5), ValueEnd: NewPos(1, 1, 2), Value: "foo"}}},
+		"1:5: *syntax.Word ends at 1:2, before it starts",
+	},
+	{
+		&Subshell{Lparen: NewPos(0, 1, 1), Rparen: NewPos(4, 1, 5), StmtList: StmtList{Stmts: []*Stmt{{
+			Position: NewPos(9, 1, 10),
+			Cmd: &CallExpr{Args: []*Word{
+				{Parts: []WordPart{&Lit{ValuePos: NewPos(9, 1, 10), ValueEnd: NewPos(12, 1, 13), Value: "foo"}}},
+			}},
+		}}}},
+		"1:10: *syntax.Stmt is not within its parent *syntax.Subshell at 1:1",
+	},
+}
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+	for i, tc := range checkTests {
+		t.Run(fmt.Sprintf("%02d", i), func(t *testing.T) {
+			got := ""
+			if err := Check(tc.node); err != nil {
+				got = err.Error()
+			}
+			if got != tc.want {
+				t.Fatalf("Check mismatch:\nwant: %q\ngot:  %q", tc.want, got)
+			}
+		})
+	}
+}
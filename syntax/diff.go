@@ -0,0 +1,232 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package syntax
+
+import "reflect"
+
+// StmtChange is the kind of a StmtDiff.
+type StmtChange int
+
+const (
+	StmtAdded StmtChange = iota
+	StmtRemoved
+	StmtChanged
+)
+
+func (c StmtChange) String() string {
+	switch c {
+	case StmtAdded:
+		return "added"
+	case StmtRemoved:
+		return "removed"
+	default:
+		return "changed"
+	}
+}
+
+// StmtDiff is a statement which differs between two programs.
+type StmtDiff struct {
+	Change StmtChange
+
+	// Old is the statement in the first program, and New is the one in
+	// the second program. Old is nil if the statement was added, and New
+	// is nil if it was removed.
+	Old, New *Stmt
+}
+
+// SemanticDiff compares two programs statement by statement, and returns
+// the statements which were added, removed or changed, in the order they
+// appear in. Differences which only affect the layout of the source, such
+// as whitespace, line breaks, semicolons and comments, are ignored.
+//
+// Statements are matched like lines are in a line-based diff. A removed
+// statement followed by an added one is reported as a change if both are
+// alike, such as two calls to the same command, or two assignments to the
+// same variable. When they are compound commands like functions, blocks,
+// loops or if clauses which only differ in the statements within them, the
+// nested statements are compared instead, so that a change in a function
+// body is reported as the statements that changed in it.
+func SemanticDiff(a, b *File) []StmtDiff {
+	var d stmtDiffer
+	d.lists(a.Stmts, b.Stmts)
+	return d.diffs
+}
+
+type stmtDiffer struct {
+	diffs []StmtDiff
+}
+
+func (d *stmtDiffer) add(change StmtChange, old, new *Stmt) {
+	d.diffs = append(d.diffs, StmtDiff{Change: change, Old: old, New: new})
+}
+
+func (d *stmtDiffer) lists(olds, news []*Stmt) {
+	oldKeys := make([]string, len(olds))
+	for i, s := range olds {
+		oldKeys[i] = sexpKey(s)
+	}
+	newKeys := make([]string, len(news))
+	for i, s := range news {
+		newKeys[i] = sexpKey(s)
+	}
+	// skip the common prefix and suffix, which is most of the program in
+	// the common case
+	start := 0
+	for start < len(olds) && start < len(news) && oldKeys[start] == newKeys[start] {
+		start++
+	}
+	endOld, endNew := len(olds), len(news)
+	for endOld > start && endNew > start && oldKeys[endOld-1] == newKeys[endNew-1] {
+		endOld--
+		endNew--
+	}
+	oldKeys, newKeys = oldKeys[start:endOld], newKeys[start:endNew]
+	olds, news = olds[start:endOld], news[start:endNew]
+
+	// lcs[i][j] is the length of the longest common subsequence of
+	// oldKeys[i:] and newKeys[j:]
+	lcs := make([][]int, len(olds)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(news)+1)
+	}
+	for i := len(olds) - 1; i >= 0; i-- {
+		for j := len(news) - 1; j >= 0; j-- {
+			switch {
+			case oldKeys[i] == newKeys[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var gapOld, gapNew []*Stmt
+	i, j := 0, 0
+	for i < len(olds) || j < len(news) {
+		switch {
+		case i < len(olds) && j < len(news) && oldKeys[i] == newKeys[j]:
+			d.gap(gapOld, gapNew)
+			gapOld, gapNew = nil, nil
+			i++
+			j++
+		case j == len(news) || (i < len(olds) && lcs[i+1][j] >= lcs[i][j+1]):
+			gapOld = append(gapOld, olds[i])
+			i++
+		default:
+			gapNew = append(gapNew, news[j])
+			j++
+		}
+	}
+	d.gap(gapOld, gapNew)
+}
+
+// gap reports the statements between two matching ones, pairing those
+// which are alike as changes.
+func (d *stmtDiffer) gap(olds, news []*Stmt) {
+	j := 0
+	for _, old := range olds {
+		paired := false
+		for k := j; k < len(news); k++ {
+			if stmtHead(old) != stmtHead(news[k]) {
+				continue
+			}
+			for _, s := range news[j:k] {
+				d.add(StmtAdded, nil, s)
+			}
+			d.changed(old, news[k])
+			j = k + 1
+			paired = true
+			break
+		}
+		if !paired {
+			d.add(StmtRemoved, old, nil)
+		}
+	}
+	for _, s := range news[j:] {
+		d.add(StmtAdded, nil, s)
+	}
+}
+
+// changed reports two alike statements which differ, comparing the
+// statements within them if that's the only difference.
+func (d *stmtDiffer) changed(old, new *Stmt) {
+	oldShell, newShell := *old, *new
+	oldShell.Cmd, newShell.Cmd = nil, nil
+	if sexpKey(&oldShell) != sexpKey(&newShell) {
+		d.add(StmtChanged, old, new)
+		return
+	}
+	switch x := old.Cmd.(type) {
+	case *FuncDecl:
+		y := new.Cmd.(*FuncDecl)
+		if y.Body != nil && x.Body != nil {
+			d.changed(x.Body, y.Body)
+			return
+		}
+	case *Block:
+		d.lists(x.Stmts, new.Cmd.(*Block).Stmts)
+		return
+	case *Subshell:
+		d.lists(x.Stmts, new.Cmd.(*Subshell).Stmts)
+		return
+	case *IfClause:
+		y := new.Cmd.(*IfClause)
+		if sameStmts(x.Cond, y.Cond) {
+			d.lists(x.Then.Stmts, y.Then.Stmts)
+			d.lists(x.Else.Stmts, y.Else.Stmts)
+			return
+		}
+	case *WhileClause:
+		y := new.Cmd.(*WhileClause)
+		if x.Until == y.Until && sameStmts(x.Cond, y.Cond) {
+			d.lists(x.Do.Stmts, y.Do.Stmts)
+			return
+		}
+	case *ForClause:
+		y := new.Cmd.(*ForClause)
+		if x.Select == y.Select && sexpKey(x.Loop) == sexpKey(y.Loop) {
+			d.lists(x.Do.Stmts, y.Do.Stmts)
+			return
+		}
+	}
+	d.add(StmtChanged, old, new)
+}
+
+func sameStmts(a, b StmtList) bool {
+	if len(a.Stmts) != len(b.Stmts) {
+		return false
+	}
+	for i := range a.Stmts {
+		if sexpKey(a.Stmts[i]) != sexpKey(b.Stmts[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// stmtHead returns a key for what a statement does, so that two statements
+// with the same key are alike, such as "echo foo" and "echo bar".
+func stmtHead(s *Stmt) string {
+	switch x := s.Cmd.(type) {
+	case *CallExpr:
+		if len(x.Args) > 0 {
+			return "call " + sexpKey(x.Args[0])
+		}
+		if len(x.Assigns) > 0 && x.Assigns[0].Name != nil {
+			return "assign " + x.Assigns[0].Name.Value
+		}
+	case *FuncDecl:
+		return "func " + x.Name.Value
+	case *DeclClause:
+		head := x.Variant.Value
+		if len(x.Assigns) > 0 && x.Assigns[0].Name != nil {
+			head += " " + x.Assigns[0].Name.Value
+		}
+		return head
+	case nil:
+		return "redirect"
+	}
+	return reflect.TypeOf(s.Cmd).String()
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package syntax
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var semanticDiffTests = []struct {
+	a, b string
+	want []string
+}{
+	{"foo", "foo", nil},
+	{"foo; bar", "foo\n\n# comment\nbar", nil},
+	{"foo   bar", "foo bar", nil},
+	{"if a; then b; fi", "if a\nthen\n\tb\nfi", nil},
+	{"foo", "foo\nbar", []string{"added: bar"}},
+	{"foo\nbar", "bar", []string{"removed: foo"}},
+	{"echo a\nfoo", "echo b\nfoo", []string{"changed: echo a -> echo b"}},
+	{"x=1", "x=2", []string{"changed: x=1 -> x=2"}},
+	{"a\nb\nc", "a\nx\nc", []string{"removed: b", "added: x"}},
+	{"a\nb\nc", "c\nb\na", []string{"removed: a", "removed: b", "added: b", "added: a"}},
+	{
+		"f() {\n\ta\n\tb\n}", "function f() {\n\ta\n\tc\n\tb\n}",
+		[]string{"added: c"},
+	},
+	{
+		"if x; then\n\techo 1\nelse\n\tbar\nfi", "if x; then\n\techo 2\nelse\n\tbar\nfi",
+		[]string{"changed: echo 1 -> echo 2"},
+	},
+	{
+		"if x; then a; fi", "if y; then a; fi",
+		[]string{"changed: if x; then a; fi -> if y; then a; fi"},
+	},
+	{
+		"for i in 1 2; do a; done", "for i in 1 2; do a; b; done",
+		[]string{"added: b"},
+	},
+	{"foo", "foo &", []string{"changed: foo -> foo &"}},
+}
+
+func TestSemanticDiff(t *testing.T) {
+	t.Parallel()
+	p := NewParser(KeepComments)
+	printer := NewPrinter()
+	str := func(s *Stmt) string {
+		var buf bytes.Buffer
+		printer.Print(&buf, s)
+		return strings.Replace(buf.String(), "\n", "; ", -1)
+	}
+	for i, tc := range semanticDiffTests {
+		t.Run(fmt.Sprintf("%02d", i), func(t *testing.T) {
+			a, err := p.Parse(strings.NewReader(tc.a), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := p.Parse(strings.NewReader(tc.b), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, d := range SemanticDiff(a, b) {
+				switch d.Change {
+				case StmtAdded:
+					got = append(got, "added: "+str(d.New))
+				case StmtRemoved:
+					got = append(got, "removed: "+str(d.Old))
+				default:
+					got = append(got, "changed: "+str(d.Old)+" -> "+str(d.New))
+				}
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("SemanticDiff mismatch in %q and %q:\nwant: %q\ngot:  %q",
+					tc.a, tc.b, tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,306 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package syntax
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+)
+
+// trapHandler parses the handler in the arguments of a trap command, if
+// there is one; see ParseTraps.
+func (p *Parser) trapHandler(args []*Word) *StmtList {
+	if len(args) > 0 && args[0].Lit() == "--" {
+		args = args[1:]
+	}
+	if len(args) < 2 {
+		return nil // listing or resetting traps
+	}
+	if strings.HasPrefix(args[0].Lit(), "-") {
+		return nil // resetting traps, or options
+	}
+	return p.embedded(args[:1], p.lang)
+}
+
+// argOpts holds the short options which take an argument, for the commands
+// which run other commands and are recognised by scriptArg.
+var argOpts = map[string]string{
+	"sudo":    "CDghpRTUu",
+	"env":     "CSu",
+	"xargs":   "EIJLPadns",
+	"nice":    "n",
+	"timeout": "ks",
+	"exec":    "a",
+	"command": "",
+	"builtin": "",
+	"nohup":   "",
+	"ssh":     "BbcDEeFIiJLlmOopQRSWw",
+}
+
+var shellLangs = map[string]LangVariant{
+	"sh":   LangPOSIX,
+	"dash": LangPOSIX,
+	"ash":  LangPOSIX,
+	"bash": LangBash,
+	"ksh":  LangKsh93,
+	"mksh": LangMirBSDKorn,
+	"zsh":  LangZsh,
+}
+
+// scriptArg parses the shell script given in the arguments of a call, if
+// there is one; see ParseScriptArgs.
+func (p *Parser) scriptArg(args []*Word) *StmtList {
+	for len(args) > 0 {
+		name := args[0].Lit()
+		if i := strings.LastIndexByte(name, '/'); i >= 0 {
+			name = name[i+1:] // e.g. "/bin/sh"
+		}
+		args = args[1:]
+		if name == "eval" {
+			if len(args) > 0 && args[0].Lit() == "--" {
+				args = args[1:]
+			}
+			if len(args) == 0 {
+				return nil
+			}
+			return p.embedded(args, p.lang)
+		}
+		if lang, ok := shellLangs[name]; ok {
+			if script := shellScript(args); script != nil {
+				return p.embedded(script, lang)
+			}
+			return nil
+		}
+		opts, ok := argOpts[name]
+		if !ok {
+			return nil
+		}
+		args = skipOpts(args, opts)
+		switch name {
+		case "env":
+			for len(args) > 0 && strings.Contains(args[0].Lit(), "=") {
+				args = args[1:]
+			}
+		case "timeout":
+			if len(args) > 0 {
+				args = args[1:] // the duration
+			}
+		case "ssh":
+			if len(args) < 2 {
+				return nil // no remote command
+			}
+			// all words after the host are joined as the command
+			return p.embedded(args[1:], p.lang)
+		}
+	}
+	return nil
+}
+
+// skipOpts skips the options at the start of args, given which short
+// options take an argument.
+func skipOpts(args []*Word, withArg string) []*Word {
+	for len(args) > 0 {
+		s := args[0].Lit()
+		if s == "--" {
+			return args[1:]
+		}
+		if len(s) < 2 || s[0] != '-' {
+			break
+		}
+		args = args[1:]
+		if len(s) == 2 && strings.IndexByte(withArg, s[1]) >= 0 && len(args) > 0 {
+			args = args[1:]
+		}
+	}
+	return args
+}
+
+// shellScript returns the script argument given to a shell via -c, if
+// any, such as in "bash -ec 'script' name args".
+func shellScript(args []*Word) []*Word {
+	command := false
+	for len(args) > 0 {
+		s := args[0].Lit()
+		if s == "--" || s == "-" {
+			args = args[1:]
+			break
+		}
+		if len(s) < 2 || (s[0] != '-' && s[0] != '+') {
+			break
+		}
+		args = args[1:]
+		if strings.HasPrefix(s, "--") {
+			continue // e.g. --norc
+		}
+		if s[0] == '-' && strings.IndexByte(s, 'c') > 0 {
+			command = true
+		}
+		if strings.ContainsAny(s, "oO") && len(args) > 0 {
+			args = args[1:] // e.g. "-o pipefail"
+		}
+	}
+	if !command || len(args) == 0 {
+		return nil
+	}
+	return args[:1]
+}
+
+// embedded parses the static value of words joined by spaces, as done by
+// ParseTraps and ParseScriptArgs. The resulting positions are mapped
+// through any quoting to the ones of the words.
+func (p *Parser) embedded(words []*Word, lang LangVariant) *StmtList {
+	var src bytes.Buffer
+	var table []Pos // source position of each byte in src, and of its end
+	var end Pos
+	for i, w := range words {
+		if i > 0 {
+			src.WriteByte(' ')
+			table = append(table, end)
+		}
+		var ok bool
+		if end, ok = staticValue(&src, &table, w); !ok {
+			return nil
+		}
+	}
+	if src.Len() == 0 {
+		return nil // e.g. ignoring signals via "trap '' INT"
+	}
+	table = append(table, end)
+
+	sub := &Parser{
+		helperBuf:        new(bytes.Buffer),
+		keepComments:     p.keepComments,
+		allowInvalidUTF8: p.allowInvalidUTF8,
+		bashCompat:       p.bashCompat,
+		parseTraps:       p.parseTraps,
+		parseScripts:     p.parseScripts,
+		lang:             lang,
+	}
+	sub.reset()
+	if lang == p.lang {
+		sub.extGlob, sub.nextExtGlob = p.extGlob, p.extGlob
+	}
+	sub.f = &File{Name: p.f.Name}
+	sub.src = &src
+	sub.rune()
+	sub.next()
+	sl := sub.stmtList()
+	if sub.err == nil {
+		sub.doHeredocs()
+	}
+	if sub.err != nil {
+		return nil
+	}
+	mapPositions(reflect.ValueOf(&sl), table, make(map[uintptr]bool))
+	return &sl
+}
+
+// staticValue writes the value of a word to src, along with the source
+// position of each of its bytes to table, and returns the position where
+// its value ends. It returns false if the value isn't known statically,
+// such as when it contains expansions or globs.
+func staticValue(src *bytes.Buffer, table *[]Pos, w *Word) (Pos, bool) {
+	var end Pos
+	for _, part := range w.Parts {
+		switch x := part.(type) {
+		case *Lit:
+			if strings.ContainsAny(x.Value, "*?[{~") {
+				return end, false // globs, brace expansions, and tildes
+			}
+			end = unquote(src, table, x.Value, x.ValuePos, "")
+		case *SglQuoted:
+			if x.Dollar {
+				return end, false
+			}
+			end = unquote(src, table, x.Value, posAddCol(x.Left, 1), "-")
+		case *DblQuoted:
+			if x.Dollar {
+				return end, false
+			}
+			end = posAddCol(x.Position, 1)
+			for _, part := range x.Parts {
+				lit, ok := part.(*Lit)
+				if !ok {
+					return end, false
+				}
+				end = unquote(src, table, lit.Value, lit.ValuePos, "$`\"\\\n")
+			}
+		default:
+			return end, false
+		}
+	}
+	return end, true
+}
+
+// unquote writes the value of the source text s which starts at pos, and
+// returns the position where s ends.
+// Backslashes escape the characters in escapable, or any character if it is
+// empty. Escaped newlines are removed. For no escaping at all, such as in
+// single quotes, escapable must be "-".
+func unquote(src *bytes.Buffer, table *[]Pos, s string, pos Pos, escapable string) Pos {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' && escapable != "-" && i+1 < len(s) &&
+			(escapable == "" || strings.IndexByte(escapable, s[i+1]) >= 0) {
+			pos = posAdvance(pos, c)
+			i++
+			c = s[i]
+			if c == '\n' {
+				pos = posAdvance(pos, c)
+				continue
+			}
+		}
+		src.WriteByte(c)
+		*table = append(*table, pos)
+		pos = posAdvance(pos, c)
+	}
+	return pos
+}
+
+func posAdvance(p Pos, c byte) Pos {
+	p.offs++
+	if c == '\n' {
+		p.line++
+		p.col = 1
+	} else {
+		p.col++
+	}
+	return p
+}
+
+// mapPositions replaces all the positions in the nodes reachable from v,
+// which are offsets into the source of an embedded script, with the ones in
+// table.
+func mapPositions(v reflect.Value, table []Pos, seen map[uintptr]bool) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || seen[v.Pointer()] {
+			return
+		}
+		seen[v.Pointer()] = true
+		mapPositions(v.Elem(), table, seen)
+	case reflect.Interface:
+		if !v.IsNil() {
+			mapPositions(v.Elem(), table, seen)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			mapPositions(v.Index(i), table, seen)
+		}
+	case reflect.Struct:
+		if v.Type() == posType {
+			pos := v.Interface().(Pos)
+			if pos.IsValid() && int(pos.offs) < len(table) && v.CanSet() {
+				v.Set(reflect.ValueOf(table[pos.offs]))
+			}
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath == "" {
+				mapPositions(v.Field(i), table, seen)
+			}
+		}
+	}
+}
@@ -64,6 +64,8 @@ func ExampleDebugPrint() {
 	// .  .  .  .  .  .  .  }
 	// .  .  .  .  .  .  }
 	// .  .  .  .  .  }
+	// .  .  .  .  .  Handler: nil
+	// .  .  .  .  .  Script: nil
 	// .  .  .  .  }
 	// .  .  .  .  Position: 1:1
 	// .  .  .  .  Semicolon: 0:0
@@ -71,9 +73,21 @@ func ExampleDebugPrint() {
 	// .  .  .  .  Background: false
 	// .  .  .  .  Coprocess: false
 	// .  .  .  .  Redirs: []*syntax.Redirect (len = 0) {}
+	// .  .  .  .  Terminator: 0x0
 	// .  .  .  }
 	// .  .  }
 	// .  .  Last: []syntax.Comment (len = 0) {}
 	// .  }
 	// }
 }
+
+func ExampleSexpPrint() {
+	in := strings.NewReader(`echo 'foo'`)
+	f, err := syntax.NewParser().Parse(in, "")
+	if err != nil {
+		return
+	}
+	syntax.SexpPrint(os.Stdout, f)
+	// Output:
+	// (File :Stmts [(Stmt@1:1 :Cmd (CallExpr@1:1 :Args [(Word (Lit@1:1 "echo")) (Word (SglQuoted@1:6 "foo"))]))])
+}
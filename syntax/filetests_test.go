@@ -156,11 +156,11 @@ var fileTests = []testCase{
 		common: litStmts("foo", "bar"),
 	},
 	{
-		Strs:   []string{"foo a b", " foo  a  b ", "foo \\\n a b"},
+		Strs:   []string{"foo a b", " foo  a  b ", "foo \\\n a b", "foo \\\r\n a b"},
 		common: litCall("foo", "a", "b"),
 	},
 	{
-		Strs:   []string{"foobar", "foo\\\nbar", "foo\\\nba\\\nr"},
+		Strs:   []string{"foobar", "foo\\\nbar", "foo\\\nba\\\nr", "foo\\\r\nbar"},
 		common: litWord("foobar"),
 	},
 	{
@@ -868,6 +868,7 @@ var fileTests = []testCase{
 			"foo <<EOF\nbar\nEOF",
 			"foo <<EOF \nbar\nEOF",
 			"foo <<EOF\t\nbar\nEOF",
+			"foo <<EOF\r\nbar\r\nEOF\r\n",
 		},
 		common: &Stmt{
 			Cmd: litCall("foo"),
@@ -901,7 +902,7 @@ var fileTests = []testCase{
 		},
 	},
 	{
-		Strs: []string{"foo <<EOF\n1\n2\n3\nEOF"},
+		Strs: []string{"foo <<EOF\n1\n2\n3\nEOF", "foo <<EOF\r\n1\r\n2\r\n3\r\nEOF"},
 		common: &Stmt{
 			Cmd: litCall("foo"),
 			Redirs: []*Redirect{{
@@ -3883,6 +3884,14 @@ var fileTests = []testCase{
 		},
 		posix: litStmt("a+=1"),
 	},
+	{
+		Strs:  []string{"a+= b[1]+="},
+		posix: litStmt("a+=", "b[1]+="),
+		bsmk: &CallExpr{Assigns: []*Assign{
+			{Append: true, Name: lit("a")},
+			{Append: true, Name: lit("b"), Index: litWord("1")},
+		}},
+	},
 	{
 		Strs: []string{"b+=(2 3)"},
 		bsmk: &CallExpr{Assigns: []*Assign{{
@@ -4179,6 +4188,7 @@ func clearPosRecurse(tb testing.TB, src string, v interface{}) {
 			if i == 0 {
 				gotErr = got
 			}
+			got = strings.Replace(got, "\r\n", "\n", -1)
 			got = strings.Replace(got, "\\\n", "", -1)
 			if len(got) > len(want) {
 				got = got[:len(want)]
@@ -4253,6 +4263,21 @@ func clearPosRecurse(tb testing.TB, src string, v interface{}) {
 			tb.Fatalf("Stmt.Pos() should not be a comment")
 		}
 		setPos(&x.Position)
+		switch x.Terminator {
+		case TermSemicolon, TermBackground:
+			checkSrc(x.Semicolon, x.Terminator.String())
+		case TermPipeAll:
+			if x.Coprocess {
+				checkSrc(x.Semicolon, x.Terminator.String())
+			}
+		case TermNewline:
+			rest := strings.TrimLeft(src[endOff:], " \t\r")
+			if !strings.HasPrefix(rest, "\n") && !strings.HasPrefix(rest, "#") {
+				tb.Fatalf("Stmt.Terminator %q not found at %d in %q",
+					x.Terminator, endOff, src)
+			}
+		}
+		x.Terminator = TermNone
 		if x.Semicolon.IsValid() {
 			setPos(&x.Semicolon, ";", "&", "|&")
 		}
@@ -4271,6 +4296,13 @@ func clearPosRecurse(tb testing.TB, src string, v interface{}) {
 		}
 	case []*Assign:
 		for _, a := range x {
+			switch end := posAddCol(a.End(), -1); {
+			case a.Value != nil, a.Array != nil:
+			case !a.Naked:
+				checkSrc(end, "=")
+			case a.Index != nil:
+				checkSrc(end, "]")
+			}
 			if a.Name != nil {
 				recurse(a.Name)
 			}
@@ -4306,7 +4338,7 @@ func clearPosRecurse(tb testing.TB, src string, v interface{}) {
 		endLine := x.End().Line()
 		switch {
 		case src == "":
-		case strings.Contains(src, "\\\n"):
+		case strings.Contains(src, "\\\n"), strings.Contains(src, "\r\n"):
 		case !strings.Contains(x.Value, "\n") && posLine != endLine:
 			tb.Fatalf("Lit without newlines has Pos/End lines %d and %d",
 				posLine, endLine)
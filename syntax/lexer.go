@@ -69,6 +69,15 @@ retry:
 	if p.bsp < len(p.bs) {
 		if b := p.bs[p.bsp]; b < utf8.RuneSelf {
 			p.bsp++
+			if b == '\r' {
+				if p.bsp == len(p.bs) {
+					p.fill()
+				}
+				if p.bsp < len(p.bs) && p.bs[p.bsp] == '\n' {
+					// read "\r\n" as a single newline
+					goto retry
+				}
+			}
 			if b == '\\' && p.openBquotes > 0 {
 				// don't do it for newlines, as we want
 				// the newlines to be eaten in p.next
@@ -98,7 +107,7 @@ retry:
 			p.litBs = append(p.litBs, p.bs[p.bsp:p.bsp+w]...)
 		}
 		p.bsp += w
-		if p.r == utf8.RuneError && w == 1 {
+		if p.r == utf8.RuneError && w == 1 && !p.allowInvalidUTF8 {
 			p.posErr(p.npos, "invalid UTF-8 encoding")
 		}
 		p.w = uint16(w)
@@ -119,9 +128,24 @@ retry:
 // had not yet been used at the end of the buffer are slid into the
 // beginning of the buffer.
 func (p *Parser) fill() {
+	if p.src == nil {
+		// all of the input is already in bs
+		if p.bsp == len(p.bs) {
+			p.offs += p.bsp
+			p.bs, p.bsp = nil, 0
+		}
+		return
+	}
 	p.offs += p.bsp
 	left := len(p.bs) - p.bsp
 	copy(p.readBuf[:left], p.readBuf[p.bsp:])
+	if p.interactive != nil && p.readErr == nil && left == 0 &&
+		(len(p.bs) == 0 || p.bs[len(p.bs)-1] == '\n') {
+		// about to read a new line
+		if !p.interactive() {
+			p.readErr = io.EOF
+		}
+	}
 	n, err := 0, p.readErr
 	if err == nil {
 		n, err = p.src.Read(p.readBuf[left:])
@@ -266,7 +290,7 @@ skipSpace:
 				p.advanceLitNone(r)
 			}
 		case '?', '*', '+', '@', '!':
-			if p.peekByte('(') {
+			if p.extGlob && p.peekByte('(') {
 				switch r {
 				case '?':
 					p.tok = globQuest
@@ -319,6 +343,13 @@ func (p *Parser) peekByte(b byte) bool {
 	if p.bsp == len(p.bs) {
 		p.fill()
 	}
+	if b == '\n' && p.bsp < len(p.bs) && p.bs[p.bsp] == '\r' {
+		// "\r\n" is read as a single newline; see p.rune
+		if p.bsp+1 == len(p.bs) {
+			p.fill()
+		}
+		return p.bsp+1 < len(p.bs) && p.bs[p.bsp+1] == '\n'
+	}
 	return p.bsp < len(p.bs) && p.bs[p.bsp] == b
 }
 
@@ -386,7 +417,7 @@ func (p *Parser) regToken(r rune) token {
 			p.rune()
 			return dollBrace
 		case '[':
-			if p.lang != LangBash || p.quote == paramExpName {
+			if (p.lang != LangBash && p.lang != LangZsh) || p.quote == paramExpName {
 				// latter to not tokenise ${$[@]} as $[
 				break
 			}
@@ -424,7 +455,7 @@ func (p *Parser) regToken(r rune) token {
 			p.rune()
 			return semiAnd
 		case '|':
-			if p.lang != LangMirBSDKorn {
+			if p.lang != LangMirBSDKorn && p.lang != LangZsh {
 				break
 			}
 			p.rune()
@@ -449,7 +480,7 @@ func (p *Parser) regToken(r rune) token {
 			p.rune()
 			return dplIn
 		case '(':
-			if p.lang != LangBash {
+			if p.lang == LangPOSIX || p.lang == LangMirBSDKorn {
 				break
 			}
 			p.rune()
@@ -468,7 +499,7 @@ func (p *Parser) regToken(r rune) token {
 			p.rune()
 			return clbOut
 		case '(':
-			if p.lang != LangBash {
+			if p.lang == LangPOSIX || p.lang == LangMirBSDKorn {
 				break
 			}
 			p.rune()
@@ -493,7 +524,7 @@ func (p *Parser) dqToken(r rune) token {
 			p.rune()
 			return dollBrace
 		case '[':
-			if p.lang != LangBash {
+			if p.lang != LangBash && p.lang != LangZsh {
 				break
 			}
 			p.rune()
@@ -731,7 +762,8 @@ func (p *Parser) newLit(r rune) {
 		p.litBs = p.litBuf[:1]
 		p.litBs[0] = byte(r)
 	case r > utf8.RuneSelf:
-		w := utf8.RuneLen(r)
+		// not utf8.RuneLen(r), as r may be an invalid byte
+		w := int(p.w)
 		p.litBs = append(p.litBuf[:0], p.bs[p.bsp-w:p.bsp]...)
 	default:
 		// don't let r == utf8.RuneSelf go to the second case as RuneLen
@@ -743,13 +775,20 @@ func (p *Parser) newLit(r rune) {
 func (p *Parser) discardLit(n int) { p.litBs = p.litBs[:len(p.litBs)-n] }
 
 func (p *Parser) endLit() (s string) {
-	if p.r == utf8.RuneSelf {
-		s = string(p.litBs)
-	} else {
-		s = string(p.litBs[:len(p.litBs)-int(p.w)])
+	lit := p.litBs
+	if p.r != utf8.RuneSelf {
+		lit = lit[:len(lit)-int(p.w)]
 	}
 	p.litBs = nil
-	return
+	if p.srcStr != "" {
+		// share the memory of the source if the literal wasn't
+		// altered, e.g. by escaped newlines or "\r\n"
+		end := p.offs + p.bsp - int(p.w)
+		if start := end - len(lit); start >= 0 && p.srcStr[start:end] == string(lit) {
+			return p.srcStr[start:end]
+		}
+	}
+	return string(lit)
 }
 
 func (p *Parser) isLitRedir() bool {
@@ -823,7 +862,15 @@ loop:
 			if p.quote&allParamReg != 0 {
 				break loop
 			}
-		case '\'', '+', '-', ' ', '\t', ';', '&', '>', '<', '|', '(', ')', '\n', '\r':
+		case '+', '-':
+			if p.lang == LangKsh93 && p.quote&allArithmExpr != 0 &&
+				floatExponent(p.litBs[:len(p.litBs)-1]) {
+				break // like in 1.5e+3
+			}
+			if p.quote&allKeepSpaces == 0 {
+				break loop
+			}
+		case '\'', ' ', '\t', ';', '&', '>', '<', '|', '(', ')', '\n', '\r':
 			if p.quote&allKeepSpaces == 0 {
 				break loop
 			}
@@ -832,6 +879,23 @@ loop:
 	p.tok, p.val = tok, p.endLit()
 }
 
+// floatExponent reports whether a literal is the start of a floating point
+// number in an arithmetic expression, followed by the exponent marker.
+func floatExponent(bs []byte) bool {
+	if len(bs) < 2 || bs[0] < '0' || bs[0] > '9' {
+		return false
+	}
+	if c := bs[len(bs)-1]; c != 'e' && c != 'E' {
+		return false
+	}
+	for _, b := range bs[:len(bs)-1] {
+		if b != '.' && (b < '0' || b > '9') {
+			return false
+		}
+	}
+	return true
+}
+
 func (p *Parser) advanceLitNone(r rune) {
 	p.eqlOffs = 0
 	tok := _LitWord
@@ -860,7 +924,7 @@ loop:
 			tok = _Lit
 			break loop
 		case '?', '*', '+', '@', '!':
-			if p.peekByte('(') {
+			if p.extGlob && p.peekByte('(') {
 				tok = _Lit
 				break loop
 			}
@@ -0,0 +1,64 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package syntax
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+)
+
+// NodeIDs returns an identifier for each of the nodes in a program, besides
+// comments. Unlike positions, identifiers are stable across reformatting
+// and across edits to other parts of the program, so that data attached to
+// nodes by other tools, such as review comments, coverage or suppressed
+// warnings, can be attached again once the edited program is parsed anew.
+//
+// A node's identifier is derived from its contents, and from the path of
+// statements it is in, such as the function declaring it. Changing a node
+// thus changes its identifier, but changing the statements around it does
+// not. Identical nodes in the same statement or list are told apart by
+// their order.
+func NodeIDs(f *File) map[Node]string {
+	ids := make(map[Node]string)
+	type scope struct {
+		path  string
+		heads map[string]int
+		keys  map[string]int
+	}
+	newScope := func(path string) *scope {
+		return &scope{path, make(map[string]int), make(map[string]int)}
+	}
+	scopes := []*scope{newScope("")}
+	var stack []Node
+	Walk(f, func(node Node) bool {
+		switch x := node.(type) {
+		case nil:
+			if _, ok := stack[len(stack)-1].(*Stmt); ok {
+				scopes = scopes[:len(scopes)-1]
+			}
+			stack = stack[:len(stack)-1]
+			return true
+		case *Comment:
+			return false // part of the layout
+		case *File:
+		default:
+			sc := scopes[len(scopes)-1]
+			key := sexpKey(node)
+			n := sc.keys[key]
+			sc.keys[key]++
+			sum := sha256.Sum256([]byte(sc.path + "\x00" + key + "#" + strconv.Itoa(n)))
+			ids[node] = hex.EncodeToString(sum[:8])
+			if s, ok := x.(*Stmt); ok {
+				head := stmtHead(s)
+				m := sc.heads[head]
+				sc.heads[head]++
+				scopes = append(scopes, newScope(sc.path+"/"+head+"#"+strconv.Itoa(m)))
+			}
+		}
+		stack = append(stack, node)
+		return true
+	})
+	return ids
+}
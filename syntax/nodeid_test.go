@@ -0,0 +1,82 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package syntax
+
+import (
+	"strings"
+	"testing"
+)
+
+// stmtIDs returns the identifiers of the statements in a program, by the
+// source of each statement.
+func stmtIDs(t *testing.T, src string) map[string]string {
+	f, err := NewParser(KeepComments).Parse(strings.NewReader(src), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := NodeIDs(f)
+	byText := make(map[string]string)
+	Walk(f, func(node Node) bool {
+		if s, ok := node.(*Stmt); ok {
+			text := src[s.Pos().Offset():s.End().Offset()]
+			text = strings.TrimSuffix(text, ";")
+			if _, ok := byText[text]; ok {
+				text += " (dup)"
+			}
+			byText[text] = ids[s]
+		}
+		return true
+	})
+	return byText
+}
+
+func TestNodeIDs(t *testing.T) {
+	t.Parallel()
+	base := stmtIDs(t, "foo\nbar() {\n\tx\n\ty\n}\nfoo")
+	tests := []struct {
+		src       string
+		same      []string
+		different []string
+	}{
+		{"foo;   bar() { x; y; }; foo", []string{"foo", "x", "y"}, nil},
+		{"# doc\nfoo\nbar() {\n\tx # x\n\ty\n}\nfoo", []string{"foo", "x", "y"}, nil},
+		{"new\nfoo\nbar() {\n\tnew\n\tx\n\ty\n}\nfoo", []string{"foo", "x", "y"}, nil},
+		{"foo\nbar() {\n\tx\n\ty2\n}\nfoo", []string{"foo", "x"}, []string{"bar() {\n\tx\n\ty\n}"}},
+		{"foo\nbaz() {\n\tx\n\ty\n}\nfoo", []string{"foo"}, []string{"x", "y"}},
+	}
+	for _, tc := range tests {
+		ids := stmtIDs(t, tc.src)
+		for _, text := range tc.same {
+			if ids[text] == "" || ids[text] != base[text] {
+				t.Errorf("NodeIDs of %q changed in %q", text, tc.src)
+			}
+		}
+		for _, text := range tc.different {
+			for _, id := range ids {
+				if id == base[text] {
+					t.Errorf("NodeIDs of %q did not change in %q", text, tc.src)
+				}
+			}
+		}
+	}
+	if base["foo"] == base["foo (dup)"] {
+		t.Errorf("NodeIDs are not unique for identical statements")
+	}
+}
+
+func TestNodeIDsUnique(t *testing.T) {
+	t.Parallel()
+	f, err := NewParser().Parse(strings.NewReader("echo $x $x; echo $x $x"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := NodeIDs(f)
+	seen := make(map[string]Node)
+	for node, id := range ids {
+		if other, ok := seen[id]; ok {
+			t.Fatalf("NodeIDs gave %T and %T the same id", node, other)
+		}
+		seen[id] = node
+	}
+}
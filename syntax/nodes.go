@@ -3,7 +3,13 @@
 
 package syntax
 
-import "fmt"
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
 
 // Node represents a syntax tree node.
 type Node interface {
@@ -21,6 +27,8 @@ type File struct {
 	Name string
 
 	StmtList
+
+	arena *arena // see Arena
 }
 
 // StmtList is a list of statements with any number of trailing comments. Both
@@ -74,6 +82,14 @@ type Pos struct {
 	line, col uint16
 }
 
+// NewPos creates a position with the given offset, line, and column.
+//
+// Note that Pos uses a limited number of bits to store these numbers. Values
+// that don't fit are truncated.
+func NewPos(offset, line, column uint) Pos {
+	return Pos{offs: uint32(offset), line: uint16(line), col: uint16(column)}
+}
+
 // Offset returns the byte offset of the position in the original source file.
 // Byte offsets start at 0.
 func (p Pos) Offset() uint { return uint(p.offs) }
@@ -82,9 +98,24 @@ func (p Pos) Offset() uint { return uint(p.offs) }
 func (p Pos) Line() uint { return uint(p.line) }
 
 // Col returns the column number of the position, starting at 1. It counts in
-// bytes.
+// bytes; see RuneCol to count in characters instead.
 func (p Pos) Col() uint { return uint(p.col) }
 
+// RuneCol returns the column number of the position, starting at 1, counting
+// in runes instead of bytes. As such, it is the column that most editors
+// show, even if the line contains multi-byte characters like "é". The source
+// must be the one that the position was obtained from.
+//
+// Each byte that is not valid UTF-8 counts as a rune.
+func (p Pos) RuneCol(src []byte) uint {
+	end := int(p.offs)
+	if end > len(src) {
+		end = len(src)
+	}
+	start := bytes.LastIndexByte(src[:end], '\n') + 1
+	return uint(utf8.RuneCount(src[start:end])) + 1
+}
+
 func (p Pos) String() string {
 	return fmt.Sprintf("%d:%d", p.Line(), p.Col())
 }
@@ -135,6 +166,66 @@ type Stmt struct {
 	Coprocess  bool // mksh's |&
 
 	Redirs []*Redirect // stmt >a <b
+
+	// Terminator is what ended the statement in the source, such as a
+	// newline or a semicolon.
+	Terminator StmtTerminator
+}
+
+// StmtTerminator is what ended a statement in the source.
+//
+// The left side of a BinaryCmd is ended by its operator. The right side
+// has no terminator of its own, as it ends the enclosing statement too.
+type StmtTerminator uint32
+
+const (
+	TermNone       StmtTerminator = iota // end of input, or a token like "}"
+	TermNewline                          // \n
+	TermSemicolon                        // ;
+	TermBackground                       // &
+	TermAndStmt                          // &&
+	TermOrStmt                           // ||
+	TermPipe                             // |
+	TermPipeAll                          // |&, also ending mksh's coprocesses
+)
+
+func (t StmtTerminator) String() string {
+	switch t {
+	case TermNewline:
+		return "\n"
+	case TermSemicolon:
+		return ";"
+	case TermBackground:
+		return "&"
+	case TermAndStmt:
+		return "&&"
+	case TermOrStmt:
+		return "||"
+	case TermPipe:
+		return "|"
+	case TermPipeAll:
+		return "|&"
+	}
+	return ""
+}
+
+// binCmdTerm returns the terminator of the left side of a BinaryCmd.
+func binCmdTerm(op BinCmdOperator) StmtTerminator {
+	switch op {
+	case AndStmt:
+		return TermAndStmt
+	case OrStmt:
+		return TermOrStmt
+	case Pipe:
+		return TermPipe
+	}
+	return TermPipeAll
+}
+
+// isPlain reports whether s only wraps its command, like the statements
+// the parser builds around nested BinaryCmd nodes.
+func (s *Stmt) isPlain() bool {
+	return !s.Negated && !s.Background && !s.Coprocess && len(s.Redirs) == 0
 }
 
 func (s *Stmt) Pos() Pos { return s.Position }
@@ -164,27 +255,30 @@ func (s *Stmt) End() Pos {
 //
 // These are *CallExpr, *IfClause, *WhileClause, *ForClause, *CaseClause,
 // *Block, *Subshell, *BinaryCmd, *FuncDecl, *ArithmCmd, *TestClause,
-// *DeclClause, *LetClause, *TimeClause, and *CoprocClause.
+// *DeclClause, *LetClause, *TimeClause, *CoprocClause, *NamespaceClause,
+// and *AnonFunc.
 type Command interface {
 	Node
 	commandNode()
 }
 
-func (*CallExpr) commandNode()     {}
-func (*IfClause) commandNode()     {}
-func (*WhileClause) commandNode()  {}
-func (*ForClause) commandNode()    {}
-func (*CaseClause) commandNode()   {}
-func (*Block) commandNode()        {}
-func (*Subshell) commandNode()     {}
-func (*BinaryCmd) commandNode()    {}
-func (*FuncDecl) commandNode()     {}
-func (*ArithmCmd) commandNode()    {}
-func (*TestClause) commandNode()   {}
-func (*DeclClause) commandNode()   {}
-func (*LetClause) commandNode()    {}
-func (*TimeClause) commandNode()   {}
-func (*CoprocClause) commandNode() {}
+func (*CallExpr) commandNode()        {}
+func (*IfClause) commandNode()        {}
+func (*WhileClause) commandNode()     {}
+func (*ForClause) commandNode()       {}
+func (*CaseClause) commandNode()      {}
+func (*Block) commandNode()           {}
+func (*Subshell) commandNode()        {}
+func (*BinaryCmd) commandNode()       {}
+func (*FuncDecl) commandNode()        {}
+func (*ArithmCmd) commandNode()       {}
+func (*TestClause) commandNode()      {}
+func (*DeclClause) commandNode()      {}
+func (*LetClause) commandNode()       {}
+func (*TimeClause) commandNode()      {}
+func (*CoprocClause) commandNode()    {}
+func (*NamespaceClause) commandNode() {}
+func (*AnonFunc) commandNode()        {}
 
 // Assign represents an assignment to a variable.
 //
@@ -196,6 +290,10 @@ func (*CoprocClause) commandNode() {}
 //
 // If Naked is true and Name is nil, the assignment is part of a DeclClause and
 // the assignment expression (in the Value field) will be evaluated at run-time.
+//
+// The form of an assignment can be told by its fields: "a" in "export a" is
+// Naked, "a=" has neither Value nor Array, "a=(x y)" has an Array, and
+// "a[i]+=x" has an Index, Append, and a Value.
 type Assign struct {
 	Append bool // +=
 	Naked  bool // without '='
@@ -219,13 +317,17 @@ func (a *Assign) End() Pos {
 	if a.Array != nil {
 		return a.Array.End()
 	}
+	end := a.Name.End()
 	if a.Index != nil {
-		return posAddCol(a.Index.End(), 2)
+		end = posAddCol(a.Index.End(), 1)
 	}
 	if a.Naked {
-		return a.Name.End()
+		return end
+	}
+	if a.Append {
+		end = posAddCol(end, 1)
 	}
-	return posAddCol(a.Name.End(), 1)
+	return posAddCol(end, 1)
 }
 
 // Redirect represents an input/output redirection.
@@ -245,6 +347,29 @@ func (r *Redirect) Pos() Pos {
 }
 func (r *Redirect) End() Pos { return r.Word.End() }
 
+// Fd returns the file descriptor that the redirection applies to. It is
+// taken from N if set, and otherwise it is the default of the operator:
+// standard input for RdrIn, RdrInOut, DplIn and the here-documents, and
+// standard output for the rest. Note that RdrAll and AppAll also apply to
+// standard error.
+//
+// If N is a variable name, as in Bash's {varname}>, the file descriptor is
+// only known at run time and -1 is returned.
+func (r *Redirect) Fd() int {
+	if r.N != nil {
+		n, err := strconv.Atoi(r.N.Value)
+		if err != nil {
+			return -1
+		}
+		return n
+	}
+	switch r.Op {
+	case RdrIn, RdrInOut, DplIn, Hdoc, DashHdoc, WordHdoc:
+		return 0
+	}
+	return 1
+}
+
 // CallExpr represents a command execution or function call, otherwise known as
 // a "simple command".
 //
@@ -253,6 +378,26 @@ func (r *Redirect) End() Pos { return r.Word.End() }
 type CallExpr struct {
 	Assigns []*Assign // a=x b=y args
 	Args    []*Word
+
+	// Handler is the parsed code of the handler of a trap command, such
+	// as the handler of:
+	//
+	//     trap 'rm -f "$tmp"' EXIT
+	//
+	// It is only set with the ParseTraps option, and only if the
+	// handler is a word whose value is known statically and parses
+	// without errors.
+	//
+	// Its positions are those in the original source. It is walked as
+	// part of the CallExpr, but not printed by Printer.
+	Handler *StmtList
+
+	// Script is the parsed code of a shell script given as an argument,
+	// such as the one in "sh -c 'cd /tmp && ls'" or "eval 'a=1; b=2'".
+	// It is only set with the ParseScriptArgs option, and only under the
+	// same conditions as Handler. Like Handler, it is walked but not
+	// printed.
+	Script *StmtList
 }
 
 func (c *CallExpr) Pos() Pos {
@@ -343,12 +488,18 @@ func (w *WhileClause) End() Pos { return posAddCol(w.DonePos, 4) }
 type ForClause struct {
 	ForPos, DoPos, DonePos Pos
 	Select                 bool
+	Braces                 bool // deprecated form with { and } instead of do and done
 	Loop                   Loop
 	Do                     StmtList
 }
 
 func (f *ForClause) Pos() Pos { return f.ForPos }
-func (f *ForClause) End() Pos { return posAddCol(f.DonePos, 4) }
+func (f *ForClause) End() Pos {
+	if f.Braces {
+		return posAddCol(f.DonePos, 1)
+	}
+	return posAddCol(f.DonePos, 4)
+}
 
 // Loop holds either *WordIter or *CStyleLoop.
 type Loop interface {
@@ -372,7 +523,7 @@ func (w *WordIter) End() Pos { return posMax(w.Name.End(), wordLastEnd(w.Items))
 // CStyleLoop represents the behaviour of a for clause similar to the C
 // language.
 //
-// This node will only appear with LangBash.
+// This node will only appear in LangBash and LangKsh93.
 type CStyleLoop struct {
 	Lparen, Rparen   Pos
 	Init, Cond, Post ArithmExpr
@@ -391,6 +542,92 @@ type BinaryCmd struct {
 func (b *BinaryCmd) Pos() Pos { return b.X.Pos() }
 func (b *BinaryCmd) End() Pos { return b.Y.End() }
 
+// AndOrList returns the AND-OR list rooted at b, or nil if b is a pipeline
+// instead. It gathers the nested BinaryCmd nodes that the parser builds
+// for a list like "a && b || c", which groups from the left as
+// "(a && b) || c".
+func (b *BinaryCmd) AndOrList() *AndOrList {
+	if b.Op.Precedence() != AndStmt.Precedence() {
+		return nil
+	}
+	l := &AndOrList{}
+	if x, ok := b.X.Cmd.(*BinaryCmd); ok && b.X.isPlain() {
+		if l2 := x.AndOrList(); l2 != nil {
+			l = l2
+		}
+	}
+	if len(l.Stmts) == 0 {
+		l.Stmts = append(l.Stmts, b.X)
+	}
+	l.Stmts = append(l.Stmts, b.Y)
+	l.Ops = append(l.Ops, b.Op)
+	l.OpPos = append(l.OpPos, b.OpPos)
+	return l
+}
+
+// AndOrList represents an AND-OR list, a sequence of statements joined by
+// "&&" and "||" which all have the same precedence. Unlike the nested
+// BinaryCmd nodes it is parsed as, it holds all of its statements at the
+// same level, so that tools don't need to tell apart a statement of the
+// list from one that happens to be a BinaryCmd. Use BinaryCmd.AndOrList
+// to obtain one.
+//
+// Its statements are shared with the syntax tree, which is not otherwise
+// modified.
+type AndOrList struct {
+	Stmts []*Stmt // at least two
+
+	// Ops and OpPos hold each operator, either AndStmt or OrStmt, and
+	// its position. Ops[i] joins Stmts[i] and Stmts[i+1].
+	Ops   []BinCmdOperator
+	OpPos []Pos
+}
+
+func (l *AndOrList) Pos() Pos { return l.Stmts[0].Pos() }
+func (l *AndOrList) End() Pos { return l.Stmts[len(l.Stmts)-1].End() }
+
+// Pipeline returns the pipeline rooted at b, or nil if b is an AND-OR list
+// instead. It gathers the nested BinaryCmd nodes that the parser builds
+// for a pipeline like "a | b |& c", which groups from the right as
+// "a | (b |& c)".
+func (b *BinaryCmd) Pipeline() *Pipeline {
+	if b.Op.Precedence() != Pipe.Precedence() {
+		return nil
+	}
+	pl := &Pipeline{Stmts: []*Stmt{b.X}, Ops: []BinCmdOperator{b.Op}, OpPos: []Pos{b.OpPos}}
+	if y, ok := b.Y.Cmd.(*BinaryCmd); ok && b.Y.isPlain() {
+		if pl2 := y.Pipeline(); pl2 != nil {
+			pl.Stmts = append(pl.Stmts, pl2.Stmts...)
+			pl.Ops = append(pl.Ops, pl2.Ops...)
+			pl.OpPos = append(pl.OpPos, pl2.OpPos...)
+			return pl
+		}
+	}
+	pl.Stmts = append(pl.Stmts, b.Y)
+	return pl
+}
+
+// Pipeline represents a pipeline, a sequence of statements whose standard
+// output, and also standard error in the case of "|&", is connected to the
+// standard input of the next one. Unlike the nested BinaryCmd nodes it is
+// parsed as, it holds all of its stages in order, which is simpler to
+// analyze, such as to tell what the last command of the pipeline is. Use
+// BinaryCmd.Pipeline to obtain one.
+//
+// Its statements are shared with the syntax tree, which is not otherwise
+// modified.
+type Pipeline struct {
+	Stmts []*Stmt // at least two
+
+	// Ops and OpPos hold each operator, either Pipe or PipeAll, and its
+	// position. Ops[i] joins Stmts[i] and Stmts[i+1].
+	Ops   []BinCmdOperator
+	OpPos []Pos
+}
+
+func (p *Pipeline) Pos() Pos { return p.Stmts[0].Pos() }
+func (p *Pipeline) End() Pos { return p.Stmts[len(p.Stmts)-1].End() }
+
 // FuncDecl represents the declaration of a function.
 type FuncDecl struct {
 	Position Pos
@@ -402,6 +639,26 @@ type FuncDecl struct {
 func (f *FuncDecl) Pos() Pos { return f.Position }
 func (f *FuncDecl) End() Pos { return f.Body.End() }
 
+// AnonFunc represents a Zsh anonymous function, which is run right away
+// with Args as its positional parameters. RsrvWord is true if it was
+// written as "function { ... }" instead of "() { ... }".
+//
+// This node will only appear with LangZsh.
+type AnonFunc struct {
+	Position Pos
+	RsrvWord bool
+	Body     *Stmt
+	Args     []*Word
+}
+
+func (a *AnonFunc) Pos() Pos { return a.Position }
+func (a *AnonFunc) End() Pos {
+	if len(a.Args) > 0 {
+		return a.Args[len(a.Args)-1].End()
+	}
+	return a.Body.End()
+}
+
 // Word represents a shell word, containing one or more word parts contiguous to
 // each other. The word is delimeted by word boundaries, such as spaces,
 // newlines, semicolons, or parentheses.
@@ -412,6 +669,69 @@ type Word struct {
 func (w *Word) Pos() Pos { return w.Parts[0].Pos() }
 func (w *Word) End() Pos { return w.Parts[len(w.Parts)-1].End() }
 
+// Lit returns the word as a literal value, if the word consists of *Lit
+// nodes only. An empty string is returned otherwise. Words with multiple
+// literals, which can appear in some edge cases, are handled properly.
+//
+// For example, the word "foo" will return "foo", but the word "foo${bar}"
+// will return "".
+func (w *Word) Lit() string {
+	lits := make([]string, 0, 1)
+	for _, part := range w.Parts {
+		lit, ok := part.(*Lit)
+		if !ok {
+			return ""
+		}
+		lits = append(lits, lit.Value)
+	}
+	return strings.Join(lits, "")
+}
+
+// IsStatic reports whether the word has no expansions, meaning that its
+// value is known without running the program. Such a word is made of
+// literals, single quotes including $'...' strings, and double quotes with
+// literals only. Translated $"..." strings are not static.
+//
+// Note that unquoted literals may still be subject to tilde, brace and
+// pathname expansion, such as in ~/*.sh; those are not considered.
+func (w *Word) IsStatic() bool {
+	prefix, _ := w.SplitStatic()
+	return len(prefix) == len(w.Parts)
+}
+
+// SplitStatic splits the parts of the word into its longest prefix of
+// static parts, as defined by IsStatic, and the rest of the parts starting
+// at the first dynamic one. For example, the word "$HOME/bin" has no static
+// prefix, and the word foo'bar'"$baz"qux has the static prefix foo'bar'.
+//
+// A double quoted part containing any expansions is dynamic as a whole.
+func (w *Word) SplitStatic() (prefix, rest []WordPart) {
+	for i, part := range w.Parts {
+		if !staticPart(part) {
+			return w.Parts[:i], w.Parts[i:]
+		}
+	}
+	return w.Parts, nil
+}
+
+func staticPart(part WordPart) bool {
+	switch x := part.(type) {
+	case *Lit, *SglQuoted:
+		return true
+	case *DblQuoted:
+		if x.Dollar {
+			return false
+		}
+		for _, part := range x.Parts {
+			if _, ok := part.(*Lit); !ok {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
 // WordPart represents all nodes that can form part of a word.
 //
 // These are *Lit, *SglQuoted, *DblQuoted, *ParamExp, *CmdSubst, *ArithmExp,
@@ -490,6 +810,7 @@ type ParamExp struct {
 	Excl           bool // ${!a}
 	Length         bool // ${#a}
 	Width          bool // ${%a}
+	Flags          *Lit // ${(flags)a}, only with LangZsh
 	Param          *Lit
 	Index          ArithmExpr       // ${a[i]}, ${a["k"]}
 	Slice          *Slice           // ${a:x:y}
@@ -513,9 +834,27 @@ func (p *ParamExp) nakedIndex() bool {
 	return p.Short && p.Index != nil
 }
 
+// IndexAll returns the special subscript of an expansion of all the
+// elements of an array, '@' in ${a[@]} and '*' in ${a[*]}, or 0 if the
+// index is missing or is a regular one. Within double quotes, the former
+// expands to one word per element, while the latter joins all the elements
+// into a single word.
+//
+// The subscript is also kept in Index as a literal word.
+func (p *ParamExp) IndexAll() byte {
+	w, ok := p.Index.(*Word)
+	if !ok || len(w.Parts) != 1 {
+		return 0
+	}
+	if lit, ok := w.Parts[0].(*Lit); ok && (lit.Value == "@" || lit.Value == "*") {
+		return lit.Value[0]
+	}
+	return 0
+}
+
 // Slice represents a character slicing expression inside a ParamExp.
 //
-// This node will only appear in LangBash and LangMirBSDKorn.
+// This node will only appear in LangBash, LangMirBSDKorn and LangKsh93.
 type Slice struct {
 	Offset, Length ArithmExpr
 }
@@ -551,7 +890,7 @@ func (a *ArithmExp) End() Pos {
 
 // ArithmCmd represents an arithmetic command.
 //
-// This node will only appear in LangBash and LangMirBSDKorn.
+// This node will only appear in LangBash, LangMirBSDKorn and LangKsh93.
 type ArithmCmd struct {
 	Left, Right Pos
 	Unsigned    bool // mksh's ((# expr))
@@ -656,7 +995,7 @@ func (c *CaseItem) End() Pos {
 
 // TestClause represents a Bash extended test clause.
 //
-// This node will only appear in LangBash and LangMirBSDKorn.
+// This node will only appear in LangBash, LangMirBSDKorn and LangKsh93.
 type TestClause struct {
 	Left, Right Pos
 	X           TestExpr
@@ -708,13 +1047,15 @@ type ParenTest struct {
 func (p *ParenTest) Pos() Pos { return p.Lparen }
 func (p *ParenTest) End() Pos { return posAddCol(p.Rparen, 1) }
 
-// DeclClause represents a Bash declare clause.
+// DeclClause represents a Bash declare clause, or any of its variants.
 //
-// This node will only appear with LangBash.
+// This node will not appear with LangPOSIX.
 type DeclClause struct {
 	// Variant is one of "declare", "local", "export", "readonly",
 	// "typeset", or "nameref".
 	Variant *Lit
+	// Opts are the words that set or unset attributes, such as "-r",
+	// "-a", or "+x", kept as written.
 	Opts    []*Word
 	Assigns []*Assign
 }
@@ -732,7 +1073,7 @@ func (d *DeclClause) End() Pos {
 
 // ArrayExpr represents a Bash array expression.
 //
-// This node will only appear with LangBash.
+// This node will only appear in LangBash and LangKsh93.
 type ArrayExpr struct {
 	Lparen, Rparen Pos
 	Elems          []*ArrayElem
@@ -758,9 +1099,10 @@ func (a *ArrayElem) Pos() Pos {
 func (a *ArrayElem) End() Pos { return a.Value.End() }
 
 // ExtGlob represents a Bash extended globbing expression. Note that these are
-// parsed independently of whether shopt has been called or not.
+// parsed independently of whether shopt has been called or not, unless
+// FollowShellOptions is used.
 //
-// This node will only appear in LangBash and LangMirBSDKorn.
+// This node will only appear in LangBash, LangMirBSDKorn and LangKsh93.
 type ExtGlob struct {
 	OpPos   Pos
 	Op      GlobOperator
@@ -772,7 +1114,7 @@ func (e *ExtGlob) End() Pos { return posAddCol(e.Pattern.End(), 1) }
 
 // ProcSubst represents a Bash process substitution.
 //
-// This node will only appear with LangBash.
+// This node will only appear in LangBash and LangKsh93.
 type ProcSubst struct {
 	OpPos, Rparen Pos
 	Op            ProcOperator
@@ -785,7 +1127,7 @@ func (s *ProcSubst) End() Pos { return posAddCol(s.Rparen, 1) }
 // TimeClause represents a Bash time clause. PosixFormat corresponds to the -p
 // flag.
 //
-// This node will only appear in LangBash and LangMirBSDKorn.
+// This node will only appear in LangBash, LangMirBSDKorn and LangKsh93.
 type TimeClause struct {
 	Time        Pos
 	PosixFormat bool
@@ -812,9 +1154,24 @@ type CoprocClause struct {
 func (c *CoprocClause) Pos() Pos { return c.Coproc }
 func (c *CoprocClause) End() Pos { return c.Stmt.End() }
 
+// NamespaceClause represents a Korn Shell 93 namespace, whose variables
+// and functions are defined with names prefixed by the namespace's, such
+// as ".foo.bar" for a variable "bar" in the namespace "foo".
+//
+// This node will only appear with LangKsh93.
+type NamespaceClause struct {
+	Namespace      Pos
+	Lbrace, Rbrace Pos
+	Name           *Lit
+	StmtList
+}
+
+func (n *NamespaceClause) Pos() Pos { return n.Namespace }
+func (n *NamespaceClause) End() Pos { return posAddCol(n.Rbrace, 1) }
+
 // LetClause represents a Bash let clause.
 //
-// This node will only appear in LangBash and LangMirBSDKorn.
+// This node will only appear in LangBash, LangMirBSDKorn and LangKsh93.
 type LetClause struct {
 	Let   Pos
 	Exprs []ArithmExpr
@@ -4,7 +4,9 @@
 package syntax
 
 import (
+	"bytes"
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -71,3 +73,258 @@ func TestWeirdOperatorString(t *testing.T) {
 		t.Fatalf("token.String() mismatch: want %s, got %s", want, got)
 	}
 }
+
+func TestNewPos(t *testing.T) {
+	t.Parallel()
+	pos := NewPos(12, 3, 4)
+	if !pos.IsValid() {
+		t.Fatalf("NewPos(12, 3, 4) is not valid")
+	}
+	if pos.Offset() != 12 || pos.Line() != 3 || pos.Col() != 4 {
+		t.Fatalf("NewPos(12, 3, 4) gave %d:%d:%d",
+			pos.Offset(), pos.Line(), pos.Col())
+	}
+	if NewPos(0, 0, 0).IsValid() {
+		t.Fatalf("NewPos(0, 0, 0) is valid")
+	}
+}
+
+func TestIndexAll(t *testing.T) {
+	t.Parallel()
+	p := NewParser()
+	for i, tc := range []struct {
+		in   string
+		want byte
+	}{
+		{"${a}", 0},
+		{"${a[1]}", 0},
+		{`${a["@"]}`, 0},
+		{"${a[@]}", '@'},
+		{"${a[*]:1}", '*'},
+		{"${#a[@]}", '@'},
+	} {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			f, err := p.Parse(strings.NewReader("echo "+tc.in), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			pe := f.Stmts[0].Cmd.(*CallExpr).Args[1].Parts[0].(*ParamExp)
+			if got := pe.IndexAll(); got != tc.want {
+				t.Fatalf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestAndOrList(t *testing.T) {
+	t.Parallel()
+	p := NewParser()
+	for i, tc := range []struct {
+		in    string
+		stmts []string
+		ops   []BinCmdOperator
+	}{
+		{"a | b", nil, nil},
+		{"a && b", []string{"a", "b"}, []BinCmdOperator{AndStmt}},
+		{"a && b || c", []string{"a", "b", "c"}, []BinCmdOperator{AndStmt, OrStmt}},
+		{"a || b | c && d", []string{"a", "b | c", "d"}, []BinCmdOperator{OrStmt, AndStmt}},
+		{"{ a && b; } || c", []string{"{ a && b; }", "c"}, []BinCmdOperator{OrStmt}},
+		{"a &&\nb", []string{"a", "b"}, []BinCmdOperator{AndStmt}},
+	} {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			f, err := p.Parse(strings.NewReader(tc.in), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			l := f.Stmts[0].Cmd.(*BinaryCmd).AndOrList()
+			if tc.stmts == nil {
+				if l != nil {
+					t.Fatalf("want nil, got %#v", l)
+				}
+				return
+			}
+			var stmts []string
+			Walk(l, func(node Node) bool {
+				if s, ok := node.(*Stmt); ok {
+					var buf bytes.Buffer
+					NewPrinter().Print(&buf, s)
+					stmts = append(stmts, buf.String())
+					return false
+				}
+				return true
+			})
+			if !reflect.DeepEqual(stmts, tc.stmts) {
+				t.Fatalf("want stmts %q, got %q", tc.stmts, stmts)
+			}
+			if !reflect.DeepEqual(l.Ops, tc.ops) {
+				t.Fatalf("want ops %v, got %v", tc.ops, l.Ops)
+			}
+			if len(l.OpPos) != len(l.Ops) {
+				t.Fatalf("want %d operator positions, got %d", len(l.Ops), len(l.OpPos))
+			}
+			if l.Pos() != f.Pos() || l.End() != f.End() {
+				t.Fatalf("want %s-%s, got %s-%s", f.Pos(), f.End(), l.Pos(), l.End())
+			}
+		})
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	t.Parallel()
+	p := NewParser()
+	for i, tc := range []struct {
+		in    string
+		stmts []string
+		ops   []BinCmdOperator
+	}{
+		{"a && b", nil, nil},
+		{"a | b", []string{"a", "b"}, []BinCmdOperator{Pipe}},
+		{"a | b |& c", []string{"a", "b", "c"}, []BinCmdOperator{Pipe, PipeAll}},
+		{"a | b | c | d", []string{"a", "b", "c", "d"}, []BinCmdOperator{Pipe, Pipe, Pipe}},
+		{"a | { b | c; }", []string{"a", "{ b | c; }"}, []BinCmdOperator{Pipe}},
+		{"a |\nb 2>&1", []string{"a", "b 2>&1"}, []BinCmdOperator{Pipe}},
+	} {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			f, err := p.Parse(strings.NewReader(tc.in), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			pl := f.Stmts[0].Cmd.(*BinaryCmd).Pipeline()
+			if tc.stmts == nil {
+				if pl != nil {
+					t.Fatalf("want nil, got %#v", pl)
+				}
+				return
+			}
+			var stmts []string
+			Walk(pl, func(node Node) bool {
+				if s, ok := node.(*Stmt); ok {
+					var buf bytes.Buffer
+					NewPrinter().Print(&buf, s)
+					stmts = append(stmts, buf.String())
+					return false
+				}
+				return true
+			})
+			if !reflect.DeepEqual(stmts, tc.stmts) {
+				t.Fatalf("want stmts %q, got %q", tc.stmts, stmts)
+			}
+			if !reflect.DeepEqual(pl.Ops, tc.ops) {
+				t.Fatalf("want ops %v, got %v", tc.ops, pl.Ops)
+			}
+			if len(pl.OpPos) != len(pl.Ops) {
+				t.Fatalf("want %d operator positions, got %d", len(pl.Ops), len(pl.OpPos))
+			}
+			if pl.Pos() != f.Pos() || pl.End() != f.End() {
+				t.Fatalf("want %s-%s, got %s-%s", f.Pos(), f.End(), pl.Pos(), pl.End())
+			}
+		})
+	}
+}
+
+func TestRedirectFd(t *testing.T) {
+	t.Parallel()
+	p := NewParser()
+	for i, tc := range []struct {
+		in   string
+		want int
+	}{
+		{">f", 1},
+		{"<f", 0},
+		{"2>f", 2},
+		{"3<f", 3},
+		{">&2", 1},
+		{"<&3", 0},
+		{"<>f", 0},
+		{"&>f", 1},
+		{"<<<foo", 0},
+		{"<<EOF\nEOF", 0},
+		{"{fd}>f", -1},
+	} {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			f, err := p.Parse(strings.NewReader("foo "+tc.in), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := f.Stmts[0].Redirs[0].Fd(); got != tc.want {
+				t.Fatalf("want %d, got %d", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRuneCol(t *testing.T) {
+	t.Parallel()
+	p := NewParser()
+	for i, tc := range []struct {
+		in           string
+		col, runeCol uint
+	}{
+		{"foo bar", 5, 5},
+		{"é bar", 4, 3},
+		{"echo ○ ○ bar", 14, 10},
+		{"○\necho ○ bar", 10, 8},
+	} {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			f, err := p.Parse(strings.NewReader(tc.in), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var last *Lit
+			Walk(f, func(node Node) bool {
+				if lit, ok := node.(*Lit); ok {
+					last = lit
+				}
+				return true
+			})
+			pos := last.Pos()
+			if got := pos.Col(); got != tc.col {
+				t.Fatalf("want Col %d, got %d", tc.col, got)
+			}
+			if got := pos.RuneCol([]byte(tc.in)); got != tc.runeCol {
+				t.Fatalf("want RuneCol %d, got %d", tc.runeCol, got)
+			}
+		})
+	}
+}
+
+func TestWordStatic(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		src           string
+		lit           string
+		static        bool
+		prefix, parts int
+	}{
+		{"foo", "foo", true, 1, 1},
+		{"foo'bar'", "", true, 2, 2},
+		{`"foo"bar`, "", true, 2, 2},
+		{"$'a\\tb'", "", true, 1, 1},
+		{`$"foo"`, "", false, 0, 1},
+		{"$HOME/bin", "", false, 0, 2},
+		{`foo'bar'"$baz"qux`, "", false, 2, 4},
+		{`"a$b"c`, "", false, 0, 2},
+		{"~/*.sh", "~/*.sh", true, 1, 1},
+	}
+	p := NewParser()
+	for i, tc := range tests {
+		t.Run(fmt.Sprintf("%02d", i), func(t *testing.T) {
+			f, err := p.Parse(strings.NewReader(tc.src), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := f.Stmts[0].Cmd.(*CallExpr).Args[0]
+			if got := w.Lit(); got != tc.lit {
+				t.Errorf("Lit() = %q, want %q", got, tc.lit)
+			}
+			if got := w.IsStatic(); got != tc.static {
+				t.Errorf("IsStatic() = %v, want %v", got, tc.static)
+			}
+			prefix, rest := w.SplitStatic()
+			if len(prefix) != tc.prefix || len(prefix)+len(rest) != tc.parts {
+				t.Errorf("SplitStatic() = %d+%d parts, want %d+%d",
+					len(prefix), len(rest), tc.prefix, tc.parts-tc.prefix)
+			}
+		})
+	}
+}
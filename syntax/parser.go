@@ -9,6 +9,7 @@ import (
 	"io"
 	"strconv"
 	"strings"
+	"sync"
 	"unicode/utf8"
 )
 
@@ -16,12 +17,84 @@ import (
 // nodes, as opposed to discarding them.
 func KeepComments(p *Parser) { p.keepComments = true }
 
+// BashCompat makes the parser accept obsolete or undocumented syntax which
+// Bash still supports, such as some of the constructs found in the test
+// suite of Bash itself. For example, for and select clauses may use braces
+// instead of "do" and "done", as in "for i in a b; { echo $i; }". It only
+// has an effect with LangBash.
+//
+// The printer uses the modern form of each construct, like it does for
+// the deprecated "$[expr]" arithmetic expansions.
+func BashCompat(p *Parser) { p.bashCompat = true }
+
+// FollowShellOptions makes the parser follow the Bash shell options which
+// change how programs are parsed, as set by "shopt" statements at the top
+// level of the program. Like in Bash, an option only applies from the line
+// after the one setting it.
+//
+// The only such option is extglob, so extended globs like "@(a|b)" are only
+// parsed once "shopt -s extglob" has been seen, and until "shopt -u
+// extglob". Options like lastpipe or expand_aliases only change how the
+// program runs. It only has an effect with LangBash.
+func FollowShellOptions(p *Parser) { p.followShopts = true }
+
+// AllowInvalidUTF8 makes the parser accept source that is not valid UTF-8,
+// like most shells do, instead of returning an error. The invalid bytes are
+// kept as they are in the literals where they appear, so that printing the
+// syntax tree reproduces them.
+func AllowInvalidUTF8(p *Parser) { p.allowInvalidUTF8 = true }
+
+// ParseScriptArgs makes the parser also parse the shell scripts given as
+// arguments to common commands, setting CallExpr.Script. These are the
+// scripts run by shells, such as "bash -c 'echo $1' _ foo", also when
+// wrapped by commands like xargs, sudo, or env, the remote commands given
+// to ssh, such as "ssh host 'ls /tmp'", and the code run by eval, such as
+// "eval 'a=1; b=2'". Like ssh and eval do, multiple words are joined with
+// spaces.
+//
+// Like with ParseTraps, scripts that aren't known statically or that don't
+// parse are ignored.
+func ParseScriptArgs(p *Parser) { p.parseScripts = true }
+
+// ParseTraps makes the parser also parse the handlers of trap commands,
+// such as the string in "trap 'rm -f $tmp' EXIT", setting CallExpr.Handler.
+// This way, code that is only run by traps can be walked and checked like
+// any other.
+//
+// Handlers that aren't known statically, such as "$cleanup", or that don't
+// parse, are ignored.
+func ParseTraps(p *Parser) { p.parseTraps = true }
+
+// LazyWords makes the parser skip building the parts of the arguments of
+// simple commands, except for plain literals such as "-v" or "file.txt".
+// Each of the other arguments, such as "$x" or "foo$(bar)", is replaced by a
+// word with a single empty literal spanning it, whose positions can be used
+// to get the original text from the source. Any statements within those
+// arguments, like in command substitutions, are skipped as well.
+//
+// This is useful for tools which only need the boundaries of statements and
+// the names of the commands they run, such as a syntax check or a list of
+// the commands a program runs, as building the skipped nodes accounts for
+// much of the time and memory spent parsing. The arguments are still parsed
+// in full, so syntax errors are reported all the same.
+//
+// Options which look at the arguments of commands, such as ParseTraps and
+// ParseScriptArgs, don't see the arguments which are skipped.
+func LazyWords(p *Parser) { p.lazyWords = true }
+
 type LangVariant int
 
 const (
 	LangBash LangVariant = iota
 	LangPOSIX
 	LangMirBSDKorn
+	LangKsh93
+
+	// LangZsh is a best-effort, partial support of the Zsh language. It
+	// only covers some of its most common constructs, such as short for
+	// loops like "for i (a b) { echo $i; }", anonymous functions, and
+	// parameter expansion flags like "${(U)foo}".
+	LangZsh
 )
 
 // Variant changes the shell language variant that the parser will
@@ -38,6 +111,10 @@ func (l LangVariant) String() string {
 		return "posix"
 	case LangMirBSDKorn:
 		return "mksh"
+	case LangKsh93:
+		return "ksh93"
+	case LangZsh:
+		return "zsh"
 	}
 	return "unknown shell language variant"
 }
@@ -67,23 +144,46 @@ func StopAt(word string) func(*Parser) {
 
 // NewParser allocates a new Parser and applies any number of options.
 func NewParser(options ...func(*Parser)) *Parser {
-	p := &Parser{helperBuf: new(bytes.Buffer)}
-	for _, opt := range options {
-		opt(p)
-	}
-	return p
+	return &Parser{opts: options, states: new(sync.Pool)}
 }
 
 // Parse reads and parses a shell program with an optional name. It
 // returns the parsed program if no issues were encountered. Otherwise,
 // an error is returned. Reads from r are buffered.
 //
-// Parse can be called more than once, but not concurrently. That is, a
-// Parser can be reused once it is done working.
+// Windows line endings, "\r\n", are read as "\n" anywhere in the
+// program, including within heredocs, quotes and line continuations.
+//
+// Parse can be called many times, including concurrently from multiple
+// goroutines.
 func (p *Parser) Parse(r io.Reader, name string) (*File, error) {
-	p.reset()
-	p.f = &File{Name: name}
-	p.src = r
+	s := p.state()
+	defer p.release(s)
+	s.src = r
+	return s.file(name)
+}
+
+// ParseBytes is like Parse, but parses a program which is already in
+// memory. The strings in the returned syntax tree, such as the values of
+// literals and the text of comments, share the memory of a single copy of
+// src instead of each being allocated on its own, which greatly reduces the
+// number of allocations needed to parse large programs.
+//
+// src is not retained, so it may be modified once ParseBytes returns.
+// However, any string obtained from the syntax tree keeps the entire copy
+// of src alive; see CopyStrings.
+func (p *Parser) ParseBytes(src []byte, name string) (*File, error) {
+	s := p.state()
+	defer p.release(s)
+	s.bs, s.srcStr = src, string(src)
+	return s.file(name)
+}
+
+func (p *Parser) file(name string) (*File, error) {
+	if p.useArena {
+		p.arena = arenaPool.Get().(*arena)
+	}
+	p.f = &File{Name: name, arena: p.arena}
 	p.rune()
 	p.next()
 	p.f.StmtList = p.stmtList()
@@ -95,33 +195,185 @@ func (p *Parser) Parse(r io.Reader, name string) (*File, error) {
 	return p.f, p.err
 }
 
+// CopyStrings replaces the strings held by a syntax tree with copies of
+// them, so that the tree no longer shares memory with the source of a
+// program parsed with ParseBytes. This is useful to keep a small part of a
+// large program around, such as a few of its statements, while letting the
+// garbage collector free the rest of it.
+func CopyStrings(node Node) {
+	Walk(node, func(node Node) bool {
+		switch x := node.(type) {
+		case *Lit:
+			x.Value = string([]byte(x.Value))
+		case *SglQuoted:
+			x.Value = string([]byte(x.Value))
+		case *Comment:
+			x.Text = string([]byte(x.Text))
+		}
+		return true
+	})
+}
+
 // Stmts reads and parses statements one at a time, calling a function
 // each time one is parsed. If the function returns false, parsing is
 // stopped and the function is not called again.
+//
+// Like Parse, Stmts can be called concurrently.
 func (p *Parser) Stmts(r io.Reader, fn func(*Stmt) bool) error {
-	p.reset()
-	p.f = &File{}
-	p.src = r
-	p.rune()
-	p.next()
-	p.stmts(fn)
-	if p.err == nil {
+	s := p.state()
+	defer p.release(s)
+	s.f = &File{}
+	s.src = r
+	s.rune()
+	s.next()
+	s.stmts(fn)
+	if s.err == nil {
 		// EOF immediately after heredoc word so no newline to
 		// trigger it
-		p.doHeredocs()
+		s.doHeredocs()
 	}
-	return p.err
+	return s.err
 }
 
-// Parser holds the internal state of the parsing mechanism of a
+// ParseStmts is like Stmts, but it recycles the memory of each statement
+// once fn returns, so that programs of any size can be parsed with a bounded
+// amount of memory, such as large generated scripts. fn must not keep the
+// statement nor any of its nodes, as they will be overwritten; only strings
+// obtained from them remain valid.
+//
+// Like Parse, ParseStmts can be called concurrently.
+func (p *Parser) ParseStmts(r io.Reader, fn func(*Stmt) bool) error {
+	s := p.state()
+	defer p.release(s)
+	a := arenaPool.Get().(*arena)
+	s.arena = a
+	s.f = &File{}
+	s.src = r
+	s.rune()
+	s.next()
+	s.stmts(func(st *Stmt) bool {
+		if !fn(st) {
+			return false
+		}
+		if len(s.heredocs) == 0 {
+			// no pending heredoc still needs the statement
+			a.reset()
+			s.dropBatches()
+		}
+		return true
+	})
+	if s.err == nil {
+		// EOF immediately after heredoc word so no newline to
+		// trigger it
+		s.doHeredocs()
+	}
+	a.reset()
+	arenaPool.Put(a)
+	return s.err
+}
+
+// Interactive parses statements from an interactive stream, such as a
+// terminal, where input arrives one line at a time. Before each line is
+// read, fn is called with the statements that were completed since the
+// last call, and with whether the input so far ends in an incomplete
+// statement, such as an unterminated if clause, quote or heredoc. This lets
+// an interactive shell run the complete statements, and then show its
+// primary or secondary prompt accordingly. The first call is made before
+// anything is read.
+//
+// If fn returns false, parsing is stopped and the function is not called
+// again. If the input ends without a newline, fn is called one last time
+// with the remaining statements, if any.
+//
+// Like Parse, Interactive can be called concurrently.
+func (p *Parser) Interactive(r io.Reader, fn func(stmts []*Stmt, incomplete bool) bool) error {
+	s := p.state()
+	defer p.release(s)
+	s.f = &File{}
+	s.src = r
+	var stmts []*Stmt
+	stopped := false
+	s.interactive = func() bool {
+		stopped = !fn(stmts, s.openStmts > 0)
+		stmts = nil
+		return !stopped
+	}
+	s.rune()
+	s.next()
+	s.stmts(func(st *Stmt) bool {
+		stmts = append(stmts, st)
+		return true
+	})
+	if s.err == nil {
+		// EOF immediately after heredoc word so no newline to
+		// trigger it
+		s.doHeredocs()
+	}
+	if stopped {
+		return nil
+	}
+	if s.err == nil && len(stmts) > 0 {
+		fn(stmts, false)
+	}
+	return s.err
+}
+
+// state returns a reset parser, with the options of p, to do the work of a
+// single call to Parse or Stmts. Since p itself is never modified, it can
+// be used concurrently.
+func (p *Parser) state() *Parser {
+	s, _ := p.states.Get().(*Parser)
+	if s == nil {
+		s = &Parser{helperBuf: new(bytes.Buffer)}
+		for _, opt := range p.opts {
+			opt(s)
+		}
+	}
+	s.reset()
+	return s
+}
+
+// release puts a parser obtained via state back in the pool, dropping its
+// references to the input and the parsed nodes.
+func (p *Parser) release(s *Parser) {
+	s.src, s.srcStr, s.bs, s.f = nil, "", nil, nil
+	s.interactive = nil
+	s.accComs, s.curComs = nil, nil
+	if s.arena != nil {
+		// the rest of the batches belong to the parsed program
+		s.arena = nil
+		s.dropBatches()
+	}
+	p.states.Put(s)
+}
+
+func (p *Parser) dropBatches() {
+	p.litBatch, p.wordBatch, p.wpsBatch = nil, nil, nil
+	p.stmtBatch, p.stListBatch, p.callBatch = nil, nil, nil
+}
+
+// Parser holds the options to parse programs with. It is safe for
+// concurrent use, as each call to Parse or Stmts uses its own state.
+//
+// Internally, the same type holds the state of the parsing mechanism of a
 // program.
 type Parser struct {
+	// opts are the options given to NewParser, to build new states.
+	opts []func(*Parser)
+	// states holds idle parser states, which are only ever used by one
+	// goroutine at a time.
+	states *sync.Pool
+
 	src io.Reader
 	bs  []byte // current chunk of read bytes
 	bsp int    // pos within chunk for the rune after r
 	r   rune   // next rune
 	w   uint16 // width of r
 
+	// srcStr is a copy of the entire input when src is nil, in which
+	// case bs already holds all of it; see ParseBytes.
+	srcStr string
+
 	f *File
 
 	spaced bool // whether tok has whitespace on its left
@@ -139,8 +391,18 @@ type Parser struct {
 	quote   quoteState // current lexer state
 	eqlOffs int        // position of '=' in val (a literal)
 
-	keepComments bool
-	lang         LangVariant
+	keepComments     bool
+	allowInvalidUTF8 bool
+	bashCompat       bool
+	followShopts     bool
+	parseTraps       bool
+	parseScripts     bool
+	lazyWords        bool
+	lang             LangVariant
+
+	// extGlob is whether extended globs are parsed, and nextExtGlob
+	// whether they will be from the next line; see FollowShellOptions.
+	extGlob, nextExtGlob bool
 
 	stopAt []byte
 
@@ -163,11 +425,22 @@ type Parser struct {
 
 	reOpenParens int
 
+	// openStmts is how many statements are being parsed, to tell if
+	// the input read so far is incomplete.
+	openStmts int
+	// interactive is called by fill before reading each line of input,
+	// if set. If it returns false, the input is treated as if it ended.
+	interactive func() bool
+
 	accComs []Comment
 	curComs *[]Comment
 
 	helperBuf *bytes.Buffer
 
+	// useArena is whether Parse allocates nodes from arena; see Arena.
+	useArena bool
+	arena    *arena
+
 	litBatch    []Lit
 	wordBatch   []Word
 	wpsBatch    []WordPart
@@ -175,6 +448,11 @@ type Parser struct {
 	stListBatch []*Stmt
 	callBatch   []callAlloc
 
+	// lazy holds the batches to parse skipped words with, which are
+	// reused for each word; see LazyWords.
+	lazy      *lazyBatches
+	lazyDepth int
+
 	readBuf [bufSize]byte
 	litBuf  [bufSize]byte
 	litBs   []byte
@@ -194,7 +472,10 @@ func (p *Parser) reset() {
 	p.heredocs, p.buriedHdocs = p.heredocs[:0], 0
 	p.openBquotes, p.buriedBquotes = 0, 0
 	p.reOpenParens = 0
+	p.openStmts = 0
 	p.accComs, p.curComs = nil, &p.accComs
+	p.extGlob = !p.followShopts || p.lang != LangBash
+	p.nextExtGlob = p.extGlob
 }
 
 func (p *Parser) getPos() Pos {
@@ -204,7 +485,11 @@ func (p *Parser) getPos() Pos {
 
 func (p *Parser) lit(pos Pos, val string) *Lit {
 	if len(p.litBatch) == 0 {
-		p.litBatch = make([]Lit, 128)
+		if p.arena != nil {
+			p.litBatch = p.arena.litSlab(128)
+		} else {
+			p.litBatch = make([]Lit, 128)
+		}
 	}
 	l := &p.litBatch[0]
 	p.litBatch = p.litBatch[1:]
@@ -216,7 +501,11 @@ func (p *Parser) lit(pos Pos, val string) *Lit {
 
 func (p *Parser) word(parts []WordPart) *Word {
 	if len(p.wordBatch) == 0 {
-		p.wordBatch = make([]Word, 64)
+		if p.arena != nil {
+			p.wordBatch = p.arena.wordSlab(64)
+		} else {
+			p.wordBatch = make([]Word, 64)
+		}
 	}
 	w := &p.wordBatch[0]
 	p.wordBatch = p.wordBatch[1:]
@@ -226,7 +515,11 @@ func (p *Parser) word(parts []WordPart) *Word {
 
 func (p *Parser) wps(wp WordPart) []WordPart {
 	if len(p.wpsBatch) == 0 {
-		p.wpsBatch = make([]WordPart, 64)
+		if p.arena != nil {
+			p.wpsBatch = p.arena.wpsSlab(64)
+		} else {
+			p.wpsBatch = make([]WordPart, 64)
+		}
 	}
 	wps := p.wpsBatch[:1:1]
 	p.wpsBatch = p.wpsBatch[1:]
@@ -236,17 +529,25 @@ func (p *Parser) wps(wp WordPart) []WordPart {
 
 func (p *Parser) stmt(pos Pos) *Stmt {
 	if len(p.stmtBatch) == 0 {
-		p.stmtBatch = make([]Stmt, 64)
+		if p.arena != nil {
+			p.stmtBatch = p.arena.stmtSlab(64)
+		} else {
+			p.stmtBatch = make([]Stmt, 64)
+		}
 	}
 	s := &p.stmtBatch[0]
 	p.stmtBatch = p.stmtBatch[1:]
-	s.Position = pos
+	*s = Stmt{Position: pos} // batches may be reused; see lazyWord
 	return s
 }
 
 func (p *Parser) stList() []*Stmt {
 	if len(p.stListBatch) == 0 {
-		p.stListBatch = make([]*Stmt, 256)
+		if p.arena != nil {
+			p.stListBatch = p.arena.stListSlab(256)
+		} else {
+			p.stListBatch = make([]*Stmt, 256)
+		}
 	}
 	stmts := p.stListBatch[:0:4]
 	p.stListBatch = p.stListBatch[4:]
@@ -260,10 +561,15 @@ type callAlloc struct {
 
 func (p *Parser) call(w *Word) *CallExpr {
 	if len(p.callBatch) == 0 {
-		p.callBatch = make([]callAlloc, 32)
+		if p.arena != nil {
+			p.callBatch = p.arena.callSlab(32)
+		} else {
+			p.callBatch = make([]callAlloc, 32)
+		}
 	}
 	alloc := &p.callBatch[0]
 	p.callBatch = p.callBatch[1:]
+	*alloc = callAlloc{}
 	ce := &alloc.ce
 	ce.Args = alloc.ws[:1]
 	ce.Args[0] = w
@@ -321,14 +627,14 @@ func (p *Parser) unquotedWordBytes(w *Word) ([]byte, bool) {
 	p.helperBuf.Reset()
 	didUnquote := false
 	for _, wp := range w.Parts {
-		if p.unquotedWordPart(p.helperBuf, wp, false) {
+		if unquotedWordPart(p.helperBuf, wp, false) {
 			didUnquote = true
 		}
 	}
 	return p.helperBuf.Bytes(), didUnquote
 }
 
-func (p *Parser) unquotedWordPart(buf *bytes.Buffer, wp WordPart, quotes bool) (quoted bool) {
+func unquotedWordPart(buf *bytes.Buffer, wp WordPart, quotes bool) (quoted bool) {
 	switch x := wp.(type) {
 	case *Lit:
 		for i := 0; i < len(x.Value); i++ {
@@ -346,7 +652,7 @@ func (p *Parser) unquotedWordPart(buf *bytes.Buffer, wp WordPart, quotes bool) (
 		quoted = true
 	case *DblQuoted:
 		for _, wp2 := range x.Parts {
-			p.unquotedWordPart(buf, wp2, true)
+			unquotedWordPart(buf, wp2, true)
 		}
 		quoted = true
 	}
@@ -569,6 +875,9 @@ func (p *Parser) stmts(fn func(*Stmt) bool, stops ...string) {
 	gotEnd := true
 loop:
 	for p.tok != _EOF {
+		if p.tok == _Newl && p.openStmts == 0 {
+			p.extGlob = p.nextExtGlob
+		}
 		newLine := p.got(_Newl)
 		switch p.tok {
 		case _LitWord:
@@ -603,12 +912,37 @@ loop:
 			break
 		}
 		gotEnd = s.Semicolon.IsValid()
+		if p.followShopts && p.openStmts == 0 {
+			p.shellOptions(s)
+		}
 		if !fn(s) {
 			break
 		}
 	}
 }
 
+// shellOptions records the changes to the shell options which affect
+// parsing made by s, if any, which apply from the next line.
+func (p *Parser) shellOptions(s *Stmt) {
+	ce, ok := s.Cmd.(*CallExpr)
+	if !ok || len(ce.Args) < 3 || ce.Args[0].Lit() != "shopt" {
+		return
+	}
+	enable, set := false, false
+	for _, arg := range ce.Args[1:] {
+		switch val := arg.Lit(); val {
+		case "-s", "-u":
+			enable, set = val == "-s", true
+		case "-o": // the options of "set -o", none of which matter
+			return
+		case "extglob":
+			if set {
+				p.nextExtGlob = enable
+			}
+		}
+	}
+}
+
 func (p *Parser) stmtList(stops ...string) (sl StmtList) {
 	fn := func(s *Stmt) bool {
 		if sl.Stmts == nil {
@@ -640,6 +974,42 @@ func (p *Parser) getWord() *Word {
 	return nil
 }
 
+type lazyBatches struct {
+	lits    [128]Lit
+	words   [64]Word
+	wps     [64]WordPart
+	stmts   [64]Stmt
+	stLists [256]*Stmt
+	calls   [32]callAlloc
+}
+
+// lazyWord is like getWord, but it only keeps the position of the word; see
+// LazyWords.
+func (p *Parser) lazyWord() *Word {
+	if p.lazyDepth > 0 {
+		// within another skipped word, already using the lazy batches
+		return p.getWord()
+	}
+	if p.lazy == nil {
+		p.lazy = new(lazyBatches)
+	}
+	lits, words, wps := p.litBatch, p.wordBatch, p.wpsBatch
+	stmts, stLists, calls := p.stmtBatch, p.stListBatch, p.callBatch
+	p.litBatch, p.wordBatch, p.wpsBatch = p.lazy.lits[:], p.lazy.words[:], p.lazy.wps[:]
+	p.stmtBatch, p.stListBatch, p.callBatch = p.lazy.stmts[:], p.lazy.stLists[:], p.lazy.calls[:]
+	p.lazyDepth++
+	parts := p.wordParts()
+	p.lazyDepth--
+	p.litBatch, p.wordBatch, p.wpsBatch = lits, words, wps
+	p.stmtBatch, p.stListBatch, p.callBatch = stmts, stLists, calls
+	if len(parts) == 0 {
+		return p.word(nil)
+	}
+	l := p.lit(parts[0].Pos(), "")
+	l.ValueEnd = parts[len(parts)-1].End()
+	return p.word(p.wps(l))
+}
+
 func (p *Parser) getLit() *Lit {
 	switch p.tok {
 	case _Lit, _LitWord, _LitRedir:
@@ -688,7 +1058,7 @@ func (p *Parser) wordPart() WordPart {
 			}
 			fallthrough
 		case ' ', '\t', '\n':
-			if p.lang != LangMirBSDKorn {
+			if p.lang != LangMirBSDKorn && p.lang != LangKsh93 {
 				p.curErr(`"${ stmts;}" is a mksh feature`)
 			}
 			cs := &CmdSubst{
@@ -847,7 +1217,7 @@ func (p *Parser) wordPart() WordPart {
 		return cs
 	case globQuest, globStar, globPlus, globAt, globExcl:
 		if p.lang == LangPOSIX {
-			p.langErr(p.pos, "extended globs", LangBash, LangMirBSDKorn)
+			p.langErr(p.pos, "extended globs", LangBash, LangMirBSDKorn, LangKsh93)
 		}
 		eg := &ExtGlob{Op: GlobOperator(p.tok), OpPos: p.pos}
 		lparens := 1
@@ -890,115 +1260,111 @@ func (p *Parser) dblQuoted() *DblQuoted {
 	return q
 }
 
-func arithmOpLevel(op BinAritOperator) int {
-	switch op {
-	case Comma:
-		return 0
-	case AddAssgn, SubAssgn, MulAssgn, QuoAssgn, RemAssgn, AndAssgn,
-		OrAssgn, XorAssgn, ShlAssgn, ShrAssgn:
-		return 1
-	case Assgn:
-		return 2
-	case Quest, Colon:
-		return 3
-	case AndArit, OrArit:
-		return 4
-	case And, Or, Xor:
-		return 5
-	case Eql, Neq:
-		return 6
-	case Lss, Gtr, Leq, Geq:
-		return 7
-	case Shl, Shr:
-		return 8
-	case Add, Sub:
-		return 9
-	case Mul, Quo, Rem:
-		return 10
-	case Pow:
-		return 11
-	}
-	return -1
-}
-
 func (p *Parser) followArithm(ftok token, fpos Pos) ArithmExpr {
-	x := p.arithmExpr(0, false, false)
+	x := p.arithmExpr(1, false, false)
 	if x == nil {
 		p.followErrExp(fpos, ftok.String())
 	}
 	return x
 }
 
+// maxArithmLevel is the highest precedence of a binary arithmetic operator.
+const maxArithmLevel = 14
+
+// arithmExpr parses an arithmetic expression whose binary operators have at
+// least the given precedence; see BinAritOperator.Precedence. If tern is
+// true, the expression is the middle operand of a ternary operator, so it
+// ends at a colon.
 func (p *Parser) arithmExpr(level int, compact, tern bool) ArithmExpr {
 	if p.tok == _EOF || p.peekArithmEnd() {
 		return nil
 	}
-	var left ArithmExpr
-	if level > 11 {
-		left = p.arithmExprBase(compact)
-	} else {
-		left = p.arithmExpr(level+1, compact, false)
-	}
-	if compact && p.spaced {
-		return left
+	if level > maxArithmLevel {
+		return p.arithmExprBase(compact)
 	}
-	p.got(_Newl)
-	newLevel := arithmOpLevel(BinAritOperator(p.tok))
-	if !tern && p.tok == colon && p.quote == paramExpSlice {
-		newLevel = -1
-	}
-	if newLevel < 0 {
-		switch p.tok {
-		case _Lit, _LitWord:
-			p.curErr("not a valid arithmetic operator: %s", p.val)
-			return nil
-		case leftBrack:
-			p.curErr("[ must follow a name")
-			return nil
-		case rightParen, _EOF:
-		default:
-			if p.quote == arithmExpr {
-				p.curErr("not a valid arithmetic operator: %v", p.tok)
+	left := p.arithmExpr(level+1, compact, tern)
+	for {
+		if compact && p.spaced {
+			return left
+		}
+		p.got(_Newl)
+		if p.tok == colon && (tern || p.quote == paramExpSlice) {
+			return left
+		}
+		newLevel := BinAritOperator(p.tok).Precedence()
+		if newLevel == 0 {
+			switch p.tok {
+			case _Lit, _LitWord:
+				p.curErr("not a valid arithmetic operator: %s", p.val)
 				return nil
+			case leftBrack:
+				p.curErr("[ must follow a name")
+				return nil
+			case rightParen, _EOF:
+			default:
+				if p.quote == arithmExpr {
+					p.curErr("not a valid arithmetic operator: %v", p.tok)
+					return nil
+				}
 			}
 		}
-	}
-	if newLevel < level {
-		return left
-	}
-	if left == nil {
-		p.curErr("%s must follow an expression", p.tok.String())
-		return nil
-	}
-	b := &BinaryArithm{
-		OpPos: p.pos,
-		Op:    BinAritOperator(p.tok),
-		X:     left,
-	}
-	switch b.Op {
-	case Colon:
-		if !tern {
+		if newLevel != level {
+			// higher levels were already parsed as part of left
+			return left
+		}
+		if left == nil {
+			p.curErr("%s must follow an expression", p.tok.String())
+			return nil
+		}
+		b := &BinaryArithm{
+			OpPos: p.pos,
+			Op:    BinAritOperator(p.tok),
+			X:     left,
+		}
+		switch b.Op {
+		case Colon:
 			p.posErr(b.Pos(), "ternary operator missing ? before :")
+		case AddAssgn, SubAssgn, MulAssgn, QuoAssgn, RemAssgn, AndAssgn,
+			OrAssgn, XorAssgn, ShlAssgn, ShrAssgn, Assgn:
+			if !isArithName(b.X) {
+				p.posErr(b.OpPos, "%s must follow a name", b.Op.String())
+			}
 		}
-	case AddAssgn, SubAssgn, MulAssgn, QuoAssgn, RemAssgn, AndAssgn,
-		OrAssgn, XorAssgn, ShlAssgn, ShrAssgn, Assgn:
-		if !isArithName(b.X) {
-			p.posErr(b.OpPos, "%s must follow a name", b.Op.String())
+		if p.next(); compact && p.spaced {
+			p.followErrExp(b.OpPos, b.Op.String())
 		}
-	}
-	if p.next(); compact && p.spaced {
-		p.followErrExp(b.OpPos, b.Op.String())
-	}
-	b.Y = p.arithmExpr(newLevel, compact, b.Op == Quest)
-	if b.Y == nil {
-		p.followErrExp(b.OpPos, b.Op.String())
-	}
-	if b.Op == Quest {
-		if b2, ok := b.Y.(*BinaryArithm); !ok || b2.Op != Colon {
-			p.posErr(b.Pos(), "ternary operator missing : after ?")
+		if b.Op == Quest {
+			// like in C, the middle operand may be any expression
+			mid := p.arithmExpr(1, compact, true)
+			if mid == nil {
+				p.followErrExp(b.OpPos, b.Op.String())
+			}
+			if p.tok != colon {
+				p.posErr(b.Pos(), "ternary operator missing : after ?")
+			}
+			c := &BinaryArithm{OpPos: p.pos, Op: Colon, X: mid}
+			if p.next(); compact && p.spaced {
+				p.followErrExp(c.OpPos, c.Op.String())
+			}
+			if c.Y = p.arithmExpr(level, compact, tern); c.Y == nil {
+				p.followErrExp(c.OpPos, c.Op.String())
+			}
+			b.Y = c
+			return b
+		}
+		if b.Op.RightAssoc() {
+			b.Y = p.arithmExpr(level, compact, tern)
+		} else {
+			b.Y = p.arithmExpr(level+1, compact, tern)
+		}
+		if b.Y == nil {
+			p.followErrExp(b.OpPos, b.Op.String())
 		}
+		if b.Op.RightAssoc() {
+			return b
+		}
+		left = b
 	}
-	return b
 }
 
 func isArithName(left ArithmExpr) bool {
@@ -1100,10 +1466,38 @@ func singleRuneParam(r rune) bool {
 	return false
 }
 
+// paramFlags reads the flags of a Zsh parameter expansion, such as the
+// "j:,:" in "${(j:,:)foo}". They are kept as a literal, as they are not
+// parsed any further.
+func (p *Parser) paramFlags() *Lit {
+	lparen := p.getPos()
+	p.rune()
+	pos := p.getPos()
+	var buf bytes.Buffer
+	for p.r != ')' {
+		if p.r == utf8.RuneSelf || p.r == '\n' {
+			what := "EOF"
+			if p.r == '\n' {
+				what = "newline"
+			}
+			p.posErr(lparen, "reached %s without matching ( with )", what)
+			return nil
+		}
+		buf.WriteRune(p.r)
+		p.rune()
+	}
+	l := p.lit(pos, buf.String())
+	p.rune()
+	return l
+}
+
 func (p *Parser) paramExp() *ParamExp {
 	pe := &ParamExp{Dollar: p.pos}
 	old := p.quote
 	p.quote = paramExpName
+	if p.lang == LangZsh && p.r == '(' {
+		pe.Flags = p.paramFlags()
+	}
 	if p.r == '#' {
 		p.tok = hash
 		p.pos = p.getPos()
@@ -1128,7 +1522,7 @@ func (p *Parser) paramExp() *ParamExp {
 	case exclMark:
 		if paramNameOp(p.r) {
 			if p.lang == LangPOSIX {
-				p.langErr(p.pos, "${!foo}", LangBash, LangMirBSDKorn)
+				p.langErr(p.pos, "${!foo}", LangBash, LangMirBSDKorn, LangKsh93)
 			}
 			pe.Excl = true
 			p.next()
@@ -1137,7 +1531,7 @@ func (p *Parser) paramExp() *ParamExp {
 	op := p.tok
 	switch p.tok {
 	case _Lit, _LitWord:
-		if !numberLiteral(p.val) && !ValidName(p.val) {
+		if !numberLiteral(p.val) && !p.validName(p.val) {
 			p.curErr("invalid parameter name")
 		}
 		pe.Param = p.lit(p.pos, p.val)
@@ -1166,9 +1560,9 @@ func (p *Parser) paramExp() *ParamExp {
 		return pe
 	case leftBrack:
 		if p.lang == LangPOSIX {
-			p.langErr(p.pos, "arrays", LangBash, LangMirBSDKorn)
+			p.langErr(p.pos, "arrays", LangBash, LangMirBSDKorn, LangKsh93, LangZsh)
 		}
-		if !ValidName(pe.Param.Value) {
+		if !p.validName(pe.Param.Value) {
 			p.curErr("cannot index a special parameter name")
 		}
 		pe.Index = p.eitherIndex()
@@ -1186,7 +1580,7 @@ func (p *Parser) paramExp() *ParamExp {
 	case slash, dblSlash:
 		// pattern search and replace
 		if p.lang == LangPOSIX {
-			p.langErr(p.pos, "search and replace", LangBash, LangMirBSDKorn)
+			p.langErr(p.pos, "search and replace", LangBash, LangMirBSDKorn, LangKsh93, LangZsh)
 		}
 		pe.Repl = &Replace{All: p.tok == dblSlash}
 		p.quote = paramExpRepl
@@ -1199,7 +1593,7 @@ func (p *Parser) paramExp() *ParamExp {
 	case colon:
 		// slicing
 		if p.lang == LangPOSIX {
-			p.langErr(p.pos, "slicing", LangBash, LangMirBSDKorn)
+			p.langErr(p.pos, "slicing", LangBash, LangMirBSDKorn, LangKsh93, LangZsh)
 		}
 		pe.Slice = &Slice{}
 		colonPos := p.pos
@@ -1219,7 +1613,7 @@ func (p *Parser) paramExp() *ParamExp {
 		pe.Exp = p.paramExpExp()
 	case at, star:
 		switch {
-		case p.tok == at && p.lang == LangPOSIX:
+		case p.tok == at && (p.lang == LangPOSIX || p.lang == LangKsh93 && !pe.Excl):
 			p.langErr(p.pos, "this expansion operator", LangBash, LangMirBSDKorn)
 		case p.tok == star && !pe.Excl:
 			p.curErr("not a valid parameter expansion operator: %v", p.tok)
@@ -1325,6 +1719,55 @@ func ValidName(val string) bool {
 	return true
 }
 
+// validName is like ValidName, but also accepts the names of variables
+// within namespaces with LangKsh93; see validKshName.
+func (p *Parser) validName(val string) bool {
+	if p.lang == LangKsh93 {
+		return validKshName(val)
+	}
+	return ValidName(val)
+}
+
+// validKshName is like ValidName, but also accepts the names of variables
+// within Korn Shell 93 namespaces, such as ".sh.version" or "foo.bar".
+func validKshName(val string) bool {
+	if ValidName(val) {
+		return true
+	}
+	if val == "" || val == "." {
+		return false
+	}
+	if val[0] == '.' {
+		val = val[1:]
+	}
+	for _, part := range strings.Split(val, ".") {
+		if part == "" || !ValidName(part) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsBuiltin returns whether name is a builtin command in Bash, which
+// includes those of POSIX Shell. Reserved words such as "if" or "[[" are
+// not builtins; see IsKeyword.
+func IsBuiltin(name string) bool {
+	switch name {
+	case ".", ":", "[", "alias", "bg", "bind", "break", "builtin",
+		"caller", "cd", "command", "compgen", "complete", "compopt",
+		"continue", "declare", "dirs", "disown", "echo", "enable",
+		"eval", "exec", "exit", "export", "false", "fc", "fg",
+		"getopts", "hash", "help", "history", "jobs", "kill", "let",
+		"local", "logout", "mapfile", "popd", "printf", "pushd", "pwd",
+		"read", "readarray", "readonly", "return", "set", "shift",
+		"shopt", "source", "suspend", "test", "times", "trap", "true",
+		"type", "typeset", "ulimit", "umask", "unalias", "unset",
+		"wait":
+		return true
+	}
+	return false
+}
+
 func numberLiteral(val string) bool {
 	for _, r := range val {
 		if '0' > r || r > '9' {
@@ -1342,7 +1785,7 @@ func (p *Parser) hasValidIdent() bool {
 		if p.val[end-1] == '+' && p.lang != LangPOSIX {
 			end--
 		}
-		if ValidName(p.val[:end]) {
+		if p.validName(p.val[:end]) {
 			return true
 		}
 	}
@@ -1401,14 +1844,14 @@ func (p *Parser) getAssign(needEqual bool) *Assign {
 	}
 	if as.Value == nil && p.tok == leftParen {
 		if p.lang == LangPOSIX {
-			p.langErr(p.pos, "arrays", LangBash, LangMirBSDKorn)
+			p.langErr(p.pos, "arrays", LangBash, LangMirBSDKorn, LangKsh93, LangZsh)
 		}
 		if as.Index != nil {
 			p.curErr("arrays cannot be nested")
 		}
 		as.Array = &ArrayExpr{Lparen: p.pos}
 		newQuote := p.quote
-		if p.lang == LangBash {
+		if p.lang == LangBash || p.lang == LangKsh93 || p.lang == LangZsh {
 			newQuote = arrayElems
 		}
 		old := p.preNested(newQuote)
@@ -1476,8 +1919,8 @@ func (p *Parser) doRedirect(s *Stmt) {
 		s.Redirs = append(s.Redirs, r)
 	}
 	r.N = p.getLit()
-	if p.lang != LangBash && r.N != nil && r.N.Value[0] == '{' {
-		p.langErr(r.N.Pos(), "{varname} redirects", LangBash)
+	if (p.lang == LangPOSIX || p.lang == LangMirBSDKorn) && r.N != nil && r.N.Value[0] == '{' {
+		p.langErr(r.N.Pos(), "{varname} redirects", LangBash, LangKsh93, LangZsh)
 	}
 	r.Op, r.OpPos = RedirOperator(p.tok), p.pos
 	p.next()
@@ -1504,6 +1947,7 @@ func (p *Parser) doRedirect(s *Stmt) {
 }
 
 func (p *Parser) getStmt(readEnd, binCmd, fnBody bool) *Stmt {
+	p.openStmts++
 	pos, ok := p.gotRsrv("!")
 	s := p.stmt(pos)
 	if ok {
@@ -1516,6 +1960,7 @@ func (p *Parser) getStmt(readEnd, binCmd, fnBody bool) *Stmt {
 		}
 	}
 	if s = p.gotStmtPipe(s); s == nil || p.err != nil {
+		p.openStmts--
 		return nil
 	}
 	// instead of using recursion, iterate manually
@@ -1523,6 +1968,7 @@ func (p *Parser) getStmt(readEnd, binCmd, fnBody bool) *Stmt {
 		// left associativity: in a list of BinaryCmds, the
 		// right recursion should only read a single element
 		if binCmd {
+			p.openStmts--
 			return s
 		}
 		b := &BinaryCmd{
@@ -1530,11 +1976,13 @@ func (p *Parser) getStmt(readEnd, binCmd, fnBody bool) *Stmt {
 			Op:    BinCmdOperator(p.tok),
 			X:     s,
 		}
+		s.Terminator = binCmdTerm(b.Op)
 		p.next()
 		p.got(_Newl)
 		b.Y = p.getStmt(false, true, false)
 		if b.Y == nil || p.err != nil {
 			p.followErr(b.OpPos, b.Op.String(), "a statement")
+			p.openStmts--
 			return nil
 		}
 		s = p.stmt(s.Position)
@@ -1545,15 +1993,20 @@ func (p *Parser) getStmt(readEnd, binCmd, fnBody bool) *Stmt {
 		switch p.tok {
 		case semicolon:
 			s.Semicolon = p.pos
+			s.Terminator = TermSemicolon
 			p.next()
 		case and:
 			s.Semicolon = p.pos
+			s.Terminator = TermBackground
 			p.next()
 			s.Background = true
 		case orAnd:
 			s.Semicolon = p.pos
+			s.Terminator = TermPipeAll
 			p.next()
 			s.Coprocess = true
+		case _Newl:
+			s.Terminator = TermNewline
 		}
 	}
 	if len(p.accComs) > 0 && !binCmd && !fnBody {
@@ -1563,6 +2016,7 @@ func (p *Parser) getStmt(readEnd, binCmd, fnBody bool) *Stmt {
 			p.accComs = p.accComs[1:]
 		}
 	}
+	p.openStmts--
 	return s
 }
 
@@ -1618,7 +2072,7 @@ func (p *Parser) gotStmtPipe(s *Stmt) *Stmt {
 				p.bashFuncDecl(s)
 			}
 		case "declare":
-			if p.lang == LangBash {
+			if p.lang == LangBash || p.lang == LangZsh {
 				p.declClause(s)
 			}
 		case "local", "export", "readonly", "typeset", "nameref":
@@ -1633,6 +2087,10 @@ func (p *Parser) gotStmtPipe(s *Stmt) *Stmt {
 			if p.lang == LangBash {
 				p.coprocClause(s)
 			}
+		case "namespace":
+			if p.lang == LangKsh93 {
+				p.namespaceClause(s)
+			}
 		case "select":
 			if p.lang != LangPOSIX {
 				p.selectClause(s)
@@ -1677,6 +2135,13 @@ func (p *Parser) gotStmtPipe(s *Stmt) *Stmt {
 		}
 		p.callExpr(s, w, false)
 	case leftParen:
+		if p.lang == LangZsh && p.r == ')' {
+			pos := p.pos
+			p.next()
+			p.next()
+			p.anonFunc(s, pos, false)
+			break
+		}
 		p.subshell(s)
 	case dblLeftParen:
 		p.arithmExpCmd(s)
@@ -1690,12 +2155,13 @@ func (p *Parser) gotStmtPipe(s *Stmt) *Stmt {
 	}
 	switch p.tok {
 	case orAnd:
-		if p.lang == LangMirBSDKorn {
+		if p.lang == LangMirBSDKorn || p.lang == LangKsh93 {
 			break
 		}
 		fallthrough
 	case or:
 		b := &BinaryCmd{OpPos: p.pos, Op: BinCmdOperator(p.tok), X: s}
+		s.Terminator = binCmdTerm(b.Op)
 		p.next()
 		p.got(_Newl)
 		if b.Y = p.gotStmtPipe(p.stmt(p.pos)); b.Y == nil || p.err != nil {
@@ -1797,6 +2263,10 @@ func (p *Parser) forClause(s *Stmt) {
 	fc := &ForClause{ForPos: p.pos}
 	p.next()
 	fc.Loop = p.loop(fc.ForPos)
+	if p.braceLoop(fc) {
+		s.Cmd = fc
+		return
+	}
 	fc.DoPos = p.followRsrv(fc.ForPos, "for foo [in words]", "do")
 
 	s.Comments = append(s.Comments, p.accComs...)
@@ -1806,24 +2276,48 @@ func (p *Parser) forClause(s *Stmt) {
 	s.Cmd = fc
 }
 
+// braceLoops reports whether for and select clauses may use braces instead
+// of "do" and "done", which is obsolete in Bash but common in Zsh.
+func (p *Parser) braceLoops() bool {
+	return p.lang == LangZsh || p.bashCompat && p.lang == LangBash
+}
+
+// braceLoop parses the body of a for or select clause in the form with
+// braces, if allowed. It reports whether it did so.
+func (p *Parser) braceLoop(fc *ForClause) bool {
+	if !p.braceLoops() || p.tok != _LitWord || p.val != "{" {
+		return false
+	}
+	fc.Braces = true
+	fc.DoPos = p.pos
+	p.next()
+	fc.Do = p.stmtList("}")
+	pos, ok := p.gotRsrv("}")
+	fc.DonePos = pos
+	if !ok {
+		p.matchingErr(fc.DoPos, "{", "}")
+	}
+	return true
+}
+
 func (p *Parser) loop(fpos Pos) Loop {
-	if p.lang != LangBash {
+	if p.lang == LangPOSIX || p.lang == LangMirBSDKorn {
 		switch p.tok {
 		case leftParen, dblLeftParen:
-			p.langErr(p.pos, "c-style fors", LangBash)
+			p.langErr(p.pos, "c-style fors", LangBash, LangKsh93, LangZsh)
 		}
 	}
 	if p.tok == dblLeftParen {
 		cl := &CStyleLoop{Lparen: p.pos}
 		old := p.preNested(arithmExprCmd)
 		p.next()
-		cl.Init = p.arithmExpr(0, false, false)
+		cl.Init = p.arithmExpr(1, false, false)
 		if !p.got(dblSemicolon) {
 			p.follow(p.pos, "expr", semicolon)
-			cl.Cond = p.arithmExpr(0, false, false)
+			cl.Cond = p.arithmExpr(1, false, false)
 			p.follow(p.pos, "expr", semicolon)
 		}
-		cl.Post = p.arithmExpr(0, false, false)
+		cl.Post = p.arithmExpr(1, false, false)
 		cl.Rparen = p.arithmEnd(dblLeftParen, cl.Lparen, old)
 		p.got(semicolon)
 		p.got(_Newl)
@@ -1852,7 +2346,23 @@ func (p *Parser) wordIter(ftok string, fpos Pos) *WordIter {
 		}
 		p.got(semicolon)
 		p.got(_Newl)
-	} else if p.tok == _LitWord && p.val == "do" {
+	} else if p.lang == LangZsh && p.tok == leftParen {
+		// the short form, like "for i (a b) { echo $i; }"
+		lparen := p.pos
+		p.next()
+		for p.tok != _EOF && p.tok != rightParen {
+			if p.got(_Newl) {
+				continue
+			}
+			if w := p.getWord(); w == nil {
+				p.curErr("word list can only contain words")
+			} else {
+				wi.Items = append(wi.Items, w)
+			}
+		}
+		p.matched(lparen, leftParen, rightParen)
+		p.got(_Newl)
+	} else if p.tok == _LitWord && (p.val == "do" || p.braceLoops() && p.val == "{") {
 	} else {
 		p.followErr(fpos, ftok+" foo", `"in", "do", ;, or a newline`)
 	}
@@ -1863,6 +2373,10 @@ func (p *Parser) selectClause(s *Stmt) {
 	fc := &ForClause{ForPos: p.pos, Select: true}
 	p.next()
 	fc.Loop = p.wordIter("select", fc.ForPos)
+	if p.braceLoop(fc) {
+		s.Cmd = fc
+		return
+	}
 	fc.DoPos = p.followRsrv(fc.ForPos, "select foo [in words]", "do")
 	fc.Do = p.followStmts("do", fc.DoPos, "done")
 	fc.DonePos = p.stmtEnd(fc, "select", "done")
@@ -1939,79 +2453,101 @@ func (p *Parser) caseItems(stop string) (items []*CaseItem) {
 
 func (p *Parser) testClause(s *Stmt) {
 	tc := &TestClause{Left: p.pos}
+	oldExtGlob := p.extGlob
+	p.extGlob = true // like Bash, which always parses them in patterns here
 	p.next()
 	if _, ok := p.gotRsrv("]]"); ok || p.tok == _EOF {
 		p.posErr(tc.Left, "test clause requires at least one expression")
 	}
-	tc.X = p.testExpr(dblLeftBrack, tc.Left, false)
+	tc.X = p.testExpr(dblLeftBrack, tc.Left, 1)
 	tc.Right = p.pos
+	p.extGlob = oldExtGlob
 	if _, ok := p.gotRsrv("]]"); !ok {
 		p.matchingErr(tc.Left, "[[", "]]")
 	}
 	s.Cmd = tc
 }
 
-func (p *Parser) testExpr(ftok token, fpos Pos, pastAndOr bool) TestExpr {
-	var left TestExpr
-	if pastAndOr {
-		left = p.testExprBase(ftok, fpos)
-	} else {
-		left = p.testExpr(ftok, fpos, true)
+// testExpr parses a test expression whose binary operators have at least
+// the given precedence; see BinTestOperator.Precedence.
+func (p *Parser) testExpr(ftok token, fpos Pos, level int) TestExpr {
+	if level >= 3 {
+		return p.testExprCmp(ftok, fpos)
 	}
-	if left == nil {
-		return left
-	}
-	switch p.tok {
-	case andAnd, orOr:
-	case _LitWord:
-		if p.val == "]]" {
-			return left
+	left := p.testExpr(ftok, fpos, level+1)
+	for left != nil {
+		var op BinTestOperator
+		switch p.tok {
+		case andAnd:
+			op = AndTest
+		case orOr:
+			op = OrTest
 		}
-	case rdrIn, rdrOut:
-	case _EOF, rightParen:
-		return left
-	case _Lit:
-		p.curErr("test operator words must consist of a single literal")
-	default:
-		p.curErr("not a valid test operator: %v", p.tok)
-	}
-	if p.tok == _LitWord {
-		if p.tok = token(testBinaryOp(p.val)); p.tok == illegalTok {
-			p.curErr("not a valid test operator: %s", p.val)
+		if op == 0 || op.Precedence() != level {
+			break
 		}
-	}
-	b := &BinaryTest{
-		OpPos: p.pos,
-		Op:    BinTestOperator(p.tok),
-		X:     left,
-	}
-	switch b.Op {
-	case AndTest, OrTest:
+		b := &BinaryTest{OpPos: p.pos, Op: op, X: left}
 		p.next()
 		p.got(_Newl)
-		if b.Y = p.testExpr(token(b.Op), b.OpPos, false); b.Y == nil {
+		if b.Y = p.testExpr(token(b.Op), b.OpPos, level+1); b.Y == nil {
 			p.followErrExp(b.OpPos, b.Op.String())
 		}
-	case TsReMatch:
-		if p.lang != LangBash {
-			p.langErr(p.pos, "regex tests", LangBash)
+		left = b
+	}
+	return left
+}
+
+// testExprCmp parses a test expression without && nor ||, such as a
+// comparison of two words.
+func (p *Parser) testExprCmp(ftok token, fpos Pos) TestExpr {
+	left := p.testExprBase(ftok, fpos)
+	// loop to give good errors for tokens following a comparison
+	for left != nil {
+		switch p.tok {
+		case andAnd, orOr:
+			return left
+		case _LitWord:
+			if p.val == "]]" {
+				return left
+			}
+		case rdrIn, rdrOut:
+		case _EOF, rightParen:
+			return left
+		case _Lit:
+			p.curErr("test operator words must consist of a single literal")
+		default:
+			p.curErr("not a valid test operator: %v", p.tok)
+		}
+		if p.tok == _LitWord {
+			if p.tok = token(testBinaryOp(p.val)); p.tok == illegalTok {
+				p.curErr("not a valid test operator: %s", p.val)
+			}
+		}
+		b := &BinaryTest{
+			OpPos: p.pos,
+			Op:    BinTestOperator(p.tok),
+			X:     left,
+		}
+		if b.Op == TsReMatch {
+			if p.lang == LangPOSIX || p.lang == LangMirBSDKorn {
+				p.langErr(p.pos, "regex tests", LangBash, LangKsh93, LangZsh)
+			}
+			oldReOpenParens := p.reOpenParens
+			old := p.preNested(testRegexp)
+			defer func() {
+				p.postNested(old)
+				p.reOpenParens = oldReOpenParens
+			}()
 		}
-		oldReOpenParens := p.reOpenParens
-		old := p.preNested(testRegexp)
-		defer func() {
-			p.postNested(old)
-			p.reOpenParens = oldReOpenParens
-		}()
-		fallthrough
-	default:
 		if _, ok := b.X.(*Word); !ok {
 			p.posErr(b.OpPos, "expected %s, %s or %s after complex expr",
 				AndTest, OrTest, "]]")
 		}
 		p.next()
 		b.Y = p.followWordTok(token(b.Op), b.OpPos)
+		left = b
 	}
-	return b
+	return left
 }
 
 func (p *Parser) testExprBase(ftok token, fpos Pos) TestExpr {
@@ -2023,7 +2559,7 @@ func (p *Parser) testExprBase(ftok token, fpos Pos) TestExpr {
 		switch op {
 		case illegalTok:
 		case tsRefVar, tsModif: // not available in mksh
-			if p.lang == LangBash {
+			if p.lang == LangBash || p.lang == LangKsh93 {
 				p.tok = op
 			}
 		default:
@@ -2034,7 +2570,7 @@ func (p *Parser) testExprBase(ftok token, fpos Pos) TestExpr {
 	case exclMark:
 		u := &UnaryTest{OpPos: p.pos, Op: TsNot}
 		p.next()
-		if u.X = p.testExpr(token(u.Op), u.OpPos, false); u.X == nil {
+		if u.X = p.testExpr(token(u.Op), u.OpPos, 3); u.X == nil {
 			p.followErrExp(u.OpPos, u.Op.String())
 		}
 		return u
@@ -2050,7 +2586,7 @@ func (p *Parser) testExprBase(ftok token, fpos Pos) TestExpr {
 		pe := &ParenTest{Lparen: p.pos}
 		p.next()
 		p.got(_Newl)
-		if pe.X = p.testExpr(leftParen, pe.Lparen, false); pe.X == nil {
+		if pe.X = p.testExpr(leftParen, pe.Lparen, 1); pe.X == nil {
 			p.followErrExp(pe.Lparen, "(")
 		}
 		pe.Rparen = p.matched(pe.Lparen, leftParen, rightParen)
@@ -2110,8 +2646,19 @@ func (p *Parser) timeClause(s *Stmt) {
 	p.next()
 	if _, ok := p.gotRsrv("-p"); ok {
 		tc.PosixFormat = true
+		if p.bashCompat {
+			p.gotRsrv("--") // ends the options, like in "time -p -- cmd"
+		}
 	}
-	tc.Stmt = p.gotStmtPipe(p.stmt(p.pos))
+	st := p.stmt(p.pos)
+	if p.bashCompat && p.tok == _LitWord && p.val == "!" {
+		p.next()
+		st.Negated = true
+		if stopToken(p.tok) {
+			p.posErr(st.Pos(), `"!" cannot form a statement alone`)
+		}
+	}
+	tc.Stmt = p.gotStmtPipe(st)
 	s.Cmd = tc
 }
 
@@ -2139,18 +2686,35 @@ func (p *Parser) coprocClause(s *Stmt) {
 			// name was in fact the start of a call
 			call.Args = append([]*Word{p.word(p.wps(cc.Name))},
 				call.Args...)
+			cc.Stmt.Position = cc.Name.ValuePos
 			cc.Name = nil
 		}
 	}
 	s.Cmd = cc
 }
 
+func (p *Parser) namespaceClause(s *Stmt) {
+	nc := &NamespaceClause{Namespace: p.pos}
+	p.next()
+	if nc.Name = p.getLit(); nc.Name == nil || !ValidName(nc.Name.Value) {
+		p.followErr(nc.Namespace, "namespace", "a name")
+	}
+	nc.Lbrace = p.followRsrv(nc.Namespace, "namespace foo", "{")
+	nc.StmtList = p.stmtList("}")
+	pos, ok := p.gotRsrv("}")
+	nc.Rbrace = pos
+	if !ok {
+		p.matchingErr(nc.Lbrace, "{", "}")
+	}
+	s.Cmd = nc
+}
+
 func (p *Parser) letClause(s *Stmt) {
 	lc := &LetClause{Let: p.pos}
 	old := p.preNested(arithmExprLet)
 	p.next()
 	for !stopToken(p.tok) && !p.peekRedir() {
-		x := p.arithmExpr(0, true, false)
+		x := p.arithmExpr(1, true, false)
 		if x == nil {
 			break
 		}
@@ -2165,7 +2729,11 @@ func (p *Parser) letClause(s *Stmt) {
 
 func (p *Parser) bashFuncDecl(s *Stmt) {
 	fpos := p.pos
-	if p.next(); p.tok != _LitWord {
+	if p.next(); p.lang == LangZsh && p.tok == _LitWord && p.val == "{" {
+		p.anonFunc(s, fpos, true)
+		return
+	}
+	if p.tok != _LitWord {
 		if w := p.followWord("function", fpos); p.err == nil {
 			p.posErr(w.Pos(), "invalid func name")
 		}
@@ -2177,6 +2745,25 @@ func (p *Parser) bashFuncDecl(s *Stmt) {
 	p.funcDecl(s, name, fpos)
 }
 
+func (p *Parser) anonFunc(s *Stmt, pos Pos, rsrvWord bool) {
+	af := &AnonFunc{Position: pos, RsrvWord: rsrvWord}
+	p.got(_Newl)
+	if p.tok != _LitWord || p.val != "{" {
+		if rsrvWord {
+			p.followErr(pos, "function", `"{"`)
+		} else {
+			p.followErr(pos, "()", `"{"`)
+		}
+		return
+	}
+	af.Body = p.stmt(p.pos)
+	p.block(af.Body)
+	for w := p.getWord(); w != nil; w = p.getWord() {
+		af.Args = append(af.Args, w)
+	}
+	s.Cmd = af
+}
+
 func (p *Parser) callExpr(s *Stmt, w *Word, assign bool) {
 	ce := p.call(w)
 	if w == nil {
@@ -2205,7 +2792,7 @@ loop:
 				ce.Assigns = append(ce.Assigns, p.getAssign(true))
 				break
 			}
-			ce.Args = append(ce.Args, p.word(p.wordParts()))
+			ce.Args = append(ce.Args, p.argWord(len(ce.Args) == 0))
 		case bckQuote:
 			if p.backquoteEnd() {
 				break loop
@@ -2214,7 +2801,7 @@ loop:
 		case dollBrace, dollDblParen, dollParen, dollar, cmdIn, cmdOut,
 			sglQuote, dollSglQuote, dblQuote, dollDblQuote, dollBrack,
 			globQuest, globStar, globPlus, globAt, globExcl:
-			ce.Args = append(ce.Args, p.word(p.wordParts()))
+			ce.Args = append(ce.Args, p.argWord(len(ce.Args) == 0))
 		case rdrOut, appOut, rdrIn, dplIn, dplOut, clbOut, rdrInOut,
 			hdoc, dashHdoc, wordHdoc, rdrAll, appAll, _LitRedir:
 			p.doRedirect(s)
@@ -2240,10 +2827,25 @@ loop:
 				p.posErr(asgn.Pos(), "inline variables cannot be arrays")
 			}
 		}
+		if p.parseTraps && ce.Args[0].Lit() == "trap" {
+			ce.Handler = p.trapHandler(ce.Args[1:])
+		}
+		if p.parseScripts {
+			ce.Script = p.scriptArg(ce.Args)
+		}
 	}
 	s.Cmd = ce
 }
 
+// argWord parses an argument of a call, which may be skipped unless it is
+// the command name; see LazyWords.
+func (p *Parser) argWord(name bool) *Word {
+	if p.lazyWords && !name {
+		return p.lazyWord()
+	}
+	return p.word(p.wordParts())
+}
+
 func (p *Parser) funcDecl(s *Stmt, name *Lit, pos Pos) {
 	fd := &FuncDecl{
 		Position: pos,
@@ -8,11 +8,15 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/kr/pretty"
@@ -294,6 +298,35 @@ func singleParse(p *Parser, in string, want *File) func(t *testing.T) {
 	}
 }
 
+func TestParseConcurrent(t *testing.T) {
+	t.Parallel()
+	p := NewParser()
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i, c := range fileTests {
+				if c.Bash == nil {
+					continue
+				}
+				for j, in := range c.Strs {
+					got, err := p.Parse(strings.NewReader(in), "")
+					if err != nil {
+						t.Errorf("%03d-%d: unexpected error in %q: %v", i, j, in, err)
+						continue
+					}
+					clearPosRecurse(t, in, got)
+					if !reflect.DeepEqual(got, c.Bash) {
+						t.Errorf("%03d-%d: syntax tree mismatch in %q", i, j, in)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
 func BenchmarkParse(b *testing.B) {
 	src := "" +
 		strings.Repeat("\n\n\t\t        \n", 10) +
@@ -978,6 +1011,14 @@ var shellTests = []errorCase{
 		in:     "echo $((a : b))",
 		common: `1:9: ternary operator missing ? before :`,
 	},
+	{
+		in:     "echo $((a ? b : c : d))",
+		common: `1:17: ternary operator missing ? before :`,
+	},
+	{
+		in:     "echo $((a ? b :))",
+		common: `1:15: : must be followed by an expression`,
+	},
 	{
 		in:     "echo $((/",
 		common: `1:9: / must follow an expression`,
@@ -1357,7 +1398,7 @@ var shellTests = []errorCase{
 	{
 		in:   "[[ a =~",
 		bash: `1:6: =~ must be followed by a word`,
-		mksh: `1:6: regex tests are a bash feature`,
+		mksh: `1:6: regex tests are a bash/ksh93/zsh feature`,
 	},
 	{
 		in:   "[[ -f a",
@@ -1681,8 +1722,8 @@ var shellTests = []errorCase{
 		// so that users won't think this will work like they expect in
 		// POSIX shell.
 		in:    "echo {var}>foo",
-		posix: `1:6: {varname} redirects are a bash feature #NOERR`,
-		mksh:  `1:6: {varname} redirects are a bash feature #NOERR`,
+		posix: `1:6: {varname} redirects are a bash/ksh93/zsh feature #NOERR`,
+		mksh:  `1:6: {varname} redirects are a bash/ksh93/zsh feature #NOERR`,
 	},
 	{
 		in:    "echo ;&",
@@ -1701,20 +1742,20 @@ var shellTests = []errorCase{
 	},
 	{
 		in:    "for ((i=0; i<5; i++)); do echo; done",
-		posix: `1:5: c-style fors are a bash feature`,
-		mksh:  `1:5: c-style fors are a bash feature`,
+		posix: `1:5: c-style fors are a bash/ksh93/zsh feature`,
+		mksh:  `1:5: c-style fors are a bash/ksh93/zsh feature`,
 	},
 	{
 		in:    "echo !(a)",
-		posix: `1:6: extended globs are a bash/mksh feature`,
+		posix: `1:6: extended globs are a bash/mksh/ksh93 feature`,
 	},
 	{
 		in:    "echo $a@(b)",
-		posix: `1:8: extended globs are a bash/mksh feature`,
+		posix: `1:8: extended globs are a bash/mksh/ksh93 feature`,
 	},
 	{
 		in:    "foo=(1 2)",
-		posix: `1:5: arrays are a bash/mksh feature`,
+		posix: `1:5: arrays are a bash/mksh/ksh93/zsh feature`,
 	},
 	{
 		in:     "a=$c\n'",
@@ -1722,19 +1763,19 @@ var shellTests = []errorCase{
 	},
 	{
 		in:    "echo ${!foo}",
-		posix: `1:8: ${!foo} is a bash/mksh feature`,
+		posix: `1:8: ${!foo} is a bash/mksh/ksh93 feature`,
 	},
 	{
 		in:    "echo ${foo[1]}",
-		posix: `1:11: arrays are a bash/mksh feature`,
+		posix: `1:11: arrays are a bash/mksh/ksh93/zsh feature`,
 	},
 	{
 		in:    "echo ${foo/a/b}",
-		posix: `1:11: search and replace is a bash/mksh feature`,
+		posix: `1:11: search and replace is a bash/mksh/ksh93/zsh feature`,
 	},
 	{
 		in:    "echo ${foo:1}",
-		posix: `1:11: slicing is a bash/mksh feature`,
+		posix: `1:11: slicing is a bash/mksh/ksh93/zsh feature`,
 	},
 	{
 		in:    "echo ${foo,bar}",
@@ -1824,6 +1865,134 @@ func TestParseErrMirBSDKorn(t *testing.T) {
 	}
 }
 
+var ksh93Tests = []struct {
+	in, want string
+}{
+	{"((x = 1.5 * 2))", "((x = 1.5 * 2))"},
+	{"echo $((1.5e+3-2E-2))", "echo $((1.5e+3 - 2E-2))"},
+	{"((x = 0x1e+3))", "((x = 0x1e + 3))"},
+	{"typeset -F3 x=1.5", "typeset -F3 x=1.5"},
+	{".foo.bar=1", ".foo.bar=1"},
+	{"typeset .foo.bar=1", "typeset .foo.bar=1"},
+	{"echo ${.sh.version} ${foo.bar[1]}", "echo ${.sh.version} ${foo.bar[1]}"},
+	{"namespace foo { bar=1; }", "namespace foo { bar=1; }"},
+	{"namespace foo {\nbar=1\n}", "namespace foo {\n\tbar=1\n}"},
+	{"[[ -R x && y =~ z ]]", "[[ -R x && y =~ z ]]"},
+	{"foo |&", "foo |&"},
+	{"echo ${ foo;}", "echo ${ foo;}"},
+	{"diff <(a) >(b)", "diff <(a) >(b)"},
+	{"for ((i = 0; i < 3; i++)); do foo; done", "for ((i = 0; i < 3; i++)); do foo; done"},
+	{"exec {fd}>f", "exec {fd}>f"},
+}
+
+func TestParseKsh93(t *testing.T) {
+	t.Parallel()
+	p := NewParser(Variant(LangKsh93))
+	printer := NewPrinter()
+	for i, tc := range ksh93Tests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			f, err := p.Parse(strings.NewReader(tc.in), "")
+			if err != nil {
+				t.Fatalf("Unexpected error in %q: %v", tc.in, err)
+			}
+			var buf bytes.Buffer
+			if err := printer.Print(&buf, f); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := buf.String(), tc.want+"\n"; got != want {
+				t.Fatalf("want %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+var ksh93ErrTests = []struct {
+	in, want string
+}{
+	{"echo ${..foo}", `1:8: invalid parameter name`},
+	{"echo ${foo.}", `1:8: invalid parameter name`},
+	{"namespace", `1:1: "namespace" must be followed by a name`},
+	{"namespace foo", `1:1: "namespace foo" must be followed by "{"`},
+	{"namespace foo { bar", `1:15: reached EOF without matching { with }`},
+	{"echo ${foo@Q}", `1:11: this expansion operator is a bash/mksh feature`},
+	{"echo ${|foo;}", `1:6: "${|stmts;}" is a mksh feature`},
+	{"echo ${foo^}", `1:11: this expansion operator is a bash feature`},
+	{"echo $((#1))", `1:6: unsigned expressions are a mksh feature`},
+}
+
+func TestParseErrKsh93(t *testing.T) {
+	t.Parallel()
+	p := NewParser(Variant(LangKsh93))
+	for i, tc := range ksh93ErrTests {
+		t.Run(fmt.Sprintf("%03d", i), checkError(p, tc.in, tc.want))
+	}
+}
+
+var zshTests = []struct {
+	in, want string
+}{
+	{"for i (a b) { foo $i; }", "for i in a b; do foo $i; done"},
+	{"for i (a b) do foo; done", "for i in a b; do foo; done"},
+	{"for i in a b; { foo; }", "for i in a b; do foo; done"},
+	{"() { foo $1; } a b", "() { foo $1; } a b"},
+	{"() {\nfoo\n} >/dev/null", "() {\n\tfoo\n} >/dev/null"},
+	{"function { foo; }", "function { foo; }"},
+	{"() { foo; } | bar", "() { foo; } | bar"},
+	{"foo() { bar; }", "foo() { bar; }"},
+	{"(foo)", "(foo)"},
+	{`echo ${(U)foo} ${(j:,:)foo[@]} "${(@)foo}"`, `echo ${(U)foo} ${(j:,:)foo[@]} "${(@)foo}"`},
+	{"echo ${(P)foo:-bar}", "echo ${(P)foo:-bar}"},
+	{"case i in a) foo ;| b) bar ;; esac", "case i in a) foo ;| b) bar ;; esac"},
+	{"declare -A foo=([a]=b)", "declare -A foo=([a]=b)"},
+	{"[[ foo =~ bar ]]", "[[ foo =~ bar ]]"},
+	{"diff <(foo) <(bar)", "diff <(foo) <(bar)"},
+}
+
+func TestParseZsh(t *testing.T) {
+	t.Parallel()
+	p := NewParser(Variant(LangZsh))
+	printer := NewPrinter()
+	for i, tc := range zshTests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			f, err := p.Parse(strings.NewReader(tc.in), "")
+			if err != nil {
+				t.Fatalf("Unexpected error in %q: %v", tc.in, err)
+			}
+			if end := f.Stmts[0].End(); end.Offset() != uint(len(tc.in)) {
+				t.Fatalf("Statement in %q ends at %d", tc.in, end.Offset())
+			}
+			var buf bytes.Buffer
+			if err := printer.Print(&buf, f); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := buf.String(), tc.want+"\n"; got != want {
+				t.Fatalf("want %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+var zshErrTests = []struct {
+	in, want string
+}{
+	{"for i (a", `1:7: reached EOF without matching ( with )`},
+	{"for i (a;) { foo; }", `1:9: word list can only contain words`},
+	{"() foo", `1:1: () must be followed by "{"`},
+	{"function", `1:1: "function" must be followed by a word`},
+	{"echo ${(U", `1:8: reached EOF without matching ( with )`},
+	{"echo ${(U\n)foo}", `1:8: reached newline without matching ( with )`},
+	{"echo ${foo^}", `1:11: this expansion operator is a bash feature`},
+	{"echo ${ foo;}", `1:6: "${ stmts;}" is a mksh feature`},
+}
+
+func TestParseErrZsh(t *testing.T) {
+	t.Parallel()
+	p := NewParser(Variant(LangZsh))
+	for i, tc := range zshErrTests {
+		t.Run(fmt.Sprintf("%03d", i), checkError(p, tc.in, tc.want))
+	}
+}
+
 func TestInputName(t *testing.T) {
 	t.Parallel()
 	in := "("
@@ -1943,6 +2112,532 @@ func TestParseStmtsStopEarly(t *testing.T) {
 	}
 }
 
+func TestParseStmtsRecycles(t *testing.T) {
+	t.Parallel()
+	p := NewParser(KeepComments)
+	printer := NewPrinter()
+	printStmts := func(parse func(io.Reader, func(*Stmt) bool) error, in string) (string, error) {
+		var buf bytes.Buffer
+		err := parse(strings.NewReader(in), func(s *Stmt) bool {
+			if err := printer.Print(&buf, s); err != nil {
+				t.Fatal(err)
+			}
+			buf.WriteString("\n")
+			return true
+		})
+		return buf.String(), err
+	}
+	var inputs []string
+	for _, c := range fileTests {
+		if c.Bash != nil {
+			inputs = append(inputs, c.Strs...)
+		}
+	}
+	for _, c := range shellTests {
+		inputs = append(inputs, c.in)
+	}
+	for _, in := range inputs {
+		want, wantErr := printStmts(p.Stmts, in)
+		got, gotErr := printStmts(p.ParseStmts, in)
+		if fmt.Sprint(wantErr) != fmt.Sprint(gotErr) {
+			t.Errorf("ParseStmts error mismatch in %q:\nwant: %v\ngot:  %v", in, wantErr, gotErr)
+		} else if got != want {
+			t.Errorf("ParseStmts mismatch in %q:\nwant: %q\ngot:  %q", in, want, got)
+		}
+	}
+
+	var first *Stmt
+	in := strings.NewReader(strings.Repeat("foo $bar | baz >out\n", 1000))
+	if err := p.ParseStmts(in, func(s *Stmt) bool {
+		if first == nil {
+			first = s
+		} else if s != first {
+			t.Fatalf("ParseStmts did not reuse the memory of the first statement")
+		}
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// lineReader returns one line per Read call, like a terminal, logging each
+// read.
+type lineReader struct {
+	lines []string
+	log   *[]string
+}
+
+func (l *lineReader) Read(p []byte) (n int, err error) {
+	if len(l.lines) == 0 {
+		return 0, io.EOF
+	}
+	line := l.lines[0]
+	l.lines = l.lines[1:]
+	*l.log = append(*l.log, "read "+strconv.Quote(line))
+	return copy(p, line), nil
+}
+
+var interactiveTests = []struct {
+	in   []string
+	want []string
+}{
+	{
+		[]string{"foo\n", "bar; baz\n"},
+		[]string{
+			"call [] false", `read "foo\n"`,
+			`call ["foo"] false`, `read "bar; baz\n"`,
+			`call ["bar" "baz"] false`,
+		},
+	},
+	{
+		[]string{"foo", "\n"},
+		[]string{
+			"call [] false", `read "foo"`, `read "\n"`,
+			`call ["foo"] false`,
+		},
+	},
+	{
+		[]string{"foo"},
+		[]string{"call [] false", `read "foo"`, `call ["foo"] false`},
+	},
+	{
+		[]string{"\n", "# bar\n"},
+		[]string{
+			"call [] false", `read "\n"`,
+			"call [] false", `read "# bar\n"`,
+			"call [] false",
+		},
+	},
+	{
+		[]string{"if foo; then\n", "bar\n", "fi\n"},
+		[]string{
+			"call [] false", `read "if foo; then\n"`,
+			"call [] true", `read "bar\n"`,
+			"call [] true", `read "fi\n"`,
+			`call ["if foo; then\n\tbar\nfi"] false`,
+		},
+	},
+	{
+		[]string{"echo 'foo\n", "bar'\n"},
+		[]string{
+			"call [] false", `read "echo 'foo\n"`,
+			"call [] true", `read "bar'\n"`,
+			`call ["echo 'foo\nbar'"] false`,
+		},
+	},
+	{
+		[]string{"foo &&\n", "bar\n"},
+		[]string{
+			"call [] false", `read "foo &&\n"`,
+			"call [] true", `read "bar\n"`,
+			`call ["foo &&\n\tbar"] false`,
+		},
+	},
+	{
+		[]string{"foo \\\n", "bar\n"},
+		[]string{
+			"call [] false", `read "foo \\\n"`,
+			"call [] true", `read "bar\n"`,
+			`call ["foo \\\n\tbar"] false`,
+		},
+	},
+	{
+		[]string{"cat <<EOF\n", "foo\n", "EOF\n"},
+		[]string{
+			"call [] false", `read "cat <<EOF\n"`,
+			"call [] true", `read "foo\n"`,
+			"call [] true", `read "EOF\n"`,
+			`call ["cat <<EOF\nfoo\nEOF"] false`,
+		},
+	},
+	{
+		[]string{"foo; if\n"},
+		[]string{
+			"call [] false", `read "foo; if\n"`,
+			`call ["foo"] true`,
+			`1:6: "if <cond>" must be followed by "then"`,
+		},
+	},
+}
+
+func TestParseInteractive(t *testing.T) {
+	t.Parallel()
+	p := NewParser()
+	printer := NewPrinter()
+	for i, c := range interactiveTests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			var log []string
+			lr := &lineReader{c.in, &log}
+			err := p.Interactive(lr, func(stmts []*Stmt, incomplete bool) bool {
+				strs := []string{}
+				for _, s := range stmts {
+					str, err := strPrint(printer, s)
+					if err != nil {
+						t.Fatal(err)
+					}
+					strs = append(strs, str)
+				}
+				log = append(log, fmt.Sprintf("call %q %t", strs, incomplete))
+				return true
+			})
+			if err != nil {
+				log = append(log, err.Error())
+			}
+			if !reflect.DeepEqual(log, c.want) {
+				t.Fatalf("want:\n%s\ngot:\n%s",
+					strings.Join(c.want, "\n"), strings.Join(log, "\n"))
+			}
+		})
+	}
+}
+
+func TestParseInteractiveStopEarly(t *testing.T) {
+	t.Parallel()
+	p := NewParser()
+	var log []string
+	lr := &lineReader{[]string{"foo\n", "if bar; then\n", "baz\n"}, &log}
+	calls := 0
+	err := p.Interactive(lr, func(stmts []*Stmt, incomplete bool) bool {
+		calls++
+		return !incomplete
+	})
+	if err != nil {
+		t.Fatalf("Expected no error: %v", err)
+	}
+	if want := 3; calls != want {
+		t.Fatalf("want %d calls, got %d", want, calls)
+	}
+	if want := 2; len(log) != want {
+		t.Fatalf("want %d reads, got %d", want, len(log))
+	}
+}
+
+func TestAllowInvalidUTF8(t *testing.T) {
+	t.Parallel()
+	p := NewParser(KeepComments, AllowInvalidUTF8)
+	printer := NewPrinter()
+	for i, in := range []string{
+		"echo \x80",
+		"echo foo\x80bar",
+		"echo foo\xc3",
+		"#foo\xc3",
+		"echo '\xff' \"\xfe\"",
+		"foo=\xe9t\xe9",
+		"<<EOF\n\xc8\nEOF",
+		"echo $((foo\x80bar))",
+	} {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			f, err := p.Parse(strings.NewReader(in), "")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var buf bytes.Buffer
+			if err := printer.Print(&buf, f); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := buf.String(), in+"\n"; got != want {
+				t.Fatalf("want %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+var bashCompatTests = []struct {
+	in, want string
+}{
+	{"for i in a b; { echo $i; }", "for i in a b; do echo $i; done"},
+	{"for i { foo; }", "for i; do foo; done"},
+	{"for ((i = 0; i < 2; i++)) { foo; }", "for ((i = 0; i < 2; i++)); do foo; done"},
+	{"for i in a\n{\nfoo\n}", "for i in a; do\n\tfoo\ndone"},
+	{"select i in a; { foo; }", "select i in a; do foo; done"},
+	{"time ! foo", "time ! foo"},
+	{"time -p -- foo | bar", "time -p foo | bar"},
+}
+
+func TestBashCompat(t *testing.T) {
+	t.Parallel()
+	p := NewParser(BashCompat)
+	printer := NewPrinter()
+	for i, tc := range bashCompatTests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			f, err := p.Parse(strings.NewReader(tc.in), "")
+			if err != nil {
+				t.Fatalf("Unexpected error in %q: %v", tc.in, err)
+			}
+			if end := f.Stmts[0].End(); end.Offset() != uint(len(tc.in)) {
+				t.Fatalf("Statement in %q ends at %d", tc.in, end.Offset())
+			}
+			var buf bytes.Buffer
+			if err := printer.Print(&buf, f); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := buf.String(), tc.want+"\n"; got != want {
+				t.Fatalf("want %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+// bashTestsEnv may be set to the tests directory of the Bash source
+// distribution, whose scripts are then parsed by TestBashCompatCorpus too.
+const bashTestsEnv = "SH_BASH_TESTS"
+
+// TestBashCompatCorpus parses the scripts in testdata/bashcompat with
+// BashCompat, checking that printing them is idempotent. The scripts in
+// $SH_BASH_TESTS, if set, are parsed as well, and those that fail to parse
+// are only logged, as some of them contain syntax errors on purpose.
+func TestBashCompatCorpus(t *testing.T) {
+	t.Parallel()
+	p := NewParser(KeepComments, BashCompat)
+	printer := NewPrinter()
+	paths, err := filepath.Glob(filepath.Join("testdata", "bashcompat", "*.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no scripts found in testdata/bashcompat")
+	}
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			bs, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, err := p.Parse(bytes.NewReader(bs), path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := printer.Print(&buf, f); err != nil {
+				t.Fatal(err)
+			}
+			want := buf.String()
+			f2, err := p.Parse(&buf, "")
+			if err != nil {
+				t.Fatalf("printed form cannot be parsed: %v", err)
+			}
+			got, err := strPrint(printer, f2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Fatalf("printed form not idempotent:\n%s", got)
+			}
+		})
+	}
+	dir := os.Getenv(bashTestsEnv)
+	if dir == "" {
+		return
+	}
+	var extra []string
+	for _, pattern := range []string{"*.tests", "*.sub"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			t.Fatal(err)
+		}
+		extra = append(extra, matches...)
+	}
+	failed := 0
+	for _, path := range extra {
+		bs, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := p.Parse(bytes.NewReader(bs), path); err != nil {
+			t.Logf("%v", err)
+			failed++
+		}
+	}
+	t.Logf("parsed %d of %d scripts in %s", len(extra)-failed, len(extra), dir)
+}
+
+var shellOptionsTests = []struct {
+	in, want string
+}{
+	{"echo @(a)", "1:7: a command can only contain words and redirects"},
+	{"shopt -s extglob\necho @(a)", ""},
+	{"shopt -s nullglob extglob\necho a@(b) !(c)", ""},
+	{"shopt -s extglob; echo @(a)", "1:25: a command can only contain words and redirects"},
+	{"shopt -s extglob\nshopt -u extglob\necho @(a)", "3:7: a command can only contain words and redirects"},
+	{"shopt -q extglob\necho @(a)", "2:7: a command can only contain words and redirects"},
+	{"f() { shopt -s extglob; }\necho @(a)", "2:7: a command can only contain words and redirects"},
+	{"[[ a == @(a|b) ]]", ""},
+	{"echo a*b ?c +d 'e@(f)'", ""},
+}
+
+func TestFollowShellOptions(t *testing.T) {
+	t.Parallel()
+	p := NewParser(FollowShellOptions)
+	for i, tc := range shellOptionsTests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			_, err := p.Parse(strings.NewReader(tc.in), "")
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tc.want {
+				t.Fatalf("error mismatch in %q\nwant: %q\ngot:  %q", tc.in, tc.want, got)
+			}
+		})
+	}
+}
+
+var parseTrapsTests = []struct {
+	in   string
+	want []string
+}{
+	{"trap cleanup EXIT", []string{"1:6 cleanup"}},
+	{`trap 'cleanup; rm -f "$tmp"' EXIT INT`, []string{"1:7 cleanup;", `1:16 rm -f "$tmp"`}},
+	{`echo; trap -- "echo bye" 0`, []string{"1:16 echo bye"}},
+	{"trap 'a\n\tb' EXIT", []string{"1:7 a", "2:2 b"}},
+	{"f() {\n\ttrap 'trap \"echo x\" ERR' EXIT\n}", []string{"2:8 trap \"echo x\" ERR"}},
+	{"trap EXIT", nil},
+	{"trap - EXIT", nil},
+	{"trap '' INT", nil},
+	{"trap -p EXIT", nil},
+	{`trap "$cleanup" EXIT`, nil},
+	{`trap "echo \$tmp" EXIT`, []string{`1:7 echo \$tmp`}},
+	{"trap 'if' EXIT", nil},
+	{"echo 'foo' EXIT", nil},
+}
+
+func TestParseTraps(t *testing.T) {
+	t.Parallel()
+	p := NewParser(ParseTraps)
+	for i, tc := range parseTrapsTests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			f, err := p.Parse(strings.NewReader(tc.in), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			Walk(f, func(node Node) bool {
+				ce, ok := node.(*CallExpr)
+				if !ok || ce.Handler == nil {
+					return true
+				}
+				for _, st := range ce.Handler.Stmts {
+					src := tc.in[st.Pos().Offset():st.End().Offset()]
+					got = append(got, fmt.Sprintf("%s %s", st.Pos(), src))
+				}
+				return false
+			})
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+	f, err := NewParser().Parse(strings.NewReader("trap cleanup EXIT"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ce := f.Stmts[0].Cmd.(*CallExpr); ce.Handler != nil {
+		t.Fatalf("handler parsed without the ParseTraps option")
+	}
+}
+
+var parseScriptArgsTests = []struct {
+	in   string
+	want []string
+}{
+	{"sh -c 'cd /tmp && ls'", []string{"1:8 cd /tmp && ls"}},
+	{"/bin/sh -c ls", []string{"1:12 ls"}},
+	{`bash -ec "echo \"\$1\"" _ x`, []string{`1:11 echo \"\$1\"`}},
+	{"bash -o pipefail -c 'a | b'", []string{"1:22 a | b"}},
+	{"sh -c 'a\nb'", []string{"1:8 a", "2:1 b"}},
+	{"sh -c \"echo a\\\nb\"", []string{"1:8 echo a\\\nb"}},
+	{`sh -c 'echo '"$0"`, nil},
+	{`sh -c 'echo '\''a b'\'`, []string{`1:8 echo '\''a b'\'`}},
+	{"xargs -0 -I {} sh -c 'echo {}'", []string{"1:23 echo {}"}},
+	{"sudo -u root bash -c id", []string{"1:22 id"}},
+	{"env -u X FOO=1 bash -c 'echo $FOO'", []string{"1:25 echo $FOO"}},
+	{"timeout 5 sh -c 'sleep 1'", []string{"1:18 sleep 1"}},
+	{"ssh -p 22 host 'uptime; df -h'", []string{"1:17 uptime;", "1:25 df -h"}},
+	{"ssh host ls -l /tmp", []string{"1:10 ls -l /tmp"}},
+	{`ssh host "sh -c 'ls'"`, []string{"1:11 sh -c 'ls'", "1:18 ls"}},
+	{"ssh host", nil},
+	{"sh script.sh", nil},
+	{"sh -c", nil},
+	{`sh -c "$cmd"`, nil},
+	{"sh -c 'echo *'", []string{"1:8 echo *"}},
+	{"sh -c echo*", nil},
+	{"echo -c ls", nil},
+	{"sh -c 'if'", nil},
+	{"eval 'a=1; b=2'", []string{"1:7 a=1;", "1:12 b=2"}},
+	{`eval echo '$x' "\$y"`, []string{`1:6 echo '$x' "\$y`}},
+	{"builtin eval -- foo", []string{"1:17 foo"}},
+	{`eval "$(ssh-agent)"`, nil},
+	{`eval echo "$x"`, nil},
+	{"eval", nil},
+}
+
+func TestParseScriptArgs(t *testing.T) {
+	t.Parallel()
+	p := NewParser(ParseScriptArgs)
+	for i, tc := range parseScriptArgsTests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			f, err := p.Parse(strings.NewReader(tc.in), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			Walk(f, func(node Node) bool {
+				ce, ok := node.(*CallExpr)
+				if !ok || ce.Script == nil {
+					return true
+				}
+				for _, st := range ce.Script.Stmts {
+					src := tc.in[st.Pos().Offset():st.End().Offset()]
+					got = append(got, fmt.Sprintf("%s %s", st.Pos(), src))
+				}
+				return true
+			})
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+var terminatorTests = []struct {
+	in   string
+	want []StmtTerminator
+}{
+	{"foo", []StmtTerminator{TermNone}},
+	{"foo\n", []StmtTerminator{TermNewline}},
+	{"foo # bar\n", []StmtTerminator{TermNewline}},
+	{"foo; bar &", []StmtTerminator{TermSemicolon, TermBackground}},
+	{"foo;\nbar\n", []StmtTerminator{TermSemicolon, TermNewline}},
+	{"foo && bar || baz", []StmtTerminator{TermNone, TermOrStmt, TermAndStmt, TermNone, TermNone}},
+	{"foo | bar", []StmtTerminator{TermNone, TermPipe, TermNone}},
+	{"foo |& bar", []StmtTerminator{TermNone, TermPipeAll, TermNone}},
+	{"{ foo; bar\n}", []StmtTerminator{TermNone, TermSemicolon, TermNewline}},
+	{"if foo; then bar; fi", []StmtTerminator{TermNone, TermSemicolon, TermSemicolon}},
+}
+
+func TestStmtTerminator(t *testing.T) {
+	t.Parallel()
+	p := NewParser()
+	for i, tc := range terminatorTests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			f, err := p.Parse(strings.NewReader(tc.in), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []StmtTerminator
+			Walk(f, func(node Node) bool {
+				if s, ok := node.(*Stmt); ok {
+					got = append(got, s.Terminator)
+				}
+				return true
+			})
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
 var stopAtTests = []struct {
 	in   string
 	stop string
@@ -1994,3 +2689,147 @@ func TestParseStmtsStopAt(t *testing.T) {
 		t.Run(fmt.Sprintf("%02d", i), singleParse(p, c.in, want))
 	}
 }
+
+var lazyWordsTests = []struct {
+	in   string
+	want []string
+}{
+	{"echo foo bar", []string{`1:1 echo "foo" "bar"`}},
+	{`echo "$x" foo$y '*' -`, []string{`1:1 echo 1:6-1:10 1:11-1:16 1:17-1:20 "-"`}},
+	{`"$cmd" $(a; b) | c "$(d)"`, []string{`1:1 "$cmd" 1:8-1:15`, `1:18 c 1:20-1:26`}},
+	{"a $((1 + 2))\nx=$y b ${z}", []string{"1:1 a 1:3-1:13", "2:1 b 2:8-2:12"}},
+	{"if a `b`; then\n\tc <<EOF ${d}\n$x\nEOF\nfi", []string{"1:4 a 1:6-1:9", "2:2 c 2:10-2:14"}},
+	{"a $(b \"$(c d)\") e", []string{`1:1 a 1:3-1:16 "e"`}},
+}
+
+func TestLazyWords(t *testing.T) {
+	t.Parallel()
+	p := NewParser(LazyWords, KeepComments)
+	for i, tc := range lazyWordsTests {
+		t.Run(fmt.Sprintf("%02d", i), func(t *testing.T) {
+			f, err := p.Parse(strings.NewReader(tc.in), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := Check(f); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			Walk(f, func(node Node) bool {
+				ce, ok := node.(*CallExpr)
+				if !ok {
+					return true
+				}
+				fields := []string{ce.Pos().String()}
+				for i, arg := range ce.Args {
+					lit, ok := arg.Parts[0].(*Lit)
+					switch {
+					case i == 0:
+						fields = append(fields, tc.in[arg.Pos().Offset():arg.End().Offset()])
+					case ok && len(arg.Parts) == 1 && lit.Value == "":
+						fields = append(fields, fmt.Sprintf("%s-%s", arg.Pos(), arg.End()))
+					default:
+						fields = append(fields, fmt.Sprintf("%q", arg.Lit()))
+					}
+				}
+				got = append(got, strings.Join(fields, " "))
+				return true
+			})
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("LazyWords mismatch in %q:\nwant: %q\ngot:  %q", tc.in, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestLazyWordsSameErrors(t *testing.T) {
+	t.Parallel()
+	p := NewParser()
+	lazy := NewParser(LazyWords)
+	var inputs []string
+	for _, c := range append(fileTests, fileTestsNoPrint...) {
+		inputs = append(inputs, c.Strs...)
+	}
+	for _, c := range shellTests {
+		inputs = append(inputs, c.in)
+	}
+	for _, in := range inputs {
+		f, err := p.Parse(strings.NewReader(in), "")
+		lf, lerr := lazy.Parse(strings.NewReader(in), "")
+		if fmt.Sprint(err) != fmt.Sprint(lerr) {
+			t.Errorf("LazyWords error mismatch in %q:\nwant: %v\ngot:  %v", in, err, lerr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if len(f.Stmts) != len(lf.Stmts) {
+			t.Errorf("LazyWords found %d statements in %q, want %d", len(lf.Stmts), in, len(f.Stmts))
+			continue
+		}
+		for i, st := range f.Stmts {
+			if lst := lf.Stmts[i]; st.Pos() != lst.Pos() || st.End() != lst.End() {
+				t.Errorf("LazyWords statement mismatch in %q:\nwant: %s-%s\ngot:  %s-%s",
+					in, st.Pos(), st.End(), lst.Pos(), lst.End())
+			}
+		}
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	t.Parallel()
+	p := NewParser(KeepComments)
+	inputs := []string{
+		"foo \\\nbar",
+		"foo\r\nbar # baz\r\n",
+		"'foo\r\nbar' \"\\\nbaz\"",
+		"echo `foo \\`bar\\``",
+		"cat <<EOF\nfoo\r\nbar\\\nbaz\nEOF",
+		"échò 'ñ' \xff",
+	}
+	for _, c := range append(fileTests, fileTestsNoPrint...) {
+		inputs = append(inputs, c.Strs...)
+	}
+	for _, c := range shellTests {
+		inputs = append(inputs, c.in)
+	}
+	for _, in := range inputs {
+		want, wantErr := p.Parse(strings.NewReader(in), "")
+		got, gotErr := p.ParseBytes([]byte(in), "")
+		if fmt.Sprint(wantErr) != fmt.Sprint(gotErr) {
+			t.Errorf("ParseBytes error mismatch in %q:\nwant: %v\ngot:  %v", in, wantErr, gotErr)
+			continue
+		}
+		if wantErr != nil {
+			continue
+		}
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("ParseBytes mismatch in %q:\n%s", in, strings.Join(pretty.Diff(want, got), "\n"))
+			continue
+		}
+		CopyStrings(got)
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("CopyStrings modified the program in %q", in)
+		}
+	}
+}
+
+func TestParseBytesAllocs(t *testing.T) {
+	p := NewParser()
+	src := strings.Repeat("foo bar 'baz'\n", 50)
+	allocs := testing.AllocsPerRun(10, func() {
+		if _, err := p.Parse(strings.NewReader(src), ""); err != nil {
+			t.Fatal(err)
+		}
+	})
+	bsrc := []byte(src)
+	bytesAllocs := testing.AllocsPerRun(10, func() {
+		if _, err := p.ParseBytes(bsrc, ""); err != nil {
+			t.Fatal(err)
+		}
+	})
+	// one string per literal, minus the single copy of the source
+	if want := allocs - 149; bytesAllocs > want {
+		t.Fatalf("ParseBytes made %v allocations, want at most %v", bytesAllocs, want)
+	}
+}
@@ -39,6 +39,9 @@ func charClass(s string) (string, error) {
 //
 // For example, TranslatePattern(`foo*bar?`, true) returns `foo.*bar.`.
 //
+// Ranges like [a-z] match by code point, and character classes like
+// [[:alpha:]] only match ASCII characters, as in the C locale.
+//
 // Note that this function (and QuotePattern) should not be directly
 // used with file paths if Windows is supported, as the path separator
 // on that platform is the same character as the escaping character for
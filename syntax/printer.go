@@ -5,8 +5,11 @@ package syntax
 
 import (
 	"bufio"
+	"bytes"
+	"fmt"
 	"io"
 	"strings"
+	"sync"
 	"unicode"
 )
 
@@ -42,46 +45,167 @@ func KeepPadding(p *Printer) {
 	p.bufWriter = &p.cols
 }
 
+// KeepTerminators will keep statements ending with a semicolon, an
+// ampersand, or mksh's '|&' on the same line as the statements that
+// followed them in the original source, instead of splitting them into
+// separate lines. Semicolons before a newline or comment are kept too.
+func KeepTerminators(p *Printer) { p.keepTerminators = true }
+
+// CRLF will print "\r\n" line endings instead of "\n", such as for scripts
+// edited on Windows. This includes the newlines within heredocs and
+// literals, which the parser reads from "\r\n" as "\n".
+func CRLF(p *Printer) { p.crlf = true }
+
 // Minify will print programs in a way to save the most bytes possible.
 // For example, indentation and comments are skipped, and extra
 // whitespace is avoided when possible.
 func Minify(p *Printer) { p.minify = true }
 
+// EmbeddedFormatter sets the function used to format the bodies of
+// heredocs in an embedded language, such as SQL or Python. Any number of
+// languages may be set, each with its own function.
+//
+// The language of a heredoc is its delimiter in lower case, without an "EO"
+// prefix or an "EOF" suffix, so that both <<'SQL' and <<EOSQL are "sql".
+// Only bodies without expansions are formatted, and only if their
+// delimiter is quoted or they have no backslashes.
+//
+// If fn returns an error, or a body which would end the heredoc early, the
+// original body is kept. The bodies of other heredocs are always printed
+// as they were parsed.
+func EmbeddedFormatter(lang string, fn func(body string) (string, error)) func(*Printer) {
+	return func(p *Printer) {
+		if p.embedded == nil {
+			p.embedded = make(map[string]func(string) (string, error))
+		}
+		p.embedded[lang] = fn
+	}
+}
+
 // NewPrinter allocates a new Printer and applies any number of options.
 func NewPrinter(options ...func(*Printer)) *Printer {
-	p := &Printer{
-		bufWriter:   bufio.NewWriter(nil),
-		lenPrinter:  new(Printer),
-		tabsPrinter: new(Printer),
-	}
-	for _, opt := range options {
-		opt(p)
+	return &Printer{opts: options, states: new(sync.Pool)}
+}
+
+// state returns a reset printer, with the options of p, to do the work of a
+// single call to Print or FprintStmts. Since p itself is never modified, it
+// can be used concurrently.
+func (p *Printer) state() *Printer {
+	s, _ := p.states.Get().(*Printer)
+	if s == nil {
+		s = &Printer{
+			bufWriter:   bufio.NewWriter(nil),
+			lenPrinter:  new(Printer),
+			tabsPrinter: new(Printer),
+		}
+		for _, opt := range p.opts {
+			opt(s)
+		}
 	}
-	return p
+	s.reset()
+	return s
+}
+
+// release puts a printer obtained via state back in the pool, dropping its
+// references to the output and the printed nodes.
+func (p *Printer) release(s *Printer) {
+	s.bufWriter.Reset(nil)
+	s.crlfOut.w = nil
+	s.pendingComments = s.pendingComments[:0]
+	s.pendingHdocs = s.pendingHdocs[:0]
+	p.states.Put(s)
 }
 
 // Print "pretty-prints" the given syntax tree node to the given writer. Writes
 // to w are buffered.
 //
 // The node types supported at the moment are *File, *Stmt, *Word, and any
-// Command node. A trailing newline will only be printed when a *File is used.
+// Command node. A trailing newline will only be printed when a *File is used,
+// unless it has no statements nor comments to print, such as when the file is
+// empty or only contains blank lines.
+//
+// Printing is idempotent with any set of options; parsing a program that
+// Print produced, with comments kept, and printing it again with the same
+// options reproduces it byte for byte, including comments, heredocs and
+// blank lines. This means that already formatted source is left untouched.
+// The only exception is a backslash at the very end of the input, such as
+// in "foo\\", which becomes a line continuation once a trailing newline is
+// printed after it. As with shells, it is then dropped when parsing again.
+//
+// Print can be called many times, including concurrently from multiple
+// goroutines.
 func (p *Printer) Print(w io.Writer, node Node) error {
-	p.reset()
-	p.bufWriter.Reset(w)
+	s := p.state()
+	defer p.release(s)
+	if s.crlf {
+		s.crlfOut.w = w
+		w = &s.crlfOut
+	}
+	s.bufWriter.Reset(w)
 	switch x := node.(type) {
 	case *File:
-		p.stmtList(x.StmtList)
-		p.newline(x.End())
+		s.stmtList(x.StmtList)
+		if len(x.Stmts) > 0 || (len(x.Last) > 0 && !s.minify) {
+			s.newline(x.End())
+		}
 	case *Stmt:
-		p.stmtList(StmtList{Stmts: []*Stmt{x}})
+		s.stmtList(StmtList{Stmts: []*Stmt{x}})
 	case *Word:
-		p.word(x)
+		s.word(x)
 	case Command:
-		p.command(x, nil)
+		s.command(x, nil)
 	}
-	p.flushHeredocs()
-	p.flushComments()
-	return p.bufWriter.Flush()
+	s.flushHeredocs()
+	s.flushComments()
+	return s.bufWriter.Flush()
+}
+
+// FprintStmts prints the given statements on a single line, such as for
+// a Makefile recipe or the argument of "sh -c". If p is nil, a Printer with
+// the default options is used.
+//
+// Statements are separated by semicolons, and always kept on the same line
+// regardless of the printer's options and the original positions. As such,
+// comments are not printed. Heredocs and literals containing newlines, such
+// as 'a<newline>b', cannot be printed on a single line, so they result in
+// an error.
+func FprintStmts(w io.Writer, stmts []*Stmt, p *Printer) error {
+	for _, s := range stmts {
+		var err error
+		Walk(s, func(node Node) bool {
+			switch x := node.(type) {
+			case *Redirect:
+				if x.Op == Hdoc || x.Op == DashHdoc {
+					err = fmt.Errorf("%s: heredocs cannot be printed on a single line",
+						x.Pos())
+				}
+			case *Lit:
+				if strings.Contains(x.Value, "\n") {
+					err = fmt.Errorf("%s: multi-line literals cannot be printed on a single line",
+						x.Pos())
+				}
+			case *SglQuoted:
+				if strings.Contains(x.Value, "\n") {
+					err = fmt.Errorf("%s: multi-line literals cannot be printed on a single line",
+						x.Pos())
+				}
+			}
+			return err == nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if p == nil {
+		p = NewPrinter()
+	}
+	s := p.state()
+	defer p.release(s)
+	s.bufWriter.Reset(w)
+	s.singleLine = true
+	s.stmtList(StmtList{Stmts: stmts})
+	s.singleLine = false
+	return s.bufWriter.Flush()
 }
 
 type bufWriter interface {
@@ -91,6 +215,26 @@ type bufWriter interface {
 	Flush() error
 }
 
+// crlfWriter writes to w, replacing each "\n" with "\r\n".
+type crlfWriter struct {
+	w   io.Writer
+	buf []byte
+}
+
+func (c *crlfWriter) Write(p []byte) (int, error) {
+	c.buf = c.buf[:0]
+	for _, b := range p {
+		if b == '\n' {
+			c.buf = append(c.buf, '\r')
+		}
+		c.buf = append(c.buf, b)
+	}
+	if _, err := c.w.Write(c.buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
 type colCounter struct {
 	*bufio.Writer
 	column int
@@ -106,8 +250,9 @@ func (c *colCounter) WriteByte(b byte) error {
 }
 
 func (c *colCounter) WriteString(s string) (int, error) {
-	for _, r := range s {
-		if r == '\n' {
+	// count bytes, as the columns in Pos do
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\n' {
 			c.column = 1
 		} else {
 			c.column++
@@ -121,18 +266,34 @@ func (c *colCounter) Reset(w io.Writer) {
 	c.Writer.Reset(w)
 }
 
-// Printer holds the internal state of the printing mechanism of a
+// Printer holds the options to print programs with. It is safe for
+// concurrent use, as each call to Print or FprintStmts uses its own state.
+//
+// Internally, the same type holds the state of the printing mechanism of a
 // program.
 type Printer struct {
-	bufWriter
-	cols colCounter
+	// opts are the options given to NewPrinter, to build new states.
+	opts []func(*Printer)
+	// states holds idle printer states, which are only ever used by one
+	// goroutine at a time.
+	states *sync.Pool
 
-	indentSpaces   uint
-	binNextLine    bool
-	swtCaseIndent  bool
-	spaceRedirects bool
-	keepPadding    bool
-	minify         bool
+	bufWriter
+	cols    colCounter
+	crlfOut crlfWriter
+
+	indentSpaces    uint
+	binNextLine     bool
+	swtCaseIndent   bool
+	spaceRedirects  bool
+	keepPadding     bool
+	keepTerminators bool
+	crlf            bool
+	minify          bool
+
+	// singleLine is set by FprintStmts to print everything on a single
+	// line.
+	singleLine bool
 
 	wantSpace   bool
 	wantNewline bool
@@ -165,6 +326,9 @@ type Printer struct {
 	// pendingHdocs is the list of pending heredocs to write.
 	pendingHdocs []*Redirect
 
+	// embedded holds the formatters of heredoc bodies, by language.
+	embedded map[string]func(string) (string, error)
+
 	// used in stmtCols to align comments
 	lenPrinter *Printer
 	lenCounter byteCounter
@@ -204,7 +368,7 @@ func (p *Printer) spacePad(pos Pos) {
 		p.WriteByte(' ')
 		p.wantSpace = false
 	}
-	for p.cols.column > 0 && p.cols.column < int(pos.col) {
+	for !p.singleLine && p.cols.column > 0 && p.cols.column < int(pos.col) {
 		p.WriteByte(' ')
 	}
 }
@@ -213,6 +377,9 @@ func (p *Printer) bslashNewl() {
 	if p.wantSpace {
 		p.space()
 	}
+	if p.singleLine {
+		return
+	}
 	p.WriteString("\\\n")
 	p.line++
 	p.indent()
@@ -272,7 +439,7 @@ func (p *Printer) decLevel() {
 }
 
 func (p *Printer) indent() {
-	if p.minify {
+	if p.minify || p.singleLine {
 		return
 	}
 	p.lastLevel = p.level
@@ -288,6 +455,17 @@ func (p *Printer) indent() {
 }
 
 func (p *Printer) newline(pos Pos) {
+	if p.singleLine {
+		// a newline after a statement is a separator
+		if p.wantNewline && !p.wroteSemi {
+			p.WriteByte(';')
+		}
+		if !p.minify {
+			p.WriteByte(' ')
+		}
+		p.wantNewline, p.wantSpace = false, false
+		return
+	}
 	p.flushHeredocs()
 	p.flushComments()
 	p.WriteByte('\n')
@@ -325,9 +503,10 @@ func (p *Printer) flushHeredocs() {
 		p.line++
 		p.WriteByte('\n')
 		p.wantNewline, p.wantSpace = false, false
+		hdoc := p.heredocBody(r)
 		if r.Op == DashHdoc && p.indentSpaces == 0 &&
 			!p.minify && p.tabsPrinter != nil {
-			if r.Hdoc != nil {
+			if hdoc != nil {
 				extra := extraIndenter{
 					bufWriter: p.bufWriter,
 					afterNewl: true,
@@ -336,16 +515,16 @@ func (p *Printer) flushHeredocs() {
 				*p.tabsPrinter = Printer{
 					bufWriter: &extra,
 				}
-				p.tabsPrinter.line = r.Hdoc.Pos().Line()
-				p.tabsPrinter.word(r.Hdoc)
+				p.tabsPrinter.line = hdoc.Pos().Line()
+				p.tabsPrinter.word(hdoc)
 				p.indent()
-				p.line = r.Hdoc.End().Line()
+				p.line = hdoc.End().Line()
 			} else {
 				p.indent()
 			}
-		} else if r.Hdoc != nil {
-			p.word(r.Hdoc)
-			p.line = r.Hdoc.End().Line()
+		} else if hdoc != nil {
+			p.word(hdoc)
+			p.line = hdoc.End().Line()
 		}
 		p.unquotedWord(r.Word)
 		p.wantSpace = false
@@ -354,7 +533,70 @@ func (p *Printer) flushHeredocs() {
 	p.pendingComments = coms
 }
 
+// heredocBody returns the body of a heredoc to print, formatted if it is
+// in an embedded language; see EmbeddedFormatter.
+func (p *Printer) heredocBody(r *Redirect) *Word {
+	if len(p.embedded) == 0 || r.Hdoc == nil || len(r.Hdoc.Parts) != 1 {
+		return r.Hdoc
+	}
+	lit, ok := r.Hdoc.Parts[0].(*Lit)
+	if !ok {
+		return r.Hdoc // has expansions
+	}
+	var buf bytes.Buffer
+	quoted := false
+	for _, wp := range r.Word.Parts {
+		if unquotedWordPart(&buf, wp, false) {
+			quoted = true
+		}
+	}
+	delim := buf.String()
+	if !quoted && strings.ContainsRune(lit.Value, '\\') {
+		return r.Hdoc
+	}
+	fn := p.embedded[heredocLang(delim)]
+	if fn == nil {
+		return r.Hdoc
+	}
+	body, err := fn(lit.Value)
+	if err != nil {
+		return r.Hdoc
+	}
+	if body != "" && !strings.HasSuffix(body, "\n") {
+		body += "\n"
+	}
+	for _, line := range strings.Split(body, "\n") {
+		if line == delim || (r.Op == DashHdoc && strings.TrimLeft(line, "\t") == delim) {
+			return r.Hdoc
+		}
+	}
+	return &Word{Parts: []WordPart{&Lit{
+		ValuePos: lit.ValuePos,
+		ValueEnd: lit.ValueEnd,
+		Value:    body,
+	}}}
+}
+
+// heredocLang returns the embedded language of a heredoc delimiter.
+func heredocLang(delim string) string {
+	lang := strings.ToLower(delim)
+	if len(lang) > 3 {
+		lang = strings.TrimSuffix(lang, "eof")
+		lang = strings.TrimSuffix(lang, "_")
+	}
+	if len(lang) > 2 && strings.HasPrefix(lang, "eo") {
+		lang = lang[2:]
+	}
+	return lang
+}
+
 func (p *Printer) newlines(pos Pos) {
+	if p.singleLine {
+		if p.wantNewline {
+			p.newline(pos)
+		}
+		return
+	}
 	if p.firstLine && len(p.pendingComments) == 0 {
 		p.firstLine = false
 		return // no empty lines at the top
@@ -374,7 +616,10 @@ func (p *Printer) newlines(pos Pos) {
 }
 
 func (p *Printer) rightParen(pos Pos) {
-	if !p.minify {
+	if p.singleLine {
+		// the closing parenthesis already ends the statements
+		p.wantNewline = false
+	} else if !p.minify {
 		p.newlines(pos)
 	}
 	p.WriteByte(')')
@@ -382,7 +627,7 @@ func (p *Printer) rightParen(pos Pos) {
 }
 
 func (p *Printer) semiRsrv(s string, pos Pos) {
-	if p.wantNewline || pos.Line() > p.line {
+	if p.wantNewline || (!p.singleLine && pos.Line() > p.line) {
 		p.newlines(pos)
 	} else {
 		if !p.wroteSemi {
@@ -397,7 +642,7 @@ func (p *Printer) semiRsrv(s string, pos Pos) {
 }
 
 func (p *Printer) comment(c Comment) {
-	if p.minify {
+	if p.minify || p.singleLine {
 		return
 	}
 	p.pendingComments = append(p.pendingComments, c)
@@ -435,7 +680,7 @@ func (p *Printer) flushComments() {
 }
 
 func (p *Printer) comments(cs []Comment) {
-	if p.minify {
+	if p.minify || p.singleLine {
 		return
 	}
 	p.pendingComments = append(p.pendingComments, cs...)
@@ -483,6 +728,13 @@ func (p *Printer) wordPart(wp, next WordPart) {
 			p.WriteString("$(")
 			p.wantSpace = len(x.Stmts) > 0 && startsWithLparen(x.Stmts[0])
 			p.nestedStmts(x.StmtList, x.Right)
+			if n := len(x.Stmts); n > 0 && len(x.Last) == 0 &&
+				x.Stmts[n-1].End().Line() == x.Right.Line() {
+				// the last statement ended with a literal spanning
+				// multiple lines, like a line continuation within
+				// backquotes
+				p.line = x.Right.Line()
+			}
 			p.rightParen(x.Right)
 		}
 	case *ParamExp:
@@ -493,7 +745,7 @@ func (p *Printer) wordPart(wp, next WordPart) {
 		name := x.Param.Value
 		switch {
 		case !p.minify:
-		case x.Excl, x.Length, x.Width:
+		case x.Excl, x.Length, x.Width, x.Flags != nil:
 		case x.Index != nil, x.Slice != nil:
 		case x.Repl != nil, x.Exp != nil:
 		case len(name) > 1 && !ValidName(name): // ${10}
@@ -562,6 +814,11 @@ func (p *Printer) paramExp(pe *ParamExp) {
 	}
 	// ${var...}
 	p.WriteString("${")
+	if pe.Flags != nil {
+		p.WriteByte('(')
+		p.WriteString(pe.Flags.Value)
+		p.WriteByte(')')
+	}
 	switch {
 	case pe.Length:
 		p.WriteByte('#')
@@ -766,7 +1023,7 @@ func (p *Printer) elemJoin(elems []*ArrayElem, last []Comment) {
 			}
 			p.comment(c)
 		}
-		if el.Pos().Line() > p.line {
+		if !p.singleLine && el.Pos().Line() > p.line {
 			p.newline(el.Pos())
 			p.indent()
 		} else if p.wantSpace {
@@ -819,10 +1076,13 @@ func (p *Printer) stmt(s *Stmt) {
 		}
 	}
 	switch {
-	case s.Semicolon.IsValid() && s.Semicolon.Line() > p.line:
+	case !p.singleLine && s.Semicolon.IsValid() && s.Semicolon.Line() > p.line:
 		p.bslashNewl()
 		p.WriteByte(';')
 		p.wroteSemi = true
+	case p.keepTerminators && s.Terminator == TermSemicolon:
+		p.WriteByte(';')
+		p.wroteSemi = true
 	case s.Background:
 		if !p.minify {
 			p.space()
@@ -834,6 +1094,11 @@ func (p *Printer) stmt(s *Stmt) {
 		}
 		p.WriteString("|&")
 	}
+	if p.singleLine && (s.Background || s.Coprocess) {
+		// the operator already separates this statement
+		p.wroteSemi = true
+		p.wantSpace = !p.minify
+	}
 	p.decLevel()
 }
 
@@ -904,7 +1169,7 @@ func (p *Printer) command(cmd Command, redirs []*Redirect) (startRedirs int) {
 		p.semiRsrv("done", x.DonePos)
 	case *BinaryCmd:
 		p.stmt(x.X)
-		if p.minify || x.Y.Pos().Line() <= p.line {
+		if p.minify || p.singleLine || x.Y.Pos().Line() <= p.line {
 			// leave p.nestedBinary untouched
 			p.spacedToken(x.Op.String(), x.OpPos)
 			p.line = x.Y.Pos().Line()
@@ -924,6 +1189,9 @@ func (p *Printer) command(cmd Command, redirs []*Redirect) (startRedirs int) {
 				p.wantSpace = false
 				p.newline(Pos{})
 				p.indent()
+				// the comments start on this line, even if they
+				// were on a later line in the input
+				p.line = x.Y.Comments[0].Hash.Line()
 				p.comments(x.Y.Comments)
 				p.newline(Pos{})
 				p.indent()
@@ -954,6 +1222,19 @@ func (p *Printer) command(cmd Command, redirs []*Redirect) (startRedirs int) {
 		p.line = x.Body.Pos().Line()
 		p.comments(x.Body.Comments)
 		p.stmt(x.Body)
+	case *AnonFunc:
+		if x.RsrvWord {
+			p.WriteString("function ")
+		} else {
+			p.WriteString("()")
+			if !p.minify {
+				p.space()
+			}
+		}
+		p.line = x.Body.Pos().Line()
+		p.comments(x.Body.Comments)
+		p.stmt(x.Body)
+		p.wordJoin(x.Args)
 	case *CaseClause:
 		p.WriteString("case ")
 		p.word(x.Word)
@@ -971,6 +1252,7 @@ func (p *Printer) command(cmd Command, redirs []*Redirect) (startRedirs int) {
 				p.comment(c)
 			}
 			p.newlines(ci.Pos())
+			p.line = ci.Pos().Line()
 			p.casePatternJoin(ci.Patterns)
 			p.WriteByte(')')
 			p.wantSpace = !p.minify
@@ -979,7 +1261,7 @@ func (p *Printer) command(cmd Command, redirs []*Redirect) (startRedirs int) {
 			p.nestedStmts(ci.StmtList, ci.OpPos)
 			if !p.minify || i != len(x.Items)-1 {
 				p.level++
-				if sep {
+				if sep && !p.singleLine {
 					p.newlines(ci.OpPos)
 					p.wantNewline = true
 				}
@@ -1032,6 +1314,14 @@ func (p *Printer) command(cmd Command, redirs []*Redirect) (startRedirs int) {
 		}
 		p.space()
 		p.stmt(x.Stmt)
+	case *NamespaceClause:
+		p.spacedString("namespace", x.Pos())
+		p.space()
+		p.WriteString(x.Name.Value)
+		p.WriteString(" {")
+		p.wantSpace = true
+		p.nestedStmts(x.StmtList, x.Rbrace)
+		p.semiRsrv("}", x.Rbrace)
 	case *LetClause:
 		p.spacedString("let", x.Pos())
 		for _, n := range x.Exprs {
@@ -1111,7 +1401,7 @@ func (p *Printer) stmtList(sl StmtList) {
 			p.commentPadding = 0
 			p.comments(midComs)
 			p.stmt(s)
-			p.wantNewline = true
+			p.endStmt(sl.Stmts, i)
 			continue
 		}
 		p.comments(midComs)
@@ -1137,8 +1427,10 @@ func (p *Printer) stmtList(sl StmtList) {
 		}
 		if endCom != nil {
 			p.comment(*endCom)
+			p.wantNewline = true
+		} else {
+			p.endStmt(sl.Stmts, i)
 		}
-		p.wantNewline = true
 	}
 	if len(sl.Stmts) == 1 && !sep {
 		p.wantNewline = false
@@ -1146,6 +1438,23 @@ func (p *Printer) stmtList(sl StmtList) {
 	p.comments(sl.Last)
 }
 
+// endStmt prepares for the statement following stmts[i], which goes on a
+// new line unless KeepTerminators is set and it shared the line with
+// stmts[i] in the original source.
+func (p *Printer) endStmt(stmts []*Stmt, i int) {
+	s := stmts[i]
+	switch {
+	case !p.keepTerminators, i+1 == len(stmts):
+	case s.Terminator != TermSemicolon && s.Terminator != TermBackground &&
+		s.Terminator != TermPipeAll:
+	case stmts[i+1].Pos().Line() == s.Semicolon.Line():
+		p.wantNewline = false
+		p.wantSpace = !p.minify
+		return
+	}
+	p.wantNewline = true
+}
+
 type byteCounter int
 
 func (c *byteCounter) WriteByte(b byte) error {
@@ -1212,7 +1521,14 @@ func (p *Printer) stmtCols(s *Stmt) int {
 
 func (p *Printer) nestedStmts(sl StmtList, closing Pos) {
 	p.incLevel()
+	oneLine := false
 	switch {
+	case p.singleLine:
+	case p.keepTerminators && closing.Line() == p.line &&
+		len(p.pendingComments) == 0:
+		// Keep the statements on a single line, as in:
+		//     { stmt; stmt; }
+		oneLine = true
 	case len(sl.Stmts) > 1:
 		// Force a newline if we find:
 		//     { stmt; stmt; }
@@ -1230,6 +1546,9 @@ func (p *Printer) nestedStmts(sl StmtList, closing Pos) {
 		p.wantNewline = true
 	}
 	p.stmtList(sl)
+	if oneLine && len(sl.Last) == 0 {
+		p.wantNewline = false
+	}
 	if closing.IsValid() {
 		p.flushComments()
 	}
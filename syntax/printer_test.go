@@ -9,6 +9,7 @@ import (
 	"io/ioutil"
 	"os"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -387,6 +388,11 @@ var printTests = []printCase{
 	samePrint("\"foo\n$(bar)\""),
 	samePrint("\"foo\\\n$(bar)\""),
 	samePrint("((foo++)) || bar"),
+	samePrint("((a ? b ? 1 : 2 : (c = 3), a <<= 2#101 ** 0x1f))"),
+	{
+		"((a?1,2:3))",
+		"((a ? 1, 2 : 3))",
+	},
 	{
 		"a=b \\\nc=d \\\nfoo",
 		"a=b \\\n\tc=d \\\n\tfoo",
@@ -462,6 +468,46 @@ var printTests = []printCase{
 	samePrint("if foo; then\n\tx\nelse\n\tbar\n\t# comment\nfi"),
 }
 
+func TestPrintEmptyFile(t *testing.T) {
+	t.Parallel()
+	var tests = [...]printCase{
+		{"", ""},
+		{"\n\n", ""},
+		{" \t\n", ""},
+		{"# a", "# a\n"},
+		{"\n# a\n\n", "# a\n"},
+		{"#!/bin/sh\n# Copyright\n\n# License\n", "#!/bin/sh\n# Copyright\n\n# License\n"},
+		{"# a\n\n\n# b\n", "# a\n\n# b\n"},
+	}
+	parser := NewParser(KeepComments)
+	printers := []*Printer{NewPrinter(), NewPrinter(KeepPadding)}
+	for i, tc := range tests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			prog, err := parser.Parse(strings.NewReader(tc.in), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, printer := range printers {
+				got, err := strPrint(printer, prog)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != tc.want {
+					t.Fatalf("Print mismatch:\nin:\n%q\nwant:\n%q\ngot:\n%q",
+						tc.in, tc.want, got)
+				}
+			}
+			got, err := strPrint(NewPrinter(Minify), prog)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != "" {
+				t.Fatalf("Minify should print nothing, got %q", got)
+			}
+		})
+	}
+}
+
 func TestPrintWeirdFormat(t *testing.T) {
 	t.Parallel()
 	parser := NewParser(KeepComments)
@@ -479,6 +525,114 @@ func TestPrintWeirdFormat(t *testing.T) {
 	}
 }
 
+// these are printed in a way that is not stable, as a backslash that
+// isn't followed by a newline ends up followed by one
+var printNotIdempotent = map[string]bool{
+	`\`:         true,
+	`foo\`:      true,
+	"f\\\noo\\": true,
+}
+
+func TestPrintIdempotent(t *testing.T) {
+	t.Parallel()
+	var inputs []string
+	for _, c := range fileTests {
+		inputs = append(inputs, c.Strs...)
+	}
+	for _, tc := range printTests {
+		inputs = append(inputs, tc.in)
+	}
+	parser := NewParser(KeepComments)
+	printers := []*Printer{
+		NewPrinter(),
+		NewPrinter(Indent(4)),
+		NewPrinter(BinaryNextLine),
+		NewPrinter(SwitchCaseIndent),
+		NewPrinter(SpaceRedirects),
+		NewPrinter(KeepPadding),
+		NewPrinter(KeepTerminators),
+		NewPrinter(CRLF),
+		NewPrinter(Minify),
+	}
+	for i, in := range inputs {
+		if printNotIdempotent[in] {
+			continue
+		}
+		prog, err := parser.Parse(strings.NewReader(in), "")
+		if err != nil {
+			continue // not valid bash
+		}
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			for _, printer := range printers {
+				once, err := strPrint(printer, prog)
+				if err != nil {
+					t.Fatal(err)
+				}
+				prog2, err := parser.Parse(strings.NewReader(once), "")
+				if err != nil {
+					t.Fatalf("Result is not valid shell:\n%s", once)
+				}
+				twice, err := strPrint(printer, prog2)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if twice != once {
+					t.Fatalf("Print is not idempotent:\nin:\n%s\nonce:\n%stwice:\n%s",
+						in, once, twice)
+				}
+			}
+		})
+	}
+}
+
+func TestPrintConcurrent(t *testing.T) {
+	t.Parallel()
+	parser := NewParser(KeepComments)
+	printers := []*Printer{
+		NewPrinter(),
+		NewPrinter(KeepPadding),
+		NewPrinter(Minify),
+	}
+	var progs []*File
+	for _, c := range fileTests {
+		for _, in := range c.Strs {
+			prog, err := parser.Parse(strings.NewReader(in), "")
+			if err == nil {
+				progs = append(progs, prog)
+			}
+		}
+	}
+	want := make([][]string, len(printers))
+	for i, printer := range printers {
+		for _, prog := range progs {
+			out, err := strPrint(printer, prog)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want[i] = append(want[i], out)
+		}
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i, printer := range printers {
+				for j, prog := range progs {
+					got, err := strPrint(printer, prog)
+					if err != nil {
+						t.Error(err)
+					} else if got != want[i][j] {
+						t.Errorf("concurrent Print mismatch:\nwant:\n%sgot:\n%s",
+							want[i][j], got)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
 func parsePath(tb testing.TB, path string) *File {
 	f, err := os.Open(path)
 	if err != nil {
@@ -640,6 +794,8 @@ func TestPrintBinaryNextLine(t *testing.T) {
 			"a |\nb | #c2\nc",
 			"a \\\n\t| b \\\n\t|\n\t#c2\n\tc",
 		},
+		samePrint("a \\\n\t| b \\\n\t|\n\t#c2\n\tc"),
+		samePrint("foo \\\n\t&&\n\t#a1\n\t#a2\n\t$(bar)"),
 	}
 	parser := NewParser(KeepComments)
 	printer := NewPrinter(BinaryNextLine)
@@ -712,6 +868,7 @@ func TestPrintKeepPadding(t *testing.T) {
 		samePrint("{  a;  }"),
 		samePrint("(  a   )"),
 		samePrint("'foo\nbar'   # x"),
+		samePrint("a=○  foo   bar"),
 	}
 	parser := NewParser(KeepComments)
 	printer := NewPrinter(KeepPadding)
@@ -722,6 +879,64 @@ func TestPrintKeepPadding(t *testing.T) {
 	}
 }
 
+func TestPrintKeepTerminators(t *testing.T) {
+	t.Parallel()
+	var tests = [...]printCase{
+		samePrint("foo; bar"),
+		samePrint("foo & bar"),
+		samePrint("foo;\nbar"),
+		samePrint("foo; # x\nbar"),
+		samePrint("foo\nbar; baz"),
+		samePrint("{ foo; bar; }"),
+		samePrint("if foo; then bar; baz; fi"),
+		samePrint("foo && bar; baz"),
+		samePrint("foo | bar & baz"),
+		samePrint("cat <<EOF; bar\nbody\nEOF"),
+		{"foo  ;bar", "foo; bar"},
+		{"{ foo; bar\n}", "{\n\tfoo; bar\n}"},
+		{"foo; bar # x", "foo; bar # x"},
+	}
+	parser := NewParser(KeepComments)
+	printer := NewPrinter(KeepTerminators)
+	for i, tc := range tests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			printTest(t, parser, printer, tc.in, tc.want)
+		})
+	}
+}
+
+func TestPrintCRLF(t *testing.T) {
+	t.Parallel()
+	var tests = [...]printCase{
+		{"foo", "foo\r\n"},
+		{"foo\r\nbar\r\n", "foo\r\nbar\r\n"},
+		{"foo\nbar", "foo\r\nbar\r\n"},
+		{"foo \\\r\nbar", "foo \\\r\n\tbar\r\n"},
+		{"# c\r\n\r\nfoo # d", "# c\r\n\r\nfoo # d\r\n"},
+		{"cat <<EOF\r\nbody\r\nEOF\r\n", "cat <<EOF\r\nbody\r\nEOF\r\n"},
+		{"echo 'a\r\nb'", "echo 'a\r\nb'\r\n"},
+		{"echo 'a\rb'", "echo 'a\rb'\r\n"},
+	}
+	parser := NewParser(KeepComments)
+	printer := NewPrinter(CRLF)
+	for i, tc := range tests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			prog, err := parser.Parse(strings.NewReader(tc.in), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := strPrint(printer, prog)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Fatalf("Print mismatch:\nin:\n%q\nwant:\n%q\ngot:\n%q",
+					tc.in, tc.want, got)
+			}
+		})
+	}
+}
+
 func TestPrintMinify(t *testing.T) {
 	t.Parallel()
 	var tests = [...]printCase{
@@ -775,6 +990,10 @@ func TestPrintMinify(t *testing.T) {
 			"case $a in\nx) c ;;\ny | z)\n\td\n\t;;\nesac",
 			"case $a in\nx)c;;\ny|z)d\nesac",
 		},
+		{
+			"case $a\nin\n#etc\nx)\nc\n;;\nesac",
+			"case $a in\nx)c\nesac",
+		},
 		{
 			"a && b | c",
 			"a&&b|c",
@@ -846,6 +1065,9 @@ func printTest(t *testing.T, parser *Parser, printer *Printer, in, want string)
 		t.Fatal(err)
 	}
 	wantNewl := want + "\n"
+	if want == "" {
+		wantNewl = "" // nothing to print
+	}
 	got, err := strPrint(printer, prog)
 	if err != nil {
 		t.Fatal(err)
@@ -935,3 +1157,118 @@ func TestPrintManyStmts(t *testing.T) {
 		})
 	}
 }
+
+func TestFprintStmts(t *testing.T) {
+	t.Parallel()
+	var tests = [...]printCase{
+		samePrint("foo"),
+		{"foo\nbar # c\n\nbaz", "foo; bar; baz"},
+		{"foo &\nbar", "foo & bar"},
+		{"{ a & }", "{ a & }"},
+		{
+			"if a; then\n\tb\n\tc\nelif d; then e\nelse\n\tf\nfi",
+			"if a; then b; c; elif d; then e; else f; fi",
+		},
+		{"while a\ndo b; c; done", "while a; do b; c; done"},
+		{
+			"case $x in\na | b) foo ;;\n*)\n\tbar\n\tbaz\n\t;;\nesac",
+			"case $x in a | b) foo ;; *) bar; baz ;; esac",
+		},
+		{"f() {\n\tfoo\n}\nf", "f() { foo; }; f"},
+		{"foo &&\n\tbar ||\n\t# c\n\tbaz", "foo && bar || baz"},
+		{"echo $(\n\ta\n\tb\n) `c; d` \"$(e)\"", "echo $(a; b) $(c; d) \"$(e)\""},
+		{"a=1 \\\n\tb=2 foo >x \\\n\t2>&1", "a=1 b=2 foo >x 2>&1"},
+		{"x=(\n\t1\n\t2\n)", "x=(1 2)"},
+		samePrint("echo 'a b' \"c d\" $'e\\nf'"),
+	}
+	parser := NewParser(KeepComments)
+	for i, tc := range tests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			prog, err := parser.Parse(strings.NewReader(tc.in), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the multi-line options must not have any effect
+			printer := NewPrinter(Indent(4), BinaryNextLine, KeepPadding)
+			var buf bytes.Buffer
+			if err := FprintStmts(&buf, prog.Stmts, printer); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tc.want {
+				t.Fatalf("FprintStmts mismatch:\nin:\n%s\nwant:\n%s\ngot:\n%s",
+					tc.in, tc.want, got)
+			}
+			if _, err := parser.Parse(&buf, ""); err != nil {
+				t.Fatalf("Result is not valid shell:\n%s", tc.want)
+			}
+		})
+	}
+}
+
+var fprintStmtsErrTests = []struct {
+	in, want string
+}{
+	{"foo\ncat <<EOF\nbar\nEOF", "2:5: heredocs cannot be printed on a single line"},
+	{"echo 'a\nb'; c", "1:6: multi-line literals cannot be printed on a single line"},
+	{"echo \"a\nb\"", "1:7: multi-line literals cannot be printed on a single line"},
+	{"echo $'a\nb'", "1:6: multi-line literals cannot be printed on a single line"},
+}
+
+func TestFprintStmtsErrors(t *testing.T) {
+	t.Parallel()
+	for i, tc := range fprintStmtsErrTests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			prog, err := NewParser().Parse(strings.NewReader(tc.in), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = FprintStmts(ioutil.Discard, prog.Stmts, nil)
+			if err == nil || err.Error() != tc.want {
+				t.Fatalf("FprintStmts error mismatch: want %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestPrintEmbeddedFormatter(t *testing.T) {
+	t.Parallel()
+	upper := func(body string) (string, error) {
+		return strings.ToUpper(body), nil
+	}
+	failing := func(body string) (string, error) {
+		return "", fmt.Errorf("invalid")
+	}
+	var tests = [...]printCase{
+		{"psql <<'SQL'\nselect 1;\nSQL", "psql <<'SQL'\nSELECT 1;\nSQL"},
+		{"psql <<EOSQL\nselect 1;\nEOSQL", "psql <<EOSQL\nSELECT 1;\nEOSQL"},
+		{"psql <<SQL_EOF\nselect 1;\nSQL_EOF", "psql <<SQL_EOF\nSELECT 1;\nSQL_EOF"},
+		{"if x; then\n\tpsql <<-SQL\n\t\tselect 1;\n\tSQL\nfi", "if x; then\n\tpsql <<-SQL\n\t\tSELECT 1;\n\tSQL\nfi"},
+		samePrint("psql <<SQL\nselect $x;\nSQL"),
+		samePrint("psql <<SQL\nselect \\$1;\nSQL"),
+		{"psql <<\\SQL\nselect \\$1;\nSQL", "psql <<\\SQL\nSELECT \\$1;\nSQL"},
+		samePrint("cat <<EOF\n  keep   this\n\tas is\nEOF"),
+		samePrint("python3 <<'PY'\nprint(1)\nPY"),
+		samePrint("psql <<'SQL'\nsql\nSQL"),
+	}
+	parser := NewParser(KeepComments)
+	printer := NewPrinter(
+		EmbeddedFormatter("sql", upper),
+		EmbeddedFormatter("py", failing),
+	)
+	for i, tc := range tests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			prog, err := parser.Parse(strings.NewReader(tc.in), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := strPrint(printer, prog)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want+"\n" {
+				t.Fatalf("Print mismatch:\nin:\n%q\nwant:\n%q\ngot:\n%q",
+					tc.in, tc.want+"\n", got)
+			}
+		})
+	}
+}
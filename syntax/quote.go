@@ -0,0 +1,86 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package syntax
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NewLit returns a literal with the given value, or an error if the value
+// would not be parsed back as the same literal, such as "a b", "x;y" or
+// "$x". Building such literals by hand results in programs which mean
+// something else once printed, which is a common source of injection bugs
+// in generated scripts.
+//
+// Escaped characters, like in `a\ b`, and glob characters, like in "*.sh",
+// are allowed, as they don't change where the literal ends.
+func NewLit(value string) (*Lit, error) {
+	// surround the value, so that it can't escape what follows it
+	f, err := NewParser().Parse(strings.NewReader("x "+value+" y"), "")
+	if err == nil && len(f.Stmts) == 1 && len(f.Stmts[0].Redirs) == 0 {
+		ce, _ := f.Stmts[0].Cmd.(*CallExpr)
+		if ce != nil && len(ce.Assigns) == 0 && len(ce.Args) == 3 &&
+			len(ce.Args[1].Parts) == 1 {
+			if lit, _ := ce.Args[1].Parts[0].(*Lit); lit != nil && lit.Value == value {
+				return &Lit{Value: value}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("value is not a single literal: %q", value)
+}
+
+// NewSglQuoted returns a single-quoted string with the given value, or an
+// error if the value contains a single quote, as it would end the string
+// early. Any other character, including newlines, is kept as-is.
+func NewSglQuoted(value string) (*SglQuoted, error) {
+	if strings.ContainsRune(value, '\'') {
+		return nil, fmt.Errorf("value contains a single quote: %q", value)
+	}
+	return &SglQuoted{Value: value}, nil
+}
+
+// QuoteWord returns a word which expands to exactly the given value, as a
+// single field, quoting and escaping it as needed. Unlike NewLit and
+// NewSglQuoted it cannot fail, so it is the safest way to build a word out
+// of an arbitrary string, such as user input.
+//
+// For example, QuoteWord("foo") is foo and QuoteWord("a b") is 'a b'. Single
+// quotes in the value are escaped with backslashes between single-quoted
+// strings.
+func QuoteWord(value string) *Word {
+	if plainWord(value) {
+		return &Word{Parts: []WordPart{&Lit{Value: value}}}
+	}
+	w := &Word{}
+	for i, s := range strings.Split(value, "'") {
+		if i > 0 {
+			w.Parts = append(w.Parts, &Lit{Value: `\'`})
+		}
+		if s != "" || value == "" {
+			w.Parts = append(w.Parts, &SglQuoted{Value: s})
+		}
+	}
+	return w
+}
+
+// plainWord reports whether a string can be a literal word with the same
+// meaning anywhere, without quotes.
+func plainWord(s string) bool {
+	if s == "" || IsKeyword(s) {
+		return false
+	}
+	if i := strings.IndexByte(s, '='); i > 0 && ValidName(s[:i]) {
+		return false // an assignment at the start of a command
+	}
+	for _, r := range s {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		case strings.ContainsRune("_@%+=:,./-", r):
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package syntax
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestNewLit(t *testing.T) {
+	t.Parallel()
+	for _, value := range []string{"foo", "-x", "a=b", `a\ b`, "*.sh", "{a,b}", "if", "~/bin"} {
+		if _, err := NewLit(value); err != nil {
+			t.Errorf("NewLit(%q) failed: %v", value, err)
+		}
+	}
+	for _, value := range []string{
+		"", "a b", "x;y", "a\nb", "$x", "`x`", "'a'", `"a"`, "a|b",
+		"a>b", "(a)", "#a", `a\`, "a&", "$(x)",
+	} {
+		if _, err := NewLit(value); err == nil {
+			t.Errorf("NewLit(%q) did not fail", value)
+		}
+	}
+}
+
+func TestNewSglQuoted(t *testing.T) {
+	t.Parallel()
+	for _, value := range []string{"", "a b", "$x", "a\nb", `"a"`} {
+		if _, err := NewSglQuoted(value); err != nil {
+			t.Errorf("NewSglQuoted(%q) failed: %v", value, err)
+		}
+	}
+	if _, err := NewSglQuoted("it's"); err == nil {
+		t.Errorf("NewSglQuoted did not fail with a single quote")
+	}
+}
+
+var quoteWordTests = []struct {
+	value, want string
+}{
+	{"foo", "foo"},
+	{"", "''"},
+	{"a b", "'a b'"},
+	{"if", "'if'"},
+	{"a=b", "'a=b'"},
+	{"--opt=1", "--opt=1"},
+	{"$x `y` \\ \"z\"", `'$x ` + "`y`" + ` \ "z"'`},
+	{"it's", `'it'\''s'`},
+	{"'a'", `\''a'\'`},
+	{"a\nb", "'a\nb'"},
+}
+
+func TestQuoteWord(t *testing.T) {
+	t.Parallel()
+	for _, tc := range quoteWordTests {
+		w := QuoteWord(tc.value)
+		var buf bytes.Buffer
+		NewPrinter().Print(&buf, w)
+		if got := buf.String(); got != tc.want {
+			t.Errorf("QuoteWord mismatch in %q:\nwant: %s\ngot:  %s", tc.value, tc.want, got)
+		}
+		f, err := NewParser().Parse(strings.NewReader("x "+buf.String()), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		args := f.Stmts[0].Cmd.(*CallExpr).Args
+		if val, ok := StaticValue(args[1]); len(args) != 2 || !ok || val != tc.value {
+			t.Errorf("QuoteWord(%q) does not expand to the value: %q", tc.value, val)
+		}
+	}
+}
+
+func TestQuoteWordBash(t *testing.T) {
+	if testing.Short() {
+		t.Skip("calling bash is slow.")
+	}
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not available")
+	}
+	t.Parallel()
+	for _, tc := range quoteWordTests {
+		out, err := exec.Command("bash", "-c", "printf %s "+tc.want).Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != tc.value {
+			t.Errorf("bash expanded %s to %q, want %q", tc.want, out, tc.value)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package syntax
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+)
+
+// SexpPrint prints the provided syntax tree as a compact, single-line
+// s-expression. Unlike DebugPrint, it omits empty fields and only shows
+// the starting position of each node, which makes it easy to compare
+// syntax trees in test failure messages.
+//
+// For example, "echo $x" is printed as:
+//
+//	(File :Stmts [(Stmt@1:1 :Cmd (CallExpr@1:1 :Args [(Word (Lit@1:1 "echo")) (Word (ParamExp@1:6 :Short :Param (Lit@1:7 "x")))]))])
+func SexpPrint(w io.Writer, node Node) error {
+	p := sexpPrinter{layout: true}
+	p.value(reflect.ValueOf(node))
+	_, err := w.Write(p.Bytes())
+	return err
+}
+
+// sexpKey is like SexpPrint, but without positions nor comments, so that
+// two nodes have the same key if they only differ in their layout.
+func sexpKey(node Node) string {
+	var p sexpPrinter
+	p.value(reflect.ValueOf(node))
+	return p.String()
+}
+
+type sexpPrinter struct {
+	bytes.Buffer
+
+	layout bool // whether to print positions and comments
+}
+
+var (
+	posType      = reflect.TypeOf(Pos{})
+	termType     = reflect.TypeOf(TermNone)
+	commentsType = reflect.TypeOf([]Comment(nil))
+	stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+)
+
+func (p *sexpPrinter) value(x reflect.Value) {
+	switch x.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if x.IsNil() {
+			p.WriteString("nil")
+			return
+		}
+		if x.Kind() == reflect.Ptr && x.Elem().Kind() == reflect.Struct {
+			p.node(x.Elem(), x)
+			return
+		}
+		p.value(x.Elem())
+	case reflect.Struct:
+		if x.CanAddr() {
+			p.node(x, x.Addr())
+		} else {
+			p.node(x, reflect.Value{})
+		}
+	case reflect.Slice:
+		p.WriteByte('[')
+		p.elems(x)
+		p.WriteByte(']')
+	case reflect.String:
+		p.WriteString(strconv.Quote(x.String()))
+	default:
+		if x.Type().Implements(stringerType) {
+			p.WriteString(x.Interface().(fmt.Stringer).String())
+		} else {
+			fmt.Fprintf(p, "%v", x.Interface())
+		}
+	}
+}
+
+func (p *sexpPrinter) elems(x reflect.Value) {
+	for i := 0; i < x.Len(); i++ {
+		if i > 0 {
+			p.WriteByte(' ')
+		}
+		p.value(x.Index(i))
+	}
+}
+
+// node prints a struct, using ptr to find its position if it is a Node.
+func (p *sexpPrinter) node(x, ptr reflect.Value) {
+	p.WriteByte('(')
+	p.WriteString(x.Type().Name())
+	switch x.Type() {
+	case reflect.TypeOf(File{}), reflect.TypeOf(Word{}):
+		// their position is that of their first child
+	default:
+		if !ptr.IsValid() || !p.layout {
+			break
+		}
+		if n, ok := ptr.Interface().(Node); ok {
+			if pos := n.Pos(); pos.IsValid() {
+				fmt.Fprintf(p, "@%d:%d", pos.Line(), pos.Col())
+			}
+		}
+	}
+	if w, ok := x.Interface().(Word); ok {
+		// a word is just its parts
+		p.WriteByte(' ')
+		p.elems(reflect.ValueOf(w.Parts))
+	} else {
+		p.fields(x)
+	}
+	p.WriteByte(')')
+}
+
+func (p *sexpPrinter) fields(x reflect.Value) {
+	t := x.Type()
+	for i := 0; i < t.NumField(); i++ {
+		ft := t.Field(i)
+		fv := x.Field(i)
+		if ft.PkgPath != "" || ft.Type == posType || sexpZero(fv) {
+			continue
+		}
+		if ft.Type == termType {
+			continue // like positions, only layout
+		}
+		if ft.Type == commentsType && !p.layout {
+			continue
+		}
+		switch {
+		case ft.Anonymous:
+			// e.g. StmtList; inline its fields
+			p.fields(fv)
+		case ft.Name == "Value" && fv.Kind() == reflect.String:
+			p.WriteByte(' ')
+			p.value(fv)
+		case fv.Kind() == reflect.Bool:
+			p.WriteString(" :" + ft.Name)
+		default:
+			p.WriteString(" :" + ft.Name + " ")
+			p.value(fv)
+		}
+	}
+}
+
+func sexpZero(x reflect.Value) bool {
+	switch x.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		return x.IsNil()
+	case reflect.Slice:
+		return x.Len() == 0
+	case reflect.Struct:
+		for i := 0; i < x.NumField(); i++ {
+			if x.Type().Field(i).Type != posType && !sexpZero(x.Field(i)) {
+				return false
+			}
+		}
+		return true
+	}
+	return x.Interface() == reflect.Zero(x.Type()).Interface()
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package syntax
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+var sexpTests = []struct {
+	in, want string
+}{
+	{"", "(File)"},
+	{"foo", `(File :Stmts [(Stmt@1:1 :Cmd (CallExpr@1:1 :Args [(Word (Lit@1:1 "foo"))]))])`},
+	{"! a &", `(File :Stmts [(Stmt@1:1 :Cmd (CallExpr@1:3 :Args [(Word (Lit@1:3 "a"))]) :Negated :Background)])`},
+	{"a && b", `(File :Stmts [(Stmt@1:1 :Cmd (BinaryCmd@1:1 :Op && ` +
+		`:X (Stmt@1:1 :Cmd (CallExpr@1:1 :Args [(Word (Lit@1:1 "a"))])) ` +
+		`:Y (Stmt@1:6 :Cmd (CallExpr@1:6 :Args [(Word (Lit@1:6 "b"))]))))])`},
+	{"x=\"$y\" >f", `(File :Stmts [(Stmt@1:1 :Cmd (CallExpr@1:1 :Assigns [(Assign@1:1 :Name (Lit@1:1 "x") ` +
+		`:Value (Word (DblQuoted@1:3 :Parts [(ParamExp@1:4 :Short :Param (Lit@1:5 "y"))])))]) ` +
+		`:Redirs [(Redirect@1:8 :Op > :Word (Word (Lit@1:9 "f")))])])`},
+	{"# c\n{ a; }", `(File :Stmts [(Stmt@2:1 :Comments [(Comment@1:1 :Text " c")] ` +
+		`:Cmd (Block@2:1 :Stmts [(Stmt@2:3 :Cmd (CallExpr@2:3 :Args [(Word (Lit@2:3 "a"))]))]))])`},
+	{"echo $((1 + 2))", `(File :Stmts [(Stmt@1:1 :Cmd (CallExpr@1:1 :Args [(Word (Lit@1:1 "echo")) ` +
+		`(Word (ArithmExp@1:6 :X (BinaryArithm@1:9 :Op + :X (Word (Lit@1:9 "1")) :Y (Word (Lit@1:13 "2")))))]))])`},
+}
+
+func TestSexpPrint(t *testing.T) {
+	t.Parallel()
+	for i, tc := range sexpTests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			f, err := NewParser(KeepComments).Parse(strings.NewReader(tc.in), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := SexpPrint(&buf, f); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tc.want {
+				t.Fatalf("SexpPrint mismatch in %q:\nwant: %s\ngot:  %s",
+					tc.in, tc.want, got)
+			}
+		})
+	}
+}
@@ -3,7 +3,10 @@
 
 package syntax
 
-import "bytes"
+import (
+	"bytes"
+	"strings"
+)
 
 // Simplify simplifies a given program and returns whether any changes
 // were made.
@@ -16,6 +19,10 @@ import "bytes"
 //     Remove redundant quotes                  [[ "$var" == str ]]
 //     Merge negations with unary operators     [[ ! -n $var ]]
 //     Use single quotes to shorten literals    "\$foo"
+//     Remove braces from simple params         "${var}"
+//     Remove quotes from simple literals       "foo"
+//     Replace no-op self comparisons           [ "$#" = "$#" ]
+//     Remove semicolons after line breaks      foo \<newline> ;
 //
 // This function is EXPERIMENTAL; it may change or disappear at any
 // point until this notice is removed.
@@ -27,18 +34,76 @@ func Simplify(n Node) bool {
 
 type simplifier struct {
 	modified bool
+
+	// keepQuotes holds the words whose quotes change their meaning
+	// even if they only contain a simple literal, such as heredoc
+	// delimiters.
+	keepQuotes map[*Word]bool
+}
+
+func (s *simplifier) keep(w *Word) {
+	if s.keepQuotes == nil {
+		s.keepQuotes = make(map[*Word]bool)
+	}
+	s.keepQuotes[w] = true
+}
+
+// keepArithm keeps the quotes of the words in arithmetic expressions, as
+// characters such as + and : would be parsed as operators without them.
+func (s *simplifier) keepArithm(exprs ...ArithmExpr) {
+	for _, expr := range exprs {
+		if w, ok := expr.(*Word); ok {
+			s.keep(w)
+		}
+	}
 }
 
 func (s *simplifier) visit(node Node) bool {
 	switch x := node.(type) {
+	case *Stmt:
+		s.removeSemicolon(x)
+		if tc, ok := x.Cmd.(*TestClause); ok {
+			if val := s.selfComparison(tc.X); val != "" {
+				x.Cmd = &CallExpr{Args: []*Word{litWordAt(val, tc.Pos())}}
+			}
+		}
+	case *CallExpr:
+		if len(x.Args) == 0 {
+			break
+		}
+		// quoting the command name avoids keywords and declarations
+		s.keep(x.Args[0])
+		if len(x.Assigns) > 0 {
+			break
+		}
+		var test TestExpr
+		switch name := x.Args[0].Lit(); {
+		case name == "[" && len(x.Args) == 5 && x.Args[4].Lit() == "]",
+			name == "test" && len(x.Args) == 4:
+			test = &BinaryTest{
+				Op: testBinaryOp(x.Args[2].Lit()),
+				X:  x.Args[1],
+				Y:  x.Args[3],
+			}
+		}
+		if val := s.selfComparison(test); val != "" {
+			x.Args = []*Word{litWordAt(val, x.Pos())}
+		}
+	case *Redirect:
+		if x.Op == Hdoc || x.Op == DashHdoc {
+			// quoting the delimiter disables expansions
+			s.keep(x.Word)
+		}
 	case *Assign:
 		x.Index = s.removeParensArithm(x.Index)
+		s.keepArithm(x.Index)
 		// Don't inline params, as x[i] and x[$i] mean
 		// different things when x is an associative
 		// array; the first means "i", the second "$i".
 	case *ParamExp:
 		x.Index = s.removeParensArithm(x.Index)
 		// don't inline params - same as above.
+		s.keepArithm(x.Index)
 
 		if x.Slice == nil {
 			break
@@ -47,24 +112,41 @@ func (s *simplifier) visit(node Node) bool {
 		x.Slice.Offset = s.inlineSimpleParams(x.Slice.Offset)
 		x.Slice.Length = s.removeParensArithm(x.Slice.Length)
 		x.Slice.Length = s.inlineSimpleParams(x.Slice.Length)
+		s.keepArithm(x.Slice.Offset, x.Slice.Length)
 	case *ArithmExp:
 		x.X = s.removeParensArithm(x.X)
 		x.X = s.inlineSimpleParams(x.X)
+		s.keepArithm(x.X)
 	case *ArithmCmd:
 		x.X = s.removeParensArithm(x.X)
 		x.X = s.inlineSimpleParams(x.X)
+		s.keepArithm(x.X)
 	case *ParenArithm:
 		x.X = s.removeParensArithm(x.X)
 		x.X = s.inlineSimpleParams(x.X)
+		s.keepArithm(x.X)
 	case *BinaryArithm:
 		x.X = s.inlineSimpleParams(x.X)
 		x.Y = s.inlineSimpleParams(x.Y)
+		s.keepArithm(x.X, x.Y)
+	case *UnaryArithm:
+		s.keepArithm(x.X)
+	case *LetClause:
+		s.keepArithm(x.Exprs...)
+	case *CStyleLoop:
+		s.keepArithm(x.Init, x.Cond, x.Post)
 	case *CmdSubst:
 		x.Stmts = s.inlineSubshell(x.Stmts)
 	case *Subshell:
 		x.Stmts = s.inlineSubshell(x.Stmts)
 	case *Word:
 		x.Parts = s.simplifyWord(x.Parts)
+		x.Parts = s.removeParamBraces(x.Parts)
+		if !s.keepQuotes[x] {
+			x.Parts = s.unquoteLit(x.Parts)
+		}
+	case *DblQuoted:
+		x.Parts = s.removeParamBraces(x.Parts)
 	case *TestClause:
 		x.X = s.removeParensTest(x.X)
 		x.X = s.removeNegateTest(x.X)
@@ -77,6 +159,11 @@ func (s *simplifier) visit(node Node) bool {
 		switch x.Op {
 		case TsMatch, TsNoMatch:
 			// unquoting enables globbing
+		case TsReMatch:
+			if w, ok := x.Y.(*Word); ok {
+				// quoted regex characters are matched literally
+				s.keep(w)
+			}
 		default:
 			x.Y = s.unquoteParams(x.Y)
 		}
@@ -154,8 +241,8 @@ func (s *simplifier) inlineSimpleParams(x ArithmExpr) ArithmExpr {
 	if pe == nil || !ValidName(pe.Param.Value) {
 		return x
 	}
-	if pe.Excl || pe.Length || pe.Width || pe.Slice != nil ||
-		pe.Repl != nil || pe.Exp != nil {
+	if pe.Excl || pe.Length || pe.Width || pe.Flags != nil ||
+		pe.Slice != nil || pe.Repl != nil || pe.Exp != nil {
 		return x
 	}
 	if pe.Index != nil {
@@ -246,3 +333,171 @@ func (s *simplifier) removeNegateTest(x TestExpr) TestExpr {
 	}
 	return x
 }
+
+func (s *simplifier) removeSemicolon(st *Stmt) {
+	if st.Cmd == nil || !st.Semicolon.IsValid() || st.Background || st.Coprocess {
+		return
+	}
+	end := st.Cmd.End()
+	if len(st.Redirs) > 0 {
+		end = posMax(end, st.Redirs[len(st.Redirs)-1].End())
+	}
+	if st.Semicolon.Line() > end.Line() {
+		s.modified = true
+		st.Semicolon = Pos{}
+		st.Terminator = TermNewline
+	}
+}
+
+// removeParamBraces replaces ${var} with $var when the parameter
+// expansion is not followed by characters which would become part of
+// its name. Braces are also kept before a digit, as ${1}0 is $10 in some
+// shells, and before a '[', as $x[0] is an index in some shells; the
+// language variant isn't known here, so this is always done.
+func (s *simplifier) removeParamBraces(wps []WordPart) []WordPart {
+	for i, wp := range wps {
+		pe, _ := wp.(*ParamExp)
+		if pe == nil || pe.Short || pe.Excl || pe.Length || pe.Width ||
+			pe.Flags != nil || pe.Index != nil || pe.Slice != nil ||
+			pe.Repl != nil || pe.Exp != nil {
+			continue
+		}
+		name := pe.Param.Value
+		if len(name) > 1 && !ValidName(name) { // ${10}
+			continue
+		}
+		if i+1 < len(wps) {
+			if lit, ok := wps[i+1].(*Lit); ok && lit.Value != "" {
+				if c := lit.Value[0]; c == '[' || ('0' <= c && c <= '9') ||
+					ValidName(name+lit.Value[:1]) {
+					continue
+				}
+			}
+		}
+		s.modified = true
+		pe.Short = true
+	}
+	return wps
+}
+
+// unquoteLit removes the quotes from a word consisting of a quoted literal
+// without any characters that are special when unquoted.
+func (s *simplifier) unquoteLit(wps []WordPart) []WordPart {
+	if len(wps) != 1 {
+		return wps
+	}
+	var pos, end Pos
+	var val string
+	switch x := wps[0].(type) {
+	case *SglQuoted:
+		if x.Dollar {
+			return wps
+		}
+		pos, end, val = x.Pos(), x.End(), x.Value
+	case *DblQuoted:
+		if x.Dollar || len(x.Parts) != 1 {
+			return wps
+		}
+		lit, _ := x.Parts[0].(*Lit)
+		if lit == nil {
+			return wps
+		}
+		pos, end, val = x.Pos(), x.End(), lit.Value
+	default:
+		return wps
+	}
+	if val == "" || IsKeyword(val) {
+		return wps
+	}
+	if !plainChars(val) {
+		return wps
+	}
+	s.modified = true
+	return []WordPart{&Lit{ValuePos: pos, ValueEnd: end, Value: val}}
+}
+
+// selfComparison returns "true" or "false" if x is a string comparison
+// of a side effect free word against itself, which always gives the same result.
+// Otherwise, it returns the empty string.
+func (s *simplifier) selfComparison(x TestExpr) string {
+	b, _ := x.(*BinaryTest)
+	if b == nil || (b.Op != TsMatch && b.Op != TsNoMatch) {
+		return ""
+	}
+	w1, _ := b.X.(*Word)
+	w2, _ := b.Y.(*Word)
+	if w1 == nil || w2 == nil || !sideEffectFree(w1) {
+		return ""
+	}
+	var buf1, buf2 bytes.Buffer
+	printer := NewPrinter()
+	if printer.Print(&buf1, w1) != nil || printer.Print(&buf2, w2) != nil ||
+		buf1.String() != buf2.String() {
+		return ""
+	}
+	s.modified = true
+	if b.Op == TsMatch {
+		return "true"
+	}
+	return "false"
+}
+
+// plainChars reports whether val is made only of characters which never
+// have a special meaning in a shell, even when unquoted.
+func plainChars(val string) bool {
+	for _, r := range val {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		case strings.ContainsRune("_./,:+@%-", r):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// sideEffectFree reports whether w is a plain literal, or a double-quoted
+// string made only of literals and expansions of special parameters, so
+// that expanding it twice gives the same single field without any side
+// effects.
+//
+// Other parameters are not allowed, as some like RANDOM or SECONDS give a
+// different value each time, and any other might be unset, which is an
+// error if the nounset option is set.
+func sideEffectFree(w *Word) bool {
+	if len(w.Parts) != 1 {
+		return false
+	}
+	switch x := w.Parts[0].(type) {
+	case *Lit:
+		return plainChars(x.Value)
+	case *DblQuoted:
+		if x.Dollar {
+			return false
+		}
+		for _, wp := range x.Parts {
+			switch x := wp.(type) {
+			case *Lit:
+			case *ParamExp:
+				if x.Excl || x.Index != nil || x.Slice != nil ||
+					x.Repl != nil || x.Names != 0 || x.Exp != nil {
+					return false
+				}
+				switch x.Param.Value {
+				case "#", "?", "$", "-", "0":
+				default:
+					return false
+				}
+			default:
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func litWordAt(val string, pos Pos) *Word {
+	lit := &Lit{ValuePos: pos, ValueEnd: posAddCol(pos, len(val)), Value: val}
+	return &Word{Parts: []WordPart{lit}}
+}
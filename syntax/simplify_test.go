@@ -35,7 +35,8 @@ var simplifyTests = [...]simplifyTest{
 	noSimple("(($3 == $#))"),
 
 	// test exprs
-	{`[[ "$foo" == "bar" ]]`, `[[ $foo == "bar" ]]`},
+	{`[[ "$foo" == "bar" ]]`, `[[ $foo == bar ]]`},
+	noSimple(`[[ $foo =~ "a.b" ]]`),
 	{`[[ (-z "$foo") ]]`, `[[ -z $foo ]]`},
 	{`[[ "a b" > "$c" ]]`, `[[ "a b" > $c ]]`},
 	{`[[ ! -n $foo ]]`, `[[ -z $foo ]]`},
@@ -43,15 +44,47 @@ var simplifyTests = [...]simplifyTest{
 	{`[[ (! a == b) || (! c != d) ]]`, `[[ (a != b) || (c == d) ]]`},
 	noSimple(`[[ -n a$b && -n $c ]]`),
 	noSimple(`[[ ! -e foo ]]`),
+	{`[ "$#" = "$#" ]`, `true`},
+	{`test "$?" != "$?" && foo`, `false && foo`},
+	{`[[ "${?}x" == "${?}x" ]]`, `true`},
+	{`[ foo = foo ] || [[ a.b != a.b ]]`, `true || false`},
+	noSimple(`[ "$#" = "$?" ]`),
+	noSimple(`[ $# = $# ]`),
+	noSimple(`[ "$a" = "$a" ]`),
+	noSimple(`[ "$RANDOM" = "$RANDOM" ]`),
+	noSimple(`[[ $SECONDS == "$SECONDS" ]]`),
+	noSimple(`[ "$@" = "$@" ]`),
+	noSimple(`[ "${!a}" = "${!a}" ]`),
+	noSimple(`[ * = * ] || [[ [a] == [a] ]] || [ ~ = ~ ]`),
+	noSimple(`[ "$(a)" = "$(a)" ]`),
+	noSimple(`[ "${a:=b}" = "${a:=b}" ]`),
+	noSimple(`x=y [ "$a" = "$a" ]`),
 
 	// stmts
 	{"$( (sts))", "$(sts)"},
 	{"( ( (sts)))", "(sts)"},
 	noSimple("( (sts) >f)"),
 	noSimple("(\n\tx\n\t(sts)\n)"),
+	{"foo \\\n\t;", "foo"},
+	{"if a \\\n\t; then b; fi", "if a; then b; fi"},
+
+	// params
+	{`"${foo}"`, `"$foo"`},
+	{`${foo}.bar ${1}. ${@}`, `$foo.bar $1. $@`},
+	{`"${foo}${bar}-"`, `"$foo$bar-"`},
+	noSimple(`"${foo}bar"`),
+	noSimple(`${foo}_`),
+	noSimple(`"${1}0" ${1}0 "${@}1"`),
+	noSimple(`"${x}[0]" ${x}[0]`),
+	noSimple(`${10} ${#a} ${a[1]} ${a:-b}`),
 
 	// strings
-	noSimple(`"foo"`),
+	{`echo "foo"`, `echo foo`},
+	{`echo 'a/b.c' "-x"`, `echo a/b.c -x`},
+	noSimple(`"foo bar" 'a=b' "~" "*" ""`),
+	noSimple(`"echo" foo`),
+	noSimple(`echo "done" 'in'`),
+	noSimple("cat <<\"EOF\"\n$foo\nEOF"),
 	noSimple(`"foo$bar"`),
 	noSimple(`"$bar"`),
 	noSimple(`"f'o\\o"`),
@@ -63,6 +96,9 @@ var simplifyTests = [...]simplifyTest{
 	{"\"fo\\`o\"", "'fo`o'"},
 	noSimple(`fo"o"bar`),
 	noSimple(`foo""bar`),
+	noSimple(`let 'i++:'`),
+	noSimple(`$(("a:b" + 'c'))`),
+	noSimple(`for ((i = 0; 'i' < "3"; i++)); do foo; done`),
 }
 
 func TestSimplify(t *testing.T) {
@@ -91,3 +127,15 @@ func TestSimplify(t *testing.T) {
 		})
 	}
 }
+
+func TestSimplifyEmptyLit(t *testing.T) {
+	t.Parallel()
+	// built by hand, as the parser never produces empty literals
+	word := &Word{Parts: []WordPart{
+		&ParamExp{Param: &Lit{Value: "foo"}},
+		&Lit{},
+	}}
+	if !Simplify(word) {
+		t.Fatalf("did not simplify ${foo} followed by an empty literal")
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package syntax
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// StaticValue returns the exact string that a word expands to at run time,
+// if it is known statically. Quotes are removed and escape sequences are
+// resolved, including those in $'...' strings, so that both 'a b' and
+// a\ b result in "a b".
+//
+// It returns false if the word contains any expansions, including those
+// within double quotes, and translated $"..." strings. Unquoted literals
+// which may be subject to pathname, brace or tilde expansion, such as *.sh,
+// {a,b} or ~/bin, are not considered static either.
+func StaticValue(w *Word) (string, bool) {
+	return staticWord(w, "*?[{~")
+}
+
+// StaticAssignValue is like StaticValue, but for the value of an
+// assignment, like y in x=y, where no pathname nor brace expansion happens.
+// For example, *.sh is static there, while ~/bin is still not.
+func StaticAssignValue(w *Word) (string, bool) {
+	return staticWord(w, "~")
+}
+
+// staticWord implements StaticValue, where special are the characters
+// which make an unquoted literal not static.
+func staticWord(w *Word, special string) (string, bool) {
+	var buf bytes.Buffer
+	for _, part := range w.Parts {
+		switch x := part.(type) {
+		case *Lit:
+			if strings.ContainsAny(x.Value, special) {
+				return "", false
+			}
+			unescapeLit(&buf, x.Value, "")
+		case *SglQuoted:
+			if x.Dollar {
+				dollarEscapes(&buf, x.Value)
+			} else {
+				buf.WriteString(x.Value)
+			}
+		case *DblQuoted:
+			if x.Dollar {
+				return "", false
+			}
+			for _, part := range x.Parts {
+				lit, ok := part.(*Lit)
+				if !ok {
+					return "", false
+				}
+				unescapeLit(&buf, lit.Value, "$`\"\\\n")
+			}
+		default:
+			return "", false
+		}
+	}
+	return buf.String(), true
+}
+
+// unescapeLit writes s without its backslashes, which escape the
+// characters in escapable, or any character if it is empty. Escaped
+// newlines are removed.
+func unescapeLit(buf *bytes.Buffer, s, escapable string) {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) &&
+			(escapable == "" || strings.IndexByte(escapable, s[i+1]) >= 0) {
+			i++
+			if c = s[i]; c == '\n' {
+				continue
+			}
+		}
+		buf.WriteByte(c)
+	}
+}
+
+// dollarEscapes writes the value of the contents of a $'...' string,
+// resolving its escape sequences like Bash.
+func dollarEscapes(buf *bytes.Buffer, s string) {
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			buf.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch c := s[i]; c {
+		case 'a':
+			buf.WriteByte('\a')
+		case 'b':
+			buf.WriteByte('\b')
+		case 'e', 'E':
+			buf.WriteByte('\x1b')
+		case 'f':
+			buf.WriteByte('\f')
+		case 'n':
+			buf.WriteByte('\n')
+		case 'r':
+			buf.WriteByte('\r')
+		case 't':
+			buf.WriteByte('\t')
+		case 'v':
+			buf.WriteByte('\v')
+		case '\\', '\'', '"', '?':
+			buf.WriteByte(c)
+		case 'c':
+			if i+1 < len(s) {
+				i++
+				buf.WriteByte(s[i] & 0x1f) // control characters like \cA
+			} else {
+				buf.WriteString(`\c`)
+			}
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			j := i
+			for j < len(s) && j-i < 3 && '0' <= s[j] && s[j] <= '7' {
+				j++
+			}
+			n, _ := strconv.ParseUint(s[i:j], 8, 16)
+			buf.WriteByte(byte(n))
+			i = j - 1
+		case 'x', 'u', 'U':
+			max := 2 // hex digits
+			switch c {
+			case 'u':
+				max = 4
+			case 'U':
+				max = 8
+			}
+			j := i + 1
+			for j < len(s) && j-i <= max && strings.IndexByte("0123456789abcdefABCDEF", s[j]) >= 0 {
+				j++
+			}
+			if j == i+1 {
+				buf.WriteByte('\\')
+				buf.WriteByte(c)
+				break
+			}
+			n, _ := strconv.ParseUint(s[i+1:j], 16, 32)
+			if c == 'x' {
+				buf.WriteByte(byte(n))
+			} else if utf8.ValidRune(rune(n)) {
+				buf.WriteRune(rune(n))
+			}
+			i = j - 1
+		default:
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package syntax
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+var staticValueTests = []struct {
+	src  string
+	want string
+	ok   bool
+}{
+	{`foo`, "foo", true},
+	{`'a b'`, "a b", true},
+	{`a\ b`, "a b", true},
+	{`"a \"b\" \$c \x"`, `a "b" $c \x`, true},
+	{`"a\` + "\n" + `b"`, "ab", true},
+	{`a'b'"c"`, "abc", true},
+	{`$'a\tb\n'`, "a\tb\n", true},
+	{`$'\x41\101é\U0001F600'`, "AAé😀", true},
+	{`$'\'\"\\\?\z\x'`, `'"\?\z\x`, true},
+	{`$'\cA\e'`, "\x01\x1b", true},
+	{`''`, "", true},
+	{`$foo`, "", false},
+	{`"a$foo"`, "", false},
+	{`"$(foo)"`, "", false},
+	{`$"foo"`, "", false},
+	{`*.sh`, "", false},
+	{`'*.sh'`, "*.sh", true},
+	{`{a,b}`, "", false},
+	{`~/bin`, "", false},
+}
+
+func TestStaticValue(t *testing.T) {
+	t.Parallel()
+	p := NewParser()
+	for i, tc := range staticValueTests {
+		t.Run(fmt.Sprintf("%02d", i), func(t *testing.T) {
+			f, err := p.Parse(strings.NewReader(tc.src), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := f.Stmts[0].Cmd.(*CallExpr).Args[0]
+			got, ok := StaticValue(w)
+			if got != tc.want || ok != tc.ok {
+				t.Fatalf("StaticValue(%s) = %q, %v; want %q, %v",
+					tc.src, got, ok, tc.want, tc.ok)
+			}
+		})
+	}
+}
+
+var staticAssignValueTests = []struct {
+	src  string
+	want string
+	ok   bool
+}{
+	{`x=foo`, "foo", true},
+	{`x=*.sh`, "*.sh", true},
+	{`x={a,b}`, "{a,b}", true},
+	{`x=a\*'b'`, "a*b", true},
+	{`x=~/bin`, "", false},
+	{`x=$foo`, "", false},
+}
+
+func TestStaticAssignValue(t *testing.T) {
+	t.Parallel()
+	p := NewParser()
+	for i, tc := range staticAssignValueTests {
+		t.Run(fmt.Sprintf("%02d", i), func(t *testing.T) {
+			f, err := p.Parse(strings.NewReader(tc.src), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := f.Stmts[0].Cmd.(*CallExpr).Assigns[0].Value
+			got, ok := StaticAssignValue(w)
+			if got != tc.want || ok != tc.ok {
+				t.Fatalf("StaticAssignValue(%s) = %q, %v; want %q, %v",
+					tc.src, got, ok, tc.want, tc.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,4 @@
+# the obsolete arithmetic expansion
+echo $[1 + 2]
+x=$[x * 2] y=$[(3)]
+echo "$[x]" $[$[1] + 1]
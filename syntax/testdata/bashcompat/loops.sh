@@ -0,0 +1,9 @@
+# for and select clauses with braces instead of do and done
+for i in a b c; { echo $i; }
+for i { echo "$i"; }
+for ((i = 0; i < 3; i++)) { echo $i; }
+for i in 1 2
+{
+	echo $i
+}
+select opt in yes no; { break; }
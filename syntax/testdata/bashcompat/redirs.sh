@@ -0,0 +1,7 @@
+# redirections on compound and conditional commands
+[[ -n $x ]] >/dev/null 2>&1
+((x++)) 2>&1
+if true; then echo; fi >out
+case $x in a) echo ;; esac <in
+{ echo; } 2>&1 | cat
+f() { echo; } >&2
@@ -0,0 +1,5 @@
+# time with options and negated pipelines
+time -p -- sleep 0
+time ! false
+time -p ! false | true
+time
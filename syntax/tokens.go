@@ -344,3 +344,158 @@ func (o UnAritOperator) String() string   { return token(o).String() }
 func (o BinAritOperator) String() string  { return token(o).String() }
 func (o UnTestOperator) String() string   { return token(o).String() }
 func (o BinTestOperator) String() string  { return token(o).String() }
+
+// Precedence returns how tightly the operator binds its operands when
+// parsed, from 1 for the lowest to 14 for the highest. The levels match
+// those of Bash, which follows C:
+//
+//	1   ,
+//	2   = += -= *= /= %= &= |= ^= <<= >>=
+//	3   ? :
+//	4   ||
+//	5   &&
+//	6   |
+//	7   ^
+//	8   &
+//	9   == !=
+//	10  < > <= >=
+//	11  << >>
+//	12  + -
+//	13  * / %
+//	14  **
+//
+// Unary operators bind more tightly than any binary operator.
+func (o BinAritOperator) Precedence() int {
+	switch o {
+	case Comma:
+		return 1
+	case Assgn, AddAssgn, SubAssgn, MulAssgn, QuoAssgn, RemAssgn,
+		AndAssgn, OrAssgn, XorAssgn, ShlAssgn, ShrAssgn:
+		return 2
+	case Quest, Colon:
+		return 3
+	case OrArit:
+		return 4
+	case AndArit:
+		return 5
+	case Or:
+		return 6
+	case Xor:
+		return 7
+	case And:
+		return 8
+	case Eql, Neq:
+		return 9
+	case Lss, Gtr, Leq, Geq:
+		return 10
+	case Shl, Shr:
+		return 11
+	case Add, Sub:
+		return 12
+	case Mul, Quo, Rem:
+		return 13
+	case Pow:
+		return 14
+	}
+	return 0
+}
+
+// RightAssoc reports whether a chain of operators with the same
+// precedence as o groups from the right, like "a = b = c" or "2 ** 3 ** 2".
+// The rest group from the left, like "a - b - c".
+func (o BinAritOperator) RightAssoc() bool {
+	switch o.Precedence() {
+	case 2, 3, 14:
+		return true
+	}
+	return false
+}
+
+// Precedence returns how tightly the operator binds its operands when
+// parsed, from 1 for the lowest to 3 for the highest. OrTest has the lowest,
+// followed by AndTest. The rest, such as TsMatch, compare two words and
+// have the highest. All of them group from the left.
+func (o BinTestOperator) Precedence() int {
+	switch o {
+	case OrTest:
+		return 1
+	case AndTest:
+		return 2
+	}
+	return 3
+}
+
+// Precedence returns how tightly the operator binds its operands when
+// parsed. AndStmt and OrStmt have the same precedence of 1 and group from
+// the left, while Pipe and PipeAll have a precedence of 2 and group from
+// the right, like "a | (b | c)".
+func (o BinCmdOperator) Precedence() int {
+	switch o {
+	case Pipe, PipeAll:
+		return 2
+	}
+	return 1
+}
+
+// RightAssoc reports whether a chain of operators with the same
+// precedence as o groups from the right.
+func (o BinCmdOperator) RightAssoc() bool { return o.Precedence() == 2 }
+
+// Token is a lexical token, such as an operator like "&&" or "<<". Any of
+// the operator types, such as BinCmdOperator, can be converted to a Token.
+type Token uint32
+
+func (t Token) String() string { return token(t).String() }
+
+// tokensByString maps the string of each operator token to its value.
+var tokensByString = func() map[string]Token {
+	m := make(map[string]Token)
+	for t := sglQuote; t <= globExcl; t++ {
+		m[t.String()] = Token(t)
+	}
+	return m
+}()
+
+// ParseToken returns the operator token whose string is s, such as "&&" or
+// "-eq". Words, including reserved words such as "if", are not tokens.
+func ParseToken(s string) (Token, bool) {
+	t, ok := tokensByString[s]
+	return t, ok
+}
+
+// IsRedirect reports whether t is a redirection operator, such as ">" or
+// "<<", and so can be converted to a RedirOperator.
+func (t Token) IsRedirect() bool {
+	return token(t) >= rdrOut && token(t) <= appAll
+}
+
+// IsArithmOp reports whether t is an operator that may appear in an
+// arithmetic expression, and so can be converted to a UnAritOperator or a
+// BinAritOperator.
+func (t Token) IsArithmOp() bool {
+	switch token(t) {
+	case exclMark, addAdd, subSub,
+		plus, minus, star, slash, perc, power,
+		equal, nequal, rdrOut, rdrIn, lequal, gequal,
+		and, or, caret, appOut, hdoc, andAnd, orOr,
+		comma, quest, colon, assgn, addAssgn, subAssgn,
+		mulAssgn, quoAssgn, remAssgn, andAssgn, orAssgn,
+		xorAssgn, shlAssgn, shrAssgn:
+		return true
+	}
+	return false
+}
+
+// IsKeyword reports whether word is a reserved word in Bash, which
+// includes those of POSIX Shell. Reserved words such as "if" or "[[" are
+// only special when unquoted and in certain positions, such as at the
+// start of a command.
+func IsKeyword(word string) bool {
+	switch word {
+	case "!", "{", "}", "[[", "]]", "case", "coproc", "do", "done",
+		"elif", "else", "esac", "fi", "for", "function", "if", "in",
+		"select", "then", "time", "until", "while":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package syntax
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseToken(t *testing.T) {
+	t.Parallel()
+	for _, op := range []Token{
+		Token(AndStmt), Token(Pipe), Token(RdrOut), Token(DashHdoc),
+		Token(CmdIn), Token(GlobExcl), Token(Resume), Token(Pow),
+		Token(ShlAssgn), Token(TsReMatch), Token(TsRefVar), Token(TsNot),
+	} {
+		got, ok := ParseToken(op.String())
+		if !ok || got != op {
+			t.Errorf("ParseToken(%q) = %v, %v", op.String(), got, ok)
+		}
+	}
+	for _, s := range []string{"", "if", "foo", "EOF", "Lit", "&&&"} {
+		if got, ok := ParseToken(s); ok {
+			t.Errorf("ParseToken(%q) = %v, want no token", s, got)
+		}
+	}
+}
+
+func TestTokenPredicates(t *testing.T) {
+	t.Parallel()
+	redirs := []RedirOperator{RdrOut, AppOut, RdrIn, RdrInOut, DplIn,
+		DplOut, ClbOut, Hdoc, DashHdoc, WordHdoc, RdrAll, AppAll}
+	for _, op := range redirs {
+		if !Token(op).IsRedirect() {
+			t.Errorf("%q is not a redirect", op)
+		}
+	}
+	ariths := []Token{Token(Not), Token(Inc), Token(Dec), Token(Plus),
+		Token(Minus)}
+	for _, op := range []BinAritOperator{Add, Sub, Mul, Quo, Rem, Pow,
+		Eql, Gtr, Lss, Neq, Leq, Geq, And, Or, Xor, Shr, Shl, AndArit,
+		OrArit, Comma, Quest, Colon, Assgn, AddAssgn, SubAssgn, MulAssgn,
+		QuoAssgn, RemAssgn, AndAssgn, OrAssgn, XorAssgn, ShlAssgn,
+		ShrAssgn} {
+		ariths = append(ariths, Token(op))
+	}
+	for _, op := range ariths {
+		if !op.IsArithmOp() {
+			t.Errorf("%q is not an arithmetic operator", op)
+		}
+	}
+	for _, op := range []Token{Token(CmdIn), Token(Break), Token(TsEql)} {
+		if op.IsRedirect() || op.IsArithmOp() {
+			t.Errorf("%q is a redirect or arithmetic operator", op)
+		}
+	}
+	for _, word := range []string{"if", "[[", "}", "coproc"} {
+		if !IsKeyword(word) {
+			t.Errorf("%q is not a keyword", word)
+		}
+	}
+	for _, word := range []string{"echo", "[", "declare", "fi2"} {
+		if IsKeyword(word) {
+			t.Errorf("%q is a keyword", word)
+		}
+	}
+}
+
+// grouped prints an expression with parentheses around each binary
+// operation, to show how it was grouped.
+func grouped(node Node) string {
+	switch x := node.(type) {
+	case *BinaryArithm:
+		return "(" + grouped(x.X) + " " + x.Op.String() + " " + grouped(x.Y) + ")"
+	case *BinaryTest:
+		return "(" + grouped(x.X) + " " + x.Op.String() + " " + grouped(x.Y) + ")"
+	case *UnaryArithm:
+		if x.Post {
+			return grouped(x.X) + x.Op.String()
+		}
+		return x.Op.String() + grouped(x.X)
+	case *UnaryTest:
+		return x.Op.String() + grouped(x.X)
+	case *Word:
+		return x.Parts[0].(*Lit).Value
+	}
+	return "?"
+}
+
+var precedenceTests = []struct {
+	in, want string
+}{
+	{"1 - 2 - 3", "((1 - 2) - 3)"},
+	{"1 + 2 * 3 ** 2 ** 2", "(1 + (2 * (3 ** (2 ** 2))))"},
+	{"a || b && c | d ^ e & f", "(a || (b && (c | (d ^ (e & f)))))"},
+	{"a == b < c << d", "(a == (b < (c << d)))"},
+	{"a = b += c ? d : e ? f : g", "(a = (b += (c ? (d : (e ? (f : g))))))"},
+	{"a, b = 1, -c++", "((a , (b = 1)) , -c++)"},
+	{"!a && b", "(!a && b)"},
+	{"a ? b = 1 : c", "(a ? ((b = 1) : c))"},
+	{"a ? 1, 2 : 3", "(a ? ((1 , 2) : 3))"},
+	{"a ? b ? 1 : 2 : 3", "(a ? ((b ? (1 : 2)) : 3))"},
+	{"a <<= 0x1f | 2#101", "(a <<= (0x1f | 2#101))"},
+}
+
+var testPrecedenceTests = []struct {
+	in, want string
+}{
+	{"a && b || c", "((a && b) || c)"},
+	{"a || b && c", "(a || (b && c))"},
+	{"a || b || c", "((a || b) || c)"},
+	{"! a && b == c", "(!a && (b == c))"},
+}
+
+func TestPrecedence(t *testing.T) {
+	t.Parallel()
+	p := NewParser()
+	for i, tc := range precedenceTests {
+		t.Run(fmt.Sprintf("%03d", i), func(t *testing.T) {
+			f, err := p.Parse(strings.NewReader("(("+tc.in+"))"), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := grouped(f.Stmts[0].Cmd.(*ArithmCmd).X)
+			if got != tc.want {
+				t.Fatalf("want %s, got %s", tc.want, got)
+			}
+		})
+	}
+	for i, tc := range testPrecedenceTests {
+		t.Run(fmt.Sprintf("test%03d", i), func(t *testing.T) {
+			f, err := p.Parse(strings.NewReader("[[ "+tc.in+" ]]"), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := grouped(f.Stmts[0].Cmd.(*TestClause).X)
+			if got != tc.want {
+				t.Fatalf("want %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRightAssoc(t *testing.T) {
+	t.Parallel()
+	for _, op := range []BinAritOperator{Assgn, ShrAssgn, Quest, Colon, Pow} {
+		if !op.RightAssoc() {
+			t.Errorf("%s is not right-associative", op)
+		}
+	}
+	for _, op := range []BinAritOperator{Comma, OrArit, Sub, Quo} {
+		if op.RightAssoc() {
+			t.Errorf("%s is right-associative", op)
+		}
+	}
+	if !Pipe.RightAssoc() || AndStmt.RightAssoc() || Pipe.Precedence() <= OrStmt.Precedence() {
+		t.Errorf("unexpected BinCmdOperator precedence")
+	}
+}
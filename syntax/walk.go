@@ -77,6 +77,12 @@ func Walk(node Node, f func(Node) bool) {
 			Walk(a, f)
 		}
 		walkWords(x.Args, f)
+		if x.Handler != nil {
+			walkStmts(*x.Handler, f)
+		}
+		if x.Script != nil {
+			walkStmts(*x.Script, f)
+		}
 	case *Subshell:
 		walkStmts(x.StmtList, f)
 	case *Block:
@@ -107,9 +113,20 @@ func Walk(node Node, f func(Node) bool) {
 	case *BinaryCmd:
 		Walk(x.X, f)
 		Walk(x.Y, f)
+	case *AndOrList:
+		for _, s := range x.Stmts {
+			Walk(s, f)
+		}
+	case *Pipeline:
+		for _, s := range x.Stmts {
+			Walk(s, f)
+		}
 	case *FuncDecl:
 		Walk(x.Name, f)
 		Walk(x.Body, f)
+	case *AnonFunc:
+		Walk(x.Body, f)
+		walkWords(x.Args, f)
 	case *Word:
 		for _, wp := range x.Parts {
 			Walk(wp, f)
@@ -123,6 +140,9 @@ func Walk(node Node, f func(Node) bool) {
 	case *CmdSubst:
 		walkStmts(x.StmtList, f)
 	case *ParamExp:
+		if x.Flags != nil {
+			Walk(x.Flags, f)
+		}
 		Walk(x.Param, f)
 		if x.Index != nil {
 			Walk(x.Index, f)
@@ -213,6 +233,9 @@ func Walk(node Node, f func(Node) bool) {
 			Walk(x.Name, f)
 		}
 		Walk(x.Stmt, f)
+	case *NamespaceClause:
+		Walk(x.Name, f)
+		walkStmts(x.StmtList, f)
 	case *LetClause:
 		for _, expr := range x.Exprs {
 			Walk(expr, f)
@@ -224,6 +247,38 @@ func Walk(node Node, f func(Node) bool) {
 	f(nil)
 }
 
+// NodeAt returns the innermost node of f containing the given byte offset,
+// followed by each of its ancestors up to f itself. A node contains the
+// offsets from its position up to, but not including, its end. If no node
+// contains the offset, only f is returned.
+//
+// The ancestors are those in the syntax tree, which may not contain the
+// offset themselves; for example, a heredoc body is within its statement,
+// but is placed after it in the source.
+func NodeAt(f *File, offset int) []Node {
+	var stack, best []Node
+	Walk(f, func(node Node) bool {
+		if node == nil {
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		stack = append(stack, node)
+		pos, end := node.Pos(), node.End()
+		if int(pos.Offset()) <= offset && offset < int(end.Offset()) &&
+			len(stack) > len(best) {
+			best = append(best[:0], stack...)
+		}
+		return true
+	})
+	if len(best) == 0 {
+		return []Node{f}
+	}
+	for i, j := 0, len(best)-1; i < j; i, j = i+1, j-1 {
+		best[i], best[j] = best[j], best[i]
+	}
+	return best
+}
+
 // DebugPrint prints the provided syntax tree, spanning multiple lines and with
 // indentation. Can be useful to investigate the content of a syntax tree.
 func DebugPrint(w io.Writer, node Node) error {
@@ -289,13 +344,19 @@ func (p *debugPrinter) print(x reflect.Value) {
 			return
 		}
 		t := x.Type()
+		var fields []int
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).PkgPath == "" {
+				fields = append(fields, i)
+			}
+		}
 		p.printf("%s {", t)
 		p.level++
 		p.newline()
-		for i := 0; i < t.NumField(); i++ {
+		for j, i := range fields {
 			p.printf("%s: ", t.Field(i).Name)
 			p.print(x.Field(i))
-			if i == x.NumField()-1 {
+			if j == len(fields)-1 {
 				p.level--
 			}
 			p.newline()
@@ -123,3 +123,50 @@ func TestWalkUnexpectedType(t *testing.T) {
 		return true
 	})
 }
+
+var nodeAtTests = []struct {
+	src    string
+	offset int
+	want   []string
+}{
+	{"", 0, []string{"*syntax.File"}},
+	{"foo bar", 5, []string{
+		"*syntax.Lit", "*syntax.Word", "*syntax.CallExpr",
+		"*syntax.Stmt", "*syntax.File",
+	}},
+	{"echo ${foo}", 7, []string{
+		"*syntax.Lit", "*syntax.ParamExp", "*syntax.Word",
+		"*syntax.CallExpr", "*syntax.Stmt", "*syntax.File",
+	}},
+	{"f() { a; }", 6, []string{
+		"*syntax.Lit", "*syntax.Word", "*syntax.CallExpr", "*syntax.Stmt",
+		"*syntax.Block", "*syntax.Stmt", "*syntax.FuncDecl", "*syntax.Stmt",
+		"*syntax.File",
+	}},
+	{"cat <<EOF\nbody\nEOF", 11, []string{
+		"*syntax.Lit", "*syntax.Word", "*syntax.Redirect",
+		"*syntax.Stmt", "*syntax.File",
+	}},
+	{"# c\na", 1, []string{"*syntax.Comment", "*syntax.Stmt", "*syntax.File"}},
+}
+
+func TestNodeAt(t *testing.T) {
+	t.Parallel()
+	p := NewParser(KeepComments)
+	for i, tc := range nodeAtTests {
+		t.Run(fmt.Sprintf("%02d", i), func(t *testing.T) {
+			f, err := p.Parse(strings.NewReader(tc.src), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, node := range NodeAt(f, tc.offset) {
+				got = append(got, fmt.Sprintf("%T", node))
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("NodeAt mismatch in %q at %d:\nwant: %q\ngot:  %q",
+					tc.src, tc.offset, tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,543 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package transform
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// specialVars are the variables which have an effect on the shell itself,
+// so assigning them is never useless. Variables starting with LC_ are
+// special too.
+var specialVars = map[string]bool{
+	"BASH_ENV": true, "BASH_COMPAT": true, "BASH_XTRACEFD": true,
+	"BASHOPTS": true, "CDPATH": true, "COLUMNS": true, "COMPREPLY": true,
+	"ENV": true, "EXECIGNORE": true, "FCEDIT": true, "FIGNORE": true,
+	"FUNCNEST": true, "GLOBIGNORE": true, "HISTCONTROL": true,
+	"HISTFILE": true, "HISTFILESIZE": true, "HISTIGNORE": true,
+	"HISTSIZE": true, "HISTTIMEFORMAT": true, "HOME": true, "IFS": true,
+	"INPUTRC": true, "LANG": true, "LINENO": true, "LINES": true,
+	"MAIL": true, "MAILCHECK": true, "MAILPATH": true, "OLDPWD": true,
+	"OPTARG": true, "OPTERR": true, "OPTIND": true, "PATH": true,
+	"POSIXLY_CORRECT": true, "PROMPT_COMMAND": true, "PS1": true,
+	"PS2": true, "PS3": true, "PS4": true, "PWD": true, "RANDOM": true,
+	"REPLY": true, "SECONDS": true, "SHELLOPTS": true, "TERM": true,
+	"TIMEFORMAT": true, "TMOUT": true, "TMPDIR": true, "TZ": true,
+}
+
+// RemoveDeadVars returns a copy of a program without the assignments to
+// variables which are never read, such as "tmp=x" where $tmp isn't used
+// anywhere, which is useful to shrink generated programs. It also returns
+// the sorted names of the variables whose assignments were removed. f
+// itself is not modified.
+//
+// Whether a variable is read is decided regardless of control flow, and
+// conservatively. Variables mentioned like $name in single-quoted strings,
+// such as in trap 'rm "$tmp"' EXIT, are considered read, and so are the
+// names in values evaluated as arithmetic, like x in "y=x; echo $((y))"
+// or in let "y = x + 1". Exported variables and those with a special
+// meaning to the shell, such as PATH or IFS, are kept. Nothing is removed
+// if the program may read variables in ways that can't be followed
+// statically: via eval, source or ., an indirect expansion like ${!name},
+// a nameref, an integer variable, set -a, a command printing all variables
+// like set or declare -p, or arithmetic on a string that doesn't parse.
+//
+// Only assignments whose value has no side effects are removed, so that
+// "x=$(cmd)" is kept. A statement left without any assignments is removed
+// unless it is the last in its list, or the next statement uses $?, as
+// that would change an exit status. Removing assignments may leave other
+// variables unused too, so those are removed as well.
+//
+// Like with InlineSources, the result is printed and parsed again, and
+// comments are kept.
+func RemoveDeadVars(f *syntax.File) (*syntax.File, []string, error) {
+	var removed []string
+	seen := make(map[string]bool)
+	for {
+		vs := scanVars(f)
+		if vs.dynamic {
+			break
+		}
+		vs.marker = avoidMarker("__dead", f)
+		var round []string
+		syntax.Walk(f, func(node syntax.Node) bool {
+			switch x := node.(type) {
+			case *syntax.File:
+				round = append(round, vs.trimList(&x.StmtList)...)
+			case *syntax.Block:
+				round = append(round, vs.trimList(&x.StmtList)...)
+			case *syntax.Subshell:
+				round = append(round, vs.trimList(&x.StmtList)...)
+			case *syntax.CmdSubst:
+				round = append(round, vs.trimList(&x.StmtList)...)
+			case *syntax.IfClause:
+				round = append(round, vs.trimList(&x.Then)...)
+				round = append(round, vs.trimList(&x.Else)...)
+			case *syntax.WhileClause:
+				round = append(round, vs.trimList(&x.Do)...)
+			case *syntax.ForClause:
+				round = append(round, vs.trimList(&x.Do)...)
+			case *syntax.CaseItem:
+				round = append(round, vs.trimList(&x.StmtList)...)
+			}
+			return true
+		})
+		if len(round) == 0 {
+			break
+		}
+		for _, name := range round {
+			if !seen[name] {
+				seen[name] = true
+				removed = append(removed, name)
+			}
+		}
+		// Print the program with the removed statements as placeholder
+		// commands, as removing them from the syntax tree would leave
+		// gaps in its positions.
+		var buf bytes.Buffer
+		err := syntax.NewPrinter().Print(&buf, f)
+		for i := len(vs.undo) - 1; i >= 0; i-- {
+			vs.undo[i]()
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		src := dropMarkers(buf.String(), vs.marker)
+		if f, err = syntax.NewParser(syntax.KeepComments).Parse(strings.NewReader(src), f.Name); err != nil {
+			return nil, nil, err
+		}
+	}
+	sort.Strings(removed)
+	return f, removed, nil
+}
+
+// dropMarkers removes the placeholder commands from a program's source.
+func dropMarkers(src, marker string) string {
+	lines := strings.SplitAfter(src, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		switch {
+		case !strings.Contains(line, marker):
+		case strings.TrimSpace(line) == marker:
+			continue // only the placeholder
+		default:
+			line = strings.Replace(line, marker+"; ", "", -1)
+			line = strings.Replace(line, marker+" #", "#", -1)
+			line = strings.Replace(line, marker, ":", -1)
+		}
+		kept = append(kept, line)
+	}
+	return strings.Join(kept, "")
+}
+
+// varScan holds what a program does with its variables.
+type varScan struct {
+	read    map[string]bool // read, exported or special
+	dynamic bool            // whether variables may be read dynamically
+	nounset bool            // whether expanding unset variables may fail
+
+	// the variables whose values are evaluated as arithmetic, and the
+	// values assigned to each variable
+	arithmVars []string
+	inArithm   map[string]bool
+	assigned   map[string][]*syntax.Word
+
+	marker string   // name of the placeholder commands
+	undo   []func() // to restore the syntax tree after printing
+}
+
+func scanVars(f *syntax.File) *varScan {
+	vs := &varScan{
+		read:     make(map[string]bool),
+		inArithm: make(map[string]bool),
+		assigned: make(map[string][]*syntax.Word),
+	}
+	for name := range specialVars {
+		vs.read[name] = true
+	}
+	syntax.Walk(f, vs.visit)
+	// The values of variables used in arithmetic are evaluated as
+	// arithmetic expressions too, such as x in "y=x; echo $((y))".
+	for i := 0; i < len(vs.arithmVars); i++ {
+		for _, w := range vs.assigned[vs.arithmVars[i]] {
+			vs.arithm(w)
+		}
+	}
+	return vs
+}
+
+func (vs *varScan) visit(node syntax.Node) bool {
+	switch x := node.(type) {
+	case *syntax.ParamExp:
+		if x.Param == nil {
+			break
+		}
+		switch {
+		case x.Names != 0:
+			vs.dynamic = true // ${!prefix*}
+		case x.Excl && x.Index == nil:
+			vs.dynamic = true // ${!name}
+		}
+		vs.readName(x.Param.Value)
+		vs.arithm(x.Index)
+		if x.Slice != nil {
+			vs.arithm(x.Slice.Offset, x.Slice.Length)
+		}
+	case *syntax.Lit:
+		vs.readText(x.Value)
+	case *syntax.SglQuoted:
+		vs.readText(x.Value)
+	case *syntax.Assign:
+		if x.Name != nil && x.Value != nil {
+			vs.assigned[x.Name.Value] = append(vs.assigned[x.Name.Value], x.Value)
+		}
+		vs.arithm(x.Index)
+	case *syntax.ArrayElem:
+		vs.arithm(x.Index)
+	case *syntax.ArithmExp:
+		vs.arithm(x.X)
+	case *syntax.ArithmCmd:
+		vs.arithm(x.X)
+	case *syntax.LetClause:
+		for _, expr := range x.Exprs {
+			vs.arithm(expr)
+		}
+	case *syntax.CStyleLoop:
+		vs.arithm(x.Init, x.Cond, x.Post)
+	case *syntax.BinaryArithm:
+		vs.arithm(x.X, x.Y)
+	case *syntax.UnaryArithm:
+		vs.arithm(x.X)
+	case *syntax.ParenArithm:
+		vs.arithm(x.X)
+	case *syntax.BinaryTest:
+		switch x.Op {
+		case syntax.TsEql, syntax.TsNeq, syntax.TsLeq,
+			syntax.TsGeq, syntax.TsLss, syntax.TsGtr:
+			vs.arithm(x.X, x.Y)
+		}
+	case *syntax.UnaryTest:
+		if x.Op == syntax.TsVarSet || x.Op == syntax.TsRefVar {
+			vs.arithm(x.X)
+		}
+	case *syntax.DeclClause:
+		vs.decl(x)
+	case *syntax.CallExpr:
+		vs.call(x)
+	}
+	return true
+}
+
+// arithm marks the names used in words which are evaluated as arithmetic
+// expressions, including quoted ones like "x + 1" in let, and those in
+// [[ tests.
+func (vs *varScan) arithm(exprs ...syntax.Node) {
+	for _, expr := range exprs {
+		w, ok := expr.(*syntax.Word)
+		if !ok {
+			continue
+		}
+		if lit := w.Lit(); lit != "" {
+			vs.readName(lit)
+			vs.arithmVar(lit)
+			continue
+		}
+		val, ok := syntax.StaticValue(w)
+		if !ok {
+			// the values of the expanded variables are evaluated
+			syntax.Walk(w, func(node syntax.Node) bool {
+				if pe, ok := node.(*syntax.ParamExp); ok && pe.Param != nil {
+					vs.arithmVar(pe.Param.Value)
+				}
+				return true
+			})
+			continue
+		}
+		f, err := syntax.NewParser().Parse(strings.NewReader("(("+val+"))"), "")
+		if err != nil || len(f.Stmts) != 1 {
+			vs.dynamic = true // not something we understand
+			continue
+		}
+		syntax.Walk(f, vs.visit)
+	}
+}
+
+// arithmVar records that a variable's value is evaluated as an arithmetic
+// expression, given its name or an element of it.
+func (vs *varScan) arithmVar(name string) {
+	if i := strings.IndexByte(name, '['); i > 0 {
+		name = name[:i]
+	}
+	if syntax.ValidName(name) && !vs.inArithm[name] {
+		vs.inArithm[name] = true
+		vs.arithmVars = append(vs.arithmVars, name)
+	}
+}
+
+// readName marks a variable as read, given its name or an element of it,
+// like "arr[1]".
+func (vs *varScan) readName(name string) {
+	if i := strings.IndexByte(name, '['); i > 0 {
+		name = name[:i]
+	}
+	if syntax.ValidName(name) {
+		vs.read[name] = true
+	}
+}
+
+// readText marks the variables mentioned in text like $name or ${name},
+// such as in code to be run by trap or sh -c.
+func (vs *varScan) readText(text string) {
+	for {
+		i := strings.IndexByte(text, '$')
+		if i < 0 {
+			return
+		}
+		text = strings.TrimPrefix(text[i+1:], "{")
+		end := 0
+		for end < len(text) && isNameByte(text[end]) {
+			end++
+		}
+		vs.readName(text[:end])
+	}
+}
+
+func isNameByte(b byte) bool {
+	return b == '_' || ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z') ||
+		('0' <= b && b <= '9')
+}
+
+func (vs *varScan) decl(dc *syntax.DeclClause) {
+	keep := false
+	switch dc.Variant.Value {
+	case "export", "readonly":
+		keep = true
+	case "nameref":
+		vs.dynamic = true
+	}
+	funcs := false
+	for _, opt := range dc.Opts {
+		flags := opt.Lit()
+		if !strings.HasPrefix(flags, "-") {
+			continue
+		}
+		if strings.ContainsAny(flags, "nip") {
+			vs.dynamic = true // namerefs, integers and printing
+		}
+		if strings.ContainsAny(flags, "xr") {
+			keep = true
+		}
+		if strings.ContainsAny(flags, "fF") {
+			funcs = true
+		}
+	}
+	if len(dc.Assigns) == 0 && !funcs {
+		vs.dynamic = true // printing all variables
+	}
+	for _, as := range dc.Assigns {
+		if !keep {
+			continue
+		}
+		if as.Name != nil {
+			vs.readName(as.Name.Value)
+		} else if as.Naked && as.Value != nil {
+			vs.readName(as.Value.Lit())
+		}
+	}
+}
+
+func (vs *varScan) call(ce *syntax.CallExpr) {
+	if len(ce.Args) == 0 {
+		return
+	}
+	for _, as := range ce.Assigns {
+		// variables in the environment of a command
+		vs.readName(as.Name.Value)
+	}
+	args := make([]string, len(ce.Args))
+	for i, arg := range ce.Args {
+		args[i] = arg.Lit()
+	}
+	switch args[0] {
+	case "eval", "source", ".":
+		vs.dynamic = true
+	case "export", "readonly":
+		for _, arg := range args[1:] {
+			if i := strings.IndexByte(arg, '='); i > 0 {
+				arg = arg[:i]
+			}
+			vs.readName(arg)
+		}
+	case "set":
+		if len(args) == 1 {
+			vs.dynamic = true // printing all variables
+		}
+		for i, arg := range args[1:] {
+			switch {
+			case arg == "-o" && i+2 < len(args):
+				switch args[i+2] {
+				case "allexport":
+					vs.dynamic = true
+				case "nounset":
+					vs.nounset = true
+				}
+			case strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--"):
+				if strings.Contains(arg, "a") {
+					vs.dynamic = true
+				}
+				if strings.Contains(arg, "u") {
+					vs.nounset = true
+				}
+			}
+		}
+	case "test", "[":
+		for i := 1; i+1 < len(args); i++ {
+			if args[i] == "-v" {
+				vs.readName(args[i+1])
+			}
+		}
+	}
+}
+
+// trimList replaces the statements of a list which only make useless
+// assignments by placeholders, returning the names of their variables.
+func (vs *varScan) trimList(list *syntax.StmtList) []string {
+	var removed []string
+	for i, st := range list.Stmts {
+		names, empty := vs.trimStmt(st)
+		if !empty {
+			removed = append(removed, names...)
+			continue
+		}
+		if i+1 == len(list.Stmts) || usesStatus(list.Stmts[i+1]) {
+			continue
+		}
+		removed = append(removed, names...)
+		list.Stmts[i] = &syntax.Stmt{
+			Comments: st.Comments,
+			Cmd: &syntax.CallExpr{Args: []*syntax.Word{{
+				Parts: []syntax.WordPart{&syntax.Lit{
+					ValuePos: st.Position,
+					ValueEnd: st.Position,
+					Value:    vs.marker,
+				}},
+			}}},
+			Position:  st.Position,
+			Semicolon: st.Semicolon,
+		}
+		i, st := i, st
+		vs.undo = append(vs.undo, func() { list.Stmts[i] = st })
+	}
+	return removed
+}
+
+// trimStmt removes the useless assignments from a statement, returning
+// the names of their variables. If all of the assignments are useless, the
+// statement is left as is and empty is true, so that the caller may remove
+// it entirely.
+func (vs *varScan) trimStmt(st *syntax.Stmt) (names []string, empty bool) {
+	if st.Negated || st.Background || st.Coprocess || len(st.Redirs) > 0 {
+		return nil, false
+	}
+	var assigns *[]*syntax.Assign
+	switch x := st.Cmd.(type) {
+	case *syntax.CallExpr:
+		if len(x.Args) > 0 {
+			return nil, false
+		}
+		assigns = &x.Assigns
+	case *syntax.DeclClause:
+		switch x.Variant.Value {
+		case "local", "declare", "typeset":
+		default:
+			return nil, false
+		}
+		for _, opt := range x.Opts {
+			if lit := opt.Lit(); strings.Trim(lit, "-aAglu") != "" || lit == "" {
+				return nil, false
+			}
+		}
+		assigns = &x.Assigns
+	default:
+		return nil, false
+	}
+	var kept []*syntax.Assign
+	for _, as := range *assigns {
+		name := ""
+		if as.Name != nil {
+			name = as.Name.Value
+		} else if as.Naked && as.Value != nil {
+			name = as.Value.Lit()
+		}
+		if !syntax.ValidName(name) || vs.read[name] || strings.HasPrefix(name, "LC_") ||
+			(!as.Naked && !vs.pure(as)) {
+			kept = append(kept, as)
+			continue
+		}
+		names = append(names, name)
+	}
+	switch {
+	case len(names) == 0:
+		return nil, false
+	case len(kept) == 0:
+		return names, true
+	}
+	old := *assigns
+	*assigns = kept
+	vs.undo = append(vs.undo, func() { *assigns = old })
+	return names, false
+}
+
+// pure reports whether an assignment has no side effects besides setting
+// its variable.
+func (vs *varScan) pure(as *syntax.Assign) bool {
+	pure := true
+	syntax.Walk(as, func(node syntax.Node) bool {
+		switch x := node.(type) {
+		case *syntax.CmdSubst, *syntax.ProcSubst:
+			pure = false
+		case *syntax.ParamExp:
+			if vs.nounset {
+				pure = false
+			}
+			if x.Exp != nil {
+				switch x.Exp.Op {
+				case syntax.SubstAssgn, syntax.SubstColAssgn,
+					syntax.SubstQuest, syntax.SubstColQuest:
+					pure = false
+				}
+			}
+		case *syntax.BinaryArithm:
+			switch x.Op {
+			case syntax.Assgn, syntax.AddAssgn, syntax.SubAssgn,
+				syntax.MulAssgn, syntax.QuoAssgn, syntax.RemAssgn,
+				syntax.AndAssgn, syntax.OrAssgn, syntax.XorAssgn,
+				syntax.ShlAssgn, syntax.ShrAssgn:
+				pure = false
+			}
+		case *syntax.UnaryArithm:
+			if x.Op == syntax.Inc || x.Op == syntax.Dec {
+				pure = false
+			}
+		}
+		return pure
+	})
+	return pure
+}
+
+// usesStatus reports whether a statement expands $?.
+func usesStatus(st *syntax.Stmt) bool {
+	found := false
+	syntax.Walk(st, func(node syntax.Node) bool {
+		if pe, ok := node.(*syntax.ParamExp); ok && pe.Param != nil && pe.Param.Value == "?" {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
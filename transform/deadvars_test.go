@@ -0,0 +1,107 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package transform
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+var deadVarsTests = []struct {
+	src, want string
+	removed   []string
+}{
+	{"x=1\nfoo", "foo\n", []string{"x"}},
+	{"x=1\necho $x", "x=1\necho $x\n", nil},
+	{"x=1 y=2\necho $y", "y=2\necho $y\n", []string{"x"}},
+	{"x=1\ny=$x\nfoo", "foo\n", []string{"x", "y"}},
+	{"foo\nx=1", "foo\nx=1\n", nil},
+	{"x=1\necho $?", "x=1\necho $?\n", nil},
+	{"x=$(cmd)\nfoo", "x=$(cmd)\nfoo\n", nil},
+	{"x=${y:=1}\nfoo", "x=${y:=1}\nfoo\n", nil},
+	{"x=$((i++))\nfoo", "x=$((i++))\nfoo\n", nil},
+	{"x=1 >f\nfoo", "x=1 >f\nfoo\n", nil},
+	{"x=1 foo", "x=1 foo\n", nil},
+	{"x=1\nexport x\nfoo", "x=1\nexport x\nfoo\n", nil},
+	{"export x=1\nfoo", "export x=1\nfoo\n", nil},
+	{"declare -x x=1\nfoo", "declare -x x=1\nfoo\n", nil},
+	{"PATH=/bin\nLC_ALL=C\nfoo", "PATH=/bin\nLC_ALL=C\nfoo\n", nil},
+	{"f() {\n\tlocal x y=1\n\tbar\n}", "f() {\n\tbar\n}\n", []string{"x", "y"}},
+	{"f() {\n\tlocal -r x=1\n\tbar\n}", "f() {\n\tlocal -r x=1\n\tbar\n}\n", nil},
+	{"if a; then\n\tx=1\n\tfoo\nfi", "if a; then\n\tfoo\nfi\n", []string{"x"}},
+	{"if x=1; then foo; fi", "if x=1; then foo; fi\n", nil},
+	{"a && x=1\nfoo", "a && x=1\nfoo\n", nil},
+	{"# doc\nx=1\nfoo", "# doc\nfoo\n", []string{"x"}},
+	{"arr=(a b)\narr+=(c)\nfoo", "foo\n", []string{"arr"}},
+	{"arr=(a b)\necho ${#arr[@]}", "arr=(a b)\necho ${#arr[@]}\n", nil},
+	{"x=1\ni=2\necho $((x + a[i]))", "x=1\ni=2\necho $((x + a[i]))\n", nil},
+	{"x=1\n[[ -v x ]]", "x=1\n[[ -v x ]]\n", nil},
+	{"x=1\n[[ 3 -gt x ]]", "x=1\n[[ 3 -gt x ]]\n", nil},
+	{"x=1\nlet \"y = x + 1\"\necho $y", "x=1\nlet \"y = x + 1\"\necho $y\n", nil},
+	{"x=1\necho $((\"x\" + 1))", "x=1\necho $((\"x\" + 1))\n", nil},
+	{"x=1\ny=x\necho $((y))", "x=1\ny=x\necho $((y))\n", nil},
+	{"x=1\ny='x * 2'\necho $(($y))", "x=1\ny='x * 2'\necho $(($y))\n", nil},
+	{"x=1\ny=2\necho $((y))", "y=2\necho $((y))\n", []string{"x"}},
+	{"x=1\ntest -v x", "x=1\ntest -v x\n", nil},
+	{"x=1\n[ -v x ]", "x=1\n[ -v x ]\n", nil},
+	{"x=1\n[", "[\n", []string{"x"}},
+	{"x=1\ntest", "test\n", []string{"x"}},
+	{"x=1\ntest -v", "test -v\n", []string{"x"}},
+	{"tmp=1\ntrap 'rm $tmp' EXIT", "tmp=1\ntrap 'rm $tmp' EXIT\n", nil},
+
+	// variables read dynamically
+	{"x=1\neval foo", "x=1\neval foo\n", nil},
+	{"x=1\n. ./lib.sh", "x=1\n. ./lib.sh\n", nil},
+	{"x=1\necho ${!y}", "x=1\necho ${!y}\n", nil},
+	{"x=1\nset -a\nfoo", "x=1\nset -a\nfoo\n", nil},
+	{"x=1\nset\nfoo", "x=1\nset\nfoo\n", nil},
+	{"x=1\ndeclare -p\nfoo", "x=1\ndeclare -p\nfoo\n", nil},
+	{"x=1\nlocal -n y=z\nfoo", "x=1\nlocal -n y=z\nfoo\n", nil},
+
+	{"set -u\nx=$y\nfoo", "set -u\nx=$y\nfoo\n", nil},
+	{"x=$y\nfoo", "foo\n", []string{"x"}},
+	{"a\n\nx=1\nb", "a\n\nb\n", []string{"x"}},
+	{"{ x=1; foo; }", "{\n\tfoo\n}\n", []string{"x"}},
+	{"x=1 # one\nfoo", "# one\nfoo\n", []string{"x"}},
+}
+
+func TestRemoveDeadVars(t *testing.T) {
+	t.Parallel()
+	for i, tc := range deadVarsTests {
+		t.Run(fmt.Sprintf("%02d", i), func(t *testing.T) {
+			p := syntax.NewParser(syntax.KeepComments)
+			f, err := p.Parse(strings.NewReader(tc.src), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var before bytes.Buffer
+			syntax.NewPrinter().Print(&before, f)
+			f2, removed, err := RemoveDeadVars(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			syntax.NewPrinter().Print(&buf, f2)
+			if got := buf.String(); got != tc.want {
+				t.Fatalf("RemoveDeadVars mismatch in %q:\nwant: %q\ngot:  %q",
+					tc.src, tc.want, got)
+			}
+			if !reflect.DeepEqual(removed, tc.removed) {
+				t.Fatalf("RemoveDeadVars names mismatch in %q:\nwant: %q\ngot:  %q",
+					tc.src, tc.removed, removed)
+			}
+			var after bytes.Buffer
+			syntax.NewPrinter().Print(&after, f)
+			if before.String() != after.String() {
+				t.Fatalf("RemoveDeadVars modified its input:\nwant: %q\ngot:  %q",
+					before.String(), after.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,10 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+// Package transform implements rewrites of shell programs parsed by the
+// syntax package, such as merging the files that a program sources into
+// a single one.
+//
+// This package is a work in progress and EXPERIMENTAL; its API is not
+// subject to the 1.x backwards compatibility guarantee.
+package transform
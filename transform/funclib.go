@@ -0,0 +1,163 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package transform
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// ExtractFuncs moves the definitions of the named functions out of a
+// program and into a new library file, which the program then sources.
+// f itself is not modified.
+//
+// The functions must be defined exactly once, at the top level of the
+// program. They are kept in the order they were defined in, and the
+// command sourcing the library replaces the first of them, so that none
+// is defined later than before. The comment lines right before each
+// definition are moved along with it, while other comments stay in the
+// program.
+//
+// path is the argument given to the . command as shell source, such as
+// "./lib.sh" or "$(dirname "$0")/lib.sh". The library's Name is its static
+// value, if any.
+//
+// Both results are printed and parsed again, so their positions do not
+// match f's.
+func ExtractFuncs(f *syntax.File, names []string, path string) (main, lib *syntax.File, err error) {
+	p := syntax.NewParser(syntax.KeepComments)
+	src := ". " + path
+	call, err := p.Parse(strings.NewReader(src), "")
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid library path %q: %v", path, err)
+	}
+	ce, ok := call.Stmts[0].Cmd.(*syntax.CallExpr)
+	if len(call.Stmts) != 1 || !ok || len(ce.Args) != 2 {
+		return nil, nil, fmt.Errorf("invalid library path %q", path)
+	}
+	libName, _ := syntax.StaticValue(ce.Args[1])
+
+	if len(names) == 0 {
+		return nil, nil, fmt.Errorf("no functions to extract")
+	}
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+	defs := make(map[string]int)
+	syntax.Walk(f, func(node syntax.Node) bool {
+		if fd, ok := node.(*syntax.FuncDecl); ok && wanted[fd.Name.Value] {
+			defs[fd.Name.Value]++
+		}
+		return true
+	})
+	var moved []*syntax.Stmt
+	for _, st := range f.Stmts {
+		if fd, ok := st.Cmd.(*syntax.FuncDecl); ok && wanted[fd.Name.Value] {
+			moved = append(moved, st)
+		}
+	}
+	for _, name := range names {
+		switch n := defs[name]; {
+		case n > 1:
+			return nil, nil, fmt.Errorf("function %s is defined more than once", name)
+		case n == 0:
+			return nil, nil, fmt.Errorf("function %s is not defined", name)
+		}
+	}
+	if len(moved) < len(wanted) {
+		return nil, nil, fmt.Errorf("functions to extract must be defined at the top level")
+	}
+
+	// The library holds each definition with its doc comments, while the
+	// program keeps the rest of the comments.
+	printer := syntax.NewPrinter()
+	marker := avoidMarker("__extract", f)
+	var libBuf bytes.Buffer
+	mainFile := *f
+	mainFile.Stmts = nil
+	var pending []syntax.Comment
+	for _, st := range f.Stmts {
+		if fd, ok := st.Cmd.(*syntax.FuncDecl); !ok || !wanted[fd.Name.Value] {
+			if len(pending) > 0 {
+				st2 := *st
+				st2.Comments = append(pending, st.Comments...)
+				st, pending = &st2, nil
+			}
+			mainFile.Stmts = append(mainFile.Stmts, st)
+			continue
+		}
+		doc, rest := docComments(st)
+		if libBuf.Len() > 0 {
+			libBuf.WriteString("\n")
+		}
+		st2 := *st
+		st2.Comments = doc
+		if err := printer.Print(&libBuf, &st2); err != nil {
+			return nil, nil, err
+		}
+		libBuf.WriteString("\n")
+		if st != moved[0] {
+			pending = append(pending, rest...)
+			continue
+		}
+		// the placeholder, to be replaced by the . command, where the
+		// definition started
+		pos := st.Position
+		if len(doc) > 0 && pos.After(doc[0].Pos()) {
+			pos = doc[0].Pos()
+		}
+		mainFile.Stmts = append(mainFile.Stmts, &syntax.Stmt{
+			Comments: rest,
+			Cmd: &syntax.CallExpr{Args: []*syntax.Word{{
+				Parts: []syntax.WordPart{&syntax.Lit{
+					ValuePos: pos,
+					ValueEnd: st.End(),
+					Value:    marker,
+				}},
+			}}},
+			Position: pos,
+		})
+	}
+	mainFile.Last = append(pending, f.Last...)
+
+	var mainBuf bytes.Buffer
+	if err := printer.Print(&mainBuf, &mainFile); err != nil {
+		return nil, nil, err
+	}
+	mainSrc := strings.Replace(mainBuf.String(), marker, src, 1)
+	main, err = p.Parse(strings.NewReader(mainSrc), f.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	lib, err = p.Parse(&libBuf, libName)
+	if err != nil {
+		return nil, nil, err
+	}
+	return main, lib, nil
+}
+
+// docComments splits the comments of a statement into those which
+// document it, being on the lines right before it or at the end of its
+// line, and the rest.
+func docComments(st *syntax.Stmt) (doc, rest []syntax.Comment) {
+	line := st.Position.Line()
+	first := len(st.Comments)
+	for i := len(st.Comments) - 1; i >= 0; i-- {
+		c := st.Comments[i]
+		if !c.Pos().After(st.Position) {
+			if c.Pos().Line() != line-1 {
+				break
+			}
+			line--
+		}
+		first = i
+	}
+	rest = st.Comments[:first:first]
+	doc = st.Comments[first:]
+	return doc, rest
+}
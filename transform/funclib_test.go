@@ -0,0 +1,133 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package transform
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+var extractFuncsTests = []struct {
+	src      string
+	names    []string
+	path     string
+	wantMain string
+	wantLib  string
+}{
+	{
+		"foo() { :; }\nfoo",
+		[]string{"foo"}, "./lib.sh",
+		". ./lib.sh\nfoo\n",
+		"foo() { :; }\n",
+	},
+	{
+		"#!/bin/bash\n\n# foo does foo\nfoo() {\n\tbar\n} # end\n\nbar() { :; }\nfoo",
+		[]string{"foo"}, "./lib.sh",
+		"#!/bin/bash\n\n. ./lib.sh\n\nbar() { :; }\nfoo\n",
+		"# foo does foo\nfoo() {\n\tbar\n} # end\n",
+	},
+	{
+		"a=1\n# one\none() { :; }\nx\n\n# free\n\n# two\ntwo() { :; }\ny",
+		[]string{"two", "one"}, `"$(dirname "$0")/lib.sh"`,
+		"a=1\n. \"$(dirname \"$0\")/lib.sh\"\n\nx\n\n# free\n\ny\n",
+		"# one\none() { :; }\n\n# two\ntwo() { :; }\n",
+	},
+	{
+		"one() { :; }\ntwo() { :; }\n# last",
+		[]string{"one", "two"}, "lib.sh",
+		". lib.sh\n\n# last\n",
+		"one() { :; }\n\ntwo() { :; }\n",
+	},
+}
+
+func TestExtractFuncs(t *testing.T) {
+	t.Parallel()
+	for i, tc := range extractFuncsTests {
+		t.Run(fmt.Sprintf("%02d", i), func(t *testing.T) {
+			p := syntax.NewParser(syntax.KeepComments)
+			f, err := p.Parse(strings.NewReader(tc.src), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var before bytes.Buffer
+			syntax.NewPrinter().Print(&before, f)
+			main, lib, err := ExtractFuncs(f, tc.names, tc.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			syntax.NewPrinter().Print(&buf, main)
+			if got := buf.String(); got != tc.wantMain {
+				t.Fatalf("ExtractFuncs main mismatch in %q:\nwant: %q\ngot:  %q",
+					tc.src, tc.wantMain, got)
+			}
+			buf.Reset()
+			syntax.NewPrinter().Print(&buf, lib)
+			if got := buf.String(); got != tc.wantLib {
+				t.Fatalf("ExtractFuncs lib mismatch in %q:\nwant: %q\ngot:  %q",
+					tc.src, tc.wantLib, got)
+			}
+			var after bytes.Buffer
+			syntax.NewPrinter().Print(&after, f)
+			if before.String() != after.String() {
+				t.Fatalf("ExtractFuncs modified its input:\nwant: %q\ngot:  %q",
+					before.String(), after.String())
+			}
+		})
+	}
+}
+
+func TestExtractFuncsName(t *testing.T) {
+	t.Parallel()
+	f, err := syntax.NewParser().Parse(strings.NewReader("foo() { :; }"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]string{
+		"./lib.sh":      "./lib.sh",
+		"'my lib.sh'":   "my lib.sh",
+		`"$dir/lib.sh"`: "",
+	} {
+		_, lib, err := ExtractFuncs(f, []string{"foo"}, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lib.Name != want {
+			t.Errorf("ExtractFuncs lib name mismatch in %q:\nwant: %q\ngot:  %q",
+				path, want, lib.Name)
+		}
+	}
+}
+
+func TestExtractFuncsError(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		src   string
+		names []string
+		path  string
+		want  string
+	}{
+		{"foo() { :; }", nil, "lib.sh", "no functions to extract"},
+		{"foo() { :; }", []string{"bar"}, "lib.sh", "function bar is not defined"},
+		{"foo() { :; }\nfoo() { :; }", []string{"foo"}, "lib.sh", "function foo is defined more than once"},
+		{"if x; then foo() { :; }; fi", []string{"foo"}, "lib.sh", "must be defined at the top level"},
+		{"foo() { :; }", []string{"foo"}, "lib.sh; rm", "invalid library path"},
+		{"foo() { :; }", []string{"foo"}, "'lib.sh", "invalid library path"},
+	}
+	for _, tc := range tests {
+		f, err := syntax.NewParser().Parse(strings.NewReader(tc.src), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = ExtractFuncs(f, tc.names, tc.path)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("ExtractFuncs error in %q:\nwant: %q\ngot:  %v",
+				tc.src, tc.want, err)
+		}
+	}
+}
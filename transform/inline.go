@@ -0,0 +1,367 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package transform
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"mvdan.cc/sh/analysis"
+	"mvdan.cc/sh/syntax"
+)
+
+// InlineSources returns a copy of a program where the source and .
+// commands are replaced by the contents of the files they read, so that
+// the result is a single self-contained program. Sourced files are
+// inlined recursively. f itself is not modified.
+//
+// Only commands with a single argument whose file is known statically are
+// inlined, and resolve is used to obtain the contents of that file like in
+// analysis.Resolver. Besides static names such as "./lib.sh" or
+// "$dir/lib.sh" where dir has a static value, paths relative to the
+// directory of a script are understood, like in these forms:
+//
+//	source "$(dirname "$0")/lib.sh"
+//	source "${BASH_SOURCE%/*}/lib.sh"
+//
+// Those relative to $0 are relative to the directory of f, while those
+// relative to BASH_SOURCE are relative to the file containing the command.
+// In both cases, the name given to resolve is joined with the directory of
+// f.Name. After inlining a file from another directory, its uses of the
+// directory of BASH_SOURCE are rewritten to keep pointing at the same
+// directory, where possible.
+//
+// A command is kept as it is if resolve returns a nil reader, if its file
+// uses return outside of a function, or if its file is already being
+// inlined, as that would never end. Errors from resolve and parse errors
+// are returned.
+//
+// The result is printed and parsed again, so its positions do not match
+// f's, but comments are kept.
+func InlineSources(f *syntax.File, resolve analysis.ResolveFunc) (*syntax.File, error) {
+	in := &inliner{
+		resolve: resolve,
+		root:    path.Dir(f.Name),
+		marker:  "__inline",
+	}
+	src, err := in.file(f, ".")
+	if err != nil {
+		return nil, err
+	}
+	return syntax.NewParser(syntax.KeepComments).Parse(strings.NewReader(src), f.Name)
+}
+
+type inliner struct {
+	resolve analysis.ResolveFunc
+	root    string   // directory of the main file
+	stack   []string // names of the files being inlined
+	marker  string   // prefix of the placeholder commands
+	count   int      // number of placeholders so far
+}
+
+// avoidMarker makes a placeholder name longer until it doesn't appear in
+// a file.
+func avoidMarker(marker string, f *syntax.File) string {
+	var buf bytes.Buffer
+	syntax.NewPrinter().Print(&buf, f)
+	for bytes.Contains(buf.Bytes(), []byte(marker)) {
+		marker += "_"
+	}
+	return marker
+}
+
+// inlined is a command to be replaced by the contents of a file.
+type inlined struct {
+	stmt    *syntax.Stmt
+	brace   bool // whether it's not part of a list of statements
+	text    string
+	oneLine bool // whether text is a single statement on one line
+}
+
+// file returns the source of a program with its sourced files inlined. dir
+// is the directory of the file relative to the main file's, or empty if it
+// is not known.
+func (in *inliner) file(f *syntax.File, dir string) (string, error) {
+	in.marker = avoidMarker(in.marker, f)
+	in.stack = append(in.stack, f.Name)
+	defer func() { in.stack = in.stack[:len(in.stack)-1] }()
+
+	var vals *analysis.Values
+	var list []*inlined
+	inBinary := make(map[*syntax.Stmt]bool)
+	var err error
+	syntax.Walk(f, func(node syntax.Node) bool {
+		if err != nil {
+			return false
+		}
+		switch x := node.(type) {
+		case *syntax.BinaryCmd:
+			inBinary[x.X], inBinary[x.Y] = true, true
+		case *syntax.Stmt:
+			ce, ok := x.Cmd.(*syntax.CallExpr)
+			if !ok || len(ce.Assigns) > 0 || len(ce.Args) != 2 ||
+				x.Negated || x.Background || x.Coprocess || len(x.Redirs) > 0 {
+				break
+			}
+			if name := ce.Args[0].Lit(); name != "source" && name != "." {
+				break
+			}
+			arg := ce.Args[1]
+			name, sub, ok := in.target(f, dir, arg)
+			if !ok {
+				if vals == nil {
+					vals = analysis.StaticValues(f)
+				}
+				if name, ok = vals.Word(arg); !ok {
+					break
+				}
+			}
+			il, serr := in.source(f.Name, arg.Pos(), name, sub)
+			if err = serr; err != nil {
+				return false
+			}
+			if il != nil {
+				il.stmt, il.brace = x, inBinary[x]
+				list = append(list, il)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return "", err
+	}
+	if dir != "" && dir != "." {
+		relocate(f, dir)
+	}
+
+	// Print the program with placeholder commands, and replace them by
+	// the inlined files afterwards, as positions from different files
+	// can't be mixed in a syntax tree.
+	olds := make([]syntax.Command, len(list))
+	names := make([]string, len(list))
+	for i, il := range list {
+		in.count++
+		names[i] = in.marker + strconv.Itoa(in.count)
+		olds[i] = il.stmt.Cmd
+		il.stmt.Cmd = &syntax.CallExpr{Args: []*syntax.Word{{
+			Parts: []syntax.WordPart{&syntax.Lit{
+				ValuePos: olds[i].Pos(),
+				ValueEnd: olds[i].End(),
+				Value:    names[i],
+			}},
+		}}}
+	}
+	var buf bytes.Buffer
+	err = syntax.NewPrinter().Print(&buf, f)
+	for i, il := range list {
+		il.stmt.Cmd = olds[i]
+	}
+	if err != nil {
+		return "", err
+	}
+	src := buf.String()
+	for i, il := range list {
+		text := strings.TrimSuffix(il.text, "\n")
+		j := strings.Index(src, names[i])
+		ownLine := strings.TrimLeft(src[strings.LastIndexByte(src[:j], '\n')+1:j], " \t") == "" &&
+			strings.HasPrefix(src[j+len(names[i]):]+"\n", "\n")
+		switch {
+		case text == "":
+			text = ":"
+		case il.brace || (!ownLine && !il.oneLine):
+			// a list of statements, or one which must end its line
+			text = "{\n" + text + "\n}"
+		}
+		src = src[:j] + text + src[j+len(names[i]):]
+	}
+	return src, nil
+}
+
+// target returns the name of the file sourced by arg if it is relative to
+// the directory of a script, along with its directory relative to the
+// main file's, which is empty if not known.
+func (in *inliner) target(f *syntax.File, dir string, arg *syntax.Word) (name, sub string, ok bool) {
+	param, rest, ok := scriptDir(arg)
+	if !ok || !strings.HasPrefix(rest, "/") {
+		return "", "", false
+	}
+	rest = rest[1:]
+	switch {
+	case param == "0":
+		// $0 is the main file, no matter where we are
+		rel := path.Join(".", rest)
+		return path.Join(in.root, rel), path.Dir(rel), true
+	case dir != "":
+		rel := path.Join(dir, rest)
+		return path.Join(in.root, rel), path.Dir(rel), true
+	}
+	return path.Join(path.Dir(f.Name), rest), "", true
+}
+
+// source returns the contents of a sourced file with its own sourced
+// files inlined, or nil if the command sourcing it should be kept.
+// Problems are reported at pos in the file named from.
+func (in *inliner) source(from string, pos syntax.Pos, name, dir string) (*inlined, error) {
+	for _, name2 := range in.stack {
+		if name2 == name {
+			return nil, nil
+		}
+	}
+	r, err := in.resolve(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%s: could not source %s: %v", from, pos, name, err)
+	}
+	if r == nil {
+		return nil, nil
+	}
+	f, err := syntax.NewParser(syntax.KeepComments).Parse(r, name)
+	if err != nil {
+		return nil, err
+	}
+	if hasReturn(f) {
+		return nil, nil
+	}
+	text, err := in.file(f, dir)
+	if err != nil {
+		return nil, err
+	}
+	oneLine := len(f.Stmts) == 1 && len(f.Last) == 0 &&
+		!strings.Contains(strings.TrimSuffix(text, "\n"), "\n")
+	syntax.Walk(f, func(node syntax.Node) bool {
+		if _, ok := node.(*syntax.Comment); ok {
+			oneLine = false
+		}
+		return oneLine
+	})
+	return &inlined{text: text, oneLine: oneLine}, nil
+}
+
+// hasReturn reports whether a file uses return outside of a function,
+// which stops sourcing it.
+func hasReturn(f *syntax.File) bool {
+	found := false
+	syntax.Walk(f, func(node syntax.Node) bool {
+		switch x := node.(type) {
+		case *syntax.FuncDecl:
+			return false
+		case *syntax.CallExpr:
+			if len(x.Args) > 0 && x.Args[0].Lit() == "return" {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// scriptDir splits a word starting with the directory of a script, like
+// "$(dirname "$0")/lib.sh" or ${BASH_SOURCE%/*}/lib.sh, into the parameter
+// holding the script's path, either "0" or "BASH_SOURCE", and the static
+// rest of the word.
+func scriptDir(w *syntax.Word) (param, rest string, ok bool) {
+	if len(w.Parts) == 0 {
+		return "", "", false
+	}
+	restWord := &syntax.Word{Parts: w.Parts[1:]}
+	first := w.Parts[0]
+	if dq, ok := first.(*syntax.DblQuoted); ok && !dq.Dollar && len(dq.Parts) > 0 {
+		first = dq.Parts[0]
+		restWord.Parts = append([]syntax.WordPart{
+			&syntax.DblQuoted{Parts: dq.Parts[1:]},
+		}, restWord.Parts...)
+	}
+	if param = dirParam(first); param == "" {
+		return "", "", false
+	}
+	rest, ok = syntax.StaticValue(restWord)
+	return param, rest, ok
+}
+
+// dirParam returns the parameter holding the path of a script if part
+// expands to its directory, like $(dirname "$0") or ${BASH_SOURCE%/*}.
+func dirParam(part syntax.WordPart) string {
+	switch x := part.(type) {
+	case *syntax.CmdSubst:
+		if len(x.Stmts) != 1 {
+			break
+		}
+		ce, ok := x.Stmts[0].Cmd.(*syntax.CallExpr)
+		if !ok || len(ce.Args) != 2 || ce.Args[0].Lit() != "dirname" ||
+			len(ce.Args[1].Parts) != 1 {
+			break
+		}
+		part := ce.Args[1].Parts[0]
+		if dq, ok := part.(*syntax.DblQuoted); ok && len(dq.Parts) == 1 {
+			part = dq.Parts[0]
+		}
+		if pe, ok := part.(*syntax.ParamExp); ok && pe.Exp == nil {
+			return scriptParam(pe)
+		}
+	case *syntax.ParamExp:
+		if x.Exp != nil && x.Exp.Op == syntax.RemSmallSuffix &&
+			x.Exp.Word != nil && x.Exp.Word.Lit() == "/*" {
+			return scriptParam(x)
+		}
+	}
+	return ""
+}
+
+// scriptParam returns the name of the parameter if pe is $0, $BASH_SOURCE
+// or ${BASH_SOURCE[0]}, ignoring its expansion operator.
+func scriptParam(pe *syntax.ParamExp) string {
+	if pe.Length || pe.Excl || pe.Slice != nil || pe.Repl != nil || pe.Names != 0 {
+		return ""
+	}
+	switch pe.Param.Value {
+	case "0":
+		if pe.Index == nil {
+			return "0"
+		}
+	case "BASH_SOURCE":
+		if pe.Index == nil {
+			return "BASH_SOURCE"
+		}
+		if w, ok := pe.Index.(*syntax.Word); ok && w.Lit() == "0" {
+			return "BASH_SOURCE"
+		}
+	}
+	return ""
+}
+
+// relocate rewrites the uses of the directory of BASH_SOURCE in a file
+// being inlined, which is in dir relative to the main file, so that they
+// point to the same directory once the file is part of the main file.
+func relocate(f *syntax.File, dir string) {
+	for _, r := range dir {
+		if !strings.ContainsRune("./-_+", r) &&
+			!('a' <= r && r <= 'z') && !('A' <= r && r <= 'Z') && !('0' <= r && r <= '9') {
+			return // would need quoting
+		}
+	}
+	syntax.Walk(f, func(node syntax.Node) bool {
+		w, ok := node.(*syntax.Word)
+		if !ok || len(w.Parts) == 0 {
+			return true
+		}
+		parts := &w.Parts
+		if dq, ok := w.Parts[0].(*syntax.DblQuoted); ok && !dq.Dollar && len(dq.Parts) > 0 {
+			parts = &dq.Parts
+		}
+		if dirParam((*parts)[0]) != "BASH_SOURCE" {
+			return true
+		}
+		if len(*parts) > 1 {
+			if lit, ok := (*parts)[1].(*syntax.Lit); ok && strings.HasPrefix(lit.Value, "/") {
+				lit.Value = "/" + dir + lit.Value
+				return true
+			}
+		}
+		lit := &syntax.Lit{Value: "/" + dir}
+		*parts = append((*parts)[:1], append([]syntax.WordPart{lit}, (*parts)[1:]...)...)
+		return true
+	})
+}
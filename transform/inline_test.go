@@ -0,0 +1,139 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package transform
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+func mapResolver(files map[string]string) func(string) (io.Reader, error) {
+	return func(name string) (io.Reader, error) {
+		src, ok := files[name]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		if src == "skip" {
+			return nil, nil
+		}
+		return strings.NewReader(src), nil
+	}
+}
+
+var inlineFiles = map[string]string{
+	"lib.sh":        "# lib\nlibfn() { echo lib; }",
+	"./nested.sh":   "foo\n. lib.sh\nbar",
+	"empty.sh":      "",
+	"skip.sh":       "skip",
+	"ret.sh":        "[ -n \"$x\" ] && return\nx=1",
+	"funcret.sh":    "f() { return 1; }",
+	"loop.sh":       "foo\nsource loop.sh",
+	"bad.sh":        "foo() {",
+	"heredoc.sh":    "cat <<EOF\n  body\nEOF",
+	"sub/a.sh":      "source \"${BASH_SOURCE%/*}/b.sh\"\ncat \"$(dirname \"$BASH_SOURCE\")/data\"\ncd \"$(dirname \"${BASH_SOURCE[0]}\")\"",
+	"sub/b.sh":      "echo b",
+	"inst/lib.sh":   "echo instlib",
+	"inst/x/top.sh": "source \"$(dirname \"$0\")/lib.sh\"",
+}
+
+var inlineTests = []struct {
+	name, src string
+	want      string
+}{
+	{"", "foo", "foo\n"},
+	{"", "source lib.sh", "# lib\nlibfn() { echo lib; }\n"},
+	{"", ". lib.sh\nfoo", "# lib\nlibfn() { echo lib; }\nfoo\n"},
+	{"", "dir=.\n. $dir/nested.sh", "dir=.\nfoo\n# lib\nlibfn() { echo lib; }\nbar\n"},
+	{"", "if x; then\n\tsource lib.sh\nfi", "if x; then\n\t# lib\n\tlibfn() { echo lib; }\nfi\n"},
+	{"", "x && source lib.sh", "x && {\n\t# lib\n\tlibfn() { echo lib; }\n}\n"},
+	{"", "x=$(source lib.sh)", "x=$({\n\t# lib\n\tlibfn() { echo lib; }\n})\n"},
+	{"", "x=$(source sub/b.sh) # b", "x=$(echo b) # b\n"},
+	{"", "source lib.sh # lib", "{\n\t# lib\n\tlibfn() { echo lib; }\n} # lib\n"},
+	{"", "source empty.sh", ":\n"},
+	{"", "x || . empty.sh", "x || :\n"},
+	{"", "source heredoc.sh", "cat <<EOF\n  body\nEOF\n"},
+	{"", "{ source heredoc.sh; }", "{ {\n\tcat <<EOF\n  body\nEOF\n}; }\n"},
+	{"", "source loop.sh", "foo\nsource loop.sh\n"},
+	{"", "source funcret.sh", "f() { return 1; }\n"},
+
+	// kept as they are
+	{"", "source skip.sh", "source skip.sh\n"},
+	{"", "source ret.sh", "source ret.sh\n"},
+	{"", "source lib.sh foo", "source lib.sh foo\n"},
+	{"", "source lib.sh >/dev/null", "source lib.sh >/dev/null\n"},
+	{"", "source lib.sh &", "source lib.sh &\n"},
+	{"", "source $dir/lib.sh", "source $dir/lib.sh\n"},
+	{"", "source", "source\n"},
+
+	// relative to the script's directory
+	{"", "source \"$(dirname \"$0\")/lib.sh\"", "# lib\nlibfn() { echo lib; }\n"},
+	{"", "source \"${0%/*}\"/lib.sh", "# lib\nlibfn() { echo lib; }\n"},
+	{
+		"main.sh", "source ${BASH_SOURCE%/*}/sub/a.sh",
+		"echo b\ncat \"$(dirname \"$BASH_SOURCE\")/sub/data\"\ncd \"$(dirname \"${BASH_SOURCE[0]}\")/sub\"\n",
+	},
+	{"inst/main.sh", "source \"${BASH_SOURCE[0]%/*}/lib.sh\"", "echo instlib\n"},
+	{"inst/main.sh", ". \"$(dirname \"$0\")/x/top.sh\"", "echo instlib\n"},
+}
+
+func TestInlineSources(t *testing.T) {
+	t.Parallel()
+	resolve := mapResolver(inlineFiles)
+	for i, tc := range inlineTests {
+		t.Run(fmt.Sprintf("%02d", i), func(t *testing.T) {
+			p := syntax.NewParser(syntax.KeepComments)
+			f, err := p.Parse(strings.NewReader(tc.src), tc.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var before bytes.Buffer
+			syntax.NewPrinter().Print(&before, f)
+			f2, err := InlineSources(f, resolve)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			syntax.NewPrinter().Print(&buf, f2)
+			if got := buf.String(); got != tc.want {
+				t.Fatalf("InlineSources mismatch in %q:\nwant: %q\ngot:  %q",
+					tc.src, tc.want, got)
+			}
+			var after bytes.Buffer
+			syntax.NewPrinter().Print(&after, f)
+			if before.String() != after.String() {
+				t.Fatalf("InlineSources modified its input:\nwant: %q\ngot:  %q",
+					before.String(), after.String())
+			}
+		})
+	}
+}
+
+func TestInlineSourcesError(t *testing.T) {
+	t.Parallel()
+	resolve := mapResolver(inlineFiles)
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"foo\nsource missing.sh", "2:8: could not source missing.sh"},
+		{"source bad.sh", "bad.sh:1:7"},
+	}
+	for _, tc := range tests {
+		f, err := syntax.NewParser().Parse(strings.NewReader(tc.src), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = InlineSources(f, resolve)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("InlineSources error in %q:\nwant: %q\ngot:  %v",
+				tc.src, tc.want, err)
+		}
+	}
+}
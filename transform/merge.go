@@ -0,0 +1,491 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package transform
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// Merge does a three-way merge of two programs, ours and theirs, which were
+// both changed from a common ancestor, base. It returns the source of the
+// merged program and the number of conflicts in it.
+//
+// Unlike a line-based merge, the programs are merged statement by
+// statement, so changes which only affect their formatting never conflict.
+// Statements added at the same place by both sides are all kept, ours
+// first. When both sides changed the same compound command, such as a
+// function or a loop, the statements within it are merged instead.
+//
+// Any other statement changed by both sides is a conflict, written with
+// the usual markers:
+//
+//	<<<<<<< ours
+//	echo foo
+//	=======
+//	echo bar
+//	>>>>>>> theirs
+//
+// The merged program is printed with the default printer options. Since
+// the markers aren't valid shell, it can only be parsed and formatted
+// again if there were no conflicts.
+func Merge(base, ours, theirs *syntax.File) ([]byte, int, error) {
+	m := merger{marker: "__merge"}
+	for _, f := range []*syntax.File{base, ours, theirs} {
+		m.marker = avoidMarker(m.marker, f)
+	}
+	text, err := m.list(&base.StmtList, &ours.StmtList, &theirs.StmtList)
+	if err != nil {
+		return nil, 0, err
+	}
+	if text != "" {
+		text += "\n"
+	}
+	return []byte(text), m.conflicts, nil
+}
+
+type merger struct {
+	marker    string
+	count     int
+	conflicts int
+}
+
+// mergeOut builds the source of a merged list of statements.
+type mergeOut struct {
+	bytes.Buffer
+}
+
+// stmt writes the source of a statement, which was at index i in its
+// original list. i may be past the end of the list, such as for a conflict
+// where ours removed the last statements, in which case no empty line is
+// kept before it.
+func (o *mergeOut) stmt(text string, list []*syntax.Stmt, i int) {
+	if o.Len() > 0 {
+		o.WriteByte('\n')
+		if i > 0 && i < len(list) && startLine(list[i]) > endLine(list[i-1])+1 {
+			o.WriteByte('\n')
+		}
+	}
+	o.WriteString(text)
+}
+
+func (m *merger) print(node syntax.Node) (string, error) {
+	var buf bytes.Buffer
+	if err := syntax.NewPrinter().Print(&buf, node); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// stmts writes a number of statements from a list, starting at index i.
+func (m *merger) stmts(o *mergeOut, list []*syntax.Stmt, i int, stmts []*syntax.Stmt) error {
+	for j, s := range stmts {
+		text, err := m.print(s)
+		if err != nil {
+			return err
+		}
+		o.stmt(text, list, i+j)
+	}
+	return nil
+}
+
+// list returns the source of the merged statements of three lists.
+func (m *merger) list(base, ours, theirs *syntax.StmtList) (string, error) {
+	bs, os, ts := base.Stmts, ours.Stmts, theirs.Stmts
+	bKeys, oKeys, tKeys := stmtKeys(bs), stmtKeys(os), stmtKeys(ts)
+	inOurs, inTheirs := matchKeys(bKeys, oKeys), matchKeys(bKeys, tKeys)
+
+	var o mergeOut
+	i, j, k := 0, 0, 0
+	for {
+		// find the next statement which neither side changed
+		n := i
+		for n < len(bs) && (inOurs[n] < 0 || inTheirs[n] < 0) {
+			n++
+		}
+		nj, nk := len(os), len(ts)
+		if n < len(bs) {
+			nj, nk = inOurs[n], inTheirs[n]
+		}
+		if err := m.chunk(&o, bs[i:n], bKeys[i:n],
+			os, j, oKeys[j:nj], ts, k, tKeys[k:nk]); err != nil {
+			return "", err
+		}
+		if n == len(bs) {
+			break
+		}
+		if err := m.stmts(&o, os, nj, os[nj:nj+1]); err != nil {
+			return "", err
+		}
+		i, j, k = n+1, nj+1, nk+1
+	}
+
+	// trailing comments aren't statements; keep ours if both changed
+	last, lastList := ours.Last, os
+	if commentsKey(base.Last) == commentsKey(ours.Last) {
+		last, lastList = theirs.Last, ts
+	}
+	for i, c := range last {
+		if o.Len() > 0 {
+			o.WriteByte('\n')
+			if i == 0 && len(lastList) > 0 &&
+				c.Pos().Line() > endLine(lastList[len(lastList)-1])+1 {
+				o.WriteByte('\n')
+			}
+		}
+		o.WriteString("#" + c.Text)
+	}
+	return o.String(), nil
+}
+
+// chunk writes the merge of the statements between two which neither
+// side changed. The statements in ours and theirs start at the indexes j
+// and k of their lists, respectively.
+func (m *merger) chunk(o *mergeOut, bs []*syntax.Stmt, bKeys []string,
+	os []*syntax.Stmt, j int, oKeys []string,
+	ts []*syntax.Stmt, k int, tKeys []string) error {
+	oChunk, tChunk := os[j:j+len(oKeys)], ts[k:k+len(tKeys)]
+	switch {
+	case equalKeys(oKeys, tKeys), equalKeys(bKeys, tKeys):
+		return m.stmts(o, os, j, oChunk)
+	case equalKeys(bKeys, oKeys):
+		return m.stmts(o, ts, k, tChunk)
+	case len(bKeys) == 0:
+		// independent insertions
+		if err := m.stmts(o, os, j, oChunk); err != nil {
+			return err
+		}
+		inserted := make(map[string]bool, len(oKeys))
+		for _, key := range oKeys {
+			inserted[key] = true
+		}
+		for i, s := range tChunk {
+			if !inserted[tKeys[i]] {
+				if err := m.stmts(o, ts, k+i, []*syntax.Stmt{s}); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	case len(bs) == 1 && len(oChunk) == 1 && len(tChunk) == 1:
+		text, err := m.nested(bs[0], oChunk[0], tChunk[0])
+		if err != nil {
+			return err
+		}
+		if text != "" {
+			o.stmt(text, os, j)
+			return nil
+		}
+	}
+	m.conflicts++
+	var ours, theirs mergeOut
+	if err := m.stmts(&ours, os, j, oChunk); err != nil {
+		return err
+	}
+	if err := m.stmts(&theirs, ts, k, tChunk); err != nil {
+		return err
+	}
+	var conflict bytes.Buffer
+	conflict.WriteString("<<<<<<< ours\n")
+	if ours.Len() > 0 {
+		conflict.WriteString(ours.String() + "\n")
+	}
+	conflict.WriteString("=======\n")
+	if theirs.Len() > 0 {
+		conflict.WriteString(theirs.String() + "\n")
+	}
+	conflict.WriteString(">>>>>>> theirs")
+	o.stmt(conflict.String(), os, j)
+	return nil
+}
+
+// nested merges three versions of a compound command by merging the
+// statements within it. It returns an empty string if that's not possible,
+// such as when both sides changed the command itself.
+func (m *merger) nested(base, ours, theirs *syntax.Stmt) (string, error) {
+	bShell, bLists := hollow(base)
+	oShell, oLists := hollow(ours)
+	tShell, tLists := hollow(theirs)
+	if bShell == nil || oShell == nil || tShell == nil ||
+		len(bLists) != len(oLists) || len(oLists) != len(tLists) {
+		return "", nil
+	}
+	for _, s := range []*syntax.Stmt{base, ours, theirs} {
+		if !reindentable(s) {
+			return "", nil
+		}
+	}
+	// the lists are merged separately, so compare the rest
+	bOrig, oOrig, tOrig := emptyLists(bLists), emptyLists(oLists), emptyLists(tLists)
+	bKey, oKey, tKey := nodeKey(bShell), nodeKey(oShell), nodeKey(tShell)
+	shell, lists, origs := oShell, oLists, oOrig
+	switch {
+	case oKey == tKey, bKey == tKey:
+	case bKey == oKey:
+		shell, lists, origs = tShell, tLists, tOrig
+	default:
+		return "", nil
+	}
+
+	// print the command with a placeholder for each list, which must be
+	// on a line of its own for the merged statements to replace it
+	placeholders := make([]string, len(lists))
+	for i, list := range lists {
+		if len(origs[i].Stmts) == 0 {
+			return "", nil
+		}
+		first := origs[i].Stmts[0]
+		pos := first.Pos()
+		if cs := first.Comments; len(cs) > 0 && pos.After(cs[0].Pos()) {
+			pos = cs[0].Pos()
+		}
+		placeholders[i] = m.marker + strconv.Itoa(m.count)
+		m.count++
+		*list = syntax.StmtList{Stmts: []*syntax.Stmt{{
+			Position: pos,
+			Cmd: &syntax.CallExpr{Args: []*syntax.Word{{
+				Parts: []syntax.WordPart{&syntax.Lit{
+					ValuePos: pos,
+					ValueEnd: pos,
+					Value:    placeholders[i],
+				}},
+			}}},
+		}}}
+	}
+	text, err := m.print(shell)
+	if err != nil {
+		return "", err
+	}
+	lines := strings.Split(text, "\n")
+	indexes := make([]int, len(placeholders))
+	for i, ph := range placeholders {
+		indexes[i] = -1
+		for l, line := range lines {
+			if strings.TrimSpace(line) == ph {
+				indexes[i] = l
+			}
+		}
+		if indexes[i] < 0 {
+			return "", nil
+		}
+	}
+	merged := make(map[int]string, len(indexes))
+	for i, l := range indexes {
+		text, err := m.list(&bOrig[i], &oOrig[i], &tOrig[i])
+		if err != nil {
+			return "", err
+		}
+		line := lines[l]
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		mergedLines := strings.Split(text, "\n")
+		for i, ml := range mergedLines {
+			if ml != "" && !isMarker(ml) {
+				mergedLines[i] = indent + ml
+			}
+		}
+		merged[l] = strings.Join(mergedLines, "\n")
+	}
+	var buf bytes.Buffer
+	for l, line := range lines {
+		if text, ok := merged[l]; ok {
+			line = text
+		} else if _, ok := merged[l-1]; ok && line == "" {
+			continue // the placeholder ends earlier than the list did
+		}
+		if l > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(line)
+	}
+	return buf.String(), nil
+}
+
+// hollow returns a copy of a compound command and pointers to the lists of
+// statements within it, which can be replaced without modifying the
+// original. It returns nil if the command has no such lists.
+func hollow(s *syntax.Stmt) (*syntax.Stmt, []*syntax.StmtList) {
+	s2 := *s
+	switch x := s.Cmd.(type) {
+	case *syntax.Block:
+		x2 := *x
+		s2.Cmd = &x2
+		return &s2, []*syntax.StmtList{&x2.StmtList}
+	case *syntax.Subshell:
+		x2 := *x
+		s2.Cmd = &x2
+		return &s2, []*syntax.StmtList{&x2.StmtList}
+	case *syntax.FuncDecl:
+		body, lists := hollow(x.Body)
+		if body == nil {
+			return nil, nil
+		}
+		x2 := *x
+		x2.Body = body
+		s2.Cmd = &x2
+		return &s2, lists
+	case *syntax.IfClause:
+		x2 := *x
+		s2.Cmd = &x2
+		lists := []*syntax.StmtList{&x2.Then}
+		if len(x.Else.Stmts) > 0 && !x.FollowedByElif() {
+			lists = append(lists, &x2.Else)
+		}
+		return &s2, lists
+	case *syntax.WhileClause:
+		x2 := *x
+		s2.Cmd = &x2
+		return &s2, []*syntax.StmtList{&x2.Do}
+	case *syntax.ForClause:
+		x2 := *x
+		s2.Cmd = &x2
+		return &s2, []*syntax.StmtList{&x2.Do}
+	}
+	return nil, nil
+}
+
+// emptyLists empties a number of lists, returning their previous contents.
+func emptyLists(lists []*syntax.StmtList) []syntax.StmtList {
+	origs := make([]syntax.StmtList, len(lists))
+	for i, list := range lists {
+		origs[i] = *list
+		*list = syntax.StmtList{}
+	}
+	return origs
+}
+
+// reindentable reports whether a statement means the same if its lines are
+// indented, which isn't the case with heredocs or multi-line strings.
+func reindentable(s *syntax.Stmt) bool {
+	ok := true
+	syntax.Walk(s, func(node syntax.Node) bool {
+		switch x := node.(type) {
+		case *syntax.Redirect:
+			if x.Op == syntax.Hdoc || x.Op == syntax.DashHdoc {
+				ok = false
+			}
+		case *syntax.Lit:
+			if strings.Contains(x.Value, "\n") {
+				ok = false
+			}
+		case *syntax.SglQuoted:
+			if strings.Contains(x.Value, "\n") {
+				ok = false
+			}
+		}
+		return ok
+	})
+	return ok
+}
+
+func isMarker(line string) bool {
+	for _, prefix := range [...]string{"<<<<<<< ", "=======", ">>>>>>> "} {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeKey returns a key for a node, so that two nodes have the same key if
+// they only differ in their formatting.
+func nodeKey(node syntax.Node) string {
+	var buf bytes.Buffer
+	syntax.SexpPrint(&buf, node)
+	return sexpPos.ReplaceAllString(buf.String(), "($1")
+}
+
+func stmtKeys(stmts []*syntax.Stmt) []string {
+	keys := make([]string, len(stmts))
+	for i, s := range stmts {
+		keys[i] = nodeKey(s)
+	}
+	return keys
+}
+
+func commentsKey(cs []syntax.Comment) string {
+	var buf bytes.Buffer
+	for _, c := range cs {
+		buf.WriteString(c.Text + "\n")
+	}
+	return buf.String()
+}
+
+func equalKeys(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// matchKeys matches the keys in a to those in b via their longest common
+// subsequence. The result holds the index in b of each key in a, or -1 if
+// it has no match.
+func matchKeys(a, b []string) []int {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	match := make([]int, len(a))
+	i, j := 0, 0
+	for i < len(a) {
+		switch {
+		case j < len(b) && a[i] == b[j]:
+			match[i] = j
+			i++
+			j++
+		case j == len(b) || lcs[i+1][j] >= lcs[i][j+1]:
+			match[i] = -1
+			i++
+		default:
+			j++
+		}
+	}
+	return match
+}
+
+// startLine returns the first line of a statement, including the comments
+// before it.
+func startLine(s *syntax.Stmt) uint {
+	line := s.Pos().Line()
+	for _, c := range s.Comments {
+		if l := c.Pos().Line(); l < line {
+			line = l
+		}
+	}
+	return line
+}
+
+// endLine returns the last line of a statement, including the comments
+// after it.
+func endLine(s *syntax.Stmt) uint {
+	line := s.End().Line()
+	for _, c := range s.Comments {
+		if l := c.Pos().Line(); l > line {
+			line = l
+		}
+	}
+	return line
+}
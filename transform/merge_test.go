@@ -0,0 +1,142 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package transform
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+var mergeTests = []struct {
+	base, ours, theirs string
+	want               string
+	conflicts          int
+}{
+	{"a\nb", "a\nb", "a\nb", "a\nb\n", 0},
+	{"a\nb", "a\nb\nc", "a\nb", "a\nb\nc\n", 0},
+	{"a\nb", "a\nb", "x\na\nb", "x\na\nb\n", 0},
+	{"a\nb", "a\nb\nc", "x\na\nb", "x\na\nb\nc\n", 0},
+	{"a\nb", "a\nx\nb", "a\ny\nb", "a\nx\ny\nb\n", 0},
+	{"a\nb", "a\nx\nb", "a\nx\nb", "a\nx\nb\n", 0},
+	{"a\nb\nc", "a\nc", "a\nb\nc", "a\nc\n", 0},
+	{"a\nb\nc", "a\nc", "a\nb\nc\nd", "a\nc\nd\n", 0},
+	{"a\nb\nc", "a\nb2\nc", "a\nb\nc\nd", "a\nb2\nc\nd\n", 0},
+
+	// formatting changes are not conflicts
+	{"a\nb", "a;   b", "a\nb\nc", "a\nb\nc\n", 0},
+	{"if x; then y; fi", "if x\nthen\n\ty\nfi", "if x; then z; fi", "if x; then z; fi\n", 0},
+	{"a\n\nb", "a\n\nb", "a\n\nb\n\nc", "a\n\nb\n\nc\n", 0},
+
+	// comments are changes too
+	{"a\nb", "a # one\nb", "a\nb\nc", "a # one\nb\nc\n", 0},
+	{"a\n# end", "a\n# end", "a\n# the end", "a\n# the end\n", 0},
+
+	// nested statements
+	{
+		"f() {\n\ta\n\tb\n}",
+		"f() {\n\ta\n\tx\n\tb\n}",
+		"f() {\n\ta\n\tb\n\ty\n}",
+		"f() {\n\ta\n\tx\n\tb\n\ty\n}\n", 0,
+	},
+	{
+		"for i in 1 2; do\n\tfoo\ndone",
+		"for i in 1 2 3; do\n\tfoo\ndone",
+		"for i in 1 2; do\n\tfoo\n\tbar\ndone",
+		"for i in 1 2 3; do\n\tfoo\n\tbar\ndone\n", 0,
+	},
+	{
+		"if x; then\n\ta\nelse\n\tb\nfi",
+		"if x; then\n\ta1\nelse\n\tb\nfi",
+		"if x; then\n\ta\nelse\n\tb2\nfi",
+		"if x; then\n\ta1\nelse\n\tb2\nfi\n", 0,
+	},
+
+	// conflicts
+	{
+		"a\nb",
+		"a\nb1",
+		"a\nb2",
+		"a\n<<<<<<< ours\nb1\n=======\nb2\n>>>>>>> theirs\n", 1,
+	},
+	{
+		"a\nb\nc",
+		"a\nc",
+		"a\nb2\nc",
+		"a\n<<<<<<< ours\n=======\nb2\n>>>>>>> theirs\nc\n", 1,
+	},
+	{
+		"f() {\n\ta\n\tb\n}",
+		"f() {\n\ta\n\tb1\n}",
+		"f() {\n\ta\n\tb2\n}",
+		"f() {\n\ta\n<<<<<<< ours\n\tb1\n=======\n\tb2\n>>>>>>> theirs\n}\n", 1,
+	},
+	{
+		"a\nb",
+		"a",
+		"a\nB",
+		"a\n<<<<<<< ours\n=======\nB\n>>>>>>> theirs\n", 1,
+	},
+	{
+		"a\na\na",
+		"a\na",
+		"a\na\na\na",
+		"a\na\n<<<<<<< ours\n=======\na\na\n>>>>>>> theirs\n", 1,
+	},
+	{
+		"f() {\n\ta\n}",
+		"g() {\n\ta\n}",
+		"f() {\n\tb\n}",
+		"g() {\n\tb\n}\n", 0,
+	},
+	{
+		"f() {\n\ta\n}",
+		"g() {\n\ta\n}",
+		"h() {\n\ta\n}",
+		"<<<<<<< ours\ng() {\n\ta\n}\n=======\nh() {\n\ta\n}\n>>>>>>> theirs\n", 1,
+	},
+	{
+		"f() {\n\tcat <<EOF\nfoo\nEOF\n\ta\n}",
+		"f() {\n\tcat <<EOF\nfoo\nEOF\n\ta1\n}",
+		"f() {\n\tcat <<EOF\nfoo\nEOF\n\ta2\n}",
+		"<<<<<<< ours\nf() {\n\tcat <<EOF\nfoo\nEOF\n\ta1\n}\n=======\nf() {\n\tcat <<EOF\nfoo\nEOF\n\ta2\n}\n>>>>>>> theirs\n", 1,
+	},
+}
+
+func TestMerge(t *testing.T) {
+	t.Parallel()
+	for i, tc := range mergeTests {
+		t.Run(fmt.Sprintf("%02d", i), func(t *testing.T) {
+			p := syntax.NewParser(syntax.KeepComments)
+			var files [3]*syntax.File
+			for i, src := range []string{tc.base, tc.ours, tc.theirs} {
+				f, err := p.Parse(strings.NewReader(src), "")
+				if err != nil {
+					t.Fatal(err)
+				}
+				files[i] = f
+			}
+			merged, conflicts, err := Merge(files[0], files[1], files[2])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(merged); got != tc.want {
+				t.Fatalf("Merge mismatch in %q:\nwant: %q\ngot:  %q",
+					tc.ours, tc.want, got)
+			}
+			if conflicts != tc.conflicts {
+				t.Fatalf("Merge conflicts mismatch in %q: want %d, got %d",
+					tc.ours, tc.conflicts, conflicts)
+			}
+			if conflicts > 0 {
+				return
+			}
+			if _, err := p.Parse(strings.NewReader(tc.want), ""); err != nil {
+				t.Fatalf("Merge result does not parse: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,350 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package transform
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// Normalize returns a canonical form of a program, so that programs which
+// only differ in their formatting, comments, quoting, or in the names of
+// their variables and functions result in the same syntax tree. This helps
+// find copies of a program which were changed to avoid detection, such as
+// malicious scripts. f itself is not modified.
+//
+// Comments are dropped, and the program is simplified like with
+// syntax.Simplify. Words which are known statically, such as e'ch'"o" or
+// $'\x65cho', are rewritten as plain literals, or as a single-quoted
+// string if they need quoting.
+//
+// Variables assigned by the program are renamed v1, v2 and so on, and the
+// functions it defines f1, f2 and so on, in the order in which they first
+// appear. Variables with a special meaning to the shell, such as PATH or
+// IFS, and those exported to other programs are not renamed.
+//
+// The result is not meant to be run, but to be compared or printed; see
+// StructuralHash.
+func Normalize(f *syntax.File) (*syntax.File, error) {
+	// a copy of the program without comments
+	var buf bytes.Buffer
+	if err := syntax.NewPrinter().Print(&buf, f); err != nil {
+		return nil, err
+	}
+	f, err := syntax.NewParser().Parse(&buf, f.Name)
+	if err != nil {
+		return nil, err
+	}
+	syntax.Simplify(f)
+	normalizeWords(f)
+	renameSymbols(f)
+	return f, nil
+}
+
+var sexpPos = regexp.MustCompile(`\(([A-Za-z]+)@[0-9]+:[0-9]+`)
+
+// StructuralHash returns the SHA-256 hash of the syntax tree of a
+// program's normal form, as returned by Normalize. Two programs with the
+// same hash are the same, save for what Normalize ignores, regardless of
+// how they are formatted.
+func StructuralHash(f *syntax.File) ([sha256.Size]byte, error) {
+	f, err := Normalize(f)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	var buf bytes.Buffer
+	if err := syntax.SexpPrint(&buf, f); err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	// positions are only layout
+	sexp := sexpPos.ReplaceAll(buf.Bytes(), []byte("($1"))
+	return sha256.Sum256(sexp), nil
+}
+
+// normalizeWords rewrites the static words in a program as canonical
+// literals.
+func normalizeWords(f *syntax.File) {
+	keep := make(map[*syntax.Word]bool)
+	// words in arithmetic expressions, where quotes separate tokens and
+	// characters like + and : are operators
+	keepArithm := func(exprs ...syntax.ArithmExpr) {
+		for _, expr := range exprs {
+			if w, ok := expr.(*syntax.Word); ok {
+				keep[w] = true
+			}
+		}
+	}
+	syntax.Walk(f, func(node syntax.Node) bool {
+		switch x := node.(type) {
+		case *syntax.Redirect:
+			if x.Op == syntax.Hdoc || x.Op == syntax.DashHdoc {
+				// quoting the delimiter disables expansions, and
+				// the body isn't a word to be quoted
+				keep[x.Word] = true
+				keep[x.Hdoc] = true
+			}
+		case *syntax.Assign:
+			keepArithm(x.Index)
+		case *syntax.ParamExp:
+			keepArithm(x.Index)
+			if x.Slice != nil {
+				keepArithm(x.Slice.Offset, x.Slice.Length)
+			}
+		case *syntax.ArithmExp:
+			keepArithm(x.X)
+		case *syntax.ArithmCmd:
+			keepArithm(x.X)
+		case *syntax.LetClause:
+			keepArithm(x.Exprs...)
+		case *syntax.CStyleLoop:
+			keepArithm(x.Init, x.Cond, x.Post)
+		case *syntax.BinaryArithm:
+			keepArithm(x.X, x.Y)
+		case *syntax.UnaryArithm:
+			keepArithm(x.X)
+		case *syntax.ParenArithm:
+			keepArithm(x.X)
+		case *syntax.Word:
+			if keep[x] || len(x.Parts) == 0 {
+				break
+			}
+			if _, ok := x.Parts[0].(*syntax.Lit); ok && len(x.Parts) == 1 {
+				break // already a literal
+			}
+			val, ok := syntax.StaticValue(x)
+			if !ok {
+				break
+			}
+			if strings.Contains(val, "'") {
+				break // escaping single quotes would not be simpler
+			}
+			q := syntax.QuoteWord(val)
+			switch y := q.Parts[0].(type) {
+			case *syntax.Lit:
+				y.ValuePos, y.ValueEnd = x.Pos(), x.End()
+			case *syntax.SglQuoted:
+				y.Left, y.Right = x.Pos(), x.End()
+			}
+			x.Parts = q.Parts
+		}
+		return true
+	})
+}
+
+// nameOpts lists, for each command which takes names of variables as
+// arguments, the flags that consume the following argument.
+var nameOpts = map[string]string{
+	"read":      "aAdinNptu",
+	"mapfile":   "dnOsuCc",
+	"readarray": "dnOsuCc",
+	"printf":    "v",
+	"getopts":   "",
+	"unset":     "",
+}
+
+// nameArgs returns the arguments of a call which are names of variables,
+// like x in "read -r x" or "printf -v x".
+func nameArgs(ce *syntax.CallExpr) []*syntax.Word {
+	if len(ce.Args) == 0 {
+		return nil
+	}
+	cmd := ce.Args[0].Lit()
+	opts, ok := nameOpts[cmd]
+	if !ok {
+		return nil
+	}
+	var names, operands []*syntax.Word
+	args := ce.Args[1:]
+	for i := 0; i < len(args); i++ {
+		arg := args[i].Lit()
+		if arg == "--" {
+			operands = append(operands, args[i+1:]...)
+			break
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			operands = append(operands, args[i])
+			continue
+		}
+		if cmd == "unset" && strings.Contains(arg, "f") {
+			return nil // functions
+		}
+		flag := arg[len(arg)-1:]
+		if strings.Contains(opts, flag) && i+1 < len(args) {
+			i++
+			if flag == "a" || flag == "A" || flag == "v" {
+				names = append(names, args[i])
+			}
+		}
+	}
+	switch cmd {
+	case "printf":
+		return names
+	case "getopts":
+		if len(operands) > 1 {
+			names = append(names, operands[1])
+		}
+		return names
+	}
+	return append(names, operands...)
+}
+
+// renameSymbols gives positional names to the variables and functions
+// defined in a program.
+func renameSymbols(f *syntax.File) {
+	exported := make(map[string]bool)
+	for name := range specialVars {
+		exported[name] = true
+	}
+	vars := make(map[string]string)
+	funcs := make(map[string]string)
+	defVar := func(name string) {
+		if _, ok := vars[name]; ok || exported[name] ||
+			!syntax.ValidName(name) || strings.HasPrefix(name, "LC_") {
+			return
+		}
+		vars[name] = "v" + strconv.Itoa(len(vars)+1)
+	}
+	// First, find what the program exports, as the order in which
+	// names are found matters.
+	syntax.Walk(f, func(node syntax.Node) bool {
+		switch x := node.(type) {
+		case *syntax.DeclClause:
+			export := x.Variant.Value == "export"
+			for _, opt := range x.Opts {
+				if lit := opt.Lit(); strings.HasPrefix(lit, "-") && strings.Contains(lit, "x") {
+					export = true
+				}
+			}
+			if !export {
+				break
+			}
+			for _, as := range x.Assigns {
+				if as.Name != nil {
+					exported[as.Name.Value] = true
+				} else if as.Naked && as.Value != nil {
+					exported[as.Value.Lit()] = true
+				}
+			}
+		case *syntax.CallExpr:
+			if len(x.Args) == 0 {
+				break
+			}
+			for _, as := range x.Assigns {
+				exported[as.Name.Value] = true
+			}
+			if x.Args[0].Lit() == "export" {
+				for _, arg := range x.Args[1:] {
+					name := arg.Lit()
+					if i := strings.IndexByte(name, '='); i > 0 {
+						name = name[:i]
+					}
+					exported[name] = true
+				}
+			}
+		}
+		return true
+	})
+	syntax.Walk(f, func(node syntax.Node) bool {
+		switch x := node.(type) {
+		case *syntax.FuncDecl:
+			if _, ok := funcs[x.Name.Value]; !ok {
+				funcs[x.Name.Value] = "f" + strconv.Itoa(len(funcs)+1)
+			}
+		case *syntax.Assign:
+			if x.Name != nil {
+				defVar(x.Name.Value)
+			} else if x.Naked && x.Value != nil {
+				defVar(x.Value.Lit())
+			}
+		case *syntax.WordIter:
+			defVar(x.Name.Value)
+		case *syntax.ParamExp:
+			if x.Exp != nil && x.Param != nil {
+				switch x.Exp.Op {
+				case syntax.SubstAssgn, syntax.SubstColAssgn:
+					defVar(x.Param.Value)
+				}
+			}
+		case *syntax.CallExpr:
+			for _, arg := range nameArgs(x) {
+				defVar(arg.Lit())
+			}
+		}
+		return true
+	})
+
+	rename := func(lit *syntax.Lit, names map[string]string) {
+		if lit == nil {
+			return
+		}
+		if name, ok := names[lit.Value]; ok {
+			lit.Value = name
+		}
+	}
+	renameWord := func(node syntax.Node) {
+		if w, ok := node.(*syntax.Word); ok && len(w.Parts) == 1 {
+			if lit, ok := w.Parts[0].(*syntax.Lit); ok {
+				rename(lit, vars)
+			}
+		}
+	}
+	syntax.Walk(f, func(node syntax.Node) bool {
+		switch x := node.(type) {
+		case *syntax.FuncDecl:
+			rename(x.Name, funcs)
+		case *syntax.Assign:
+			rename(x.Name, vars)
+			if x.Naked && x.Value != nil {
+				renameWord(x.Value)
+			}
+			renameWord(x.Index)
+		case *syntax.WordIter:
+			rename(x.Name, vars)
+		case *syntax.ParamExp:
+			rename(x.Param, vars)
+			renameWord(x.Index)
+		case *syntax.ArithmExp:
+			renameWord(x.X)
+		case *syntax.ArithmCmd:
+			renameWord(x.X)
+		case *syntax.LetClause:
+			for _, expr := range x.Exprs {
+				renameWord(expr)
+			}
+		case *syntax.CStyleLoop:
+			renameWord(x.Init)
+			renameWord(x.Cond)
+			renameWord(x.Post)
+		case *syntax.BinaryArithm:
+			renameWord(x.X)
+			renameWord(x.Y)
+		case *syntax.UnaryArithm:
+			renameWord(x.X)
+		case *syntax.ParenArithm:
+			renameWord(x.X)
+		case *syntax.UnaryTest:
+			if x.Op == syntax.TsVarSet || x.Op == syntax.TsRefVar {
+				renameWord(x.X)
+			}
+		case *syntax.CallExpr:
+			if len(x.Args) == 0 {
+				break
+			}
+			for _, arg := range nameArgs(x) {
+				renameWord(arg)
+			}
+			if len(x.Args[0].Parts) == 1 {
+				if lit, ok := x.Args[0].Parts[0].(*syntax.Lit); ok {
+					rename(lit, funcs)
+				}
+			}
+		}
+		return true
+	})
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package transform
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+var normalizeTests = []struct {
+	src, want string
+}{
+	{"echo foo", "echo foo\n"},
+	{"# comment\ne'ch'\"o\" $'\\x66oo'", "echo foo\n"},
+	{"echo \"a b\" \"it's\"", "echo 'a b' \"it's\"\n"},
+	{"'if' x; \"a=b\" c", "'if' x\n'a=b' c\n"},
+	{"cat <<'EOF'\n$x\nEOF", "cat <<'EOF'\n$x\nEOF\n"},
+	{"url=x\ncurl \"${url}\" | sh", "v1=x\ncurl \"$v1\" | sh\n"},
+	{"for f in *; do rm $f; done", "for v1 in *; do rm $v1; done\n"},
+	{"read -r -p prompt line\necho $line", "read -r -p prompt v1\necho $v1\n"},
+	{"printf -v out %s x; echo $out", "printf -v v1 %s x\necho $v1\n"},
+	{"n=0; ((n++)); echo $((n + 1))", "v1=0\n((v1++))\necho $((v1 + 1))\n"},
+	{"payload() { :; }\npayload x", "f1() { :; }\nf1 x\n"},
+	{"PATH=/tmp\nexport KEY=x\nTOKEN=y cmd", "PATH=/tmp\nexport KEY=x\nTOKEN=y cmd\n"},
+	{"echo $HOME $undefined", "echo $HOME $undefined\n"},
+	{"foo <<EOF\nbar$\nEOF", "foo <<EOF\nbar$\nEOF\n"},
+	{"let 'i++:'", "let 'i++:'\n"},
+	{"echo $((\"1\" + 2)) ${a:'1'}", "echo $((\"1\" + 2)) ${a:'1'}\n"},
+}
+
+func TestNormalize(t *testing.T) {
+	t.Parallel()
+	for i, tc := range normalizeTests {
+		t.Run(fmt.Sprintf("%02d", i), func(t *testing.T) {
+			f, err := syntax.NewParser(syntax.KeepComments).Parse(strings.NewReader(tc.src), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			f2, err := Normalize(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			syntax.NewPrinter().Print(&buf, f2)
+			if got := buf.String(); got != tc.want {
+				t.Fatalf("Normalize mismatch in %q:\nwant: %q\ngot:  %q",
+					tc.src, tc.want, got)
+			}
+			if _, err := syntax.NewParser().Parse(&buf, ""); err != nil {
+				t.Fatalf("Normalize of %q results in an invalid program: %v", tc.src, err)
+			}
+		})
+	}
+}
+
+var structuralHashTests = []struct {
+	a, b string
+	same bool
+}{
+	{"echo foo", "echo foo", true},
+	{"echo foo", "echo    foo # bar", true},
+	{"echo foo", "\"e\"cho 'foo'", true},
+	{"if a; then b; fi", "if a\nthen\n\tb\nfi", true},
+	{"x=1; echo $x", "y=1\necho ${y}", true},
+	{"echo $x", "echo \"$x\"", false},
+	{"f() { g; }; f", "h() {\n\tg\n}\nh", true},
+	{"echo foo", "echo bar", false},
+	{"echo $HOME", "echo $PWD", false},
+	{"x=1; echo $x", "x=1; echo $y", false},
+	{"a; b", "b; a", false},
+}
+
+func TestStructuralHash(t *testing.T) {
+	t.Parallel()
+	hash := func(src string) [32]byte {
+		f, err := syntax.NewParser().Parse(strings.NewReader(src), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum, err := StructuralHash(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sum
+	}
+	for _, tc := range structuralHashTests {
+		if got := hash(tc.a) == hash(tc.b); got != tc.same {
+			t.Errorf("StructuralHash of %q and %q equal: want %v, got %v",
+				tc.a, tc.b, tc.same, got)
+		}
+	}
+}
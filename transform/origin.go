@@ -0,0 +1,90 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package transform
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"mvdan.cc/sh/syntax"
+)
+
+// Origins records where the statements of a generated program came from,
+// such as the name of the template or the function which built each of
+// them. It helps debug generated programs like installers, as each line
+// can be traced back to the code which produced it.
+//
+// Statements without an origin are treated like any other statement.
+type Origins map[*syntax.Stmt]string
+
+// Comment adds the origin of each statement in a program as a trailing
+// comment, like "# generated-by: origin". f is modified in place.
+func (o Origins) Comment(f *syntax.File) {
+	syntax.Walk(f, func(node syntax.Node) bool {
+		s, ok := node.(*syntax.Stmt)
+		if !ok {
+			return true
+		}
+		origin, ok := o[s]
+		if !ok {
+			return true
+		}
+		text := " generated-by: " + origin
+		for i, c := range s.Comments {
+			if c.End().After(s.End()) {
+				// a statement has at most one trailing comment
+				s.Comments[i].Text += " #" + text
+				return true
+			}
+		}
+		s.Comments = append(s.Comments, syntax.Comment{Hash: s.End(), Text: text})
+		return true
+	})
+}
+
+// Print prints a program like p would, and returns a map from line numbers
+// in the printed source to the origin of the statement starting at each of
+// them. Lines starting nested statements map to the innermost one's origin.
+//
+// The map can be stored alongside the program, as an alternative to Comment
+// which leaves the source untouched. The printed program must be valid Bash
+// for its lines to be found.
+func (o Origins) Print(w io.Writer, p *syntax.Printer, f *syntax.File) (map[uint]string, error) {
+	var buf bytes.Buffer
+	if err := p.Print(&buf, f); err != nil {
+		return nil, err
+	}
+	printed, err := syntax.NewParser().Parse(bytes.NewReader(buf.Bytes()), f.Name)
+	if err != nil {
+		return nil, err
+	}
+	// the statements are in the same order in both trees
+	olds, news := walkStmts(f), walkStmts(printed)
+	if len(olds) != len(news) {
+		return nil, fmt.Errorf("printed program has %d statements, want %d",
+			len(news), len(olds))
+	}
+	lines := make(map[uint]string)
+	for i, s := range olds {
+		if origin, ok := o[s]; ok {
+			lines[news[i].Pos().Line()] = origin
+		}
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+func walkStmts(node syntax.Node) []*syntax.Stmt {
+	var stmts []*syntax.Stmt
+	syntax.Walk(node, func(node syntax.Node) bool {
+		if s, ok := node.(*syntax.Stmt); ok {
+			stmts = append(stmts, s)
+		}
+		return true
+	})
+	return stmts
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package transform
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+func litCall(args ...string) *syntax.Stmt {
+	ce := &syntax.CallExpr{}
+	for _, arg := range args {
+		ce.Args = append(ce.Args, &syntax.Word{
+			Parts: []syntax.WordPart{&syntax.Lit{Value: arg}},
+		})
+	}
+	return &syntax.Stmt{Cmd: ce}
+}
+
+func generated() (*syntax.File, Origins) {
+	a, b := litCall("echo", "a"), litCall("echo", "b")
+	fn := &syntax.Stmt{Cmd: &syntax.FuncDecl{
+		Name: &syntax.Lit{Value: "f"},
+		Body: &syntax.Stmt{Cmd: &syntax.Block{
+			StmtList: syntax.StmtList{Stmts: []*syntax.Stmt{a, b}},
+		}},
+	}}
+	call := litCall("f")
+	f := &syntax.File{StmtList: syntax.StmtList{Stmts: []*syntax.Stmt{fn, call}}}
+	return f, Origins{fn: "funcs.go:10", a: "funcs.go:12", call: "main.go:5"}
+}
+
+func TestOriginsComment(t *testing.T) {
+	t.Parallel()
+	f, origins := generated()
+	origins.Comment(f)
+	var buf bytes.Buffer
+	syntax.NewPrinter().Print(&buf, f)
+	want := `f() {
+	echo a # generated-by: funcs.go:12
+	echo b
+} # generated-by: funcs.go:10
+f # generated-by: main.go:5
+`
+	if got := buf.String(); got != want {
+		t.Fatalf("Origins.Comment mismatch:\nwant: %q\ngot:  %q", want, got)
+	}
+
+	// parsed programs keep their layout
+	f, err := syntax.NewParser(syntax.KeepComments).Parse(strings.NewReader("# doc\nfoo\n\nbar # bar"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	Origins{f.Stmts[0]: "x", f.Stmts[1]: "y"}.Comment(f)
+	buf.Reset()
+	syntax.NewPrinter().Print(&buf, f)
+	want = "# doc\nfoo # generated-by: x\n\nbar # bar # generated-by: y\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("Origins.Comment mismatch:\nwant: %q\ngot:  %q", want, got)
+	}
+}
+
+func TestOriginsPrint(t *testing.T) {
+	t.Parallel()
+	f, origins := generated()
+	var buf bytes.Buffer
+	lines, err := origins.Print(&buf, syntax.NewPrinter(), f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "f() {\n\techo a\n\techo b\n}\nf\n"; buf.String() != want {
+		t.Fatalf("Origins.Print mismatch:\nwant: %q\ngot:  %q", want, buf.String())
+	}
+	want := map[uint]string{1: "funcs.go:10", 2: "funcs.go:12", 5: "main.go:5"}
+	if !reflect.DeepEqual(lines, want) {
+		t.Fatalf("Origins.Print lines mismatch:\nwant: %v\ngot:  %v", want, lines)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package transform
+
+import (
+	"bytes"
+	"sort"
+
+	"mvdan.cc/sh/analysis"
+	"mvdan.cc/sh/syntax"
+)
+
+// Requote returns a copy of a program whose strings use the preferred kind
+// of quotes where that doesn't change their meaning. It applies the fixes
+// of the quote-style rule; see analysis.QuoteStyle. f itself is not
+// modified.
+func Requote(f *syntax.File, quote byte) (*syntax.File, error) {
+	var buf bytes.Buffer
+	if err := syntax.NewPrinter().Print(&buf, f); err != nil {
+		return nil, err
+	}
+	src := buf.Bytes()
+	parser := syntax.NewParser(syntax.KeepComments)
+	f, err := parser.Parse(bytes.NewReader(src), f.Name)
+	if err != nil {
+		return nil, err
+	}
+	var edits []analysis.Edit
+	for _, d := range analysis.NewAnalyzer(analysis.QuoteStyle(quote)).Analyze(f) {
+		if d.Rule == "quote-style" {
+			edits = append(edits, d.Fixes[0].Edits...)
+		}
+	}
+	return parser.Parse(bytes.NewReader(applyEdits(src, edits)), f.Name)
+}
+
+// applyEdits returns a copy of src with edits which don't overlap applied.
+func applyEdits(src []byte, edits []analysis.Edit) []byte {
+	sort.Slice(edits, func(i, j int) bool {
+		return edits[i].Pos.Offset() < edits[j].Pos.Offset()
+	})
+	var buf bytes.Buffer
+	last := uint(0)
+	for _, e := range edits {
+		buf.Write(src[last:e.Pos.Offset()])
+		buf.WriteString(e.Text)
+		last = e.End.Offset()
+	}
+	buf.Write(src[last:])
+	return buf.Bytes()
+}
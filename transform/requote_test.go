@@ -0,0 +1,46 @@
+// Copyright (c) 2018, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package transform
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"mvdan.cc/sh/syntax"
+)
+
+var requoteTests = []struct {
+	quote     byte
+	src, want string
+}{
+	{'\'', `echo "foo" "$x" "a\$b" "it's" # "c"`, "echo 'foo' \"$x\" 'a$b' \"it's\" # \"c\"\n"},
+	{'\'', "f() {\n\tgrep \"x\" <<EOF\n\"y\"\nEOF\n}", "f() {\n\tgrep 'x' <<EOF\n\"y\"\nEOF\n}\n"},
+	{'"', `echo 'foo' 'a$b' $'c' 'd'"e"`, "echo \"foo\" 'a$b' $'c' \"d\"\"e\"\n"},
+	{'"', `echo foo`, "echo foo\n"},
+}
+
+func TestRequote(t *testing.T) {
+	t.Parallel()
+	for i, tc := range requoteTests {
+		t.Run(fmt.Sprintf("%02d", i), func(t *testing.T) {
+			p := syntax.NewParser(syntax.KeepComments)
+			f, err := p.Parse(strings.NewReader(tc.src), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, err = Requote(f, tc.quote)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			syntax.NewPrinter().Print(&buf, f)
+			if got := buf.String(); got != tc.want {
+				t.Fatalf("Requote mismatch in %q:\nwant: %q\ngot:  %q",
+					tc.src, tc.want, got)
+			}
+		})
+	}
+}